@@ -0,0 +1,303 @@
+package app
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	Tier1EnvPrefix = "SUBSTREAMS_TIER1_"
+	Tier2EnvPrefix = "SUBSTREAMS_TIER2_"
+
+	DefaultStateBundleSize = 1_000
+	DefaultMaxSubrequests  = 4
+	DefaultSubrequestsSize = 10_000
+
+	DefaultModuleExecutionBudgetRepeat = 3
+
+	DefaultExecOutPrunerInterval       = time.Hour
+	DefaultIdempotencyExpiryInterval   = time.Hour
+	DefaultResumePointMaxAge           = 7 * 24 * time.Hour
+	DefaultPlanCheckpointMaxAge        = 24 * time.Hour
+	DefaultPlanCheckpointSweepInterval = time.Hour
+
+	DefaultExtensionBreakerBackoff    = 5 * time.Second
+	DefaultExtensionBreakerMaxBackoff = 5 * time.Minute
+
+	DefaultBillingInterval = time.Minute
+)
+
+// LoadTier1Config loads a Tier1Config from the YAML file at `path` (skipped when empty),
+// then from the `SUBSTREAMS_TIER1_<KEY>` environment variables, where `<KEY>` is the
+// upper-cased YAML key (ex: `SUBSTREAMS_TIER1_STATE_STORE_URL`). Defaults are applied
+// to the fields left unset and the resulting config is validated, its required
+// fields included.
+//
+// Fields that cannot be expressed as text (WASM extensions, pipeline options) must
+// be set on the returned config.
+func LoadTier1Config(path string) (*Tier1Config, error) {
+	config := &Tier1Config{}
+	if err := loadConfig(path, Tier1EnvPrefix, config); err != nil {
+		return nil, err
+	}
+	config.setDefaults()
+	if err := config.validateLoaded(); err != nil {
+		return nil, fmt.Errorf("invalid tier1 config: %w", err)
+	}
+	return config, nil
+}
+
+// LoadTier2Config is the Tier2Config equivalent of LoadTier1Config, reading the
+// `SUBSTREAMS_TIER2_<KEY>` environment variables.
+func LoadTier2Config(path string) (*Tier2Config, error) {
+	config := &Tier2Config{}
+	if err := loadConfig(path, Tier2EnvPrefix, config); err != nil {
+		return nil, err
+	}
+	config.setDefaults()
+	if err := config.validateLoaded(); err != nil {
+		return nil, fmt.Errorf("invalid tier2 config: %w", err)
+	}
+	return config, nil
+}
+
+func loadConfig(path string, envPrefix string, config interface{}) error {
+	fields := configFields(config)
+
+	if path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("reading config file: %w", err)
+		}
+
+		values := map[string]interface{}{}
+		if err := yaml.Unmarshal(content, &values); err != nil {
+			return fmt.Errorf("decoding config file %q: %w", path, err)
+		}
+		for key, value := range values {
+			field, found := fields[key]
+			if !found {
+				return fmt.Errorf("config file %q: unknown key %q", path, key)
+			}
+			if value == nil {
+				continue
+			}
+			if list, ok := value.([]interface{}); ok {
+				items := make([]string, len(list))
+				for i, item := range list {
+					items[i] = fmt.Sprint(item)
+				}
+				value = strings.Join(items, ",")
+			}
+			if err := setField(field, fmt.Sprint(value)); err != nil {
+				return fmt.Errorf("config file %q: key %q: %w", path, key, err)
+			}
+		}
+	}
+
+	for key, field := range fields {
+		envName := envPrefix + strings.ToUpper(key)
+		value, found := os.LookupEnv(envName)
+		if !found {
+			continue
+		}
+		if err := setField(field, value); err != nil {
+			return fmt.Errorf("environment variable %s: %w", envName, err)
+		}
+	}
+
+	return nil
+}
+
+// configFields maps the YAML key of each field of `config` to its settable value,
+// fields tagged `yaml:"-"` are skipped.
+func configFields(config interface{}) map[string]reflect.Value {
+	out := map[string]reflect.Value{}
+	value := reflect.ValueOf(config).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		key := strings.Split(value.Type().Field(i).Tag.Get("yaml"), ",")[0]
+		if key == "" || key == "-" {
+			continue
+		}
+		out[key] = value.Field(i)
+	}
+	return out
+}
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	urlType      = reflect.TypeOf(&url.URL{})
+	stringsType  = reflect.TypeOf([]string{})
+)
+
+// setField sets `field` from its text representation, lists being comma-separated.
+func setField(field reflect.Value, value string) error {
+	switch {
+	case field.Type() == durationType:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q: %w", value, err)
+		}
+		field.SetInt(int64(d))
+	case field.Type() == urlType:
+		u, err := url.Parse(value)
+		if err != nil {
+			return fmt.Errorf("invalid url %q: %w", value, err)
+		}
+		field.Set(reflect.ValueOf(u))
+	case field.Type() == stringsType:
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	case field.Kind() == reflect.String:
+		field.SetString(value)
+	case field.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q: %w", value, err)
+		}
+		field.SetBool(b)
+	case field.Kind() == reflect.Uint64:
+		n, err := strconv.ParseUint(strings.ReplaceAll(value, "_", ""), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid unsigned integer %q: %w", value, err)
+		}
+		field.SetUint(n)
+	default:
+		return fmt.Errorf("unsupported config field type %s", field.Type())
+	}
+	return nil
+}
+
+// EffectiveConfig returns the config as it is used, keyed by YAML key, fields that
+// cannot be expressed as text are omitted. The secrets of the URLs (credentials,
+// tokens) are redacted, see redactURL.
+func EffectiveConfig(config interface{}) map[string]interface{} {
+	out := map[string]interface{}{}
+	for key, field := range configFields(config) {
+		switch {
+		case field.Type() == durationType:
+			out[key] = time.Duration(field.Int()).String()
+		case field.Type() == urlType:
+			if u := field.Interface().(*url.URL); u != nil {
+				out[key] = redactURL(u.String())
+			} else {
+				out[key] = ""
+			}
+		case field.Kind() == reflect.String:
+			out[key] = redactURL(field.String())
+		case field.Type() == stringsType:
+			values := make([]string, field.Len())
+			for i := range values {
+				values[i] = redactURL(field.Index(i).String())
+			}
+			out[key] = values
+		default:
+			out[key] = field.Interface()
+		}
+	}
+	return out
+}
+
+const redacted = "REDACTED"
+
+// secretParams are the substrings of the names of the query parameters holding
+// secrets, ex: `?token=`, `?secret_key=`.
+var secretParams = []string{"token", "secret", "password", "passwd", "key", "credential", "signature", "auth"}
+
+// redactURL replaces the user info (DSN credentials, tokens passed as user) and
+// the secret query parameters of `value` when it is a URL, it is returned
+// unchanged otherwise.
+func redactURL(value string) string {
+	if !strings.Contains(value, "://") {
+		return value
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		return redacted
+	}
+	if u.User != nil {
+		u.User = url.User(redacted)
+	}
+	if u.RawQuery != "" {
+		query := u.Query()
+		for name := range query {
+			lower := strings.ToLower(name)
+			for _, secret := range secretParams {
+				if strings.Contains(lower, secret) {
+					query[name] = []string{redacted}
+					break
+				}
+			}
+		}
+		u.RawQuery = query.Encode()
+	}
+	return u.String()
+}
+
+// EffectiveConfigHandler serves the effective config as YAML.
+func EffectiveConfigHandler(config interface{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, err := yaml.Marshal(EffectiveConfig(config))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/yaml")
+		w.Write(content)
+	})
+}
+
+// serveEffectiveConfig serves the effective config on `<listenAddr>/config` until
+// `terminating` is closed.
+func serveEffectiveConfig(listenAddr string, config interface{}, terminating <-chan struct{}, logger *zap.Logger) error {
+	listener, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		return fmt.Errorf("listening on %q: %w", listenAddr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/config", EffectiveConfigHandler(config))
+	server := &http.Server{Handler: mux}
+
+	go func() {
+		<-terminating
+		server.Close()
+	}()
+	go func() {
+		logger.Info("serving effective config", zap.String("listen_addr", listenAddr))
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			logger.Warn("effective config server failed", zap.Error(err))
+		}
+	}()
+	return nil
+}
+
+func validateRequired(fields map[string]string) error {
+	var missing []string
+	for key, value := range fields {
+		if value == "" {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) != 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("missing required config %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
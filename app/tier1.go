@@ -12,39 +12,146 @@ import (
 	"github.com/streamingfast/dmetrics"
 	"github.com/streamingfast/dstore"
 	"github.com/streamingfast/shutter"
+	"github.com/streamingfast/substreams/billing"
 	"github.com/streamingfast/substreams/client"
 	"github.com/streamingfast/substreams/metrics"
+	"github.com/streamingfast/substreams/orchestrator/work"
 	"github.com/streamingfast/substreams/pipeline"
 	"github.com/streamingfast/substreams/service"
+	"github.com/streamingfast/substreams/storage/execout"
+	"github.com/streamingfast/substreams/storage/faulty"
+	"github.com/streamingfast/substreams/storage/idempotency"
+	"github.com/streamingfast/substreams/storage/replica"
+	"github.com/streamingfast/substreams/storage/store"
 	"github.com/streamingfast/substreams/wasm"
 	"go.uber.org/atomic"
 	"go.uber.org/zap"
 )
 
 type Tier1Config struct {
-	MergedBlocksStoreURL    string
-	OneBlocksStoreURL       string
-	ForkedBlocksStoreURL    string
-	BlockStreamAddr         string        // gRPC endpoint to get real-time blocks, can be "" in which live streams is disabled
-	GRPCListenAddr          string        // gRPC address where this app will listen to
-	GRPCShutdownGracePeriod time.Duration // The duration we allow for gRPC connections to terminate gracefully prior forcing shutdown
-	ServiceDiscoveryURL     *url.URL
-
-	StateStoreURL   string
-	StateBundleSize uint64
-	BlockType       string
-
-	MaxSubrequests       uint64
-	SubrequestsSize      uint64
-	SubrequestsEndpoint  string
-	SubrequestsInsecure  bool
-	SubrequestsPlaintext bool
-
-	WASMExtensions  []wasm.WASMExtensioner
-	PipelineOptions []pipeline.PipelineOptioner
-
-	RequestStats bool
-	Tracing      bool
+	MergedBlocksStoreURL    string        `yaml:"merged_blocks_store_url"`
+	OneBlocksStoreURL       string        `yaml:"one_blocks_store_url"`
+	ForkedBlocksStoreURL    string        `yaml:"forked_blocks_store_url"`
+	BlockStreamAddr         string        `yaml:"block_stream_addr"`          // gRPC endpoint to get real-time blocks, can be "" in which live streams is disabled
+	GRPCListenAddr          string        `yaml:"grpc_listen_addr"`           // gRPC address where this app will listen to
+	GRPCShutdownGracePeriod time.Duration `yaml:"grpc_shutdown_grace_period"` // The duration we allow for gRPC connections to terminate gracefully prior forcing shutdown
+	ServiceDiscoveryURL     *url.URL      `yaml:"service_discovery_url"`
+
+	StateStoreURL         string   `yaml:"state_store_url"`
+	StateStoreReplicaURLs []string `yaml:"state_store_replica_urls"` // replicas of the state store, read first in this order (nearest or cheapest first), writes go to state_store_url
+	StateBundleSize       uint64   `yaml:"state_bundle_size"`
+	StateStoreFaults      string   `yaml:"state_store_faults"` // chaos mode, for testing only: faults injected in the calls to the state store (ex: `latency=50ms,throttle=0.01,partial_write=0.005,corrupt_read=0`)
+	BlockType             string   `yaml:"block_type"`
+
+	PinnedCacheURL     string   `yaml:"pinned_cache_url"`     // read-only cache maintained by another provider, serving the files of the pinned modules
+	PinnedModuleHashes []string `yaml:"pinned_module_hashes"` // modules served from pinned_cache_url, always complete and never scheduled
+
+	MaxSubrequests       uint64 `yaml:"max_subrequests"`
+	SubrequestsSize      uint64 `yaml:"subrequests_size"`
+	SubrequestsEndpoint  string `yaml:"subrequests_endpoint"`
+	SubrequestsInsecure  bool   `yaml:"subrequests_insecure"`
+	SubrequestsPlaintext bool   `yaml:"subrequests_plaintext"`
+
+	MaxConcurrentJobsPerModule uint64 `yaml:"max_concurrent_jobs_per_module"` // if not 0, limits the subrequests of a single module running at the same time
+	MaxConcurrentSquashes      uint64 `yaml:"max_concurrent_squashes"`        // if not 0, limits the partial stores merged at the same time by a request, across its store modules
+	MaxPendingMergeBytes       uint64 `yaml:"max_pending_merge_bytes"`        // if not 0, slows down the dispatch of jobs while the partial stores of a request not merged yet exceed it
+	SquashLoadParallelism      uint64 `yaml:"squash_load_parallelism"`        // if above 1, the partial stores of a store module are loaded that many at a time, ahead of the one being merged
+	StoreJobsProduceOutputs    bool   `yaml:"store_jobs_produce_outputs"`     // store jobs also produce the outputs of the output map module when its inputs are available, requires tier2 servers supporting it
+	DevModeDiscardOutputs      bool   `yaml:"dev_mode_discard_outputs"`       // the jobs of development mode requests discard their execution outputs instead of writing them to the outputs cache, requires tier2 servers supporting it
+
+	WASMExtensions       []wasm.WASMExtensioner      `yaml:"-"`
+	PipelineOptions      []pipeline.PipelineOptioner `yaml:"-"`
+	WorkerPoolAutoscaler work.Autoscaler             `yaml:"-"` // if set, resizes the worker pool of each request from its demand
+
+	RequestStats    bool `yaml:"request_stats"`
+	Tracing         bool `yaml:"tracing"`
+	StorageLayoutV2 bool `yaml:"storage_layout_v2"` // write store snapshots and execution outputs using the sharded layout, still reading the previous one
+
+	IdempotentWrites          bool          `yaml:"idempotent_writes"`           // check the store snapshots, execution outputs and flush manifests against a ledger in the state store, so that retries never write them twice
+	IdempotencyExpiryInterval time.Duration `yaml:"idempotency_expiry_interval"` // interval between the scans of the state store deleting the ledger records of the objects since deleted, defaults to 1h
+
+	CommitStoreFlushes bool `yaml:"commit_store_flushes"` // commit the snapshots of the stores flushed together at a boundary with manifests, so that the ones of a flush interrupted midway are not used
+
+	ContentAddressedOutputs bool `yaml:"content_addressed_outputs"` // write the execution outputs segments as blobs named after the hash of their content, shared by the modules producing the same outputs; older servers cannot read them
+
+	WASMRuntime string `yaml:"wasm_runtime"` // runtime executing the modules, `wazero` (default, pure Go) or `wasmtime` (requires cgo), the SUBSTREAMS_WASM_RUNTIME environment variable overriding it
+
+	WASMHostFunctions []string `yaml:"wasm_host_functions"` // sets of host functions exposed to the modules, in addition to the WASMExtensions, among the ones registered with wasm.RegisterHostFunctions (built in: crypto, bigdecimal)
+
+	SchedulerEventLog bool `yaml:"scheduler_event_log"` // record the scheduler decisions of each request in the state store, for postmortems
+	PlanCheckpoints   bool `yaml:"plan_checkpoints"`    // checkpoint the work plan in the state store, so that backprocessing resumes from it after a restart
+	ThroughputStats   bool `yaml:"throughput_stats"`    // persist the throughput measured for each module in the state store, and plan from it
+
+	PlanCheckpointMaxAge time.Duration `yaml:"plan_checkpoint_max_age"` // the plan checkpoints saved longer than this ago are not resumed from, and deleted by a sweep every hour, defaults to 24h
+
+	PackageStatsInterval time.Duration `yaml:"package_stats_interval"` // if not 0, export the orchestration stats of each package (hash of the output module) at this interval, to package_stats_file and/or as metrics
+	PackageStatsFile     string        `yaml:"package_stats_file"`     // if set, the package stats are written to this file as a JSON array
+	PackageStatsMetrics  bool          `yaml:"package_stats_metrics"`  // export the package stats as the `substreams_package_*` gauges, labelled by output module hash
+
+	DisabledCapabilities []string `yaml:"disabled_capabilities"` // capabilities never negotiated with the clients (ex: `slow_execution_progress`)
+
+	AdaptiveJobDuration time.Duration `yaml:"adaptive_job_duration"` // if not 0, size the jobs of each module to take about this duration from its measured throughput, requires throughput_stats
+
+	ModuleExecutionBudget       time.Duration `yaml:"module_execution_budget"`        // if not 0, modules whose execution on a single block exceeds it are reported to the user
+	ModuleExecutionBudgetRepeat uint64        `yaml:"module_execution_budget_repeat"` // number of blocks exceeding the budget before a module is reported, defaults to 3
+
+	ModuleExecutionTimeout time.Duration `yaml:"module_execution_timeout"` // if not 0, executions of a module on a single block taking longer are stopped, failing the request
+	ModuleMaxFuel          uint64        `yaml:"module_max_fuel"`          // if not 0, executions of a module on a single block consuming more fuel (WASM instructions) are stopped, failing the request, only metered by the wasmtime runtime
+
+	MaxConcurrentCPUHeavyModules uint64 `yaml:"max_concurrent_cpu_heavy_modules"` // if not 0, limits the modules hinted `cpu_heavy` executing at the same time, across requests
+
+	ExtensionBreakerThreshold  uint64        `yaml:"extension_breaker_threshold"`   // if not 0, the calls to a WASM extension provider fail immediately, with a transient error, after that many consecutive failed calls
+	ExtensionBreakerBackoff    time.Duration `yaml:"extension_breaker_backoff"`     // time the calls to a failing provider fail immediately, doubled each time it fails again, defaults to 5s
+	ExtensionBreakerMaxBackoff time.Duration `yaml:"extension_breaker_max_backoff"` // upper bound of extension_breaker_backoff, defaults to 5m
+	ExtensionCallTimeout       time.Duration `yaml:"extension_call_timeout"`        // if not 0, the calls to the WASM extensions taking longer fail and count as failed calls, requires extension_breaker_threshold
+
+	MaxConcurrentRequests uint64 `yaml:"max_concurrent_requests"` // if not 0, limits the requests served at the same time, the others wait in the admission queue
+	MaxQueuedRequests     uint64 `yaml:"max_queued_requests"`     // requests waiting for one of max_concurrent_requests to complete, the requests over it are rejected, telling the client to retry later
+
+	MaxStreamsPerKey        uint64        `yaml:"max_streams_per_key"`        // if not 0, limits the requests of each API key (or user without API key) served at the same time, the requests over it are rejected with RESOURCE_EXHAUSTED
+	BackprocessBlocksPerKey uint64        `yaml:"backprocess_blocks_per_key"` // if not 0, the blocks each API key can backprocess on tier2 per key_quota_window, the requests over it fail with RESOURCE_EXHAUSTED telling when to retry
+	StreamedBytesPerKey     uint64        `yaml:"streamed_bytes_per_key"`     // if not 0, the bytes streamed to each API key per key_quota_window, the requests over it fail with RESOURCE_EXHAUSTED telling when to retry
+	KeyQuotaWindow          time.Duration `yaml:"key_quota_window"`           // window of backprocess_blocks_per_key and streamed_bytes_per_key
+
+	RequestChunkSize uint64 `yaml:"request_chunk_size"` // if not 0, backprocess the production mode requests spanning longer ranges in sequential chunks of that many blocks, capping the resources held by each request
+
+	HandoffCatchUpBlocks uint64 `yaml:"handoff_catch_up_blocks"` // if not 0, once a production mode request was backprocessed up to its handoff block, the blocks finalized meanwhile are backprocessed too when they are at least that many, before the live stream starts exactly where the backprocessing ended
+
+	RequestFanOutReplayBlocks uint64 `yaml:"request_fan_out_replay_blocks"` // if not 0, the production mode live requests producing the same responses share a single pipeline, a request joining it when its start is within that many blocks of its head
+
+	Network string `yaml:"network"` // name of the network served, ex: `mainnet`, sent to the clients; the network of the requests is checked against the genesis block of the chain instead
+
+	StoreDeltaStreams bool `yaml:"store_delta_streams"` // let the requests ask for the deltas of their stores with each block (`store_delta_modules`), executing them linearly from their start block
+
+	BlockSource string `yaml:"block_source"` // where the blocks of the streams are read from: `default` (the live source for the blocks it holds), `live-only` (the streams starting below the live source fail) or `merged-files-distance=<blocks>` (the blocks at least that many blocks below the head are read from the merged blocks files), the requests can override it with the `X-Sf-Substreams-Block-Source` header
+
+	MaxReorgDepth uint64 `yaml:"max_reorg_depth"` // if not 0, the store changes of at most that many reversible blocks are retained by each stream, a deeper reorganization fails the stream instead of keeping all of them until they are final
+
+	ResumePointInterval time.Duration `yaml:"resume_point_interval"` // if not 0, the stores of the streams are saved at the final blocks sent, at most once per interval, so that a stream resumed from its cursor is not backprocessed again from the previous store boundary
+
+	AsyncSnapshotWritesQueueSize uint64 `yaml:"async_snapshot_writes_queue_size"` // if not 0, the store snapshots are uploaded in the background while the blocks are processed, up to that many waiting to be uploaded by each request
+
+	StoreSeedURLPrefixes []string `yaml:"store_seed_url_prefixes"` // the packages can seed their stores from the URLs starting with one of these, must match the tier2 servers' config
+
+	PartialReaperInterval time.Duration `yaml:"partial_reaper_interval"` // if not 0, scan the state store at this interval and delete the partial store files covered by a complete snapshot
+	PartialReaperDryRun   bool          `yaml:"partial_reaper_dry_run"`  // only log and count the partial store files the reaper would delete
+	ResumePointMaxAge     time.Duration `yaml:"resume_point_max_age"`    // the partial reaper deletes the resume points written longer than this ago, left by the streams that never ended cleanly, defaults to 168h
+
+	ExecOutAccessTracking bool          `yaml:"execout_access_tracking"` // record the last access of the execution outputs segments, required by execout_max_age on every tier1 and tier2 server
+	ExecOutMaxAge         time.Duration `yaml:"execout_max_age"`         // if not 0, delete the execution outputs segments unused for longer than this, requires execout_access_tracking
+	ExecOutPrunerInterval time.Duration `yaml:"execout_pruner_interval"` // interval between the scans of the state store for unused execution outputs segments, defaults to 1h
+	ExecOutPrunerDryRun   bool          `yaml:"execout_pruner_dry_run"`  // only log and count the execution outputs segments the pruner would delete
+
+	BillingSinkURL  string        `yaml:"billing_sink_url"` // if set, the usage of each request is sent to this sink every billing_interval: `http(s)://<url>` (POST of JSON arrays), `log://`, or a scheme registered with billing.RegisterSink (ex: a Kafka producer)
+	BillingInterval time.Duration `yaml:"billing_interval"` // interval between the billing events of a request, defaults to 1m
+
+	ProgressMessagesPerSecond uint64 `yaml:"progress_messages_per_second"` // if not 0, the modules progress sent to each client is coalesced into at most that many messages per second, the progress of the modules reported in between being merged
+
+	ConfigDumpListenAddr string   `yaml:"config_dump_listen_addr"` // if set, the effective config is served as YAML on `http://<addr>/config`
+	NodeStatus           bool     `yaml:"node_status"`             // serve the `GetNodeStatus` RPC to the authenticated callers, reporting their own requests only
+	NodeStatusOperators  []string `yaml:"node_status_operators"`   // user IDs of the callers of `GetNodeStatus` shown the requests of all users
+
+	ModuleReload bool `yaml:"module_reload"` // serve the `ReloadModule` RPC, replacing the code of a module of a development mode request mid-session, to the user who sent it
 }
 
 type Tier1App struct {
@@ -53,6 +160,7 @@ type Tier1App struct {
 	modules *Modules
 	logger  *zap.Logger
 	isReady *atomic.Bool
+	svc     *service.Tier1Service // set by Run, probing the dependencies for the health checks
 }
 
 func NewTier1(logger *zap.Logger, config *Tier1Config, modules *Modules) *Tier1App {
@@ -73,6 +181,17 @@ func (a *Tier1App) Run() error {
 	if err := a.config.Validate(); err != nil {
 		return fmt.Errorf("invalid app config: %w", err)
 	}
+	if a.config.WASMRuntime != "" {
+		if err := wasm.SetDefaultRuntime(a.config.WASMRuntime); err != nil {
+			return fmt.Errorf("invalid app config: %w", err)
+		}
+	}
+
+	if a.config.ConfigDumpListenAddr != "" {
+		if err := serveEffectiveConfig(a.config.ConfigDumpListenAddr, a.config, a.Terminating(), a.logger); err != nil {
+			return fmt.Errorf("serving effective config: %w", err)
+		}
+	}
 
 	mergedBlocksStore, err := dstore.NewDBinStore(a.config.MergedBlocksStoreURL)
 	if err != nil {
@@ -84,10 +203,50 @@ func (a *Tier1App) Run() error {
 		return fmt.Errorf("failed setting up one-block store from url %q: %w", a.config.OneBlocksStoreURL, err)
 	}
 
-	stateStore, err := dstore.NewStore(a.config.StateStoreURL, "zst", "zstd", true)
+	var stateStore dstore.Store
+	if len(a.config.StateStoreReplicaURLs) != 0 {
+		stateStore, err = replica.NewStoreFromURLs(a.config.StateStoreURL, a.config.StateStoreReplicaURLs, "zst", "zstd", true)
+	} else {
+		stateStore, err = dstore.NewStore(a.config.StateStoreURL, "zst", "zstd", true)
+	}
 	if err != nil {
 		return fmt.Errorf("failed setting up state store from url %q: %w", a.config.StateStoreURL, err)
 	}
+	if a.config.StateStoreFaults != "" {
+		faults, _ := faulty.ParseConfig(a.config.StateStoreFaults) // validated by Validate()
+		a.logger.Warn("injecting faults in the calls to the state store, for testing only", zap.String("state_store_faults", a.config.StateStoreFaults))
+		stateStore = faulty.NewStore(stateStore, faults)
+	}
+
+	if a.config.PartialReaperInterval != 0 {
+		reaperCtx, cancelReaper := context.WithCancel(context.Background())
+		a.OnTerminating(func(_ error) { cancelReaper() })
+		reaper := store.NewPartialReaper(stateStore, a.config.PartialReaperInterval, a.config.PartialReaperDryRun, a.logger)
+		reaper.SetResumePointMaxAge(a.config.ResumePointMaxAge)
+		go reaper.Run(reaperCtx)
+	}
+
+	if a.config.IdempotentWrites {
+		expirerCtx, cancelExpirer := context.WithCancel(context.Background())
+		a.OnTerminating(func(_ error) { cancelExpirer() })
+		go idempotency.NewExpirer(stateStore, a.config.IdempotencyExpiryInterval, a.logger).Run(expirerCtx)
+	}
+
+	if a.config.PlanCheckpoints {
+		plansStore, err := stateStore.SubStore("plans")
+		if err != nil {
+			return fmt.Errorf("plans store: %w", err)
+		}
+		sweeperCtx, cancelSweeper := context.WithCancel(context.Background())
+		a.OnTerminating(func(_ error) { cancelSweeper() })
+		go work.NewPlanCheckpointSweeper(plansStore, a.config.PlanCheckpointMaxAge, DefaultPlanCheckpointSweepInterval, a.logger).Run(sweeperCtx)
+	}
+
+	if a.config.ExecOutMaxAge != 0 {
+		prunerCtx, cancelPruner := context.WithCancel(context.Background())
+		a.OnTerminating(func(_ error) { cancelPruner() })
+		go execout.NewPruner(stateStore, a.config.ExecOutMaxAge, a.config.ExecOutPrunerInterval, a.config.ExecOutPrunerDryRun, a.logger).Run(prunerCtx)
+	}
 
 	// set to empty store interface if URL is ""
 	var forkedBlocksStore dstore.Store
@@ -141,7 +300,19 @@ func (a *Tier1App) Run() error {
 	opts := []service.Option{
 		service.WithCacheSaveInterval(a.config.StateBundleSize),
 	}
-	for _, ext := range a.config.WASMExtensions {
+
+	if a.config.PinnedCacheURL != "" {
+		pinnedCache, err := dstore.NewStore(a.config.PinnedCacheURL, "zst", "zstd", false)
+		if err != nil {
+			return fmt.Errorf("failed setting up pinned cache from url %q: %w", a.config.PinnedCacheURL, err)
+		}
+		opts = append(opts, service.WithPinnedModules(pinnedCache, a.config.PinnedModuleHashes))
+	}
+	hostFunctions, err := wasm.HostFunctions(a.config.WASMHostFunctions)
+	if err != nil {
+		return fmt.Errorf("invalid app config: %w", err)
+	}
+	for _, ext := range append(a.config.WASMExtensions, hostFunctions...) {
 		opts = append(opts, service.WithWASMExtension(ext))
 	}
 
@@ -157,6 +328,186 @@ func (a *Tier1App) Run() error {
 		opts = append(opts, service.WithRequestStats())
 	}
 
+	if a.config.StorageLayoutV2 {
+		opts = append(opts, service.WithStorageLayoutV2())
+	}
+
+	if a.config.IdempotentWrites {
+		opts = append(opts, service.WithIdempotentWrites())
+	}
+
+	if a.config.CommitStoreFlushes {
+		opts = append(opts, service.WithStoreFlushCommits())
+	}
+
+	if a.config.ContentAddressedOutputs {
+		opts = append(opts, service.WithContentAddressedOutputs())
+	}
+
+	if a.config.MaxConcurrentJobsPerModule != 0 {
+		opts = append(opts, service.WithMaxConcurrentJobsPerModule(a.config.MaxConcurrentJobsPerModule))
+	}
+	if a.config.MaxConcurrentSquashes != 0 {
+		opts = append(opts, service.WithMaxConcurrentSquashes(a.config.MaxConcurrentSquashes))
+	}
+	if a.config.MaxPendingMergeBytes != 0 {
+		opts = append(opts, service.WithMaxPendingMergeBytes(a.config.MaxPendingMergeBytes))
+	}
+	if a.config.SquashLoadParallelism > 1 {
+		opts = append(opts, service.WithSquashLoadParallelism(a.config.SquashLoadParallelism))
+	}
+	if a.config.StoreJobsProduceOutputs {
+		opts = append(opts, service.WithStoreJobsProduceOutputs())
+	}
+	if a.config.DevModeDiscardOutputs {
+		opts = append(opts, service.WithDevModeDiscardOutputs())
+	}
+
+	if a.config.SchedulerEventLog {
+		opts = append(opts, service.WithSchedulerEventLog())
+	}
+
+	if a.config.PackageStatsInterval != 0 {
+		var exporters []metrics.PackageStatsExporter
+		if a.config.PackageStatsFile != "" {
+			exporters = append(exporters, metrics.PackageStatsFileExporter(a.config.PackageStatsFile))
+		}
+		if a.config.PackageStatsMetrics {
+			exporters = append(exporters, metrics.PackageStatsMetricsExporter)
+		}
+		packageStats := metrics.NewPackageStats()
+		statsCtx, cancelStats := context.WithCancel(context.Background())
+		a.OnTerminating(func(_ error) { cancelStats() })
+		go packageStats.Run(statsCtx, a.config.PackageStatsInterval, a.logger, exporters...)
+		opts = append(opts, service.WithPackageStats(packageStats))
+	}
+
+	if a.config.PlanCheckpoints {
+		opts = append(opts, service.WithPlanCheckpoints(a.config.PlanCheckpointMaxAge))
+	}
+
+	if a.config.ThroughputStats {
+		opts = append(opts, service.WithThroughputStats())
+	}
+
+	if len(a.config.DisabledCapabilities) != 0 {
+		opts = append(opts, service.WithDisabledCapabilities(a.config.DisabledCapabilities))
+	}
+
+	if a.config.AdaptiveJobDuration != 0 {
+		opts = append(opts, service.WithAdaptiveJobDuration(a.config.AdaptiveJobDuration))
+	}
+
+	if a.config.WorkerPoolAutoscaler != nil {
+		opts = append(opts, service.WithWorkerPoolAutoscaler(a.config.WorkerPoolAutoscaler))
+	}
+
+	if a.config.ModuleExecutionBudget != 0 {
+		opts = append(opts, service.WithModuleExecutionBudget(a.config.ModuleExecutionBudget, a.config.ModuleExecutionBudgetRepeat))
+	}
+
+	if a.config.ModuleExecutionTimeout != 0 {
+		opts = append(opts, service.WithModuleExecutionTimeout(a.config.ModuleExecutionTimeout))
+	}
+
+	if a.config.ModuleMaxFuel != 0 {
+		opts = append(opts, service.WithMaxWasmFuelPerBlockModule(a.config.ModuleMaxFuel))
+	}
+
+	if a.config.MaxConcurrentCPUHeavyModules != 0 {
+		opts = append(opts, service.WithMaxConcurrentCPUHeavyModules(a.config.MaxConcurrentCPUHeavyModules))
+	}
+
+	if a.config.ExtensionBreakerThreshold != 0 {
+		opts = append(opts, service.WithExtensionBreakers(wasm.ExtensionBreakerConfig{
+			FailureThreshold: a.config.ExtensionBreakerThreshold,
+			Backoff:          a.config.ExtensionBreakerBackoff,
+			MaxBackoff:       a.config.ExtensionBreakerMaxBackoff,
+			CallTimeout:      a.config.ExtensionCallTimeout,
+		}))
+	}
+
+	if a.config.MaxStreamsPerKey != 0 || a.config.BackprocessBlocksPerKey != 0 || a.config.StreamedBytesPerKey != 0 {
+		opts = append(opts, service.WithAdmissionController(service.NewKeyQuotas(service.KeyQuotaLimits{
+			MaxConcurrentStreams: a.config.MaxStreamsPerKey,
+			MaxBackprocessBlocks: a.config.BackprocessBlocksPerKey,
+			MaxStreamedBytes:     a.config.StreamedBytesPerKey,
+			Window:               a.config.KeyQuotaWindow,
+		})))
+	}
+
+	if a.config.MaxConcurrentRequests != 0 {
+		opts = append(opts, service.WithMaxConcurrentRequests(a.config.MaxConcurrentRequests, a.config.MaxQueuedRequests))
+	}
+
+	if a.config.Network != "" {
+		opts = append(opts, service.WithNetwork(a.config.Network))
+	}
+
+	if a.config.StoreDeltaStreams {
+		opts = append(opts, service.WithStoreDeltaStreams())
+	}
+
+	if a.config.BlockSource != "" {
+		policy, _ := service.ParseBlockSourcePolicy(a.config.BlockSource) // validated by Validate()
+		opts = append(opts, service.WithBlockSourcePolicy(policy))
+	}
+
+	if a.config.MaxReorgDepth != 0 {
+		opts = append(opts, service.WithMaxReorgDepth(a.config.MaxReorgDepth))
+	}
+
+	if a.config.ResumePointInterval != 0 {
+		opts = append(opts, service.WithResumePoints(a.config.ResumePointInterval))
+	}
+
+	if a.config.AsyncSnapshotWritesQueueSize != 0 {
+		opts = append(opts, service.WithAsyncSnapshotWrites(a.config.AsyncSnapshotWritesQueueSize))
+	}
+
+	if len(a.config.StoreSeedURLPrefixes) != 0 {
+		opts = append(opts, service.WithStoreSeedURLPrefixes(a.config.StoreSeedURLPrefixes))
+	}
+
+	if a.config.RequestChunkSize != 0 {
+		opts = append(opts, service.WithRequestChunkSize(a.config.RequestChunkSize))
+	}
+
+	if a.config.HandoffCatchUpBlocks != 0 {
+		opts = append(opts, service.WithHandoffCatchUp(a.config.HandoffCatchUpBlocks))
+	}
+
+	if a.config.RequestFanOutReplayBlocks != 0 {
+		opts = append(opts, service.WithRequestFanOut(a.config.RequestFanOutReplayBlocks))
+	}
+
+	if a.config.NodeStatus {
+		opts = append(opts, service.WithNodeStatus(a.config.NodeStatusOperators))
+	}
+
+	if a.config.ModuleReload {
+		opts = append(opts, service.WithModuleReload())
+	}
+
+	if a.config.ExecOutAccessTracking {
+		opts = append(opts, service.WithExecOutAccessTracking(execout.DefaultAccessResolution))
+	}
+
+	if a.config.BillingSinkURL != "" {
+		sink, err := billing.NewSink(a.config.BillingSinkURL, a.logger)
+		if err != nil {
+			return fmt.Errorf("failed setting up billing sink from url %q: %w", a.config.BillingSinkURL, err)
+		}
+		reporter := billing.NewReporter(sink, a.config.BillingInterval, a.logger)
+		// once the server stopped, the final events of its requests were queued
+		a.OnTerminated(func(_ error) { reporter.Close() })
+		opts = append(opts, service.WithBillingReporter(reporter))
+	}
+
+	if a.config.ProgressMessagesPerSecond != 0 {
+		opts = append(opts, service.WithProgressMessagesPerSecond(a.config.ProgressMessagesPerSecond))
+	}
+
 	svc := service.NewTier1(
 		a.logger,
 		mergedBlocksStore,
@@ -169,6 +520,11 @@ func (a *Tier1App) Run() error {
 		subrequestsClientConfig,
 		opts...,
 	)
+	a.svc = svc
+
+	readinessCtx, cancelReadiness := context.WithCancel(context.Background())
+	a.OnTerminating(func(_ error) { cancelReadiness() })
+	go svc.RunReadinessProbes(readinessCtx)
 
 	a.OnTerminating(func(err error) {
 		svc.Shutdown(err)
@@ -196,8 +552,18 @@ func (a *Tier1App) Run() error {
 	return nil
 }
 
+// HealthCheck reports the app as not ready, with the reason, while its
+// dependencies are unreachable, see service.Tier1Service.Ready.
 func (a *Tier1App) HealthCheck(ctx context.Context) (bool, interface{}, error) {
-	return a.IsReady(ctx), nil, nil
+	if !a.IsReady(ctx) {
+		return false, nil, nil
+	}
+	if a.svc != nil {
+		if err := a.svc.Ready(); err != nil {
+			return false, map[string]string{"reason": err.Error()}, nil
+		}
+	}
+	return true, nil, nil
 }
 
 // IsReady return `true` if the apps is ready to accept requests, `false` is returned
@@ -214,7 +580,97 @@ func (a *Tier1App) IsReady(ctx context.Context) bool {
 }
 
 // Validate inspects itself to determine if the current config is valid according to
-// substreams rules.
+// substreams rules. Only the optional features set are checked, so that the configs
+// built in code keep running as before: the required fields and sizes are checked
+// on the configs loaded with LoadTier1Config.
 func (config *Tier1Config) Validate() error {
+	if config.AdaptiveJobDuration != 0 && !config.ThroughputStats {
+		return fmt.Errorf("adaptive_job_duration requires throughput_stats")
+	}
+	if config.PackageStatsInterval != 0 && config.PackageStatsFile == "" && !config.PackageStatsMetrics {
+		return fmt.Errorf("package_stats_interval requires package_stats_file or package_stats_metrics")
+	}
+	if config.ExecOutMaxAge != 0 && !config.ExecOutAccessTracking {
+		return fmt.Errorf("execout_max_age requires execout_access_tracking")
+	}
+	if config.ExtensionCallTimeout != 0 && config.ExtensionBreakerThreshold == 0 {
+		return fmt.Errorf("extension_call_timeout requires extension_breaker_threshold")
+	}
+	if (config.PinnedCacheURL == "") != (len(config.PinnedModuleHashes) == 0) {
+		return fmt.Errorf("pinned_cache_url and pinned_module_hashes must be set together")
+	}
+	if _, err := faulty.ParseConfig(config.StateStoreFaults); err != nil {
+		return fmt.Errorf("invalid state_store_faults: %w", err)
+	}
+	if config.BlockSource != "" {
+		if _, err := service.ParseBlockSourcePolicy(config.BlockSource); err != nil {
+			return fmt.Errorf("invalid block_source: %w", err)
+		}
+	}
+	if (config.BackprocessBlocksPerKey != 0 || config.StreamedBytesPerKey != 0) && config.KeyQuotaWindow == 0 {
+		return fmt.Errorf("backprocess_blocks_per_key and streamed_bytes_per_key require key_quota_window")
+	}
+	if config.BillingSinkURL != "" && config.BillingInterval <= 0 {
+		return fmt.Errorf("billing_interval must be greater than 0 when billing_sink_url is set")
+	}
 	return nil
 }
+
+// validateLoaded checks the required fields and sizes of a loaded config, then
+// Validate.
+func (config *Tier1Config) validateLoaded() error {
+	if err := validateRequired(map[string]string{
+		"merged_blocks_store_url": config.MergedBlocksStoreURL,
+		"state_store_url":         config.StateStoreURL,
+		"grpc_listen_addr":        config.GRPCListenAddr,
+		"subrequests_endpoint":    config.SubrequestsEndpoint,
+	}); err != nil {
+		return err
+	}
+	if config.StateBundleSize == 0 {
+		return fmt.Errorf("state_bundle_size must be greater than 0")
+	}
+	if config.MaxSubrequests == 0 {
+		return fmt.Errorf("max_subrequests must be greater than 0")
+	}
+	if config.SubrequestsSize < config.StateBundleSize {
+		return fmt.Errorf("subrequests_size (%d) must be greater or equal to state_bundle_size (%d)", config.SubrequestsSize, config.StateBundleSize)
+	}
+	return config.Validate()
+}
+
+func (config *Tier1Config) setDefaults() {
+	if config.StateBundleSize == 0 {
+		config.StateBundleSize = DefaultStateBundleSize
+	}
+	if config.ModuleExecutionBudgetRepeat == 0 {
+		config.ModuleExecutionBudgetRepeat = DefaultModuleExecutionBudgetRepeat
+	}
+	if config.ExtensionBreakerBackoff == 0 {
+		config.ExtensionBreakerBackoff = DefaultExtensionBreakerBackoff
+	}
+	if config.ExtensionBreakerMaxBackoff == 0 {
+		config.ExtensionBreakerMaxBackoff = DefaultExtensionBreakerMaxBackoff
+	}
+	if config.MaxSubrequests == 0 {
+		config.MaxSubrequests = DefaultMaxSubrequests
+	}
+	if config.SubrequestsSize == 0 {
+		config.SubrequestsSize = DefaultSubrequestsSize
+	}
+	if config.ExecOutPrunerInterval == 0 {
+		config.ExecOutPrunerInterval = DefaultExecOutPrunerInterval
+	}
+	if config.IdempotencyExpiryInterval == 0 {
+		config.IdempotencyExpiryInterval = DefaultIdempotencyExpiryInterval
+	}
+	if config.ResumePointMaxAge == 0 {
+		config.ResumePointMaxAge = DefaultResumePointMaxAge
+	}
+	if config.PlanCheckpointMaxAge == 0 {
+		config.PlanCheckpointMaxAge = DefaultPlanCheckpointMaxAge
+	}
+	if config.BillingInterval == 0 {
+		config.BillingInterval = DefaultBillingInterval
+	}
+}
@@ -4,32 +4,93 @@ import (
 	"context"
 	"fmt"
 	"net/url"
+	"time"
 
 	"github.com/streamingfast/dmetrics"
 	"github.com/streamingfast/dstore"
 	"github.com/streamingfast/shutter"
+	"github.com/streamingfast/substreams/billing"
 	"github.com/streamingfast/substreams/metrics"
 	"github.com/streamingfast/substreams/pipeline"
 	"github.com/streamingfast/substreams/service"
+	"github.com/streamingfast/substreams/service/blockcache"
+	"github.com/streamingfast/substreams/storage/execout"
+	"github.com/streamingfast/substreams/storage/faulty"
+	"github.com/streamingfast/substreams/storage/replica"
+	"github.com/streamingfast/substreams/storage/store"
 	"github.com/streamingfast/substreams/wasm"
 	"go.uber.org/atomic"
 	"go.uber.org/zap"
 )
 
 type Tier2Config struct {
-	MergedBlocksStoreURL string
-	GRPCListenAddr       string // gRPC address where this app will listen to
-	ServiceDiscoveryURL  *url.URL
+	MergedBlocksStoreURL string   `yaml:"merged_blocks_store_url"`
+	GRPCListenAddr       string   `yaml:"grpc_listen_addr"` // gRPC address where this app will listen to
+	ServiceDiscoveryURL  *url.URL `yaml:"service_discovery_url"`
 
-	StateStoreURL   string
-	StateBundleSize uint64
-	BlockType       string
+	StateStoreURL         string   `yaml:"state_store_url"`
+	StateStoreReplicaURLs []string `yaml:"state_store_replica_urls"` // replicas of the state store, read first in this order (nearest or cheapest first), writes go to state_store_url
+	StateBundleSize       uint64   `yaml:"state_bundle_size"`
+	StateStoreFaults      string   `yaml:"state_store_faults"` // chaos mode, for testing only: faults injected in the calls to the state store (ex: `latency=50ms,throttle=0.01,partial_write=0.005,corrupt_read=0`)
+	BlockType             string   `yaml:"block_type"`
 
-	WASMExtensions  []wasm.WASMExtensioner
-	PipelineOptions []pipeline.PipelineOptioner
+	PinnedCacheURL     string   `yaml:"pinned_cache_url"`     // read-only cache maintained by another provider, serving the files of the pinned modules
+	PinnedModuleHashes []string `yaml:"pinned_module_hashes"` // modules served from pinned_cache_url, always complete and never scheduled
 
-	RequestStats bool
-	Tracing      bool
+	WASMExtensions  []wasm.WASMExtensioner      `yaml:"-"`
+	PipelineOptions []pipeline.PipelineOptioner `yaml:"-"`
+
+	RequestStats    bool `yaml:"request_stats"`
+	Tracing         bool `yaml:"tracing"`
+	StorageLayoutV2 bool `yaml:"storage_layout_v2"` // write store snapshots and execution outputs using the sharded layout, still reading the previous one
+
+	IdempotentWrites bool `yaml:"idempotent_writes"` // check the store snapshots, execution outputs and flush manifests against a ledger in the state store, so that retries never write them twice
+
+	CommitStoreFlushes bool `yaml:"commit_store_flushes"` // commit the snapshots of the stores flushed together at a boundary with manifests, so that the ones of a flush interrupted midway are not used
+
+	ContentAddressedOutputs bool `yaml:"content_addressed_outputs"` // write the execution outputs segments as blobs named after the hash of their content, shared by the modules producing the same outputs; older servers cannot read them
+
+	WASMRuntime string `yaml:"wasm_runtime"` // runtime executing the modules, `wazero` (default, pure Go) or `wasmtime` (requires cgo), the SUBSTREAMS_WASM_RUNTIME environment variable overriding it
+
+	WASMHostFunctions []string `yaml:"wasm_host_functions"` // sets of host functions exposed to the modules, in addition to the WASMExtensions, among the ones registered with wasm.RegisterHostFunctions (built in: crypto, bigdecimal)
+
+	ModuleExecutionBudget       time.Duration `yaml:"module_execution_budget"`        // if not 0, modules whose execution on a single block exceeds it are reported to the user
+	ModuleExecutionBudgetRepeat uint64        `yaml:"module_execution_budget_repeat"` // number of blocks exceeding the budget before a module is reported, defaults to 3
+
+	ModuleExecutionTimeout time.Duration `yaml:"module_execution_timeout"` // if not 0, executions of a module on a single block taking longer are stopped, failing the request
+	ModuleMaxFuel          uint64        `yaml:"module_max_fuel"`          // if not 0, executions of a module on a single block consuming more fuel (WASM instructions) are stopped, failing the request, only metered by the wasmtime runtime
+
+	MaxConcurrentCPUHeavyModules uint64 `yaml:"max_concurrent_cpu_heavy_modules"` // if not 0, limits the modules hinted `cpu_heavy` executing at the same time, across requests
+
+	ExtensionBreakerThreshold  uint64        `yaml:"extension_breaker_threshold"`   // if not 0, the calls to a WASM extension provider fail immediately, with a transient error, after that many consecutive failed calls
+	ExtensionBreakerBackoff    time.Duration `yaml:"extension_breaker_backoff"`     // time the calls to a failing provider fail immediately, doubled each time it fails again, defaults to 5s
+	ExtensionBreakerMaxBackoff time.Duration `yaml:"extension_breaker_max_backoff"` // upper bound of extension_breaker_backoff, defaults to 5m
+	ExtensionCallTimeout       time.Duration `yaml:"extension_call_timeout"`        // if not 0, the calls to the WASM extensions taking longer fail and count as failed calls, requires extension_breaker_threshold
+
+	BlockCacheMemoryBytes uint64 `yaml:"block_cache_memory_bytes"` // if not 0, merged blocks files are cached in memory and shared across concurrent jobs
+	BlockCacheDiskDir     string `yaml:"block_cache_disk_dir"`     // if set, merged blocks files evicted from memory are kept on disk in this directory
+	BlockCacheDiskBytes   uint64 `yaml:"block_cache_disk_bytes"`
+
+	WASMCompilationCacheDir string `yaml:"wasm_compilation_cache_dir"` // if set, compiled WASM modules are kept in this directory and shared with other workers through the state store
+	WASMModulePoolSize      uint64 `yaml:"wasm_module_pool_size"`      // if not 0, up to that many WASM modules are kept warm once their job is done, reused by the next jobs running the same code
+
+	StoreSpillThresholdBytes uint64 `yaml:"store_spill_threshold_bytes"` // if not 0, the entries of a store held in memory are spilled to disk above that size
+	StoreSpillDir            string `yaml:"store_spill_dir"`             // directory of the store spill files, defaults to the system temporary directory
+
+	StoreFileCacheBytes uint64 `yaml:"store_file_cache_bytes"` // if not 0, the complete store snapshots loaded by the jobs are kept in memory, up to that size, and shared across jobs
+
+	ExecOutAccessTracking bool `yaml:"execout_access_tracking"` // record the last access of the execution outputs segments, required by the execout pruner of tier1
+
+	AsyncSnapshotWritesQueueSize uint64 `yaml:"async_snapshot_writes_queue_size"` // if not 0, the store snapshots are uploaded in the background while the blocks are processed, up to that many waiting to be uploaded by each request
+
+	StoreSeedURLPrefixes []string `yaml:"store_seed_url_prefixes"` // the packages can seed their stores from the URLs starting with one of these, must match the tier1 servers' config
+
+	DeterminismAuditFraction float64 `yaml:"determinism_audit_fraction"` // fraction of the jobs (0 to 1) whose modules are executed twice on each block, failing the job when the outputs differ
+
+	BillingSinkURL  string        `yaml:"billing_sink_url"` // if set, the usage of each request is sent to this sink every billing_interval: `http(s)://<url>` (POST of JSON arrays), `log://`, or a scheme registered with billing.RegisterSink (ex: a Kafka producer)
+	BillingInterval time.Duration `yaml:"billing_interval"` // interval between the billing events of a request, defaults to 1m
+
+	ConfigDumpListenAddr string `yaml:"config_dump_listen_addr"` // if set, the effective config is served as YAML on `http://<addr>/config`
 }
 
 type Tier2App struct {
@@ -38,6 +99,7 @@ type Tier2App struct {
 	modules *Modules
 	logger  *zap.Logger
 	isReady *atomic.Bool
+	svc     *service.Tier2Service // set by Run, probing the dependencies for the health checks
 }
 
 func NewTier2(logger *zap.Logger, config *Tier2Config, modules *Modules) *Tier2App {
@@ -58,21 +120,54 @@ func (a *Tier2App) Run() error {
 	if err := a.config.Validate(); err != nil {
 		return fmt.Errorf("invalid app config: %w", err)
 	}
+	if a.config.WASMRuntime != "" {
+		if err := wasm.SetDefaultRuntime(a.config.WASMRuntime); err != nil {
+			return fmt.Errorf("invalid app config: %w", err)
+		}
+	}
+
+	if a.config.ConfigDumpListenAddr != "" {
+		if err := serveEffectiveConfig(a.config.ConfigDumpListenAddr, a.config, a.Terminating(), a.logger); err != nil {
+			return fmt.Errorf("serving effective config: %w", err)
+		}
+	}
 
 	mergedBlocksStore, err := dstore.NewDBinStore(a.config.MergedBlocksStoreURL)
 	if err != nil {
 		return fmt.Errorf("failed setting up block store from url %q: %w", a.config.MergedBlocksStoreURL, err)
 	}
 
-	stateStore, err := dstore.NewStore(a.config.StateStoreURL, "zst", "zstd", true)
+	var stateStore dstore.Store
+	if len(a.config.StateStoreReplicaURLs) != 0 {
+		stateStore, err = replica.NewStoreFromURLs(a.config.StateStoreURL, a.config.StateStoreReplicaURLs, "zst", "zstd", true)
+	} else {
+		stateStore, err = dstore.NewStore(a.config.StateStoreURL, "zst", "zstd", true)
+	}
 	if err != nil {
 		return fmt.Errorf("failed setting up state store from url %q: %w", a.config.StateStoreURL, err)
 	}
+	if a.config.StateStoreFaults != "" {
+		faults, _ := faulty.ParseConfig(a.config.StateStoreFaults) // validated by Validate()
+		a.logger.Warn("injecting faults in the calls to the state store, for testing only", zap.String("state_store_faults", a.config.StateStoreFaults))
+		stateStore = faulty.NewStore(stateStore, faults)
+	}
 
 	opts := []service.Option{
 		service.WithCacheSaveInterval(a.config.StateBundleSize),
 	}
-	for _, ext := range a.config.WASMExtensions {
+
+	if a.config.PinnedCacheURL != "" {
+		pinnedCache, err := dstore.NewStore(a.config.PinnedCacheURL, "zst", "zstd", false)
+		if err != nil {
+			return fmt.Errorf("failed setting up pinned cache from url %q: %w", a.config.PinnedCacheURL, err)
+		}
+		opts = append(opts, service.WithPinnedModules(pinnedCache, a.config.PinnedModuleHashes))
+	}
+	hostFunctions, err := wasm.HostFunctions(a.config.WASMHostFunctions)
+	if err != nil {
+		return fmt.Errorf("invalid app config: %w", err)
+	}
+	for _, ext := range append(a.config.WASMExtensions, hostFunctions...) {
 		opts = append(opts, service.WithWASMExtension(ext))
 	}
 
@@ -88,6 +183,102 @@ func (a *Tier2App) Run() error {
 		opts = append(opts, service.WithRequestStats())
 	}
 
+	if a.config.StorageLayoutV2 {
+		opts = append(opts, service.WithStorageLayoutV2())
+	}
+
+	if a.config.IdempotentWrites {
+		opts = append(opts, service.WithIdempotentWrites())
+	}
+
+	if a.config.CommitStoreFlushes {
+		opts = append(opts, service.WithStoreFlushCommits())
+	}
+
+	if a.config.ContentAddressedOutputs {
+		opts = append(opts, service.WithContentAddressedOutputs())
+	}
+
+	if a.config.ModuleExecutionBudget != 0 {
+		opts = append(opts, service.WithModuleExecutionBudget(a.config.ModuleExecutionBudget, a.config.ModuleExecutionBudgetRepeat))
+	}
+
+	if a.config.ModuleExecutionTimeout != 0 {
+		opts = append(opts, service.WithModuleExecutionTimeout(a.config.ModuleExecutionTimeout))
+	}
+
+	if a.config.ModuleMaxFuel != 0 {
+		opts = append(opts, service.WithMaxWasmFuelPerBlockModule(a.config.ModuleMaxFuel))
+	}
+
+	if a.config.MaxConcurrentCPUHeavyModules != 0 {
+		opts = append(opts, service.WithMaxConcurrentCPUHeavyModules(a.config.MaxConcurrentCPUHeavyModules))
+	}
+
+	if a.config.ExtensionBreakerThreshold != 0 {
+		opts = append(opts, service.WithExtensionBreakers(wasm.ExtensionBreakerConfig{
+			FailureThreshold: a.config.ExtensionBreakerThreshold,
+			Backoff:          a.config.ExtensionBreakerBackoff,
+			MaxBackoff:       a.config.ExtensionBreakerMaxBackoff,
+			CallTimeout:      a.config.ExtensionCallTimeout,
+		}))
+	}
+
+	if a.config.BlockCacheMemoryBytes != 0 || a.config.BlockCacheDiskDir != "" {
+		cache, err := blockcache.New(a.config.BlockCacheMemoryBytes, a.config.BlockCacheDiskDir, a.config.BlockCacheDiskBytes, a.logger.Named("block_cache"))
+		if err != nil {
+			return fmt.Errorf("setting up block cache: %w", err)
+		}
+		opts = append(opts, service.WithBlockCache(cache))
+	}
+
+	if a.config.WASMCompilationCacheDir != "" {
+		wasmCacheStore, err := stateStore.SubStore("wasm-cache")
+		if err != nil {
+			return fmt.Errorf("setting up wasm compilation cache store: %w", err)
+		}
+		opts = append(opts, service.WithWASMCompilationCache(wasm.NewCompilationCache(wasmCacheStore, a.config.WASMCompilationCacheDir)))
+	}
+
+	if a.config.WASMModulePoolSize != 0 {
+		opts = append(opts, service.WithWASMModulePool(a.config.WASMModulePoolSize))
+	}
+
+	if a.config.DeterminismAuditFraction != 0 {
+		opts = append(opts, service.WithDeterminismAudit(a.config.DeterminismAuditFraction))
+	}
+
+	if a.config.ExecOutAccessTracking {
+		opts = append(opts, service.WithExecOutAccessTracking(execout.DefaultAccessResolution))
+	}
+
+	if a.config.StoreSpillThresholdBytes != 0 {
+		opts = append(opts, service.WithStoreSpill(a.config.StoreSpillDir, a.config.StoreSpillThresholdBytes))
+	}
+
+	if a.config.StoreFileCacheBytes != 0 {
+		opts = append(opts, service.WithStoreFileCache(store.NewFileCache(a.config.StoreFileCacheBytes)))
+	}
+
+	if a.config.AsyncSnapshotWritesQueueSize != 0 {
+		opts = append(opts, service.WithAsyncSnapshotWrites(a.config.AsyncSnapshotWritesQueueSize))
+	}
+
+	if len(a.config.StoreSeedURLPrefixes) != 0 {
+		opts = append(opts, service.WithStoreSeedURLPrefixes(a.config.StoreSeedURLPrefixes))
+	}
+
+	if a.config.BillingSinkURL != "" {
+		sink, err := billing.NewSink(a.config.BillingSinkURL, a.logger)
+		if err != nil {
+			return fmt.Errorf("failed setting up billing sink from url %q: %w", a.config.BillingSinkURL, err)
+		}
+		reporter := billing.NewReporter(sink, a.config.BillingInterval, a.logger)
+		// once the server stopped, the final events of its requests were queued
+		a.OnTerminated(func(_ error) { reporter.Close() })
+		opts = append(opts, service.WithBillingReporter(reporter))
+	}
+
 	svc := service.NewTier2(
 		a.logger,
 		mergedBlocksStore,
@@ -96,6 +287,11 @@ func (a *Tier2App) Run() error {
 		a.config.BlockType,
 		opts...,
 	)
+	a.svc = svc
+
+	readinessCtx, cancelReadiness := context.WithCancel(context.Background())
+	a.OnTerminating(func(_ error) { cancelReadiness() })
+	go svc.RunReadinessProbes(readinessCtx)
 
 	go func() {
 		a.logger.Info("launching gRPC server")
@@ -108,8 +304,18 @@ func (a *Tier2App) Run() error {
 	return nil
 }
 
+// HealthCheck reports the app as not ready, with the reason, while its
+// dependencies are unreachable, see service.Tier2Service.Ready.
 func (a *Tier2App) HealthCheck(ctx context.Context) (bool, interface{}, error) {
-	return a.IsReady(ctx), nil, nil
+	if !a.IsReady(ctx) {
+		return false, nil, nil
+	}
+	if a.svc != nil {
+		if err := a.svc.Ready(); err != nil {
+			return false, map[string]string{"reason": err.Error()}, nil
+		}
+	}
+	return true, nil, nil
 }
 
 // IsReady return `true` if the apps is ready to accept requests, `false` is returned
@@ -126,7 +332,60 @@ func (a *Tier2App) IsReady(ctx context.Context) bool {
 }
 
 // Validate inspects itself to determine if the current config is valid according to
-// substreams rules.
+// substreams rules. Only the optional features set are checked, see
+// Tier1Config.Validate.
 func (config *Tier2Config) Validate() error {
+	if config.BlockCacheDiskDir != "" && config.BlockCacheDiskBytes == 0 {
+		return fmt.Errorf("block_cache_disk_bytes must be greater than 0 when block_cache_disk_dir is set")
+	}
+	if config.ExtensionCallTimeout != 0 && config.ExtensionBreakerThreshold == 0 {
+		return fmt.Errorf("extension_call_timeout requires extension_breaker_threshold")
+	}
+	if (config.PinnedCacheURL == "") != (len(config.PinnedModuleHashes) == 0) {
+		return fmt.Errorf("pinned_cache_url and pinned_module_hashes must be set together")
+	}
+	if _, err := faulty.ParseConfig(config.StateStoreFaults); err != nil {
+		return fmt.Errorf("invalid state_store_faults: %w", err)
+	}
+	if config.DeterminismAuditFraction < 0 || config.DeterminismAuditFraction > 1 {
+		return fmt.Errorf("determinism_audit_fraction must be between 0 and 1")
+	}
+	if config.BillingSinkURL != "" && config.BillingInterval <= 0 {
+		return fmt.Errorf("billing_interval must be greater than 0 when billing_sink_url is set")
+	}
 	return nil
 }
+
+// validateLoaded checks the required fields and sizes of a loaded config, then
+// Validate.
+func (config *Tier2Config) validateLoaded() error {
+	if err := validateRequired(map[string]string{
+		"merged_blocks_store_url": config.MergedBlocksStoreURL,
+		"state_store_url":         config.StateStoreURL,
+		"grpc_listen_addr":        config.GRPCListenAddr,
+	}); err != nil {
+		return err
+	}
+	if config.StateBundleSize == 0 {
+		return fmt.Errorf("state_bundle_size must be greater than 0")
+	}
+	return config.Validate()
+}
+
+func (config *Tier2Config) setDefaults() {
+	if config.StateBundleSize == 0 {
+		config.StateBundleSize = DefaultStateBundleSize
+	}
+	if config.ModuleExecutionBudgetRepeat == 0 {
+		config.ModuleExecutionBudgetRepeat = DefaultModuleExecutionBudgetRepeat
+	}
+	if config.ExtensionBreakerBackoff == 0 {
+		config.ExtensionBreakerBackoff = DefaultExtensionBreakerBackoff
+	}
+	if config.ExtensionBreakerMaxBackoff == 0 {
+		config.ExtensionBreakerMaxBackoff = DefaultExtensionBreakerMaxBackoff
+	}
+	if config.BillingInterval == 0 {
+		config.BillingInterval = DefaultBillingInterval
+	}
+}
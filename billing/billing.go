@@ -0,0 +1,130 @@
+// Package billing reports the usage of the requests served, for billing: the
+// bytes read and written to the stores, the blocks processed and the time
+// spent executing the WASM modules. The usage of each request is sent
+// periodically, as the deltas since its previous event, to a Sink.
+package billing
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Event is the usage of a request over [Start, End).
+type Event struct {
+	RequestID string `json:"request_id"` // trace ID of the request
+	APIKeyID  string `json:"api_key_id"`
+	UserID    string `json:"user_id"`
+	Endpoint  string `json:"endpoint"`
+
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Final bool      `json:"final"` // last event of the request
+
+	BytesRead         uint64        `json:"bytes_read"`
+	BytesWritten      uint64        `json:"bytes_written"`
+	BlocksProcessed   uint64        `json:"blocks_processed"`
+	WasmExecutionTime time.Duration `json:"wasm_execution_time_ns"` // wall-clock time of the module executions, their host calls included, not CPU time
+}
+
+// Sink receives the billing events, see RegisterSink.
+type Sink interface {
+	// Send is called with batches of events, ordered by time for each request.
+	// A failed batch is not retried.
+	Send(ctx context.Context, events []*Event) error
+	Close() error
+}
+
+// SinkFactory creates the Sink configured by `dsn`.
+type SinkFactory func(dsn *url.URL, logger *zap.Logger) (Sink, error)
+
+var sinkFactories = map[string]SinkFactory{}
+
+func init() {
+	RegisterSink("http", newHTTPSink)
+	RegisterSink("https", newHTTPSink)
+	RegisterSink("log", newLogSink)
+	RegisterSink("null", newNullSink)
+}
+
+// RegisterSink makes the sinks created by `factory` available to NewSink, for
+// the DSNs of scheme `scheme`. Sinks for message brokers (ex: Kafka) are
+// registered this way by the binaries embedding substreams.
+func RegisterSink(scheme string, factory SinkFactory) {
+	if sinkFactories[scheme] != nil {
+		panic(fmt.Sprintf("billing sink %q already registered", scheme))
+	}
+	sinkFactories[scheme] = factory
+}
+
+// SinkSchemes returns the schemes of the sinks registered, sorted.
+func SinkSchemes() (out []string) {
+	for scheme := range sinkFactories {
+		out = append(out, scheme)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// NewSink creates the Sink configured by `dsn`, from the factory registered
+// for its scheme.
+func NewSink(dsn string, logger *zap.Logger) (Sink, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid billing sink %q: %w", dsn, err)
+	}
+	factory := sinkFactories[u.Scheme]
+	if factory == nil {
+		return nil, fmt.Errorf("unknown billing sink scheme %q, registered: %v", u.Scheme, SinkSchemes())
+	}
+	return factory(u, logger)
+}
+
+// Usage counts the blocks processed and the WASM execution time of a request,
+// the bytes being counted by its dmetering.Meter. A nil Usage counts nothing.
+type Usage struct {
+	blocks            atomic.Uint64
+	wasmExecutionTime atomic.Int64
+}
+
+func (u *Usage) AddBlocks(blocks uint64) {
+	if u == nil {
+		return
+	}
+	u.blocks.Add(blocks)
+}
+
+func (u *Usage) AddWasmExecutionTime(elapsed time.Duration) {
+	if u == nil {
+		return
+	}
+	u.wasmExecutionTime.Add(int64(elapsed))
+}
+
+// Totals returns the blocks processed and the WASM execution time counted so
+// far.
+func (u *Usage) Totals() (blocks uint64, wasmExecutionTime time.Duration) {
+	if u == nil {
+		return 0, 0
+	}
+	return u.blocks.Load(), time.Duration(u.wasmExecutionTime.Load())
+}
+
+type usageKey struct{}
+
+// WithUsage returns a copy of `ctx` holding `usage`.
+func WithUsage(ctx context.Context, usage *Usage) context.Context {
+	return context.WithValue(ctx, usageKey{}, usage)
+}
+
+// UsageFromContext returns the Usage of the request of `ctx`, nil when its
+// usage is not reported.
+func UsageFromContext(ctx context.Context) *Usage {
+	usage, _ := ctx.Value(usageKey{}).(*Usage)
+	return usage
+}
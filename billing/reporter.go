@@ -0,0 +1,200 @@
+package billing
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/streamingfast/substreams/metrics"
+)
+
+const (
+	reporterQueueSize = 10_000 // events waiting to be sent, the next ones are dropped
+	reporterBatchSize = 500
+	sinkSendTimeout   = 30 * time.Second
+)
+
+// Request identifies the request whose usage is reported.
+type Request struct {
+	ID       string // trace ID
+	APIKeyID string
+	UserID   string
+	Endpoint string
+}
+
+// BytesCounter counts the bytes read and written by a request, implemented by
+// dmetering.Meter.
+type BytesCounter interface {
+	BytesRead() uint64
+	BytesWritten() uint64
+}
+
+// Reporter sends the usage of the requests it tracks to its sink, in the
+// background, see Track.
+type Reporter struct {
+	sink     Sink
+	interval time.Duration
+	logger   *zap.Logger
+	now      func() time.Time
+
+	queue     chan *Event
+	closing   chan struct{}
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// NewReporter returns a Reporter sending the usage of each request tracked to
+// `sink` every `interval`.
+func NewReporter(sink Sink, interval time.Duration, logger *zap.Logger) *Reporter {
+	r := &Reporter{
+		sink:     sink,
+		interval: interval,
+		logger:   logger,
+		now:      time.Now,
+		queue:    make(chan *Event, reporterQueueSize),
+		closing:  make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+// Track reports the usage of `request` every interval, its bytes counted by
+// `bytes`, the blocks and WASM execution time by the Usage of the context
+// returned. The stop function returned reports the usage left, in the final
+// event of the request, and must be called once the request completed.
+//
+// The periodic events without usage are skipped.
+func (r *Reporter) Track(ctx context.Context, request Request, bytes BytesCounter) (context.Context, func()) {
+	t := &tracker{request: request, bytes: bytes, usage: &Usage{}, start: r.now()}
+
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if ev := t.event(r.now(), false); ev != nil {
+					r.enqueue(ev)
+				}
+			}
+		}
+	}()
+
+	var stopOnce sync.Once
+	return WithUsage(ctx, t.usage), func() {
+		stopOnce.Do(func() {
+			close(stop)
+			<-stopped
+			r.enqueue(t.event(r.now(), true))
+		})
+	}
+}
+
+func (r *Reporter) enqueue(ev *Event) {
+	select {
+	case r.queue <- ev:
+	default:
+		metrics.BillingEvents.Inc("dropped")
+		r.logger.Warn("billing events queue full, dropping event", zap.String("request_id", ev.RequestID))
+	}
+}
+
+// Close sends the events queued, then closes the sink. The events of the
+// requests completing later are not sent.
+func (r *Reporter) Close() error {
+	r.closeOnce.Do(func() { close(r.closing) })
+	<-r.done
+	return r.sink.Close()
+}
+
+func (r *Reporter) run() {
+	defer close(r.done)
+	for {
+		select {
+		case ev := <-r.queue:
+			r.send(r.batch(ev))
+		case <-r.closing:
+			for batch := r.batch(nil); len(batch) != 0; batch = r.batch(nil) {
+				r.send(batch)
+			}
+			return
+		}
+	}
+}
+
+// batch returns `first`, if not nil, with the events queued behind it, up to
+// reporterBatchSize.
+func (r *Reporter) batch(first *Event) (events []*Event) {
+	if first != nil {
+		events = append(events, first)
+	}
+	for len(events) < reporterBatchSize {
+		select {
+		case ev := <-r.queue:
+			events = append(events, ev)
+		default:
+			return events
+		}
+	}
+	return events
+}
+
+func (r *Reporter) send(events []*Event) {
+	ctx, cancel := context.WithTimeout(context.Background(), sinkSendTimeout)
+	defer cancel()
+	if err := r.sink.Send(ctx, events); err != nil {
+		metrics.BillingEvents.AddInt(len(events), "failed")
+		r.logger.Warn("sending billing events", zap.Int("events", len(events)), zap.Error(err))
+		return
+	}
+	metrics.BillingEvents.AddInt(len(events), "sent")
+}
+
+// tracker computes the usage of a request since its previous event.
+type tracker struct {
+	request Request
+	bytes   BytesCounter
+	usage   *Usage
+
+	start             time.Time // of the current period
+	bytesRead         uint64    // totals at the start of the period
+	bytesWritten      uint64
+	blocks            uint64
+	wasmExecutionTime time.Duration
+}
+
+// event returns the usage of the period ending at `end`, nil when there was
+// none and `final` is not set.
+func (t *tracker) event(end time.Time, final bool) *Event {
+	bytesRead, bytesWritten := t.bytes.BytesRead(), t.bytes.BytesWritten()
+	blocks, wasmExecutionTime := t.usage.blocks.Load(), time.Duration(t.usage.wasmExecutionTime.Load())
+
+	ev := &Event{
+		RequestID:         t.request.ID,
+		APIKeyID:          t.request.APIKeyID,
+		UserID:            t.request.UserID,
+		Endpoint:          t.request.Endpoint,
+		Start:             t.start,
+		End:               end,
+		Final:             final,
+		BytesRead:         bytesRead - t.bytesRead,
+		BytesWritten:      bytesWritten - t.bytesWritten,
+		BlocksProcessed:   blocks - t.blocks,
+		WasmExecutionTime: wasmExecutionTime - t.wasmExecutionTime,
+	}
+	if !final && ev.BytesRead == 0 && ev.BytesWritten == 0 && ev.BlocksProcessed == 0 && ev.WasmExecutionTime == 0 {
+		return nil
+	}
+
+	t.start = end
+	t.bytesRead, t.bytesWritten, t.blocks, t.wasmExecutionTime = bytesRead, bytesWritten, blocks, wasmExecutionTime
+	return ev
+}
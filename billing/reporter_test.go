@@ -0,0 +1,141 @@
+package billing
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type testBytes struct {
+	read, written uint64
+}
+
+func (b *testBytes) BytesRead() uint64    { return b.read }
+func (b *testBytes) BytesWritten() uint64 { return b.written }
+
+func TestTracker_Event(t *testing.T) {
+	bytes := &testBytes{}
+	start := time.Unix(1000, 0)
+	tr := &tracker{request: Request{ID: "trace", APIKeyID: "key"}, bytes: bytes, usage: &Usage{}, start: start}
+
+	assert.Nil(t, tr.event(start.Add(time.Second), false), "no usage")
+
+	bytes.read, bytes.written = 100, 10
+	tr.usage.AddBlocks(5)
+	tr.usage.AddWasmExecutionTime(time.Millisecond)
+	ev := tr.event(start.Add(2*time.Second), false)
+	require.NotNil(t, ev)
+	assert.Equal(t, &Event{
+		RequestID:         "trace",
+		APIKeyID:          "key",
+		Start:             start,
+		End:               start.Add(2 * time.Second),
+		BytesRead:         100,
+		BytesWritten:      10,
+		BlocksProcessed:   5,
+		WasmExecutionTime: time.Millisecond,
+	}, ev)
+
+	bytes.read = 150
+	tr.usage.AddBlocks(1)
+	ev = tr.event(start.Add(3*time.Second), true)
+	assert.True(t, ev.Final)
+	assert.Equal(t, start.Add(2*time.Second), ev.Start, "deltas since the previous event")
+	assert.Equal(t, uint64(50), ev.BytesRead)
+	assert.Equal(t, uint64(0), ev.BytesWritten)
+	assert.Equal(t, uint64(1), ev.BlocksProcessed)
+	assert.Equal(t, time.Duration(0), ev.WasmExecutionTime)
+}
+
+type testSink struct {
+	mu     sync.Mutex
+	events []*Event
+	closed bool
+}
+
+func (s *testSink) Send(_ context.Context, events []*Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, events...)
+	return nil
+}
+
+func (s *testSink) Close() error {
+	s.closed = true
+	return nil
+}
+
+func TestReporter(t *testing.T) {
+	sink := &testSink{}
+	r := NewReporter(sink, time.Millisecond, zap.NewNop())
+
+	ctx, stop := r.Track(context.Background(), Request{ID: "trace"}, &testBytes{})
+	usage := UsageFromContext(ctx)
+	require.NotNil(t, usage)
+	usage.AddBlocks(3)
+	assert.Eventually(t, func() bool {
+		sink.mu.Lock()
+		defer sink.mu.Unlock()
+		return len(sink.events) == 1
+	}, 5*time.Second, time.Millisecond, "periodic event")
+
+	usage.AddBlocks(2)
+	stop()
+	stop()
+	require.NoError(t, r.Close())
+	assert.True(t, sink.closed)
+
+	var blocks uint64
+	for _, ev := range sink.events {
+		blocks += ev.BlocksProcessed
+	}
+	assert.Equal(t, uint64(5), blocks)
+	assert.True(t, sink.events[len(sink.events)-1].Final, "single final event")
+	for _, ev := range sink.events[:len(sink.events)-1] {
+		assert.False(t, ev.Final)
+	}
+}
+
+func TestHTTPSink(t *testing.T) {
+	var received []*Event
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+	}))
+	defer server.Close()
+
+	sink, err := NewSink(server.URL+"/billing", zap.NewNop())
+	require.NoError(t, err)
+	require.NoError(t, sink.Send(context.Background(), []*Event{{RequestID: "trace", BytesRead: 10, WasmExecutionTime: time.Second}}))
+	require.Len(t, received, 1)
+	assert.Equal(t, "trace", received[0].RequestID)
+	assert.Equal(t, time.Second, received[0].WasmExecutionTime)
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	sink, err = NewSink(failing.URL, zap.NewNop())
+	require.NoError(t, err)
+	assert.Error(t, sink.Send(context.Background(), []*Event{{}}))
+}
+
+func TestNewSink_UnknownScheme(t *testing.T) {
+	_, err := NewSink("kafka://broker:9092/billing", zap.NewNop())
+	assert.ErrorContains(t, err, `unknown billing sink scheme "kafka"`)
+}
+
+func TestUsage_Nil(t *testing.T) {
+	usage := UsageFromContext(context.Background())
+	assert.Nil(t, usage)
+	usage.AddBlocks(1)
+	usage.AddWasmExecutionTime(time.Second)
+}
@@ -0,0 +1,85 @@
+package billing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"go.uber.org/zap"
+)
+
+// httpSink POSTs each batch of events to its URL as a JSON array.
+type httpSink struct {
+	url    string
+	client *http.Client
+}
+
+func newHTTPSink(dsn *url.URL, _ *zap.Logger) (Sink, error) {
+	return &httpSink{url: dsn.String(), client: http.DefaultClient}, nil
+}
+
+func (s *httpSink) Send(ctx context.Context, events []*Event) error {
+	body, err := json.Marshal(events)
+	if err != nil {
+		return fmt.Errorf("encoding billing events: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("sending billing events: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("sending billing events: unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+func (s *httpSink) Close() error { return nil }
+
+// logSink logs the events, for development.
+type logSink struct {
+	logger *zap.Logger
+}
+
+func newLogSink(_ *url.URL, logger *zap.Logger) (Sink, error) {
+	return &logSink{logger: logger}, nil
+}
+
+func (s *logSink) Send(_ context.Context, events []*Event) error {
+	for _, ev := range events {
+		s.logger.Info("billing event",
+			zap.String("request_id", ev.RequestID),
+			zap.String("api_key_id", ev.APIKeyID),
+			zap.String("user_id", ev.UserID),
+			zap.String("endpoint", ev.Endpoint),
+			zap.Time("start", ev.Start),
+			zap.Time("end", ev.End),
+			zap.Bool("final", ev.Final),
+			zap.Uint64("bytes_read", ev.BytesRead),
+			zap.Uint64("bytes_written", ev.BytesWritten),
+			zap.Uint64("blocks_processed", ev.BlocksProcessed),
+			zap.Duration("wasm_execution_time", ev.WasmExecutionTime),
+		)
+	}
+	return nil
+}
+
+func (s *logSink) Close() error { return nil }
+
+type nullSink struct{}
+
+func newNullSink(_ *url.URL, _ *zap.Logger) (Sink, error) { return nullSink{}, nil }
+
+func (nullSink) Send(context.Context, []*Event) error { return nil }
+func (nullSink) Close() error                         { return nil }
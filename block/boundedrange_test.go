@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestBoundedRange_computeInitialBounds(t *testing.T) {
@@ -60,7 +61,9 @@ func TestBoundedRange_computeInitialBounds(t *testing.T) {
 			if tt.want == "nil" {
 				assert.Nil(t, res)
 			} else {
-				assert.Equalf(t, ParseRange(tt.want), res, "computeInitialBounds()")
+				want, err := NewRangeFromString(tt.want)
+				require.NoError(t, err)
+				assert.Equalf(t, want, res, "computeInitialBounds()")
 			}
 		})
 	}
@@ -8,20 +8,35 @@ import (
 	"go.uber.org/zap/zapcore"
 )
 
-func ParseRange(in string) *Range {
-	if in == "" {
-		return nil
+// NewRangeFromString parses a range in its canonical `<start>-<exclusive_end>`
+// form (see `Canonical`), or in the `[<start>, <exclusive_end>)` form of
+// `String`. Surrounding spaces are ignored. Reversed ranges are rejected.
+func NewRangeFromString(in string) (*Range, error) {
+	trimmed := strings.TrimSpace(in)
+	sep := "-"
+	if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, ")") {
+		trimmed = trimmed[1 : len(trimmed)-1]
+		sep = ","
 	}
-	ch := strings.Split(in, "-")
-	lo, err := strconv.ParseInt(ch[0], 10, 64)
+
+	bounds := strings.Split(trimmed, sep)
+	if len(bounds) != 2 {
+		return nil, fmt.Errorf("invalid range %q, expected <start>-<exclusive_end>", in)
+	}
+	start, err := strconv.ParseUint(strings.TrimSpace(bounds[0]), 10, 64)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("invalid range %q start block: %w", in, err)
 	}
-	hi, err := strconv.ParseInt(ch[1], 10, 64)
+	end, err := strconv.ParseUint(strings.TrimSpace(bounds[1]), 10, 64)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("invalid range %q end block: %w", in, err)
 	}
-	return NewRange(uint64(lo), uint64(hi))
+
+	r := NewRange(start, end)
+	if err := r.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid range %q: %w", in, err)
+	}
+	return r, nil
 }
 
 type Range struct {
@@ -40,6 +55,20 @@ func (r *Range) String() string {
 	return fmt.Sprintf("[%d, %d)", r.StartBlock, r.ExclusiveEndBlock)
 }
 
+// Canonical formats the range as `<start>-<exclusive_end>`, the form parsed
+// by `NewRangeFromString`.
+func (r *Range) Canonical() string {
+	return fmt.Sprintf("%d-%d", r.StartBlock, r.ExclusiveEndBlock)
+}
+
+// Validate returns an error if the range ends before it starts.
+func (r *Range) Validate() error {
+	if r.ExclusiveEndBlock < r.StartBlock {
+		return fmt.Errorf("reversed range, end block %d is below start block %d", r.ExclusiveEndBlock, r.StartBlock)
+	}
+	return nil
+}
+
 func (r *Range) MarshalLogObject(enc zapcore.ObjectEncoder) error {
 	if r == nil {
 		enc.AddBool("nil", true)
@@ -23,3 +23,38 @@ func TestRange_Split(t *testing.T) {
 
 	require.Equal(t, expected, actual)
 }
+
+func TestNewRangeFromString(t *testing.T) {
+	tests := []struct {
+		in          string
+		expect      *Range
+		expectError bool
+	}{
+		{"10-20", NewRange(10, 20), false},
+		{" 10-20 ", NewRange(10, 20), false},
+		{"[10, 20)", NewRange(10, 20), false},
+		{"10-10", NewRange(10, 10), false},
+		{"20-10", nil, true},
+		{"10", nil, true},
+		{"10-20-30", nil, true},
+		{"a-20", nil, true},
+		{"-10-20", nil, true},
+		{"10-99999999999999999999", nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.in, func(t *testing.T) {
+			r, err := NewRangeFromString(test.in)
+			if test.expectError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expect, r)
+
+			roundTrip, err := NewRangeFromString(r.Canonical())
+			require.NoError(t, err)
+			require.Equal(t, r, roundTrip)
+		})
+	}
+}
@@ -1,15 +1,37 @@
 package block
 
-import "strings"
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// NewRangesFromString parses comma-separated ranges in their canonical form
+// (see `Ranges.Canonical`), empty elements are skipped. Reversed or
+// overlapping ranges are rejected, their order is kept.
+func NewRangesFromString(in string) (Ranges, error) {
+	out, err := parseRanges(in)
+	if err != nil {
+		return nil, err
+	}
+	if err := out.Validate(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
 
-func ParseRanges(in string) (out Ranges) {
+func parseRanges(in string) (out Ranges, err error) {
 	for _, e := range strings.Split(in, ",") {
-		newRange := ParseRange(strings.Trim(e, " "))
-		if newRange != nil {
-			out = append(out, newRange)
+		if strings.TrimSpace(e) == "" {
+			continue
+		}
+		newRange, err := NewRangeFromString(e)
+		if err != nil {
+			return nil, err
 		}
+		out = append(out, newRange)
 	}
-	return
+	return out, nil
 }
 
 type Ranges []*Range
@@ -22,6 +44,35 @@ func (r Ranges) String() string {
 	return strings.Join(rs, ",")
 }
 
+// Canonical formats the ranges as comma-separated `<start>-<exclusive_end>`,
+// the form parsed by `NewRangesFromString`.
+func (r Ranges) Canonical() string {
+	var rs []string
+	for _, i := range r {
+		rs = append(rs, i.Canonical())
+	}
+	return strings.Join(rs, ",")
+}
+
+// Validate returns an error if one of the ranges is reversed or if two of
+// them overlap.
+func (r Ranges) Validate() error {
+	sorted := make(Ranges, len(r))
+	for i, el := range r {
+		if err := el.Validate(); err != nil {
+			return err
+		}
+		sorted[i] = el
+	}
+	sort.Sort(sorted)
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i].StartBlock < sorted[i-1].ExclusiveEndBlock {
+			return fmt.Errorf("overlapping ranges %s and %s", sorted[i-1], sorted[i])
+		}
+	}
+	return nil
+}
+
 func (r Ranges) Len() int {
 	return len(r)
 }
@@ -43,36 +94,6 @@ func (r Ranges) Contains(input *Range) bool {
 	return false
 }
 
-func (r Ranges) Merged() (out Ranges) {
-	for i := 0; i < len(r); i++ {
-		curRange := r[i]
-		if i == len(r)-1 {
-			out = append(out, curRange)
-			break
-		}
-		nextRange := r[i+1]
-		if curRange.ExclusiveEndBlock != nextRange.StartBlock {
-			out = append(out, curRange)
-			continue
-		}
-
-		i++
-
-		// Loop to squash all the next ones and create a new Range
-		// from `curRange` and the latest matching `nextRange`.
-		for j := i + 1; j < len(r); j++ {
-			nextNextRange := r[j]
-			if nextRange.ExclusiveEndBlock != nextNextRange.StartBlock {
-				break
-			}
-			i++
-			nextRange = nextNextRange
-		}
-		out = append(out, NewRange(curRange.StartBlock, nextRange.ExclusiveEndBlock))
-	}
-	return out
-}
-
 func (r Ranges) MergedBuckets(maxBucketSize uint64) (out Ranges) {
 	for i := 0; i < len(r); i++ {
 		currentRange := r[i]
@@ -109,3 +130,89 @@ func (r Ranges) MergedBuckets(maxBucketSize uint64) (out Ranges) {
 	}
 	return out
 }
+
+// The set operations below treat the ranges as the set of blocks they cover.
+// They accept unsorted, overlapping or empty ranges and return the blocks of
+// the result coalesced: sorted, non-empty, neither overlapping nor adjacent.
+// The inputs are left untouched.
+
+// Coalesce returns the blocks covered by the ranges, merging the overlapping
+// and adjacent ones, the ranges don't need to be sorted.
+func (r Ranges) Coalesce() (out Ranges) {
+	sorted := make(Ranges, 0, len(r))
+	for _, el := range r {
+		if !el.IsEmpty() {
+			sorted = append(sorted, el)
+		}
+	}
+	sort.Stable(sorted)
+
+	for _, el := range sorted {
+		if last := len(out) - 1; last >= 0 && el.StartBlock <= out[last].ExclusiveEndBlock {
+			if el.ExclusiveEndBlock > out[last].ExclusiveEndBlock {
+				out[last] = NewRange(out[last].StartBlock, el.ExclusiveEndBlock)
+			}
+			continue
+		}
+		out = append(out, NewRange(el.StartBlock, el.ExclusiveEndBlock))
+	}
+	return out
+}
+
+// Union returns the blocks covered by `r` or `other`.
+func (r Ranges) Union(other Ranges) Ranges {
+	all := make(Ranges, 0, len(r)+len(other))
+	all = append(all, r...)
+	all = append(all, other...)
+	return all.Coalesce()
+}
+
+// Intersect returns the blocks covered by both `r` and `other`.
+func (r Ranges) Intersect(other Ranges) (out Ranges) {
+	left, right := r.Coalesce(), other.Coalesce()
+	for i, j := 0, 0; i < len(left) && j < len(right); {
+		start := left[i].StartBlock
+		if right[j].StartBlock > start {
+			start = right[j].StartBlock
+		}
+		end := left[i].ExclusiveEndBlock
+		if right[j].ExclusiveEndBlock < end {
+			end = right[j].ExclusiveEndBlock
+		}
+		if start < end {
+			out = append(out, NewRange(start, end))
+		}
+
+		if left[i].ExclusiveEndBlock < right[j].ExclusiveEndBlock {
+			i++
+		} else {
+			j++
+		}
+	}
+	return out
+}
+
+// Subtract returns the blocks covered by `r` but not by `other`, ex: the
+// ranges of a request not covered by the files found.
+func (r Ranges) Subtract(other Ranges) (out Ranges) {
+	removed := other.Coalesce()
+	j := 0
+	for _, el := range r.Coalesce() {
+		start := el.StartBlock
+		for j < len(removed) && removed[j].ExclusiveEndBlock <= start {
+			j++
+		}
+		for k := j; k < len(removed) && removed[k].StartBlock < el.ExclusiveEndBlock; k++ {
+			if removed[k].StartBlock > start {
+				out = append(out, NewRange(start, removed[k].StartBlock))
+			}
+			if removed[k].ExclusiveEndBlock > start {
+				start = removed[k].ExclusiveEndBlock
+			}
+		}
+		if start < el.ExclusiveEndBlock {
+			out = append(out, NewRange(start, el.ExclusiveEndBlock))
+		}
+	}
+	return out
+}
@@ -4,50 +4,112 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
-func TestRangeMerged(t *testing.T) {
-	assert.Equal(t, ParseRanges("10-40,50-70").String(), ParseRanges("10-20,20-30,30-40,50-60,60-70").Merged().String())
-	assert.Equal(t, ParseRanges("10-40,60-70").String(), ParseRanges("10-20,20-30,30-40,60-70").Merged().String())
-	assert.Equal(t, ParseRanges("10-40").String(), ParseRanges("10-20,20-30,30-40").Merged().String())
-	assert.Equal(t, ParseRanges("1-5,10-12,13-14").String(), ParseRanges("1-2,2-3,3-4,4-5,10-12,13-14").Merged().String())
-}
-
 func TestRangeMergedBuckets(t *testing.T) {
 	assert.Equal(t,
-		ParseRanges("1-10,10-11").String(),
-		ParseRanges("1-10,10-11").MergedBuckets(10).String(),
+		mustParseRanges(t, "1-10,10-11").String(),
+		mustParseRanges(t, "1-10,10-11").MergedBuckets(10).String(),
 	)
 	assert.Equal(t,
-		ParseRanges("1-10,10-12").String(),
-		ParseRanges("1-10,10-12").MergedBuckets(10).String(),
+		mustParseRanges(t, "1-10,10-12").String(),
+		mustParseRanges(t, "1-10,10-12").MergedBuckets(10).String(),
 	)
 	assert.Equal(t,
-		ParseRanges("10-30,30-40,50-70").String(),
-		ParseRanges("10-20,20-30,30-40,50-60,60-70").MergedBuckets(20).String(),
+		mustParseRanges(t, "10-30,30-40,50-70").String(),
+		mustParseRanges(t, "10-20,20-30,30-40,50-60,60-70").MergedBuckets(20).String(),
 	)
 	assert.Equal(t,
-		ParseRanges("10-30,30-50,50-60,80-100").String(),
-		ParseRanges("10-20,20-30,30-40,40-50,50-60,80-90,90-100").MergedBuckets(20).String(),
+		mustParseRanges(t, "10-30,30-50,50-60,80-100").String(),
+		mustParseRanges(t, "10-20,20-30,30-40,40-50,50-60,80-90,90-100").MergedBuckets(20).String(),
 	)
 	assert.Equal(t,
-		ParseRanges("10-20,20-30,30-40").String(),
-		ParseRanges("10-20,20-30,30-40").MergedBuckets(5).String(),
+		mustParseRanges(t, "10-20,20-30,30-40").String(),
+		mustParseRanges(t, "10-20,20-30,30-40").MergedBuckets(5).String(),
 	)
 	assert.Equal(t,
-		ParseRanges("10-20,20-30,30-40,40-50").String(),
-		ParseRanges("10-20,20-30,30-40,40-50").MergedBuckets(11).String(),
+		mustParseRanges(t, "10-20,20-30,30-40,40-50").String(),
+		mustParseRanges(t, "10-20,20-30,30-40,40-50").MergedBuckets(11).String(),
 	)
 	assert.Equal(t,
-		ParseRanges("10-20,20-30,30-40,40-50").String(),
-		ParseRanges("10-20,20-30,30-40,40-50").MergedBuckets(19).String(),
+		mustParseRanges(t, "10-20,20-30,30-40,40-50").String(),
+		mustParseRanges(t, "10-20,20-30,30-40,40-50").MergedBuckets(19).String(),
 	)
 	assert.Equal(t,
-		ParseRanges("10-30,30-50").String(),
-		ParseRanges("10-20,20-30,30-40,40-50").MergedBuckets(20).String(),
+		mustParseRanges(t, "10-30,30-50").String(),
+		mustParseRanges(t, "10-20,20-30,30-40,40-50").MergedBuckets(20).String(),
 	)
 	assert.Equal(t,
-		ParseRanges("1-4,4-5,10-12,13-14").String(),
-		ParseRanges("1-2,2-3,3-4,4-5,10-12,13-14").MergedBuckets(3).String(),
+		mustParseRanges(t, "1-4,4-5,10-12,13-14").String(),
+		mustParseRanges(t, "1-2,2-3,3-4,4-5,10-12,13-14").MergedBuckets(3).String(),
 	)
 }
+
+func TestNewRangesFromString(t *testing.T) {
+	ranges, err := NewRangesFromString("30-40, 10-20,,20-30")
+	require.NoError(t, err)
+	assert.Equal(t, "30-40,10-20,20-30", ranges.Canonical())
+
+	_, err = NewRangesFromString("10-20,15-30")
+	assert.Error(t, err, "overlapping")
+
+	_, err = NewRangesFromString("10-20,30-25")
+	assert.Error(t, err, "reversed")
+
+	ranges, err = NewRangesFromString("")
+	require.NoError(t, err)
+	assert.Len(t, ranges, 0)
+}
+
+func TestRangesCoalesce(t *testing.T) {
+	assert.Equal(t, "", Ranges(nil).Coalesce().Canonical())
+	assert.Equal(t, "10-40,50-70", mustParseRanges(t, "30-40,10-20,20-30,60-70,50-60").Coalesce().Canonical())
+	assert.Equal(t, "10-40", mustParseRanges(t, "10-30,15-20,25-40").Coalesce().Canonical())
+	assert.Equal(t, "10-20", mustParseRanges(t, "15-15,10-20,10-20").Coalesce().Canonical())
+
+	input := mustParseRanges(t, "20-30,10-20")
+	input.Coalesce()
+	assert.Equal(t, "20-30,10-20", input.Canonical(), "input left untouched")
+}
+
+func TestRangesSetOperations(t *testing.T) {
+	tests := []struct {
+		name      string
+		left      string
+		right     string
+		union     string
+		intersect string
+		subtract  string
+	}{
+		{"empty", "", "", "", "", ""},
+		{"empty right", "10-20", "", "10-20", "", "10-20"},
+		{"empty left", "", "10-20", "10-20", "", ""},
+		{"disjoint", "10-20", "30-40", "10-20,30-40", "", "10-20"},
+		{"adjacent", "10-20", "20-30", "10-30", "", "10-20"},
+		{"overlapping", "10-30", "20-40", "10-40", "20-30", "10-20"},
+		{"containing", "10-40", "20-30", "10-40", "20-30", "10-20,30-40"},
+		{"contained", "20-30", "10-40", "10-40", "20-30", ""},
+		{"equal", "10-20", "10-20", "10-20", "10-20", ""},
+		{"many", "0-10,20-30,40-50", "5-25,45-60", "0-30,40-60", "5-10,20-25,45-50", "0-5,25-30,40-45"},
+		{"unsorted and overlapping", "40-50,0-10,5-30", "20-45,20-25", "0-50", "20-30,40-45", "0-20,45-50"},
+		{"spanning several", "0-10,20-30,40-50", "5-45", "0-50", "5-10,20-30,40-45", "0-5,45-50"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			left, right := mustParseRanges(t, test.left), mustParseRanges(t, test.right)
+			assert.Equal(t, test.union, left.Union(right).Canonical(), "union")
+			assert.Equal(t, test.intersect, left.Intersect(right).Canonical(), "intersect")
+			assert.Equal(t, test.subtract, left.Subtract(right).Canonical(), "subtract")
+		})
+	}
+}
+
+func mustParseRanges(t *testing.T, in string) Ranges {
+	t.Helper()
+
+	out, err := parseRanges(in)
+	require.NoError(t, err)
+	return out
+}
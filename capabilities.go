@@ -0,0 +1,79 @@
+package substreams
+
+// Capabilities are the optional features negotiated between the client and the
+// server: the client lists the ones it supports in `Request.capabilities`, the
+// server enables those it supports too and lists them back in
+// `SessionInit.enabled_capabilities`. Behaviors that clients not aware of them
+// could not handle are only enabled when negotiated, so they can roll out
+// without breaking older clients.
+const (
+	// CapabilitySlowExecutionProgress enables the `SlowExecution` module progress
+	// messages, see the module execution budget.
+	CapabilitySlowExecutionProgress = "slow_execution_progress"
+	// CapabilityStagesProgress enables the `StagesProgress` messages, the state
+	// of the backprocessing segments of each stage.
+	CapabilityStagesProgress = "stages_progress"
+	// CapabilityPerBlockUndo sends a `BlockUndoSignal` for each reverted block,
+	// carrying the outputs that were sent for it, instead of a single one per
+	// fork naming the last valid block.
+	CapabilityPerBlockUndo = "per_block_undo"
+	// CapabilityQueueProgress enables the `QueueProgress` messages, the
+	// position of the request in the queue of the node while it waits to be
+	// started.
+	CapabilityQueueProgress = "queue_progress"
+	// CapabilityBlockMetadata advertises the `block` host functions (`number`,
+	// `id` and `timestamp`), through which modules read the header fields of
+	// the block being processed without decoding it. They are registered on
+	// every chain, by both WASM runtimes.
+	CapabilityBlockMetadata = "block_metadata"
+	// CapabilityModuleStats enables the `ModuleStats` module progress
+	// messages, the resources used by each module (WASM execution time, store
+	// operations and peak store size), so users can find their hot modules.
+	CapabilityModuleStats = "module_stats"
+	// CapabilityStructuredErrors sends the `Error` of a failed request in a
+	// last `Response`, before the stream ends with the error. The error is in
+	// the details of its gRPC status for every client.
+	CapabilityStructuredErrors = "structured_errors"
+	// CapabilityChunkProgress enables the `ChunkProgress` messages, the
+	// continuation cursor of each chunk of the requests served in chunks.
+	CapabilityChunkProgress = "chunk_progress"
+	// CapabilityBlockIsFinal allows the modules of the request to import the
+	// `block::is_final` host function, whose result depends on when a block is
+	// processed: the live blocks can be reversible, the blocks of the
+	// backprocessing jobs are always final. The requests with such modules are
+	// rejected unless they announce it, the stores of these modules and of the
+	// modules depending on them are then only saved by the backprocessing jobs.
+	CapabilityBlockIsFinal = "block_is_final"
+)
+
+// SupportedCapabilities are the capabilities implemented by this version, in
+// the order they were introduced.
+var SupportedCapabilities = []string{
+	CapabilitySlowExecutionProgress,
+	CapabilityStagesProgress,
+	CapabilityPerBlockUndo,
+	CapabilityQueueProgress,
+	CapabilityBlockMetadata,
+	CapabilityModuleStats,
+	CapabilityStructuredErrors,
+	CapabilityChunkProgress,
+	CapabilityBlockIsFinal,
+}
+
+// NegotiateCapabilities returns the capabilities of `requested` found in
+// `enabled`, in the order of `enabled`. Capabilities unknown to the server are
+// ignored.
+func NegotiateCapabilities(requested, enabled []string) (out []string) {
+	wanted := make(map[string]bool, len(requested))
+	for _, capability := range requested {
+		wanted[capability] = true
+	}
+
+	for _, capability := range enabled {
+		if wanted[capability] {
+			out = append(out, capability)
+			delete(wanted, capability)
+		}
+	}
+	return
+}
@@ -0,0 +1,28 @@
+package substreams
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegotiateCapabilities(t *testing.T) {
+	tests := []struct {
+		name      string
+		requested []string
+		enabled   []string
+		expect    []string
+	}{
+		{"old client", nil, []string{"a", "b"}, nil},
+		{"all enabled", []string{"b", "a"}, []string{"a", "b"}, []string{"a", "b"}},
+		{"unknown to the server", []string{"a", "c"}, []string{"a", "b"}, []string{"a"}},
+		{"disabled on the server", []string{"a", "b"}, []string{"b"}, []string{"b"}},
+		{"duplicated", []string{"a", "a"}, []string{"a"}, []string{"a"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expect, NegotiateCapabilities(test.requested, test.enabled))
+		})
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/credentials/oauth"
 	xdscreds "google.golang.org/grpc/credentials/xds"
+	pbhealth "google.golang.org/grpc/health/grpc_health_v1"
 	_ "google.golang.org/grpc/xds"
 )
 
@@ -88,8 +89,30 @@ func NewInternalClientFactory(config *SubstreamsClientConfig) InternalClientFact
 }
 
 func NewSubstreamsInternalClient(config *SubstreamsClientConfig) (cli pbssinternal.SubstreamsClient, closeFunc func() error, callOpts []grpc.CallOption, err error) {
+	conn, callOpts, err := newInternalConn(config)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	zlog.Debug("creating new client", zap.String("endpoint", config.endpoint))
+	cli = pbssinternal.NewSubstreamsClient(conn)
+	zlog.Debug("client created")
+	return cli, conn.Close, callOpts, nil
+}
+
+// NewInternalHealthClient returns a client of the gRPC health service of the
+// tier2 endpoint of `config`.
+func NewInternalHealthClient(config *SubstreamsClientConfig) (cli pbhealth.HealthClient, closeFunc func() error, callOpts []grpc.CallOption, err error) {
+	conn, callOpts, err := newInternalConn(config)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return pbhealth.NewHealthClient(conn), conn.Close, callOpts, nil
+}
+
+func newInternalConn(config *SubstreamsClientConfig) (conn *grpc.ClientConn, callOpts []grpc.CallOption, err error) {
 	if config == nil {
-		return nil, nil, nil, fmt.Errorf("substreams client config not set")
+		return nil, nil, fmt.Errorf("substreams client config not set")
 	}
 	endpoint := config.endpoint
 	jwt := config.jwt
@@ -97,7 +120,7 @@ func NewSubstreamsInternalClient(config *SubstreamsClientConfig) (cli pbssintern
 	useInsecureTLSConnection := config.insecure
 
 	if !portSuffixRegex.MatchString(endpoint) {
-		return nil, nil, nil, fmt.Errorf("invalid endpoint %q: endpoint's suffix must be a valid port in the form ':<port>', port 443 is usually the right one to use", endpoint)
+		return nil, nil, fmt.Errorf("invalid endpoint %q: endpoint's suffix must be a valid port in the form ':<port>', port 443 is usually the right one to use", endpoint)
 	}
 
 	bootStrapFilename := os.Getenv("GRPC_XDS_BOOTSTRAP")
@@ -108,12 +131,12 @@ func NewSubstreamsInternalClient(config *SubstreamsClientConfig) (cli pbssintern
 		log.Println("Using xDS credentials...")
 		creds, err := xdscreds.NewClientCredentials(xdscreds.ClientOptions{FallbackCreds: insecure.NewCredentials()})
 		if err != nil {
-			return nil, nil, nil, fmt.Errorf("failed to create xDS credentials: %v", err)
+			return nil, nil, fmt.Errorf("failed to create xDS credentials: %v", err)
 		}
 		dialOptions = append(dialOptions, grpc.WithTransportCredentials(creds))
 	} else {
 		if useInsecureTLSConnection && usePlainTextConnection {
-			return nil, nil, nil, fmt.Errorf("option --insecure and --plaintext are mutually exclusive, they cannot be both specified at the same time")
+			return nil, nil, fmt.Errorf("option --insecure and --plaintext are mutually exclusive, they cannot be both specified at the same time")
 		}
 		switch {
 		case usePlainTextConnection:
@@ -131,11 +154,10 @@ func NewSubstreamsInternalClient(config *SubstreamsClientConfig) (cli pbssintern
 	dialOptions = append(dialOptions, grpc.WithStreamInterceptor(otelgrpc.StreamClientInterceptor()))
 
 	zlog.Debug("getting connection", zap.String("endpoint", endpoint))
-	conn, err := dgrpc.NewExternalClient(endpoint, dialOptions...)
+	conn, err = dgrpc.NewExternalClient(endpoint, dialOptions...)
 	if err != nil {
-		return nil, nil, nil, fmt.Errorf("unable to create external gRPC client: %w", err)
+		return nil, nil, fmt.Errorf("unable to create external gRPC client: %w", err)
 	}
-	closeFunc = conn.Close
 
 	if !skipAuth {
 		zlog.Debug("creating oauth access", zap.String("endpoint", endpoint))
@@ -143,9 +165,6 @@ func NewSubstreamsInternalClient(config *SubstreamsClientConfig) (cli pbssintern
 		callOpts = append(callOpts, grpc.PerRPCCredentials(creds))
 	}
 
-	zlog.Debug("creating new client", zap.String("endpoint", endpoint))
-	cli = pbssinternal.NewSubstreamsClient(conn)
-	zlog.Debug("client created")
 	return
 }
 
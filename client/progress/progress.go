@@ -0,0 +1,337 @@
+// Package progress consumes the progress messages of a `Blocks` stream into a
+// typed model of the request's backprocessing: the progress of each module,
+// the state of the segments of each stage, their estimated time of arrival and
+// the failures. See TextRenderer and JSONRenderer to display it.
+package progress
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/streamingfast/substreams/block"
+	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
+)
+
+// Snapshot is the progress of a request at a given time, see Tracker.Snapshot.
+type Snapshot struct {
+	TraceID            string `json:"trace_id,omitempty"`
+	ResolvedStartBlock uint64 `json:"resolved_start_block"`
+	LinearHandoffBlock uint64 `json:"linear_handoff_block"`
+	MaxParallelWorkers uint64 `json:"max_parallel_workers,omitempty"`
+
+	// Queue is set while the request waits for the server to start it.
+	Queue *Queue `json:"queue,omitempty"`
+	// ContinuationCursor is the cursor of the last chunk completed, for the
+	// requests served in chunks, see `ChunkProgress`.
+	ContinuationCursor string `json:"continuation_cursor,omitempty"`
+
+	SegmentSize uint64     `json:"segment_size,omitempty"`
+	Stages      []*Stage   `json:"stages,omitempty"` // only sent by servers negotiating the `stages_progress` capability
+	Modules     []*Module  `json:"modules"`          // sorted by name
+	Failures    []*Failure `json:"failures,omitempty"`
+
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Failed tells if a module failed, ending the request.
+func (s *Snapshot) Failed() bool {
+	return len(s.Failures) != 0
+}
+
+type Queue struct {
+	Position       uint64 `json:"position"`
+	QueuedRequests uint64 `json:"queued_requests"`
+}
+
+// Stage is the backprocessing state of the segments of a stage, the modules
+// of a layer of the modules graph executed together.
+type Stage struct {
+	Index        uint32                         `json:"stage"`
+	Modules      []string                       `json:"modules"`
+	FirstSegment uint64                         `json:"first_segment"`
+	Segments     []pbsubstreamsrpc.SegmentState `json:"-"`
+
+	Pending   int `json:"pending"`
+	Scheduled int `json:"scheduled"`
+	Produced  int `json:"produced"` // produced by a job, not merged in the complete store yet, or merging
+	Completed int `json:"completed"`
+
+	// ETA is the estimated time left to complete the stage's segments, zero
+	// when it's complete or not known yet.
+	ETA time.Duration `json:"eta_ns,omitempty"`
+}
+
+// Done tells if all the segments of the stage are completed.
+func (s *Stage) Done() bool {
+	return s.Completed == len(s.Segments)
+}
+
+// Module is the backprocessing progress of a module up to the linear handoff
+// block.
+type Module struct {
+	Name               string       `json:"name"`
+	ProcessedRanges    block.Ranges `json:"processed_ranges,omitempty"`
+	ProcessedBlocks    uint64       `json:"processed_blocks"`
+	RemainingBlocks    uint64       `json:"remaining_blocks"`
+	AvailableUpToBlock uint64       `json:"available_up_to_block,omitempty"` // initial state of a store
+
+	BytesRead    uint64 `json:"bytes_read,omitempty"`
+	BytesWritten uint64 `json:"bytes_written,omitempty"`
+
+	// Resources used since the request started, only sent by servers
+	// negotiating the `module_stats` capability.
+	WasmExecution      time.Duration `json:"wasm_execution_ns,omitempty"`
+	StoreOperations    uint64        `json:"store_operations,omitempty"`
+	StorePeakSizeBytes uint64        `json:"store_peak_size_bytes,omitempty"`
+
+	BlocksPerSecond float64 `json:"blocks_per_second,omitempty"`
+	// ETA is the estimated time left to process the module up to the linear
+	// handoff block, zero when it's done or not known yet.
+	ETA time.Duration `json:"eta_ns,omitempty"`
+
+	SlowBlocks []*SlowBlock `json:"slow_blocks,omitempty"` // of the last SlowExecution warning
+	Failure    *Failure     `json:"failure,omitempty"`
+}
+
+// Percent is the share of the blocks processed by the module, up to the
+// linear handoff block.
+func (m *Module) Percent() float64 {
+	total := m.ProcessedBlocks + m.RemainingBlocks
+	if total == 0 {
+		return 100
+	}
+	return float64(m.ProcessedBlocks) / float64(total) * 100
+}
+
+type SlowBlock struct {
+	BlockNum uint64        `json:"block_num"`
+	Duration time.Duration `json:"duration_ns"`
+	Budget   time.Duration `json:"budget_ns"`
+}
+
+type Failure struct {
+	Module        string   `json:"module"`
+	Reason        string   `json:"reason"`
+	Logs          []string `json:"logs,omitempty"`
+	LogsTruncated bool     `json:"logs_truncated,omitempty"`
+	Limit         string   `json:"limit,omitempty"` // execution limit that stopped the module: timeout or fuel
+}
+
+// Tracker builds the progress of a request from the responses of its stream,
+// passed to Handle. It is safe to read the snapshots from another goroutine.
+type Tracker struct {
+	mu  sync.Mutex
+	now func() time.Time
+
+	snapshot Snapshot
+	modules  map[string]*Module
+	rates    map[string]*rate // by module name, and by "stage/<index>"
+}
+
+type rate struct {
+	since time.Time
+	from  uint64
+}
+
+func NewTracker() *Tracker {
+	return &Tracker{
+		now:     time.Now,
+		modules: make(map[string]*Module),
+		rates:   make(map[string]*rate),
+	}
+}
+
+// Handle updates the progress from `resp`. It returns false for the responses
+// that don't carry progress information, like the blocks data.
+func (t *Tracker) Handle(resp *pbsubstreamsrpc.Response) bool {
+	switch msg := resp.Message.(type) {
+	case *pbsubstreamsrpc.Response_Session:
+		t.HandleSessionInit(msg.Session)
+	case *pbsubstreamsrpc.Response_Progress:
+		t.HandleProgress(msg.Progress)
+	default:
+		return false
+	}
+	return true
+}
+
+func (t *Tracker) HandleSessionInit(session *pbsubstreamsrpc.SessionInit) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.snapshot.TraceID = session.TraceId
+	t.snapshot.ResolvedStartBlock = session.ResolvedStartBlock
+	t.snapshot.LinearHandoffBlock = session.LinearHandoffBlock
+	t.snapshot.MaxParallelWorkers = session.MaxParallelWorkers
+	for _, mod := range t.modules {
+		t.updateModule(mod)
+	}
+	t.snapshot.UpdatedAt = t.now()
+}
+
+func (t *Tracker) HandleProgress(progress *pbsubstreamsrpc.ModulesProgress) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.snapshot.UpdatedAt = t.now()
+	if progress.Queue != nil {
+		t.snapshot.Queue = &Queue{Position: progress.Queue.Position, QueuedRequests: progress.Queue.QueuedRequests}
+		return
+	}
+	t.snapshot.Queue = nil
+
+	if progress.Chunk != nil {
+		t.snapshot.ContinuationCursor = progress.Chunk.ContinuationCursor
+	}
+	if progress.Stages != nil {
+		t.handleStages(progress.Stages)
+	}
+	for _, modProgress := range progress.Modules {
+		t.handleModule(modProgress)
+	}
+}
+
+func (t *Tracker) handleModule(progress *pbsubstreamsrpc.ModuleProgress) {
+	mod, found := t.modules[progress.Name]
+	if !found {
+		mod = &Module{Name: progress.Name}
+		t.modules[progress.Name] = mod
+		t.snapshot.Modules = append(t.snapshot.Modules, mod)
+		sort.Slice(t.snapshot.Modules, func(i, j int) bool { return t.snapshot.Modules[i].Name < t.snapshot.Modules[j].Name })
+	}
+
+	switch msg := progress.Type.(type) {
+	case *pbsubstreamsrpc.ModuleProgress_ProcessedRanges_:
+		for _, r := range msg.ProcessedRanges.ProcessedRanges {
+			mod.ProcessedRanges = append(mod.ProcessedRanges, block.NewRange(r.StartBlock, r.EndBlock))
+		}
+		mod.ProcessedRanges = mod.ProcessedRanges.Coalesce()
+		t.updateModule(mod)
+	case *pbsubstreamsrpc.ModuleProgress_InitialState_:
+		mod.AvailableUpToBlock = msg.InitialState.AvailableUpToBlock
+	case *pbsubstreamsrpc.ModuleProgress_ProcessedBytes_:
+		mod.BytesRead = msg.ProcessedBytes.TotalBytesRead
+		mod.BytesWritten = msg.ProcessedBytes.TotalBytesWritten
+	case *pbsubstreamsrpc.ModuleProgress_ModuleStats_:
+		mod.WasmExecution = time.Duration(msg.ModuleStats.WasmExecutionNs)
+		mod.StoreOperations = msg.ModuleStats.StoreOperations
+		mod.StorePeakSizeBytes = msg.ModuleStats.StorePeakSizeBytes
+	case *pbsubstreamsrpc.ModuleProgress_SlowExecution_:
+		budget := time.Duration(msg.SlowExecution.BudgetMs) * time.Millisecond
+		mod.SlowBlocks = nil
+		for _, slow := range msg.SlowExecution.Blocks {
+			mod.SlowBlocks = append(mod.SlowBlocks, &SlowBlock{BlockNum: slow.BlockNum, Duration: time.Duration(slow.DurationMs) * time.Millisecond, Budget: budget})
+		}
+	case *pbsubstreamsrpc.ModuleProgress_Failed_:
+		mod.Failure = &Failure{
+			Module:        progress.Name,
+			Reason:        msg.Failed.Reason,
+			Logs:          msg.Failed.Logs,
+			LogsTruncated: msg.Failed.LogsTruncated,
+		}
+		if limit := msg.Failed.LimitExceeded; limit != nil {
+			mod.Failure.Limit = strings.ToLower(strings.TrimPrefix(limit.Limit.String(), "EXECUTION_LIMIT_"))
+		}
+		t.snapshot.Failures = append(t.snapshot.Failures, mod.Failure)
+	}
+}
+
+// updateModule computes the blocks left to process by `mod`, from its lowest
+// processed block up to the linear handoff block, and its ETA.
+func (t *Tracker) updateModule(mod *Module) {
+	mod.ProcessedBlocks = 0
+	for _, r := range mod.ProcessedRanges {
+		mod.ProcessedBlocks += r.Size()
+	}
+
+	mod.RemainingBlocks = 0
+	if len(mod.ProcessedRanges) != 0 && t.snapshot.LinearHandoffBlock > mod.ProcessedRanges[0].StartBlock {
+		target := block.Ranges{block.NewRange(mod.ProcessedRanges[0].StartBlock, t.snapshot.LinearHandoffBlock)}
+		for _, r := range target.Subtract(mod.ProcessedRanges) {
+			mod.RemainingBlocks += r.Size()
+		}
+	}
+
+	mod.BlocksPerSecond, mod.ETA = t.estimate(mod.Name, mod.ProcessedBlocks, mod.RemainingBlocks)
+}
+
+func (t *Tracker) handleStages(progress *pbsubstreamsrpc.StagesProgress) {
+	t.snapshot.SegmentSize = progress.SegmentSize
+	t.snapshot.Stages = nil
+	for _, stageProgress := range progress.Stages {
+		stage := &Stage{
+			Index:        stageProgress.Stage,
+			Modules:      stageProgress.Modules,
+			FirstSegment: stageProgress.FirstSegment,
+			Segments:     stageProgress.Segments,
+		}
+		for _, state := range stage.Segments {
+			switch state {
+			case pbsubstreamsrpc.SegmentState_SEGMENT_STATE_PENDING:
+				stage.Pending++
+			case pbsubstreamsrpc.SegmentState_SEGMENT_STATE_SCHEDULED:
+				stage.Scheduled++
+			case pbsubstreamsrpc.SegmentState_SEGMENT_STATE_PARTIAL_PRESENT, pbsubstreamsrpc.SegmentState_SEGMENT_STATE_MERGING:
+				stage.Produced++
+			case pbsubstreamsrpc.SegmentState_SEGMENT_STATE_COMPLETED:
+				stage.Completed++
+			}
+		}
+		_, stage.ETA = t.estimate(stageRateKey(stage.Index), uint64(stage.Completed), uint64(len(stage.Segments)-stage.Completed))
+		t.snapshot.Stages = append(t.snapshot.Stages, stage)
+	}
+}
+
+func stageRateKey(index uint32) string {
+	return fmt.Sprintf("stage/%d", index)
+}
+
+// estimate returns the average rate at which `done` progressed since it was
+// first seen under `key`, and the time left to progress by `remaining` at that
+// rate.
+func (t *Tracker) estimate(key string, done, remaining uint64) (perSecond float64, eta time.Duration) {
+	now := t.now()
+	r, found := t.rates[key]
+	if !found || done < r.from {
+		t.rates[key] = &rate{since: now, from: done}
+		return 0, 0
+	}
+
+	elapsed := now.Sub(r.since)
+	if elapsed <= 0 || done == r.from {
+		return 0, 0
+	}
+	perSecond = float64(done-r.from) / elapsed.Seconds()
+	if remaining == 0 {
+		return perSecond, 0
+	}
+	return perSecond, time.Duration(float64(remaining) / perSecond * float64(time.Second))
+}
+
+// Snapshot returns a copy of the current progress.
+func (t *Tracker) Snapshot() *Snapshot {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	out := t.snapshot
+	if out.Queue != nil {
+		queue := *out.Queue
+		out.Queue = &queue
+	}
+	out.Stages = make([]*Stage, len(t.snapshot.Stages))
+	for i, stage := range t.snapshot.Stages {
+		copied := *stage
+		out.Stages[i] = &copied
+	}
+	out.Modules = make([]*Module, len(t.snapshot.Modules))
+	for i, mod := range t.snapshot.Modules {
+		copied := *mod
+		copied.ProcessedRanges = append(block.Ranges(nil), mod.ProcessedRanges...)
+		out.Modules[i] = &copied
+	}
+	out.Failures = append([]*Failure(nil), t.snapshot.Failures...)
+	return &out
+}
@@ -0,0 +1,145 @@
+package progress
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/streamingfast/substreams/block"
+	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
+)
+
+func processedRanges(name string, ranges ...*pbsubstreamsrpc.BlockRange) *pbsubstreamsrpc.ModuleProgress {
+	return &pbsubstreamsrpc.ModuleProgress{
+		Name: name,
+		Type: &pbsubstreamsrpc.ModuleProgress_ProcessedRanges_{ProcessedRanges: &pbsubstreamsrpc.ModuleProgress_ProcessedRanges{ProcessedRanges: ranges}},
+	}
+}
+
+func progressResponse(progress *pbsubstreamsrpc.ModulesProgress) *pbsubstreamsrpc.Response {
+	return &pbsubstreamsrpc.Response{Message: &pbsubstreamsrpc.Response_Progress{Progress: progress}}
+}
+
+func TestTracker(t *testing.T) {
+	now := time.Unix(0, 0)
+	tracker := NewTracker()
+	tracker.now = func() time.Time { return now }
+
+	assert.True(t, tracker.Handle(&pbsubstreamsrpc.Response{Message: &pbsubstreamsrpc.Response_Session{Session: &pbsubstreamsrpc.SessionInit{
+		TraceId:            "trace",
+		ResolvedStartBlock: 1000,
+		LinearHandoffBlock: 1000,
+	}}}))
+	assert.False(t, tracker.Handle(&pbsubstreamsrpc.Response{Message: &pbsubstreamsrpc.Response_BlockScopedData{}}))
+
+	tracker.Handle(progressResponse(&pbsubstreamsrpc.ModulesProgress{Queue: &pbsubstreamsrpc.QueueProgress{Position: 2, QueuedRequests: 3}}))
+	assert.Equal(t, &Queue{Position: 2, QueuedRequests: 3}, tracker.Snapshot().Queue)
+
+	tracker.Handle(progressResponse(&pbsubstreamsrpc.ModulesProgress{Chunk: &pbsubstreamsrpc.ChunkProgress{EndBlock: 2000, ContinuationCursor: "cursor"}}))
+	assert.Equal(t, "cursor", tracker.Snapshot().ContinuationCursor)
+
+	tracker.Handle(progressResponse(&pbsubstreamsrpc.ModulesProgress{
+		Modules: []*pbsubstreamsrpc.ModuleProgress{
+			processedRanges("store_b", &pbsubstreamsrpc.BlockRange{StartBlock: 0, EndBlock: 100}),
+			processedRanges("map_a", &pbsubstreamsrpc.BlockRange{StartBlock: 200, EndBlock: 300}),
+		},
+		Stages: &pbsubstreamsrpc.StagesProgress{
+			SegmentSize: 100,
+			Stages: []*pbsubstreamsrpc.StageProgress{{
+				Stage:    0,
+				Modules:  []string{"store_b"},
+				Segments: []pbsubstreamsrpc.SegmentState{pbsubstreamsrpc.SegmentState_SEGMENT_STATE_COMPLETED, pbsubstreamsrpc.SegmentState_SEGMENT_STATE_MERGING, pbsubstreamsrpc.SegmentState_SEGMENT_STATE_SCHEDULED, pbsubstreamsrpc.SegmentState_SEGMENT_STATE_PENDING},
+			}},
+		},
+	}))
+
+	now = now.Add(10 * time.Second)
+	tracker.Handle(progressResponse(&pbsubstreamsrpc.ModulesProgress{
+		Modules: []*pbsubstreamsrpc.ModuleProgress{
+			processedRanges("store_b", &pbsubstreamsrpc.BlockRange{StartBlock: 100, EndBlock: 200}, &pbsubstreamsrpc.BlockRange{StartBlock: 300, EndBlock: 400}),
+		},
+	}))
+
+	snapshot := tracker.Snapshot()
+	assert.Nil(t, snapshot.Queue)
+	require.Len(t, snapshot.Modules, 2)
+	assert.Equal(t, "map_a", snapshot.Modules[0].Name)
+
+	storeB := snapshot.Modules[1]
+	assert.Equal(t, block.Ranges{block.NewRange(0, 200), block.NewRange(300, 400)}, storeB.ProcessedRanges)
+	assert.Equal(t, uint64(300), storeB.ProcessedBlocks)
+	assert.Equal(t, uint64(700), storeB.RemainingBlocks)
+	assert.Equal(t, 20.0, storeB.BlocksPerSecond)
+	assert.Equal(t, 35*time.Second, storeB.ETA)
+	assert.Equal(t, 30.0, storeB.Percent())
+
+	require.Len(t, snapshot.Stages, 1)
+	stage := snapshot.Stages[0]
+	assert.Equal(t, []int{1, 1, 1, 1}, []int{stage.Pending, stage.Scheduled, stage.Produced, stage.Completed})
+	assert.False(t, stage.Done())
+
+	tracker.Handle(progressResponse(&pbsubstreamsrpc.ModulesProgress{
+		Modules: []*pbsubstreamsrpc.ModuleProgress{{
+			Name: "store_b",
+			Type: &pbsubstreamsrpc.ModuleProgress_ModuleStats_{ModuleStats: &pbsubstreamsrpc.ModuleProgress_ModuleStats{WasmExecutionNs: 1500, StoreOperations: 20, StorePeakSizeBytes: 2048}},
+		}},
+	}))
+	storeB = tracker.Snapshot().Modules[1]
+	assert.Equal(t, []uint64{1500, 20, 2048}, []uint64{uint64(storeB.WasmExecution), storeB.StoreOperations, storeB.StorePeakSizeBytes})
+
+	tracker.Handle(progressResponse(&pbsubstreamsrpc.ModulesProgress{
+		Modules: []*pbsubstreamsrpc.ModuleProgress{{
+			Name: "map_a",
+			Type: &pbsubstreamsrpc.ModuleProgress_Failed_{Failed: &pbsubstreamsrpc.ModuleProgress_Failed{Reason: "panic", Logs: []string{"log"}}},
+		}},
+	}))
+	snapshot = tracker.Snapshot()
+	assert.True(t, snapshot.Failed())
+	assert.Equal(t, []*Failure{{Module: "map_a", Reason: "panic", Logs: []string{"log"}}}, snapshot.Failures)
+
+	// snapshots are not changed by the following progress messages
+	tracker.Handle(progressResponse(&pbsubstreamsrpc.ModulesProgress{
+		Modules: []*pbsubstreamsrpc.ModuleProgress{processedRanges("store_b", &pbsubstreamsrpc.BlockRange{StartBlock: 400, EndBlock: 500})},
+	}))
+	assert.Equal(t, uint64(300), storeB.ProcessedBlocks)
+}
+
+func TestRenderers(t *testing.T) {
+	snapshot := &Snapshot{
+		ResolvedStartBlock: 1000,
+		LinearHandoffBlock: 1000,
+		Modules: []*Module{
+			{Name: "map_a", ProcessedBlocks: 500, RemainingBlocks: 500, BlocksPerSecond: 50, ETA: 10 * time.Second, WasmExecution: 1500 * time.Millisecond, StoreOperations: 20},
+			{Name: "store_b", ProcessedBlocks: 1000, WasmExecution: time.Second, StoreOperations: 10, StorePeakSizeBytes: 2048},
+		},
+		Stages: []*Stage{{
+			Index:     0,
+			Modules:   []string{"map_a"},
+			Segments:  []pbsubstreamsrpc.SegmentState{pbsubstreamsrpc.SegmentState_SEGMENT_STATE_COMPLETED, pbsubstreamsrpc.SegmentState_SEGMENT_STATE_PENDING},
+			Completed: 1,
+			Pending:   1,
+		}},
+		Failures: []*Failure{{Module: "map_a", Reason: "panic", LogsTruncated: true}},
+	}
+
+	text := bytes.NewBuffer(nil)
+	require.NoError(t, TextRenderer{BarWidth: 4}.Render(text, snapshot))
+	assert.Equal(t, `Request starting at block 1000, backprocessing up to block 1000
+map_a   [██░░]  50.0% 500/1000 blocks, 50 blocks/s, ETA 10s, wasm 1.5s, 20 store ops
+store_b [████] 100.0% 1000/1000 blocks, wasm 1s, 10 store ops, store peak 2.0 KiB
+stage 0 [█░] 1/2 segments (map_a)
+map_a: failed: panic
+map_a: <logs truncated>
+`, text.String())
+
+	jsonOut := bytes.NewBuffer(nil)
+	require.NoError(t, JSONRenderer{}.Render(jsonOut, snapshot))
+	decoded := &Snapshot{}
+	require.NoError(t, json.Unmarshal(jsonOut.Bytes(), decoded))
+	assert.Equal(t, snapshot.Modules, decoded.Modules)
+	assert.Equal(t, 1, decoded.Stages[0].Completed)
+}
@@ -0,0 +1,142 @@
+package progress
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+
+	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
+)
+
+// Renderer writes a snapshot of the progress of a request.
+type Renderer interface {
+	Render(w io.Writer, snapshot *Snapshot) error
+}
+
+// JSONRenderer writes each snapshot as a single line of JSON, for tools
+// processing the progress of their requests.
+type JSONRenderer struct{}
+
+func (JSONRenderer) Render(w io.Writer, snapshot *Snapshot) error {
+	cnt, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("marshal progress: %w", err)
+	}
+	_, err = w.Write(append(cnt, '\n'))
+	return err
+}
+
+// TextRenderer writes each snapshot for a terminal: a line per module with its
+// progress bar, a line per stage with the state of its segments, followed by
+// the failures.
+type TextRenderer struct {
+	// BarWidth is the number of cells of the progress bars, 40 when zero.
+	BarWidth int
+}
+
+var segmentGlyphs = map[pbsubstreamsrpc.SegmentState]string{
+	pbsubstreamsrpc.SegmentState_SEGMENT_STATE_PENDING:         "░",
+	pbsubstreamsrpc.SegmentState_SEGMENT_STATE_SCHEDULED:       "▒",
+	pbsubstreamsrpc.SegmentState_SEGMENT_STATE_PARTIAL_PRESENT: "▓",
+	pbsubstreamsrpc.SegmentState_SEGMENT_STATE_MERGING:         "▓",
+	pbsubstreamsrpc.SegmentState_SEGMENT_STATE_COMPLETED:       "█",
+}
+
+func (r TextRenderer) Render(w io.Writer, snapshot *Snapshot) error {
+	width := r.BarWidth
+	if width <= 0 {
+		width = 40
+	}
+
+	var out strings.Builder
+	if snapshot.Queue != nil {
+		fmt.Fprintf(&out, "Waiting for the server to start the request: position %d of %d in queue\n", snapshot.Queue.Position, snapshot.Queue.QueuedRequests)
+	}
+	if snapshot.LinearHandoffBlock != 0 {
+		fmt.Fprintf(&out, "Request starting at block %d, backprocessing up to block %d\n", snapshot.ResolvedStartBlock, snapshot.LinearHandoffBlock)
+	}
+
+	nameWidth := 0
+	for _, mod := range snapshot.Modules {
+		if len(mod.Name) > nameWidth {
+			nameWidth = len(mod.Name)
+		}
+	}
+	for _, mod := range snapshot.Modules {
+		fmt.Fprintf(&out, "%-*s [%s] %5.1f%% %d/%d blocks", nameWidth, mod.Name, renderBar(mod.Percent(), width), mod.Percent(), mod.ProcessedBlocks, mod.ProcessedBlocks+mod.RemainingBlocks)
+		if mod.BlocksPerSecond != 0 {
+			fmt.Fprintf(&out, ", %.0f blocks/s", mod.BlocksPerSecond)
+		}
+		if mod.ETA != 0 {
+			fmt.Fprintf(&out, ", ETA %s", mod.ETA.Round(time.Second))
+		}
+		if len(mod.SlowBlocks) != 0 {
+			fmt.Fprintf(&out, ", %d slow blocks", len(mod.SlowBlocks))
+		}
+		if mod.WasmExecution != 0 {
+			fmt.Fprintf(&out, ", wasm %s, %d store ops", mod.WasmExecution.Round(time.Millisecond), mod.StoreOperations)
+		}
+		if mod.StorePeakSizeBytes != 0 {
+			fmt.Fprintf(&out, ", store peak %s", humanize.IBytes(mod.StorePeakSizeBytes))
+		}
+		out.WriteString("\n")
+	}
+
+	for _, stage := range snapshot.Stages {
+		fmt.Fprintf(&out, "stage %d [%s] %d/%d segments", stage.Index, renderSegments(stage.Segments, width), stage.Completed, len(stage.Segments))
+		if stage.ETA != 0 {
+			fmt.Fprintf(&out, ", ETA %s", stage.ETA.Round(time.Second))
+		}
+		fmt.Fprintf(&out, " (%s)\n", strings.Join(stage.Modules, ", "))
+	}
+
+	for _, failure := range snapshot.Failures {
+		fmt.Fprintf(&out, "%s: failed: %s\n", failure.Module, failure.Reason)
+		for _, log := range failure.Logs {
+			fmt.Fprintf(&out, "%s: log: %s\n", failure.Module, log)
+		}
+		if failure.LogsTruncated {
+			fmt.Fprintf(&out, "%s: <logs truncated>\n", failure.Module)
+		}
+	}
+
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+func renderBar(percent float64, width int) string {
+	filled := int(percent / 100 * float64(width))
+	if filled > width {
+		filled = width
+	}
+	return strings.Repeat("█", filled) + strings.Repeat("░", width-filled)
+}
+
+// renderSegments renders `segments` in at most `width` cells, each cell
+// showing the least advanced state of the segments it spans.
+func renderSegments(segments []pbsubstreamsrpc.SegmentState, width int) string {
+	perCell := (len(segments) + width - 1) / width
+	if perCell == 0 {
+		perCell = 1
+	}
+
+	var out strings.Builder
+	for lo := 0; lo < len(segments); lo += perCell {
+		hi := lo + perCell
+		if hi > len(segments) {
+			hi = len(segments)
+		}
+		least := pbsubstreamsrpc.SegmentState_SEGMENT_STATE_COMPLETED
+		for _, state := range segments[lo:hi] {
+			if state < least {
+				least = state
+			}
+		}
+		out.WriteString(segmentGlyphs[least])
+	}
+	return out.String()
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
+)
+
+// printExplanation prints the backprocessing plan returned by the `Explain` call.
+func printExplanation(out io.Writer, explanation *pbsubstreamsrpc.ExplainResponse) {
+	fmt.Fprintf(out, "Resolved start block: %d\n", explanation.ResolvedStartBlock)
+	fmt.Fprintf(out, "Linear handoff block: %d\n", explanation.LinearHandoffBlock)
+	fmt.Fprintf(out, "Segment size: %d blocks, job size: %d blocks, parallel workers: %d\n", explanation.SegmentSize, explanation.JobSize, explanation.MaxParallelWorkers)
+
+	estimate := "unknown, no throughput measured yet"
+	if explanation.EstimatedDurationMs != 0 {
+		estimate = (time.Duration(explanation.EstimatedDurationMs) * time.Millisecond).String()
+		if !explanation.EstimateComplete {
+			estimate += " (some modules have no measured throughput and are not part of the estimate)"
+		}
+	}
+	fmt.Fprintf(out, "Estimated duration: %s\n", estimate)
+
+	fmt.Fprintln(out)
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "MODULE\tCACHED\tJOBS\tBLOCKS\tSEGMENTS")
+	for _, module := range explanation.Modules {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\n", module.Name, blockRanges(module.CachedRanges), module.Jobs, module.BlocksToProcess, module.SegmentsToProcess)
+	}
+	w.Flush()
+
+	if len(explanation.Jobs) == 0 {
+		fmt.Fprintln(out, "\nNo jobs to run, everything is served from the cache.")
+		return
+	}
+
+	fmt.Fprintf(out, "\nJobs, highest priority first (%d):\n", len(explanation.Jobs))
+	w = tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "MODULE\tRANGE\tPRIORITY\tSEGMENTS\tREQUIRES")
+	for _, job := range explanation.Jobs {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\n", job.Module, blockRanges([]*pbsubstreamsrpc.BlockRange{job.Range}), job.Priority, job.Segments, strings.Join(job.RequiredModules, ","))
+	}
+	w.Flush()
+}
+
+func blockRanges(ranges []*pbsubstreamsrpc.BlockRange) string {
+	if len(ranges) == 0 {
+		return "-"
+	}
+
+	out := make([]string, len(ranges))
+	for i, rng := range ranges {
+		out[i] = fmt.Sprintf("[%d, %d)", rng.StartBlock, rng.EndBlock)
+	}
+	return strings.Join(out, ",")
+}
@@ -5,8 +5,10 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
+	"github.com/streamingfast/substreams"
 	"github.com/streamingfast/substreams/manifest"
 
 	tea "github.com/charmbracelet/bubbletea"
@@ -27,12 +29,14 @@ func init() {
 	guiCmd.Flags().StringP("start-block", "s", "", "Start block to stream from. If empty, will be replaced by initialBlock of the first module you are streaming. If negative, will be resolved by the server relative to the chain head")
 	guiCmd.Flags().StringP("cursor", "c", "", "Cursor to stream from. Leave blank for no cursor")
 	guiCmd.Flags().StringP("stop-block", "t", "0", "Stop block to end stream at, inclusively.")
+	guiCmd.Flags().Bool("allow-sunset-modules", false, "Run the modules past their deprecation sunset date instead of having the server refuse the request")
 	guiCmd.Flags().Bool("final-blocks-only", false, "Only process blocks that have pass finality, to prevent any reorg and undo signal by staying further away from the chain HEAD")
 	guiCmd.Flags().StringSlice("debug-modules-initial-snapshot", nil, "List of 'store' modules from which to print the initial data snapshot (Unavailable in Production Mode")
 	guiCmd.Flags().StringSlice("debug-modules-output", nil, "List of extra modules from which to print outputs, deltas and logs (Unavailable in Production Mode)")
 	guiCmd.Flags().Bool("production-mode", false, "Enable Production Mode, with high-speed parallel processing")
 	guiCmd.Flags().StringArrayP("params", "p", nil, "Set a params for parameterizable modules. Can be specified multiple times. Ex: -p module1=valA -p module2=valX&valY")
 	guiCmd.Flags().Bool("replay", false, "Replay saved session into GUI from replay.bin")
+	guiCmd.Flags().Uint64("output-sampling", 0, "Ask the server to only send the outputs of every Nth block (blocks where modules produced data are always sent), keeping the GUI responsive on busy streams. 0 disables sampling")
 	rootCmd.AddCommand(guiCmd)
 }
 
@@ -120,6 +124,14 @@ func runGui(cmd *cobra.Command, args []string) error {
 
 	stopBlock := mustGetString(cmd, "stop-block")
 
+	headers := parseHeaders(mustGetStringSlice(cmd, "header"))
+	if outputSampling := mustGetUint64(cmd, "output-sampling"); outputSampling > 1 && !productionMode {
+		if headers == nil {
+			headers = make(map[string]string)
+		}
+		headers[substreams.OutputSamplingHeader] = strconv.FormatUint(outputSampling, 10)
+	}
+
 	requestConfig := &request.RequestConfig{
 		ManifestPath:                manifestPath,
 		ReadFromModule:              readFromModule,
@@ -130,11 +142,12 @@ func runGui(cmd *cobra.Command, args []string) error {
 		SubstreamsClientConfig:      substreamsClientConfig,
 		HomeDir:                     homeDir,
 		Vcr:                         mustGetBool(cmd, "replay"),
-		Headers:                     parseHeaders(mustGetStringSlice(cmd, "header")),
+		Headers:                     headers,
 		Cursor:                      cursor,
 		StartBlock:                  startBlock,
 		StopBlock:                   stopBlock,
 		FinalBlocksOnly:             mustGetBool(cmd, "final-blocks-only"),
+		AllowSunsetModules:          mustGetBool(cmd, "allow-sunset-modules"),
 	}
 
 	ui, err := tui2.New(requestConfig)
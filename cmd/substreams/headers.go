@@ -1,8 +1,11 @@
 package main
 
 import (
+	"context"
 	"log"
 	"strings"
+
+	"google.golang.org/grpc/metadata"
 )
 
 // util to parse headers flags
@@ -20,3 +23,16 @@ func parseHeaders(headers []string) map[string]string {
 	}
 	return result
 }
+
+// withHeaders adds the headers flags to the outgoing gRPC metadata of `ctx`.
+func withHeaders(ctx context.Context, headers []string) context.Context {
+	if headers == nil {
+		return ctx
+	}
+	res := parseHeaders(headers)
+	headerArray := make([]string, 0, len(res)*2)
+	for k, v := range res {
+		headerArray = append(headerArray, k, v)
+	}
+	return metadata.AppendToOutgoingContext(ctx, headerArray...)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/spf13/cobra"
+	"github.com/streamingfast/cli"
+	"github.com/streamingfast/substreams/client"
+	"github.com/streamingfast/substreams/manifest"
+	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
+	"github.com/streamingfast/substreams/tools"
+)
+
+func init() {
+	keyHistoryCmd.Flags().StringP("substreams-endpoint", "e", "mainnet.eth.streamingfast.io:443", "Substreams gRPC endpoint")
+	keyHistoryCmd.Flags().String("substreams-api-token-envvar", "SUBSTREAMS_API_TOKEN", "name of variable containing Substreams Authentication token")
+	keyHistoryCmd.Flags().StringP("start-block", "s", "", "Start block of the history. If empty, will be replaced by initialBlock of the store module")
+	keyHistoryCmd.Flags().StringP("stop-block", "t", "0", "Stop block of the history, exclusively. A '+' prefix can indicate 'relative to start-block'")
+	keyHistoryCmd.Flags().Bool("insecure", false, "Skip certificate validation on GRPC connection")
+	keyHistoryCmd.Flags().Bool("plaintext", false, "Establish GRPC connection in plaintext")
+	keyHistoryCmd.Flags().StringSliceP("header", "H", nil, "Additional headers to be sent in the substreams request")
+	keyHistoryCmd.Flags().StringArrayP("params", "p", nil, "Set a params for parameterizable modules. Can be specified multiple times. Ex: -p module1=valA -p module2=valX&valY")
+	rootCmd.AddCommand(keyHistoryCmd)
+}
+
+var keyHistoryCmd = &cobra.Command{
+	Use:   "key-history [<manifest>] <store_module> <key>",
+	Short: "Print the changes of a single key of a store module over a block range",
+	Long: cli.Dedent(`
+		Print the changes of a single key of a store module over a block range, replayed by the remote endpoint from the
+		store's cached deltas, to explain how its value came to be. Nothing is executed: ranges that the endpoint did not
+		process yet are reported as missing.
+	`),
+	RunE:         runKeyHistory,
+	Args:         cobra.RangeArgs(2, 3),
+	SilenceUsage: true,
+}
+
+func runKeyHistory(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+
+	var manifestPath string
+	if len(args) == 3 {
+		manifestPath, args = args[0], args[1:]
+	}
+	storeModule, key := args[0], args[1]
+
+	manifestReader, err := manifest.NewReader(manifestPath)
+	if err != nil {
+		return fmt.Errorf("manifest reader: %w", err)
+	}
+
+	pkg, err := manifestReader.Read()
+	if err != nil {
+		return fmt.Errorf("read manifest %q: %w", manifestPath, err)
+	}
+
+	if err := manifest.ApplyParams(mustGetStringArray(cmd, "params"), pkg); err != nil {
+		return err
+	}
+
+	graph, err := manifest.NewModuleGraph(pkg.Modules.Modules)
+	if err != nil {
+		return fmt.Errorf("creating module graph: %w", err)
+	}
+
+	startBlock, readFromModule, err := readStartBlockFlag(cmd, "start-block")
+	if err != nil {
+		return fmt.Errorf("start block: %w", err)
+	}
+	if readFromModule {
+		sb, err := graph.ModuleInitialBlock(storeModule)
+		if err != nil {
+			return fmt.Errorf("getting module start block: %w", err)
+		}
+		startBlock = int64(sb)
+	}
+	if startBlock < 0 {
+		return fmt.Errorf("start block must be positive")
+	}
+
+	stopBlock, err := readStopBlockFlag(cmd, startBlock, "stop-block")
+	if err != nil {
+		return fmt.Errorf("stop block: %w", err)
+	}
+
+	substreamsClientConfig := client.NewSubstreamsClientConfig(
+		mustGetString(cmd, "substreams-endpoint"),
+		tools.ReadAPIToken(cmd, "substreams-api-token-envvar"),
+		mustGetBool(cmd, "insecure"),
+		mustGetBool(cmd, "plaintext"),
+	)
+
+	ssClient, connClose, callOpts, err := client.NewSubstreamsClient(substreamsClientConfig)
+	if err != nil {
+		return fmt.Errorf("substreams client setup: %w", err)
+	}
+	defer connClose()
+
+	req := &pbsubstreamsrpc.StoreKeyHistoryRequest{
+		Modules:    pkg.Modules,
+		Module:     storeModule,
+		Key:        key,
+		StartBlock: uint64(startBlock),
+		StopBlock:  stopBlock,
+	}
+
+	history, err := ssClient.StoreKeyHistory(withHeaders(ctx, mustGetStringSlice(cmd, "header")), req, callOpts...)
+	if err != nil {
+		return fmt.Errorf("call sf.substreams.rpc.v2.Stream/StoreKeyHistory: %w", err)
+	}
+	printKeyHistory(os.Stdout, history)
+	return nil
+}
+
+// printKeyHistory prints the mutations returned by the `StoreKeyHistory` call.
+func printKeyHistory(out io.Writer, history *pbsubstreamsrpc.StoreKeyHistoryResponse) {
+	if len(history.Mutations) == 0 {
+		fmt.Fprintln(out, "No changes of the key in the processed ranges.")
+	} else {
+		w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "BLOCK\tBLOCK ID\tORDINAL\tOPERATION\tOLD VALUE\tNEW VALUE")
+		for _, mutation := range history.Mutations {
+			delta := mutation.Delta
+			fmt.Fprintf(w, "%d\t%s\t%d\t%s\t%s\t%s\n", mutation.BlockNum, mutation.BlockId, delta.Ordinal, delta.Operation, storeValue(delta.OldValue), storeValue(delta.NewValue))
+		}
+		w.Flush()
+	}
+
+	if len(history.MissingRanges) != 0 {
+		fmt.Fprintf(out, "\nNot processed yet, changes unknown: %s\n", blockRanges(history.MissingRanges))
+	}
+}
+
+// storeValue renders a store value as a quoted string when it is printable
+// text, in hex otherwise.
+func storeValue(value []byte) string {
+	if len(value) == 0 {
+		return "-"
+	}
+	if utf8.Valid(value) {
+		printable := true
+		for _, r := range string(value) {
+			if !unicode.IsPrint(r) {
+				printable = false
+				break
+			}
+		}
+		if printable {
+			return strconv.Quote(string(value))
+		}
+	}
+	return "0x" + hex.EncodeToString(value)
+}
@@ -18,6 +18,7 @@ import (
 	"github.com/streamingfast/substreams/manifest"
 	pbrpcsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
 	ssconnect "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2/pbsubstreamsrpcconnect"
+	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
 	"github.com/streamingfast/substreams/tools"
 )
 
@@ -46,21 +47,24 @@ func (cs *ConnectServer) Blocks(
 		StartCursor:                         req.Msg.StartCursor,
 		FinalBlocksOnly:                     req.Msg.FinalBlocksOnly,
 		OutputModule:                        req.Msg.OutputModule,
+		OutputModules:                       req.Msg.OutputModules,
+		Params:                              req.Msg.Params,
+		Network:                             req.Msg.Network,
 		Modules:                             req.Msg.Modules,
 		DebugInitialStoreSnapshotForModules: req.Msg.DebugInitialStoreSnapshotForModules,
+		Capabilities:                        req.Msg.Capabilities,
+		AllowSunsetModules:                  req.Msg.AllowSunsetModules,
 	}
 
 	if cs.Manifest != "" {
-		manifestReader, err := manifest.NewReader(cs.Manifest)
+		pkg, err := cs.forcedPackage()
 		if err != nil {
-			return fmt.Errorf("manifest reader: %w", err)
-		}
-
-		pkg, err := manifestReader.Read()
-		if err != nil {
-			return fmt.Errorf("read manifest %q: %w", cs.Manifest, err)
+			return err
 		}
 		newReq.Modules = pkg.Modules
+		if pkg.Network != "" {
+			newReq.Network = pkg.Network
+		}
 	}
 
 	if cs.StartBlock != 0 {
@@ -96,6 +100,62 @@ func (cs *ConnectServer) Blocks(
 	}
 }
 
+func (cs *ConnectServer) StoreKeyHistory(
+	ctx context.Context,
+	req *connect.Request[pbrpcsubstreams.StoreKeyHistoryRequest],
+) (*connect.Response[pbrpcsubstreams.StoreKeyHistoryResponse], error) {
+	ssClient, connClose, callOpts, err := client.NewSubstreamsClient(cs.SubstreamsClientConfig)
+	if err != nil {
+		return nil, fmt.Errorf("substreams client setup: %w", err)
+	}
+	defer connClose()
+
+	if cs.Manifest != "" {
+		pkg, err := cs.forcedPackage()
+		if err != nil {
+			return nil, err
+		}
+		req.Msg.Modules = pkg.Modules
+	}
+
+	history, err := ssClient.StoreKeyHistory(ctx, req.Msg, callOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("call sf.substreams.rpc.v2.Stream/StoreKeyHistory: %w", err)
+	}
+	return connect.NewResponse(history), nil
+}
+
+func (cs *ConnectServer) ReloadModule(
+	ctx context.Context,
+	req *connect.Request[pbrpcsubstreams.ReloadModuleRequest],
+) (*connect.Response[pbrpcsubstreams.ReloadModuleResponse], error) {
+	ssClient, connClose, callOpts, err := client.NewSubstreamsClient(cs.SubstreamsClientConfig)
+	if err != nil {
+		return nil, fmt.Errorf("substreams client setup: %w", err)
+	}
+	defer connClose()
+
+	reloaded, err := ssClient.ReloadModule(ctx, req.Msg, callOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("call sf.substreams.rpc.v2.Stream/ReloadModule: %w", err)
+	}
+	return connect.NewResponse(reloaded), nil
+}
+
+// forcedModules reads the modules of the `--force-manifest` package.
+func (cs *ConnectServer) forcedPackage() (*pbsubstreams.Package, error) {
+	manifestReader, err := manifest.NewReader(cs.Manifest)
+	if err != nil {
+		return nil, fmt.Errorf("manifest reader: %w", err)
+	}
+
+	pkg, err := manifestReader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read manifest %q: %w", cs.Manifest, err)
+	}
+	return pkg, nil
+}
+
 func init() {
 	proxyCmd.Flags().StringP("substreams-endpoint", "e", "mainnet.eth.streamingfast.io:443", "Substreams gRPC endpoint")
 	proxyCmd.Flags().String("substreams-api-token-envvar", "SUBSTREAMS_API_TOKEN", "name of variable containing Substreams Authentication token")
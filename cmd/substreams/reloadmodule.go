@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/streamingfast/cli"
+	"github.com/streamingfast/substreams/client"
+	"github.com/streamingfast/substreams/manifest"
+	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
+	"github.com/streamingfast/substreams/tools"
+)
+
+func init() {
+	reloadModuleCmd.Flags().StringP("substreams-endpoint", "e", "mainnet.eth.streamingfast.io:443", "Substreams gRPC endpoint")
+	reloadModuleCmd.Flags().String("substreams-api-token-envvar", "SUBSTREAMS_API_TOKEN", "name of variable containing Substreams Authentication token")
+	reloadModuleCmd.Flags().String("request-id", "", "ID of the running request on the node serving it, printed when its session starts (required)")
+	reloadModuleCmd.Flags().Bool("insecure", false, "Skip certificate validation on GRPC connection")
+	reloadModuleCmd.Flags().Bool("plaintext", false, "Establish GRPC connection in plaintext")
+	reloadModuleCmd.Flags().StringSliceP("header", "H", nil, "Additional headers to be sent in the substreams request")
+	rootCmd.AddCommand(reloadModuleCmd)
+}
+
+var reloadModuleCmd = &cobra.Command{
+	Use:   "reload-module [<manifest>] <module_name>",
+	Short: "Replace the code of a module of a running development mode request",
+	Long: cli.Dedent(`
+		Replace the code of a module of a development mode request being streamed, identified by its request ID, with
+		the binary of the module in the manifest, rebuilt since. The request resumes from the last block it sent with
+		the new code: only the module and the modules depending on it are rebuilt, the others resume from their
+		snapshots. The endpoint must have enabled module reloads.
+	`),
+	RunE:         runReloadModule,
+	Args:         cobra.RangeArgs(1, 2),
+	SilenceUsage: true,
+}
+
+func runReloadModule(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+
+	var manifestPath string
+	if len(args) == 2 {
+		manifestPath, args = args[0], args[1:]
+	}
+	moduleName := args[0]
+
+	requestID := mustGetString(cmd, "request-id")
+	if requestID == "" {
+		return fmt.Errorf("the ID of the request is required, see --request-id")
+	}
+
+	manifestReader, err := manifest.NewReader(manifestPath)
+	if err != nil {
+		return fmt.Errorf("manifest reader: %w", err)
+	}
+
+	pkg, err := manifestReader.Read()
+	if err != nil {
+		return fmt.Errorf("read manifest %q: %w", manifestPath, err)
+	}
+
+	req := &pbsubstreamsrpc.ReloadModuleRequest{
+		RequestId: requestID,
+		Module:    moduleName,
+	}
+	for _, module := range pkg.Modules.Modules {
+		if module.Name == moduleName {
+			req.Binary = pkg.Modules.Binaries[module.BinaryIndex]
+		}
+	}
+	if req.Binary == nil {
+		return fmt.Errorf("module %q not found in manifest %q", moduleName, manifestPath)
+	}
+
+	substreamsClientConfig := client.NewSubstreamsClientConfig(
+		mustGetString(cmd, "substreams-endpoint"),
+		tools.ReadAPIToken(cmd, "substreams-api-token-envvar"),
+		mustGetBool(cmd, "insecure"),
+		mustGetBool(cmd, "plaintext"),
+	)
+
+	ssClient, connClose, callOpts, err := client.NewSubstreamsClient(substreamsClientConfig)
+	if err != nil {
+		return fmt.Errorf("substreams client setup: %w", err)
+	}
+	defer connClose()
+
+	resp, err := ssClient.ReloadModule(withHeaders(ctx, mustGetStringSlice(cmd, "header")), req, callOpts...)
+	if err != nil {
+		return fmt.Errorf("call sf.substreams.rpc.v2.Stream/ReloadModule: %w", err)
+	}
+
+	fmt.Printf("Module %q reloaded, hash %s\n", moduleName, resp.ModuleHash)
+	fmt.Printf("Rebuilding modules: %s\n", strings.Join(resp.InvalidatedModules, ", "))
+	if resp.ResumeBlock != 0 {
+		fmt.Printf("Request resuming from block #%d\n", resp.ResumeBlock)
+	} else {
+		fmt.Println("Request starting over, no block was sent yet")
+	}
+	return nil
+}
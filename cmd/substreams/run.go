@@ -3,13 +3,14 @@ package main
 import (
 	"context"
 	"fmt"
-	"google.golang.org/grpc/metadata"
 	"io"
+	"os"
 	"strconv"
 	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/streamingfast/cli"
+	"github.com/streamingfast/substreams"
 	"github.com/streamingfast/substreams/client"
 	"github.com/streamingfast/substreams/manifest"
 	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
@@ -26,16 +27,19 @@ func init() {
 	runCmd.Flags().StringP("cursor", "c", "", "Cursor to stream from. Leave blank for no cursor")
 	runCmd.Flags().StringP("stop-block", "t", "0", "Stop block to end stream at, exclusively. If the start-block is positive, a '+' prefix can indicate 'relative to start-block'")
 	runCmd.Flags().Bool("final-blocks-only", false, "Only process blocks that have pass finality, to prevent any reorg and undo signal by staying further away from the chain HEAD")
+	runCmd.Flags().Bool("allow-sunset-modules", false, "Run the modules past their deprecation sunset date instead of having the server refuse the request")
 	runCmd.Flags().Bool("insecure", false, "Skip certificate validation on GRPC connection")
 	runCmd.Flags().Bool("plaintext", false, "Establish GRPC connection in plaintext")
 	runCmd.Flags().StringP("output", "o", "", "Output mode. Defaults to 'ui' when in a TTY is present, and 'json' otherwise")
 	runCmd.Flags().StringSlice("debug-modules-initial-snapshot", nil, "List of 'store' modules from which to print the initial data snapshot (Unavailable in Production Mode)")
 	runCmd.Flags().StringSlice("debug-modules-output", nil, "List of modules from which to print outputs, deltas and logs (Unavailable in Production Mode)")
+	runCmd.Flags().StringSlice("store-deltas", nil, "List of 'store' modules from which to print the deltas of each block, in Production Mode too (the blocks are then executed from the start block)")
 	runCmd.Flags().StringSliceP("header", "H", nil, "Additional headers to be sent in the substreams request")
 	runCmd.Flags().Bool("production-mode", false, "Enable Production Mode, with high-speed parallel processing")
 	runCmd.Flags().StringArrayP("params", "p", nil, "Set a params for parameterizable modules. Can be specified multiple times. Ex: -p module1=valA -p module2=valX&valY")
 	runCmd.Flags().String("test-file", "", "runs a test file")
 	runCmd.Flags().Bool("test-verbose", false, "print out all the results")
+	runCmd.Flags().Bool("explain", false, "Print the backprocessing plan the server computes for this request (jobs, ranges, priorities, estimated duration) without executing it")
 	rootCmd.AddCommand(runCmd)
 }
 
@@ -148,15 +152,31 @@ func runRun(cmd *cobra.Command, args []string) error {
 		OutputModule:                        outputModule,
 		ProductionMode:                      productionMode,
 		DebugInitialStoreSnapshotForModules: debugModulesInitialSnapshot,
+		StoreDeltaModules:                   mustGetStringSlice(cmd, "store-deltas"),
+		Capabilities:                        substreams.SupportedCapabilities,
+		AllowSunsetModules:                  mustGetBool(cmd, "allow-sunset-modules"),
+		Network:                             pkg.Network,
 	}
 
 	if err := req.Validate(); err != nil {
 		return fmt.Errorf("validate request: %w", err)
 	}
+
+	if mustGetBool(cmd, "explain") {
+		explainCtx := withHeaders(ctx, mustGetStringSlice(cmd, "header"))
+		explanation, err := ssClient.Explain(explainCtx, req, callOpts...)
+		if err != nil {
+			return fmt.Errorf("call sf.substreams.rpc.v2.Stream/Explain: %w", err)
+		}
+		printExplanation(os.Stdout, explanation)
+		return nil
+	}
+
 	toPrint := debugModulesOutput
 	if toPrint == nil {
 		toPrint = []string{outputModule}
 	}
+	toPrint = append(toPrint, req.StoreDeltaModules...)
 
 	ui := tui.New(req, pkg, toPrint)
 	if err := ui.Init(outputMode); err != nil {
@@ -174,16 +194,7 @@ func runRun(cmd *cobra.Command, args []string) error {
 	})
 	defer cancel()
 
-	//parse additional-headers flag
-	additionalHeaders := mustGetStringSlice(cmd, "header")
-	if additionalHeaders != nil {
-		res := parseHeaders(additionalHeaders)
-		headerArray := make([]string, 0, len(res)*2)
-		for k, v := range res {
-			headerArray = append(headerArray, k, v)
-		}
-		streamCtx = metadata.AppendToOutgoingContext(streamCtx, headerArray...)
-	}
+	streamCtx = withHeaders(streamCtx, mustGetStringSlice(cmd, "header"))
 
 	ui.SetRequest(req)
 	ui.Connecting()
@@ -195,6 +206,13 @@ func runRun(cmd *cobra.Command, args []string) error {
 
 	for {
 		resp, err := cli.Recv()
+		if session := resp.GetSession(); session != nil {
+			// older endpoints don't check the network of the request
+			if err := manifest.ValidateNetwork(req.Network, session.GenesisBlockId); err != nil {
+				ui.Cancel()
+				return err
+			}
+		}
 		if resp != nil {
 			if err := ui.IncomingMessage(ctx, resp, testRunner); err != nil {
 				fmt.Printf("RETURN HANDLER ERROR: %s\n", err)
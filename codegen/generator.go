@@ -271,7 +271,7 @@ func (e *Engine) moduleOutputForName(moduleName string) (string, error) {
 
 func (e *Engine) FunctionSignature(module *manifest.Module) (*FunctionSignature, error) {
 	switch module.Kind {
-	case manifest.ModuleKindMap:
+	case manifest.ModuleKindMap, manifest.ModuleKindBlockIndex:
 		return e.mapFunctionSignature(module)
 	case manifest.ModuleKindStore:
 		return e.storeFunctionSignature(module)
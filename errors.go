@@ -0,0 +1,35 @@
+package substreams
+
+import (
+	"github.com/streamingfast/dgrpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
+)
+
+// NewStatusError returns a gRPC error of `code` whose message is the reason of
+// `details`, carried in the details of its status.
+func NewStatusError(code codes.Code, details *pbsubstreamsrpc.Error) error {
+	st := status.New(code, details.Reason)
+	if withDetails, err := st.WithDetails(details); err == nil {
+		st = withDetails
+	}
+	return st.Err()
+}
+
+// ErrorDetails returns the `Error` carried in the details of the first gRPC
+// status found in the chain of `err`, nil when there is none (ex: the server
+// predates the structured errors).
+func ErrorDetails(err error) *pbsubstreamsrpc.Error {
+	st := dgrpc.AsGRPCError(err)
+	if st == nil {
+		return nil
+	}
+	for _, detail := range st.Details() {
+		if out, ok := detail.(*pbsubstreamsrpc.Error); ok {
+			return out
+		}
+	}
+	return nil
+}
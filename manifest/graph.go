@@ -61,6 +61,14 @@ func NewModuleGraph(modules []*pbsubstreams.Module) (*ModuleGraph, error) {
 
 			g.inputOrderIndex[module.Name][moduleName] = j
 		}
+
+		// the block index filtering a module is executed before it, as an input
+		if filter := module.BlockFilter; filter != nil {
+			if j, found := g.moduleIndex[filter.Module]; found {
+				g.AddCost(i, j, 1)
+			}
+			g.inputOrderIndex[module.Name][filter.Module] = len(module.Inputs)
+		}
 	}
 
 	if !graph.Acyclic(g) {
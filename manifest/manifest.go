@@ -2,6 +2,7 @@ package manifest
 
 import (
 	"bytes"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"math"
@@ -9,10 +10,13 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 
+	"google.golang.org/protobuf/types/known/timestamppb"
 	"gopkg.in/yaml.v3"
 
 	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
+	"github.com/streamingfast/substreams/storage/store/marshaller"
 )
 
 const UNSET = math.MaxUint64
@@ -24,8 +28,14 @@ func init() {
 }
 
 const (
-	ModuleKindStore = "store"
-	ModuleKindMap   = "map"
+	ModuleKindStore      = "store"
+	ModuleKindMap        = "map"
+	ModuleKindBlockIndex = "blockIndex"
+)
+
+const (
+	ExecutionHintCPUHeavy = "cpu_heavy"
+	ExecutionHintIOBound  = "io_bound"
 )
 
 // Manifest is a YAML structure used to create a Package and its list
@@ -80,14 +90,81 @@ type Module struct {
 	Kind         string  `yaml:"kind"`
 	InitialBlock *uint64 `yaml:"initialBlock"`
 
-	UpdatePolicy string `yaml:"updatePolicy"`
-	ValueType    string `yaml:"valueType"`
-	Binary       string `yaml:"binary"`
+	// ExecutionHint is one of ExecutionHintCPUHeavy or ExecutionHintIOBound, or empty
+	ExecutionHint string `yaml:"executionHint"`
+
+	Deprecation         *Deprecation         `yaml:"deprecation"`
+	OutputCompatibility *OutputCompatibility `yaml:"outputCompatibility"`
+	BlockFilter         *BlockFilter         `yaml:"blockFilter"`
+
+	UpdatePolicy string     `yaml:"updatePolicy"`
+	ValueType    string     `yaml:"valueType"`
+	Immutable    bool       `yaml:"immutable"`
+	Codec        string     `yaml:"codec"`
+	TTLBlocks    uint64     `yaml:"ttlBlocks"`
+	Seed         *StoreSeed `yaml:"seed"`
+	Binary       string     `yaml:"binary"`
 
 	Inputs []*Input     `yaml:"inputs"`
 	Output StreamOutput `yaml:"output"`
 }
 
+// StoreSeed is the initial content of a store, read from `File` and shipped
+// in the package, or fetched by the servers from `URL`.
+type StoreSeed struct {
+	File   string `yaml:"file"`
+	URL    string `yaml:"url"`
+	SHA256 string `yaml:"sha256"`
+}
+
+// Deprecation warns the users of a module that it goes away. After `Sunset`,
+// a date (`2006-01-02`) or an RFC3339 time, the servers refuse to run it.
+type Deprecation struct {
+	Message     string `yaml:"message"`
+	Sunset      string `yaml:"sunset"`
+	Replacement string `yaml:"replacement"`
+}
+
+// OutputCompatibility declares that the outputs of a module are the same as
+// those of the module with hash `ModuleHash` before `UntilBlock`, see
+// `Module.output_compatibility`.
+type OutputCompatibility struct {
+	ModuleHash string `yaml:"moduleHash"`
+	UntilBlock uint64 `yaml:"untilBlock"`
+}
+
+// BlockFilter executes a module only on the blocks matched by the block index
+// module `Module`, see `Module.block_filter`.
+type BlockFilter struct {
+	Module string `yaml:"module"`
+}
+
+func (c *OutputCompatibility) validate() error {
+	if _, err := hex.DecodeString(c.ModuleHash); err != nil || c.ModuleHash == "" {
+		return fmt.Errorf("invalid 'moduleHash' %q, expected the hex-encoded hash of a module", c.ModuleHash)
+	}
+	if c.UntilBlock == 0 {
+		return errors.New("'untilBlock' is required")
+	}
+	return nil
+}
+
+// parseSunset returns the sunset time of the deprecation, the zero time when
+// it has none.
+func (d *Deprecation) parseSunset() (time.Time, error) {
+	if d.Sunset == "" {
+		return time.Time{}, nil
+	}
+	if sunset, err := time.Parse("2006-01-02", d.Sunset); err == nil {
+		return sunset, nil
+	}
+	sunset, err := time.Parse(time.RFC3339, d.Sunset)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid sunset %q, expected a date (2006-01-02) or an RFC3339 time", d.Sunset)
+	}
+	return sunset, nil
+}
+
 type Input struct {
 	Source string `yaml:"source"`
 	Store  string `yaml:"store"`
@@ -104,10 +181,14 @@ type Binary struct {
 	Content             []byte            `yaml:"-"`
 	Entrypoint          string            `yaml:"entrypoint"`
 	ProtoPackageMapping map[string]string `yaml:"protoPackageMapping"`
+
+	// Imports are the namespaces of the host functions imported by the binary
+	// which are not built in the runtimes, see validateBinaryImports.
+	Imports []string `yaml:"imports"`
 }
 
 type StreamOutput struct {
-	// For 'map'
+	// For 'map' and 'blockIndex'
 	Type string `yaml:"type"`
 }
 
@@ -228,6 +309,23 @@ func validateStoreBuilder(module *Module) error {
 		return fmt.Errorf("invalid 'output.updatePolicy' and 'output.valueType' combination, found %q use one of: %s", lastCombination, combinations)
 	}
 
+	if module.Immutable && module.UpdatePolicy != UpdatePolicySet && module.UpdatePolicy != UpdatePolicySetIfNotExists {
+		return fmt.Errorf("'immutable' is only valid with update policies %q and %q, found %q", UpdatePolicySet, UpdatePolicySetIfNotExists, module.UpdatePolicy)
+	}
+
+	if _, err := marshaller.ForCodec(module.Codec); err != nil {
+		return fmt.Errorf("invalid 'codec': %w", err)
+	}
+
+	if seed := module.Seed; seed != nil {
+		if (seed.File == "") == (seed.URL == "") {
+			return errors.New("'seed' expects one, and only one of: 'file' or 'url'")
+		}
+		if seed.URL != "" && seed.SHA256 == "" {
+			return errors.New("'seed.sha256' is required with 'seed.url'")
+		}
+	}
+
 	return nil
 }
 
@@ -247,6 +345,38 @@ func (m *Module) ToProtoWASM(codeIndex uint32) (*pbsubstreams.Module, error) {
 		out.InitialBlock = *m.InitialBlock
 	}
 
+	switch m.ExecutionHint {
+	case ExecutionHintCPUHeavy:
+		out.ExecutionHint = pbsubstreams.Module_EXECUTION_HINT_CPU_HEAVY
+	case ExecutionHintIOBound:
+		out.ExecutionHint = pbsubstreams.Module_EXECUTION_HINT_IO_BOUND
+	}
+
+	if d := m.Deprecation; d != nil {
+		sunset, err := d.parseSunset()
+		if err != nil {
+			return nil, fmt.Errorf("module %q: deprecation: %w", m.Name, err)
+		}
+		out.Deprecation = &pbsubstreams.Module_Deprecation{
+			Message:     d.Message,
+			Replacement: d.Replacement,
+		}
+		if !sunset.IsZero() {
+			out.Deprecation.Sunset = timestamppb.New(sunset)
+		}
+	}
+
+	if c := m.OutputCompatibility; c != nil {
+		out.OutputCompatibility = &pbsubstreams.Module_OutputCompatibility{
+			ModuleHash: strings.ToLower(c.ModuleHash),
+			UntilBlock: c.UntilBlock,
+		}
+	}
+
+	if f := m.BlockFilter; f != nil {
+		out.BlockFilter = &pbsubstreams.Module_BlockFilter{Module: f.Module}
+	}
+
 	m.setOutputToProto(out)
 	m.setKindToProto(out)
 	err := m.setInputsToProto(out)
@@ -356,6 +486,12 @@ func (m *Module) setKindToProto(pbModule *pbsubstreams.Module) {
 				OutputType: m.Output.Type,
 			},
 		}
+	case ModuleKindBlockIndex:
+		pbModule.Kind = &pbsubstreams.Module_KindBlockIndex_{
+			KindBlockIndex: &pbsubstreams.Module_KindBlockIndex{
+				OutputType: m.Output.Type,
+			},
+		}
 	case ModuleKindStore:
 		var updatePolicy pbsubstreams.Module_KindStore_UpdatePolicy
 		switch m.UpdatePolicy {
@@ -378,11 +514,28 @@ func (m *Module) setKindToProto(pbModule *pbsubstreams.Module) {
 			KindStore: &pbsubstreams.Module_KindStore{
 				UpdatePolicy: updatePolicy,
 				ValueType:    m.ValueType,
+				Immutable:    m.Immutable,
+				Codec:        m.Codec,
+				TtlBlocks:    m.TTLBlocks,
+				Seed:         m.Seed.toProto(),
 			},
 		}
 	}
 }
 
+// toProto returns the seed without its content, read from `File` when
+// building the package.
+func (s *StoreSeed) toProto() *pbsubstreams.Module_KindStore_StoreSeed {
+	if s == nil {
+		return nil
+	}
+	out := &pbsubstreams.Module_KindStore_StoreSeed{Sha256: s.SHA256}
+	if s.URL != "" {
+		out.Source = &pbsubstreams.Module_KindStore_StoreSeed_Url{Url: s.URL}
+	}
+	return out
+}
+
 func (m *Module) setOutputToProto(pbModule *pbsubstreams.Module) {
 	if m.Output.Type != "" {
 		pbModule.Output = &pbsubstreams.Module_Output{
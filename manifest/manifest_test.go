@@ -3,6 +3,7 @@ package manifest
 import (
 	"strings"
 	"testing"
+	"time"
 
 	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
 	"github.com/stretchr/testify/assert"
@@ -159,3 +160,112 @@ func TestManifest_ToProto(t *testing.T) {
 //func (x *testSinkConfig) String() string                     { return "testSinkConfig" }
 //func (*testSinkConfig) ProtoMessage()                        {}
 //func (x *testSinkConfig) ProtoReflect() protoreflect.Message { panic("unimplemented") }
+
+func TestModule_ToProtoWASM_ExecutionHint(t *testing.T) {
+	tests := []struct {
+		hint   string
+		expect pbsubstreams.Module_ExecutionHint
+	}{
+		{"", pbsubstreams.Module_EXECUTION_HINT_UNSET},
+		{ExecutionHintCPUHeavy, pbsubstreams.Module_EXECUTION_HINT_CPU_HEAVY},
+		{ExecutionHintIOBound, pbsubstreams.Module_EXECUTION_HINT_IO_BOUND},
+	}
+	for _, test := range tests {
+		t.Run(test.hint, func(t *testing.T) {
+			module := &Module{Name: "map_a", Kind: ModuleKindMap, ExecutionHint: test.hint, Output: StreamOutput{Type: "proto:a.A"}}
+			out, err := module.ToProtoWASM(0)
+			require.NoError(t, err)
+			assert.Equal(t, test.expect, out.ExecutionHint)
+		})
+	}
+}
+
+func TestModule_ToProtoWASM_Deprecation(t *testing.T) {
+	module := &Module{Name: "map_a", Kind: ModuleKindMap, Output: StreamOutput{Type: "proto:a.A"}, Deprecation: &Deprecation{
+		Message:     "moved to the v2 package",
+		Sunset:      "2025-01-31",
+		Replacement: "map_b",
+	}}
+	out, err := module.ToProtoWASM(0)
+	require.NoError(t, err)
+	assert.Equal(t, "moved to the v2 package", out.Deprecation.Message)
+	assert.Equal(t, "map_b", out.Deprecation.Replacement)
+	assert.Equal(t, time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC), out.Deprecation.Sunset.AsTime())
+
+	module.Deprecation.Sunset = "2025-01-31T12:00:00+02:00"
+	out, err = module.ToProtoWASM(0)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2025, 1, 31, 10, 0, 0, 0, time.UTC), out.Deprecation.Sunset.AsTime())
+
+	module.Deprecation.Sunset = ""
+	out, err = module.ToProtoWASM(0)
+	require.NoError(t, err)
+	assert.Nil(t, out.Deprecation.Sunset)
+
+	module.Deprecation.Sunset = "next year"
+	_, err = module.ToProtoWASM(0)
+	assert.Error(t, err)
+}
+
+func TestModule_ToProtoWASM_OutputCompatibility(t *testing.T) {
+	module := &Module{Name: "map_a", Kind: ModuleKindMap, Output: StreamOutput{Type: "proto:a.A"}, OutputCompatibility: &OutputCompatibility{
+		ModuleHash: "ABCDEF12",
+		UntilBlock: 17_000_000,
+	}}
+	require.NoError(t, module.OutputCompatibility.validate())
+
+	out, err := module.ToProtoWASM(0)
+	require.NoError(t, err)
+	assert.Equal(t, "abcdef12", out.OutputCompatibility.ModuleHash)
+	assert.Equal(t, uint64(17_000_000), out.OutputCompatibility.UntilBlock)
+
+	assert.Error(t, (&OutputCompatibility{ModuleHash: "map_old", UntilBlock: 10}).validate())
+	assert.Error(t, (&OutputCompatibility{ModuleHash: "abcdef12"}).validate())
+}
+
+func TestModule_ToProtoWASM_BlockFilter(t *testing.T) {
+	index := &Module{Name: "index_a", Kind: ModuleKindBlockIndex, Output: StreamOutput{Type: "proto:a.Keys"}}
+	mapper := &Module{Name: "map_a", Kind: ModuleKindMap, Output: StreamOutput{Type: "proto:a.A"}, BlockFilter: &BlockFilter{Module: "index_a"}}
+
+	indexOut, err := index.ToProtoWASM(0)
+	require.NoError(t, err)
+	assert.Equal(t, "proto:a.Keys", indexOut.GetKindBlockIndex().OutputType)
+
+	mapperOut, err := mapper.ToProtoWASM(0)
+	require.NoError(t, err)
+	assert.Equal(t, "index_a", mapperOut.BlockFilter.Module)
+
+	assert.NoError(t, ValidateModules(&pbsubstreams.Modules{Modules: []*pbsubstreams.Module{indexOut, mapperOut}}))
+
+	mapperOut.BlockFilter.Module = "map_a"
+	assert.ErrorContains(t, ValidateModules(&pbsubstreams.Modules{Modules: []*pbsubstreams.Module{indexOut, mapperOut}}), "not of 'blockIndex' kind")
+
+	indexOut.BlockFilter = &pbsubstreams.Module_BlockFilter{Module: "index_a"}
+	mapperOut.BlockFilter = nil
+	assert.ErrorContains(t, ValidateModules(&pbsubstreams.Modules{Modules: []*pbsubstreams.Module{indexOut, mapperOut}}), "cannot be filtered")
+}
+
+func TestValidateStoreBuilder_Seed(t *testing.T) {
+	tests := []struct {
+		name      string
+		seed      *StoreSeed
+		expectErr string
+	}{
+		{"file", &StoreSeed{File: "seed.jsonl"}, ""},
+		{"url", &StoreSeed{URL: "gs://bucket/seed.jsonl", SHA256: "ab"}, ""},
+		{"none", &StoreSeed{}, "'seed' expects one, and only one of: 'file' or 'url'"},
+		{"both", &StoreSeed{File: "seed.jsonl", URL: "gs://bucket/seed.jsonl"}, "'seed' expects one, and only one of: 'file' or 'url'"},
+		{"url without sha256", &StoreSeed{URL: "gs://bucket/seed.jsonl"}, "'seed.sha256' is required with 'seed.url'"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			module := &Module{Name: "store_a", Kind: ModuleKindStore, UpdatePolicy: UpdatePolicySet, ValueType: "string", Seed: test.seed}
+			err := validateStoreBuilder(module)
+			if test.expectErr != "" {
+				assert.EqualError(t, err, test.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
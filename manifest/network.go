@@ -0,0 +1,44 @@
+package manifest
+
+import (
+	"fmt"
+	"strings"
+)
+
+// networkGenesis holds the ID of the genesis block of the chains known by
+// their chain-qualified network name. Plain names (ex: `mainnet`) are used by
+// the packages of every chain family for their own chain, they are not known.
+var networkGenesis = map[string]string{
+	"eth-mainnet": "d4e56740f876aef8c010b86a40d5f56745a118d0906a34e69aec8c0db1cb8fa3",
+	"eth-goerli":  "bf7e331f7f7c1dd2e05159666b3bf8bc7a8a3a9eb1d518969eab529dd9b88c1a",
+	"eth-sepolia": "25a5cc106eea7138acab33231d7160d69cb777ee0c2c553fcddf5138993e6dd9",
+}
+
+// NetworkGenesisBlockID returns the ID of the genesis block of the chain
+// `network`, false if the network is unknown.
+func NetworkGenesisBlockID(network string) (string, bool) {
+	id, found := networkGenesis[strings.ToLower(network)]
+	return id, found
+}
+
+// ValidateNetwork checks that the network a package is written for, usually
+// its `network`, is the chain whose genesis block is `genesisBlockID`, read
+// from the blocks served by the endpoint. Networks are compared by the ID of
+// their genesis block, not by name: the check passes when the network of the
+// package is unknown (older packages don't have one, and only the networks
+// listed in networkGenesis are known) or when the genesis block of the
+// endpoint is (older endpoints don't send it).
+func ValidateNetwork(packageNetwork, genesisBlockID string) error {
+	expected, found := NetworkGenesisBlockID(packageNetwork)
+	if !found || genesisBlockID == "" {
+		return nil
+	}
+	if normalizeBlockID(expected) != normalizeBlockID(genesisBlockID) {
+		return fmt.Errorf("package network %q has genesis block %s but this endpoint serves the chain whose genesis block is %s, its modules would decode the blocks of another chain", packageNetwork, expected, genesisBlockID)
+	}
+	return nil
+}
+
+func normalizeBlockID(id string) string {
+	return strings.TrimPrefix(strings.ToLower(id), "0x")
+}
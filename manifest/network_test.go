@@ -0,0 +1,18 @@
+package manifest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateNetwork(t *testing.T) {
+	mainnet := "d4e56740f876aef8c010b86a40d5f56745a118d0906a34e69aec8c0db1cb8fa3"
+	assert.NoError(t, ValidateNetwork("eth-mainnet", mainnet))
+	assert.NoError(t, ValidateNetwork("ETH-Mainnet", "0x"+mainnet))
+	assert.NoError(t, ValidateNetwork("mainnet", "0x0d21840abff46b96c84b2ac9e10e4f5cdaeb5693cb665db62a2f3b02d2d57b5b"), "plain names are used by every chain family")
+	assert.NoError(t, ValidateNetwork("", mainnet), "package without network")
+	assert.NoError(t, ValidateNetwork("my-devnet", mainnet), "unknown network")
+	assert.NoError(t, ValidateNetwork("eth-mainnet", ""), "endpoint without genesis block")
+	assert.ErrorContains(t, ValidateNetwork("eth-sepolia", mainnet), `package network "eth-sepolia" has genesis block 25a5cc106eea7138acab33231d7160d69cb777ee0c2c553fcddf5138993e6dd9 but this endpoint serves the chain whose genesis block is `+mainnet)
+}
@@ -2,6 +2,7 @@ package manifest
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/schollz/closestmatch"
@@ -38,3 +39,32 @@ func ApplyParams(paramsString []string, pkg *pbsubstreams.Package) error {
 	}
 	return nil
 }
+
+// ApplyModuleParams sets the value of the `params` input of the modules named
+// in `params`, the overrides of a request. The modules must declare a
+// `params` input.
+func ApplyModuleParams(modules *pbsubstreams.Modules, params map[string]string) error {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		var module *pbsubstreams.Module
+		for _, mod := range modules.Modules {
+			if mod.Name == name {
+				module = mod
+				break
+			}
+		}
+		if module == nil {
+			return fmt.Errorf("param for module %q: module not found", name)
+		}
+		if len(module.Inputs) == 0 || module.Inputs[0].GetParams() == nil {
+			return fmt.Errorf("param for module %q: the module does not declare a 'params' input", name)
+		}
+		module.Inputs[0].GetParams().Value = params[name]
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package manifest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
+)
+
+func TestApplyModuleParams(t *testing.T) {
+	newModules := func() *pbsubstreams.Modules {
+		return &pbsubstreams.Modules{
+			Binaries: []*pbsubstreams.Binary{{Type: "wasm/rust-v1"}},
+			Modules: []*pbsubstreams.Module{
+				{
+					Name:   "map_a",
+					Kind:   &pbsubstreams.Module_KindMap_{KindMap: &pbsubstreams.Module_KindMap{}},
+					Inputs: []*pbsubstreams.Module_Input{{Input: &pbsubstreams.Module_Input_Params_{Params: &pbsubstreams.Module_Input_Params{Value: "default"}}}},
+				},
+				{
+					Name:   "map_b",
+					Kind:   &pbsubstreams.Module_KindMap_{KindMap: &pbsubstreams.Module_KindMap{}},
+					Inputs: []*pbsubstreams.Module_Input{{Input: &pbsubstreams.Module_Input_Source_{Source: &pbsubstreams.Module_Input_Source{Type: "sf.substreams.v1.Clock"}}}},
+				},
+			},
+		}
+	}
+
+	modules := newModules()
+	require.NoError(t, ApplyModuleParams(modules, map[string]string{"map_a": "0xabc"}))
+	assert.Equal(t, "0xabc", modules.Modules[0].Inputs[0].GetParams().Value)
+
+	graph, err := NewModuleGraph(modules.Modules)
+	require.NoError(t, err)
+	hash, err := NewModuleHashes().HashModule(modules, modules.Modules[0], graph)
+	require.NoError(t, err)
+	defaults := newModules()
+	defaultHash, err := NewModuleHashes().HashModule(defaults, defaults.Modules[0], graph)
+	require.NoError(t, err)
+	assert.NotEqual(t, defaultHash, hash, "the params are part of the module hash")
+
+	assert.EqualError(t, ApplyModuleParams(newModules(), map[string]string{"map_c": "0xabc"}), `param for module "map_c": module not found`)
+	assert.EqualError(t, ApplyModuleParams(newModules(), map[string]string{"map_b": "0xabc"}), `param for module "map_b": the module does not declare a 'params' input`)
+}
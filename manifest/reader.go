@@ -2,6 +2,8 @@ package manifest
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -18,6 +20,7 @@ import (
 	"github.com/jhump/protoreflect/dynamic"
 	"github.com/streamingfast/dstore"
 	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
+	"github.com/streamingfast/substreams/wasm/wasmimports"
 	"go.uber.org/zap"
 	"golang.org/x/mod/semver"
 	"google.golang.org/protobuf/proto"
@@ -376,6 +379,13 @@ func (r *Reader) validatePackage(pkg *pbsubstreams.Package) error {
 					return fmt.Errorf("module %q incorrect outputTyupe %q valueType must be a proto Message", mod.Name, outputType)
 				}
 			}
+		case *pbsubstreams.Module_KindBlockIndex_:
+			outputType := i.KindBlockIndex.OutputType
+			if !r.skipModuleOutputTypeValidation {
+				if !strings.HasPrefix(outputType, "proto:") {
+					return fmt.Errorf("module %q: incorrect outputType %q, must be a proto Message", mod.Name, outputType)
+				}
+			}
 		case *pbsubstreams.Module_KindStore_:
 			valueType := i.KindStore.ValueType
 			if !r.skipModuleOutputTypeValidation {
@@ -448,6 +458,14 @@ func ValidateModules(mods *pbsubstreams.Modules) error {
 	if sumCode > 100_000_000 {
 		return fmt.Errorf("limit of 100MB of module code size reached")
 	}
+
+	var sumSeeds int
+	for _, mod := range mods.Modules {
+		sumSeeds += len(mod.GetKindStore().GetSeed().GetContent())
+	}
+	if sumSeeds > 100_000_000 {
+		return fmt.Errorf("limit of 100MB of store seeds size reached")
+	}
 	if len(mods.Modules) > 100 {
 		return fmt.Errorf("limit of 100 modules reached")
 	}
@@ -463,6 +481,12 @@ func ValidateModules(mods *pbsubstreams.Modules) error {
 			return fmt.Errorf("limit of 30 inputs for a given module (%q) reached", mod.Name)
 		}
 
+		if seed := mod.GetKindStore().GetSeed(); seed != nil {
+			if err := validateSeed(seed); err != nil {
+				return fmt.Errorf("module %q: seed: %w", mod.Name, err)
+			}
+		}
+
 		for idx, in := range mod.Inputs {
 			switch i := in.Input.(type) {
 			case *pbsubstreams.Module_Input_Params_:
@@ -479,7 +503,9 @@ func ValidateModules(mods *pbsubstreams.Modules) error {
 				for _, mod2 := range mods.Modules {
 					if mod2.Name == seekMod {
 						found = true
-						if _, ok := mod2.Kind.(*pbsubstreams.Module_KindMap_); !ok {
+						switch mod2.Kind.(type) {
+						case *pbsubstreams.Module_KindMap_, *pbsubstreams.Module_KindBlockIndex_:
+						default:
 							return fmt.Errorf("module %q: input %d: referenced module %q not of 'map' kind", mod.Name, idx, seekMod)
 						}
 					}
@@ -509,11 +535,49 @@ func ValidateModules(mods *pbsubstreams.Modules) error {
 				}
 			}
 		}
+
+		if filter := mod.BlockFilter; filter != nil {
+			if err := validateBlockFilter(mods, mod, filter); err != nil {
+				return fmt.Errorf("module %q: block filter: %w", mod.Name, err)
+			}
+		}
 	}
 
 	return nil
 }
 
+// validateBlockFilter checks that `filter` references a block index module,
+// which is not filtered itself.
+func validateBlockFilter(mods *pbsubstreams.Modules, mod *pbsubstreams.Module, filter *pbsubstreams.Module_BlockFilter) error {
+	if mod.GetKindBlockIndex() != nil {
+		return fmt.Errorf("a 'blockIndex' module cannot be filtered")
+	}
+	for _, mod2 := range mods.Modules {
+		if mod2.Name == filter.Module {
+			if mod2.GetKindBlockIndex() == nil {
+				return fmt.Errorf("referenced module %q not of 'blockIndex' kind", filter.Module)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("module %q not found", filter.Module)
+}
+
+func validateSeed(seed *pbsubstreams.Module_KindStore_StoreSeed) error {
+	if seed.Source == nil {
+		return fmt.Errorf("missing content or url")
+	}
+	if seed.Sha256 != "" {
+		if sum, err := hex.DecodeString(seed.Sha256); err != nil || len(sum) != sha256.Size {
+			return fmt.Errorf("invalid sha256 %q, expecting a hex-encoded SHA-256 hash", seed.Sha256)
+		}
+	}
+	if seed.GetUrl() != "" && seed.Sha256 == "" {
+		return fmt.Errorf("sha256 is required with url")
+	}
+	return nil
+}
+
 func LoadManifestFile(inputPath string) (*Manifest, error) {
 	m, err := decodeYamlManifestFromFile(inputPath)
 	if err != nil {
@@ -552,6 +616,10 @@ func LoadManifestFile(inputPath string) (*Manifest, error) {
 			if s.Output.Type == "" {
 				return nil, fmt.Errorf("stream %q: missing 'output.type' for kind 'map'", s.Name)
 			}
+		case ModuleKindBlockIndex:
+			if s.Output.Type == "" {
+				return nil, fmt.Errorf("stream %q: missing 'output.type' for kind 'blockIndex'", s.Name)
+			}
 		case ModuleKindStore:
 			if err := validateStoreBuilder(s); err != nil {
 				return nil, fmt.Errorf("stream %q: %w", s.Name, err)
@@ -560,6 +628,24 @@ func LoadManifestFile(inputPath string) (*Manifest, error) {
 		default:
 			return nil, fmt.Errorf("stream %q: invalid kind %q", s.Name, s.Kind)
 		}
+		switch s.ExecutionHint {
+		case "", ExecutionHintCPUHeavy, ExecutionHintIOBound:
+		default:
+			return nil, fmt.Errorf("module %q: invalid executionHint %q, must be %q or %q", s.Name, s.ExecutionHint, ExecutionHintCPUHeavy, ExecutionHintIOBound)
+		}
+		if s.Deprecation != nil {
+			if _, err := s.Deprecation.parseSunset(); err != nil {
+				return nil, fmt.Errorf("module %q: deprecation: %w", s.Name, err)
+			}
+		}
+		if s.OutputCompatibility != nil {
+			if err := s.OutputCompatibility.validate(); err != nil {
+				return nil, fmt.Errorf("module %q: outputCompatibility: %w", s.Name, err)
+			}
+		}
+		if s.BlockFilter != nil && s.BlockFilter.Module == "" {
+			return nil, fmt.Errorf("module %q: blockFilter: 'module' is required", s.Name)
+		}
 		for idx, input := range s.Inputs {
 			if err := input.parse(); err != nil {
 				return nil, fmt.Errorf("module %q: invalid input [%d]: %w", s.Name, idx, err)
@@ -723,8 +809,11 @@ func (r *Reader) convertToPkg(m *Manifest) (pkg *pbsubstreams.Package, err error
 					if err != nil {
 						return nil, fmt.Errorf("failed to read source code %q: %w", codePath, err)
 					}
+					if err := validateBinaryImports(byteCode, binaryDef.Imports); err != nil {
+						return nil, fmt.Errorf("binary %q: %w", binaryName, err)
+					}
 				}
-				pkg.Modules.Binaries = append(pkg.Modules.Binaries, &pbsubstreams.Binary{Type: binaryDef.Type, Content: byteCode})
+				pkg.Modules.Binaries = append(pkg.Modules.Binaries, &pbsubstreams.Binary{Type: binaryDef.Type, Content: byteCode, Imports: binaryDef.Imports})
 				codeIndex = len(pkg.Modules.Binaries) - 1
 				moduleCodeIndexes[binaryDef.File] = codeIndex
 			}
@@ -736,6 +825,15 @@ func (r *Reader) convertToPkg(m *Manifest) (pkg *pbsubstreams.Package, err error
 			return nil, err
 		}
 
+		if mod.Seed != nil && mod.Seed.File != "" {
+			seedPath := m.resolvePath(mod.Seed.File)
+			content, err := os.ReadFile(seedPath)
+			if err != nil {
+				return nil, fmt.Errorf("module %q: failed to read seed %q: %w", mod.Name, seedPath, err)
+			}
+			pbmod.GetKindStore().Seed.Source = &pbsubstreams.Module_KindStore_StoreSeed_Content{Content: content}
+		}
+
 		pkg.ModuleMeta = append(pkg.ModuleMeta, pbmeta)
 		pkg.Modules.Modules = append(pkg.Modules.Modules, pbmod)
 	}
@@ -763,6 +861,39 @@ func (r *Reader) convertToPkg(m *Manifest) (pkg *pbsubstreams.Package, err error
 	return
 }
 
+// validateBinaryImports checks that `declared` are exactly the namespaces of
+// the host functions imported by the WASM module `code` which are not built in
+// the runtimes, so that the servers can reject the requests importing host
+// functions they don't provide before running them. The binaries which cannot
+// be read are left to the runtime to reject.
+func validateBinaryImports(code []byte, declared []string) error {
+	imports, err := wasmimports.FunctionImports(code)
+	if err != nil {
+		return nil
+	}
+	imported := wasmimports.Namespaces(imports)
+
+	isDeclared := make(map[string]bool, len(declared))
+	for _, namespace := range declared {
+		if wasmimports.IsBuiltin(namespace) {
+			return fmt.Errorf("'imports': host functions %q are built in, they must not be declared", namespace)
+		}
+		isDeclared[namespace] = true
+	}
+	for _, namespace := range imported {
+		if !isDeclared[namespace] {
+			return fmt.Errorf("imports host functions %q, not declared in 'imports'", namespace)
+		}
+		delete(isDeclared, namespace)
+	}
+	for _, namespace := range declared {
+		if isDeclared[namespace] {
+			return fmt.Errorf("'imports': host functions %q are not imported by the binary", namespace)
+		}
+	}
+	return nil
+}
+
 var storeValidTypes = map[string]bool{
 	"bigint":     true,
 	"int64":      true,
@@ -378,3 +378,40 @@ func readSystemProtoDescriptors(t *testing.T) (out []*descriptorpb.FileDescripto
 
 	return systemProtoFiles.File
 }
+
+// cryptoImportingModule imports the functions `env::output` and
+// `crypto::keccak256`.
+var cryptoImportingModule = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00,
+	// types: (i32, i32) -> ()
+	0x01, 0x06, 0x01, 0x60, 0x02, 0x7f, 0x7f, 0x00,
+	// imports
+	0x02, 0x21, 0x02,
+	0x03, 'e', 'n', 'v', 0x06, 'o', 'u', 't', 'p', 'u', 't', 0x00, 0x00,
+	0x06, 'c', 'r', 'y', 'p', 't', 'o', 0x09, 'k', 'e', 'c', 'c', 'a', 'k', '2', '5', '6', 0x00, 0x00,
+}
+
+func TestValidateBinaryImports(t *testing.T) {
+	tests := []struct {
+		name      string
+		declared  []string
+		expectErr string
+	}{
+		{"declared", []string{"crypto"}, ""},
+		{"undeclared", nil, `imports host functions "crypto", not declared in 'imports'`},
+		{"not imported", []string{"crypto", "bigdecimal"}, `'imports': host functions "bigdecimal" are not imported by the binary`},
+		{"built in", []string{"crypto", "env"}, `'imports': host functions "env" are built in, they must not be declared`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateBinaryImports(cryptoImportingModule, test.declared)
+			if test.expectErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.EqualError(t, err, test.expectErr)
+			}
+		})
+	}
+
+	require.NoError(t, validateBinaryImports([]byte("not wasm"), []string{"crypto"}))
+}
@@ -3,9 +3,11 @@ package manifest
 import (
 	"bytes"
 	"crypto/sha1"
+	"crypto/sha256"
 	"encoding/binary"
 	"encoding/hex"
 	"fmt"
+	"strings"
 	"sync"
 
 	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
@@ -64,8 +66,20 @@ func (m *ModuleHashes) HashModule(modules *pbsubstreams.Modules, module *pbsubst
 	switch module.Kind.(type) {
 	case *pbsubstreams.Module_KindMap_:
 		buf.WriteString("map")
+	case *pbsubstreams.Module_KindBlockIndex_:
+		buf.WriteString("block_index")
 	case *pbsubstreams.Module_KindStore_:
 		buf.WriteString("store")
+		if module.GetKindStore().Immutable {
+			buf.WriteString("immutable")
+		}
+		if ttlBlocks := module.GetKindStore().TtlBlocks; ttlBlocks != 0 {
+			buf.WriteString(fmt.Sprintf("ttl_blocks%d", ttlBlocks))
+		}
+		if seed := module.GetKindStore().Seed; seed != nil {
+			buf.WriteString("seed")
+			buf.WriteString(seedHash(seed))
+		}
 	default:
 		return nil, fmt.Errorf("invalid module file %T", module.Kind)
 	}
@@ -89,6 +103,19 @@ func (m *ModuleHashes) HashModule(modules *pbsubstreams.Modules, module *pbsubst
 		buf.WriteString(value)
 	}
 
+	if filter := module.BlockFilter; filter != nil {
+		buf.WriteString("block_filter")
+		buf.WriteString(filter.Module)
+	}
+
+	if c := module.OutputCompatibility; c != nil && c.ModuleHash != "" && c.UntilBlock != 0 {
+		// the caches of a module reusing those of another one must not be
+		// shared with the same module declaring no or another compatibility
+		buf.WriteString("output_compatibility")
+		buf.WriteString(c.ModuleHash)
+		buf.WriteString(fmt.Sprintf("until_block%d", c.UntilBlock))
+	}
+
 	buf.WriteString("ancestors")
 	ancestors, _ := graph.AncestorsOf(module.Name)
 	for _, ancestor := range ancestors {
@@ -141,3 +168,13 @@ func inputValue(input *pbsubstreams.Module_Input) (string, error) {
 		return "", fmt.Errorf("invalid input %T", input.Input)
 	}
 }
+
+// seedHash is the hex-encoded SHA-256 hash of the seed file, computed from
+// its content when not declared.
+func seedHash(seed *pbsubstreams.Module_KindStore_StoreSeed) string {
+	if seed.Sha256 != "" {
+		return strings.ToLower(seed.Sha256)
+	}
+	sum := sha256.Sum256(seed.GetContent())
+	return hex.EncodeToString(sum[:])
+}
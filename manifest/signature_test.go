@@ -6,6 +6,8 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
 )
 
 func Test_HashModule(t *testing.T) {
@@ -114,3 +116,26 @@ func Test_HashModule(t *testing.T) {
 		})
 	}
 }
+
+func Test_HashModule_OutputCompatibility(t *testing.T) {
+	hash := func(compatibility *pbsubstreams.Module_OutputCompatibility) string {
+		module := &pbsubstreams.Module{
+			Name:                "map_a",
+			Kind:                &pbsubstreams.Module_KindMap_{KindMap: &pbsubstreams.Module_KindMap{}},
+			Inputs:              []*pbsubstreams.Module_Input{{Input: &pbsubstreams.Module_Input_Source_{Source: &pbsubstreams.Module_Input_Source{Type: "sf.substreams.v1.Clock"}}}},
+			OutputCompatibility: compatibility,
+		}
+		modules := &pbsubstreams.Modules{Modules: []*pbsubstreams.Module{module}, Binaries: []*pbsubstreams.Binary{{Type: "wasm/rust-v1"}}}
+		graph, err := NewModuleGraph(modules.Modules)
+		require.NoError(t, err)
+		out, err := NewModuleHashes().HashModule(modules, module, graph)
+		require.NoError(t, err)
+		return hex.EncodeToString(out)
+	}
+
+	none := hash(nil)
+	compatible := hash(&pbsubstreams.Module_OutputCompatibility{ModuleHash: "abcdef12", UntilBlock: 10})
+	assert.NotEqual(t, none, compatible)
+	assert.NotEqual(t, compatible, hash(&pbsubstreams.Module_OutputCompatibility{ModuleHash: "abcdef12", UntilBlock: 20}))
+	assert.Equal(t, compatible, hash(&pbsubstreams.Module_OutputCompatibility{ModuleHash: "abcdef12", UntilBlock: 10}))
+}
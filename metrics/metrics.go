@@ -16,6 +16,65 @@ var SquashesLaunched = MetricSet.NewCounter("substreams_total_squashes_launched"
 var SquashersStarted = MetricSet.NewCounter("substreams_total_squash_processes_launched", "Counter for Total squash processes launched, used for rate")
 var SquashersEnded = MetricSet.NewCounter("substreams_total_squash_processes_closed", "Counter for Total squash processes closed, used for active processes")
 
+var BlockCacheRequests = MetricSet.NewCounterVec("substreams_tier2_block_cache_requests", []string{"result"}, "Counter for merged blocks files requested through the tier2 block cache, by result (memory_hit, disk_hit, coalesced, miss), used for hit rates")
+
+var WASMModulePoolRequests = MetricSet.NewCounterVec("substreams_tier2_wasm_module_pool_requests", []string{"result"}, "Counter for WASM modules requested through the tier2 module pool, by result (hit, miss), used for hit rates")
+
+var NonDeterministicExecutions = MetricSet.NewCounter("substreams_tier2_non_deterministic_executions", "Counter for module executions whose replay produced a different output, all modules included, the modules being logged, see the determinism audit of tier2")
+
+var ExecOutBlobWrites = MetricSet.NewCounterVec("substreams_execout_blob_writes", []string{"result"}, "Counter for execution output segments written content-addressed, by result (written, deduplicated when an identical segment was already written, refreshed when it was written long ago)")
+
+var RequestFanOut = MetricSet.NewCounterVec("substreams_tier1_request_fan_out", []string{"result"}, "Counter for live requests eligible to a shared pipeline, by result (started a shared pipeline, joined one, own_pipeline when its start was not covered)")
+
+var QuotaExceeded = MetricSet.NewCounterVec("substreams_tier1_quota_exceeded", []string{"quota"}, "Counter for requests rejected at admission or failed by the admission controller, by quota exceeded (concurrent_streams, backprocess_blocks, streamed_bytes)")
+
+var BillingEvents = MetricSet.NewCounterVec("substreams_billing_events", []string{"result"}, "Counter for billing events reported, by result (sent, failed when the sink returned an error, dropped when the queue of the sink was full)")
+
+var StoreFileCacheRequests = MetricSet.NewCounterVec("substreams_tier2_store_file_cache_requests", []string{"result"}, "Counter for complete store snapshots loaded through the tier2 store file cache, by result (hit, miss, invalid), used for hit rates")
+var IdempotentWritesSkipped = MetricSet.NewCounterVec("substreams_idempotent_writes_skipped", []string{"reason"}, "Counter for internal writes skipped because their object was already completed, by reason (retry of the same request, conflict with another request)")
+var IdempotencyRecordsExpired = MetricSet.NewCounter("substreams_idempotency_records_expired", "Counter for the idempotency records deleted by the expirer because their object was deleted")
+var IdempotencyExpirerErrors = MetricSet.NewCounter("substreams_idempotency_expirer_errors", "Counter for the failed scans and deletions of the idempotency records expirer")
+
+var ModuleSlowBlocks = MetricSet.NewCounter("substreams_module_slow_blocks", "Counter for blocks on which a module's execution time exceeded the execution budget, all modules included, the modules being logged and reported to the clients")
+var ModuleWasmExecutionSeconds = MetricSet.NewCounter("substreams_module_wasm_execution_seconds", "Counter for the wall-clock time spent executing the WASM code of the modules, all modules included, the usage by module being streamed to the clients")
+var ModuleStoreOperations = MetricSet.NewCounter("substreams_module_store_operations", "Counter for the reads and writes of the stores by the modules, all modules included")
+var ModuleStorePeakSizeBytes = MetricSet.NewGauge("substreams_module_store_peak_size_bytes", "Gauge for the largest size of a store since the start, all store modules included")
+var ModuleExecutionLimitsExceeded = MetricSet.NewCounterVec("substreams_module_execution_limits_exceeded", []string{"limit"}, "Counter for module executions stopped by an execution limit, by limit (timeout or fuel)")
+
+var ExtensionBreakerTrips = MetricSet.NewCounterVec("substreams_extension_breaker_trips", []string{"provider"}, "Counter for the openings of the circuit breaker of a WASM extension provider, by provider")
+var ExtensionBreakerRejectedCalls = MetricSet.NewCounterVec("substreams_extension_breaker_rejected_calls", []string{"provider"}, "Counter for the WASM extension calls failed immediately because the circuit breaker of their provider was open, by provider")
+
+var ReadyJobs = MetricSet.NewGaugeVec("substreams_tier1_ready_jobs", []string{"stage"}, "Gauge for the backprocessing jobs ready to run and not dispatched yet, all requests included, by stage (dependency depth of their module)")
+var WaitingJobs = MetricSet.NewGauge("substreams_tier1_waiting_jobs", "Gauge for the backprocessing jobs waiting on their dependencies, all requests included")
+var RunningJobs = MetricSet.NewGauge("substreams_tier1_running_jobs", "Gauge for the backprocessing jobs dispatched to tier2 and not completed yet, all requests included")
+var WorkerPoolSize = MetricSet.NewGauge("substreams_tier1_worker_pool_size", "Gauge for the workers of the backprocessing worker pools, all requests included")
+var PendingMergeBytes = MetricSet.NewGauge("substreams_tier1_pending_merge_bytes", "Gauge for the bytes of the partial stores written by tier2 and not merged yet by the squashers, all requests included")
+var ActiveRequests = MetricSet.NewGauge("substreams_tier1_active_requests", "Gauge for the requests served by tier1, when the concurrent requests are limited")
+var QueuedRequests = MetricSet.NewGauge("substreams_tier1_queued_requests", "Gauge for the requests waiting in the tier1 admission queue")
+var RejectedRequests = MetricSet.NewCounter("substreams_tier1_rejected_requests", "Counter for the requests rejected because the tier1 admission queue was full")
+
+var BlocksBySource = MetricSet.NewCounterVec("substreams_tier1_blocks_by_source", []string{"source"}, "Counter for the blocks read by the tier1 streams, by source (merged_files, live), used for the share of the blocks read from the merged blocks files")
+
+var PackageRequests = MetricSet.NewGaugeVec("substreams_package_requests", []string{"output_module_hash"}, "Gauge for the tier1 requests served since the start, by package (hash of the output module), exported when the package stats are enabled")
+var PackageJobsRun = MetricSet.NewGaugeVec("substreams_package_jobs_run", []string{"output_module_hash"}, "Gauge for the backprocessing jobs completed since the start, by package (hash of the output module), exported when the package stats are enabled")
+var PackageSegmentsProduced = MetricSet.NewGaugeVec("substreams_package_segments_produced", []string{"output_module_hash"}, "Gauge for the segments produced by the backprocessing jobs since the start, by package (hash of the output module), exported when the package stats are enabled")
+var PackageAverageSegmentDuration = MetricSet.NewGaugeVec("substreams_package_average_segment_duration_seconds", []string{"output_module_hash"}, "Gauge for the average time spent by the backprocessing jobs on a segment, by package (hash of the output module), exported when the package stats are enabled")
+var PackageCacheReuseRatio = MetricSet.NewGaugeVec("substreams_package_cache_reuse_ratio", []string{"output_module_hash"}, "Gauge for the share of the blocks of the backprocessing plans read from the caches instead of processed by jobs, by package (hash of the output module), exported when the package stats are enabled")
+
+var PartialReaperOrphanedFiles = MetricSet.NewGauge("substreams_partial_reaper_orphaned_files", "Gauge for the partial store files covered by a complete snapshot found by the last scan of the partial store reaper")
+var PartialReaperDeletedFiles = MetricSet.NewCounter("substreams_partial_reaper_deleted_files", "Counter for the orphaned partial store files deleted by the partial store reaper")
+var PartialReaperDeletedResumePoints = MetricSet.NewCounter("substreams_partial_reaper_deleted_resume_points", "Counter for the resume points deleted by the partial store reaper once older than the maximum age")
+var PartialReaperErrors = MetricSet.NewCounter("substreams_partial_reaper_errors", "Counter for the failed scans and deletions of the partial store reaper")
+
+var PlanCheckpointsExpired = MetricSet.NewCounter("substreams_tier1_plan_checkpoints_expired", "Counter for the work plan checkpoints deleted by the plan checkpoint sweeper once older than the maximum age")
+var PlanCheckpointSweeperErrors = MetricSet.NewCounter("substreams_tier1_plan_checkpoint_sweeper_errors", "Counter for the failed sweeps of the plan checkpoint sweeper")
+
+var ExecOutPrunerSegments = MetricSet.NewGauge("substreams_execout_pruner_segments", "Gauge for the execution output segments found by the last scan of the execout pruner")
+var ExecOutPrunerExpiredSegments = MetricSet.NewGauge("substreams_execout_pruner_expired_segments", "Gauge for the execution output segments unused for longer than the maximum age found by the last scan of the execout pruner")
+var ExecOutPrunerDeletedSegments = MetricSet.NewCounter("substreams_execout_pruner_deleted_segments", "Counter for the unused execution output segments deleted by the execout pruner")
+var ExecOutPrunerDeletedBlobs = MetricSet.NewCounter("substreams_execout_pruner_deleted_blobs", "Counter for the execution output blobs referenced by no segment deleted by the execout pruner")
+var ExecOutPrunerErrors = MetricSet.NewCounter("substreams_execout_pruner_errors", "Counter for the failed scans and deletions of the execout pruner")
+
 var AppReadiness = MetricSet.NewAppReadiness("firehose")
 
 var registerOnce sync.Once
@@ -0,0 +1,127 @@
+package metrics
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// ModuleMeter accounts the resources used by each module of a request: the
+// time spent executing its WASM code, its reads and writes of the stores and,
+// for a store module, the peak size of its store. It is the per module
+// counterpart of the request's bytes meter. The usage by module is kept per
+// request, only its totals are exported to the `substreams_module_*` metrics:
+// labelled by module, their series would grow with every module ever served.
+type ModuleMeter struct {
+	mu      sync.Mutex
+	modules map[string]*ModuleUsage
+	changed map[string]bool // since the last call to Changed
+}
+
+// ModuleUsage is the resources used by a module, see ModuleMeter.
+type ModuleUsage struct {
+	Module             string
+	WasmExecution      time.Duration // wall-clock time of the executions, the host calls included
+	StoreOperations    uint64
+	StorePeakSizeBytes uint64
+}
+
+func NewModuleMeter() *ModuleMeter {
+	return &ModuleMeter{
+		modules: map[string]*ModuleUsage{},
+		changed: map[string]bool{},
+	}
+}
+
+// RecordExecution records an execution of `module` on a block, taking
+// `elapsed` and doing `storeOperations` reads and writes, its store holding
+// `storeSizeBytes` after it, 0 when it is not a store module. The usage is
+// also added to the totals of the `substreams_module_*` metrics. A nil meter
+// only exports them.
+func (m *ModuleMeter) RecordExecution(module string, elapsed time.Duration, storeOperations, storeSizeBytes uint64) {
+	ModuleWasmExecutionSeconds.AddFloat64(elapsed.Seconds())
+	if storeOperations != 0 {
+		ModuleStoreOperations.AddUint64(storeOperations)
+	}
+	if storeSizeBytes != 0 {
+		recordStorePeakSize(storeSizeBytes)
+	}
+
+	m.Add(ModuleUsage{Module: module, WasmExecution: elapsed, StoreOperations: storeOperations, StorePeakSizeBytes: storeSizeBytes})
+}
+
+// Add adds `usage`, used by its module elsewhere (ex: by the backprocessing
+// jobs of the request), without exporting it to the metrics.
+func (m *ModuleMeter) Add(usage ModuleUsage) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mod := m.modules[usage.Module]
+	if mod == nil {
+		mod = &ModuleUsage{Module: usage.Module}
+		m.modules[usage.Module] = mod
+	}
+	mod.WasmExecution += usage.WasmExecution
+	mod.StoreOperations += usage.StoreOperations
+	if usage.StorePeakSizeBytes > mod.StorePeakSizeBytes {
+		mod.StorePeakSizeBytes = usage.StorePeakSizeBytes
+	}
+	m.changed[usage.Module] = true
+}
+
+// Changed returns the usage of the modules changed since the previous call,
+// sorted by module name.
+func (m *ModuleMeter) Changed() (out []ModuleUsage) {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for module := range m.changed {
+		out = append(out, *m.modules[module])
+	}
+	m.changed = map[string]bool{}
+	sort.Slice(out, func(i, j int) bool { return out[i].Module < out[j].Module })
+	return out
+}
+
+// ModuleUsageDeltas tracks the usage of a ModuleMeter sent to another party,
+// returning the usage since it was last sent, see ModuleMeter.Changed.
+type ModuleUsageDeltas struct {
+	sent map[string]ModuleUsage
+}
+
+func NewModuleUsageDeltas() *ModuleUsageDeltas {
+	return &ModuleUsageDeltas{sent: map[string]ModuleUsage{}}
+}
+
+// Of returns `usage` minus the usage of its module previously passed, the
+// peak store size being kept as is.
+func (d *ModuleUsageDeltas) Of(usage ModuleUsage) ModuleUsage {
+	previous := d.sent[usage.Module]
+	d.sent[usage.Module] = usage
+	usage.WasmExecution -= previous.WasmExecution
+	usage.StoreOperations -= previous.StoreOperations
+	return usage
+}
+
+var storePeakSize struct {
+	sync.Mutex
+	bytes uint64
+}
+
+// recordStorePeakSize sets the `substreams_module_store_peak_size_bytes` gauge
+// when `sizeBytes` is above the largest size recorded by the process.
+func recordStorePeakSize(sizeBytes uint64) {
+	storePeakSize.Lock()
+	defer storePeakSize.Unlock()
+	if sizeBytes <= storePeakSize.bytes {
+		return
+	}
+	storePeakSize.bytes = sizeBytes
+	ModuleStorePeakSizeBytes.SetUint64(sizeBytes)
+}
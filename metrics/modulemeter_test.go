@@ -0,0 +1,37 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModuleMeter(t *testing.T) {
+	meter := NewModuleMeter()
+	meter.RecordExecution("map_a", time.Millisecond, 0, 0)
+	meter.RecordExecution("store_b", 2*time.Millisecond, 3, 100)
+	meter.RecordExecution("store_b", 2*time.Millisecond, 1, 80)
+	meter.Add(ModuleUsage{Module: "store_b", WasmExecution: time.Second, StoreOperations: 10, StorePeakSizeBytes: 500})
+
+	assert.Equal(t, []ModuleUsage{
+		{Module: "map_a", WasmExecution: time.Millisecond},
+		{Module: "store_b", WasmExecution: time.Second + 4*time.Millisecond, StoreOperations: 14, StorePeakSizeBytes: 500},
+	}, meter.Changed())
+	assert.Empty(t, meter.Changed())
+
+	meter.RecordExecution("map_a", time.Millisecond, 0, 0)
+	assert.Equal(t, []ModuleUsage{{Module: "map_a", WasmExecution: 2 * time.Millisecond}}, meter.Changed(), "only the modules changed")
+
+	var nilMeter *ModuleMeter
+	nilMeter.RecordExecution("map_a", time.Millisecond, 0, 0)
+	assert.Nil(t, nilMeter.Changed())
+}
+
+func TestModuleUsageDeltas(t *testing.T) {
+	deltas := NewModuleUsageDeltas()
+	assert.Equal(t, ModuleUsage{Module: "a", WasmExecution: time.Second, StoreOperations: 5, StorePeakSizeBytes: 100},
+		deltas.Of(ModuleUsage{Module: "a", WasmExecution: time.Second, StoreOperations: 5, StorePeakSizeBytes: 100}))
+	assert.Equal(t, ModuleUsage{Module: "a", WasmExecution: time.Second, StoreOperations: 1, StorePeakSizeBytes: 100},
+		deltas.Of(ModuleUsage{Module: "a", WasmExecution: 2 * time.Second, StoreOperations: 6, StorePeakSizeBytes: 100}))
+}
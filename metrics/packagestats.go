@@ -0,0 +1,205 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/streamingfast/substreams/block"
+)
+
+// PackageStats aggregates the orchestration of the tier1 requests by package,
+// identified by the hash of their output module, to decide which packages to
+// pre-backfill and how to size the tier2 fleets. They are exported
+// periodically, see Run.
+type PackageStats struct {
+	mu       sync.Mutex
+	packages map[string]*PackageStat // by output module hash
+}
+
+// PackageStat is the orchestration of the requests of a package since the
+// process started.
+type PackageStat struct {
+	OutputModuleHash string        `json:"output_module_hash"`
+	OutputModule     string        `json:"output_module"` // of the last request
+	Requests         uint64        `json:"requests"`
+	JobsRun          uint64        `json:"jobs_run"`
+	SegmentsProduced uint64        `json:"segments_produced"`
+	JobsDuration     time.Duration `json:"jobs_duration"`
+	CachedBlocks     uint64        `json:"cached_blocks"`  // blocks of the plans already processed, read from the caches
+	PlannedBlocks    uint64        `json:"planned_blocks"` // blocks of the plans processed by jobs
+}
+
+// AverageSegmentDuration is the time spent by the jobs on each segment.
+func (p *PackageStat) AverageSegmentDuration() time.Duration {
+	if p.SegmentsProduced == 0 {
+		return 0
+	}
+	return p.JobsDuration / time.Duration(p.SegmentsProduced)
+}
+
+// CacheReuseRatio is the share of the blocks of the plans read from the caches
+// instead of processed by jobs.
+func (p *PackageStat) CacheReuseRatio() float64 {
+	if p.CachedBlocks+p.PlannedBlocks == 0 {
+		return 0
+	}
+	return float64(p.CachedBlocks) / float64(p.CachedBlocks+p.PlannedBlocks)
+}
+
+func (p *PackageStat) MarshalJSON() ([]byte, error) {
+	type stat PackageStat
+	return json.Marshal(struct {
+		*stat
+		AverageSegmentDuration time.Duration `json:"average_segment_duration"`
+		CacheReuseRatio        float64       `json:"cache_reuse_ratio"`
+	}{(*stat)(p), p.AverageSegmentDuration(), p.CacheReuseRatio()})
+}
+
+func NewPackageStats() *PackageStats {
+	return &PackageStats{packages: map[string]*PackageStat{}}
+}
+
+// ForPackage returns the recorder of the orchestration of a request of the
+// package `outputModuleHash`, whose segments are `segmentSize` blocks. It is
+// nil when `s` is nil, recording nothing.
+func (s *PackageStats) ForPackage(outputModuleHash, outputModule string, segmentSize uint64) *PackageRecorder {
+	if s == nil {
+		return nil
+	}
+	return &PackageRecorder{stats: s, outputModuleHash: outputModuleHash, outputModule: outputModule, segmentSize: segmentSize}
+}
+
+func (s *PackageStats) update(outputModuleHash string, f func(stat *PackageStat)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stat := s.packages[outputModuleHash]
+	if stat == nil {
+		stat = &PackageStat{OutputModuleHash: outputModuleHash}
+		s.packages[outputModuleHash] = stat
+	}
+	f(stat)
+}
+
+// Snapshot returns a copy of the stats of the packages, ordered by hash.
+func (s *PackageStats) Snapshot() []*PackageStat {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]*PackageStat, 0, len(s.packages))
+	for _, stat := range s.packages {
+		copied := *stat
+		out = append(out, &copied)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].OutputModuleHash < out[j].OutputModuleHash })
+	return out
+}
+
+// PackageStatsExporter sends the stats of the packages to a metrics backend
+// or a file.
+type PackageStatsExporter func(stats []*PackageStat) error
+
+// Run exports the stats with each of `exporters` every `interval`, until `ctx`
+// is done. A failed export is logged and retried at the next interval.
+func (s *PackageStats) Run(ctx context.Context, interval time.Duration, logger *zap.Logger, exporters ...PackageStatsExporter) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		stats := s.Snapshot()
+		for _, export := range exporters {
+			if err := export(stats); err != nil {
+				logger.Warn("exporting package stats", zap.Error(err))
+			}
+		}
+	}
+}
+
+// PackageStatsFileExporter writes the stats to `path` as a JSON array,
+// replacing the previous ones.
+func PackageStatsFileExporter(path string) PackageStatsExporter {
+	return func(stats []*PackageStat) error {
+		content, err := json.MarshalIndent(stats, "", "  ")
+		if err != nil {
+			return fmt.Errorf("encoding package stats: %w", err)
+		}
+		tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+		if err != nil {
+			return fmt.Errorf("creating package stats file: %w", err)
+		}
+		defer os.Remove(tmp.Name())
+		if _, err := tmp.Write(content); err != nil {
+			tmp.Close()
+			return fmt.Errorf("writing package stats file: %w", err)
+		}
+		if err := tmp.Close(); err != nil {
+			return fmt.Errorf("writing package stats file: %w", err)
+		}
+		// readers never see a partially written file
+		return os.Rename(tmp.Name(), path)
+	}
+}
+
+// PackageStatsMetricsExporter sets the `substreams_package_*` gauges, by
+// output module hash.
+func PackageStatsMetricsExporter(stats []*PackageStat) error {
+	for _, stat := range stats {
+		PackageRequests.SetUint64(stat.Requests, stat.OutputModuleHash)
+		PackageJobsRun.SetUint64(stat.JobsRun, stat.OutputModuleHash)
+		PackageSegmentsProduced.SetUint64(stat.SegmentsProduced, stat.OutputModuleHash)
+		PackageAverageSegmentDuration.SetFloat64(stat.AverageSegmentDuration().Seconds(), stat.OutputModuleHash)
+		PackageCacheReuseRatio.SetFloat64(stat.CacheReuseRatio(), stat.OutputModuleHash)
+	}
+	return nil
+}
+
+// PackageRecorder records the orchestration of a request in the stats of its
+// package, see PackageStats.ForPackage.
+type PackageRecorder struct {
+	stats            *PackageStats
+	outputModuleHash string
+	outputModule     string
+	segmentSize      uint64
+}
+
+// RecordPlan records the plan of the request: `cachedBlocks` of its modules
+// are read from the caches, `plannedBlocks` are processed by its jobs.
+func (r *PackageRecorder) RecordPlan(cachedBlocks, plannedBlocks uint64) {
+	if r == nil {
+		return
+	}
+	r.stats.update(r.outputModuleHash, func(stat *PackageStat) {
+		stat.OutputModule = r.outputModule
+		stat.Requests++
+		stat.CachedBlocks += cachedBlocks
+		stat.PlannedBlocks += plannedBlocks
+	})
+}
+
+// RecordJob records a job of the request completed in `duration`, producing
+// the segments of `jobRange`.
+func (r *PackageRecorder) RecordJob(jobRange *block.Range, duration time.Duration) {
+	if r == nil {
+		return
+	}
+	segments := uint64(1)
+	if r.segmentSize != 0 {
+		segments = uint64(len(jobRange.Split(r.segmentSize)))
+	}
+	r.stats.update(r.outputModuleHash, func(stat *PackageStat) {
+		stat.JobsRun++
+		stat.SegmentsProduced += segments
+		stat.JobsDuration += duration
+	})
+}
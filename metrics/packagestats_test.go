@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/streamingfast/substreams/block"
+)
+
+func TestPackageStats(t *testing.T) {
+	stats := NewPackageStats()
+
+	first := stats.ForPackage("abc", "map_a", 100)
+	first.RecordPlan(300, 700)
+	first.RecordJob(block.NewRange(300, 500), 4*time.Second)
+	first.RecordJob(block.NewRange(550, 600), time.Second) // not aligned on the segments
+
+	second := stats.ForPackage("abc", "map_a", 100)
+	second.RecordPlan(1000, 0)
+	stats.ForPackage("def", "map_b", 100).RecordPlan(0, 100)
+
+	snapshot := stats.Snapshot()
+	require.Len(t, snapshot, 2)
+	abc := snapshot[0]
+	assert.Equal(t, "abc", abc.OutputModuleHash)
+	assert.Equal(t, uint64(2), abc.Requests)
+	assert.Equal(t, uint64(2), abc.JobsRun)
+	assert.Equal(t, uint64(3), abc.SegmentsProduced)
+	assert.Equal(t, 5*time.Second/3, abc.AverageSegmentDuration())
+	assert.Equal(t, 1300.0/2000.0, abc.CacheReuseRatio())
+	assert.Equal(t, 0.0, snapshot[1].CacheReuseRatio())
+
+	// recording nothing when the stats are disabled
+	var disabled *PackageStats
+	disabled.ForPackage("abc", "map_a", 100).RecordJob(block.NewRange(0, 100), time.Second)
+
+	path := filepath.Join(t.TempDir(), "package_stats.json")
+	require.NoError(t, PackageStatsFileExporter(path)(snapshot))
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var exported []map[string]interface{}
+	require.NoError(t, json.Unmarshal(content, &exported))
+	require.Len(t, exported, 2)
+	assert.Equal(t, "abc", exported[0]["output_module_hash"])
+	assert.Equal(t, 0.65, exported[0]["cache_reuse_ratio"])
+	assert.Equal(t, float64(3), exported[0]["segments_produced"])
+}
@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Value returns the sum of the values of the counters and gauges collected
+// from `collector`, to report them outside of prometheus.
+func Value(collector prometheus.Collector) (out float64) {
+	collect(collector, func(_ []*dto.LabelPair, value float64) {
+		out += value
+	})
+	return out
+}
+
+// ValuesByLabel returns the values of the counters and gauges collected from
+// `collector`, summed by the value of their label `label`.
+func ValuesByLabel(collector prometheus.Collector, label string) map[string]float64 {
+	out := map[string]float64{}
+	collect(collector, func(labels []*dto.LabelPair, value float64) {
+		for _, pair := range labels {
+			if pair.GetName() == label {
+				out[pair.GetValue()] += value
+			}
+		}
+	})
+	return out
+}
+
+func collect(collector prometheus.Collector, f func(labels []*dto.LabelPair, value float64)) {
+	metrics := make(chan prometheus.Metric)
+	go func() {
+		collector.Collect(metrics)
+		close(metrics)
+	}()
+
+	for metric := range metrics {
+		m := &dto.Metric{}
+		if err := metric.Write(m); err != nil {
+			continue
+		}
+		switch {
+		case m.Counter != nil:
+			f(m.Label, m.Counter.GetValue())
+		case m.Gauge != nil:
+			f(m.Label, m.Gauge.GetValue())
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/streamingfast/substreams/block"
+	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
+	"github.com/streamingfast/substreams/pipeline/outputmodules"
+	"github.com/streamingfast/substreams/service/config"
+	"github.com/streamingfast/substreams/storage"
+	execoutState "github.com/streamingfast/substreams/storage/execout/state"
+	"github.com/streamingfast/substreams/storage/index"
+)
+
+// skipSegmentFunc returns whether the block index module filtering the output
+// map `module` matched none of the blocks of a segment, its outputs being empty
+// over it. It is nil if the module is not filtered.
+//
+// Only the segments of the output maps are skipped: the filtered stores still
+// produce a partial store for every segment, their executors skipping the
+// blocks not matched.
+func skipSegmentFunc(runtimeConfig config.RuntimeConfig, outputGraph *outputmodules.Graph, module *pbsubstreams.Module) (func(ctx context.Context, segment *block.Range) (bool, error), error) {
+	filter := module.BlockFilter
+	if filter == nil {
+		return nil, nil
+	}
+
+	indexStore, err := index.NewStore(runtimeConfig.BaseObjectStore, outputGraph.ModuleHashes().Get(filter.Module), runtimeConfig.CacheSaveInterval)
+	if err != nil {
+		return nil, fmt.Errorf("block index %q: %w", filter.Module, err)
+	}
+	return indexStore.MatchesNone, nil
+}
+
+// skipFilteredSegments plans no job for the missing segments of the output
+// maps over which they are known to match no block, see skipSegmentFunc.
+func skipFilteredSegments(ctx context.Context, runtimeConfig config.RuntimeConfig, outputGraph *outputmodules.Graph, modulesStateMap storage.ModuleStorageStateMap) error {
+	for _, module := range outputGraph.OutputModules() {
+		execOutState, ok := modulesStateMap[module.Name].(*execoutState.ExecOutputStorageState)
+		if !ok {
+			continue
+		}
+
+		skipSegment, err := skipSegmentFunc(runtimeConfig, outputGraph, module)
+		if err != nil {
+			return err
+		}
+		if skipSegment == nil {
+			continue
+		}
+		if err := execOutState.SkipSegments(func(segment *block.Range) (bool, error) {
+			return skipSegment(ctx, segment)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package orchestrator
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/streamingfast/substreams/orchestrator/work"
+	"github.com/streamingfast/substreams/pipeline/outputmodules"
+	"github.com/streamingfast/substreams/reqctx"
+	"github.com/streamingfast/substreams/service/config"
+	"github.com/streamingfast/substreams/storage/store"
+)
+
+const planCheckpointInterval = 30 * time.Second
+
+func newPlanCheckpointer(runtimeConfig config.RuntimeConfig, reqDetails *reqctx.RequestDetails, outputGraph *outputmodules.Graph) (*work.PlanCheckpointer, error) {
+	if !runtimeConfig.PlanCheckpoints {
+		return nil, nil
+	}
+
+	plansStore, err := runtimeConfig.BaseObjectStore.SubStore("plans")
+	if err != nil {
+		return nil, fmt.Errorf("plans store: %w", err)
+	}
+	return work.NewPlanCheckpointer(plansStore, planCheckpointKey(reqDetails, outputGraph), planCheckpointInterval, runtimeConfig.PlanCheckpointMaxAge), nil
+}
+
+// planCheckpointKey identifies the work plan of a request: the same output module
+// (its hash covering all of its ancestors) processed over the same range.
+func planCheckpointKey(reqDetails *reqctx.RequestDetails, outputGraph *outputmodules.Graph) string {
+	outputModuleHash := outputGraph.ModuleHashes().Get(outputGraph.OutputModule().Name)
+	key := fmt.Sprintf("%s:%d:%d:%t", outputModuleHash, reqDetails.ResolvedStartBlockNum, reqDetails.LinearHandoffBlockNum, reqDetails.ProductionMode)
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(key)))
+}
+
+// resumePlan returns the plan resumed from the last checkpoint, or nil if there
+// is none or it cannot be trusted: every complete store snapshot it starts from
+// must exist, as snapshots are written asynchronously after being squashed.
+func resumePlan(ctx context.Context, checkpointer *work.PlanCheckpointer, storeConfigs store.ConfigMap) *work.Plan {
+	if checkpointer == nil {
+		return nil
+	}
+	logger := reqctx.Logger(ctx)
+
+	checkpoint, err := checkpointer.Load(ctx)
+	if err != nil {
+		logger.Warn("cannot load plan checkpoint, planning from scratch", zap.Error(err))
+		return nil
+	}
+	if checkpoint == nil {
+		return nil
+	}
+
+	for name, storeState := range checkpoint.StoreStates {
+		if storeState.InitialCompleteFile == nil {
+			continue
+		}
+		storeConfig, found := storeConfigs[name]
+		if !found {
+			logger.Warn("plan checkpoint references an unknown store, planning from scratch", zap.String("store", name))
+			return nil
+		}
+		exists, err := storeConfig.FileExists(ctx, storeState.InitialCompleteFile)
+		if err != nil || !exists {
+			logger.Info("plan checkpoint store snapshot missing, planning from scratch", zap.String("store", name), zap.Stringer("range", storeState.InitialCompleteFile.Range), zap.Error(err))
+			return nil
+		}
+	}
+
+	plan, err := work.ResumePlan(ctx, checkpoint)
+	if err != nil {
+		logger.Warn("cannot resume plan checkpoint, planning from scratch", zap.Error(err))
+		return nil
+	}
+
+	logger.Info("resuming work plan from checkpoint", zap.Int("jobs", len(checkpoint.Jobs)))
+	return plan
+}
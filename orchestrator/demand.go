@@ -0,0 +1,94 @@
+package orchestrator
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/streamingfast/substreams/metrics"
+	"github.com/streamingfast/substreams/orchestrator/work"
+	"github.com/streamingfast/substreams/reqctx"
+)
+
+// demandInterval is the interval at which the demand of a request is published
+// to the metrics and its worker pool resized, see work.Autoscaler.
+var demandInterval = 5 * time.Second
+
+// monitorDemand publishes the demand of the scheduled plan and resizes `pool`
+// with the autoscaler, if any, until `ctx` is done.
+func (s *Scheduler) monitorDemand(ctx context.Context, pool work.WorkerPool) {
+	published := &demandGauges{}
+	defer published.clear()
+
+	ticker := time.NewTicker(demandInterval)
+	defer ticker.Stop()
+
+	for {
+		demand := s.workPlan.Demand()
+		demand.Workers = pool.Size()
+		demand.MaxWorkers = s.maxWorkers
+
+		if s.autoscaler != nil {
+			workerCount := s.autoscaler.WorkerCount(demand)
+			if workerCount != demand.Workers {
+				reqctx.Logger(ctx).Debug("autoscaling worker pool",
+					zap.Ints("ready_jobs_by_stage", demand.ReadyJobsByStage),
+					zap.Int("waiting_jobs", demand.WaitingJobs),
+					zap.Int("running_jobs", demand.RunningJobs),
+					zap.Uint64("worker_count", workerCount),
+				)
+				pool.Resize(workerCount)
+				demand.Workers = pool.Size()
+
+				s.currentJobsLock.Lock()
+				s.capacity = int(demand.Workers)
+				s.currentJobsLock.Unlock()
+			}
+		}
+		published.publish(demand)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// demandGauges tracks the demand of a single request published to the metrics,
+// which add up the demand of all requests.
+type demandGauges struct {
+	readyJobsByStage []int
+	waitingJobs      int
+	runningJobs      int
+	workers          uint64
+}
+
+func (g *demandGauges) publish(demand *work.Demand) {
+	for stage := 0; stage < len(demand.ReadyJobsByStage) || stage < len(g.readyJobsByStage); stage++ {
+		var current, previous int
+		if stage < len(demand.ReadyJobsByStage) {
+			current = demand.ReadyJobsByStage[stage]
+		}
+		if stage < len(g.readyJobsByStage) {
+			previous = g.readyJobsByStage[stage]
+		}
+		if current != previous {
+			metrics.ReadyJobs.Native().WithLabelValues(strconv.Itoa(stage)).Add(float64(current - previous))
+		}
+	}
+	metrics.WaitingJobs.Native().Add(float64(demand.WaitingJobs - g.waitingJobs))
+	metrics.RunningJobs.Native().Add(float64(demand.RunningJobs - g.runningJobs))
+	metrics.WorkerPoolSize.Native().Add(float64(demand.Workers) - float64(g.workers))
+
+	g.readyJobsByStage = append(g.readyJobsByStage[:0], demand.ReadyJobsByStage...)
+	g.waitingJobs = demand.WaitingJobs
+	g.runningJobs = demand.RunningJobs
+	g.workers = demand.Workers
+}
+
+func (g *demandGauges) clear() {
+	g.publish(&work.Demand{})
+}
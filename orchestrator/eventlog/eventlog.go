@@ -0,0 +1,135 @@
+// Package eventlog records the decisions taken by the tier1 scheduler for a
+// request (jobs dispatched, completed, retried, preempted, squashes triggered)
+// into a compact log stored alongside the request trace ID, from which the
+// timeline of a backfill can be reconstructed for postmortems.
+package eventlog
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/streamingfast/dstore"
+)
+
+type Kind string
+
+const (
+	JobDispatched   Kind = "job_dispatched"
+	JobCompleted    Kind = "job_completed"
+	JobRetried      Kind = "job_retried"
+	JobFailed       Kind = "job_failed"
+	JobPreempted    Kind = "job_preempted" // canceled before completion, ex: the request terminated
+	SquashTriggered Kind = "squash_triggered"
+	StoreCompleted  Kind = "store_completed" // a store is squashed up to `end_block`
+)
+
+// Event is a single scheduler decision, stored as a JSON line.
+type Event struct {
+	Time       time.Time `json:"t"`
+	Kind       Kind      `json:"k"`
+	Module     string    `json:"m,omitempty"`
+	StartBlock uint64    `json:"s,omitempty"`
+	EndBlock   uint64    `json:"e,omitempty"`
+	Worker     string    `json:"w,omitempty"`
+	Error      string    `json:"err,omitempty"`
+}
+
+// Log accumulates the events of a request in memory until Flush. A nil Log
+// records nothing.
+type Log struct {
+	mu     sync.Mutex
+	events []*Event
+	now    func() time.Time
+}
+
+func New() *Log {
+	return &Log{now: time.Now}
+}
+
+func (l *Log) Record(kind Kind, module string, startBlock, endBlock uint64, worker string, err error) {
+	if l == nil {
+		return
+	}
+
+	event := &Event{
+		Kind:       kind,
+		Module:     module,
+		StartBlock: startBlock,
+		EndBlock:   endBlock,
+		Worker:     worker,
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	event.Time = l.now()
+	l.events = append(l.events, event)
+}
+
+func (l *Log) Events() []*Event {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]*Event{}, l.events...)
+}
+
+func filename(traceID string) string {
+	return traceID + ".events.jsonl"
+}
+
+// Flush writes the events recorded so far in `store`, under the request trace ID.
+func (l *Log) Flush(ctx context.Context, store dstore.Store, traceID string) error {
+	if l == nil {
+		return nil
+	}
+
+	buf := bytes.NewBuffer(nil)
+	encoder := json.NewEncoder(buf)
+	for _, event := range l.Events() {
+		if err := encoder.Encode(event); err != nil {
+			return fmt.Errorf("encoding event: %w", err)
+		}
+	}
+
+	if err := store.WriteObject(ctx, filename(traceID), buf); err != nil {
+		return fmt.Errorf("writing event log %q: %w", filename(traceID), err)
+	}
+	return nil
+}
+
+// Load reads the events recorded for the request `traceID` from `store`.
+func Load(ctx context.Context, store dstore.Store, traceID string) ([]*Event, error) {
+	reader, err := store.OpenObject(ctx, filename(traceID))
+	if err != nil {
+		return nil, fmt.Errorf("opening event log %q: %w", filename(traceID), err)
+	}
+	defer reader.Close()
+
+	var out []*Event
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		event := &Event{}
+		if err := json.Unmarshal(scanner.Bytes(), event); err != nil {
+			return nil, fmt.Errorf("decoding event %d: %w", len(out), err)
+		}
+		out = append(out, event)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading event log %q: %w", filename(traceID), err)
+	}
+	return out, nil
+}
@@ -0,0 +1,69 @@
+package eventlog
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/streamingfast/dstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLog_FlushLoadReplay(t *testing.T) {
+	ctx := context.Background()
+	store, err := dstore.NewStore("file://"+t.TempDir(), "", "", false)
+	require.NoError(t, err)
+
+	start := time.Date(2023, 7, 1, 0, 0, 0, 0, time.UTC)
+	ticks := 0
+	log := New()
+	log.now = func() time.Time {
+		ticks++
+		return start.Add(time.Duration(ticks) * time.Second)
+	}
+
+	log.Record(JobDispatched, "A", 0, 100, "w1", nil)
+	log.Record(JobDispatched, "B", 0, 100, "w2", nil)
+	log.Record(JobRetried, "A", 0, 100, "w1", fmt.Errorf("connection reset"))
+	log.Record(JobCompleted, "A", 0, 100, "w1", nil)
+	log.Record(SquashTriggered, "A", 0, 100, "", nil)
+	log.Record(StoreCompleted, "A", 0, 100, "", nil)
+
+	require.NoError(t, log.Flush(ctx, store, "trace"))
+
+	events, err := Load(ctx, store, "trace")
+	require.NoError(t, err)
+	require.Len(t, events, 6)
+
+	timeline := Replay(events)
+	require.Len(t, timeline.Jobs, 2)
+
+	a := timeline.Jobs[0]
+	assert.Equal(t, "A", a.Module)
+	assert.Equal(t, JobCompleted, a.Outcome)
+	assert.Equal(t, 1, a.Retries)
+	assert.Equal(t, 3*time.Second, a.Duration())
+
+	b := timeline.Jobs[1]
+	assert.Equal(t, Kind(""), b.Outcome)
+	assert.True(t, b.Ended.IsZero())
+
+	require.Len(t, timeline.Stores, 1)
+	assert.Equal(t, uint64(100), timeline.Stores[0].UpTo)
+	assert.Equal(t, 1, timeline.Stores[0].Squashes)
+
+	out := bytes.NewBuffer(nil)
+	timeline.Render(out)
+	assert.Contains(t, out.String(), "NEVER ENDED")
+	assert.Contains(t, out.String(), "2 job(s), 0 failed, 1 never ended")
+}
+
+func TestLog_Nil(t *testing.T) {
+	var log *Log
+	log.Record(JobDispatched, "A", 0, 100, "w1", nil)
+	assert.Nil(t, log.Events())
+	assert.NoError(t, log.Flush(context.Background(), nil, "trace"))
+}
@@ -0,0 +1,167 @@
+package eventlog
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// JobSpan is a job reconstructed from its events.
+type JobSpan struct {
+	Module     string
+	StartBlock uint64
+	EndBlock   uint64
+	Worker     string
+
+	Dispatched time.Time
+	Ended      time.Time // zero if the job never ended
+	Retries    int
+	Outcome    Kind // JobCompleted, JobFailed or JobPreempted, empty if the job never ended
+	Error      string
+}
+
+func (j *JobSpan) Duration() time.Duration {
+	if j.Ended.IsZero() {
+		return 0
+	}
+	return j.Ended.Sub(j.Dispatched)
+}
+
+// StoreProgress is the last block up to which a store was squashed.
+type StoreProgress struct {
+	Module   string
+	UpTo     uint64
+	Time     time.Time
+	Squashes int
+}
+
+// Timeline is the reconstructed history of a request's scheduling.
+type Timeline struct {
+	Start time.Time
+	End   time.Time
+
+	Jobs   []*JobSpan // sorted by dispatch time
+	Stores []*StoreProgress
+}
+
+// Replay reconstructs the timeline of a request from its events.
+func Replay(events []*Event) *Timeline {
+	out := &Timeline{}
+	if len(events) == 0 {
+		return out
+	}
+	out.Start = events[0].Time
+	out.End = events[len(events)-1].Time
+
+	type jobKey struct {
+		module     string
+		startBlock uint64
+		endBlock   uint64
+	}
+	running := map[jobKey]*JobSpan{}
+	stores := map[string]*StoreProgress{}
+	store := func(module string) *StoreProgress {
+		if stores[module] == nil {
+			stores[module] = &StoreProgress{Module: module}
+		}
+		return stores[module]
+	}
+
+	for _, event := range events {
+		key := jobKey{event.Module, event.StartBlock, event.EndBlock}
+		switch event.Kind {
+		case JobDispatched:
+			job := &JobSpan{
+				Module:     event.Module,
+				StartBlock: event.StartBlock,
+				EndBlock:   event.EndBlock,
+				Worker:     event.Worker,
+				Dispatched: event.Time,
+			}
+			running[key] = job
+			out.Jobs = append(out.Jobs, job)
+		case JobRetried:
+			if job := running[key]; job != nil {
+				job.Retries++
+				job.Error = event.Error
+			}
+		case JobCompleted, JobFailed, JobPreempted:
+			if job := running[key]; job != nil {
+				job.Ended = event.Time
+				job.Outcome = event.Kind
+				if event.Error != "" {
+					job.Error = event.Error
+				}
+				delete(running, key)
+			}
+		case SquashTriggered:
+			store(event.Module).Squashes++
+		case StoreCompleted:
+			s := store(event.Module)
+			if event.EndBlock > s.UpTo {
+				s.UpTo = event.EndBlock
+				s.Time = event.Time
+			}
+		}
+	}
+
+	sort.SliceStable(out.Jobs, func(i, j int) bool { return out.Jobs[i].Dispatched.Before(out.Jobs[j].Dispatched) })
+	for _, s := range stores {
+		out.Stores = append(out.Stores, s)
+	}
+	sort.Slice(out.Stores, func(i, j int) bool { return out.Stores[i].Module < out.Stores[j].Module })
+
+	return out
+}
+
+// Render writes a human readable timeline, offsets being relative to the first event.
+func (t *Timeline) Render(w io.Writer) {
+	if len(t.Jobs) == 0 && len(t.Stores) == 0 {
+		fmt.Fprintln(w, "No events recorded")
+		return
+	}
+
+	offset := func(at time.Time) string {
+		return fmt.Sprintf("+%.1fs", at.Sub(t.Start).Seconds())
+	}
+
+	fmt.Fprintf(w, "Timeline from %s to %s (%s)\n\n", t.Start.Format(time.RFC3339), t.End.Format(time.RFC3339), t.End.Sub(t.Start).Round(time.Millisecond))
+
+	fmt.Fprintln(w, "Jobs:")
+	var unfinished, failed int
+	for _, job := range t.Jobs {
+		ended, outcome := "?", "NEVER ENDED"
+		if !job.Ended.IsZero() {
+			ended = offset(job.Ended)
+			outcome = fmt.Sprintf("%s in %s", job.Outcome, job.Duration().Round(time.Millisecond))
+		} else {
+			unfinished++
+		}
+		if job.Outcome == JobFailed {
+			failed++
+		}
+
+		fmt.Fprintf(w, "  %-9s %-9s %-25s [%d, %d) worker=%s %s", offset(job.Dispatched), ended, job.Module, job.StartBlock, job.EndBlock, job.Worker, outcome)
+		if job.Retries != 0 {
+			fmt.Fprintf(w, " retries=%d", job.Retries)
+		}
+		if job.Error != "" {
+			fmt.Fprintf(w, " error=%q", job.Error)
+		}
+		fmt.Fprintln(w)
+	}
+
+	if len(t.Stores) != 0 {
+		fmt.Fprintln(w, "\nStores:")
+		for _, s := range t.Stores {
+			reached := "never"
+			if !s.Time.IsZero() {
+				reached = offset(s.Time)
+			}
+			fmt.Fprintf(w, "  %-25s squashed up to %d (at %s), %d squash(es) triggered\n", s.Module, s.UpTo, reached, s.Squashes)
+		}
+	}
+
+	fmt.Fprintf(w, "\n%d job(s), %d failed, %d never ended\n", len(t.Jobs), failed, unfinished)
+}
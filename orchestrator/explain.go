@@ -0,0 +1,91 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/streamingfast/substreams/orchestrator/work"
+	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
+	"github.com/streamingfast/substreams/pipeline/outputmodules"
+	"github.com/streamingfast/substreams/reqctx"
+	"github.com/streamingfast/substreams/service/config"
+	"github.com/streamingfast/substreams/storage/execout"
+	"github.com/streamingfast/substreams/storage/store"
+)
+
+// ExplainPlan builds the work plan of a request the same way BuildParallelProcessor
+// does, and describes it without running any of its jobs.
+func ExplainPlan(
+	ctx context.Context,
+	reqDetails *reqctx.RequestDetails,
+	runtimeConfig config.RuntimeConfig,
+	outputGraph *outputmodules.Graph,
+	execoutStorage *execout.Configs,
+	storeConfigs store.ConfigMap,
+) (*pbsubstreamsrpc.ExplainResponse, error) {
+	checkpointer, err := newPlanCheckpointer(runtimeConfig, reqDetails, outputGraph)
+	if err != nil {
+		return nil, fmt.Errorf("plan checkpointer: %w", err)
+	}
+
+	throughputStats, err := newThroughputStats(runtimeConfig)
+	if err != nil {
+		return nil, fmt.Errorf("throughput stats: %w", err)
+	}
+
+	plan, err := buildPlan(ctx, reqDetails, runtimeConfig, outputGraph, execoutStorage, storeConfigs, checkpointer, loadThroughput(ctx, throughputStats, outputGraph))
+	if err != nil {
+		return nil, err
+	}
+
+	return explainPlan(plan, reqDetails, runtimeConfig), nil
+}
+
+func explainPlan(plan *work.Plan, reqDetails *reqctx.RequestDetails, runtimeConfig config.RuntimeConfig) *pbsubstreamsrpc.ExplainResponse {
+	out := &pbsubstreamsrpc.ExplainResponse{
+		ResolvedStartBlock: reqDetails.ResolvedStartBlockNum,
+		LinearHandoffBlock: reqDetails.LinearHandoffBlockNum,
+		MaxParallelWorkers: reqDetails.MaxParallelJobs,
+		SegmentSize:        runtimeConfig.CacheSaveInterval,
+		JobSize:            runtimeConfig.SubrequestsSplitSize,
+	}
+
+	modules := map[string]*pbsubstreamsrpc.ExplainedModule{}
+	for _, name := range plan.ModulesStateMap.Names() {
+		module := &pbsubstreamsrpc.ExplainedModule{Name: name}
+		for _, rng := range plan.ModulesStateMap[name].InitialProgressRanges() {
+			module.CachedRanges = append(module.CachedRanges, &pbsubstreamsrpc.BlockRange{
+				StartBlock: rng.StartBlock,
+				EndBlock:   rng.ExclusiveEndBlock,
+			})
+		}
+		modules[name] = module
+		out.Modules = append(out.Modules, module)
+	}
+
+	for _, job := range plan.PendingJobs() {
+		segments := uint64(len(job.RequestRange.Split(runtimeConfig.CacheSaveInterval)))
+		out.Jobs = append(out.Jobs, &pbsubstreamsrpc.ExplainedJob{
+			Module: job.ModuleName,
+			Range: &pbsubstreamsrpc.BlockRange{
+				StartBlock: job.RequestRange.StartBlock,
+				EndBlock:   job.RequestRange.ExclusiveEndBlock,
+			},
+			Priority:        int64(job.Priority()),
+			RequiredModules: job.RequiredModules(),
+			Segments:        segments,
+		})
+
+		if module := modules[job.ModuleName]; module != nil {
+			module.Jobs++
+			module.BlocksToProcess += job.RequestRange.Len()
+			module.SegmentsToProcess += segments
+		}
+	}
+
+	estimate, complete := plan.EstimatedDuration(reqDetails.MaxParallelJobs)
+	out.EstimatedDurationMs = uint64(estimate.Milliseconds())
+	out.EstimateComplete = complete
+
+	return out
+}
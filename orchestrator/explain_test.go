@@ -0,0 +1,48 @@
+package orchestrator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/streamingfast/substreams/orchestrator/work"
+	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
+	"github.com/streamingfast/substreams/reqctx"
+	"github.com/streamingfast/substreams/service/config"
+)
+
+func Test_explainPlan(t *testing.T) {
+	plan := work.TestPlanReadyJobs(
+		work.TestJob("A", "0-200", 3),
+		work.TestJobDeps("B", "0-200", 1, "A"),
+		work.TestJob("A", "200-250", 2),
+	)
+	plan.ModulesStateMap = work.TestModStateMap(
+		work.TestStoreState("A", "0-100,100-200,200-250"),
+		work.TestStoreState("B", "0-100,100-200"),
+	)
+
+	out := explainPlan(plan, &reqctx.RequestDetails{
+		ResolvedStartBlockNum: 250,
+		LinearHandoffBlockNum: 250,
+		MaxParallelJobs:       4,
+	}, config.RuntimeConfig{
+		CacheSaveInterval:    100,
+		SubrequestsSplitSize: 200,
+	})
+
+	assert.Equal(t, uint64(100), out.SegmentSize)
+	assert.Equal(t, uint64(200), out.JobSize)
+	assert.Equal(t, []*pbsubstreamsrpc.ExplainedModule{
+		{Name: "A", Jobs: 2, BlocksToProcess: 250, SegmentsToProcess: 3},
+		{Name: "B", Jobs: 1, BlocksToProcess: 200, SegmentsToProcess: 2},
+	}, out.Modules)
+
+	var jobs []string
+	for _, job := range out.Jobs {
+		jobs = append(jobs, job.Module)
+	}
+	assert.Equal(t, []string{"A", "A", "B"}, jobs)
+	assert.Equal(t, []string{"A"}, out.Jobs[2].RequiredModules)
+	assert.False(t, out.EstimateComplete)
+}
@@ -0,0 +1,98 @@
+package orchestrator
+
+import (
+	"sync"
+
+	"github.com/streamingfast/substreams/metrics"
+	"github.com/streamingfast/substreams/storage/store"
+)
+
+// mergeBacklog accounts for the bytes of the partial stores handed to the
+// squashers of a request and not merged and written yet. Past `max`, it engages
+// the backpressure on the scheduler, released once the squashers caught up. A
+// nil *mergeBacklog accounts for nothing.
+type mergeBacklog struct {
+	lock   sync.Mutex
+	bytes  uint64
+	closed bool
+
+	max            uint64 // 0 for no backpressure
+	engaged        bool
+	onBackpressure func(engaged bool)
+}
+
+func (b *mergeBacklog) add(files store.FileInfos) {
+	if b == nil {
+		return
+	}
+
+	size := files.Size()
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.closed {
+		return
+	}
+	b.bytes += size
+	metrics.PendingMergeBytes.Native().Add(float64(size))
+	b.checkBackpressure()
+}
+
+func (b *mergeBacklog) remove(size uint64) {
+	if b == nil {
+		return
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.closed {
+		return
+	}
+	if size > b.bytes {
+		size = b.bytes
+	}
+	b.bytes -= size
+	metrics.PendingMergeBytes.Native().Sub(float64(size))
+	b.checkBackpressure()
+}
+
+func (b *mergeBacklog) pending() uint64 {
+	if b == nil {
+		return 0
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.bytes
+}
+
+// close removes the bytes still pending from the metric, when the squashers
+// terminated (successfully or not), and releases the backpressure.
+func (b *mergeBacklog) close() {
+	if b == nil {
+		return
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.closed {
+		return
+	}
+	metrics.PendingMergeBytes.Native().Sub(float64(b.bytes))
+	b.bytes = 0
+	b.checkBackpressure()
+	b.closed = true
+}
+
+func (b *mergeBacklog) checkBackpressure() {
+	// Called with locked mutex
+	if b.max == 0 || b.onBackpressure == nil {
+		return
+	}
+
+	engaged := b.bytes > b.max
+	if engaged != b.engaged {
+		b.engaged = engaged
+		b.onBackpressure(engaged)
+	}
+}
@@ -0,0 +1,44 @@
+package orchestrator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/streamingfast/substreams/storage/store"
+)
+
+func TestMergeBacklog(t *testing.T) {
+	partial := func(start, end, size uint64) *store.FileInfo {
+		file := store.NewPartialFileInfo(start, end, "abc")
+		file.Size = size
+		return file
+	}
+
+	var calls []bool
+	b := &mergeBacklog{max: 100, onBackpressure: func(engaged bool) { calls = append(calls, engaged) }}
+
+	b.add(store.FileInfos{partial(0, 10, 60), partial(10, 20, 30)})
+	assert.Equal(t, uint64(90), b.pending())
+	assert.Nil(t, calls)
+
+	b.add(store.FileInfos{partial(20, 30, 20)})
+	assert.Equal(t, []bool{true}, calls)
+
+	b.add(store.FileInfos{partial(30, 40, 0)})
+	b.remove(60)
+	assert.Equal(t, uint64(50), b.pending())
+	assert.Equal(t, []bool{true, false}, calls)
+
+	b.add(store.FileInfos{partial(40, 50, 70)})
+	b.close()
+	assert.Equal(t, uint64(0), b.pending())
+	assert.Equal(t, []bool{true, false, true, false}, calls)
+
+	b.add(store.FileInfos{partial(50, 60, 200)})
+	assert.Equal(t, uint64(0), b.pending(), "closed")
+
+	var none *mergeBacklog
+	none.add(store.FileInfos{partial(0, 10, 60)})
+	assert.Equal(t, uint64(0), none.pending())
+}
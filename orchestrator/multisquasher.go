@@ -7,6 +7,7 @@ import (
 
 	"go.uber.org/zap"
 
+	"github.com/streamingfast/substreams/block"
 	"github.com/streamingfast/substreams/reqctx"
 	"github.com/streamingfast/substreams/service/config"
 	"github.com/streamingfast/substreams/storage"
@@ -19,6 +20,7 @@ import (
 type MultiSquasher struct {
 	storeSquashers       map[string]squashable
 	targetExclusiveBlock uint64
+	backlog              *mergeBacklog
 }
 
 type squashable interface {
@@ -47,6 +49,15 @@ func NewMultiSquasher(
 	logger := reqctx.Logger(ctx)
 	storeSquashers := map[string]squashable{}
 
+	// Each store squasher runs in its own goroutine, see Launch, merging its
+	// partial stores in order. The merges of different stores run in parallel,
+	// up to MaxConcurrentSquashes.
+	var mergeSlots chan struct{}
+	if runtimeConfig.MaxConcurrentSquashes != 0 {
+		mergeSlots = make(chan struct{}, runtimeConfig.MaxConcurrentSquashes)
+	}
+	backlog := &mergeBacklog{max: runtimeConfig.MaxPendingMergeBytes}
+
 	for storeModuleName, moduleStorageState := range modulesStorageStateMap {
 		switch storageState := moduleStorageState.(type) {
 		case *storeState.StoreStorageState:
@@ -60,6 +71,9 @@ func NewMultiSquasher(
 				return nil, err
 			}
 
+			storeSquasher.mergeSlots = mergeSlots
+			storeSquasher.backlog = backlog
+			storeSquasher.loadParallelism = int(runtimeConfig.SquashLoadParallelism)
 			storeSquashers[storeModuleName] = storeSquasher
 			logger.Debug("store squasher initialized", zap.String("module_name", storeModuleName))
 
@@ -72,6 +86,7 @@ func NewMultiSquasher(
 	return &MultiSquasher{
 		storeSquashers:       storeSquashers,
 		targetExclusiveBlock: upToBlock,
+		backlog:              backlog,
 	}, nil
 }
 
@@ -96,6 +111,9 @@ func buildStoreSquasher(
 			zap.String("store", storeModuleName),
 			zap.String("initial_store_range", "None"),
 		)
+		if err := startingStore.LoadSeed(ctx); err != nil {
+			return nil, err
+		}
 		storeSquasher = NewStoreSquasher(startingStore, upToBlock, startingStore.InitialBlock(), storeSnapshotsSaveInterval, onStoreCompletedUntilBlock)
 	} else {
 		initialRange := storeStorageState.InitialCompleteFile.Range
@@ -116,6 +134,29 @@ func buildStoreSquasher(
 	return storeSquasher, nil
 }
 
+// OnMergeStarted registers `f`, called when a store squasher starts merging a
+// partial store. Must be called before Launch.
+func (s *MultiSquasher) OnMergeStarted(f func(storeName string, partialRange *block.Range)) {
+	for _, squashable := range s.storeSquashers {
+		if storeSquasher, ok := squashable.(*StoreSquasher); ok {
+			storeSquasher.onMergeStarted = f
+		}
+	}
+}
+
+// OnBackpressure registers `f`, called with true when the partial stores not
+// merged yet exceed `RuntimeConfig.MaxPendingMergeBytes`, and with false once the
+// squashers caught up. Must be called before Launch.
+func (s *MultiSquasher) OnBackpressure(f func(engaged bool)) {
+	s.backlog.onBackpressure = f
+}
+
+// PendingMergeBytes is the size of the partial stores received through Squash
+// and not merged and written yet, 0 for the partial stores of unknown size.
+func (s *MultiSquasher) PendingMergeBytes() uint64 {
+	return s.backlog.pending()
+}
+
 func (s *MultiSquasher) Launch(ctx context.Context) {
 	for _, squasher := range s.storeSquashers {
 		go squasher.launch(ctx)
@@ -3,16 +3,25 @@ package orchestrator
 import (
 	"context"
 	"fmt"
+	"time"
+
+	"github.com/streamingfast/dstore"
+	tracing "github.com/streamingfast/sf-tracing"
+	"go.uber.org/zap"
 
 	"github.com/streamingfast/substreams"
 	"github.com/streamingfast/substreams/block"
+	"github.com/streamingfast/substreams/manifest"
+	"github.com/streamingfast/substreams/orchestrator/eventlog"
 	"github.com/streamingfast/substreams/orchestrator/work"
 	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
+	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
 	"github.com/streamingfast/substreams/pipeline/outputmodules"
 	"github.com/streamingfast/substreams/reqctx"
 	"github.com/streamingfast/substreams/service/config"
 	"github.com/streamingfast/substreams/storage"
 	"github.com/streamingfast/substreams/storage/execout"
+	execoutState "github.com/streamingfast/substreams/storage/execout/state"
 	"github.com/streamingfast/substreams/storage/store"
 )
 
@@ -22,6 +31,14 @@ type ParallelProcessor struct {
 	squasher         *MultiSquasher
 	workerPool       work.WorkerPool
 	execOutputReader *execout.LinearReader
+	checkpointer     *work.PlanCheckpointer
+	events           *eventlog.Log
+	eventsStore      dstore.Store
+	traceID          string
+	throughputStats  *work.ThroughputStats
+	moduleHashes     *manifest.ModuleHashes
+	stages           *stagesProgress
+	respFunc         substreams.ResponseFunc
 }
 
 // BuildParallelProcessor is only called on tier1
@@ -35,27 +52,6 @@ func BuildParallelProcessor(
 	storeConfigs store.ConfigMap,
 	pendingUndoMessage *pbsubstreamsrpc.Response,
 ) (*ParallelProcessor, error) {
-	var execOutputReader *execout.LinearReader
-
-	if reqDetails.ShouldStreamCachedOutputs() {
-		// note: since we are *NOT* in a sub-request and are setting up output module is a map
-		requestedModule := outputGraph.OutputModule()
-		if requestedModule.GetKindStore() != nil {
-			panic("logic error: should not get a store as outputModule on tier 1")
-		}
-		firstRange := block.NewBoundedRange(requestedModule.InitialBlock, runtimeConfig.CacheSaveInterval, reqDetails.ResolvedStartBlockNum, reqDetails.LinearHandoffBlockNum)
-		requestedModuleCache := execoutStorage.NewFile(requestedModule.Name, firstRange)
-		execOutputReader = execout.NewLinearReader(
-			reqDetails.ResolvedStartBlockNum,
-			reqDetails.LinearHandoffBlockNum,
-			requestedModule,
-			requestedModuleCache,
-			respFunc,
-			runtimeConfig.CacheSaveInterval,
-			pendingUndoMessage,
-		)
-	}
-
 	// In Dev mode
 	// * The linearHandoff will be set to the startblock (never equal to stopBlock, which is exclusive)
 	// * We will generate stores up to the linearHandoff, even if we end with an incomplete store
@@ -67,30 +63,24 @@ func BuildParallelProcessor(
 	// * If we stop at the linearHandoff, we will only save the stores up to the boundary of the latest complete store.
 	// * On the contrary, if we need to keep going after the linearHandoff, we will need to save the last "incomplete" store.
 
-	stopAtHandoff := reqDetails.LinearHandoffBlockNum == reqDetails.StopBlockNum
+	storeLinearHandoffBlockNum := storeLinearHandoff(reqDetails, runtimeConfig)
 
-	storeLinearHandoffBlockNum := reqDetails.LinearHandoffBlockNum
-	if stopAtHandoff {
-		// we don't need to bring the stores up to handoff block if we stop there
-		storeLinearHandoffBlockNum = lowBoundary(reqDetails.LinearHandoffBlockNum, runtimeConfig.CacheSaveInterval)
-	}
-
-	modulesStateMap, err := storage.BuildModuleStorageStateMap( // ok, I will cut stores up to 800 not 842
-		ctx,
-		storeConfigs,
-		runtimeConfig.CacheSaveInterval,
-		execoutStorage,
-		reqDetails.ResolvedStartBlockNum,
-		reqDetails.LinearHandoffBlockNum,
-		storeLinearHandoffBlockNum,
-	)
+	checkpointer, err := newPlanCheckpointer(runtimeConfig, reqDetails, outputGraph)
 	if err != nil {
-		return nil, fmt.Errorf("build storage map: %w", err)
+		return nil, fmt.Errorf("plan checkpointer: %w", err)
 	}
 
-	plan, err := work.BuildNewPlan(ctx, modulesStateMap, runtimeConfig.SubrequestsSplitSize, reqDetails.LinearHandoffBlockNum, runtimeConfig.MaxJobsAhead, outputGraph)
+	throughputStats, err := newThroughputStats(runtimeConfig)
 	if err != nil {
-		return nil, fmt.Errorf("build work plan: %w", err)
+		return nil, fmt.Errorf("throughput stats: %w", err)
+	}
+
+	plan, err := buildPlan(ctx, reqDetails, runtimeConfig, outputGraph, execoutStorage, storeConfigs, checkpointer, loadThroughput(ctx, throughputStats, outputGraph))
+	if err != nil {
+		return nil, err
+	}
+	if throughputStats != nil {
+		logEstimatedDuration(ctx, plan, reqDetails.MaxParallelJobs)
 	}
 
 	if err := plan.SendInitialProgressMessages(respFunc); err != nil {
@@ -98,6 +88,29 @@ func BuildParallelProcessor(
 	}
 
 	scheduler := NewScheduler(plan, respFunc, reqDetails.Modules)
+	scheduler.checkpointer = checkpointer
+	scheduler.capacity = int(reqDetails.MaxParallelJobs)
+	scheduler.maxWorkers = reqDetails.MaxParallelJobs
+	scheduler.autoscaler = runtimeConfig.WorkerPoolAutoscaler
+	scheduler.discardOutputs = runtimeConfig.DevModeDiscardOutputs && !reqDetails.ProductionMode
+	scheduler.reserveJob = runtimeConfig.ReserveJob
+	if throughputStats != nil {
+		scheduler.throughput = work.NewThroughputRecorder(runtimeConfig.CacheSaveInterval)
+	}
+
+	var events *eventlog.Log
+	var eventsStore dstore.Store
+	if runtimeConfig.SchedulerEventLog {
+		events = eventlog.New()
+		eventsStore, err = runtimeConfig.BaseObjectStore.SubStore("events")
+		if err != nil {
+			return nil, fmt.Errorf("events store: %w", err)
+		}
+	}
+	scheduler.events = events
+	scheduler.stages = newStagesProgress(reqDetails, outputGraph, plan.ModulesStateMap, runtimeConfig.CacheSaveInterval)
+	scheduler.packageStats = runtimeConfig.PackageStats.ForPackage(outputGraph.ModuleHashes().Get(outputGraph.OutputModule().Name), outputGraph.OutputModule().Name, runtimeConfig.CacheSaveInterval)
+	scheduler.packageStats.RecordPlan(plan.BlocksCount())
 	if err != nil {
 		return nil, err
 	}
@@ -108,23 +121,125 @@ func BuildParallelProcessor(
 	}
 
 	scheduler.OnStoreJobTerminated = squasher.Squash
+	squasher.OnMergeStarted(scheduler.OnStoreMergeStarted)
+	squasher.OnBackpressure(scheduler.OnSquashBackpressure)
 
 	runnerPool := work.NewWorkerPool(ctx, reqDetails.MaxParallelJobs, runtimeConfig.WorkerFactory)
 
-	return &ParallelProcessor{
-		plan:             plan,
-		scheduler:        scheduler,
-		squasher:         squasher,
-		workerPool:       runnerPool,
-		execOutputReader: execOutputReader,
-	}, nil
+	processor := &ParallelProcessor{
+		plan:         plan,
+		scheduler:    scheduler,
+		squasher:     squasher,
+		workerPool:   runnerPool,
+		checkpointer: checkpointer,
+		events:       events,
+		eventsStore:  eventsStore,
+		traceID:      tracing.GetTraceID(ctx).String(),
+
+		throughputStats: throughputStats,
+		moduleHashes:    outputGraph.ModuleHashes(),
+		stages:          scheduler.stages,
+		respFunc:        respFunc,
+	}
+
+	if reqDetails.ShouldStreamCachedOutputs() {
+		// note: since we are *NOT* in a sub-request and are setting up output module is a map
+		for i, requestedModule := range outputGraph.OutputModules() {
+			if requestedModule.GetKindStore() != nil {
+				panic("logic error: should not get a store as outputModule on tier 1")
+			}
+			firstRange := block.NewBoundedRange(requestedModule.InitialBlock, runtimeConfig.CacheSaveInterval, reqDetails.ResolvedStartBlockNum, reqDetails.LinearHandoffBlockNum)
+			requestedModuleCache := execoutStorage.NewFile(requestedModule.Name, firstRange)
+			onMissingSegment := processor.missingSegmentHandler(requestedModule.Name, outputGraph.AncestorsFrom(requestedModule.Name), reqDetails.Modules)
+			skipSegment, err := skipSegmentFunc(runtimeConfig, outputGraph, requestedModule)
+			if err != nil {
+				return nil, err
+			}
+
+			if i != 0 {
+				processor.execOutputReader.AddOutputModule(requestedModule, requestedModuleCache, onMissingSegment, skipSegment)
+				continue
+			}
+			processor.execOutputReader = execout.NewLinearReader(
+				reqDetails.ResolvedStartBlockNum,
+				reqDetails.LinearHandoffBlockNum,
+				requestedModule,
+				requestedModuleCache,
+				respFunc,
+				runtimeConfig.CacheSaveInterval,
+				pendingUndoMessage,
+				onMissingSegment,
+			)
+			if skipSegment != nil {
+				processor.execOutputReader.SetSkipSegment(skipSegment)
+			}
+		}
+	}
+
+	return processor, nil
+}
+
+// missingSegmentHandler re-executes only the output module over a segment whose
+// cached outputs were present when the plan was built but cannot be found anymore
+// (garbage collected, for example) or are invalid (truncated by a crash), instead
+// of waiting for it forever or serving it partially. The stores it depends on are
+// still squashed by the plan, so only the map stage runs again.
+func (b *ParallelProcessor) missingSegmentHandler(outputModule string, requiredModules []string, requestModules *pbsubstreams.Modules) execout.MissingSegmentFunc {
+	execOutState, _ := b.plan.ModulesStateMap[outputModule].(*execoutState.ExecOutputStorageState)
+	if execOutState == nil {
+		return nil
+	}
+
+	return func(ctx context.Context, segment *block.Range) (bool, error) {
+		if !execOutState.SegmentsPresent.Contains(segment) {
+			// a scheduled job will produce it
+			return false, nil
+		}
+
+		logger := reqctx.Logger(ctx)
+		logger.Warn("cached outputs segment missing, re-executing output module over it", zap.String("module", outputModule), zap.Stringer("segment", segment))
+
+		job := work.NewJob(outputModule, segment, requiredModules, 0)
+		for !b.plan.DependenciesMet(job) {
+			select {
+			case <-ctx.Done():
+				return false, ctx.Err()
+			case <-time.After(time.Second):
+			}
+		}
+
+		worker := b.workerPool.Borrow(ctx)
+		if worker == nil {
+			return false, ctx.Err()
+		}
+		defer b.workerPool.Return(worker)
+
+		res := b.scheduler.runSingleJob(ctx, worker, job, requestModules)
+		return true, res.err
+	}
 }
 
 func (b *ParallelProcessor) Run(ctx context.Context) (storeMap store.Map, err error) {
+	defer b.flushEvents(ctx)
+
 	if b.execOutputReader != nil {
 		b.execOutputReader.Launch(ctx)
 	}
 	b.squasher.Launch(ctx)
+	defer b.squasher.backlog.close()
+
+	if b.stages != nil {
+		stagesCtx, stopStages := context.WithCancel(ctx)
+		stagesDone := make(chan struct{})
+		go func() {
+			b.stages.stream(stagesCtx, b.respFunc)
+			close(stagesDone)
+		}()
+		defer func() {
+			stopStages()
+			<-stagesDone
+		}()
+	}
 
 	if err := b.scheduler.Schedule(ctx, b.workerPool); err != nil {
 		return nil, fmt.Errorf("scheduler run: %w", err)
@@ -135,6 +250,11 @@ func (b *ParallelProcessor) Run(ctx context.Context) (storeMap store.Map, err er
 		return nil, err
 	}
 
+	if err := b.checkpointer.Delete(ctx); err != nil {
+		reqctx.Logger(ctx).Warn("cannot delete plan checkpoint", zap.Error(err))
+	}
+	b.saveThroughput(ctx)
+
 	if b.execOutputReader != nil {
 		select {
 		case <-b.execOutputReader.Terminated():
@@ -151,6 +271,98 @@ func (b *ParallelProcessor) Run(ctx context.Context) (storeMap store.Map, err er
 	return storeMap, nil
 }
 
+// flushEvents writes the scheduler event log, with its own context as the request's
+// one is usually canceled when processing fails, which is when the log matters most.
+func (b *ParallelProcessor) flushEvents(ctx context.Context) {
+	if b.events == nil {
+		return
+	}
+
+	flushCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	logger := reqctx.Logger(ctx)
+	if err := b.events.Flush(flushCtx, b.eventsStore, b.traceID); err != nil {
+		logger.Warn("cannot write scheduler event log", zap.Error(err))
+		return
+	}
+	logger.Info("scheduler event log written", zap.String("trace_id", b.traceID))
+}
+
+// storeLinearHandoff is the block up to which the stores must be brought by the
+// backprocessing.
+func storeLinearHandoff(reqDetails *reqctx.RequestDetails, runtimeConfig config.RuntimeConfig) uint64 {
+	stopAtHandoff := reqDetails.LinearHandoffBlockNum == reqDetails.StopBlockNum
+	if stopAtHandoff {
+		// we don't need to bring the stores up to handoff block if we stop there
+		return lowBoundary(reqDetails.LinearHandoffBlockNum, runtimeConfig.CacheSaveInterval)
+	}
+	return reqDetails.LinearHandoffBlockNum
+}
+
+// buildPlan resumes the work plan of the request from its checkpoint, or builds
+// it from the stores and execution outputs already cached, sizing the jobs from
+// the measured `throughput` of the modules when adaptive job sizes are enabled.
+func buildPlan(
+	ctx context.Context,
+	reqDetails *reqctx.RequestDetails,
+	runtimeConfig config.RuntimeConfig,
+	outputGraph *outputmodules.Graph,
+	execoutStorage *execout.Configs,
+	storeConfigs store.ConfigMap,
+	checkpointer *work.PlanCheckpointer,
+	throughput map[string]*work.ModuleThroughput,
+) (*work.Plan, error) {
+	pinned := pinnedModules(reqDetails, runtimeConfig, outputGraph, execoutStorage, storeConfigs)
+
+	plan := resumePlan(ctx, checkpointer, storeConfigs)
+	if plan != nil && !pinPlan(plan, pinned, reqctx.Logger(ctx)) {
+		plan = nil
+	}
+	if plan == nil {
+		modulesStateMap, err := storage.BuildModuleStorageStateMap( // ok, I will cut stores up to 800 not 842
+			ctx,
+			storeConfigs,
+			runtimeConfig.CacheSaveInterval,
+			execoutStorage,
+			outputGraph.OutputMapperNames(),
+			reqDetails.ResolvedStartBlockNum,
+			reqDetails.LinearHandoffBlockNum,
+			storeLinearHandoff(reqDetails, runtimeConfig),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("build storage map: %w", err)
+		}
+		// pinned modules are served by their cache, no job is planned for them
+		for name, state := range pinned {
+			modulesStateMap[name] = state
+		}
+		if err := skipFilteredSegments(ctx, runtimeConfig, outputGraph, modulesStateMap); err != nil {
+			return nil, fmt.Errorf("skipping filtered segments: %w", err)
+		}
+
+		splitter := work.NewSplitter(runtimeConfig.SubrequestsSplitSize, runtimeConfig.CacheSaveInterval, runtimeConfig.AdaptiveJobDuration, throughput)
+		plan, err = work.BuildNewPlan(ctx, modulesStateMap, splitter, reqDetails.LinearHandoffBlockNum, runtimeConfig.MaxJobsAhead, outputGraph)
+		if err != nil {
+			return nil, fmt.Errorf("build work plan: %w", err)
+		}
+	}
+
+	if runtimeConfig.JobPriority != nil {
+		plan.Reprioritize(runtimeConfig.JobPriority)
+	}
+	plan.SetMaxConcurrentJobsPerModule(runtimeConfig.MaxConcurrentJobsPerModule)
+	plan.SetThroughput(throughput)
+	if runtimeConfig.StoreJobsProduceOutputs {
+		outputModule := outputGraph.OutputModule().Name
+		if _, ok := plan.ModulesStateMap[outputModule].(*execoutState.ExecOutputStorageState); ok {
+			plan.CarryOutputJobs(outputModule)
+		}
+	}
+
+	return plan, nil
+}
+
 func lowBoundary(blk uint64, bundleSize uint64) uint64 {
 	return blk - (blk % bundleSize)
 }
@@ -0,0 +1,70 @@
+package orchestrator
+
+import (
+	"go.uber.org/zap"
+
+	"github.com/streamingfast/substreams/orchestrator/work"
+	"github.com/streamingfast/substreams/pipeline/outputmodules"
+	"github.com/streamingfast/substreams/reqctx"
+	"github.com/streamingfast/substreams/service/config"
+	"github.com/streamingfast/substreams/storage"
+	"github.com/streamingfast/substreams/storage/execout"
+	"github.com/streamingfast/substreams/storage/store"
+	"github.com/streamingfast/substreams/utils"
+)
+
+// pinnedModules returns the states of the schedulable modules whose hash is
+// pinned to an external cache (see config.RuntimeConfig.PinnedModuleHashes),
+// complete up to the linear handoff.
+func pinnedModules(
+	reqDetails *reqctx.RequestDetails,
+	runtimeConfig config.RuntimeConfig,
+	outputGraph *outputmodules.Graph,
+	execoutStorage *execout.Configs,
+	storeConfigs store.ConfigMap,
+) storage.ModuleStorageStateMap {
+	if len(runtimeConfig.PinnedModuleHashes) == 0 {
+		return nil
+	}
+
+	pinned := map[string]bool{}
+	for _, hash := range runtimeConfig.PinnedModuleHashes {
+		pinned[hash] = true
+	}
+
+	out := storage.ModuleStorageStateMap{}
+	for _, name := range outputGraph.SchedulableModuleNames() {
+		if !pinned[outputGraph.ModuleHashes().Get(name)] {
+			continue
+		}
+
+		if storeConfig, found := storeConfigs[name]; found {
+			out[name] = storage.NewPinnedStorageState(name, storeConfig.ModuleInitialBlock(), storeLinearHandoff(reqDetails, runtimeConfig))
+			continue
+		}
+		// dev mode does not manage mappers states (output caches)
+		if execoutConfig := execoutStorage.ConfigMap[name]; execoutConfig != nil && reqDetails.ProductionMode {
+			out[name] = storage.NewPinnedStorageState(name, utils.MaxOf(execoutConfig.ModuleInitialBlock(), reqDetails.ResolvedStartBlockNum), reqDetails.LinearHandoffBlockNum)
+		}
+	}
+	return out
+}
+
+// pinPlan marks the pinned modules of a resumed plan as complete, the plan
+// checkpoints only recording the state of the modules produced by jobs. Returns
+// false if the plan has jobs for a pinned module (pinned after the checkpoint was
+// taken), in which case it must be planned from scratch.
+func pinPlan(plan *work.Plan, pinned storage.ModuleStorageStateMap, logger *zap.Logger) bool {
+	for _, job := range plan.PendingJobs() {
+		if pinned[job.ModuleName] != nil {
+			logger.Info("plan checkpoint has jobs for a pinned module, planning from scratch", zap.String("module", job.ModuleName))
+			return false
+		}
+	}
+
+	for name, state := range pinned {
+		plan.ModulesStateMap[name] = state
+		plan.MarkDependencyComplete(name, state.ReadyUpToBlock())
+	}
+	return true
+}
@@ -0,0 +1,28 @@
+package orchestrator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/streamingfast/substreams/orchestrator/work"
+	"github.com/streamingfast/substreams/storage"
+)
+
+func Test_pinPlan(t *testing.T) {
+	pinned := storage.ModuleStorageStateMap{
+		"A": storage.NewPinnedStorageState("A", 0, 200),
+	}
+
+	plan := work.TestPlanReadyJobs(
+		work.TestJob("A", "100-200", 2),
+		work.TestJobDeps("B", "0-200", 1, "A"),
+	)
+	assert.False(t, pinPlan(plan, pinned, zap.NewNop()))
+
+	plan = work.TestPlanReadyJobs(
+		work.TestJobDeps("B", "0-200", 1, "A"),
+	)
+	assert.True(t, pinPlan(plan, storage.ModuleStorageStateMap{}, zap.NewNop()))
+}
@@ -0,0 +1,209 @@
+// Package responses shapes the responses sent to the clients of tier1, see
+// Stream.
+package responses
+
+import (
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/streamingfast/substreams"
+	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
+)
+
+// Stream coalesces the modules progress sent to a client, so that it receives
+// at most a given number of progress messages per second however many modules
+// and jobs report their progress.
+//
+// The progress of a module received while a message is pending is merged into
+// the previous one of the same module and kind: the processed ranges and the
+// slow blocks are appended, the processed bytes deltas are summed, the other
+// kinds are replaced by the latest. A module failure is sent immediately,
+// along with the progress pending.
+//
+// The other responses, as well as the stages and queue progress, are sent
+// directly.
+type Stream struct {
+	respFunc substreams.ResponseFunc
+	interval time.Duration
+
+	mu       sync.Mutex
+	pending  []*pbsubstreamsrpc.ModuleProgress
+	indexes  map[progressKey]int
+	lastSent time.Time
+	timer    *time.Timer
+	closed   bool
+	err      error
+}
+
+type progressKey struct {
+	module string
+	kind   string
+}
+
+func NewStream(respFunc substreams.ResponseFunc, messagesPerSecond uint64) *Stream {
+	return &Stream{
+		respFunc: respFunc,
+		interval: time.Second / time.Duration(messagesPerSecond),
+		indexes:  make(map[progressKey]int),
+	}
+}
+
+// Send is a substreams.ResponseFunc. It returns the error of a progress
+// message sent in the background, if any, by the next call.
+func (s *Stream) Send(resp substreams.ResponseFromAnyTier) error {
+	progress := modulesProgress(resp)
+	if progress == nil {
+		return s.respFunc(resp)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	if s.closed {
+		return s.respFunc(resp)
+	}
+
+	failed := false
+	for _, module := range progress.Modules {
+		s.add(module)
+		failed = failed || module.GetFailed() != nil
+	}
+
+	if failed || time.Since(s.lastSent) >= s.interval {
+		return s.flush()
+	}
+	if s.timer == nil {
+		s.timer = time.AfterFunc(s.interval-time.Since(s.lastSent), s.onTimer)
+	}
+	return nil
+}
+
+// Close sends the progress pending. The responses sent afterwards are not
+// coalesced anymore.
+func (s *Stream) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return s.err
+	}
+	s.closed = true
+	if s.err != nil {
+		return s.err
+	}
+	return s.flush()
+}
+
+func (s *Stream) onTimer() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.timer = nil
+	if s.closed || s.err != nil {
+		return
+	}
+	s.flush()
+}
+
+// modulesProgress returns the modules progress carried by `resp`, nil if
+// it is another kind of response.
+func modulesProgress(resp substreams.ResponseFromAnyTier) *pbsubstreamsrpc.ModulesProgress {
+	r, ok := resp.(*pbsubstreamsrpc.Response)
+	if !ok {
+		return nil
+	}
+	progress := r.GetProgress()
+	if progress == nil || progress.Stages != nil || progress.Queue != nil || len(progress.Modules) == 0 {
+		return nil
+	}
+	return progress
+}
+
+func (s *Stream) add(module *pbsubstreamsrpc.ModuleProgress) {
+	key := progressKey{module: module.Name, kind: kind(module)}
+	index, found := s.indexes[key]
+	if !found || key.kind == "failed" {
+		s.indexes[key] = len(s.pending)
+		// the same progress message may be sent to several streams
+		s.pending = append(s.pending, proto.Clone(module).(*pbsubstreamsrpc.ModuleProgress))
+		return
+	}
+
+	merge(s.pending[index], module)
+}
+
+// flush sends the progress pending, in a single message. It is called with
+// the lock held.
+func (s *Stream) flush() error {
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	if len(s.pending) == 0 {
+		return nil
+	}
+
+	modules := s.pending
+	s.pending = nil
+	s.indexes = make(map[progressKey]int)
+	s.lastSent = time.Now()
+
+	s.err = s.respFunc(&pbsubstreamsrpc.Response{
+		Message: &pbsubstreamsrpc.Response_Progress{
+			Progress: &pbsubstreamsrpc.ModulesProgress{Modules: modules},
+		},
+	})
+	return s.err
+}
+
+func kind(module *pbsubstreamsrpc.ModuleProgress) string {
+	switch module.Type.(type) {
+	case *pbsubstreamsrpc.ModuleProgress_ProcessedRanges_:
+		return "processed_ranges"
+	case *pbsubstreamsrpc.ModuleProgress_InitialState_:
+		return "initial_state"
+	case *pbsubstreamsrpc.ModuleProgress_ProcessedBytes_:
+		return "processed_bytes"
+	case *pbsubstreamsrpc.ModuleProgress_Failed_:
+		return "failed"
+	case *pbsubstreamsrpc.ModuleProgress_SlowExecution_:
+		return "slow_execution"
+	case *pbsubstreamsrpc.ModuleProgress_ModuleStats_:
+		return "module_stats"
+	}
+	return ""
+}
+
+// merge merges `next` into `pending`, a progress of the same module and kind.
+func merge(pending, next *pbsubstreamsrpc.ModuleProgress) {
+	switch next := next.Type.(type) {
+	case *pbsubstreamsrpc.ModuleProgress_ProcessedRanges_:
+		ranges := pending.GetProcessedRanges()
+		ranges.ProcessedRanges = append(ranges.ProcessedRanges, cloneRanges(next.ProcessedRanges.ProcessedRanges)...)
+	case *pbsubstreamsrpc.ModuleProgress_ProcessedBytes_:
+		bytes := pending.GetProcessedBytes()
+		bytes.TotalBytesRead = next.ProcessedBytes.TotalBytesRead
+		bytes.TotalBytesWritten = next.ProcessedBytes.TotalBytesWritten
+		bytes.BytesReadDelta += next.ProcessedBytes.BytesReadDelta
+		bytes.BytesWrittenDelta += next.ProcessedBytes.BytesWrittenDelta
+		bytes.NanoSecondsDelta += next.ProcessedBytes.NanoSecondsDelta
+	case *pbsubstreamsrpc.ModuleProgress_SlowExecution_:
+		slow := pending.GetSlowExecution()
+		slow.BudgetMs = next.SlowExecution.BudgetMs
+		for _, block := range next.SlowExecution.Blocks {
+			slow.Blocks = append(slow.Blocks, proto.Clone(block).(*pbsubstreamsrpc.ModuleProgress_SlowBlock))
+		}
+	default:
+		pending.Type = proto.Clone(&pbsubstreamsrpc.ModuleProgress{Type: next}).(*pbsubstreamsrpc.ModuleProgress).Type
+	}
+}
+
+func cloneRanges(ranges []*pbsubstreamsrpc.BlockRange) []*pbsubstreamsrpc.BlockRange {
+	out := make([]*pbsubstreamsrpc.BlockRange, len(ranges))
+	for i, r := range ranges {
+		out[i] = proto.Clone(r).(*pbsubstreamsrpc.BlockRange)
+	}
+	return out
+}
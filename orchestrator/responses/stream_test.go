@@ -0,0 +1,117 @@
+package responses
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/streamingfast/substreams"
+	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
+)
+
+func progress(modules ...*pbsubstreamsrpc.ModuleProgress) *pbsubstreamsrpc.Response {
+	return &pbsubstreamsrpc.Response{
+		Message: &pbsubstreamsrpc.Response_Progress{Progress: &pbsubstreamsrpc.ModulesProgress{Modules: modules}},
+	}
+}
+
+func processedRange(module string, start, end uint64) *pbsubstreamsrpc.ModuleProgress {
+	return &pbsubstreamsrpc.ModuleProgress{
+		Name: module,
+		Type: &pbsubstreamsrpc.ModuleProgress_ProcessedRanges_{ProcessedRanges: &pbsubstreamsrpc.ModuleProgress_ProcessedRanges{
+			ProcessedRanges: []*pbsubstreamsrpc.BlockRange{{StartBlock: start, EndBlock: end}},
+		}},
+	}
+}
+
+func processedBytes(module string, total, delta uint64) *pbsubstreamsrpc.ModuleProgress {
+	return &pbsubstreamsrpc.ModuleProgress{
+		Name: module,
+		Type: &pbsubstreamsrpc.ModuleProgress_ProcessedBytes_{ProcessedBytes: &pbsubstreamsrpc.ModuleProgress_ProcessedBytes{
+			TotalBytesRead: total, BytesReadDelta: delta,
+		}},
+	}
+}
+
+type recorder struct {
+	mu   sync.Mutex
+	sent []*pbsubstreamsrpc.Response
+}
+
+func (r *recorder) send(resp substreams.ResponseFromAnyTier) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sent = append(r.sent, resp.(*pbsubstreamsrpc.Response))
+	return nil
+}
+
+func (r *recorder) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.sent)
+}
+
+func TestStream(t *testing.T) {
+	rec := &recorder{}
+	stream := NewStream(rec.send, 1)
+
+	require.NoError(t, stream.Send(progress(processedRange("map_a", 0, 10))))
+	require.Equal(t, 1, rec.count(), "the first progress is sent immediately")
+
+	shared := progress(processedRange("map_a", 10, 20), processedBytes("map_a", 100, 100))
+	require.NoError(t, stream.Send(shared))
+	require.NoError(t, stream.Send(progress(processedRange("store_b", 0, 10), processedRange("map_a", 20, 30))))
+	require.NoError(t, stream.Send(progress(processedBytes("map_a", 150, 50))))
+
+	data := &pbsubstreamsrpc.Response{Message: &pbsubstreamsrpc.Response_BlockScopedData{}}
+	require.NoError(t, stream.Send(data))
+	require.Equal(t, 2, rec.count(), "the other responses are sent directly")
+
+	require.NoError(t, stream.Close())
+	require.Equal(t, 3, rec.count())
+
+	expected := progress(
+		&pbsubstreamsrpc.ModuleProgress{Name: "map_a", Type: &pbsubstreamsrpc.ModuleProgress_ProcessedRanges_{ProcessedRanges: &pbsubstreamsrpc.ModuleProgress_ProcessedRanges{
+			ProcessedRanges: []*pbsubstreamsrpc.BlockRange{{StartBlock: 10, EndBlock: 20}, {StartBlock: 20, EndBlock: 30}},
+		}}},
+		processedBytes("map_a", 150, 150),
+		processedRange("store_b", 0, 10),
+	)
+	assert.True(t, proto.Equal(expected, rec.sent[2]), "got %s", rec.sent[2])
+	assert.True(t, proto.Equal(progress(processedRange("map_a", 10, 20), processedBytes("map_a", 100, 100)), shared), "the progress sent is not modified")
+}
+
+func TestStream_Interval(t *testing.T) {
+	rec := &recorder{}
+	stream := NewStream(rec.send, 100)
+
+	require.NoError(t, stream.Send(progress(processedRange("map_a", 0, 10))))
+	require.NoError(t, stream.Send(progress(processedRange("map_a", 10, 20))))
+	require.Equal(t, 1, rec.count())
+
+	assert.Eventually(t, func() bool { return rec.count() == 2 }, 5*time.Second, time.Millisecond, "the progress pending is sent after the interval")
+	require.NoError(t, stream.Close())
+	assert.Equal(t, 2, rec.count())
+}
+
+func TestStream_Failed(t *testing.T) {
+	rec := &recorder{}
+	stream := NewStream(rec.send, 1)
+
+	require.NoError(t, stream.Send(progress(processedRange("map_a", 0, 10))))
+	require.NoError(t, stream.Send(progress(processedRange("map_a", 10, 20))))
+	require.NoError(t, stream.Send(progress(&pbsubstreamsrpc.ModuleProgress{
+		Name: "map_a",
+		Type: &pbsubstreamsrpc.ModuleProgress_Failed_{Failed: &pbsubstreamsrpc.ModuleProgress_Failed{Reason: "panic"}},
+	})))
+
+	require.Equal(t, 2, rec.count(), "a failure is sent immediately")
+	modules := rec.sent[1].GetProgress().Modules
+	require.Len(t, modules, 2)
+	assert.NotNil(t, modules[0].GetProcessedRanges())
+	assert.Equal(t, "panic", modules[1].GetFailed().Reason)
+}
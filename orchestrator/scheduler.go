@@ -7,16 +7,54 @@ import (
 	"sync"
 	"time"
 
-	"github.com/streamingfast/derr"
 	"go.uber.org/zap"
 
 	"github.com/streamingfast/substreams"
+	"github.com/streamingfast/substreams/block"
+	"github.com/streamingfast/substreams/metrics"
+	"github.com/streamingfast/substreams/orchestrator/eventlog"
 	"github.com/streamingfast/substreams/orchestrator/work"
+	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
 	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
 	"github.com/streamingfast/substreams/reqctx"
 	"github.com/streamingfast/substreams/storage/store"
 )
 
+// Jobs failing with a retryable error are retried up to jobMaxRetries times,
+// waiting jobRetryInitialBackoff, doubled on every retry up to jobRetryMaxBackoff,
+// unless a module fails jobPoisonThreshold consecutive times with the same
+// error, see work.RetryableErr.ModuleFailure.
+const (
+	jobMaxRetries      = 5
+	jobPoisonThreshold = 3
+)
+
+var (
+	jobRetryInitialBackoff = time.Second
+	jobRetryMaxBackoff     = 30 * time.Second
+)
+
+func jobRetryBackoff(attempt int) time.Duration {
+	backoff := jobRetryInitialBackoff
+	for i := 0; i < attempt && backoff < jobRetryMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > jobRetryMaxBackoff {
+		return jobRetryMaxBackoff
+	}
+	return backoff
+}
+
+// squashBackpressureMaxDelay is the longest a job is held back while the
+// squashers are behind, see OnSquashBackpressure. The dispatch is slowed down,
+// never stopped: the jobs of the segments the squashers wait on may not be
+// dispatched yet.
+var squashBackpressureMaxDelay = 5 * time.Second
+
+// reservedCapacityRatio is the share of the workers reserved to the jobs of
+// modules depending on other modules, see work.Plan.NextDependentJob.
+const reservedCapacityRatio = 0.1
+
 type Scheduler struct {
 	workPlan               *work.Plan
 	submittedJobs          []*work.Job
@@ -25,8 +63,24 @@ type Scheduler struct {
 
 	currentJobsLock sync.Mutex
 	currentJobs     map[string]*work.Job
+	capacity        int // number of workers, 0 if unknown, see reservedCapacityRatio
+
+	autoscaler work.Autoscaler // optional, resizes the worker pool, see monitorDemand
+	maxWorkers uint64
+
+	discardOutputs bool                                   // the jobs discard their execution outputs, see config.RuntimeConfig.DevModeDiscardOutputs
+	reserveJob     func(context.Context, *work.Job) error // optional, see config.RuntimeConfig.ReserveJob
 
 	OnStoreJobTerminated func(ctx context.Context, moduleName string, partialFilesWritten store.FileInfos) error
+
+	checkpointer *work.PlanCheckpointer
+	events       *eventlog.Log
+	throughput   *work.ThroughputRecorder
+	stages       *stagesProgress
+	packageStats *metrics.PackageRecorder
+
+	backpressureLock sync.Mutex
+	backpressure     chan struct{} // closed when the squash backpressure is released, nil when not engaged
 }
 
 func NewScheduler(workPlan *work.Plan, respFunc substreams.ResponseFunc, upstreamRequestModules *pbsubstreams.Modules) *Scheduler {
@@ -41,6 +95,8 @@ func NewScheduler(workPlan *work.Plan, respFunc substreams.ResponseFunc, upstrea
 type jobResult struct {
 	job             *work.Job
 	partialsWritten store.FileInfos
+	bytesWritten    uint64
+	duration        time.Duration // of the successful attempt
 	err             error
 }
 
@@ -48,6 +104,7 @@ func fromWorkResult(job *work.Job, wr *work.Result) jobResult {
 	return jobResult{
 		job:             job,
 		partialsWritten: wr.PartialFilesWritten,
+		bytesWritten:    wr.BytesWritten,
 		err:             wr.Error,
 	}
 }
@@ -59,6 +116,10 @@ func (s *Scheduler) Schedule(ctx context.Context, pool work.WorkerPool) (err err
 	wg := &sync.WaitGroup{}
 	logger.Info("launching scheduler")
 
+	demandCtx, stopDemand := context.WithCancel(ctx)
+	defer stopDemand()
+	go s.monitorDemand(demandCtx, pool)
+
 	go func() {
 		allJobsStarted := false
 		for !allJobsStarted {
@@ -89,6 +150,8 @@ func (s *Scheduler) run(ctx context.Context, wg *sync.WaitGroup, result chan job
 		return true
 	}
 
+	s.waitSquashBackpressure(ctx)
+
 	nextJob := s.getNextJob(ctx)
 	if nextJob == nil {
 		return true
@@ -100,6 +163,10 @@ func (s *Scheduler) run(ctx context.Context, wg *sync.WaitGroup, result chan job
 	reqctx.Logger(ctx).Debug("current running jobs", zap.Strings("jobs", jobsSummary(s.currentJobs)))
 	s.currentJobs[worker.ID()] = nextJob
 	s.currentJobsLock.Unlock()
+	s.stages.update(nextJob.ModuleName, nextJob.RequestRange, pbsubstreamsrpc.SegmentState_SEGMENT_STATE_SCHEDULED)
+	if nextJob.CachedOutputModule != "" {
+		s.stages.update(nextJob.CachedOutputModule, nextJob.RequestRange, pbsubstreamsrpc.SegmentState_SEGMENT_STATE_SCHEDULED)
+	}
 	go func() {
 		jr := s.runSingleJob(ctx, worker, nextJob, s.upstreamRequestModules)
 		select {
@@ -117,12 +184,29 @@ func (s *Scheduler) run(ctx context.Context, wg *sync.WaitGroup, result chan job
 	return false
 }
 
+// inReservedCapacity tells if the worker about to be assigned a job is one of the
+// reserved workers, all the others being busy.
+func (s *Scheduler) inReservedCapacity() bool {
+	s.currentJobsLock.Lock()
+	defer s.currentJobsLock.Unlock()
+
+	reserved := int(float64(s.capacity) * reservedCapacityRatio)
+	if reserved == 0 {
+		return false
+	}
+	return len(s.currentJobs) >= s.capacity-reserved
+}
+
 func (s *Scheduler) getNextJob(ctx context.Context) (nextJob *work.Job) {
 	for {
 		if ctx.Err() != nil {
 			return nil
 		}
-		nextJob, moreJobs := s.workPlan.NextJob()
+		nextJobFunc := s.workPlan.NextJob
+		if s.inReservedCapacity() {
+			nextJobFunc = s.workPlan.NextDependentJob
+		}
+		nextJob, moreJobs := nextJobFunc()
 		if nextJob != nil {
 			return nextJob
 		}
@@ -163,59 +247,166 @@ func (s *Scheduler) processJobResult(ctx context.Context, result jobResult) erro
 	}
 
 	if result.partialsWritten != nil {
+		s.events.Record(eventlog.SquashTriggered, result.job.ModuleName, result.job.RequestRange.StartBlock, result.job.RequestRange.ExclusiveEndBlock, "", nil)
 		// This signals back to the Squasher that it can squash this segment
 		if err := s.OnStoreJobTerminated(ctx, result.job.ModuleName, result.partialsWritten); err != nil {
 			return fmt.Errorf("on job terminated: %w", err)
 		}
 	}
 
+	if result.partialsWritten != nil {
+		s.stages.update(result.job.ModuleName, result.job.RequestRange, pbsubstreamsrpc.SegmentState_SEGMENT_STATE_PARTIAL_PRESENT)
+	} else {
+		s.stages.update(result.job.ModuleName, result.job.RequestRange, pbsubstreamsrpc.SegmentState_SEGMENT_STATE_COMPLETED)
+	}
+	if result.job.CachedOutputModule != "" {
+		s.stages.update(result.job.CachedOutputModule, result.job.RequestRange, pbsubstreamsrpc.SegmentState_SEGMENT_STATE_COMPLETED)
+	}
+	s.throughput.Record(result.job, result.duration, result.bytesWritten)
+	s.packageStats.RecordJob(result.job.RequestRange, result.duration)
+	s.workPlan.MarkJobCompleted(result.job)
+	if err := s.checkpointer.MaybeSave(ctx, s.workPlan); err != nil {
+		reqctx.Logger(ctx).Warn("cannot save plan checkpoint", zap.Error(err))
+	}
+
 	return nil
 }
 
+// OnSquashBackpressure is called when the partial stores not merged yet by the
+// squashers exceed the configured limit (`engaged`), and when they caught up.
+func (s *Scheduler) OnSquashBackpressure(engaged bool) {
+	s.backpressureLock.Lock()
+	defer s.backpressureLock.Unlock()
+
+	if engaged && s.backpressure == nil {
+		s.backpressure = make(chan struct{})
+	}
+	if !engaged && s.backpressure != nil {
+		close(s.backpressure)
+		s.backpressure = nil
+	}
+}
+
+// waitSquashBackpressure holds back the next job while the squash backpressure
+// is engaged, for at most squashBackpressureMaxDelay.
+func (s *Scheduler) waitSquashBackpressure(ctx context.Context) {
+	s.backpressureLock.Lock()
+	released := s.backpressure
+	s.backpressureLock.Unlock()
+	if released == nil {
+		return
+	}
+
+	reqctx.Logger(ctx).Debug("squashers behind, holding back the next job")
+	select {
+	case <-released:
+	case <-ctx.Done():
+	case <-time.After(squashBackpressureMaxDelay):
+	}
+}
+
+// OnStoreMergeStarted is called when the squasher of `storeName` starts merging
+// the partial store of `partialRange`.
+func (s *Scheduler) OnStoreMergeStarted(storeName string, partialRange *block.Range) {
+	s.stages.update(storeName, partialRange, pbsubstreamsrpc.SegmentState_SEGMENT_STATE_MERGING)
+}
+
 // OnStoreCompletedUntilBlock is called to indicate that the given storeName
 // has snapshots at the `storeSaveIntervals` up to `blockNum` here.
 //
 // This should unlock all jobs that were dependent
 func (s *Scheduler) OnStoreCompletedUntilBlock(storeName string, blockNum uint64) {
+	s.events.Record(eventlog.StoreCompleted, storeName, 0, blockNum, "", nil)
+	s.stages.completeUpTo(storeName, blockNum)
 	s.workPlan.MarkDependencyComplete(storeName, blockNum)
 }
 
 func (s *Scheduler) runSingleJob(ctx context.Context, worker work.Worker, job *work.Job, requestModules *pbsubstreams.Modules) jobResult {
 	logger := reqctx.Logger(ctx)
 	request := job.CreateRequest(requestModules)
+	request.DiscardOutputs = s.discardOutputs
+	recordEvent := func(kind eventlog.Kind, err error) {
+		s.events.Record(kind, job.ModuleName, job.RequestRange.StartBlock, job.RequestRange.ExclusiveEndBlock, worker.ID(), err)
+	}
+	recordEvent(eventlog.JobDispatched, nil)
 
-	var workResult *work.Result
+	if s.reserveJob != nil {
+		// once per job, not per attempt: the retries run the same blocks
+		if err := s.reserveJob(ctx, job); err != nil {
+			logger.Info("job not reserved", zap.Object("job", job), zap.Error(err))
+			recordEvent(eventlog.JobFailed, err)
+			return jobResult{job: job, err: err}
+		}
+	}
 
-	err := derr.RetryContext(ctx, 3, func(ctx context.Context) error {
+	var workResult *work.Result
+	var duration time.Duration
+	var err error
+
+	var lastErr string
+	var sameErrCount int
+retries:
+	for attempt := 0; ; attempt++ {
+		start := time.Now()
 		workResult = worker.Work(ctx, request, s.respFunc)
-		err := workResult.Error
+		duration = time.Since(start)
+		err = workResult.Error
 
-		switch err.(type) {
-		case *work.RetryableErr:
-			logger.Debug("worker failed with retryable error", zap.Error(err))
-			return err
+		retryable, ok := err.(*work.RetryableErr)
+		if !ok {
+			break
+		}
+
+		switch {
+		case !retryable.ModuleFailure():
+			lastErr, sameErrCount = "", 0
+		case err.Error() == lastErr:
+			sameErrCount++
 		default:
-			if err != nil {
-				return derr.NewFatalError(err)
+			lastErr, sameErrCount = err.Error(), 1
+		}
+		if sameErrCount >= jobPoisonThreshold {
+			poisoned := work.NewPoisonedJobErr(job, sameErrCount, err)
+			if respErr := s.respFunc(poisoned.Response()); respErr != nil {
+				logger.Warn("cannot send poisoned job progress", zap.Error(respErr))
 			}
-			return nil
+			err = poisoned
+			break
+		}
+		if attempt >= jobMaxRetries {
+			break
 		}
-	})
+
+		backoff := jobRetryBackoff(attempt)
+		logger.Debug("worker failed with retryable error", zap.Error(err), zap.Duration("backoff", backoff))
+		recordEvent(eventlog.JobRetried, err)
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+			break retries
+		case <-time.After(backoff):
+		}
+	}
 	if err != nil {
 		if errors.Is(err, context.Canceled) {
 			logger.Debug("job canceled", zap.Object("job", job), zap.Error(err))
+			recordEvent(eventlog.JobPreempted, err)
 			return jobResult{job: job, err: err}
 		}
 		logger.Info("job failed", zap.Object("job", job), zap.Error(err))
+		recordEvent(eventlog.JobFailed, err)
 		return jobResult{job: job, err: err}
 	}
 
 	if err := ctx.Err(); err != nil {
 		logger.Info("job not completed", zap.Object("job", job), zap.Error(err))
+		recordEvent(eventlog.JobPreempted, err)
 		return jobResult{job: job, err: err}
 	}
 
+	recordEvent(eventlog.JobCompleted, nil)
 	jr := fromWorkResult(job, workResult)
+	jr.duration = duration
 	logger.Info("job completed", zap.Object("job", job), zap.Error(workResult.Error))
 	return jr
 }
@@ -2,6 +2,7 @@ package orchestrator
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sort"
 	"sync"
@@ -13,10 +14,13 @@ import (
 	"github.com/streamingfast/substreams/manifest"
 	"github.com/streamingfast/substreams/orchestrator/work"
 	pbssinternal "github.com/streamingfast/substreams/pb/sf/substreams/intern/v2"
+	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
 	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
 	"github.com/streamingfast/substreams/storage/store"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
 )
 
 type in struct {
@@ -62,7 +66,7 @@ func TestSchedulerInOut(t *testing.T) {
 
 	sort.Sort(accumulatedRanges)
 	assert.Equal(t,
-		block.ParseRanges("0-10,10-20").String(),
+		block.Ranges{block.NewRange(0, 10), block.NewRange(10, 20)}.String(),
 		accumulatedRanges.String(),
 	)
 }
@@ -125,6 +129,137 @@ func TestScheduler_runOne(t *testing.T) {
 	}
 }
 
+func TestScheduler_runSingleJobRetries(t *testing.T) {
+	defer func(initial time.Duration) { jobRetryInitialBackoff = initial }(jobRetryInitialBackoff)
+	jobRetryInitialBackoff = time.Millisecond
+
+	moduleFailure := work.NewRetryableErr(fmt.Errorf("receiving stream resp: %w", substreams.NewStatusError(codes.Internal, &pbsubstreamsrpc.Error{
+		Code:     pbsubstreamsrpc.ErrorCode_ERROR_CODE_INTERNAL,
+		Reason:   "general wasm execution failed",
+		Module:   "A",
+		BlockNum: 12,
+	})))
+
+	tests := []struct {
+		name           string
+		errs           []error
+		expectAttempts int
+		expectPoisoned bool
+		expectErr      bool
+	}{
+		{
+			name:           "transient error",
+			errs:           []error{work.NewRetryableErr(fmt.Errorf("connection reset"))},
+			expectAttempts: 2,
+		},
+		{
+			name: "different errors",
+			errs: []error{
+				work.NewRetryableErr(fmt.Errorf("connection reset")),
+				work.NewRetryableErr(fmt.Errorf("unavailable")),
+				work.NewRetryableErr(fmt.Errorf("connection reset")),
+			},
+			expectAttempts: 4,
+		},
+		{
+			name: "same error",
+			errs: []error{
+				work.NewRetryableErr(fmt.Errorf("connection reset")),
+				work.NewRetryableErr(fmt.Errorf("connection reset")),
+				work.NewRetryableErr(fmt.Errorf("connection reset")),
+			},
+			expectAttempts: 4,
+		},
+		{
+			name:           "same module failure",
+			errs:           []error{moduleFailure, moduleFailure, moduleFailure},
+			expectAttempts: 3,
+			expectPoisoned: true,
+			expectErr:      true,
+		},
+		{
+			name:           "module failure interrupted by transient error",
+			errs:           []error{moduleFailure, moduleFailure, work.NewRetryableErr(fmt.Errorf("connection reset")), moduleFailure},
+			expectAttempts: 5,
+		},
+		{
+			name:           "fatal error",
+			errs:           []error{fmt.Errorf("invalid module")},
+			expectAttempts: 1,
+			expectErr:      true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			attempts := 0
+			worker := work.NewWorkerFactoryFromFunc(func(ctx context.Context, request *pbssinternal.ProcessRangeRequest, respFunc substreams.ResponseFunc) *work.Result {
+				attempts++
+				if attempts <= len(test.errs) {
+					return &work.Result{Error: test.errs[attempts-1]}
+				}
+				return &work.Result{}
+			})
+
+			var failedProgress []*pbsubstreamsrpc.ModuleProgress_Failed
+			reservations := 0
+			s := &Scheduler{
+				reserveJob: func(ctx context.Context, job *work.Job) error {
+					reservations++
+					return nil
+				},
+				respFunc: func(resp substreams.ResponseFromAnyTier) error {
+					for _, module := range resp.(*pbsubstreamsrpc.Response).GetProgress().GetModules() {
+						if failed := module.GetFailed(); failed != nil {
+							failedProgress = append(failedProgress, failed)
+						}
+					}
+					return nil
+				},
+			}
+
+			res := s.runSingleJob(context.Background(), worker, work.TestJob("A", "0-10", 1), nil)
+			assert.Equal(t, test.expectAttempts, attempts)
+			assert.Equal(t, 1, reservations, "reserved once whatever the retries")
+			if test.expectErr {
+				assert.Error(t, res.err)
+			} else {
+				assert.NoError(t, res.err)
+			}
+
+			var poisoned *work.PoisonedJobErr
+			assert.Equal(t, test.expectPoisoned, errors.As(res.err, &poisoned))
+			if test.expectPoisoned {
+				require.Len(t, failedProgress, 1)
+				assert.Equal(t, poisoned.Error(), failedProgress[0].Reason)
+			} else {
+				assert.Empty(t, failedProgress)
+			}
+		})
+	}
+}
+
+func TestScheduler_runSingleJobNotReserved(t *testing.T) {
+	attempts := 0
+	worker := work.NewWorkerFactoryFromFunc(func(ctx context.Context, request *pbssinternal.ProcessRangeRequest, respFunc substreams.ResponseFunc) *work.Result {
+		attempts++
+		return &work.Result{}
+	})
+	reserveErr := fmt.Errorf("over quota")
+	s := &Scheduler{reserveJob: func(ctx context.Context, job *work.Job) error { return reserveErr }}
+
+	res := s.runSingleJob(context.Background(), worker, work.TestJob("A", "0-10", 1), nil)
+	assert.Equal(t, reserveErr, res.err)
+	assert.Equal(t, 0, attempts, "the job not reserved is not run")
+}
+
+func Test_jobRetryBackoff(t *testing.T) {
+	assert.Equal(t, time.Second, jobRetryBackoff(0))
+	assert.Equal(t, 2*time.Second, jobRetryBackoff(1))
+	assert.Equal(t, 16*time.Second, jobRetryBackoff(4))
+	assert.Equal(t, 30*time.Second, jobRetryBackoff(5))
+	assert.Equal(t, 30*time.Second, jobRetryBackoff(50))
+}
+
 func testNoopRunnerPool(parallelism uint64) work.WorkerPool {
 	ctx := context.Background()
 	runnerPool := work.NewWorkerPool(ctx, parallelism,
@@ -136,3 +271,61 @@ func testNoopRunnerPool(parallelism uint64) work.WorkerPool {
 	)
 	return runnerPool
 }
+
+func TestScheduler_monitorDemand(t *testing.T) {
+	pool := work.NewWorkerPool(context.Background(), 4, func(logger *zap.Logger) work.Worker {
+		return work.NewWorkerFactoryFromFunc(func(ctx context.Context, request *pbssinternal.ProcessRangeRequest, respFunc substreams.ResponseFunc) *work.Result {
+			return &work.Result{}
+		})
+	})
+
+	var seen *work.Demand
+	s := &Scheduler{
+		workPlan: work.TestPlanReadyJobs(
+			work.TestJob("A", "0-10", 2),
+			work.TestJob("A", "10-20", 1),
+		),
+		currentJobs: map[string]*work.Job{},
+		capacity:    4,
+		maxWorkers:  4,
+		autoscaler: work.AutoscalerFunc(func(demand *work.Demand) uint64 {
+			seen = demand
+			return uint64(demand.ReadyJobs())
+		}),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s.monitorDemand(ctx, pool)
+
+	require.NotNil(t, seen)
+	assert.Equal(t, []int{2}, seen.ReadyJobsByStage)
+	assert.Equal(t, uint64(4), seen.MaxWorkers)
+	assert.Equal(t, uint64(2), pool.Size())
+	assert.Equal(t, 2, s.capacity)
+}
+
+func TestScheduler_waitSquashBackpressure(t *testing.T) {
+	defer func(delay time.Duration) { squashBackpressureMaxDelay = delay }(squashBackpressureMaxDelay)
+	squashBackpressureMaxDelay = 50 * time.Millisecond
+
+	s := &Scheduler{}
+	ctx := context.Background()
+
+	start := time.Now()
+	s.waitSquashBackpressure(ctx)
+	assert.Less(t, time.Since(start), squashBackpressureMaxDelay, "not engaged")
+
+	s.OnSquashBackpressure(true)
+	start = time.Now()
+	s.waitSquashBackpressure(ctx)
+	assert.GreaterOrEqual(t, time.Since(start), squashBackpressureMaxDelay, "engaged, dispatch only delayed")
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		s.OnSquashBackpressure(false)
+	}()
+	start = time.Now()
+	s.waitSquashBackpressure(ctx)
+	assert.Less(t, time.Since(start), squashBackpressureMaxDelay, "released")
+}
@@ -0,0 +1,213 @@
+package orchestrator
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/streamingfast/substreams"
+	"github.com/streamingfast/substreams/block"
+	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
+	"github.com/streamingfast/substreams/pipeline/outputmodules"
+	"github.com/streamingfast/substreams/reqctx"
+	"github.com/streamingfast/substreams/storage"
+	"github.com/streamingfast/substreams/utils"
+)
+
+// stagesProgressInterval is the minimum interval between two StagesProgress
+// messages, sent only when a segment changed state.
+var stagesProgressInterval = time.Second
+
+// stagesProgress tracks the state of the segments of the scheduled modules and
+// streams them by stage to the clients that negotiated the `stages_progress`
+// capability. A nil *stagesProgress tracks nothing.
+type stagesProgress struct {
+	segmentSize uint64
+	stages      []stageModules
+
+	lock    sync.Mutex
+	modules map[string]*moduleSegments
+	changed bool
+}
+
+type stageModules struct {
+	stage   int
+	modules []string
+}
+
+// moduleSegments are the states of the segments of a module, from the segment
+// of the first block it is planned from.
+type moduleSegments struct {
+	first  uint64 // segment of states[0]
+	states []pbsubstreamsrpc.SegmentState
+}
+
+// newStagesProgress returns the tracker of the modules of `modulesStateMap`,
+// their segments pending except those of their initial progress ranges, or nil
+// if the client did not negotiate the `stages_progress` capability.
+func newStagesProgress(reqDetails *reqctx.RequestDetails, outputGraph *outputmodules.Graph, modulesStateMap storage.ModuleStorageStateMap, segmentSize uint64) *stagesProgress {
+	if !reqDetails.HasCapability(substreams.CapabilityStagesProgress) {
+		return nil
+	}
+
+	p := &stagesProgress{
+		segmentSize: segmentSize,
+		modules:     map[string]*moduleSegments{},
+		changed:     true,
+	}
+
+	for _, state := range modulesStateMap {
+		ranges := append(append(block.Ranges{}, state.InitialProgressRanges()...), state.BatchRequests(segmentSize)...)
+		if len(ranges) == 0 {
+			continue
+		}
+
+		start, end := ranges[0].StartBlock, ranges[0].ExclusiveEndBlock
+		for _, rng := range ranges[1:] {
+			start = utils.MinOf(start, rng.StartBlock)
+			end = utils.MaxOf(end, rng.ExclusiveEndBlock)
+		}
+		segments := &moduleSegments{first: start / segmentSize}
+		segments.states = make([]pbsubstreamsrpc.SegmentState, (end-1)/segmentSize-segments.first+1)
+		p.modules[state.Name()] = segments
+	}
+	for name, state := range modulesStateMap {
+		for _, rng := range state.InitialProgressRanges() {
+			p.set(name, rng, pbsubstreamsrpc.SegmentState_SEGMENT_STATE_COMPLETED)
+		}
+	}
+
+	for i, stage := range outputGraph.StagedUsedModules() {
+		var modules []string
+		for _, module := range stage {
+			if p.modules[module.Name] != nil {
+				modules = append(modules, module.Name)
+			}
+		}
+		if len(modules) != 0 {
+			p.stages = append(p.stages, stageModules{stage: i, modules: modules})
+		}
+	}
+	return p
+}
+
+// update advances the segments of `moduleName` overlapping `rng` to `state`,
+// segments never going back to a previous state.
+func (p *stagesProgress) update(moduleName string, rng *block.Range, state pbsubstreamsrpc.SegmentState) {
+	if p == nil {
+		return
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.set(moduleName, rng, state)
+}
+
+// completeUpTo marks the segments of `moduleName` before `blockNum` completed,
+// `blockNum` being a segment boundary or the block the module is planned up to.
+func (p *stagesProgress) completeUpTo(moduleName string, blockNum uint64) {
+	p.update(moduleName, block.NewRange(0, blockNum), pbsubstreamsrpc.SegmentState_SEGMENT_STATE_COMPLETED)
+}
+
+func (p *stagesProgress) set(moduleName string, rng *block.Range, state pbsubstreamsrpc.SegmentState) {
+	// Called with locked mutex
+	segments := p.modules[moduleName]
+	if segments == nil || rng.IsEmpty() {
+		return
+	}
+
+	for segment := rng.StartBlock / p.segmentSize; segment <= (rng.ExclusiveEndBlock-1)/p.segmentSize; segment++ {
+		if segment < segments.first {
+			continue
+		}
+		i := segment - segments.first
+		if i >= uint64(len(segments.states)) {
+			break
+		}
+		if segments.states[i] < state {
+			segments.states[i] = state
+			p.changed = true
+		}
+	}
+}
+
+// snapshot returns the state of the segments of each stage, or nil if none
+// changed since the last call.
+func (p *stagesProgress) snapshot() *pbsubstreamsrpc.StagesProgress {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if !p.changed {
+		return nil
+	}
+	p.changed = false
+
+	out := &pbsubstreamsrpc.StagesProgress{SegmentSize: p.segmentSize}
+	for _, stage := range p.stages {
+		first, end := uint64(0), uint64(0)
+		for i, name := range stage.modules {
+			segments := p.modules[name]
+			if i == 0 || segments.first < first {
+				first = segments.first
+			}
+			if moduleEnd := segments.first + uint64(len(segments.states)); moduleEnd > end {
+				end = moduleEnd
+			}
+		}
+
+		// The state of a segment is the least advanced of the modules
+		// spanning it.
+		states := make([]pbsubstreamsrpc.SegmentState, end-first)
+		for i := range states {
+			segment := first + uint64(i)
+			states[i] = pbsubstreamsrpc.SegmentState_SEGMENT_STATE_COMPLETED
+			for _, name := range stage.modules {
+				segments := p.modules[name]
+				if segment < segments.first || segment-segments.first >= uint64(len(segments.states)) {
+					continue
+				}
+				if state := segments.states[segment-segments.first]; state < states[i] {
+					states[i] = state
+				}
+			}
+		}
+
+		out.Stages = append(out.Stages, &pbsubstreamsrpc.StageProgress{
+			Stage:        uint32(stage.stage),
+			Modules:      stage.modules,
+			FirstSegment: first,
+			Segments:     states,
+		})
+	}
+	return out
+}
+
+// stream sends the state of the segments through `respFunc` at most every
+// stagesProgressInterval, until `ctx` is done, and a last time then.
+func (p *stagesProgress) stream(ctx context.Context, respFunc substreams.ResponseFunc) {
+	ticker := time.NewTicker(stagesProgressInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			p.send(ctx, respFunc)
+			return
+		case <-ticker.C:
+			p.send(ctx, respFunc)
+		}
+	}
+}
+
+func (p *stagesProgress) send(ctx context.Context, respFunc substreams.ResponseFunc) {
+	progress := p.snapshot()
+	if progress == nil {
+		return
+	}
+
+	if err := respFunc(substreams.NewStagesProgressResponse(progress)); err != nil {
+		reqctx.Logger(ctx).Debug("cannot send stages progress", zap.Error(err))
+	}
+}
@@ -0,0 +1,66 @@
+package orchestrator
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/streamingfast/substreams"
+	"github.com/streamingfast/substreams/block"
+	"github.com/streamingfast/substreams/manifest"
+	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
+	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
+	"github.com/streamingfast/substreams/pipeline/outputmodules"
+	"github.com/streamingfast/substreams/reqctx"
+	"github.com/streamingfast/substreams/storage"
+	"github.com/streamingfast/substreams/storage/store"
+	storeState "github.com/streamingfast/substreams/storage/store/state"
+)
+
+func Test_stagesProgress(t *testing.T) {
+	outputGraph, err := outputmodules.NewOutputModuleGraph("E", false, &pbsubstreams.Modules{Modules: manifest.NewTestModules(), Binaries: []*pbsubstreams.Binary{{}}})
+	require.NoError(t, err)
+
+	modulesStateMap := storage.ModuleStorageStateMap{
+		"As": &storeState.StoreStorageState{ModuleName: "As", PartialsMissing: block.Ranges{block.NewRange(0, 10), block.NewRange(10, 20), block.NewRange(20, 30)}},
+		"E": &storeState.StoreStorageState{
+			ModuleName:          "E",
+			ModuleInitialBlock:  5,
+			InitialCompleteFile: store.NewCompleteFileInfo(5, 10),
+			PartialsMissing:     block.Ranges{block.NewRange(10, 20), block.NewRange(20, 30)},
+		},
+	}
+
+	assert.Nil(t, newStagesProgress(&reqctx.RequestDetails{}, outputGraph, modulesStateMap, 10))
+
+	p := newStagesProgress(&reqctx.RequestDetails{Capabilities: []string{substreams.CapabilityStagesProgress}}, outputGraph, modulesStateMap, 10)
+	assert.Equal(t, map[string]string{"0 As": "...", "2 E": "C.."}, stagesGrid(p.snapshot()))
+	assert.Nil(t, p.snapshot(), "unchanged")
+
+	p.update("As", block.NewRange(0, 20), pbsubstreamsrpc.SegmentState_SEGMENT_STATE_SCHEDULED)
+	p.update("As", block.NewRange(0, 10), pbsubstreamsrpc.SegmentState_SEGMENT_STATE_PARTIAL_PRESENT)
+	assert.Equal(t, map[string]string{"0 As": "PS.", "2 E": "C.."}, stagesGrid(p.snapshot()))
+
+	p.update("As", block.NewRange(0, 10), pbsubstreamsrpc.SegmentState_SEGMENT_STATE_MERGING)
+	p.update("E", block.NewRange(10, 30), pbsubstreamsrpc.SegmentState_SEGMENT_STATE_SCHEDULED)
+	assert.Equal(t, map[string]string{"0 As": "MS.", "2 E": "CSS"}, stagesGrid(p.snapshot()))
+
+	p.completeUpTo("As", 10)
+	p.update("As", block.NewRange(0, 10), pbsubstreamsrpc.SegmentState_SEGMENT_STATE_SCHEDULED)
+	assert.Equal(t, map[string]string{"0 As": "CS.", "2 E": "CSS"}, stagesGrid(p.snapshot()), "segments never go back")
+}
+
+func stagesGrid(progress *pbsubstreamsrpc.StagesProgress) map[string]string {
+	out := map[string]string{}
+	for _, stage := range progress.Stages {
+		var grid []byte
+		for _, state := range stage.Segments {
+			grid = append(grid, ".SPMC"[state])
+		}
+		out[fmt.Sprintf("%d %s", stage.Stage, strings.Join(stage.Modules, ","))] = string(grid)
+	}
+	return out
+}
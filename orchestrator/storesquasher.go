@@ -19,6 +19,7 @@ import (
 
 var SkipFile = errors.New("skip file")
 var PartialsChannelClosed = errors.New("partial chunks done")
+var errSquashStopped = errors.New("squash stopped")
 
 type StoreSquasher struct {
 	*shutter.Shutter
@@ -33,6 +34,11 @@ type StoreSquasher struct {
 	storeSaveInterval            uint64
 
 	onStoreCompletedUntilBlock func(storeName string, blockNum uint64)
+	onMergeStarted             func(storeName string, partialRange *block.Range) // optional
+
+	mergeSlots      chan struct{} // shared by the squashers of a request to bound the partial stores merged at the same time, nil for no limit
+	backlog         *mergeBacklog // shared by the squashers of a request, optional
+	loadParallelism int           // if above 1, partial stores loaded ahead of the one being merged, see store.FullKV.LoadPartials
 }
 
 func NewStoreSquasher(
@@ -83,11 +89,17 @@ func (s *StoreSquasher) squash(ctx context.Context, partialsChunks store.FileInf
 		return fmt.Errorf("partialsChunks is empty for module %q", s.name)
 	}
 
+	// accounted before being sent, the merge may complete before this
+	// function returns
+	s.backlog.add(partialsChunks)
+
 	select {
 	case s.partialsChunks <- partialsChunks:
 	case <-ctx.Done():
+		s.backlog.remove(partialsChunks.Size())
 		return ctx.Err()
 	case <-s.Terminated():
+		s.backlog.remove(partialsChunks.Size())
 		return s.Err()
 	}
 	return nil
@@ -133,6 +145,7 @@ func (s *StoreSquasher) processPartials(ctx context.Context) error {
 		if err := eg.Wait(); err != nil {
 			return fmt.Errorf("waiting: %w", err)
 		}
+		s.backlog.remove(out.squashedBytes)
 
 		totalDuration := time.Since(start)
 		avgDuration := time.Duration(0)
@@ -146,6 +159,7 @@ func (s *StoreSquasher) processPartials(ctx context.Context) error {
 
 type rangeProgress struct {
 	squashCount           uint64
+	squashedBytes         uint64 // size of the partial stores merged
 	lastExclusiveEndBlock uint64
 }
 
@@ -221,31 +235,72 @@ func (s *StoreSquasher) processRanges(ctx context.Context, eg *llerrgroup.Group)
 			return out, nil
 		}
 
+		if ready := s.readyFiles(); s.loadParallelism > 1 && len(ready) > 1 {
+			err := s.store.LoadPartials(ctx, ready, s.loadParallelism, func(squashableFile *store.FileInfo, nextStore *store.PartialKV) error {
+				if eg.Stop() {
+					return errSquashStopped
+				}
+				if err := s.processSquashableFile(ctx, eg, squashableFile, nextStore); err != nil {
+					return fmt.Errorf("process squashable file on range %q: %w", squashableFile.Range.String(), err)
+				}
+				s.squashed(logger, out, squashableFile)
+				return nil
+			})
+			if errors.Is(err, errSquashStopped) {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
 		squashableFile := s.files[0]
-		err := s.processSquashableFile(ctx, eg, squashableFile)
+		err := s.processSquashableFile(ctx, eg, squashableFile, nil)
 		if err == SkipFile {
 			break
 		}
 		if err != nil {
 			return nil, fmt.Errorf("process squashable file on range %q: %w", squashableFile.Range.String(), err)
 		}
-		// This will inform the scheduler that this range has progressed, as it affects jobs dependending on it
-		s.onStoreCompletedUntilBlock(s.name, squashableFile.Range.ExclusiveEndBlock)
+		s.squashed(logger, out, squashableFile)
+	}
+	return out, nil
+}
 
-		out.squashCount++
+// readyFiles returns the files that can be merged right away, contiguous from
+// the next expected start block.
+func (s *StoreSquasher) readyFiles() store.FileInfos {
+	next := s.nextExpectedStartBlock
+	for i, file := range s.files {
+		if file.Range.StartBlock != next {
+			return s.files[:i]
+		}
+		next = file.Range.ExclusiveEndBlock
+	}
+	return s.files
+}
 
-		s.files = s.files[1:]
+// squashed records the merge of `squashableFile`, the first of the files.
+func (s *StoreSquasher) squashed(logger *zap.Logger, out *rangeProgress, squashableFile *store.FileInfo) {
+	// This will inform the scheduler that this range has progressed, as it affects jobs dependending on it
+	s.onStoreCompletedUntilBlock(s.name, squashableFile.Range.ExclusiveEndBlock)
 
-		if squashableFile.Range.ExclusiveEndBlock == s.targetExclusiveEndBlock {
-			s.targetExclusiveEndBlockReach = true
-		}
-		logger.Debug("signaling the jobs planner that we completed", zap.String("module", s.name), zap.String("file", squashableFile.Filename))
-		out.lastExclusiveEndBlock = squashableFile.Range.ExclusiveEndBlock
+	out.squashCount++
+	out.squashedBytes += squashableFile.Size
+
+	s.files = s.files[1:]
+
+	if squashableFile.Range.ExclusiveEndBlock == s.targetExclusiveEndBlock {
+		s.targetExclusiveEndBlockReach = true
 	}
-	return out, nil
+	logger.Debug("signaling the jobs planner that we completed", zap.String("module", s.name), zap.String("file", squashableFile.Filename))
+	out.lastExclusiveEndBlock = squashableFile.Range.ExclusiveEndBlock
 }
 
-func (s *StoreSquasher) processSquashableFile(ctx context.Context, eg *llerrgroup.Group, squashableFile *store.FileInfo) error {
+// processSquashableFile merges `squashableFile` into the store, `nextStore`
+// being its partial store when already loaded, nil to load it here.
+func (s *StoreSquasher) processSquashableFile(ctx context.Context, eg *llerrgroup.Group, squashableFile *store.FileInfo, nextStore *store.PartialKV) error {
 	logger := s.logger(ctx)
 
 	startTime := time.Now()
@@ -265,18 +320,28 @@ func (s *StoreSquasher) processSquashableFile(ctx context.Context, eg *llerrgrou
 		zap.Stringer("squasher", s),
 		zap.String("squashable_file", squashableFile.Filename),
 	)
-
-	nextStore := s.store.DerivePartialStore(squashableFile.Range.StartBlock)
+	if err := s.acquireMergeSlot(ctx); err != nil {
+		return err
+	}
+	if s.onMergeStarted != nil {
+		s.onMergeStarted(s.name, squashableFile.Range)
+	}
 
 	loadTime := time.Now()
-	if err := nextStore.Load(ctx, squashableFile); err != nil {
-		return fmt.Errorf("initializing next partial store %q: %w", s.name, err)
+	if nextStore == nil {
+		nextStore = s.store.DerivePartialStore(squashableFile.Range.StartBlock)
+		if err := nextStore.Load(ctx, squashableFile); err != nil {
+			s.releaseMergeSlot()
+			return fmt.Errorf("initializing next partial store %q: %w", s.name, err)
+		}
 	}
 	loadTimeTook := time.Since(loadTime)
 
 	mergeTime := time.Now()
 	logger.Info("merging next store loaded", zap.Object("store", nextStore))
-	if err := s.store.Merge(nextStore); err != nil {
+	err := s.store.Merge(nextStore)
+	s.releaseMergeSlot()
+	if err != nil {
 		return fmt.Errorf("merging: %w", err)
 	}
 	mergeTimeTook := time.Since(mergeTime)
@@ -284,6 +349,12 @@ func (s *StoreSquasher) processSquashableFile(ctx context.Context, eg *llerrgrou
 	logger.Debug("store merge", zap.Object("store", s.store))
 	s.nextExpectedStartBlock = squashableFile.Range.ExclusiveEndBlock
 
+	if squashableFile.Range.ExclusiveEndBlock%s.storeSaveInterval == 0 {
+		if deleted := s.store.Expire(squashableFile.Range.ExclusiveEndBlock); deleted > 0 {
+			logger.Debug("expired store keys", zap.Int("deleted_count", deleted))
+		}
+	}
+
 	if reqctx.Details(ctx).ProductionMode || squashableFile.Range.ExclusiveEndBlock%s.storeSaveInterval == 0 {
 		logger.Info("deleting store", zap.Stringer("store", nextStore))
 		eg.Go(func() error {
@@ -316,17 +387,29 @@ func (s *StoreSquasher) processSquashableFile(ctx context.Context, eg *llerrgrou
 	return nil
 }
 
+// acquireMergeSlot waits for one of the merge slots shared with the other
+// squashers of the request to be free, if they are bounded.
+func (s *StoreSquasher) acquireMergeSlot(ctx context.Context) error {
+	if s.mergeSlots == nil {
+		return nil
+	}
+
+	select {
+	case s.mergeSlots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *StoreSquasher) releaseMergeSlot() {
+	if s.mergeSlots != nil {
+		<-s.mergeSlots
+	}
+}
+
 func (s *StoreSquasher) shouldSaveFullKV(storeInitialBlock uint64, squashableRange *block.Range) bool {
-	// we check if the squashableRange we just merged into our FullKV store, ends on a storeInterval boundary block
-	// If someone the storeSaveInterval
-
-	// squashable range must end on a store boundary block
-	isSaveIntervalReached := squashableRange.ExclusiveEndBlock%s.storeSaveInterval == 0
-	// we expect the range to be equal to the store save interval, except if the range start block
-	// is the same as the store initial block
-	isFirstKvForModule := isSaveIntervalReached && squashableRange.StartBlock == storeInitialBlock
-	isCompletedKv := isSaveIntervalReached && squashableRange.Len()-s.storeSaveInterval == 0
-	return isFirstKvForModule || isCompletedKv
+	return store.ShouldSaveFullKV(storeInitialBlock, s.storeSaveInterval, squashableRange)
 }
 
 func (s *StoreSquasher) IsEmpty() bool {
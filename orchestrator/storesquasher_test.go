@@ -32,42 +32,42 @@ func TestShouldSaveFullKV(t *testing.T) {
 			name:              "first range",
 			storeSaveInterval: 10,
 			storeInitialBlock: 0,
-			squashableRange:   block.ParseRange("0-10"),
+			squashableRange:   block.NewRange(0, 10),
 			expectValue:       true,
 		},
 		{
 			name:              "first range, doesn't start on store boundary",
 			storeSaveInterval: 10,
 			storeInitialBlock: 5,
-			squashableRange:   block.ParseRange("5-10"),
+			squashableRange:   block.NewRange(5, 10),
 			expectValue:       true,
 		},
 		{
 			name:              "range does not end on boundary",
 			storeSaveInterval: 10,
 			storeInitialBlock: 5,
-			squashableRange:   block.ParseRange("10-15"),
+			squashableRange:   block.NewRange(10, 15),
 			expectValue:       false,
 		},
 		{
 			name:              "range end on store boundary",
 			storeSaveInterval: 10,
 			storeInitialBlock: 0,
-			squashableRange:   block.ParseRange("10-20"),
+			squashableRange:   block.NewRange(10, 20),
 			expectValue:       true,
 		},
 		{
 			name:              "range does not end on store boundary greater",
 			storeSaveInterval: 10,
 			storeInitialBlock: 0,
-			squashableRange:   block.ParseRange("10-45"),
+			squashableRange:   block.NewRange(10, 45),
 			expectValue:       false,
 		},
 		{
 			name:              "range ends on store boundary wih big range",
 			storeSaveInterval: 10,
 			storeInitialBlock: 0,
-			squashableRange:   block.ParseRange("10-50"),
+			squashableRange:   block.NewRange(10, 50),
 			expectValue:       false,
 		},
 	}
@@ -234,7 +234,7 @@ func TestStoreSquasher_processRange(t *testing.T) {
 			ctx := reqctx.WithRequest(context.Background(), &reqctx.RequestDetails{
 				ProductionMode: false,
 			})
-			err := squasher.processSquashableFile(ctx, eg, test.squashableFile)
+			err := squasher.processSquashableFile(ctx, eg, test.squashableFile, nil)
 			require.NoError(t, eg.Wait())
 
 			if test.expectError != nil {
@@ -249,6 +249,34 @@ func TestStoreSquasher_processRange(t *testing.T) {
 	}
 }
 
+func TestStoreSquasher_mergeSlots(t *testing.T) {
+	testStore := dstore.NewMockStore(nil)
+	testStore.OpenObjectFunc = func(ctx context.Context, name string) (out io.ReadCloser, err error) {
+		return newPartialKVContent(t, map[string][]byte{}, &store.FullKV{}), nil
+	}
+	testStore.WriteObjectFunc = func(ctx context.Context, base string, f io.Reader) error { return nil }
+
+	mergeSlots := make(chan struct{}, 1)
+	squasher := &StoreSquasher{
+		store:             newTestStore(t, testStore, 0),
+		storeSaveInterval: 10,
+		mergeSlots:        mergeSlots,
+	}
+	ctx, cancel := context.WithCancel(reqctx.WithRequest(context.Background(), &reqctx.RequestDetails{}))
+
+	eg := llerrgroup.New(250)
+	require.NoError(t, squasher.processSquashableFile(ctx, eg, store.PartialFile("0-10", store.TraceIDParam("testTraceID")), nil))
+	require.NoError(t, eg.Wait())
+	assert.Len(t, mergeSlots, 0, "slot released")
+
+	// another squasher merging
+	mergeSlots <- struct{}{}
+	cancel()
+	err := squasher.processSquashableFile(ctx, eg, store.PartialFile("10-20", store.TraceIDParam("testTraceID")), nil)
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, uint64(10), squasher.nextExpectedStartBlock)
+}
+
 func newTestStore(t *testing.T, testStore dstore.Store, initialBlock uint64) *store.FullKV {
 	c, err := store.NewConfig(
 		"mod",
@@ -0,0 +1,68 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+
+	"github.com/streamingfast/substreams/orchestrator/work"
+	"github.com/streamingfast/substreams/pipeline/outputmodules"
+	"github.com/streamingfast/substreams/reqctx"
+	"github.com/streamingfast/substreams/service/config"
+)
+
+func newThroughputStats(runtimeConfig config.RuntimeConfig) (*work.ThroughputStats, error) {
+	if !runtimeConfig.ThroughputStats {
+		return nil, nil
+	}
+
+	statsStore, err := runtimeConfig.BaseObjectStore.SubStore("stats")
+	if err != nil {
+		return nil, fmt.Errorf("stats store: %w", err)
+	}
+	return work.NewThroughputStats(statsStore), nil
+}
+
+// loadThroughput returns the throughput previously measured for the schedulable
+// modules of the request, by module name, so that the plan starts from the actual
+// cost of the modules.
+func loadThroughput(ctx context.Context, stats *work.ThroughputStats, outputGraph *outputmodules.Graph) map[string]*work.ModuleThroughput {
+	if stats == nil {
+		return nil
+	}
+	logger := reqctx.Logger(ctx)
+
+	moduleHashes := outputGraph.ModuleHashes()
+	throughput := map[string]*work.ModuleThroughput{}
+	for _, name := range outputGraph.SchedulableModuleNames() {
+		moduleThroughput, err := stats.Load(ctx, moduleHashes.Get(name))
+		if err != nil {
+			logger.Warn("cannot load module throughput", zap.String("module", name), zap.Error(err))
+			continue
+		}
+		if moduleThroughput != nil {
+			throughput[name] = moduleThroughput
+		}
+	}
+	return throughput
+}
+
+func logEstimatedDuration(ctx context.Context, plan *work.Plan, parallelJobs uint64) {
+	estimate, complete := plan.EstimatedDuration(parallelJobs)
+	reqctx.Logger(ctx).Info("estimated backprocessing duration from measured throughput", zap.Duration("estimate", estimate), zap.Bool("all_modules_measured", complete))
+}
+
+// saveThroughput persists the throughput measured for the jobs of the request.
+func (b *ParallelProcessor) saveThroughput(ctx context.Context) {
+	if b.throughputStats == nil {
+		return
+	}
+	logger := reqctx.Logger(ctx)
+
+	for name, measured := range b.scheduler.throughput.Measured() {
+		if err := b.throughputStats.Save(ctx, b.moduleHashes.Get(name), measured); err != nil {
+			logger.Warn("cannot save module throughput", zap.String("module", name), zap.Error(err))
+		}
+	}
+}
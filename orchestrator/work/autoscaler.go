@@ -0,0 +1,75 @@
+package work
+
+// Demand is a snapshot of the work of a request, used to size its worker pool.
+// Jobs are grouped by stage, the depth of their module in the dependency chain
+// of the plan: stage 0 modules depend on no other module with jobs, stage 1
+// modules on stage 0 modules, and so on.
+type Demand struct {
+	ReadyJobsByStage []int // jobs ready to run and not dispatched yet, indexed by stage
+	WaitingJobs      int   // jobs waiting on their dependencies
+	RunningJobs      int   // jobs dispatched and not completed yet
+
+	Workers    uint64 // current size of the worker pool
+	MaxWorkers uint64 // maximum size of the worker pool, the parallel jobs allowed to the request
+}
+
+// ReadyJobs is the number of jobs ready to run, all stages included.
+func (d *Demand) ReadyJobs() (out int) {
+	for _, count := range d.ReadyJobsByStage {
+		out += count
+	}
+	return
+}
+
+// Autoscaler sizes the worker pool of a request from its demand, letting
+// operators follow the capacity of the tier2 fleet (ex: shrink the pools while
+// it scales up). The returned worker count is clamped between 1 and
+// `Demand.MaxWorkers`.
+type Autoscaler interface {
+	WorkerCount(demand *Demand) uint64
+}
+
+// AutoscalerFunc is an Autoscaler implemented by a function.
+type AutoscalerFunc func(demand *Demand) uint64
+
+func (f AutoscalerFunc) WorkerCount(demand *Demand) uint64 { return f(demand) }
+
+// Demand returns the jobs of the plan by state, see Demand. The worker pool
+// fields are left to the caller.
+func (p *Plan) Demand() *Demand {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.stages == nil {
+		p.initStages()
+	}
+
+	out := &Demand{
+		WaitingJobs: len(p.waitingJobs),
+	}
+	for _, job := range p.readyJobs {
+		stage := p.stages[job.ModuleName]
+		for len(out.ReadyJobsByStage) <= stage {
+			out.ReadyJobsByStage = append(out.ReadyJobsByStage, 0)
+		}
+		out.ReadyJobsByStage[stage]++
+	}
+	for _, count := range p.runningJobsPerModule {
+		out.RunningJobs += count
+	}
+	return out
+}
+
+func (p *Plan) initStages() {
+	// Called with locked mutex
+	ancestors := map[string][]string{}
+	for _, job := range p.jobs {
+		ancestors[job.ModuleName] = job.requiredModules
+	}
+	ancestorsFrom := func(moduleName string) []string { return ancestors[moduleName] }
+
+	p.stages = make(map[string]int, len(ancestors))
+	for moduleName := range ancestors {
+		p.stages[moduleName] = ancestorsDepth(moduleName, ancestorsFrom) - 1
+	}
+}
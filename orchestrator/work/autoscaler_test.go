@@ -0,0 +1,38 @@
+package work
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestPlan_Demand(t *testing.T) {
+	jobA1 := TestJob("A", "0-10", 6)
+	jobA2 := TestJob("A", "10-20", 5)
+	jobA3 := TestJob("A", "20-30", 4)
+	jobB1 := TestJobDeps("B", "0-10", 3, "A")
+	jobC1 := TestJobDeps("C", "0-10", 2, "B")
+	jobC2 := TestJobDeps("C", "10-20", 1, "B")
+	jobD1 := TestJobDeps("D", "0-10", 1, "A,C")
+	p := &Plan{
+		jobs:                      []*Job{jobA1, jobA2, jobA3, jobB1, jobC1, jobC2, jobD1},
+		readyJobs:                 []*Job{jobA1, jobA2, jobA3, jobB1, jobC1},
+		waitingJobs:               []*Job{jobC2, jobD1},
+		highestModuleRunningBlock: map[string]uint64{},
+		logger:                    zap.NewNop(),
+	}
+
+	demand := p.Demand()
+	assert.Equal(t, []int{3, 1, 1}, demand.ReadyJobsByStage)
+	assert.Equal(t, 5, demand.ReadyJobs())
+	assert.Equal(t, 2, demand.WaitingJobs)
+	assert.Equal(t, 0, demand.RunningJobs)
+
+	job, _ := p.NextJob()
+	assert.Equal(t, jobA1, job)
+	demand = p.Demand()
+	assert.Equal(t, []int{2, 1, 1}, demand.ReadyJobsByStage)
+	assert.Equal(t, 1, demand.RunningJobs)
+	assert.Equal(t, 3, p.stages["D"])
+}
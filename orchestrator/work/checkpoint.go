@@ -0,0 +1,379 @@
+package work
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/streamingfast/dstore"
+	"go.uber.org/zap"
+
+	"github.com/streamingfast/substreams/block"
+	"github.com/streamingfast/substreams/metrics"
+	"github.com/streamingfast/substreams/reqctx"
+	"github.com/streamingfast/substreams/storage"
+	execoutState "github.com/streamingfast/substreams/storage/execout/state"
+	"github.com/streamingfast/substreams/storage/store"
+	storeState "github.com/streamingfast/substreams/storage/store/state"
+)
+
+const planCheckpointVersion = 1
+
+// PlanCheckpoint is the serializable state of a Plan, from which a restarted tier1
+// resumes backprocessing (see ResumePlan) instead of scanning the store state and
+// planning the work from scratch.
+//
+// Only durable progress is recorded: a store is ready up to its last squashed
+// complete snapshot, and a store job is only dropped once its range is squashed.
+// Jobs of mapper modules, whose outputs are written by the worker itself, are
+// dropped when completed.
+type PlanCheckpoint struct {
+	Version int       `json:"version"`
+	SavedAt time.Time `json:"saved_at"`
+
+	UpToBlock          uint64   `json:"up_to_block"`
+	MaxBlocksAhead     uint64   `json:"max_blocks_ahead"`
+	SchedulableModules []string `json:"schedulable_modules"`
+
+	StoreStates   map[string]*storeState.StoreStorageState        `json:"store_states"`
+	ExecOutStates map[string]*execoutState.ExecOutputStorageState `json:"execout_states"`
+
+	Jobs []*JobCheckpoint `json:"jobs"`
+}
+
+type JobCheckpoint struct {
+	ModuleName      string       `json:"module_name"`
+	RequestRange    *block.Range `json:"request_range"`
+	RequiredModules []string     `json:"required_modules"`
+	Priority        int          `json:"priority"`
+}
+
+// Checkpoint returns the current state of the plan, waiting, ready and running
+// jobs included.
+func (p *Plan) Checkpoint() *PlanCheckpoint {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	out := &PlanCheckpoint{
+		Version:            planCheckpointVersion,
+		UpToBlock:          p.upToBlock,
+		MaxBlocksAhead:     p.maxBlocksAhead,
+		SchedulableModules: p.schedulableModules,
+		StoreStates:        map[string]*storeState.StoreStorageState{},
+		ExecOutStates:      map[string]*execoutState.ExecOutputStorageState{},
+	}
+
+	for name, modState := range p.ModulesStateMap {
+		switch s := modState.(type) {
+		case *storeState.StoreStorageState:
+			out.StoreStates[name] = p.storeStateCheckpoint(s)
+		case *execoutState.ExecOutputStorageState:
+			out.ExecOutStates[name] = p.execOutStateCheckpoint(s)
+		}
+	}
+
+	for _, job := range p.jobs {
+		requestRange := job.RequestRange
+		if _, isStore := p.ModulesStateMap[job.ModuleName].(*storeState.StoreStorageState); isStore {
+			readyUpTo := p.modulesReadyUpToBlock[job.ModuleName]
+			if requestRange.ExclusiveEndBlock <= readyUpTo {
+				continue
+			}
+			if requestRange.StartBlock < readyUpTo {
+				requestRange = block.NewRange(readyUpTo, requestRange.ExclusiveEndBlock)
+			}
+		} else if p.completedJobs[job] {
+			continue
+		}
+
+		out.Jobs = append(out.Jobs, &JobCheckpoint{
+			ModuleName:      job.ModuleName,
+			RequestRange:    requestRange,
+			RequiredModules: job.requiredModules,
+			Priority:        job.priority,
+		})
+	}
+
+	return out
+}
+
+func (p *Plan) storeStateCheckpoint(s *storeState.StoreStorageState) *storeState.StoreStorageState {
+	// Called with locked mutex
+	readyUpTo := p.modulesReadyUpToBlock[s.ModuleName]
+	if readyUpTo <= s.ReadyUpToBlock() {
+		return s
+	}
+
+	out := &storeState.StoreStorageState{
+		ModuleName:          s.ModuleName,
+		ModuleInitialBlock:  s.ModuleInitialBlock,
+		InitialCompleteFile: store.NewCompleteFileInfo(s.ModuleInitialBlock, readyUpTo),
+	}
+	for _, partial := range s.PartialsMissing {
+		if partial.StartBlock >= readyUpTo {
+			out.PartialsMissing = append(out.PartialsMissing, partial)
+		}
+	}
+	return out
+}
+
+func (p *Plan) execOutStateCheckpoint(s *execoutState.ExecOutputStorageState) *execoutState.ExecOutputStorageState {
+	// Called with locked mutex
+	out := &execoutState.ExecOutputStorageState{
+		ModuleName:         s.ModuleName,
+		ModuleInitialBlock: s.ModuleInitialBlock,
+		SegmentsPresent:    append(block.Ranges{}, s.SegmentsPresent...),
+	}
+
+	for _, segment := range s.SegmentsMissing {
+		if p.segmentCompleted(s.ModuleName, segment) {
+			out.SegmentsPresent = append(out.SegmentsPresent, segment)
+		} else {
+			out.SegmentsMissing = append(out.SegmentsMissing, segment)
+		}
+	}
+	sort.Sort(out.SegmentsPresent)
+	return out
+}
+
+func (p *Plan) segmentCompleted(moduleName string, segment *block.Range) bool {
+	for job := range p.completedJobs {
+		if job.ModuleName == moduleName && job.RequestRange.StartBlock <= segment.StartBlock && segment.ExclusiveEndBlock <= job.RequestRange.ExclusiveEndBlock {
+			return true
+		}
+	}
+	return false
+}
+
+// ResumePlan rebuilds a Plan from a checkpoint taken by `Plan.Checkpoint`.
+func ResumePlan(ctx context.Context, checkpoint *PlanCheckpoint) (*Plan, error) {
+	if checkpoint.Version != planCheckpointVersion {
+		return nil, fmt.Errorf("unsupported plan checkpoint version %d", checkpoint.Version)
+	}
+
+	plan := &Plan{
+		ModulesStateMap:    storage.ModuleStorageStateMap{},
+		schedulableModules: checkpoint.SchedulableModules,
+		upToBlock:          checkpoint.UpToBlock,
+		maxBlocksAhead:     checkpoint.MaxBlocksAhead,
+		logger:             reqctx.Logger(ctx),
+	}
+	for name, s := range checkpoint.StoreStates {
+		plan.ModulesStateMap[name] = s
+	}
+	for name, s := range checkpoint.ExecOutStates {
+		plan.ModulesStateMap[name] = s
+	}
+	for _, job := range checkpoint.Jobs {
+		if job.RequestRange == nil {
+			return nil, fmt.Errorf("job for module %q has no range", job.ModuleName)
+		}
+		j := NewJob(job.ModuleName, job.RequestRange, job.RequiredModules, job.Priority)
+		plan.jobs = append(plan.jobs, j)
+		plan.waitingJobs = append(plan.waitingJobs, j)
+	}
+
+	plan.initModulesReadyUpToBlock()
+	plan.promoteWaitingJobs()
+	plan.prioritize()
+
+	return plan, nil
+}
+
+// PlanCheckpointer persists the checkpoints of a Plan as a JSON object named
+// `<key>.json` in `store`, see PlanCheckpoint. A nil PlanCheckpointer does nothing.
+type PlanCheckpointer struct {
+	store    dstore.Store
+	key      string
+	interval time.Duration
+	maxAge   time.Duration
+
+	mu       sync.Mutex
+	lastSave time.Time
+	now      func() time.Time
+}
+
+// NewPlanCheckpointer returns a PlanCheckpointer saving checkpoints at most once
+// per `interval` through MaybeSave. The checkpoints saved longer than `maxAge`
+// ago are not resumed from, see Load.
+func NewPlanCheckpointer(store dstore.Store, key string, interval, maxAge time.Duration) *PlanCheckpointer {
+	return &PlanCheckpointer{
+		store:    store,
+		key:      key,
+		interval: interval,
+		maxAge:   maxAge,
+		now:      time.Now,
+	}
+}
+
+func (c *PlanCheckpointer) filename() string {
+	return c.key + ".json"
+}
+
+// Load returns the last checkpoint saved, or nil if there is none or it was
+// saved longer than the maximum age ago, in which case it is deleted.
+func (c *PlanCheckpointer) Load(ctx context.Context) (*PlanCheckpoint, error) {
+	if c == nil {
+		return nil, nil
+	}
+
+	reader, err := c.store.OpenObject(ctx, c.filename())
+	if err != nil {
+		if errors.Is(err, dstore.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("opening plan checkpoint %q: %w", c.filename(), err)
+	}
+	defer reader.Close()
+
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("reading plan checkpoint %q: %w", c.filename(), err)
+	}
+
+	checkpoint := &PlanCheckpoint{}
+	if err := json.Unmarshal(content, checkpoint); err != nil {
+		return nil, fmt.Errorf("decoding plan checkpoint %q: %w", c.filename(), err)
+	}
+	if age := c.now().Sub(checkpoint.SavedAt); age > c.maxAge {
+		reqctx.Logger(ctx).Info("plan checkpoint expired, deleting it", zap.String("key", c.key), zap.Time("saved_at", checkpoint.SavedAt))
+		return nil, c.Delete(ctx)
+	}
+	return checkpoint, nil
+}
+
+// MaybeSave saves a checkpoint of `plan` unless one was saved less than `interval` ago.
+func (c *PlanCheckpointer) MaybeSave(ctx context.Context, plan *Plan) error {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	if time.Since(c.lastSave) < c.interval {
+		c.mu.Unlock()
+		return nil
+	}
+	c.lastSave = time.Now()
+	c.mu.Unlock()
+
+	return c.Save(ctx, plan)
+}
+
+func (c *PlanCheckpointer) Save(ctx context.Context, plan *Plan) error {
+	if c == nil {
+		return nil
+	}
+
+	checkpoint := plan.Checkpoint()
+	checkpoint.SavedAt = c.now()
+	content, err := json.Marshal(checkpoint)
+	if err != nil {
+		return fmt.Errorf("encoding plan checkpoint: %w", err)
+	}
+	if err := c.store.WriteObject(ctx, c.filename(), bytes.NewReader(content)); err != nil {
+		return fmt.Errorf("writing plan checkpoint %q: %w", c.filename(), err)
+	}
+
+	reqctx.Logger(ctx).Debug("plan checkpoint saved", zap.String("key", c.key))
+	return nil
+}
+
+// Delete removes the checkpoint, once the plan is completed.
+func (c *PlanCheckpointer) Delete(ctx context.Context) error {
+	if c == nil {
+		return nil
+	}
+
+	if err := c.store.DeleteObject(ctx, c.filename()); err != nil && !errors.Is(err, dstore.ErrNotFound) {
+		return fmt.Errorf("deleting plan checkpoint %q: %w", c.filename(), err)
+	}
+	return nil
+}
+
+// PlanCheckpointSweeper deletes the plan checkpoints written longer than a
+// maximum age ago, left by the requests that failed or whose client went away
+// before their plan was completed, a completed plan deleting its own.
+type PlanCheckpointSweeper struct {
+	plansStore dstore.Store
+	maxAge     time.Duration
+	interval   time.Duration
+	logger     *zap.Logger
+
+	now func() time.Time
+}
+
+// NewPlanCheckpointSweeper returns a sweeper of the checkpoints of
+// `plansStore`, the store the PlanCheckpointers save into.
+func NewPlanCheckpointSweeper(plansStore dstore.Store, maxAge, interval time.Duration, logger *zap.Logger) *PlanCheckpointSweeper {
+	return &PlanCheckpointSweeper{
+		plansStore: plansStore,
+		maxAge:     maxAge,
+		interval:   interval,
+		logger:     logger.Named("plan_checkpoint_sweeper"),
+		now:        time.Now,
+	}
+}
+
+// Run sweeps the checkpoints every interval, until `ctx` is done.
+func (s *PlanCheckpointSweeper) Run(ctx context.Context) {
+	s.logger.Info("starting plan checkpoint sweeper", zap.Duration("max_age", s.maxAge), zap.Duration("interval", s.interval))
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		deleted, err := s.Sweep(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			metrics.PlanCheckpointSweeperErrors.Inc()
+			s.logger.Warn("sweeping plan checkpoints", zap.Error(err))
+			continue
+		}
+		s.logger.Info("swept plan checkpoints", zap.Int("deleted_count", len(deleted)))
+	}
+}
+
+// Sweep deletes the checkpoints written longer than the maximum age ago,
+// returning their names.
+func (s *PlanCheckpointSweeper) Sweep(ctx context.Context) (deleted []string, err error) {
+	var names []string
+	if err := s.plansStore.Walk(ctx, "", func(filename string) error {
+		names = append(names, filename)
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("listing plan checkpoints: %w", err)
+	}
+
+	for _, name := range names {
+		attrs, err := s.plansStore.ObjectAttributes(ctx, name)
+		if err != nil {
+			if errors.Is(err, dstore.ErrNotFound) {
+				continue
+			}
+			return deleted, fmt.Errorf("reading plan checkpoint %q attributes: %w", name, err)
+		}
+		if s.now().Sub(attrs.LastModified) <= s.maxAge {
+			continue
+		}
+		if err := s.plansStore.DeleteObject(ctx, name); err != nil && !errors.Is(err, dstore.ErrNotFound) {
+			return deleted, fmt.Errorf("deleting plan checkpoint %q: %w", name, err)
+		}
+		metrics.PlanCheckpointsExpired.Inc()
+		deleted = append(deleted, name)
+	}
+	return deleted, nil
+}
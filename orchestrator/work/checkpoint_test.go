@@ -0,0 +1,151 @@
+package work
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/streamingfast/dstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/streamingfast/substreams/block"
+	"github.com/streamingfast/substreams/storage/execout/state"
+	state2 "github.com/streamingfast/substreams/storage/store/state"
+)
+
+func TestPlan_CheckpointResume(t *testing.T) {
+	jobA1 := TestJob("A", "0-20", 2)
+	jobA2 := TestJob("A", "20-40", 1)
+	jobB1 := TestJobDeps("B", "0-20", 1, "A")
+	jobB2 := TestJobDeps("B", "20-40", 0, "A")
+
+	plan := &Plan{
+		ModulesStateMap: TestModStateMap(
+			TestStoreState("A", "0-10,10-20,20-30,30-40"),
+			TestMapState("B", "0-10,10-20,20-30,30-40"),
+		),
+		schedulableModules: []string{"A", "B"},
+		upToBlock:          40,
+		jobs:               []*Job{jobA1, jobA2, jobB1, jobB2},
+		waitingJobs:        []*Job{jobA1, jobA2, jobB1, jobB2},
+		logger:             zap.NewNop(),
+	}
+	plan.initModulesReadyUpToBlock()
+	plan.promoteWaitingJobs()
+	plan.prioritize()
+
+	// A is squashed up to 30, in the middle of jobA2, B's first job completed
+	plan.MarkDependencyComplete("A", 30)
+	plan.MarkJobCompleted(jobB1)
+
+	content, err := json.Marshal(plan.Checkpoint())
+	require.NoError(t, err)
+	checkpoint := &PlanCheckpoint{}
+	require.NoError(t, json.Unmarshal(content, checkpoint))
+
+	storeState := checkpoint.StoreStates["A"]
+	require.NotNil(t, storeState.InitialCompleteFile)
+	assert.Equal(t, block.NewRange(0, 30), storeState.InitialCompleteFile.Range)
+	assert.Equal(t, block.Ranges{block.NewRange(30, 40)}, storeState.PartialsMissing)
+
+	execOutState := checkpoint.ExecOutStates["B"]
+	assert.Equal(t, block.Ranges{block.NewRange(0, 10), block.NewRange(10, 20)}, execOutState.SegmentsPresent)
+	assert.Equal(t, block.Ranges{block.NewRange(20, 30), block.NewRange(30, 40)}, execOutState.SegmentsMissing)
+
+	resumed, err := ResumePlan(context.Background(), checkpoint)
+	require.NoError(t, err)
+
+	assert.IsType(t, &state2.StoreStorageState{}, resumed.ModulesStateMap["A"])
+	assert.IsType(t, &state.ExecOutputStorageState{}, resumed.ModulesStateMap["B"])
+	assert.Equal(t, map[string]uint64{"A": 30, "B": 20}, resumed.modulesReadyUpToBlock)
+	assert.Equal(t, []*Job{
+		TestJob("A", "30-40", 1),
+		TestJobDeps("B", "20-40", 0, "A"),
+	}, resumed.readyJobs)
+	assert.Empty(t, resumed.waitingJobs)
+}
+
+func TestResumePlan_UnsupportedVersion(t *testing.T) {
+	_, err := ResumePlan(context.Background(), &PlanCheckpoint{Version: 0})
+	assert.Error(t, err)
+}
+
+func TestPlanCheckpointer(t *testing.T) {
+	ctx := context.Background()
+	store, err := dstore.NewStore("file://"+t.TempDir(), "", "", false)
+	require.NoError(t, err)
+
+	checkpointer := NewPlanCheckpointer(store, "abc", time.Hour, 24*time.Hour)
+	checkpoint, err := checkpointer.Load(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, checkpoint)
+
+	plan := &Plan{
+		ModulesStateMap:       TestModStateMap(TestStoreState("A", "0-10")),
+		upToBlock:             10,
+		jobs:                  []*Job{TestJob("A", "0-10", 1)},
+		modulesReadyUpToBlock: map[string]uint64{},
+	}
+	require.NoError(t, checkpointer.MaybeSave(ctx, plan))
+
+	plan.jobs = nil
+	require.NoError(t, checkpointer.MaybeSave(ctx, plan)) // throttled
+
+	checkpoint, err = checkpointer.Load(ctx)
+	require.NoError(t, err)
+	require.Len(t, checkpoint.Jobs, 1)
+	assert.Equal(t, uint64(10), checkpoint.UpToBlock)
+
+	require.NoError(t, checkpointer.Delete(ctx))
+	checkpoint, err = checkpointer.Load(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, checkpoint)
+
+	var disabled *PlanCheckpointer
+	require.NoError(t, disabled.MaybeSave(ctx, plan))
+}
+
+func TestPlanCheckpointer_Expired(t *testing.T) {
+	ctx := context.Background()
+	store, err := dstore.NewStore("file://"+t.TempDir(), "", "", false)
+	require.NoError(t, err)
+
+	checkpointer := NewPlanCheckpointer(store, "abc", time.Hour, 24*time.Hour)
+	plan := &Plan{
+		ModulesStateMap:       TestModStateMap(TestStoreState("A", "0-10")),
+		upToBlock:             10,
+		jobs:                  []*Job{TestJob("A", "0-10", 1)},
+		modulesReadyUpToBlock: map[string]uint64{},
+	}
+	require.NoError(t, checkpointer.Save(ctx, plan))
+
+	checkpointer.now = func() time.Time { return time.Now().Add(25 * time.Hour) }
+	checkpoint, err := checkpointer.Load(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, checkpoint, "expired")
+
+	exists, err := store.FileExists(ctx, "abc.json")
+	require.NoError(t, err)
+	assert.False(t, exists, "expired checkpoint deleted")
+}
+
+func TestPlanCheckpointSweeper(t *testing.T) {
+	ctx := context.Background()
+	store, err := dstore.NewStore("file://"+t.TempDir(), "", "", false)
+	require.NoError(t, err)
+	require.NoError(t, store.WriteObject(ctx, "abc.json", strings.NewReader("{}")))
+
+	sweeper := NewPlanCheckpointSweeper(store, 24*time.Hour, time.Hour, zap.NewNop())
+	deleted, err := sweeper.Sweep(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, deleted)
+
+	sweeper.now = func() time.Time { return time.Now().Add(25 * time.Hour) }
+	deleted, err = sweeper.Sweep(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"abc.json"}, deleted)
+}
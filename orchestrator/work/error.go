@@ -1,5 +1,12 @@
 package work
 
+import (
+	"fmt"
+
+	"github.com/streamingfast/substreams"
+	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
+)
+
 type RetryableErr struct {
 	cause error
 }
@@ -13,3 +20,40 @@ func NewRetryableErr(cause error) *RetryableErr {
 func (r *RetryableErr) Error() string {
 	return r.cause.Error()
 }
+
+// ModuleFailure tells if the error is the failure of a module executing a
+// block, reported by tier2 with the module in its details, rather than a
+// transient failure of the worker or of its connection.
+func (r *RetryableErr) ModuleFailure() bool {
+	details := substreams.ErrorDetails(r.cause)
+	return details != nil && details.Module != ""
+}
+
+// PoisonedJobErr is returned for a job whose module failed with the same error
+// on consecutive attempts: the failure is deterministic, retrying cannot fix it.
+type PoisonedJobErr struct {
+	Job      *Job
+	Attempts int
+	cause    error
+}
+
+func NewPoisonedJobErr(job *Job, attempts int, cause error) *PoisonedJobErr {
+	return &PoisonedJobErr{
+		Job:      job,
+		Attempts: attempts,
+		cause:    cause,
+	}
+}
+
+func (p *PoisonedJobErr) Error() string {
+	return fmt.Sprintf("job poisoned, failed %d times with the same error: %s", p.Attempts, p.cause)
+}
+
+func (p *PoisonedJobErr) Unwrap() error {
+	return p.cause
+}
+
+// Response is the progress message surfacing the failure to the client.
+func (p *PoisonedJobErr) Response() *pbsubstreamsrpc.Response {
+	return toRPCFailedProgressResponse(p.Job.ModuleName, p.Error(), nil, false)
+}
@@ -18,6 +18,11 @@ type Job struct {
 	// the order of the job, as a unit of job scheduling, relative to the position in the chain.
 	requiredModules []string // modules that need to be sync'd before this one starts at RequestRange.StartBlockNum}
 	priority        int
+
+	// CachedOutputModule is the map module whose outputs this store job also
+	// produces, in place of the `carried` job of that module, see Plan.CarryOutputJobs.
+	CachedOutputModule string
+	carried            *Job
 }
 
 func NewJob(storeName string, requestRange *block.Range, requiredModules []string, priority int) *Job {
@@ -34,16 +39,24 @@ func NewJob(storeName string, requestRange *block.Range, requiredModules []strin
 	return j
 }
 
+// Priority is the scheduling priority of the job, higher runs first.
+func (j *Job) Priority() int { return j.priority }
+
+// RequiredModules are the modules that must be ready up to the job's start block
+// before it can run.
+func (j *Job) RequiredModules() []string { return j.requiredModules }
+
 func (j *Job) Matches(moduleName string, blockNum uint64) bool {
 	return j.ModuleName == moduleName && j.RequestRange.Contains(blockNum)
 }
 
 func (j *Job) CreateRequest(originalModules *pbsubstreams.Modules) *pbssinternal.ProcessRangeRequest {
 	return &pbssinternal.ProcessRangeRequest{
-		StartBlockNum: j.RequestRange.StartBlock,
-		StopBlockNum:  j.RequestRange.ExclusiveEndBlock,
-		Modules:       originalModules,
-		OutputModule:  j.ModuleName,
+		StartBlockNum:      j.RequestRange.StartBlock,
+		StopBlockNum:       j.RequestRange.ExclusiveEndBlock,
+		Modules:            originalModules,
+		OutputModule:       j.ModuleName,
+		CachedOutputModule: j.CachedOutputModule,
 	}
 }
 
@@ -55,6 +68,9 @@ func (j *Job) MarshalLogObject(enc zapcore.ObjectEncoder) error {
 	enc.AddString("module_name", j.ModuleName)
 	enc.AddUint64("start_block", j.RequestRange.StartBlock)
 	enc.AddUint64("end_block", j.RequestRange.ExclusiveEndBlock)
+	if j.CachedOutputModule != "" {
+		enc.AddString("cached_output_module", j.CachedOutputModule)
+	}
 	//enc.AddArray("deps", j.deps)
 	return nil
 }
@@ -6,6 +6,7 @@ import (
 	"math"
 	"sort"
 	"sync"
+	"time"
 
 	"go.uber.org/zap"
 
@@ -19,34 +20,51 @@ import (
 	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
 )
 
+// handoffBoostSegments is the number of segments before the linear handoff block
+// that are scheduled ahead of all others in the last stage, as soon as their
+// dependencies are met, so that linear processing can start as early as possible
+// instead of waiting for the whole historical range to complete left-to-right.
+const handoffBoostSegments = 1
+
 type Plan struct {
 	ModulesStateMap storage.ModuleStorageStateMap
 
 	maxBlocksAhead uint64
 	upToBlock      uint64
 
+	jobs               []*Job // all the jobs of the plan, see Checkpoint
+	completedJobs      map[*Job]bool
 	waitingJobs        []*Job
+	waitingOn          map[string][]*Job // the waiting jobs by the module they wait on, see promoteJobsWaitingOn
 	readyJobs          []*Job
 	schedulableModules []string
 
 	highestModuleRunningBlock map[string]uint64
 	modulesReadyUpToBlock     map[string]uint64
 
+	maxConcurrentJobsPerModule uint64         // 0 for no limit
+	runningJobsPerModule       map[string]int // jobs dispatched and not completed yet
+
+	throughput map[string]*ModuleThroughput // by module name, see SetThroughput
+	stages     map[string]int               // by module name, see Demand
+
+	carriedOutputModule string // see CarryOutputJobs
+
 	mu     sync.Mutex
 	logger *zap.Logger
 }
 
-func BuildNewPlan(ctx context.Context, modulesStateMap storage.ModuleStorageStateMap, subrequestSplitSize, upToBlock uint64, maxJobsAhead uint64, outputGraph *outputmodules.Graph) (*Plan, error) {
+func BuildNewPlan(ctx context.Context, modulesStateMap storage.ModuleStorageStateMap, splitter *Splitter, upToBlock uint64, maxJobsAhead uint64, outputGraph *outputmodules.Graph) (*Plan, error) {
 	logger := reqctx.Logger(ctx)
 	plan := &Plan{
 		ModulesStateMap:    modulesStateMap,
 		schedulableModules: outputGraph.SchedulableModuleNames(),
 		upToBlock:          upToBlock,
-		maxBlocksAhead:     subrequestSplitSize * (maxJobsAhead + 1),
+		maxBlocksAhead:     splitter.DefaultSize() * (maxJobsAhead + 1),
 		logger:             logger,
 	}
 
-	if err := plan.splitWorkIntoJobs(subrequestSplitSize, outputGraph.OutputModule().Name, outputGraph.AncestorsFrom); err != nil {
+	if err := plan.splitWorkIntoJobs(splitter, outputGraph.IsOutputModule, outputGraph.AncestorsFrom); err != nil {
 		return nil, fmt.Errorf("split to jobs: %w", err)
 	}
 
@@ -57,7 +75,8 @@ func BuildNewPlan(ctx context.Context, modulesStateMap storage.ModuleStorageStat
 	return plan, nil
 }
 
-func (p *Plan) splitWorkIntoJobs(subrequestSplitSize uint64, outputModuleName string, ancestorsFrom func(string) []string) error {
+func (p *Plan) splitWorkIntoJobs(splitter *Splitter, isOutputModule func(string) bool, ancestorsFrom func(string) []string) error {
+	subrequestSplitSize := splitter.DefaultSize()
 
 	stepSize := calculateHighestDependencyDepth(p.schedulableModules, p.ModulesStateMap, ancestorsFrom)
 	highestJobOrdinal := int(p.upToBlock/subrequestSplitSize) * stepSize
@@ -67,15 +86,18 @@ func (p *Plan) splitWorkIntoJobs(subrequestSplitSize uint64, outputModuleName st
 		if modState == nil {
 			continue
 		}
-		requests := modState.BatchRequests(subrequestSplitSize)
+		requests := modState.BatchRequests(splitter.SplitSize(storeName))
 		for _, requestRange := range requests {
 			requiredModules := ancestorsFrom(storeName)
 			dependencyDepth := ancestorsDepth(storeName, ancestorsFrom)
 
 			jobOrdinal := int(requestRange.StartBlock/subrequestSplitSize) * stepSize
 			priority := highestJobOrdinal - jobOrdinal - (dependencyDepth - 1)
-			if storeName == outputModuleName {
-				priority += stepSize // always run our outputModule 1 step ahead of its dependencies, it only needs the previous stores to be completed and should start ahead
+			if isOutputModule(storeName) {
+				priority += stepSize // always run our output modules 1 step ahead of its dependencies, it only needs the previous stores to be completed and should start ahead
+			}
+			if dependencyDepth == stepSize && requestRange.StartBlock+handoffBoostSegments*subrequestSplitSize >= p.upToBlock {
+				priority += highestJobOrdinal + stepSize // run ahead of every other job, see handoffBoostSegments
 			}
 
 			p.logger.Debug("adding job",
@@ -87,6 +109,7 @@ func (p *Plan) splitWorkIntoJobs(subrequestSplitSize uint64, outputModuleName st
 			)
 
 			job := NewJob(storeName, requestRange, requiredModules, priority)
+			p.jobs = append(p.jobs, job)
 			p.waitingJobs = append(p.waitingJobs, job)
 		}
 	}
@@ -141,10 +164,93 @@ func (p *Plan) MarkDependencyComplete(modName string, upToBlock uint64) {
 	defer p.mu.Unlock()
 
 	p.bumpModuleUpToBlock(modName, upToBlock)
-	p.promoteWaitingJobs()
+	p.promoteJobsWaitingOn(modName)
 	p.prioritize()
 }
 
+// MarkJobCompleted records that `job` completed successfully, see Checkpoint,
+// letting another job of its module run, see SetMaxConcurrentJobsPerModule.
+func (p *Plan) MarkJobCompleted(job *Job) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.completedJobs == nil {
+		p.completedJobs = map[*Job]bool{}
+	}
+	p.completedJobs[job] = true
+	if job.carried != nil {
+		p.completedJobs[job.carried] = true
+	}
+
+	if p.runningJobsPerModule[job.ModuleName] > 0 {
+		p.runningJobsPerModule[job.ModuleName]--
+	}
+}
+
+// CarryOutputJobs makes the store jobs produce the outputs of the map
+// `outputModule` over their range when its job over that range is ready, all
+// the stores it needs being complete up to the job's start block. The store job
+// then replaces the one of `outputModule`, instead of executing the same
+// dependencies again in a later job.
+func (p *Plan) CarryOutputJobs(outputModule string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.carriedOutputModule = outputModule
+}
+
+// SetMaxConcurrentJobsPerModule limits the number of jobs of a single module
+// running at the same time, so that heavy modules (ex: huge stores split in
+// many segments) don't occupy all the workers while the jobs of lighter
+// modules wait. 0 means no limit.
+func (p *Plan) SetMaxConcurrentJobsPerModule(max uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.maxConcurrentJobsPerModule = max
+}
+
+// SetThroughput sets the throughput previously measured for the modules of the
+// plan, by module name, see ThroughputStats.
+func (p *Plan) SetThroughput(throughput map[string]*ModuleThroughput) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.throughput = throughput
+}
+
+// EstimatedDuration estimates the time left to run the jobs not dispatched yet
+// over `parallelJobs` workers, from the measured throughput of their modules.
+// `complete` is false when some of those jobs' modules have no measured
+// throughput, in which case they are not part of the estimate.
+func (p *Plan) EstimatedDuration(parallelJobs uint64) (estimate time.Duration, complete bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if parallelJobs == 0 {
+		parallelJobs = 1
+	}
+
+	complete = true
+	var seconds float64
+	for _, jobs := range [][]*Job{p.waitingJobs, p.readyJobs} {
+		for _, job := range jobs {
+			throughput := p.throughput[job.ModuleName]
+			if throughput == nil || throughput.BlocksPerSecond <= 0 {
+				complete = false
+				continue
+			}
+			seconds += float64(job.RequestRange.Len()) / throughput.BlocksPerSecond
+		}
+	}
+	return time.Duration(seconds / float64(parallelJobs) * float64(time.Second)), complete
+}
+
+func (p *Plan) underConcurrencyLimit(job *Job) bool {
+	// Called with locked mutex
+	return p.maxConcurrentJobsPerModule == 0 || uint64(p.runningJobsPerModule[job.ModuleName]) < p.maxConcurrentJobsPerModule
+}
+
 func (p *Plan) bumpModuleUpToBlock(modName string, upToBlock uint64) {
 	// Called with locked mutex
 	current := p.modulesReadyUpToBlock[modName]
@@ -183,26 +289,42 @@ func (p *Plan) highestRunnableStartBlock() (uint64, string) {
 	return lowestModuleHeight + p.maxBlocksAhead, lowestModules
 }
 
-// promoteWaitingJobs moves jobs from waitingJobs to readyJobs
+// promoteWaitingJobs moves jobs from waitingJobs to readyJobs, checking all
+// of them, and indexes the ones still waiting by the module they wait on.
 func (p *Plan) promoteWaitingJobs() {
 	// Called with locked mutex
 
-	//noJobAbove, cause := p.highestRunnableStartBlock()
+	p.waitingOn = map[string][]*Job{}
+	p.promoteJobs(p.waitingJobs)
+}
+
+// promoteJobsWaitingOn moves to readyJobs the jobs waiting on `modName` whose
+// dependencies are now all met, the others waiting on their next dependency
+// not met. Only the jobs waiting on `modName` are checked.
+func (p *Plan) promoteJobsWaitingOn(modName string) {
+	// Called with locked mutex
+
+	if p.waitingOn == nil {
+		p.promoteWaitingJobs()
+		return
+	}
+
+	jobs := p.waitingOn[modName]
+	delete(p.waitingOn, modName)
+	p.promoteJobs(jobs)
+}
+
+func (p *Plan) promoteJobs(jobs []*Job) {
+	// Called with locked mutex
+
 	removeJobs := map[*Job]bool{}
-	//printSkippingLog := true
-	for _, job := range p.waitingJobs {
-		if p.allDependenciesMet(job) {
-			//if job.RequestRange.StartBlock >= noJobAbove {
-			//	if printSkippingLog {
-			//		p.logger.Info("skipping job because above threshold (next messages skipped)", zap.String("job", job.String()), zap.Uint64("no_job_above", noJobAbove), zap.String("modules_causing_restriction", cause))
-			//		printSkippingLog = false
-			//	}
-			//	continue
-			//}
-			// TODO: send a signal here?
-			p.readyJobs = append(p.readyJobs, job)
-			removeJobs[job] = true
+	for _, job := range jobs {
+		if dep := p.unmetDependency(job); dep != "" {
+			p.waitingOn[dep] = append(p.waitingOn[dep], job)
+			continue
 		}
+		p.readyJobs = append(p.readyJobs, job)
+		removeJobs[job] = true
 	}
 	if len(removeJobs) != 0 {
 		var newWaitingJobs []*Job
@@ -215,17 +337,30 @@ func (p *Plan) promoteWaitingJobs() {
 	}
 }
 
+// DependenciesMet tells if all the modules required by `job` are ready up to
+// its start block, it does not affect the jobs already planned.
+func (p *Plan) DependenciesMet(job *Job) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.allDependenciesMet(job)
+}
+
 func (p *Plan) allDependenciesMet(job *Job) bool {
-	// TODO: if we shrink the number of dependent jobs,
-	//  send a signal for the number of waited upon jobs.
+	return p.unmetDependency(job) == ""
+}
+
+// unmetDependency returns the first module required by `job` that is not ready
+// up to its start block, empty if there is none.
+func (p *Plan) unmetDependency(job *Job) string {
 	startBlock := job.RequestRange.StartBlock
 	for _, dep := range job.requiredModules {
 		depUpTo, ok := p.modulesReadyUpToBlock[dep]
 		if !ok || depUpTo < startBlock {
-			return false
+			return dep
 		}
 	}
-	return true
+	return ""
 }
 
 func (p *Plan) prioritize() {
@@ -236,6 +371,38 @@ func (p *Plan) prioritize() {
 	})
 }
 
+// Reprioritize replaces the priority of every job not yet dispatched by the one
+// returned by `priority`, higher priorities being dispatched first. This lets
+// operators replace the default priority, based on the block position and the
+// dependency depth of the jobs (ex: to favor shallow modules, or the segments
+// closest to the requested start block).
+func (p *Plan) Reprioritize(priority func(*Job) int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, job := range p.waitingJobs {
+		job.priority = priority(job)
+	}
+	for _, job := range p.readyJobs {
+		job.priority = priority(job)
+	}
+	p.prioritize()
+}
+
+// PendingJobs returns the jobs not dispatched yet, highest priority first, the
+// jobs ready to run before the ones waiting on their dependencies at equal
+// priority.
+func (p *Plan) PendingJobs() []*Job {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	out := append(append([]*Job{}, p.readyJobs...), p.waitingJobs...)
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].priority > out[j].priority
+	})
+	return out
+}
+
 func (p *Plan) NextJob() (job *Job, more bool) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
@@ -246,17 +413,113 @@ func (p *Plan) NextJob() (job *Job, more bool) {
 		return
 	}
 
-	job = p.readyJobs[0]
-	p.readyJobs = p.readyJobs[1:]
+	for i, readyJob := range p.readyJobs {
+		if p.underConcurrencyLimit(readyJob) {
+			return p.takeReadyJob(i), p.hasMore()
+		}
+	}
+	p.logger.Debug("all ready jobs are of modules at their concurrency limit", zap.Uint64("max_concurrent_jobs_per_module", p.maxConcurrentJobsPerModule))
+	return nil, p.hasMore()
+}
+
+// NextDependentJob is like NextJob, but only returns the jobs of modules that depend
+// on other modules, which become ready when a segment they wait on completes. Jobs
+// without dependencies are only returned once no job is waiting on dependencies
+// anymore. It is used for the workers reserved to dispatch those jobs immediately,
+// instead of behind a long queue of jobs without dependencies.
+func (p *Plan) NextDependentJob() (job *Job, more bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i, readyJob := range p.readyJobs {
+		if len(readyJob.requiredModules) != 0 && p.underConcurrencyLimit(readyJob) {
+			return p.takeReadyJob(i), p.hasMore()
+		}
+	}
+	if len(p.waitingJobs) == 0 {
+		for i, readyJob := range p.readyJobs {
+			if p.underConcurrencyLimit(readyJob) {
+				return p.takeReadyJob(i), p.hasMore()
+			}
+		}
+	}
+	return nil, p.hasMore()
+}
+
+func (p *Plan) takeReadyJob(i int) *Job {
+	// Called with locked mutex
+	job := p.readyJobs[i]
+	p.readyJobs = append(p.readyJobs[:i], p.readyJobs[i+1:]...)
+	if p.carriedOutputModule != "" {
+		job = p.carryOutputJob(job)
+	}
 
 	p.highestModuleRunningBlock[job.ModuleName] = job.RequestRange.ExclusiveEndBlock
-	return job, p.hasMore()
+	if p.runningJobsPerModule == nil {
+		p.runningJobsPerModule = map[string]int{}
+	}
+	p.runningJobsPerModule[job.ModuleName]++
+	return job
+}
+
+// carryOutputJob pairs `job` with a ready job over the same range, one being a
+// job of the carried output module and the other a job of one of the stores it
+// requires. The store job is returned carrying the output module job, which is
+// removed from the plan, see CarryOutputJobs. `job` is returned as is when
+// there is no such pair.
+func (p *Plan) carryOutputJob(job *Job) *Job {
+	// Called with locked mutex
+	for i, readyJob := range p.readyJobs {
+		storeJob, outputJob := readyJob, job
+		if job.ModuleName != p.carriedOutputModule {
+			storeJob, outputJob = job, readyJob
+		}
+		if outputJob.ModuleName != p.carriedOutputModule ||
+			storeJob.ModuleName == p.carriedOutputModule ||
+			!outputJob.RequestRange.Equals(storeJob.RequestRange) ||
+			!requiresModule(outputJob, storeJob.ModuleName) ||
+			!p.underConcurrencyLimit(storeJob) {
+			continue
+		}
+		p.readyJobs = append(p.readyJobs[:i], p.readyJobs[i+1:]...)
+		p.highestModuleRunningBlock[outputJob.ModuleName] = outputJob.RequestRange.ExclusiveEndBlock
+
+		storeJob.CachedOutputModule = outputJob.ModuleName
+		storeJob.carried = outputJob
+		p.logger.Debug("store job carrying output module job", zap.Object("job", storeJob))
+		return storeJob
+	}
+	return job
+}
+
+func requiresModule(job *Job, moduleName string) bool {
+	for _, required := range job.requiredModules {
+		if required == moduleName {
+			return true
+		}
+	}
+	return false
 }
 
 func (p *Plan) hasMore() bool {
 	return len(p.readyJobs)+len(p.waitingJobs) > 0
 }
 
+// BlocksCount returns the blocks of the modules of the plan already
+// processed when it was built, read from the caches, and the ones processed by
+// its jobs.
+func (p *Plan) BlocksCount() (cachedBlocks, jobBlocks uint64) {
+	for _, modState := range p.ModulesStateMap {
+		for _, rng := range modState.InitialProgressRanges() {
+			cachedBlocks += rng.Len()
+		}
+	}
+	for _, job := range p.jobs {
+		jobBlocks += job.RequestRange.Len()
+	}
+	return
+}
+
 func (p *Plan) SendInitialProgressMessages(respFunc substreams.ResponseFunc) error {
 	progressMessages := p.initialProgressMessages()
 	if err := respFunc(substreams.NewModulesProgressResponse(progressMessages)); err != nil {
@@ -61,6 +61,21 @@ func TestWorkPlanning(t *testing.T) {
 				TestJob("As", "50-60", 3),
 			},
 		},
+		{
+			name:        "segment closest to handoff boosted",
+			upToBlock:   60,
+			subreqSplit: 20,
+			state: TestModStateMap(
+				TestStoreState("As", "0-10,10-20,30-40,40-50,50-60"),
+			),
+			productionMode: false,
+			outMod:         "As",
+			expectReadyJobs: []*Job{
+				TestJob("As", "50-60", 6),
+				TestJob("As", "0-20", 4),
+				TestJob("As", "30-50", 3),
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -69,7 +84,7 @@ func TestWorkPlanning(t *testing.T) {
 			outputGraph, err := outputmodules.NewOutputModuleGraph(test.outMod, test.productionMode, &pbsubstreams.Modules{Modules: mods, Binaries: []*pbsubstreams.Binary{{}}})
 			require.NoError(t, err)
 
-			plan, err := BuildNewPlan(context.Background(), test.state, uint64(test.subreqSplit), test.upToBlock, 0, outputGraph)
+			plan, err := BuildNewPlan(context.Background(), test.state, FixedSplitter(uint64(test.subreqSplit)), test.upToBlock, 0, outputGraph)
 			require.NoError(t, err)
 
 			assert.Equal(t, jobList(test.expectWaitingJobs), jobList(plan.waitingJobs), "waiting jobs") // these are not sorted by the engine
@@ -199,6 +214,113 @@ func TestPlan_NextJob(t *testing.T) {
 	}
 }
 
+func TestPlan_NextDependentJob(t *testing.T) {
+	tests := []struct {
+		name        string
+		waitingJobs []*Job
+		readyJobs   []*Job
+		expectJob   *Job
+		expectMore  bool
+	}{
+		{
+			name:        "dependent job behind independent ones",
+			waitingJobs: []*Job{TestJobDeps("C", "100-200", 1, "A")},
+			readyJobs:   []*Job{TestJob("A", "100-200", 2), TestJobDeps("B", "0-100", 1, "A")},
+			expectJob:   TestJobDeps("B", "0-100", 1, "A"),
+			expectMore:  true,
+		},
+		{
+			name:        "only independent jobs ready, some waiting",
+			waitingJobs: []*Job{TestJobDeps("B", "0-100", 1, "A")},
+			readyJobs:   []*Job{TestJob("A", "100-200", 2)},
+			expectJob:   nil,
+			expectMore:  true,
+		},
+		{
+			name:       "only independent jobs ready, none waiting",
+			readyJobs:  []*Job{TestJob("A", "100-200", 2), TestJob("C", "0-100", 1)},
+			expectJob:  TestJob("A", "100-200", 2),
+			expectMore: true,
+		},
+		{
+			name:       "nothing left",
+			expectJob:  nil,
+			expectMore: false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := &Plan{
+				waitingJobs:               test.waitingJobs,
+				readyJobs:                 test.readyJobs,
+				highestModuleRunningBlock: map[string]uint64{},
+				logger:                    zap.NewNop(),
+			}
+
+			gotJob, gotMore := p.NextDependentJob()
+
+			assert.Equalf(t, test.expectJob, gotJob, "NextDependentJob()")
+			assert.Equalf(t, test.expectMore, gotMore, "NextDependentJob()")
+			if gotJob != nil {
+				assert.NotContains(t, p.readyJobs, gotJob)
+			}
+		})
+	}
+}
+
+func TestPlan_MaxConcurrentJobsPerModule(t *testing.T) {
+	jobA1 := TestJob("A", "0-10", 3)
+	jobA2 := TestJob("A", "10-20", 2)
+	jobB1 := TestJob("B", "0-10", 1)
+	p := &Plan{
+		readyJobs:                 []*Job{jobA1, jobA2, jobB1},
+		highestModuleRunningBlock: map[string]uint64{},
+		logger:                    zap.NewNop(),
+	}
+	p.SetMaxConcurrentJobsPerModule(1)
+
+	job, _ := p.NextJob()
+	assert.Equal(t, jobA1, job)
+	job, _ = p.NextJob()
+	assert.Equal(t, jobB1, job, "A is at its limit")
+	job, more := p.NextJob()
+	assert.Nil(t, job)
+	assert.True(t, more)
+
+	p.MarkJobCompleted(jobA1)
+	job, more = p.NextJob()
+	assert.Equal(t, jobA2, job)
+	assert.False(t, more)
+}
+
+func TestPlan_CarryOutputJobs(t *testing.T) {
+	outputJob1 := TestJobDeps("M", "0-10", 5, "A")
+	outputJob2 := TestJobDeps("M", "10-20", 4, "A")
+	storeJob1 := TestJob("A", "0-10", 3)
+	storeJob2 := TestJob("B", "10-20", 2)
+	storeJob3 := TestJob("A", "10-20", 1)
+	p := TestPlanReadyJobs(outputJob1, outputJob2, storeJob1, storeJob2, storeJob3)
+	p.CarryOutputJobs("M")
+
+	job, _ := p.NextJob()
+	assert.Equal(t, storeJob1, job, "dispatched in place of the output job")
+	assert.Equal(t, "M", job.CachedOutputModule)
+	assert.Equal(t, "M", job.CreateRequest(nil).CachedOutputModule)
+
+	job, _ = p.NextJob()
+	assert.Equal(t, storeJob3, job, "B is not required by M")
+	assert.Equal(t, "M", job.CachedOutputModule)
+
+	job, more := p.NextJob()
+	assert.Equal(t, storeJob2, job)
+	assert.Equal(t, "", job.CachedOutputModule)
+	assert.False(t, more)
+
+	p.MarkJobCompleted(storeJob1)
+	assert.True(t, p.completedJobs[outputJob1])
+	assert.False(t, p.completedJobs[outputJob2])
+}
+
 func TestPlan_allDependenciesMet(t *testing.T) {
 	type fields struct {
 		modulesReadyUpToBlock map[string]uint64
@@ -325,6 +447,27 @@ func TestPlan_prioritize(t *testing.T) {
 	}
 }
 
+func TestPlan_Reprioritize(t *testing.T) {
+	shallowFirst := func(job *Job) int { return -len(job.RequiredModules()) }
+
+	p := &Plan{
+		readyJobs: []*Job{
+			TestJobDeps("C", "0-10", 3, "A,B"),
+			TestJob("A", "0-10", 1),
+		},
+		waitingJobs: []*Job{
+			TestJobDeps("B", "10-20", 2, "A"),
+		},
+	}
+	p.Reprioritize(shallowFirst)
+
+	assert.Equal(t, []*Job{
+		TestJob("A", "0-10", 0),
+		TestJobDeps("C", "0-10", -2, "A,B"),
+	}, p.readyJobs)
+	assert.Equal(t, -1, p.waitingJobs[0].Priority())
+}
+
 func TestPlan_initModulesReadyUpToBlock(t *testing.T) {
 	type fields struct {
 		ModulesStateMap       storage.ModuleStorageStateMap
@@ -543,6 +686,27 @@ func TestPlan_promoteWaitingJobs(t *testing.T) {
 	}
 }
 
+func TestPlan_MarkDependencyComplete_WaitingOn(t *testing.T) {
+	jobC := TestJobDeps("C", "100-200", 2, "A,B")
+	jobD := TestJobDeps("D", "100-200", 1, "B")
+	p := &Plan{
+		waitingJobs:           []*Job{jobC, jobD},
+		modulesReadyUpToBlock: map[string]uint64{"A": 0, "B": 0},
+		logger:                zap.NewNop(),
+	}
+	p.promoteWaitingJobs()
+	assert.Equal(t, map[string][]*Job{"A": {jobC}, "B": {jobD}}, p.waitingOn)
+
+	p.MarkDependencyComplete("A", 100)
+	assert.Empty(t, p.readyJobs)
+	assert.Equal(t, map[string][]*Job{"B": {jobD, jobC}}, p.waitingOn, "C now waits on B")
+
+	p.MarkDependencyComplete("B", 100)
+	assert.Equal(t, []*Job{jobC, jobD}, p.readyJobs)
+	assert.Empty(t, p.waitingJobs)
+	assert.Empty(t, p.waitingOn)
+}
+
 func TestPlan_splitWorkIntoJobs(t *testing.T) {
 	t.Skip("not implemented")
 	type fields struct {
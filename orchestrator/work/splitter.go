@@ -0,0 +1,59 @@
+package work
+
+import "time"
+
+// splitMaxFactor caps the size of the jobs of cheap modules, relative to the
+// default size, so that a single job doesn't cover most of the range.
+const splitMaxFactor = 4
+
+// Splitter sizes the jobs of each module. With a target job duration, the size
+// follows the throughput measured for the module (see ThroughputStats) so that
+// its jobs take about that duration: smaller jobs for slow modules, which would
+// otherwise hold the modules depending on them, and larger jobs for cheap ones,
+// saving the per-job overhead. Sizes are multiples of the segment size, up to
+// `splitMaxFactor` times the default size. Modules without measured throughput
+// use the default size.
+type Splitter struct {
+	defaultSize       uint64
+	segmentSize       uint64
+	targetJobDuration time.Duration
+	throughput        map[string]*ModuleThroughput // by module name
+}
+
+func NewSplitter(defaultSize, segmentSize uint64, targetJobDuration time.Duration, throughput map[string]*ModuleThroughput) *Splitter {
+	return &Splitter{
+		defaultSize:       defaultSize,
+		segmentSize:       segmentSize,
+		targetJobDuration: targetJobDuration,
+		throughput:        throughput,
+	}
+}
+
+// FixedSplitter sizes the jobs of all modules to `size` blocks.
+func FixedSplitter(size uint64) *Splitter {
+	return NewSplitter(size, size, 0, nil)
+}
+
+// DefaultSize is the size of the jobs of the modules without measured throughput,
+// the unit in which the position of the jobs in the chain is counted to prioritize them.
+func (s *Splitter) DefaultSize() uint64 {
+	return s.defaultSize
+}
+
+// SplitSize returns the number of blocks of the jobs of `moduleName`.
+func (s *Splitter) SplitSize(moduleName string) uint64 {
+	throughput := s.throughput[moduleName]
+	if s.targetJobDuration <= 0 || throughput == nil || throughput.BlocksPerSecond <= 0 || s.segmentSize == 0 {
+		return s.defaultSize
+	}
+
+	size := uint64(throughput.BlocksPerSecond * s.targetJobDuration.Seconds())
+	size -= size % s.segmentSize
+	if size < s.segmentSize {
+		size = s.segmentSize
+	}
+	if max := s.defaultSize * splitMaxFactor; size > max {
+		size = max - max%s.segmentSize
+	}
+	return size
+}
@@ -0,0 +1,38 @@
+package work
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitter_SplitSize(t *testing.T) {
+	throughput := map[string]*ModuleThroughput{
+		"slow":    {BlocksPerSecond: 5},
+		"average": {BlocksPerSecond: 83},
+		"cheap":   {BlocksPerSecond: 10_000},
+		"unknown": {BlocksPerSecond: 0},
+	}
+
+	tests := []struct {
+		name              string
+		targetJobDuration time.Duration
+		module            string
+		expect            uint64
+	}{
+		{"disabled", 0, "slow", 10_000},
+		{"not measured", time.Minute, "other", 10_000},
+		{"no throughput", time.Minute, "unknown", 10_000},
+		{"slow module gets a single segment", time.Minute, "slow", 1_000},
+		{"rounded down to segments", 2 * time.Minute, "average", 9_000},
+		{"cheap module capped", time.Minute, "cheap", 40_000},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			splitter := NewSplitter(10_000, 1_000, test.targetJobDuration, throughput)
+			assert.Equal(t, test.expect, splitter.SplitSize(test.module))
+		})
+	}
+}
@@ -13,8 +13,26 @@ import (
 	"github.com/streamingfast/substreams/storage"
 )
 
+// testRange parses `rng`, panicking on errors, the test helpers being called
+// with literal ranges.
+func testRange(rng string) *block.Range {
+	r, err := block.NewRangeFromString(rng)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+func testRanges(rng string) block.Ranges {
+	r, err := block.NewRangesFromString(rng)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
 func TestJob(modName string, rng string, prio int) *Job {
-	return NewJob(modName, block.ParseRange(rng), nil, prio)
+	return NewJob(modName, testRange(rng), nil, prio)
 }
 
 func TestPlanReadyJobs(jobs ...*Job) *Plan {
@@ -26,15 +44,15 @@ func TestPlanReadyJobs(jobs ...*Job) *Plan {
 }
 
 func TestJobDeps(modName string, rng string, prio int, deps string) *Job {
-	return NewJob(modName, block.ParseRange(rng), strings.Split(deps, ","), prio)
+	return NewJob(modName, testRange(rng), strings.Split(deps, ","), prio)
 }
 
 func TestStoreState(modName string, rng string) storage.ModuleStorageState {
-	return &state2.StoreStorageState{ModuleName: modName, PartialsMissing: block.ParseRanges(rng)}
+	return &state2.StoreStorageState{ModuleName: modName, PartialsMissing: testRanges(rng)}
 }
 
 func TestMapState(modName string, rng string) storage.ModuleStorageState {
-	return &state.ExecOutputStorageState{ModuleName: modName, SegmentsMissing: block.ParseRanges(rng)}
+	return &state.ExecOutputStorageState{ModuleName: modName, SegmentsMissing: testRanges(rng)}
 }
 
 func TestModStateMap(modStates ...storage.ModuleStorageState) (out storage.ModuleStorageStateMap) {
@@ -0,0 +1,178 @@
+package work
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/streamingfast/dstore"
+)
+
+// throughputMaxJobs caps the weight of the previous measures when merging new
+// ones, so that the throughput follows the changes of a module's cost (ex: the
+// chain getting busier) instead of being frozen by its history.
+const throughputMaxJobs = 100
+
+// ModuleThroughput is the throughput measured for the backprocessing jobs of a module.
+type ModuleThroughput struct {
+	BlocksPerSecond float64 `json:"blocks_per_second"`
+	BytesPerSegment uint64  `json:"bytes_per_segment"` // bytes written by tier2 per segment of the module
+	Jobs            uint64  `json:"jobs"`              // number of jobs measured, capped to throughputMaxJobs
+}
+
+func (t *ModuleThroughput) merge(other *ModuleThroughput) {
+	prevWeight := t.Jobs
+	if prevWeight > throughputMaxJobs {
+		prevWeight = throughputMaxJobs
+	}
+	total := float64(prevWeight + other.Jobs)
+	if total == 0 {
+		return
+	}
+
+	t.BlocksPerSecond = (t.BlocksPerSecond*float64(prevWeight) + other.BlocksPerSecond*float64(other.Jobs)) / total
+	t.BytesPerSegment = uint64((float64(t.BytesPerSegment)*float64(prevWeight) + float64(other.BytesPerSegment)*float64(other.Jobs)) / total)
+	t.Jobs = prevWeight + other.Jobs
+	if t.Jobs > throughputMaxJobs {
+		t.Jobs = throughputMaxJobs
+	}
+}
+
+// ThroughputRecorder accumulates the throughput of the jobs of a request, see
+// ThroughputStats. A nil ThroughputRecorder records nothing.
+type ThroughputRecorder struct {
+	mu          sync.Mutex
+	segmentSize uint64
+	modules     map[string]*measure
+}
+
+type measure struct {
+	blocks       uint64
+	duration     time.Duration
+	bytesWritten uint64
+	jobs         uint64
+}
+
+func NewThroughputRecorder(segmentSize uint64) *ThroughputRecorder {
+	return &ThroughputRecorder{
+		segmentSize: segmentSize,
+		modules:     map[string]*measure{},
+	}
+}
+
+// Record adds the measure of a completed job, `bytesWritten` being the bytes its
+// tier2 reported writing.
+func (r *ThroughputRecorder) Record(job *Job, duration time.Duration, bytesWritten uint64) {
+	if r == nil || duration <= 0 {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	m := r.modules[job.ModuleName]
+	if m == nil {
+		m = &measure{}
+		r.modules[job.ModuleName] = m
+	}
+	m.blocks += job.RequestRange.Len()
+	m.duration += duration
+	m.bytesWritten += bytesWritten
+	m.jobs++
+}
+
+// Measured returns the throughput of each module recorded so far, by module name.
+func (r *ThroughputRecorder) Measured() map[string]*ModuleThroughput {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	out := make(map[string]*ModuleThroughput, len(r.modules))
+	for name, m := range r.modules {
+		throughput := &ModuleThroughput{
+			BlocksPerSecond: float64(m.blocks) / m.duration.Seconds(),
+			Jobs:            m.jobs,
+		}
+		if segments := m.blocks / r.segmentSize; segments != 0 {
+			throughput.BytesPerSegment = m.bytesWritten / segments
+		}
+		out[name] = throughput
+	}
+	return out
+}
+
+// ThroughputStats persists the throughput measured for the modules, keyed by
+// module hash, so that the plans of the following requests start from the
+// measured throughput instead of nothing. A nil ThroughputStats loads and saves
+// nothing.
+type ThroughputStats struct {
+	store dstore.Store
+}
+
+func NewThroughputStats(store dstore.Store) *ThroughputStats {
+	return &ThroughputStats{store: store}
+}
+
+func throughputFilename(moduleHash string) string {
+	return moduleHash + ".json"
+}
+
+// Load returns the throughput persisted for `moduleHash`, or nil if none was.
+func (s *ThroughputStats) Load(ctx context.Context, moduleHash string) (*ModuleThroughput, error) {
+	if s == nil {
+		return nil, nil
+	}
+
+	reader, err := s.store.OpenObject(ctx, throughputFilename(moduleHash))
+	if err != nil {
+		if errors.Is(err, dstore.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("opening throughput stats %q: %w", throughputFilename(moduleHash), err)
+	}
+	defer reader.Close()
+
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("reading throughput stats %q: %w", throughputFilename(moduleHash), err)
+	}
+
+	out := &ModuleThroughput{}
+	if err := json.Unmarshal(content, out); err != nil {
+		return nil, fmt.Errorf("decoding throughput stats %q: %w", throughputFilename(moduleHash), err)
+	}
+	return out, nil
+}
+
+// Save merges `measured` into the throughput persisted for `moduleHash`.
+func (s *ThroughputStats) Save(ctx context.Context, moduleHash string, measured *ModuleThroughput) error {
+	if s == nil {
+		return nil
+	}
+
+	throughput, err := s.Load(ctx, moduleHash)
+	if err != nil {
+		return err
+	}
+	if throughput == nil {
+		throughput = &ModuleThroughput{}
+	}
+	throughput.merge(measured)
+
+	content, err := json.Marshal(throughput)
+	if err != nil {
+		return fmt.Errorf("encoding throughput stats: %w", err)
+	}
+	if err := s.store.WriteObject(ctx, throughputFilename(moduleHash), bytes.NewReader(content)); err != nil {
+		return fmt.Errorf("writing throughput stats %q: %w", throughputFilename(moduleHash), err)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package work
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/streamingfast/dstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestThroughputRecorder(t *testing.T) {
+	recorder := NewThroughputRecorder(10)
+	recorder.Record(TestJob("A", "0-100", 1), 10*time.Second, 1000)
+	recorder.Record(TestJob("A", "100-200", 1), 30*time.Second, 3000)
+	recorder.Record(TestJob("B", "0-100", 1), 0, 1000) // not measured
+
+	assert.Equal(t, map[string]*ModuleThroughput{
+		"A": {BlocksPerSecond: 5, BytesPerSegment: 200, Jobs: 2},
+	}, recorder.Measured())
+
+	var disabled *ThroughputRecorder
+	disabled.Record(TestJob("A", "0-100", 1), time.Second, 0)
+	assert.Nil(t, disabled.Measured())
+}
+
+func TestThroughputStats(t *testing.T) {
+	ctx := context.Background()
+	store, err := dstore.NewStore("file://"+t.TempDir(), "", "", false)
+	require.NoError(t, err)
+	stats := NewThroughputStats(store)
+
+	throughput, err := stats.Load(ctx, "abc")
+	require.NoError(t, err)
+	assert.Nil(t, throughput)
+
+	require.NoError(t, stats.Save(ctx, "abc", &ModuleThroughput{BlocksPerSecond: 10, BytesPerSegment: 100, Jobs: 1}))
+	require.NoError(t, stats.Save(ctx, "abc", &ModuleThroughput{BlocksPerSecond: 40, BytesPerSegment: 400, Jobs: 2}))
+
+	throughput, err = stats.Load(ctx, "abc")
+	require.NoError(t, err)
+	assert.Equal(t, &ModuleThroughput{BlocksPerSecond: 30, BytesPerSegment: 300, Jobs: 3}, throughput)
+}
+
+func TestModuleThroughput_mergeCapsHistory(t *testing.T) {
+	throughput := &ModuleThroughput{BlocksPerSecond: 10, Jobs: 1000}
+	throughput.merge(&ModuleThroughput{BlocksPerSecond: 110, Jobs: 100})
+
+	assert.Equal(t, 60.0, throughput.BlocksPerSecond)
+	assert.Equal(t, uint64(throughputMaxJobs), throughput.Jobs)
+}
+
+func TestPlan_EstimatedDuration(t *testing.T) {
+	p := &Plan{
+		waitingJobs: []*Job{TestJobDeps("B", "0-100", 1, "A")},
+		readyJobs:   []*Job{TestJob("A", "0-100", 2), TestJob("A", "100-200", 2)},
+	}
+
+	p.SetThroughput(map[string]*ModuleThroughput{"A": {BlocksPerSecond: 10}})
+	estimate, complete := p.EstimatedDuration(2)
+	assert.Equal(t, 10*time.Second, estimate)
+	assert.False(t, complete)
+
+	p.SetThroughput(map[string]*ModuleThroughput{"A": {BlocksPerSecond: 10}, "B": {BlocksPerSecond: 5}})
+	estimate, complete = p.EstimatedDuration(2)
+	assert.Equal(t, 20*time.Second, estimate)
+	assert.True(t, complete)
+}
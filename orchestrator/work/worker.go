@@ -5,9 +5,11 @@ import (
 	"fmt"
 	"io"
 	"sync/atomic"
+	"time"
 
 	"github.com/streamingfast/substreams"
 	"github.com/streamingfast/substreams/client"
+	"github.com/streamingfast/substreams/metrics"
 	pbssinternal "github.com/streamingfast/substreams/pb/sf/substreams/intern/v2"
 	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
 	"github.com/streamingfast/substreams/reqctx"
@@ -25,6 +27,7 @@ var lastWorkerID uint64
 
 type Result struct {
 	PartialFilesWritten store.FileInfos
+	BytesWritten        uint64 // as last reported by the tier2
 	Error               error
 }
 
@@ -140,6 +143,7 @@ func (w *RemoteWorker) Work(ctx context.Context, request *pbssinternal.ProcessRa
 
 	span.SetAttributes(attribute.String("substreams.remote_hostname", remoteHostname))
 
+	var bytesWritten uint64
 	for {
 		resp, err := stream.Recv()
 
@@ -168,15 +172,53 @@ func (w *RemoteWorker) Work(ctx context.Context, request *pbssinternal.ProcessRa
 				}
 
 			case *pbssinternal.ProcessRangeResponse_ProcessedBytes:
-				/// ignore
+				bytesWritten = r.ProcessedBytes.TotalBytesWritten
+
+			case *pbssinternal.ProcessRangeResponse_SlowExecution:
+				if !reqctx.Details(ctx).HasCapability(substreams.CapabilitySlowExecutionProgress) {
+					continue
+				}
+				if err := respFunc(toRPCSlowExecutionResponse(resp.ModuleName, r.SlowExecution)); err != nil {
+					if ctx.Err() != nil {
+						return &Result{
+							Error: ctx.Err(),
+						}
+					}
+					span.SetStatus(codes.Error, err.Error())
+					return &Result{
+						Error: NewRetryableErr(fmt.Errorf("sending slow execution progress: %w", err)),
+					}
+				}
+
+			case *pbssinternal.ProcessRangeResponse_ModuleStats:
+				reqctx.ModuleMeter(ctx).Add(metrics.ModuleUsage{
+					Module:             resp.ModuleName,
+					WasmExecution:      time.Duration(r.ModuleStats.WasmExecutionNs),
+					StoreOperations:    r.ModuleStats.StoreOperations,
+					StorePeakSizeBytes: r.ModuleStats.StorePeakSizeBytes,
+				})
 
 			case *pbssinternal.ProcessRangeResponse_Failed:
-				// FIXME(abourget): we do NOT emit those Failed objects anymore. There was a flow
-				// for that that would pick up the errors, and pack the remaining logs
-				// and reasons into a message. This is nowhere to be found now.
+				// Only emitted for the modules stopped by an execution limit, the other
+				// failures end the stream with an error.
 				forwardResponse := toRPCFailedProgressResponse(resp.ModuleName, r.Failed.Reason, r.Failed.Logs, r.Failed.LogsTruncated)
+				if limit := r.Failed.LimitExceeded; limit != nil {
+					forwardResponse.GetProgress().Modules[0].GetFailed().LimitExceeded = &pbsubstreamsrpc.ModuleProgress_LimitExceeded{
+						Limit:    pbsubstreamsrpc.ModuleProgress_ExecutionLimit(limit.Limit),
+						Budget:   limit.Budget,
+						BlockNum: limit.BlockNum,
+					}
+				}
 				respFunc(forwardResponse)
 				err := fmt.Errorf("module %s failed on host: %s", resp.ModuleName, r.Failed.Reason)
+				if limit := r.Failed.LimitExceeded; limit != nil {
+					err = substreams.NewStatusError(grpcCodes.InvalidArgument, &pbsubstreamsrpc.Error{
+						Code:     pbsubstreamsrpc.ErrorCode_ERROR_CODE_LIMIT_EXCEEDED,
+						Reason:   err.Error(),
+						Module:   resp.ModuleName,
+						BlockNum: limit.BlockNum,
+					})
+				}
 				span.SetStatus(codes.Error, err.Error())
 				return &Result{
 					Error: err,
@@ -186,6 +228,7 @@ func (w *RemoteWorker) Work(ctx context.Context, request *pbssinternal.ProcessRa
 				logger.Info("worker done")
 				return &Result{
 					PartialFilesWritten: toRPCPartialFiles(r.Completed),
+					BytesWritten:        bytesWritten,
 				}
 			}
 		}
@@ -233,6 +276,33 @@ func toRPCFailedProgressResponse(moduleName, reason string, logs []string, logsT
 	}
 }
 
+func toRPCSlowExecutionResponse(moduleName string, slow *pbssinternal.SlowExecution) *pbsubstreamsrpc.Response {
+	blocks := make([]*pbsubstreamsrpc.ModuleProgress_SlowBlock, len(slow.Blocks))
+	for i, block := range slow.Blocks {
+		blocks[i] = &pbsubstreamsrpc.ModuleProgress_SlowBlock{
+			BlockNum:   block.BlockNum,
+			DurationMs: block.DurationMs,
+		}
+	}
+	return &pbsubstreamsrpc.Response{
+		Message: &pbsubstreamsrpc.Response_Progress{
+			Progress: &pbsubstreamsrpc.ModulesProgress{
+				Modules: []*pbsubstreamsrpc.ModuleProgress{
+					{
+						Name: moduleName,
+						Type: &pbsubstreamsrpc.ModuleProgress_SlowExecution_{
+							SlowExecution: &pbsubstreamsrpc.ModuleProgress_SlowExecution{
+								BudgetMs: slow.BudgetMs,
+								Blocks:   blocks,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
 func toRPCProcessedBytes(
 	moduleName string,
 	bytesReadDelta uint64,
@@ -291,6 +361,7 @@ func toRPCPartialFiles(completed *pbssinternal.Completed) (out store.FileInfos)
 	out = make(store.FileInfos, len(completed.AllProcessedRanges))
 	for i, b := range completed.AllProcessedRanges {
 		out[i] = store.NewPartialFileInfo(b.StartBlock, b.EndBlock, completed.TraceId)
+		out[i].Size = b.Size
 	}
 	return
 }
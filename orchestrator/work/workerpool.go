@@ -2,6 +2,7 @@ package work
 
 import (
 	"context"
+	"sync"
 
 	"github.com/streamingfast/substreams/reqctx"
 	"go.uber.org/zap"
@@ -10,12 +11,25 @@ import (
 type WorkerPool interface {
 	Borrow(context.Context) Worker
 	Return(Worker)
+
+	// Resize changes the number of workers of the pool, between 1 and the worker
+	// count the pool was created with. When shrinking, the borrowed workers are
+	// dropped as they are returned.
+	Resize(workerCount uint64)
+	// Size is the number of workers of the pool, as last resized.
+	Size() uint64
 }
 
 var _ WorkerPool = (*workerPool)(nil)
 
 type workerPool struct {
-	workers chan Worker
+	workers       chan Worker
+	workerFactory WorkerFactory
+	logger        *zap.Logger
+
+	lock    sync.Mutex
+	size    uint64 // target number of workers
+	created uint64 // number of workers idle or borrowed
 }
 
 func NewWorkerPool(ctx context.Context, workerCount uint64, workerFactory WorkerFactory) WorkerPool {
@@ -28,7 +42,11 @@ func NewWorkerPool(ctx context.Context, workerCount uint64, workerFactory Worker
 	}
 
 	return &workerPool{
-		workers: workers,
+		workers:       workers,
+		workerFactory: workerFactory,
+		logger:        logger,
+		size:          workerCount,
+		created:       workerCount,
 	}
 
 }
@@ -43,5 +61,55 @@ func (p *workerPool) Borrow(ctx context.Context) Worker {
 }
 
 func (p *workerPool) Return(worker Worker) {
+	p.lock.Lock()
+	if p.created > p.size {
+		p.created--
+		p.lock.Unlock()
+		return
+	}
+	p.lock.Unlock()
+
 	p.workers <- worker
 }
+
+func (p *workerPool) Resize(workerCount uint64) {
+	if workerCount < 1 {
+		workerCount = 1
+	}
+	if max := uint64(cap(p.workers)); workerCount > max {
+		workerCount = max
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if workerCount == p.size {
+		return
+	}
+	p.logger.Info("resizing worker pool", zap.Uint64("from", p.size), zap.Uint64("to", workerCount))
+	p.size = workerCount
+
+	// The channel can hold all the workers the pool was created with, so
+	// adding workers never blocks.
+	for p.created < p.size {
+		p.workers <- p.workerFactory(p.logger)
+		p.created++
+	}
+
+	// Idle workers are dropped right away, the others as they are returned.
+	for p.created > p.size {
+		select {
+		case <-p.workers:
+			p.created--
+		default:
+			return
+		}
+	}
+}
+
+func (p *workerPool) Size() uint64 {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.size
+}
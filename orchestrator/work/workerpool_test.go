@@ -43,3 +43,38 @@ func Test_workerPoolPool_Borrow_Return_Canceled_Ctx(t *testing.T) {
 	assert.Nil(t, workerPool)
 
 }
+
+func Test_workerPool_Resize(t *testing.T) {
+	ctx := context.Background()
+	pi := NewWorkerPool(ctx, 4, func(logger *zap.Logger) Worker {
+		return NewWorkerFactoryFromFunc(func(ctx context.Context, request *pbssinternal.ProcessRangeRequest, respFunc substreams.ResponseFunc) *Result {
+			return &Result{}
+		})
+	})
+	p := pi.(*workerPool)
+
+	borrowed := p.Borrow(ctx)
+	assert.Len(t, p.workers, 3)
+
+	p.Resize(1)
+	assert.Equal(t, uint64(1), p.Size())
+	assert.Len(t, p.workers, 0, "idle workers dropped")
+
+	p.Return(borrowed)
+	assert.Len(t, p.workers, 1, "borrowed worker kept")
+
+	borrowed = p.Borrow(ctx)
+	p.Resize(3)
+	p.Resize(2)
+	assert.Len(t, p.workers, 1)
+	p.Return(borrowed)
+	assert.Len(t, p.workers, 2)
+
+	p.Resize(10)
+	assert.Equal(t, uint64(4), p.Size(), "capped to the initial worker count")
+	assert.Len(t, p.workers, 4)
+
+	p.Resize(0)
+	assert.Equal(t, uint64(1), p.Size(), "at least one worker")
+	assert.Len(t, p.workers, 1)
+}
@@ -21,6 +21,7 @@ func (r *ProcessRangeRequest) Validate() error {
 
 	seenStores := map[string]bool{}
 	outputModuleFound := false
+	var cachedOutputModule *pbsubstreams.Module
 	for _, mod := range r.Modules.Modules {
 		if _, ok := mod.Kind.(*pbsubstreams.Module_KindStore_); ok {
 			seenStores[mod.Name] = true
@@ -28,10 +29,25 @@ func (r *ProcessRangeRequest) Validate() error {
 		if mod.Name == r.OutputModule { // internal request can have store or module output
 			outputModuleFound = true
 		}
+		if mod.Name == r.CachedOutputModule {
+			cachedOutputModule = mod
+		}
 	}
 	if !outputModuleFound {
 		return fmt.Errorf("output module %q not found in modules", r.OutputModule)
 	}
 
+	if r.CachedOutputModule != "" {
+		if !seenStores[r.OutputModule] {
+			return fmt.Errorf("cached output module %q requires a store output module, got %q", r.CachedOutputModule, r.OutputModule)
+		}
+		if cachedOutputModule == nil {
+			return fmt.Errorf("cached output module %q not found in modules", r.CachedOutputModule)
+		}
+		if cachedOutputModule.GetKindMap() == nil {
+			return fmt.Errorf("cached output module %q is not a map module", r.CachedOutputModule)
+		}
+	}
+
 	return nil
 }
@@ -28,6 +28,20 @@ const (
 // StreamClient is a client for the sf.substreams.rpc.v2.Stream service.
 type StreamClient interface {
 	Blocks(context.Context, *connect_go.Request[v2.Request]) (*connect_go.ServerStreamForClient[v2.Response], error)
+	// Explain computes the backprocessing plan of a request without executing it.
+	Explain(context.Context, *connect_go.Request[v2.Request]) (*connect_go.Response[v2.ExplainResponse], error)
+	// StoreKeyHistory replays the deltas of a single key of a store module over a
+	// block range, from its cached outputs, without executing anything.
+	StoreKeyHistory(context.Context, *connect_go.Request[v2.StoreKeyHistoryRequest]) (*connect_go.Response[v2.StoreKeyHistoryResponse], error)
+	// GetNodeStatus reports the state of the node serving the call, for the
+	// operators dashboards. It is only served when enabled on the node.
+	GetNodeStatus(context.Context, *connect_go.Request[v2.NodeStatusRequest]) (*connect_go.Response[v2.NodeStatusResponse], error)
+	// ReloadModule replaces the code of a module of a development mode `Blocks`
+	// request being served, found by its trace ID. The request resumes with the
+	// new code from the last block it sent, only the state of the module and of
+	// the modules depending on it being rebuilt. It is only served when enabled
+	// on the node.
+	ReloadModule(context.Context, *connect_go.Request[v2.ReloadModuleRequest]) (*connect_go.Response[v2.ReloadModuleResponse], error)
 }
 
 // NewStreamClient constructs a client for the sf.substreams.rpc.v2.Stream service. By default, it
@@ -45,12 +59,36 @@ func NewStreamClient(httpClient connect_go.HTTPClient, baseURL string, opts ...c
 			baseURL+"/sf.substreams.rpc.v2.Stream/Blocks",
 			opts...,
 		),
+		explain: connect_go.NewClient[v2.Request, v2.ExplainResponse](
+			httpClient,
+			baseURL+"/sf.substreams.rpc.v2.Stream/Explain",
+			opts...,
+		),
+		storeKeyHistory: connect_go.NewClient[v2.StoreKeyHistoryRequest, v2.StoreKeyHistoryResponse](
+			httpClient,
+			baseURL+"/sf.substreams.rpc.v2.Stream/StoreKeyHistory",
+			opts...,
+		),
+		getNodeStatus: connect_go.NewClient[v2.NodeStatusRequest, v2.NodeStatusResponse](
+			httpClient,
+			baseURL+"/sf.substreams.rpc.v2.Stream/GetNodeStatus",
+			opts...,
+		),
+		reloadModule: connect_go.NewClient[v2.ReloadModuleRequest, v2.ReloadModuleResponse](
+			httpClient,
+			baseURL+"/sf.substreams.rpc.v2.Stream/ReloadModule",
+			opts...,
+		),
 	}
 }
 
 // streamClient implements StreamClient.
 type streamClient struct {
-	blocks *connect_go.Client[v2.Request, v2.Response]
+	blocks          *connect_go.Client[v2.Request, v2.Response]
+	explain         *connect_go.Client[v2.Request, v2.ExplainResponse]
+	storeKeyHistory *connect_go.Client[v2.StoreKeyHistoryRequest, v2.StoreKeyHistoryResponse]
+	getNodeStatus   *connect_go.Client[v2.NodeStatusRequest, v2.NodeStatusResponse]
+	reloadModule    *connect_go.Client[v2.ReloadModuleRequest, v2.ReloadModuleResponse]
 }
 
 // Blocks calls sf.substreams.rpc.v2.Stream.Blocks.
@@ -58,9 +96,43 @@ func (c *streamClient) Blocks(ctx context.Context, req *connect_go.Request[v2.Re
 	return c.blocks.CallServerStream(ctx, req)
 }
 
+// Explain calls sf.substreams.rpc.v2.Stream.Explain.
+func (c *streamClient) Explain(ctx context.Context, req *connect_go.Request[v2.Request]) (*connect_go.Response[v2.ExplainResponse], error) {
+	return c.explain.CallUnary(ctx, req)
+}
+
+// StoreKeyHistory calls sf.substreams.rpc.v2.Stream.StoreKeyHistory.
+func (c *streamClient) StoreKeyHistory(ctx context.Context, req *connect_go.Request[v2.StoreKeyHistoryRequest]) (*connect_go.Response[v2.StoreKeyHistoryResponse], error) {
+	return c.storeKeyHistory.CallUnary(ctx, req)
+}
+
+// GetNodeStatus calls sf.substreams.rpc.v2.Stream.GetNodeStatus.
+func (c *streamClient) GetNodeStatus(ctx context.Context, req *connect_go.Request[v2.NodeStatusRequest]) (*connect_go.Response[v2.NodeStatusResponse], error) {
+	return c.getNodeStatus.CallUnary(ctx, req)
+}
+
+// ReloadModule calls sf.substreams.rpc.v2.Stream.ReloadModule.
+func (c *streamClient) ReloadModule(ctx context.Context, req *connect_go.Request[v2.ReloadModuleRequest]) (*connect_go.Response[v2.ReloadModuleResponse], error) {
+	return c.reloadModule.CallUnary(ctx, req)
+}
+
 // StreamHandler is an implementation of the sf.substreams.rpc.v2.Stream service.
 type StreamHandler interface {
 	Blocks(context.Context, *connect_go.Request[v2.Request], *connect_go.ServerStream[v2.Response]) error
+	// Explain computes the backprocessing plan of a request without executing it.
+	Explain(context.Context, *connect_go.Request[v2.Request]) (*connect_go.Response[v2.ExplainResponse], error)
+	// StoreKeyHistory replays the deltas of a single key of a store module over a
+	// block range, from its cached outputs, without executing anything.
+	StoreKeyHistory(context.Context, *connect_go.Request[v2.StoreKeyHistoryRequest]) (*connect_go.Response[v2.StoreKeyHistoryResponse], error)
+	// GetNodeStatus reports the state of the node serving the call, for the
+	// operators dashboards. It is only served when enabled on the node.
+	GetNodeStatus(context.Context, *connect_go.Request[v2.NodeStatusRequest]) (*connect_go.Response[v2.NodeStatusResponse], error)
+	// ReloadModule replaces the code of a module of a development mode `Blocks`
+	// request being served, found by its trace ID. The request resumes with the
+	// new code from the last block it sent, only the state of the module and of
+	// the modules depending on it being rebuilt. It is only served when enabled
+	// on the node.
+	ReloadModule(context.Context, *connect_go.Request[v2.ReloadModuleRequest]) (*connect_go.Response[v2.ReloadModuleResponse], error)
 }
 
 // NewStreamHandler builds an HTTP handler from the service implementation. It returns the path on
@@ -75,6 +147,26 @@ func NewStreamHandler(svc StreamHandler, opts ...connect_go.HandlerOption) (stri
 		svc.Blocks,
 		opts...,
 	))
+	mux.Handle("/sf.substreams.rpc.v2.Stream/Explain", connect_go.NewUnaryHandler(
+		"/sf.substreams.rpc.v2.Stream/Explain",
+		svc.Explain,
+		opts...,
+	))
+	mux.Handle("/sf.substreams.rpc.v2.Stream/StoreKeyHistory", connect_go.NewUnaryHandler(
+		"/sf.substreams.rpc.v2.Stream/StoreKeyHistory",
+		svc.StoreKeyHistory,
+		opts...,
+	))
+	mux.Handle("/sf.substreams.rpc.v2.Stream/GetNodeStatus", connect_go.NewUnaryHandler(
+		"/sf.substreams.rpc.v2.Stream/GetNodeStatus",
+		svc.GetNodeStatus,
+		opts...,
+	))
+	mux.Handle("/sf.substreams.rpc.v2.Stream/ReloadModule", connect_go.NewUnaryHandler(
+		"/sf.substreams.rpc.v2.Stream/ReloadModule",
+		svc.ReloadModule,
+		opts...,
+	))
 	return "/sf.substreams.rpc.v2.Stream/", mux
 }
 
@@ -84,3 +176,19 @@ type UnimplementedStreamHandler struct{}
 func (UnimplementedStreamHandler) Blocks(context.Context, *connect_go.Request[v2.Request], *connect_go.ServerStream[v2.Response]) error {
 	return connect_go.NewError(connect_go.CodeUnimplemented, errors.New("sf.substreams.rpc.v2.Stream.Blocks is not implemented"))
 }
+
+func (UnimplementedStreamHandler) Explain(context.Context, *connect_go.Request[v2.Request]) (*connect_go.Response[v2.ExplainResponse], error) {
+	return nil, connect_go.NewError(connect_go.CodeUnimplemented, errors.New("sf.substreams.rpc.v2.Stream.Explain is not implemented"))
+}
+
+func (UnimplementedStreamHandler) StoreKeyHistory(context.Context, *connect_go.Request[v2.StoreKeyHistoryRequest]) (*connect_go.Response[v2.StoreKeyHistoryResponse], error) {
+	return nil, connect_go.NewError(connect_go.CodeUnimplemented, errors.New("sf.substreams.rpc.v2.Stream.StoreKeyHistory is not implemented"))
+}
+
+func (UnimplementedStreamHandler) GetNodeStatus(context.Context, *connect_go.Request[v2.NodeStatusRequest]) (*connect_go.Response[v2.NodeStatusResponse], error) {
+	return nil, connect_go.NewError(connect_go.CodeUnimplemented, errors.New("sf.substreams.rpc.v2.Stream.GetNodeStatus is not implemented"))
+}
+
+func (UnimplementedStreamHandler) ReloadModule(context.Context, *connect_go.Request[v2.ReloadModuleRequest]) (*connect_go.Response[v2.ReloadModuleResponse], error) {
+	return nil, connect_go.NewError(connect_go.CodeUnimplemented, errors.New("sf.substreams.rpc.v2.Stream.ReloadModule is not implemented"))
+}
@@ -23,6 +23,20 @@ const _ = grpc.SupportPackageIsVersion7
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type StreamClient interface {
 	Blocks(ctx context.Context, in *Request, opts ...grpc.CallOption) (Stream_BlocksClient, error)
+	// Explain computes the backprocessing plan of a request without executing it.
+	Explain(ctx context.Context, in *Request, opts ...grpc.CallOption) (*ExplainResponse, error)
+	// StoreKeyHistory replays the deltas of a single key of a store module over a
+	// block range, from its cached outputs, without executing anything.
+	StoreKeyHistory(ctx context.Context, in *StoreKeyHistoryRequest, opts ...grpc.CallOption) (*StoreKeyHistoryResponse, error)
+	// GetNodeStatus reports the state of the node serving the call, for the
+	// operators dashboards. It is only served when enabled on the node.
+	GetNodeStatus(ctx context.Context, in *NodeStatusRequest, opts ...grpc.CallOption) (*NodeStatusResponse, error)
+	// ReloadModule replaces the code of a module of a development mode `Blocks`
+	// request being served, found by its trace ID. The request resumes with the
+	// new code from the last block it sent, only the state of the module and of
+	// the modules depending on it being rebuilt. It is only served when enabled
+	// on the node.
+	ReloadModule(ctx context.Context, in *ReloadModuleRequest, opts ...grpc.CallOption) (*ReloadModuleResponse, error)
 }
 
 type streamClient struct {
@@ -65,11 +79,61 @@ func (x *streamBlocksClient) Recv() (*Response, error) {
 	return m, nil
 }
 
+func (c *streamClient) Explain(ctx context.Context, in *Request, opts ...grpc.CallOption) (*ExplainResponse, error) {
+	out := new(ExplainResponse)
+	err := c.cc.Invoke(ctx, "/sf.substreams.rpc.v2.Stream/Explain", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *streamClient) StoreKeyHistory(ctx context.Context, in *StoreKeyHistoryRequest, opts ...grpc.CallOption) (*StoreKeyHistoryResponse, error) {
+	out := new(StoreKeyHistoryResponse)
+	err := c.cc.Invoke(ctx, "/sf.substreams.rpc.v2.Stream/StoreKeyHistory", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *streamClient) GetNodeStatus(ctx context.Context, in *NodeStatusRequest, opts ...grpc.CallOption) (*NodeStatusResponse, error) {
+	out := new(NodeStatusResponse)
+	err := c.cc.Invoke(ctx, "/sf.substreams.rpc.v2.Stream/GetNodeStatus", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *streamClient) ReloadModule(ctx context.Context, in *ReloadModuleRequest, opts ...grpc.CallOption) (*ReloadModuleResponse, error) {
+	out := new(ReloadModuleResponse)
+	err := c.cc.Invoke(ctx, "/sf.substreams.rpc.v2.Stream/ReloadModule", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // StreamServer is the server API for Stream service.
 // All implementations should embed UnimplementedStreamServer
 // for forward compatibility
 type StreamServer interface {
 	Blocks(*Request, Stream_BlocksServer) error
+	// Explain computes the backprocessing plan of a request without executing it.
+	Explain(context.Context, *Request) (*ExplainResponse, error)
+	// StoreKeyHistory replays the deltas of a single key of a store module over a
+	// block range, from its cached outputs, without executing anything.
+	StoreKeyHistory(context.Context, *StoreKeyHistoryRequest) (*StoreKeyHistoryResponse, error)
+	// GetNodeStatus reports the state of the node serving the call, for the
+	// operators dashboards. It is only served when enabled on the node.
+	GetNodeStatus(context.Context, *NodeStatusRequest) (*NodeStatusResponse, error)
+	// ReloadModule replaces the code of a module of a development mode `Blocks`
+	// request being served, found by its trace ID. The request resumes with the
+	// new code from the last block it sent, only the state of the module and of
+	// the modules depending on it being rebuilt. It is only served when enabled
+	// on the node.
+	ReloadModule(context.Context, *ReloadModuleRequest) (*ReloadModuleResponse, error)
 }
 
 // UnimplementedStreamServer should be embedded to have forward compatible implementations.
@@ -79,6 +143,18 @@ type UnimplementedStreamServer struct {
 func (UnimplementedStreamServer) Blocks(*Request, Stream_BlocksServer) error {
 	return status.Errorf(codes.Unimplemented, "method Blocks not implemented")
 }
+func (UnimplementedStreamServer) Explain(context.Context, *Request) (*ExplainResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Explain not implemented")
+}
+func (UnimplementedStreamServer) StoreKeyHistory(context.Context, *StoreKeyHistoryRequest) (*StoreKeyHistoryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method StoreKeyHistory not implemented")
+}
+func (UnimplementedStreamServer) GetNodeStatus(context.Context, *NodeStatusRequest) (*NodeStatusResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetNodeStatus not implemented")
+}
+func (UnimplementedStreamServer) ReloadModule(context.Context, *ReloadModuleRequest) (*ReloadModuleResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReloadModule not implemented")
+}
 
 // UnsafeStreamServer may be embedded to opt out of forward compatibility for this service.
 // Use of this interface is not recommended, as added methods to StreamServer will
@@ -112,13 +188,102 @@ func (x *streamBlocksServer) Send(m *Response) error {
 	return x.ServerStream.SendMsg(m)
 }
 
+func _Stream_Explain_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Request)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StreamServer).Explain(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/sf.substreams.rpc.v2.Stream/Explain",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StreamServer).Explain(ctx, req.(*Request))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Stream_StoreKeyHistory_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StoreKeyHistoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StreamServer).StoreKeyHistory(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/sf.substreams.rpc.v2.Stream/StoreKeyHistory",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StreamServer).StoreKeyHistory(ctx, req.(*StoreKeyHistoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Stream_GetNodeStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(NodeStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StreamServer).GetNodeStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/sf.substreams.rpc.v2.Stream/GetNodeStatus",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StreamServer).GetNodeStatus(ctx, req.(*NodeStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Stream_ReloadModule_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReloadModuleRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StreamServer).ReloadModule(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/sf.substreams.rpc.v2.Stream/ReloadModule",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StreamServer).ReloadModule(ctx, req.(*ReloadModuleRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Stream_ServiceDesc is the grpc.ServiceDesc for Stream service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
 var Stream_ServiceDesc = grpc.ServiceDesc{
 	ServiceName: "sf.substreams.rpc.v2.Stream",
 	HandlerType: (*StreamServer)(nil),
-	Methods:     []grpc.MethodDesc{},
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Explain",
+			Handler:    _Stream_Explain_Handler,
+		},
+		{
+			MethodName: "StoreKeyHistory",
+			Handler:    _Stream_StoreKeyHistory_Handler,
+		},
+		{
+			MethodName: "GetNodeStatus",
+			Handler:    _Stream_GetNodeStatus_Handler,
+		},
+		{
+			MethodName: "ReloadModule",
+			Handler:    _Stream_ReloadModule_Handler,
+		},
+	},
 	Streams: []grpc.StreamDesc{
 		{
 			StreamName:    "Blocks",
@@ -70,28 +70,38 @@ func (req *Request) Validate() error {
 		return fmt.Errorf("no modules found in request")
 	}
 
-	if req.OutputModule == "" {
+	outputModules := req.OutputModuleNames()
+	if len(outputModules) == 0 {
 		return fmt.Errorf("no output module defined in request")
 	}
+	if len(req.OutputModules) != 0 && req.OutputModule != "" && req.OutputModule != req.OutputModules[0] {
+		return fmt.Errorf("output module %q must be the first of the output modules, got %q", req.OutputModule, req.OutputModules[0])
+	}
 
 	if req.DebugInitialStoreSnapshotForModules != nil && req.ProductionMode {
 		return fmt.Errorf("cannot set 'debug-modules-initial-snapshot' in 'production-mode'")
 	}
 
-	outputModuleFound := false
+	maps := map[string]bool{}
 	for _, mod := range req.Modules.Modules {
 		if _, ok := mod.Kind.(*pbsubstreams.Module_KindStore_); ok {
 			seenStores[mod.Name] = true
-		}
-		if mod.Name == req.OutputModule {
-			if _, ok := mod.Kind.(*pbsubstreams.Module_KindStore_); ok {
-				return fmt.Errorf("output module must be of kind 'map'")
-			}
-			outputModuleFound = true
+		} else {
+			maps[mod.Name] = true
 		}
 	}
-	if !outputModuleFound {
-		return fmt.Errorf("output module %q not found in modules", req.OutputModule)
+	seenOutputs := map[string]bool{}
+	for _, outputModule := range outputModules {
+		if seenStores[outputModule] {
+			return fmt.Errorf("output module must be of kind 'map'")
+		}
+		if !maps[outputModule] {
+			return fmt.Errorf("output module %q not found in modules", outputModule)
+		}
+		if seenOutputs[outputModule] {
+			return fmt.Errorf("output module %q is listed twice", outputModule)
+		}
+		seenOutputs[outputModule] = true
 	}
 
 	for _, storeSnapshot := range req.DebugInitialStoreSnapshotForModules {
@@ -99,5 +109,37 @@ func (req *Request) Validate() error {
 			return fmt.Errorf("initial store snapshots for module: %q: no such 'store' module defined modules graph", storeSnapshot)
 		}
 	}
+
+	for _, storeDeltas := range req.StoreDeltaModules {
+		if !seenStores[storeDeltas] {
+			return fmt.Errorf("store deltas for module: %q: no such 'store' module defined modules graph", storeDeltas)
+		}
+	}
+
+	if storeValue := req.StopConditions.GetStoreValue(); storeValue != nil {
+		if !seenStores[storeValue.ModuleName] {
+			return fmt.Errorf("stop condition on store value: %q: no such 'store' module defined modules graph", storeValue.ModuleName)
+		}
+		if storeValue.Key == "" {
+			return fmt.Errorf("stop condition on store value: missing key")
+		}
+	}
+	if stopAtTime := req.StopConditions.GetStopAtTime(); stopAtTime != nil {
+		if err := stopAtTime.CheckValid(); err != nil {
+			return fmt.Errorf("stop condition on time: %w", err)
+		}
+	}
 	return nil
 }
+
+// OutputModuleNames returns the modules whose outputs are streamed:
+// `output_modules`, or `output_module` alone when they are not set.
+func (req *Request) OutputModuleNames() []string {
+	if len(req.OutputModules) != 0 {
+		return req.OutputModules
+	}
+	if req.OutputModule == "" {
+		return nil
+	}
+	return []string{req.OutputModule}
+}
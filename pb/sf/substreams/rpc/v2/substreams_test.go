@@ -20,6 +20,13 @@ func Test_ValidateRequest(t *testing.T) {
 		{"no modules found in request", &Request{StartBlockNum: 1}, fmt.Errorf("no modules found in request")},
 		{"store output module is accepted for sub-request", TestNewRequest(1, withTestOutputModule("output_mod_1"), withTestStoreModule("output_mod_1")), fmt.Errorf("output module must be of kind 'map'")},
 		{"production mode should fail with debug flag", TestNewRequest(1, withTestOutputModule("output_mod_1"), withTestMapModule("output_mod_1"), withProductionMode(), withDebugSnapshotsModule("output_mod_1")), fmt.Errorf("cannot set 'debug-modules-initial-snapshot' in 'production-mode'")},
+		{"store deltas in production mode", TestNewRequest(1, withTestOutputModule("output_mod_1"), withTestMapModule("output_mod_1"), withTestStoreModule("store_1"), withProductionMode(), withStoreDeltaModule("store_1")), nil},
+		{"output modules", TestNewRequest(1, withTestOutputModules("output_mod_1", "output_mod_2"), withTestMapModule("output_mod_1"), withTestMapModule("output_mod_2")), nil},
+		{"output module first of output modules", TestNewRequest(1, withTestOutputModule("output_mod_1"), withTestOutputModules("output_mod_1", "output_mod_2"), withTestMapModule("output_mod_1"), withTestMapModule("output_mod_2")), nil},
+		{"output module not first of output modules", TestNewRequest(1, withTestOutputModule("output_mod_2"), withTestOutputModules("output_mod_1", "output_mod_2"), withTestMapModule("output_mod_1"), withTestMapModule("output_mod_2")), fmt.Errorf("output module \"output_mod_2\" must be the first of the output modules, got \"output_mod_1\"")},
+		{"output modules listed twice", TestNewRequest(1, withTestOutputModules("output_mod_1", "output_mod_1"), withTestMapModule("output_mod_1")), fmt.Errorf("output module \"output_mod_1\" is listed twice")},
+		{"store in output modules", TestNewRequest(1, withTestOutputModules("output_mod_1", "store_1"), withTestMapModule("output_mod_1"), withTestStoreModule("store_1")), fmt.Errorf("output module must be of kind 'map'")},
+		{"store deltas of a map module", TestNewRequest(1, withTestOutputModule("output_mod_1"), withTestMapModule("output_mod_1"), withStoreDeltaModule("output_mod_1")), fmt.Errorf("store deltas for module: \"output_mod_1\": no such 'store' module defined modules graph")},
 	}
 
 	for _, test := range tests {
@@ -29,6 +29,13 @@ func withDebugSnapshotsModule(mod string) testNewRequestOption {
 	}
 }
 
+func withStoreDeltaModule(mod string) testNewRequestOption {
+	return func(req *Request) *Request {
+		req.StoreDeltaModules = append(req.StoreDeltaModules, mod)
+		return req
+	}
+}
+
 func withTestOutputModule(module string) testNewRequestOption {
 	return func(req *Request) *Request {
 		req.OutputModule = module
@@ -36,6 +43,13 @@ func withTestOutputModule(module string) testNewRequestOption {
 	}
 }
 
+func withTestOutputModules(modules ...string) testNewRequestOption {
+	return func(req *Request) *Request {
+		req.OutputModules = modules
+		return req
+	}
+}
+
 func withTestStoreModule(name string) testNewRequestOption {
 	return func(req *Request) *Request {
 		req.Modules.Modules = append(req.Modules.Modules, TestNewStoreModule(name))
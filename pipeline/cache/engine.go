@@ -10,6 +10,7 @@ import (
 	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
 	"github.com/streamingfast/substreams/service/config"
 	"github.com/streamingfast/substreams/storage/execout"
+	"github.com/streamingfast/substreams/storage/index"
 	"go.uber.org/zap"
 )
 
@@ -20,13 +21,15 @@ import (
 type Engine struct {
 	ctx               context.Context
 	blockType         string
+	payloadValidated  bool                       // the payload of the first block is checked against blockType, see execout.ValidateBlockPayload
 	reversibleBuffers map[uint64]*execout.Buffer // block num to modules' outputs for that given block
-	writableFiles     *execout.Writer            // moduleName => irreversible File
+	writableFiles     execout.OutputWriter       // moduleName => irreversible File
+	indexWriter       *index.Writer              // nil when no block index module is executed, see SetIndexWriter
 	runtimeConfig     config.RuntimeConfig
 	logger            *zap.Logger
 }
 
-func NewEngine(ctx context.Context, runtimeConfig config.RuntimeConfig, execOutWriter *execout.Writer, blockType string) (*Engine, error) {
+func NewEngine(ctx context.Context, runtimeConfig config.RuntimeConfig, execOutWriter execout.OutputWriter, blockType string) (*Engine, error) {
 	e := &Engine{
 		ctx:               ctx,
 		runtimeConfig:     runtimeConfig,
@@ -38,8 +41,21 @@ func NewEngine(ctx context.Context, runtimeConfig config.RuntimeConfig, execOutW
 	return e, nil
 }
 
+// SetIndexWriter makes the engine record the blocks matched by the block index
+// modules in their final outputs, see index.Writer.
+func (e *Engine) SetIndexWriter(w *index.Writer) {
+	e.indexWriter = w
+}
+
 func (e *Engine) NewBuffer(block *bstream.Block, clock *pbsubstreams.Clock, cursor *bstream.Cursor) (execout.ExecutionOutput, error) {
-	execOutBuf, err := execout.NewBuffer(e.blockType, block, clock)
+	if !e.payloadValidated {
+		if err := execout.ValidateBlockPayload(e.blockType, block); err != nil {
+			return nil, err
+		}
+		e.payloadValidated = true
+	}
+
+	execOutBuf, err := execout.NewBuffer(e.blockType, block, clock, isFinal(block, cursor))
 	if err != nil {
 		return nil, fmt.Errorf("setting up map: %w", err)
 	}
@@ -49,6 +65,14 @@ func (e *Engine) NewBuffer(block *bstream.Block, clock *pbsubstreams.Clock, curs
 	return execOutBuf, nil
 }
 
+// isFinal returns whether `block` is final at the position of `cursor`.
+func isFinal(block *bstream.Block, cursor *bstream.Cursor) bool {
+	if cursor == nil {
+		return false
+	}
+	return cursor.Step.Matches(bstream.StepIrreversible) || (cursor.LIB != nil && block.Number <= cursor.LIB.Num())
+}
+
 func (e *Engine) HandleUndo(clock *pbsubstreams.Clock) {
 	delete(e.reversibleBuffers, clock.Number)
 }
@@ -72,6 +96,13 @@ func (e *Engine) HandleFinal(clock *pbsubstreams.Clock) error {
 		e.writableFiles.Write(clock, execOutBuf)
 	}
 
+	if e.indexWriter != nil {
+		if err := e.indexWriter.MaybeRotate(e.ctx, clock.Number); err != nil {
+			return fmt.Errorf("rotating block indexes: %w", err)
+		}
+		e.indexWriter.Write(clock.Number, execOutBuf)
+	}
+
 	delete(e.reversibleBuffers, clock.Number)
 
 	return nil
@@ -92,6 +123,11 @@ func (e *Engine) EndOfStream(lastFinalClock *pbsubstreams.Clock) error {
 			return fmt.Errorf("rotating writable files: %w", err)
 		}
 	}
+	if e.indexWriter != nil {
+		if err := e.indexWriter.MaybeRotate(e.ctx, lastFinalClock.Number+1); err != nil {
+			return fmt.Errorf("rotating block indexes: %w", err)
+		}
+	}
 
 	return nil
 }
@@ -0,0 +1,30 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/streamingfast/bstream"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsFinal(t *testing.T) {
+	block := &bstream.Block{Number: 10, Id: "10a"}
+
+	tests := []struct {
+		name   string
+		cursor *bstream.Cursor
+		expect bool
+	}{
+		{"no cursor", nil, false},
+		{"new, above lib", &bstream.Cursor{Step: bstream.StepNew, LIB: bstream.NewBlockRef("8a", 8)}, false},
+		{"new, at lib", &bstream.Cursor{Step: bstream.StepNew, LIB: bstream.NewBlockRef("10a", 10)}, true},
+		{"new irreversible", &bstream.Cursor{Step: bstream.StepNewIrreversible, LIB: bstream.NewBlockRef("8a", 8)}, true},
+		{"irreversible, final blocks only", &bstream.Cursor{Step: bstream.StepIrreversible, LIB: bstream.NewBlockRef("8a", 8)}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expect, isFinal(block, test.cursor))
+		})
+	}
+}
@@ -7,12 +7,28 @@ import (
 
 	ttrace "go.opentelemetry.io/otel/trace"
 
+	pbssinternal "github.com/streamingfast/substreams/pb/sf/substreams/intern/v2"
 	"github.com/streamingfast/substreams/storage/execout"
 	"github.com/streamingfast/substreams/wasm"
 )
 
 var ErrWasmDeterministicExec = errors.New("wasm execution failed deterministically")
 
+// ExecutionError is the failure of the execution of a module on a block.
+type ExecutionError struct {
+	Module   string
+	BlockNum uint64
+	Err      error
+}
+
+func (e *ExecutionError) Error() string {
+	return fmt.Sprintf("block %d: module %q: %s", e.BlockNum, e.Module, e.Err)
+}
+
+func (e *ExecutionError) Unwrap() error {
+	return e.Err
+}
+
 type BaseExecutor struct {
 	ctx context.Context
 
@@ -24,11 +40,15 @@ type BaseExecutor struct {
 
 	instanceCacheEnabled bool
 	cachedInstance       wasm.Instance
+	recordStoreReads     bool
+	blockFilter          string // the block index module, see FilterBlocks
 
 	// Results
-	logs           []string
-	logsTruncated  bool
-	executionStack []string
+	logs            []string
+	logsTruncated   bool
+	executionStack  []string
+	storeReads      []*pbssinternal.StoreReads
+	storeOperations uint64
 }
 
 func NewBaseExecutor(ctx context.Context, moduleName string, wasmModule wasm.Module, cacheEnabled bool, wasmArguments []wasm.Argument, entrypoint string, tracer ttrace.Tracer) *BaseExecutor {
@@ -43,12 +63,40 @@ func NewBaseExecutor(ctx context.Context, moduleName string, wasmModule wasm.Mod
 	}
 }
 
+// RecordStoreReads makes the executor record the keys read from the input
+// stores of the module, see `OutputDebugInfo.store_reads`. Meant for
+// development mode only.
+func (e *BaseExecutor) RecordStoreReads() {
+	e.recordStoreReads = true
+}
+
+// FilterBlocks makes the executor skip the blocks on which the block index
+// module `indexModule` produced no output, see `Module.block_filter`. The
+// output of the module is empty on those blocks.
+func (e *BaseExecutor) FilterBlocks(indexModule string) {
+	e.blockFilter = indexModule
+}
+
 //var Timer time.Duration
 
 func (e *BaseExecutor) wasmCall(outputGetter execout.ExecutionOutputGetter) (call *wasm.Call, err error) {
 	e.logs = nil
 	e.logsTruncated = false
 	e.executionStack = nil
+	e.storeReads = nil
+	e.storeOperations = 0
+
+	if e.blockFilter != "" {
+		// the block index is executed before the modules it filters, its
+		// output is missing only if it was not executed
+		matched, _, err := outputGetter.Get(e.blockFilter)
+		if err != nil {
+			return nil, fmt.Errorf("block filter %q: %w", e.blockFilter, err)
+		}
+		if len(matched) == 0 {
+			return nil, nil
+		}
+	}
 
 	hasInput := false
 	for _, input := range e.wasmArguments {
@@ -79,6 +127,8 @@ func (e *BaseExecutor) wasmCall(outputGetter execout.ExecutionOutputGetter) (cal
 
 		//t0 := time.Now()
 		call = wasm.NewCall(clock, e.moduleName, e.entrypoint, e.wasmArguments)
+		call.Final = outputGetter.Final()
+		call.RecordStoreReads = e.recordStoreReads
 		inst, err = e.wasmModule.ExecuteNewCall(e.ctx, call, e.cachedInstance, e.wasmArguments)
 		//Timer += time.Since(t0)
 		if panicErr := call.Err(); panicErr != nil {
@@ -86,10 +136,10 @@ func (e *BaseExecutor) wasmCall(outputGetter execout.ExecutionOutputGetter) (cal
 				message:    panicErr.Error(),
 				stackTrace: call.ExecutionStack,
 			}
-			return nil, fmt.Errorf("block %d: module %q: %w: %s", clock.Number, e.moduleName, ErrWasmDeterministicExec, errExecutor.Error())
+			return nil, &ExecutionError{Module: e.moduleName, BlockNum: clock.Number, Err: fmt.Errorf("%w: %s", ErrWasmDeterministicExec, errExecutor.Error())}
 		}
 		if err != nil {
-			return nil, fmt.Errorf("block %d: module %q: general wasm execution failed: %v", clock.Number, e.moduleName, err)
+			return nil, &ExecutionError{Module: e.moduleName, BlockNum: clock.Number, Err: fmt.Errorf("general wasm execution failed: %w", err)}
 		}
 		if e.instanceCacheEnabled {
 			if err := inst.Cleanup(e.ctx); err != nil {
@@ -104,6 +154,8 @@ func (e *BaseExecutor) wasmCall(outputGetter execout.ExecutionOutputGetter) (cal
 		e.logs = call.Logs
 		e.logsTruncated = call.ReachedLogsMaxByteCount()
 		e.executionStack = call.ExecutionStack
+		e.storeReads = call.StoreReads
+		e.storeOperations = call.StoreOperations
 	}
 	return
 }
@@ -121,3 +173,9 @@ func (e *BaseExecutor) lastExecutionLogs() (logs []string, truncated bool) {
 func (e *BaseExecutor) lastExecutionStack() []string {
 	return e.executionStack
 }
+func (e *BaseExecutor) lastExecutionStoreReads() []*pbssinternal.StoreReads {
+	return e.storeReads
+}
+func (e *BaseExecutor) lastExecutionStoreOperations() uint64 {
+	return e.storeOperations
+}
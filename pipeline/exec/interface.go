@@ -19,4 +19,6 @@ type ModuleExecutor interface {
 
 	lastExecutionLogs() (logs []string, truncated bool)
 	lastExecutionStack() []string
+	lastExecutionStoreReads() []*pbssinternal.StoreReads
+	lastExecutionStoreOperations() uint64
 }
@@ -9,7 +9,9 @@ import (
 	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 
+	"github.com/streamingfast/substreams/billing"
 	"github.com/streamingfast/substreams/reqctx"
+	"github.com/streamingfast/substreams/storage/store"
 
 	pbssinternal "github.com/streamingfast/substreams/pb/sf/substreams/intern/v2"
 )
@@ -54,7 +56,10 @@ func RunModule(ctx context.Context, executor ModuleExecutor, execOutput execout.
 	if err != nil {
 		return nil, nil, fmt.Errorf("execute: %w", err)
 	}
-	reqctx.ReqStats(ctx).RecordModuleExecDuration(time.Since(t0))
+	elapsed := time.Since(t0)
+	reqctx.ReqStats(ctx).RecordModuleExecDuration(elapsed)
+	billing.UsageFromContext(ctx).AddWasmExecutionTime(elapsed)
+	reqctx.ModuleMeter(ctx).RecordExecution(modName, elapsed, executor.lastExecutionStoreOperations(), storeSizeBytes(executor))
 
 	fillModuleOutputMetadata(executor, moduleOutput)
 
@@ -75,5 +80,17 @@ func fillModuleOutputMetadata(executor ModuleExecutor, in *pbssinternal.ModuleOu
 	in.ModuleName = executor.Name()
 	in.Logs = logs
 	in.DebugLogsTruncated = truncated
+	in.DebugStoreReads = executor.lastExecutionStoreReads()
 	return
 }
+
+// storeSizeBytes is the size of the store of a store module, 0 for the other
+// modules.
+func storeSizeBytes(executor ModuleExecutor) uint64 {
+	if storeExecutor, ok := executor.(*StoreModuleExecutor); ok {
+		if iterable, ok := storeExecutor.outputStore.(store.Iterable); ok {
+			return iterable.SizeBytes()
+		}
+	}
+	return 0
+}
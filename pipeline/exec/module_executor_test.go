@@ -22,6 +22,10 @@ func (t *MockExecOutput) Clock() *pbsubstreams.Clock {
 	return t.clockFunc()
 }
 
+func (t *MockExecOutput) Final() bool {
+	return true
+}
+
 func (t *MockExecOutput) Get(name string) ([]byte, bool, error) {
 	v, ok := t.cacheMap[name]
 	if !ok {
@@ -89,6 +93,14 @@ func (t *MockModuleExecutor) lastExecutionStack() []string {
 	return nil
 }
 
+func (t *MockModuleExecutor) lastExecutionStoreReads() []*pbssinternal.StoreReads {
+	return nil
+}
+
+func (t *MockModuleExecutor) lastExecutionStoreOperations() uint64 {
+	return 0
+}
+
 func TestModuleExecutorRunner_Run_HappyPath(t *testing.T) {
 	ctx := context.Background()
 	executor := &MockModuleExecutor{
@@ -0,0 +1,49 @@
+package exec
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/streamingfast/substreams/storage/execout"
+	"github.com/streamingfast/substreams/storage/store"
+)
+
+// ErrNonDeterministicExec is returned by ReplayModule when two executions of a
+// module on the same block did not produce the same output.
+var ErrNonDeterministicExec = errors.New("wasm execution is not deterministic")
+
+// ReplayModule executes `executor` a second time on the block of `execOutput`,
+// right after RunModule executed it and produced `outputBytes`, and fails with
+// ErrNonDeterministicExec when the output differs. The output store of a store
+// module is first rewound to its state before the block, it is back to its
+// state after the block once the module replayed.
+func ReplayModule(ctx context.Context, executor ModuleExecutor, execOutput execout.ExecutionOutputGetter, outputBytes []byte) error {
+	if e, ok := executor.(*StoreModuleExecutor); ok {
+		e.rewind()
+	}
+
+	replayBytes, _, err := executor.run(ctx, execOutput)
+	if err != nil {
+		return fmt.Errorf("replay: %w", err)
+	}
+
+	if !bytes.Equal(outputBytes, replayBytes) {
+		return &ExecutionError{
+			Module:   executor.Name(),
+			BlockNum: execOutput.Clock().Number,
+			Err:      fmt.Errorf("%w: output hashes %x and %x", ErrNonDeterministicExec, sha256.Sum256(outputBytes), sha256.Sum256(replayBytes)),
+		}
+	}
+	return nil
+}
+
+// rewind reverts the changes made to the output store by the last execution.
+func (e *StoreModuleExecutor) rewind() {
+	e.outputStore.ApplyDeltasReverse(e.outputStore.GetDeltas())
+	if s, ok := e.outputStore.(store.Resettable); ok {
+		s.Reset()
+	}
+}
@@ -0,0 +1,73 @@
+package exec
+
+import (
+	"context"
+	"testing"
+
+	"github.com/streamingfast/dstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	pbssinternal "github.com/streamingfast/substreams/pb/sf/substreams/intern/v2"
+	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
+	"github.com/streamingfast/substreams/storage/execout"
+	"github.com/streamingfast/substreams/storage/store"
+)
+
+func TestReplayModule(t *testing.T) {
+	output := &MockExecOutput{
+		clockFunc: func() *pbsubstreams.Clock { return &pbsubstreams.Clock{Number: 10} },
+		cacheMap:  make(map[string][]byte),
+	}
+	executorReturning := func(outputs ...string) *MockModuleExecutor {
+		return &MockModuleExecutor{
+			name: "test",
+			RunFunc: func(ctx context.Context, reader execout.ExecutionOutputGetter) ([]byte, *pbssinternal.ModuleOutput, error) {
+				out := outputs[0]
+				outputs = outputs[1:]
+				return []byte(out), &pbssinternal.ModuleOutput{}, nil
+			},
+		}
+	}
+
+	t.Run("deterministic", func(t *testing.T) {
+		executor := executorReturning("a", "a")
+		_, outputBytes, err := RunModule(context.Background(), executor, output)
+		require.NoError(t, err)
+		assert.NoError(t, ReplayModule(context.Background(), executor, output, outputBytes))
+	})
+
+	t.Run("non deterministic", func(t *testing.T) {
+		executor := executorReturning("a", "b")
+		_, outputBytes, err := RunModule(context.Background(), executor, output)
+		require.NoError(t, err)
+		err = ReplayModule(context.Background(), executor, output, outputBytes)
+		assert.ErrorIs(t, err, ErrNonDeterministicExec)
+		assert.Contains(t, err.Error(), `block 10: module "test"`)
+	})
+}
+
+func TestStoreModuleExecutor_rewind(t *testing.T) {
+	config, err := store.NewConfig("test", 0, "test", pbsubstreams.Module_KindStore_UPDATE_POLICY_SET, "string", dstore.NewMockStore(nil), "")
+	require.NoError(t, err)
+	kv := config.NewFullKV(zap.NewNop())
+	kv.Set(0, "kept", "1")
+	kv.Reset()
+
+	executor := NewStoreModuleExecutor(&BaseExecutor{moduleName: "test"}, kv)
+	kv.Set(5, "kept", "2")
+	kv.Set(6, "added", "3")
+
+	executor.rewind()
+	assert.Empty(t, kv.GetDeltas())
+	value, found := kv.GetLast("kept")
+	assert.True(t, found)
+	assert.Equal(t, "1", string(value))
+	_, found = kv.GetLast("added")
+	assert.False(t, found)
+
+	// the ordinals of the replay start over
+	kv.Set(5, "kept", "2")
+	assert.Len(t, kv.GetDeltas(), 1)
+}
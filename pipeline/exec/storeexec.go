@@ -57,7 +57,11 @@ func (e *StoreModuleExecutor) wrapDeltas() ([]byte, *pbssinternal.ModuleOutput,
 		StoreDeltas: e.outputStore.GetDeltas(),
 	}
 
-	data, err := proto.Marshal(deltas)
+	// The consuming modules only know of per-key operations, the ranged
+	// deletes are only kept compact in the module output, to undo them.
+	data, err := proto.Marshal(&pbssinternal.StoreDeltas{
+		StoreDeltas: store.ExpandDeltas(deltas.StoreDeltas),
+	})
 	if err != nil {
 		return nil, nil, fmt.Errorf("caching: marshalling delta: %w", err)
 	}
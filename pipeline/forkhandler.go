@@ -51,6 +51,15 @@ func (f *ForkHandler) handleUndo(
 	return nil
 }
 
+// reversibleOutput returns the outputs of the modules executed on block
+// `blockID`, nil once it is final.
+func (f *ForkHandler) reversibleOutput(blockID string) []*pbssinternal.ModuleOutput {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return f.reversibleOutputs[blockID]
+}
+
 func (f *ForkHandler) removeReversibleOutput(blockID string) {
 	f.mu.Lock()
 	delete(f.reversibleOutputs, blockID)
@@ -0,0 +1,84 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+
+	pbssinternal "github.com/streamingfast/substreams/pb/sf/substreams/intern/v2"
+	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
+	"github.com/streamingfast/substreams/reqctx"
+	"github.com/streamingfast/substreams/storage/store"
+)
+
+// PipelineHooks lets applications embedding the pipeline observe its execution,
+// to implement custom accounting, caching or data export. Register them
+// with `WithPipelineHooks`, embed `NoopPipelineHooks` to only implement some of them.
+//
+// Hooks are called synchronously from the pipeline's goroutine, they must not
+// block for long. An error returned by a hook fails the request.
+type PipelineHooks interface {
+	// OnBlockStart is called for each new block, before any module is executed.
+	OnBlockStart(ctx context.Context, clock *pbsubstreams.Clock) error
+
+	// OnModuleExecuted is called after each module execution, with the module's
+	// output (which can be nil) and execution error, if any.
+	OnModuleExecuted(ctx context.Context, clock *pbsubstreams.Clock, moduleName string, output *pbssinternal.ModuleOutput, execErr error) error
+
+	// OnStoreFlush is called after a store snapshot has been written.
+	OnStoreFlush(ctx context.Context, storeName string, file *store.FileInfo) error
+
+	// OnStreamEnd is called once when the stream terminates, `err` is the
+	// termination cause, which is `io.EOF` or `stream.ErrStopBlockReached`
+	// on graceful completion. The `clock` is the last final block processed,
+	// it can be nil.
+	OnStreamEnd(ctx context.Context, clock *pbsubstreams.Clock, err error)
+}
+
+var _ PipelineHooks = NoopPipelineHooks{}
+
+type NoopPipelineHooks struct{}
+
+func (NoopPipelineHooks) OnBlockStart(context.Context, *pbsubstreams.Clock) error { return nil }
+func (NoopPipelineHooks) OnModuleExecuted(context.Context, *pbsubstreams.Clock, string, *pbssinternal.ModuleOutput, error) error {
+	return nil
+}
+func (NoopPipelineHooks) OnStoreFlush(context.Context, string, *store.FileInfo) error { return nil }
+func (NoopPipelineHooks) OnStreamEnd(context.Context, *pbsubstreams.Clock, error)     {}
+
+func (p *Pipeline) runOnBlockStartHooks(ctx context.Context, clock *pbsubstreams.Clock) error {
+	for _, hooks := range p.hooks {
+		if err := hooks.OnBlockStart(ctx, clock); err != nil {
+			return fmt.Errorf("on block start hook: %w", err)
+		}
+	}
+	return nil
+}
+
+func (p *Pipeline) runOnModuleExecutedHooks(ctx context.Context, clock *pbsubstreams.Clock, moduleName string, output *pbssinternal.ModuleOutput, execErr error) error {
+	for _, hooks := range p.hooks {
+		if err := hooks.OnModuleExecuted(ctx, clock, moduleName, output, execErr); err != nil {
+			return fmt.Errorf("on module executed hook: %w", err)
+		}
+	}
+	return nil
+}
+
+func (p *Pipeline) runOnStoreFlushHooks(ctx context.Context, storeName string, file *store.FileInfo) error {
+	for _, hooks := range p.hooks {
+		if err := hooks.OnStoreFlush(ctx, storeName, file); err != nil {
+			return fmt.Errorf("on store flush hook: %w", err)
+		}
+	}
+	return nil
+}
+
+func (p *Pipeline) runOnStreamEndHooks(ctx context.Context, clock *pbsubstreams.Clock, err error) {
+	for _, hooks := range p.hooks {
+		hooks.OnStreamEnd(ctx, clock, err)
+	}
+	if len(p.hooks) > 0 {
+		reqctx.Logger(ctx).Debug("pipeline hooks notified of stream end", zap.Int("hooks", len(p.hooks)), zap.Error(err))
+	}
+}
@@ -0,0 +1,51 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	pbssinternal "github.com/streamingfast/substreams/pb/sf/substreams/intern/v2"
+	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingHooks struct {
+	NoopPipelineHooks
+	calls    []string
+	failWith error
+}
+
+func (h *recordingHooks) OnBlockStart(_ context.Context, clock *pbsubstreams.Clock) error {
+	h.calls = append(h.calls, fmt.Sprintf("block_start:%d", clock.Number))
+	return h.failWith
+}
+
+func (h *recordingHooks) OnModuleExecuted(_ context.Context, clock *pbsubstreams.Clock, moduleName string, _ *pbssinternal.ModuleOutput, _ error) error {
+	h.calls = append(h.calls, fmt.Sprintf("module_executed:%d:%s", clock.Number, moduleName))
+	return h.failWith
+}
+
+func TestPipelineHooks(t *testing.T) {
+	ctx := context.Background()
+	clock := &pbsubstreams.Clock{Number: 10}
+
+	first, second := &recordingHooks{}, &recordingHooks{}
+	p := &Pipeline{}
+	WithPipelineHooks(first)(p)
+	WithPipelineHooks(second)(p)
+
+	require.NoError(t, p.runOnBlockStartHooks(ctx, clock))
+	require.NoError(t, p.runOnModuleExecutedHooks(ctx, clock, "map_a", nil, nil))
+	require.NoError(t, p.runOnStoreFlushHooks(ctx, "store_a", nil))
+	p.runOnStreamEndHooks(ctx, clock, nil)
+
+	assert.Equal(t, []string{"block_start:10", "module_executed:10:map_a"}, first.calls)
+	assert.Equal(t, first.calls, second.calls)
+
+	first.failWith = fmt.Errorf("boom")
+	second.calls = nil
+	assert.ErrorContains(t, p.runOnBlockStartHooks(ctx, clock), "on block start hook: boom")
+	assert.Empty(t, second.calls)
+}
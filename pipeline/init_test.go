@@ -80,3 +80,7 @@ func (i *ExecOutputTesting) Set(moduleName string, value []byte) (err error) {
 func (i *ExecOutputTesting) Clock() *pbsubstreams.Clock {
 	return i.clock
 }
+
+func (i *ExecOutputTesting) Final() bool {
+	return true
+}
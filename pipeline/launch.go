@@ -10,9 +10,9 @@ import (
 	"github.com/streamingfast/bstream/stream"
 	"go.uber.org/zap"
 
-	"github.com/streamingfast/substreams/block"
 	pbssinternal "github.com/streamingfast/substreams/pb/sf/substreams/intern/v2"
 	"github.com/streamingfast/substreams/reqctx"
+	"github.com/streamingfast/substreams/storage/store"
 )
 
 const progressMessageInterval = time.Millisecond * 200
@@ -37,6 +37,7 @@ func (p *Pipeline) OnStreamTerminated(ctx context.Context, err error) error {
 	}
 
 	p.runPostJobHooks(ctx, p.lastFinalClock)
+	p.runOnStreamEndHooks(ctx, p.lastFinalClock, err)
 
 	if !errors.Is(err, stream.ErrStopBlockReached) && !errors.Is(err, io.EOF) {
 		return err
@@ -64,6 +65,10 @@ func (p *Pipeline) OnStreamTerminated(ctx context.Context, err error) error {
 	if err := p.stores.flushStores(ctx, reqDetails.StopBlockNum); err != nil {
 		return fmt.Errorf("step new irr: stores end of stream: %w", err)
 	}
+	if err := p.stores.waitSnapshots(ctx); err != nil {
+		return fmt.Errorf("stores end of stream: %w", err)
+	}
+	p.resumePoints.deleteAll(ctx, p.stores.configs)
 
 	p.execOutputCache.Close()
 
@@ -82,11 +87,12 @@ func (p *Pipeline) OnStreamTerminated(ctx context.Context, err error) error {
 	return nil
 }
 
-func toPBInternalBlockRanges(in block.Ranges) (out []*pbssinternal.BlockRange) {
-	for _, r := range in {
+func toPBInternalBlockRanges(in store.FileInfos) (out []*pbssinternal.BlockRange) {
+	for _, file := range in {
 		out = append(out, &pbssinternal.BlockRange{
-			StartBlock: r.StartBlock,
-			EndBlock:   r.ExclusiveEndBlock,
+			StartBlock: file.Range.StartBlock,
+			EndBlock:   file.Range.ExclusiveEndBlock,
+			Size:       file.Size,
 		})
 	}
 	return
@@ -0,0 +1,76 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.uber.org/zap"
+
+	"github.com/streamingfast/substreams"
+	"github.com/streamingfast/substreams/metrics"
+	pbssinternal "github.com/streamingfast/substreams/pb/sf/substreams/intern/v2"
+	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
+	"github.com/streamingfast/substreams/reqctx"
+	"github.com/streamingfast/substreams/wasm"
+)
+
+// returnLimitExceededProgress sends a `Failed` progress message naming the
+// execution limit hit when `execErr` is a wasm.LimitExceededError, the request
+// then failing with `execErr`.
+func (p *Pipeline) returnLimitExceededProgress(ctx context.Context, moduleName string, execErr error) error {
+	var limitErr *wasm.LimitExceededError
+	if !errors.As(execErr, &limitErr) {
+		return nil
+	}
+
+	metrics.ModuleExecutionLimitsExceeded.Inc(limitErr.Limit.String())
+	reqctx.Logger(ctx).Warn("module execution stopped by an execution limit",
+		zap.String("module_name", moduleName),
+		zap.Stringer("limit", limitErr.Limit),
+		zap.Uint64("block_num", limitErr.BlockNum),
+		zap.Uint64("budget", limitErr.Budget()),
+	)
+
+	if p.respFunc == nil {
+		return nil
+	}
+	if err := p.respFunc(toLimitExceededResponse(ctx, moduleName, execErr.Error(), limitErr)); err != nil {
+		return fmt.Errorf("sending failed progress: %w", err)
+	}
+	return nil
+}
+
+func toLimitExceededResponse(ctx context.Context, moduleName, reason string, limitErr *wasm.LimitExceededError) substreams.ResponseFromAnyTier {
+	if reqctx.Details(ctx).IsSubRequest {
+		return &pbssinternal.ProcessRangeResponse{
+			ModuleName: moduleName,
+			Type: &pbssinternal.ProcessRangeResponse_Failed{
+				Failed: &pbssinternal.Failed{
+					Reason: reason,
+					LimitExceeded: &pbssinternal.LimitExceeded{
+						Limit:    pbssinternal.ExecutionLimit(limitErr.Limit),
+						Budget:   limitErr.Budget(),
+						BlockNum: limitErr.BlockNum,
+					},
+				},
+			},
+		}
+	}
+
+	return substreams.NewModulesProgressResponse([]*pbsubstreamsrpc.ModuleProgress{
+		{
+			Name: moduleName,
+			Type: &pbsubstreamsrpc.ModuleProgress_Failed_{
+				Failed: &pbsubstreamsrpc.ModuleProgress_Failed{
+					Reason: reason,
+					LimitExceeded: &pbsubstreamsrpc.ModuleProgress_LimitExceeded{
+						Limit:    pbsubstreamsrpc.ModuleProgress_ExecutionLimit(limitErr.Limit),
+						Budget:   limitErr.Budget(),
+						BlockNum: limitErr.BlockNum,
+					},
+				},
+			},
+		},
+	})
+}
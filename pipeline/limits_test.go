@@ -0,0 +1,79 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/streamingfast/substreams"
+	pbssinternal "github.com/streamingfast/substreams/pb/sf/substreams/intern/v2"
+	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
+	"github.com/streamingfast/substreams/reqctx"
+	"github.com/streamingfast/substreams/wasm"
+)
+
+func TestPipeline_returnLimitExceededProgress(t *testing.T) {
+	limitErr := fmt.Errorf("execute module: %w", &wasm.LimitExceededError{Limit: wasm.ExecutionLimitTimeout, Timeout: 2 * time.Second, BlockNum: 10})
+
+	tests := []struct {
+		name         string
+		isSubRequest bool
+		execErr      error
+		check        func(t *testing.T, resp substreams.ResponseFromAnyTier) // nil when no response is expected
+	}{
+		{
+			name:    "tier1",
+			execErr: limitErr,
+			check: func(t *testing.T, resp substreams.ResponseFromAnyTier) {
+				progress := resp.(*pbsubstreamsrpc.Response).GetProgress().Modules[0]
+				assert.Equal(t, "A", progress.Name)
+				assert.Equal(t, limitErr.Error(), progress.GetFailed().Reason)
+				assert.Equal(t, pbsubstreamsrpc.ModuleProgress_EXECUTION_LIMIT_TIMEOUT, progress.GetFailed().LimitExceeded.Limit)
+				assert.Equal(t, uint64(2000), progress.GetFailed().LimitExceeded.Budget)
+				assert.Equal(t, uint64(10), progress.GetFailed().LimitExceeded.BlockNum)
+			},
+		},
+		{
+			name:         "tier2",
+			isSubRequest: true,
+			execErr:      limitErr,
+			check: func(t *testing.T, resp substreams.ResponseFromAnyTier) {
+				progress := resp.(*pbssinternal.ProcessRangeResponse)
+				assert.Equal(t, "A", progress.ModuleName)
+				assert.Equal(t, pbssinternal.ExecutionLimit_EXECUTION_LIMIT_TIMEOUT, progress.GetFailed().LimitExceeded.Limit)
+				assert.Equal(t, uint64(2000), progress.GetFailed().LimitExceeded.Budget)
+			},
+		},
+		{
+			name:    "other error",
+			execErr: errors.New("panic"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := reqctx.WithRequest(context.Background(), &reqctx.RequestDetails{IsSubRequest: test.isSubRequest})
+
+			var responses []substreams.ResponseFromAnyTier
+			p := &Pipeline{
+				respFunc: func(resp substreams.ResponseFromAnyTier) error {
+					responses = append(responses, resp)
+					return nil
+				},
+			}
+
+			require.NoError(t, p.returnLimitExceededProgress(ctx, "A", test.execErr))
+			if test.check == nil {
+				assert.Empty(t, responses)
+				return
+			}
+			require.Len(t, responses, 1)
+			test.check(t, responses[0])
+		})
+	}
+}
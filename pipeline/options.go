@@ -38,8 +38,53 @@ func WithPostJobHook(f substreams.PostJobHook) Option {
 	}
 }
 
+// WithPipelineHooks registers hooks notified of the pipeline's execution, see `PipelineHooks`.
+func WithPipelineHooks(h PipelineHooks) Option {
+	return func(p *Pipeline) {
+		p.hooks = append(p.hooks, h)
+	}
+}
+
+// WithDeterminismAudit makes the pipeline execute each module a second time
+// on every block it does not read from the cache, failing with
+// exec.ErrNonDeterministicExec when the two outputs differ, before anything
+// is written from them.
+func WithDeterminismAudit() Option {
+	return func(p *Pipeline) {
+		p.determinismAudit = true
+	}
+}
+
 func WithFinalBlocksOnly() Option {
 	return func(p *Pipeline) {
 		p.finalBlocksOnly = true
 	}
 }
+
+// WithStoreDeltaModules sends back the deltas of the stores `names` with each
+// block, in production mode too, see `BlockScopedData.store_outputs`.
+func WithStoreDeltaModules(names []string) Option {
+	return func(p *Pipeline) {
+		p.storeDeltaModules = make(map[string]bool, len(names))
+		for _, name := range names {
+			p.storeDeltaModules[name] = true
+		}
+	}
+}
+
+// WithOutputSampling only sends back the outputs of every Nth block, plus the
+// outputs of any block where a module produced data, deltas or logs. It is meant
+// for development mode clients that cannot render outputs as fast as they are produced.
+func WithOutputSampling(every uint64) Option {
+	return func(p *Pipeline) {
+		p.outputSampler = newOutputSampler(every)
+	}
+}
+
+// WithStopConditions ends the stream, before its stop block, as soon as one of
+// `conditions` is met, see `TerminationReason`.
+func WithStopConditions(conditions *pbsubstreamsrpc.StopConditions) Option {
+	return func(p *Pipeline) {
+		p.stopConditions = newStopConditions(conditions)
+	}
+}
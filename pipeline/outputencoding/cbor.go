@@ -0,0 +1,172 @@
+package outputencoding
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// CBOR major types, see RFC 8949 section 3.1.
+const (
+	cborUnsigned byte = iota << 5
+	cborNegative
+	cborBytes
+	cborText
+	cborArray
+	cborMap
+)
+
+const (
+	cborFalse   byte = 0xf4
+	cborTrue    byte = 0xf5
+	cborFloat32 byte = 0xfa
+	cborFloat64 byte = 0xfb
+)
+
+// marshalCBOR encodes `message` as a map of its set fields, by field number,
+// keyed by their JSON names. Map fields are encoded with their keys sorted
+// bytewise, so the encoding of a message is deterministic.
+func marshalCBOR(message protoreflect.Message) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := writeMessage(buf, message); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeMessage(buf *bytes.Buffer, message protoreflect.Message) error {
+	var fields []protoreflect.FieldDescriptor
+	message.Range(func(field protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+		fields = append(fields, field)
+		return true
+	})
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Number() < fields[j].Number() })
+
+	writeHead(buf, cborMap, uint64(len(fields)))
+	for _, field := range fields {
+		writeText(buf, field.JSONName())
+		if err := writeField(buf, field, message.Get(field)); err != nil {
+			return fmt.Errorf("field %s: %w", field.Name(), err)
+		}
+	}
+	return nil
+}
+
+func writeField(buf *bytes.Buffer, field protoreflect.FieldDescriptor, value protoreflect.Value) error {
+	switch {
+	case field.IsList():
+		list := value.List()
+		writeHead(buf, cborArray, uint64(list.Len()))
+		for i := 0; i < list.Len(); i++ {
+			if err := writeValue(buf, field, list.Get(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case field.IsMap():
+		type entry struct {
+			key   []byte
+			value protoreflect.Value
+		}
+		var entries []entry
+		var err error
+		value.Map().Range(func(key protoreflect.MapKey, value protoreflect.Value) bool {
+			keyBuf := &bytes.Buffer{}
+			if err = writeValue(keyBuf, field.MapKey(), key.Value()); err != nil {
+				return false
+			}
+			entries = append(entries, entry{key: keyBuf.Bytes(), value: value})
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		sort.Slice(entries, func(i, j int) bool { return bytes.Compare(entries[i].key, entries[j].key) < 0 })
+
+		writeHead(buf, cborMap, uint64(len(entries)))
+		for _, entry := range entries {
+			buf.Write(entry.key)
+			if err := writeValue(buf, field.MapValue(), entry.value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return writeValue(buf, field, value)
+}
+
+func writeValue(buf *bytes.Buffer, field protoreflect.FieldDescriptor, value protoreflect.Value) error {
+	switch field.Kind() {
+	case protoreflect.BoolKind:
+		if value.Bool() {
+			buf.WriteByte(cborTrue)
+		} else {
+			buf.WriteByte(cborFalse)
+		}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		writeInt(buf, value.Int())
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind, protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		writeHead(buf, cborUnsigned, value.Uint())
+	case protoreflect.FloatKind:
+		buf.WriteByte(cborFloat32)
+		binary.Write(buf, binary.BigEndian, math.Float32bits(float32(value.Float())))
+	case protoreflect.DoubleKind:
+		buf.WriteByte(cborFloat64)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(value.Float()))
+	case protoreflect.StringKind:
+		writeText(buf, value.String())
+	case protoreflect.BytesKind:
+		writeHead(buf, cborBytes, uint64(len(value.Bytes())))
+		buf.Write(value.Bytes())
+	case protoreflect.EnumKind:
+		if enumValue := field.Enum().Values().ByNumber(value.Enum()); enumValue != nil {
+			writeText(buf, string(enumValue.Name()))
+		} else {
+			writeInt(buf, int64(value.Enum()))
+		}
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return writeMessage(buf, value.Message())
+	default:
+		return fmt.Errorf("unsupported kind %s", field.Kind())
+	}
+	return nil
+}
+
+func writeInt(buf *bytes.Buffer, value int64) {
+	if value < 0 {
+		writeHead(buf, cborNegative, uint64(-(value + 1)))
+		return
+	}
+	writeHead(buf, cborUnsigned, uint64(value))
+}
+
+func writeText(buf *bytes.Buffer, value string) {
+	writeHead(buf, cborText, uint64(len(value)))
+	buf.WriteString(value)
+}
+
+// writeHead writes the initial byte of an item of type `major` and its
+// argument `n`, in the shortest form.
+func writeHead(buf *bytes.Buffer, major byte, n uint64) {
+	switch {
+	case n < 24:
+		buf.WriteByte(major | byte(n))
+	case n <= math.MaxUint8:
+		buf.Write([]byte{major | 24, byte(n)})
+	case n <= math.MaxUint16:
+		buf.WriteByte(major | 25)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	case n <= math.MaxUint32:
+		buf.WriteByte(major | 26)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	default:
+		buf.WriteByte(major | 27)
+		binary.Write(buf, binary.BigEndian, n)
+	}
+}
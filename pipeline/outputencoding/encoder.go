@@ -0,0 +1,214 @@
+// Package outputencoding re-encodes the map module outputs, protobuf messages
+// described by the proto files of the package, to JSON or CBOR before they are
+// sent to the client, see `Request.output_encoding`.
+package outputencoding
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
+)
+
+type Encoder struct {
+	encoding pbsubstreamsrpc.OutputEncoding
+	files    *protoregistry.Files
+
+	lock  sync.Mutex
+	types map[string]protoreflect.MessageType // by type URL
+}
+
+// Stats is the cost of re-encoding the outputs of a response.
+type Stats struct {
+	Outputs  int
+	Bytes    int // size of the re-encoded outputs
+	Duration time.Duration
+}
+
+// New returns the encoder of the outputs to `encoding`, or nil when the outputs
+// are sent as is.
+func New(encoding pbsubstreamsrpc.OutputEncoding, protoFiles []*descriptorpb.FileDescriptorProto) (*Encoder, error) {
+	switch encoding {
+	case pbsubstreamsrpc.OutputEncoding_OUTPUT_ENCODING_PROTOBUF:
+		return nil, nil
+	case pbsubstreamsrpc.OutputEncoding_OUTPUT_ENCODING_JSON, pbsubstreamsrpc.OutputEncoding_OUTPUT_ENCODING_CBOR:
+	default:
+		return nil, fmt.Errorf("unknown output encoding %d", encoding)
+	}
+
+	if len(protoFiles) == 0 {
+		return nil, fmt.Errorf("output encoding %s requires the output proto files", encoding)
+	}
+	files, err := newFiles(protoFiles)
+	if err != nil {
+		return nil, fmt.Errorf("output proto files: %w", err)
+	}
+
+	return &Encoder{
+		encoding: encoding,
+		files:    files,
+		types:    map[string]protoreflect.MessageType{},
+	}, nil
+}
+
+// newFiles registers `protoFiles`, in any order, their imports not found in
+// `protoFiles` being resolved from the files linked in this binary (ex:
+// `google/protobuf/timestamp.proto`).
+func newFiles(protoFiles []*descriptorpb.FileDescriptorProto) (*protoregistry.Files, error) {
+	files := &protoregistry.Files{}
+	resolver := &fallbackResolver{files: files}
+
+	pending := protoFiles
+	for len(pending) != 0 {
+		var retry []*descriptorpb.FileDescriptorProto
+		var lastErr error
+		for _, protoFile := range pending {
+			file, err := protodesc.NewFile(protoFile, resolver)
+			if err != nil {
+				// an import of the file may come later in the list
+				retry = append(retry, protoFile)
+				lastErr = fmt.Errorf("file %q: %w", protoFile.GetName(), err)
+				continue
+			}
+			if err := files.RegisterFile(file); err != nil {
+				return nil, fmt.Errorf("registering file %q: %w", protoFile.GetName(), err)
+			}
+		}
+		if len(retry) == len(pending) {
+			return nil, lastErr
+		}
+		pending = retry
+	}
+	return files, nil
+}
+
+type fallbackResolver struct {
+	files *protoregistry.Files
+}
+
+func (r *fallbackResolver) FindFileByPath(path string) (protoreflect.FileDescriptor, error) {
+	if file, err := r.files.FindFileByPath(path); err == nil {
+		return file, nil
+	}
+	return protoregistry.GlobalFiles.FindFileByPath(path)
+}
+
+func (r *fallbackResolver) FindDescriptorByName(name protoreflect.FullName) (protoreflect.Descriptor, error) {
+	if descriptor, err := r.files.FindDescriptorByName(name); err == nil {
+		return descriptor, nil
+	}
+	return protoregistry.GlobalFiles.FindDescriptorByName(name)
+}
+
+// Encode decodes `output` and re-encodes it.
+func (e *Encoder) Encode(output *anypb.Any) ([]byte, error) {
+	messageType, err := e.messageType(output.TypeUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	message := messageType.New().Interface()
+	if err := proto.Unmarshal(output.Value, message); err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", output.TypeUrl, err)
+	}
+
+	if e.encoding == pbsubstreamsrpc.OutputEncoding_OUTPUT_ENCODING_JSON {
+		return protojson.MarshalOptions{Resolver: e}.Marshal(message)
+	}
+	return marshalCBOR(message.ProtoReflect())
+}
+
+func (e *Encoder) messageType(typeURL string) (protoreflect.MessageType, error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if messageType, found := e.types[typeURL]; found {
+		return messageType, nil
+	}
+
+	messageType, err := e.FindMessageByURL(typeURL)
+	if err != nil {
+		return nil, err
+	}
+	e.types[typeURL] = messageType
+	return messageType, nil
+}
+
+// FindMessageByURL implements the protojson resolver, for the `Any` fields of
+// the outputs.
+func (e *Encoder) FindMessageByURL(url string) (protoreflect.MessageType, error) {
+	return e.FindMessageByName(protoreflect.FullName(url[strings.LastIndex(url, "/")+1:]))
+}
+
+func (e *Encoder) FindMessageByName(name protoreflect.FullName) (protoreflect.MessageType, error) {
+	descriptor, err := e.files.FindDescriptorByName(name)
+	if err != nil {
+		if messageType, globalErr := protoregistry.GlobalTypes.FindMessageByName(name); globalErr == nil {
+			return messageType, nil
+		}
+		return nil, fmt.Errorf("message %q not found in the output proto files: %w", name, err)
+	}
+
+	messageDescriptor, ok := descriptor.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%q is not a message", name)
+	}
+	return dynamicpb.NewMessageType(messageDescriptor), nil
+}
+
+func (e *Encoder) FindExtensionByName(field protoreflect.FullName) (protoreflect.ExtensionType, error) {
+	return protoregistry.GlobalTypes.FindExtensionByName(field)
+}
+
+func (e *Encoder) FindExtensionByNumber(message protoreflect.FullName, field protoreflect.FieldNumber) (protoreflect.ExtensionType, error) {
+	return protoregistry.GlobalTypes.FindExtensionByNumber(message, field)
+}
+
+// EncodeResponse replaces the map outputs of `resp`, if it is a
+// BlockScopedData, by their re-encoding.
+func (e *Encoder) EncodeResponse(resp *pbsubstreamsrpc.Response) (*Stats, error) {
+	data := resp.GetBlockScopedData()
+	if data == nil {
+		return nil, nil
+	}
+
+	start := time.Now()
+	stats := &Stats{}
+	for _, output := range append([]*pbsubstreamsrpc.MapModuleOutput{data.Output}, data.DebugMapOutputs...) {
+		if output == nil || output.MapOutput == nil {
+			continue
+		}
+
+		value, err := e.Encode(output.MapOutput)
+		if err != nil {
+			return nil, fmt.Errorf("encoding output of module %q: %w", output.Name, err)
+		}
+		output.EncodedOutput = &pbsubstreamsrpc.EncodedOutput{
+			TypeUrl:  output.MapOutput.TypeUrl,
+			Encoding: e.encoding,
+			Value:    value,
+		}
+		output.MapOutput = nil
+
+		stats.Outputs++
+		stats.Bytes += len(value)
+	}
+	stats.Duration = time.Since(start)
+	return stats, nil
+}
+
+// Name is the name of the encoding, as used in the metering.
+func (e *Encoder) Name() string {
+	return strings.ToLower(strings.TrimPrefix(e.encoding.String(), "OUTPUT_ENCODING_"))
+}
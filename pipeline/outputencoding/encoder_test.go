@@ -0,0 +1,68 @@
+package outputencoding
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
+	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
+)
+
+func TestEncoder(t *testing.T) {
+	protoFiles := []*descriptorpb.FileDescriptorProto{
+		protodesc.ToFileDescriptorProto(pbsubstreams.File_sf_substreams_v1_clock_proto),
+	}
+	output, err := anypb.New(&pbsubstreams.Clock{Id: "a", Number: 1})
+	require.NoError(t, err)
+
+	encoder, err := New(pbsubstreamsrpc.OutputEncoding_OUTPUT_ENCODING_JSON, protoFiles)
+	require.NoError(t, err)
+	value, err := encoder.Encode(output)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"id":"a","number":"1"}`, string(value))
+
+	encoder, err = New(pbsubstreamsrpc.OutputEncoding_OUTPUT_ENCODING_CBOR, protoFiles)
+	require.NoError(t, err)
+	value, err = encoder.Encode(output)
+	require.NoError(t, err)
+	// {"id": "a", "number": 1}
+	assert.Equal(t, "a2"+"626964"+"6161"+"666e756d626572"+"01", hex.EncodeToString(value))
+}
+
+func TestNew(t *testing.T) {
+	encoder, err := New(pbsubstreamsrpc.OutputEncoding_OUTPUT_ENCODING_PROTOBUF, nil)
+	require.NoError(t, err)
+	assert.Nil(t, encoder)
+
+	_, err = New(pbsubstreamsrpc.OutputEncoding_OUTPUT_ENCODING_JSON, nil)
+	assert.Error(t, err)
+}
+
+func TestEncoder_EncodeResponse(t *testing.T) {
+	encoder, err := New(pbsubstreamsrpc.OutputEncoding_OUTPUT_ENCODING_CBOR, []*descriptorpb.FileDescriptorProto{
+		protodesc.ToFileDescriptorProto(pbsubstreams.File_sf_substreams_v1_clock_proto),
+	})
+	require.NoError(t, err)
+
+	output, err := anypb.New(&pbsubstreams.Clock{Number: 1})
+	require.NoError(t, err)
+	resp := &pbsubstreamsrpc.Response{Message: &pbsubstreamsrpc.Response_BlockScopedData{BlockScopedData: &pbsubstreamsrpc.BlockScopedData{
+		Output: &pbsubstreamsrpc.MapModuleOutput{Name: "map_clock", MapOutput: output},
+	}}}
+
+	stats, err := encoder.EncodeResponse(resp)
+	require.NoError(t, err)
+	assert.Equal(t, 1, stats.Outputs)
+	assert.Equal(t, 9, stats.Bytes)
+
+	out := resp.GetBlockScopedData().Output
+	assert.Nil(t, out.MapOutput)
+	assert.Equal(t, "type.googleapis.com/sf.substreams.v1.Clock", out.EncodedOutput.TypeUrl)
+	assert.Equal(t, "cbor", encoder.Name())
+}
@@ -2,8 +2,12 @@ package outputmodules
 
 import (
 	"fmt"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/streamingfast/substreams/manifest"
+	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
 	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
 )
 
@@ -14,38 +18,160 @@ type Graph struct {
 	moduleHashes      *manifest.ModuleHashes
 	stores            []*pbsubstreams.Module // subset of allModules: only the stores
 
-	outputModule *pbsubstreams.Module
+	outputModule  *pbsubstreams.Module
+	outputModules []*pbsubstreams.Module // outputModule first, then the other modules whose outputs are streamed
 
 	schedulableModules      []*pbsubstreams.Module // stores and output mappers needed to execute to produce output for all `output_modules`.
 	schedulableAncestorsMap map[string][]string    // modules that are ancestors (therefore dependencies) of a given module
 }
 
 func (g *Graph) OutputModule() *pbsubstreams.Module          { return g.outputModule }
+func (g *Graph) OutputModules() []*pbsubstreams.Module       { return g.outputModules }
 func (g *Graph) Stores() []*pbsubstreams.Module              { return g.stores }
 func (g *Graph) UsedModules() []*pbsubstreams.Module         { return g.usedModules }
 func (g *Graph) StagedUsedModules() [][]*pbsubstreams.Module { return g.stagedUsedModules }
-func (g *Graph) IsOutputModule(name string) bool             { return g.outputModule.Name == name }
 func (g *Graph) ModuleHashes() *manifest.ModuleHashes        { return g.moduleHashes }
 
+func (g *Graph) IsOutputModule(name string) bool {
+	for _, module := range g.outputModules {
+		if module.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// OutputMapperNames returns the names of the output modules which are maps,
+// whose outputs are cached, in order.
+func (g *Graph) OutputMapperNames() (out []string) {
+	for _, module := range g.outputModules {
+		if module.GetKindStore() == nil {
+			out = append(out, module.Name)
+		}
+	}
+	return
+}
+
+// ValidateStoreDeltaModules checks that the stores whose deltas are streamed
+// to the client are executed to produce the output module.
+func (g *Graph) ValidateStoreDeltaModules(names []string) error {
+	for _, name := range names {
+		found := false
+		for _, store := range g.stores {
+			if store.Name == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("store deltas for module %q: not a store the output module %q depends on", name, g.outputModule.Name)
+		}
+	}
+	return nil
+}
+
+// ValidateStopConditions checks that the store whose value stops the stream
+// is executed to produce the output module.
+func (g *Graph) ValidateStopConditions(conditions *pbsubstreamsrpc.StopConditions) error {
+	storeValue := conditions.GetStoreValue()
+	if storeValue == nil {
+		return nil
+	}
+	for _, store := range g.stores {
+		if store.Name == storeValue.ModuleName {
+			return nil
+		}
+	}
+	return fmt.Errorf("stop condition on store value: %q is not a store the output module %q depends on", storeValue.ModuleName, g.outputModule.Name)
+}
+
+// ValidateStoreSeeds checks that the stores seeded from a URL fetch it from
+// one of `allowedURLPrefixes`.
+func (g *Graph) ValidateStoreSeeds(allowedURLPrefixes []string) error {
+	for _, store := range g.stores {
+		url := store.GetKindStore().GetSeed().GetUrl()
+		if url == "" {
+			continue
+		}
+		allowed := false
+		for _, prefix := range allowedURLPrefixes {
+			if strings.HasPrefix(url, prefix) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("store %q: seed url %q is not allowed on this endpoint", store.Name, url)
+		}
+	}
+	return nil
+}
+
+// DeprecatedModules returns the warnings about the modules executed that their
+// package deprecates, ordered by name. They are flagged `Sunset` once past
+// their sunset date at `now`.
+func (g *Graph) DeprecatedModules(now time.Time) (out []*pbsubstreamsrpc.DeprecatedModule) {
+	for _, module := range g.usedModules {
+		if module.Deprecation == nil {
+			continue
+		}
+		out = append(out, &pbsubstreamsrpc.DeprecatedModule{
+			ModuleName:  module.Name,
+			Deprecation: module.Deprecation,
+			Sunset:      sunsetPassed(module.Deprecation, now),
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ModuleName < out[j].ModuleName })
+	return out
+}
+
+// ValidateSunsets checks that none of the modules executed is past its
+// deprecation sunset date at `now`.
+func (g *Graph) ValidateSunsets(now time.Time) error {
+	for _, deprecated := range g.DeprecatedModules(now) {
+		if !deprecated.Sunset {
+			continue
+		}
+		msg := fmt.Sprintf("module %q was sunset on %s", deprecated.ModuleName, deprecated.Deprecation.Sunset.AsTime().UTC().Format(time.RFC3339))
+		if deprecated.Deprecation.Replacement != "" {
+			msg += fmt.Sprintf(", use %q instead", deprecated.Deprecation.Replacement)
+		}
+		if deprecated.Deprecation.Message != "" {
+			msg += ": " + deprecated.Deprecation.Message
+		}
+		return fmt.Errorf("%s (set `allow_sunset_modules` on the request to run it anyway)", msg)
+	}
+	return nil
+}
+
+func sunsetPassed(deprecation *pbsubstreams.Module_Deprecation, now time.Time) bool {
+	return deprecation.Sunset != nil && !now.Before(deprecation.Sunset.AsTime())
+}
+
 func NewOutputModuleGraph(outputModule string, productionMode bool, modules *pbsubstreams.Modules) (out *Graph, err error) {
+	return NewOutputModulesGraph([]string{outputModule}, productionMode, modules)
+}
+
+// NewOutputModulesGraph is NewOutputModuleGraph for the requests streaming the
+// outputs of several modules, the first one being the `OutputModule()`.
+func NewOutputModulesGraph(outputModules []string, productionMode bool, modules *pbsubstreams.Modules) (out *Graph, err error) {
 	out = &Graph{
 		requestModules: modules,
 	}
-	if err := out.computeGraph(outputModule, productionMode, modules); err != nil {
+	if err := out.computeGraph(outputModules, productionMode, modules); err != nil {
 		return nil, fmt.Errorf("module graph: %w", err)
 	}
 
 	return out, nil
 }
 
-func (g *Graph) computeGraph(outputModule string, productionMode bool, modules *pbsubstreams.Modules) error {
+func (g *Graph) computeGraph(outputModules []string, productionMode bool, modules *pbsubstreams.Modules) error {
 	graph, err := manifest.NewModuleGraph(modules.Modules)
 	if err != nil {
 		return fmt.Errorf("compute graph: %w", err)
 	}
-	outputModuleName := outputModule
 
-	processModules, err := graph.ModulesDownTo(outputModuleName)
+	processModules, err := modulesDownTo(graph, outputModules, graph.ModulesDownTo)
 	if err != nil {
 		return fmt.Errorf("building execution moduleGraph: %w", err)
 	}
@@ -56,15 +182,18 @@ func (g *Graph) computeGraph(outputModule string, productionMode bool, modules *
 		return fmt.Errorf("cannot hash module: %w", err)
 	}
 
-	g.outputModule = computeOutputModule(g.usedModules, outputModuleName)
+	for _, outputModuleName := range outputModules {
+		g.outputModules = append(g.outputModules, computeOutputModule(g.usedModules, outputModuleName))
+	}
+	g.outputModule = g.outputModules[0]
 
-	storeModules, err := graph.StoresDownTo(g.outputModule.Name)
+	storeModules, err := modulesDownTo(graph, outputModules, graph.StoresDownTo)
 	if err != nil {
 		return fmt.Errorf("stores down: %w", err)
 	}
 	g.stores = storeModules
 
-	g.schedulableModules = computeSchedulableModules(storeModules, g.outputModule, productionMode)
+	g.schedulableModules = computeSchedulableModules(storeModules, g.outputModules, productionMode)
 
 	ancestorsMap, err := computeSchedulableAncestors(graph, g.schedulableModules)
 	if err != nil {
@@ -75,6 +204,36 @@ func (g *Graph) computeGraph(outputModule string, productionMode bool, modules *
 	return nil
 }
 
+// modulesDownTo returns the modules `downTo` returns for each of the
+// `outputModules`, once, in the order it returns them.
+func modulesDownTo(graph *manifest.ModuleGraph, outputModules []string, downTo func(string) ([]*pbsubstreams.Module, error)) ([]*pbsubstreams.Module, error) {
+	if len(outputModules) == 1 {
+		return downTo(outputModules[0])
+	}
+
+	known := map[string]bool{}
+	for _, outputModule := range outputModules {
+		modules, err := downTo(outputModule)
+		if err != nil {
+			return nil, err
+		}
+		for _, module := range modules {
+			known[module.Name] = true
+		}
+	}
+
+	sorted, ok := graph.TopologicalSortKnownModules(known)
+	if !ok {
+		return nil, fmt.Errorf("could not get topological sort of module graph")
+	}
+	// dependencies first, like `downTo`
+	out := make([]*pbsubstreams.Module, len(sorted))
+	for i, module := range sorted {
+		out[len(sorted)-1-i] = module
+	}
+	return out, nil
+}
+
 func computeStages(mods []*pbsubstreams.Module) (stages [][]*pbsubstreams.Module) {
 	seen := map[string]bool{}
 
@@ -86,7 +245,7 @@ func computeStages(mods []*pbsubstreams.Module) (stages [][]*pbsubstreams.Module
 	modLoop:
 		for _, mod := range mods {
 			switch mod.Kind.(type) {
-			case *pbsubstreams.Module_KindMap_:
+			case *pbsubstreams.Module_KindMap_, *pbsubstreams.Module_KindBlockIndex_:
 				if i%2 == 0 {
 					continue
 				}
@@ -118,6 +277,10 @@ func computeStages(mods []*pbsubstreams.Module) (stages [][]*pbsubstreams.Module
 					continue modLoop
 				}
 			}
+			// the block index filtering a module is executed before it
+			if filter := mod.BlockFilter; filter != nil && !seen[filter.Module] {
+				continue
+			}
 
 			stage = append(stage, mod)
 		}
@@ -141,16 +304,18 @@ func computeOutputModule(mods []*pbsubstreams.Module, outputModule string) *pbsu
 
 }
 
-func computeSchedulableModules(stores []*pbsubstreams.Module, outputModule *pbsubstreams.Module, productionMode bool) []*pbsubstreams.Module {
+func computeSchedulableModules(stores []*pbsubstreams.Module, outputModules []*pbsubstreams.Module, productionMode bool) []*pbsubstreams.Module {
 	if !productionMode { // dev never schedules maps, all stores are in there
 		return stores
 	}
 
-	if outputModule.GetKindStore() != nil {
-		return stores
+	out := stores
+	for _, outputModule := range outputModules {
+		if outputModule.GetKindStore() == nil {
+			out = append(out, outputModule)
+		}
 	}
-
-	return append(stores, outputModule)
+	return out
 }
 
 func computeSchedulableAncestors(graph *manifest.ModuleGraph, schedulableModules []*pbsubstreams.Module) (out map[string][]string, err error) {
@@ -191,8 +356,10 @@ func (g *Graph) hashModules(graph *manifest.ModuleGraph) error {
 }
 
 func (g *Graph) ValidateRequestStartBlock(requestStartBlockNum uint64) error {
-	if requestStartBlockNum < g.outputModule.InitialBlock {
-		return fmt.Errorf("start block %d smaller than request outputs for module %q with start block %d", requestStartBlockNum, g.outputModule.Name, g.outputModule.InitialBlock)
+	for _, outputModule := range g.outputModules {
+		if requestStartBlockNum < outputModule.InitialBlock {
+			return fmt.Errorf("start block %d smaller than request outputs for module %q with start block %d", requestStartBlockNum, outputModule.Name, outputModule.InitialBlock)
+		}
 	}
 	return nil
 }
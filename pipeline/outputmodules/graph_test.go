@@ -2,10 +2,14 @@ package outputmodules
 
 import (
 	"testing"
+	"time"
 
+	"github.com/streamingfast/substreams/manifest"
 	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
 	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 func TestGraph_computeSchedulableModules(t *testing.T) {
@@ -47,10 +51,51 @@ func TestGraph_computeSchedulableModules(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			out := computeSchedulableModules(test.stores, test.outputModule, test.productionMode)
+			out := computeSchedulableModules(test.stores, []*pbsubstreams.Module{test.outputModule}, test.productionMode)
 
 			assert.Equal(t, test.expect, out)
 		})
 	}
 
 }
+
+func TestGraph_DeprecatedModules(t *testing.T) {
+	sunset := time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC)
+	storeA := pbsubstreamsrpc.TestNewStoreModule("store_a")
+	storeA.Deprecation = &pbsubstreams.Module_Deprecation{Message: "moved", Sunset: timestamppb.New(sunset), Replacement: "store_c"}
+	mapA := pbsubstreamsrpc.TestNewMapModule("map_a")
+	mapA.Deprecation = &pbsubstreams.Module_Deprecation{Message: "no sunset yet"}
+	g := &Graph{usedModules: []*pbsubstreams.Module{storeA, pbsubstreamsrpc.TestNewStoreModule("store_b"), mapA}}
+
+	deprecated := g.DeprecatedModules(sunset.Add(-time.Hour))
+	require.Len(t, deprecated, 2)
+	assert.Equal(t, "map_a", deprecated[0].ModuleName)
+	assert.Equal(t, "store_a", deprecated[1].ModuleName)
+	assert.False(t, deprecated[1].Sunset)
+	assert.NoError(t, g.ValidateSunsets(sunset.Add(-time.Hour)))
+
+	deprecated = g.DeprecatedModules(sunset)
+	assert.True(t, deprecated[1].Sunset)
+	assert.False(t, deprecated[0].Sunset)
+	assert.EqualError(t, g.ValidateSunsets(sunset), `module "store_a" was sunset on 2025-01-31T00:00:00Z, use "store_c" instead: moved (set `+"`allow_sunset_modules`"+` on the request to run it anyway)`)
+}
+
+func TestNewOutputModulesGraph(t *testing.T) {
+	modules := &pbsubstreams.Modules{Modules: manifest.NewTestModules(), Binaries: []*pbsubstreams.Binary{{}}}
+
+	g, err := NewOutputModulesGraph([]string{"D", "C"}, true, modules)
+	require.NoError(t, err)
+
+	assert.Equal(t, "D", g.OutputModule().Name)
+	assert.Equal(t, []string{"D", "C"}, moduleNames(g.OutputModules()))
+	assert.True(t, g.IsOutputModule("C"))
+	assert.False(t, g.IsOutputModule("B"))
+	assert.ElementsMatch(t, []string{"Am", "B", "D", "As", "C"}, moduleNames(g.UsedModules()))
+	assert.ElementsMatch(t, []string{"As", "B"}, moduleNames(g.Stores()))
+	assert.ElementsMatch(t, []string{"As", "B", "D", "C"}, g.SchedulableModuleNames())
+
+	single, err := NewOutputModuleGraph("D", true, modules)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"D"}, moduleNames(single.OutputModules()))
+	assert.Equal(t, []string{"Am", "B", "D"}, moduleNames(single.UsedModules()))
+}
@@ -3,9 +3,11 @@ package outputmodules
 import pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
 
 func TestNew() *Graph {
+	outputModule := &pbsubstreams.Module{
+		Name: "",
+	}
 	return &Graph{
-		outputModule: &pbsubstreams.Module{
-			Name: "",
-		},
+		outputModule:  outputModule,
+		outputModules: []*pbsubstreams.Module{outputModule},
 	}
 }
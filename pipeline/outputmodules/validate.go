@@ -18,10 +18,16 @@ func ValidateTier1Request(request *pbsubstreamsrpc.Request, blockType string) er
 		return fmt.Errorf("validate tier1 request: %s", err)
 	}
 
-	err := validateRequest(request.Modules.Binaries, request.Modules, request.OutputModule, blockType)
+	outputModules := request.OutputModuleNames()
+	err := validateRequest(request.Modules.Binaries, request.Modules, outputModules[0], blockType)
 	if err != nil {
 		return err
 	}
+	for _, outputModule := range outputModules[1:] {
+		if err := validateModuleGraph(request.Modules.Modules, outputModule, blockType); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
@@ -36,9 +42,38 @@ func ValidateTier2Request(request *pbssinternal.ProcessRangeRequest, blockType s
 		return err
 	}
 
+	if request.CachedOutputModule != "" {
+		if err := validateCachedOutputModule(request.Modules.Modules, request.OutputModule, request.CachedOutputModule, blockType); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// validateCachedOutputModule checks that `cachedOutputModule`, executed along
+// with the `outputModule` store, depends on it.
+func validateCachedOutputModule(mods []*pbsubstreams.Module, outputModule, cachedOutputModule string, blockType string) error {
+	if err := validateModuleGraph(mods, cachedOutputModule, blockType); err != nil {
+		return err
+	}
+
+	graph, err := manifest.NewModuleGraph(mods)
+	if err != nil {
+		return fmt.Errorf("should have been able to derive modules graph: %w", err)
+	}
+	ancestors, err := graph.AncestorStoresOf(cachedOutputModule)
+	if err != nil {
+		return fmt.Errorf("computing ancestors of %q: %w", cachedOutputModule, err)
+	}
+	for _, ancestor := range ancestors {
+		if ancestor.Name == outputModule {
+			return nil
+		}
+	}
+	return fmt.Errorf("cached output module %q does not depend on store %q", cachedOutputModule, outputModule)
+}
+
 func validateRequest(binaries []*pbsubstreams.Binary, modules *pbsubstreams.Modules, outputModule string, blockType string) error {
 	if err := validateBinaryTypes(binaries); err != nil {
 		return err
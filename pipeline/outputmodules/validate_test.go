@@ -90,3 +90,22 @@ func addOutputModule(req *pbsubstreamsrpc.Request, outputModule, kind string) {
 	req.OutputModule = outputModule
 
 }
+
+func Test_validateCachedOutputModule(t *testing.T) {
+	testBlockType := "sf.substreams.v1.test.Block"
+	source := &pbsubstreams.Module_Input{Input: &pbsubstreams.Module_Input_Source_{Source: &pbsubstreams.Module_Input_Source{Type: testBlockType}}}
+	storeInput := func(name string) *pbsubstreams.Module_Input {
+		return &pbsubstreams.Module_Input{Input: &pbsubstreams.Module_Input_Store_{Store: &pbsubstreams.Module_Input_Store{ModuleName: name}}}
+	}
+	mods := []*pbsubstreams.Module{
+		{Name: "store_a", Kind: &pbsubstreams.Module_KindStore_{KindStore: &pbsubstreams.Module_KindStore{}}, Inputs: []*pbsubstreams.Module_Input{source}},
+		{Name: "store_b", Kind: &pbsubstreams.Module_KindStore_{KindStore: &pbsubstreams.Module_KindStore{}}, Inputs: []*pbsubstreams.Module_Input{storeInput("store_a")}},
+		{Name: "store_c", Kind: &pbsubstreams.Module_KindStore_{KindStore: &pbsubstreams.Module_KindStore{}}, Inputs: []*pbsubstreams.Module_Input{source}},
+		{Name: "map_out", Kind: &pbsubstreams.Module_KindMap_{KindMap: &pbsubstreams.Module_KindMap{}}, Inputs: []*pbsubstreams.Module_Input{source, storeInput("store_b")}},
+	}
+
+	require.NoError(t, validateCachedOutputModule(mods, "store_b", "map_out", testBlockType))
+	require.NoError(t, validateCachedOutputModule(mods, "store_a", "map_out", testBlockType), "transitive dependency")
+	require.EqualError(t, validateCachedOutputModule(mods, "store_c", "map_out", testBlockType), `cached output module "map_out" does not depend on store "store_c"`)
+	require.Error(t, validateCachedOutputModule(mods, "store_b", "map_out", "other.Block"))
+}
@@ -3,6 +3,7 @@ package pipeline
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
@@ -14,6 +15,7 @@ import (
 	"github.com/streamingfast/dauth"
 
 	"github.com/streamingfast/substreams"
+	"github.com/streamingfast/substreams/metrics"
 	"github.com/streamingfast/substreams/orchestrator"
 	pbssinternal "github.com/streamingfast/substreams/pb/sf/substreams/intern/v2"
 	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
@@ -25,6 +27,7 @@ import (
 	"github.com/streamingfast/substreams/service/config"
 	"github.com/streamingfast/substreams/storage/execout"
 	"github.com/streamingfast/substreams/storage/store"
+	pbstore "github.com/streamingfast/substreams/storage/store/marshaller/pb"
 	"github.com/streamingfast/substreams/wasm"
 )
 
@@ -41,18 +44,24 @@ type Pipeline struct {
 	preBlockHooks      []substreams.BlockHook
 	postBlockHooks     []substreams.BlockHook
 	postJobHooks       []substreams.PostJobHook
+	hooks              []PipelineHooks
 
 	wasmRuntime     *wasm.Registry
 	outputGraph     *outputmodules.Graph
 	loadedModules   map[uint32]wasm.Module
 	moduleExecutors [][]exec.ModuleExecutor
+	cpuHeavyModules map[string]bool // modules hinted `cpu_heavy`, executed within runtimeConfig.CPUHeavyModuleSlots
 
 	mapModuleOutput         *pbsubstreamsrpc.MapModuleOutput
+	otherOutputs            map[string]*pbsubstreamsrpc.MapModuleOutput // outputs of the output modules after the first, see outputModuleOutputs
 	extraMapModuleOutputs   []*pbsubstreamsrpc.MapModuleOutput
 	extraStoreModuleOutputs []*pbsubstreamsrpc.StoreModuleOutput
+	storeModuleOutputs      []*pbsubstreamsrpc.StoreModuleOutput // deltas of the storeDeltaModules
+	storeDeltaModules       map[string]bool
 
 	respFunc         substreams.ResponseFunc
 	lastProgressSent time.Time
+	moduleStatsSent  *metrics.ModuleUsageDeltas // usage of the modules sent to tier1, by a tier2 pipeline
 
 	stores         *Stores
 	execoutStorage *execout.Configs
@@ -61,11 +70,20 @@ type Pipeline struct {
 
 	gate            *gate
 	finalBlocksOnly bool
+	outputSampler   *outputSampler
+	slowBlocks      *slowBlocksDetector
+
+	determinismAudit bool // modules executed twice, see WithDeterminismAudit
+
+	stopConditions    *stopConditions
+	resumePoints      *resumePoints
+	terminationReason string // set when a stop condition ended the stream, see TerminationReason
 
 	forkHandler     *ForkHandler
 	insideReorgUpTo bstream.BlockRef
 
 	execOutputCache *cache.Engine
+	storesPrefetch  *storePrefetch // stores of a tier2 job being loaded, see awaitSubrequestStores
 
 	// lastFinalClock should always be either THE `stopBlock` or a block beyond that point
 	// (for chains with potential block skips)
@@ -99,12 +117,25 @@ func New(
 		stores:          stores,
 		execoutStorage:  execoutStorage,
 		forkHandler:     NewForkHandler(),
+		slowBlocks:      newSlowBlocksDetector(runtimeConfig.ModuleExecutionBudget, runtimeConfig.ModuleExecutionBudgetRepeat),
+		resumePoints:    newResumePoints(runtimeConfig.ResumePointInterval),
+		moduleStatsSent: metrics.NewModuleUsageDeltas(),
 		tier:            tier,
 		traceID:         traceID,
 	}
 	for _, opt := range opts {
 		opt(pipe)
 	}
+	if stores != nil && len(pipe.hooks) > 0 {
+		stores.onStoreFlush = pipe.runOnStoreFlushHooks
+	}
+	if stores != nil && !stores.isSubRequest {
+		stores.journal = newUndoJournal(runtimeConfig.MaxReorgDepth)
+	}
+	if stores != nil {
+		stores.writer = newSnapshotWriter(runtimeConfig.SnapshotWriteQueueSize)
+		stores.traceID = traceID
+	}
 	return pipe
 }
 
@@ -112,12 +143,6 @@ func (p *Pipeline) InitStoresAndBackprocess(ctx context.Context) (err error) {
 	reqDetails := reqctx.Details(ctx)
 	logger := reqctx.Logger(ctx)
 
-	p.forkHandler.registerUndoHandler(func(clock *pbsubstreams.Clock, moduleOutputs []*pbssinternal.ModuleOutput) {
-		for _, modOut := range moduleOutputs {
-			p.stores.storesHandleUndo(modOut)
-		}
-	})
-
 	p.setupProcessingModule(reqDetails)
 
 	var storeMap store.Map
@@ -142,13 +167,30 @@ func (p *Pipeline) InitWASM(ctx context.Context) (err error) {
 	//  and cache the latest if all block boundaries
 	//  are still clear.
 
-	return p.buildWASM(ctx, p.outputGraph.StagedUsedModules())
+	if err := p.buildWASM(ctx, p.outputGraph.StagedUsedModules()); err != nil {
+		return err
+	}
+
+	// the stores of tier2 jobs are prefetched while the modules are built
+	if err := p.awaitSubrequestStores(ctx, p.stores.StoreMap); err != nil {
+		return fmt.Errorf("loading stores: %w", err)
+	}
+	return nil
 }
 
 func (p *Pipeline) GetStoreMap() store.Map {
 	return p.stores.StoreMap
 }
 
+// TerminationReason returns why the stream ended, once it ended gracefully:
+// one of the TerminationReason* constants.
+func (p *Pipeline) TerminationReason() string {
+	if p.terminationReason == "" {
+		return TerminationReasonStopBlock
+	}
+	return p.terminationReason
+}
+
 func (p *Pipeline) setupProcessingModule(reqDetails *reqctx.RequestDetails) {
 	for _, module := range reqDetails.Modules.Modules {
 		if reqDetails.IsOutputModule(module.Name) {
@@ -172,27 +214,95 @@ func (p *Pipeline) setupSubrequestStores(ctx context.Context) (storeMap store.Ma
 	ttrace.SpanContextFromContext(context.Background())
 	storeMap = store.NewMap()
 
-	for name, storeConfig := range p.stores.configs {
+	var stages [][]*pbsubstreams.Module
+	if p.outputGraph != nil {
+		stages = p.outputGraph.StagedUsedModules()
+	}
+	names := make([]string, 0, len(p.stores.configs))
+	for name := range p.stores.configs {
+		names = append(names, name)
+	}
+
+	var prefetched []*store.FullKV
+	for _, name := range storesByDepth(names, stages) {
+		storeConfig := p.stores.configs[name]
 		if name == outputModuleName {
-			partialStore := storeConfig.NewPartialKV(reqDetails.ResolvedStartBlockNum, logger)
-			storeMap.Set(partialStore)
-		} else {
-			fullStore := storeConfig.NewFullKV(logger)
+			storeMap.Set(storeConfig.NewPartialKV(reqDetails.ResolvedStartBlockNum, logger))
 
-			if fullStore.InitialBlock() != reqDetails.ResolvedStartBlockNum {
-				file := store.NewCompleteFileInfo(fullStore.InitialBlock(), reqDetails.ResolvedStartBlockNum)
-				if err := fullStore.Load(ctx, file); err != nil {
-					return nil, fmt.Errorf("load full store %s (%s): %w", storeConfig.Name(), storeConfig.ModuleHash(), err)
-				}
+			if reqDetails.CachedOutputModule != "" {
+				fullStore := storeConfig.NewFullKV(logger)
+				p.stores.fullOutputStore = fullStore
+				prefetched = append(prefetched, fullStore)
 			}
-
+		} else {
+			fullStore := storeConfig.NewFullKV(logger)
 			storeMap.Set(fullStore)
+			prefetched = append(prefetched, fullStore)
 		}
 	}
+	p.storesPrefetch = prefetchStores(ctx, prefetched, reqDetails.ResolvedStartBlockNum, p.runtimeConfig.CacheSaveInterval)
 
 	return storeMap, nil
 }
 
+// awaitSubrequestStores waits for the stores of `storeMap` prefetched by
+// setupSubrequestStores, then records them in the lineage of the partial store
+// of the job.
+func (p *Pipeline) awaitSubrequestStores(ctx context.Context, storeMap store.Map) (err error) {
+	if p.storesPrefetch == nil {
+		return nil
+	}
+	ctx, span := reqctx.WithSpan(ctx, fmt.Sprintf("substreams/%s/pipeline/store_prefetch_wait", p.tier))
+	defer span.EndWithErr(&err)
+
+	err = p.storesPrefetch.wait(ctx)
+	p.storesPrefetch = nil
+	if err != nil {
+		return err
+	}
+
+	var partialStore *store.PartialKV
+	var inputs []*pbstore.InputSnapshot
+	for _, s := range storeMap {
+		switch s := s.(type) {
+		case *store.PartialKV:
+			partialStore = s
+		case *store.FullKV:
+			inputs = append(inputs, s.InputSnapshot())
+		}
+	}
+
+	if partialStore != nil {
+		sort.Slice(inputs, func(i, j int) bool { return inputs[i].ModuleName < inputs[j].ModuleName })
+		partialStore.SetLineageInputs(inputs)
+	}
+	return nil
+}
+
+// loadFullStore loads `fullStore` from its complete snapshot at `startBlock`,
+// or from its seed when starting at its initial block. Between the store save
+// `interval` boundaries, the snapshot can be a resume point, see resumePoints.
+func loadFullStore(ctx context.Context, fullStore *store.FullKV, startBlock, interval uint64) error {
+	if fullStore.InitialBlock() == startBlock {
+		return fullStore.LoadSeed(ctx)
+	}
+
+	file := store.NewCompleteFileInfo(fullStore.InitialBlock(), startBlock)
+	if interval != 0 && startBlock%interval != 0 {
+		resumePoint, err := fullStore.FindResumePoint(ctx, startBlock)
+		if err != nil {
+			return fmt.Errorf("finding resume point of store %s: %w", fullStore.Name(), err)
+		}
+		if resumePoint != nil {
+			file = resumePoint
+		}
+	}
+	if err := fullStore.Load(ctx, file); err != nil {
+		return fmt.Errorf("load full store %s (%s): %w", fullStore.Name(), fullStore.ModuleHash(), err)
+	}
+	return nil
+}
+
 // runParallelProcess
 func (p *Pipeline) runParallelProcess(ctx context.Context) (storeMap store.Map, err error) {
 	ctx, span := reqctx.WithSpan(ctx, fmt.Sprintf("substreams/%s/pipeline/parallel_process", p.tier))
@@ -233,6 +343,30 @@ func (p *Pipeline) isOutputModule(name string) bool {
 	return p.outputGraph.IsOutputModule(name)
 }
 
+// outputModuleOutputs returns the outputs of the output modules on the block
+// executed: the first one's, and the others' in their order. When there are
+// several output modules, the ones which produced nothing get an output
+// without data, naming them, so that the client receives one per module.
+func (p *Pipeline) outputModuleOutputs() (first *pbsubstreamsrpc.MapModuleOutput, others []*pbsubstreamsrpc.MapModuleOutput) {
+	outputModules := p.outputGraph.OutputModules()
+	if len(outputModules) <= 1 {
+		return p.mapModuleOutput, nil
+	}
+
+	first = p.mapModuleOutput
+	if first == nil {
+		first = &pbsubstreamsrpc.MapModuleOutput{Name: outputModules[0].Name}
+	}
+	for _, module := range outputModules[1:] {
+		output := p.otherOutputs[module.Name]
+		if output == nil {
+			output = &pbsubstreamsrpc.MapModuleOutput{Name: module.Name}
+		}
+		others = append(others, output)
+	}
+	return first, others
+}
+
 func (p *Pipeline) runPostJobHooks(ctx context.Context, clock *pbsubstreams.Clock) {
 	for _, hook := range p.postJobHooks {
 		if err := hook(ctx, clock); err != nil {
@@ -263,28 +397,49 @@ func toRPCStoreModuleOutputs(in *pbssinternal.ModuleOutput) (out *pbsubstreamsrp
 			Logs:          in.Logs,
 			LogsTruncated: in.DebugLogsTruncated,
 			Cached:        in.Cached,
+			StoreReads:    toRPCStoreReads(in.DebugStoreReads),
 		},
 	}
 }
 
+// toRPCStoreDeltas returns the deltas of a store output, without the debug
+// info of toRPCStoreModuleOutputs.
+func toRPCStoreDeltas(in *pbssinternal.ModuleOutput) (out *pbsubstreamsrpc.StoreModuleOutput) {
+	deltas := in.GetStoreDeltas()
+	if deltas == nil {
+		return nil
+	}
+
+	return &pbsubstreamsrpc.StoreModuleOutput{
+		Name:             in.ModuleName,
+		DebugStoreDeltas: toRPCDeltas(deltas),
+	}
+}
+
 func toRPCDeltas(in *pbssinternal.StoreDeltas) (out []*pbsubstreamsrpc.StoreDelta) {
-	if len(in.StoreDeltas) == 0 {
+	deltas := store.ExpandDeltas(in.StoreDeltas)
+	if len(deltas) == 0 {
 		return nil
 	}
 
-	out = make([]*pbsubstreamsrpc.StoreDelta, len(in.StoreDeltas))
-	for i, d := range in.StoreDeltas {
-		out[i] = &pbsubstreamsrpc.StoreDelta{
-			Operation: toRPCOperation(d.Operation),
-			Ordinal:   d.Ordinal,
-			Key:       d.Key,
-			OldValue:  d.OldValue,
-			NewValue:  d.NewValue,
-		}
+	out = make([]*pbsubstreamsrpc.StoreDelta, len(deltas))
+	for i, d := range deltas {
+		out[i] = ToRPCDelta(d)
 	}
 	return
 }
 
+// ToRPCDelta converts a store delta to its representation sent to the clients.
+func ToRPCDelta(in *pbssinternal.StoreDelta) *pbsubstreamsrpc.StoreDelta {
+	return &pbsubstreamsrpc.StoreDelta{
+		Operation: toRPCOperation(in.Operation),
+		Ordinal:   in.Ordinal,
+		Key:       in.Key,
+		OldValue:  in.OldValue,
+		NewValue:  in.NewValue,
+	}
+}
+
 func toRPCOperation(in pbssinternal.StoreDelta_Operation) (out pbsubstreamsrpc.StoreDelta_Operation) {
 	switch in {
 	case pbssinternal.StoreDelta_UPDATE:
@@ -309,10 +464,23 @@ func toRPCMapModuleOutputs(in *pbssinternal.ModuleOutput) (out *pbsubstreamsrpc.
 			Logs:          in.Logs,
 			LogsTruncated: in.DebugLogsTruncated,
 			Cached:        in.Cached,
+			StoreReads:    toRPCStoreReads(in.DebugStoreReads),
 		},
 	}
 }
 
+func toRPCStoreReads(in []*pbssinternal.StoreReads) (out []*pbsubstreamsrpc.StoreReads) {
+	for _, reads := range in {
+		out = append(out, &pbsubstreamsrpc.StoreReads{
+			StoreName:     reads.StoreName,
+			Keys:          reads.Keys,
+			ReadCount:     reads.ReadCount,
+			NotFoundCount: reads.NotFoundCount,
+		})
+	}
+	return
+}
+
 func (p *Pipeline) returnRPCModuleProgressOutputs(clock *pbsubstreams.Clock) error {
 	var progress []*pbsubstreamsrpc.ModuleProgress
 	if p.processingModule != nil {
@@ -338,7 +506,7 @@ func (p *Pipeline) returnRPCModuleProgressOutputs(clock *pbsubstreams.Clock) err
 	return nil
 }
 
-func (p *Pipeline) returnInternalModuleProgressOutputs(clock *pbsubstreams.Clock, forceOutput bool) error {
+func (p *Pipeline) returnInternalModuleProgressOutputs(ctx context.Context, clock *pbsubstreams.Clock, forceOutput bool) error {
 	if p.respFunc != nil {
 		if forceOutput || time.Since(p.lastProgressSent) > progressMessageInterval {
 			p.lastProgressSent = time.Now()
@@ -355,6 +523,31 @@ func (p *Pipeline) returnInternalModuleProgressOutputs(clock *pbsubstreams.Clock
 			if err := p.respFunc(out); err != nil {
 				return fmt.Errorf("calling return func: %w", err)
 			}
+			if err := p.returnInternalModuleStats(ctx); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// returnInternalModuleStats sends the usage of the modules since it was last
+// sent to tier1, which adds it to the usage of the request.
+func (p *Pipeline) returnInternalModuleStats(ctx context.Context) error {
+	for _, usage := range reqctx.ModuleMeter(ctx).Changed() {
+		delta := p.moduleStatsSent.Of(usage)
+		out := &pbssinternal.ProcessRangeResponse{
+			ModuleName: usage.Module,
+			Type: &pbssinternal.ProcessRangeResponse_ModuleStats{
+				ModuleStats: &pbssinternal.ModuleStats{
+					WasmExecutionNs:    uint64(delta.WasmExecution.Nanoseconds()),
+					StoreOperations:    delta.StoreOperations,
+					StorePeakSizeBytes: delta.StorePeakSizeBytes,
+				},
+			},
+		}
+		if err := p.respFunc(out); err != nil {
+			return fmt.Errorf("sending module stats: %w", err)
 		}
 	}
 	return nil
@@ -385,10 +578,16 @@ func (p *Pipeline) buildWASM(ctx context.Context, stages [][]*pbsubstreams.Modul
 	}
 	p.loadedModules = loadedModules
 
+	p.cpuHeavyModules = make(map[string]bool)
+	recordStoreReads := !reqctx.Details(ctx).ProductionMode
 	var stagedModuleExecutors [][]exec.ModuleExecutor
 	for _, stage := range stages {
 		var moduleExecutors []exec.ModuleExecutor
 		for _, module := range stage {
+			if module.ExecutionHint == pbsubstreams.Module_EXECUTION_HINT_CPU_HEAVY {
+				p.cpuHeavyModules[module.Name] = true
+			}
+
 			inputs, err := p.renderWasmInputs(module)
 			if err != nil {
 				return fmt.Errorf("module %q: get wasm inputs: %w", module.Name, err)
@@ -398,7 +597,7 @@ func (p *Pipeline) buildWASM(ctx context.Context, stages [][]*pbsubstreams.Modul
 			mod := loadedModules[module.BinaryIndex]
 
 			switch kind := module.Kind.(type) {
-			case *pbsubstreams.Module_KindMap_:
+			case *pbsubstreams.Module_KindMap_, *pbsubstreams.Module_KindBlockIndex_:
 				outType := strings.TrimPrefix(module.Output.Type, "proto:")
 				baseExecutor := exec.NewBaseExecutor(
 					ctx,
@@ -409,30 +608,32 @@ func (p *Pipeline) buildWASM(ctx context.Context, stages [][]*pbsubstreams.Modul
 					entrypoint,
 					tracer,
 				)
+				if recordStoreReads {
+					baseExecutor.RecordStoreReads()
+				}
+				if filter := module.BlockFilter; filter != nil {
+					baseExecutor.FilterBlocks(filter.Module)
+				}
 				executor := exec.NewMapperModuleExecutor(baseExecutor, outType)
 				moduleExecutors = append(moduleExecutors, executor)
 
 			case *pbsubstreams.Module_KindStore_:
-				updatePolicy := kind.KindStore.UpdatePolicy
-				valueType := kind.KindStore.ValueType
-
 				outputStore, found := p.stores.StoreMap.Get(module.Name)
 				if !found {
 					return fmt.Errorf("store %q not found", module.Name)
 				}
-				inputs = append(inputs, wasm.NewStoreWriterOutput(module.Name, outputStore, updatePolicy, valueType))
-
-				baseExecutor := exec.NewBaseExecutor(
-					ctx,
-					module.Name,
-					mod,
-					p.wasmRuntime.InstanceCacheEnabled(),
-					inputs,
-					entrypoint,
-					tracer,
-				)
-				executor := exec.NewStoreModuleExecutor(baseExecutor, outputStore)
-				moduleExecutors = append(moduleExecutors, executor)
+				moduleExecutors = append(moduleExecutors, p.newStoreModuleExecutor(ctx, module, kind, mod, inputs, outputStore, tracer, recordStoreReads))
+
+				if fullOutputStore := p.stores.fullOutputStore; fullOutputStore != nil && fullOutputStore.Name() == module.Name {
+					// The wasm arguments hold the values of the block being
+					// executed, they can't be shared by the executors of a stage.
+					fullInputs, err := p.renderWasmInputs(module)
+					if err != nil {
+						return fmt.Errorf("module %q: get wasm inputs: %w", module.Name, err)
+					}
+					executor := p.newStoreModuleExecutor(ctx, module, kind, mod, fullInputs, fullOutputStore, tracer, recordStoreReads)
+					moduleExecutors = append(moduleExecutors, &fullOutputStoreExecutor{executor})
+				}
 
 			default:
 				panic(fmt.Errorf("invalid kind %q input module %q", module.Kind, module.Name))
@@ -445,12 +646,52 @@ func (p *Pipeline) buildWASM(ctx context.Context, stages [][]*pbsubstreams.Modul
 	return nil
 }
 
+func (p *Pipeline) newStoreModuleExecutor(
+	ctx context.Context,
+	module *pbsubstreams.Module,
+	kind *pbsubstreams.Module_KindStore_,
+	mod wasm.Module,
+	inputs []wasm.Argument,
+	outputStore store.Store,
+	tracer ttrace.Tracer,
+	recordStoreReads bool,
+) exec.ModuleExecutor {
+	inputs = append(inputs, wasm.NewStoreWriterOutput(module.Name, outputStore, kind.KindStore.UpdatePolicy, kind.KindStore.ValueType))
+
+	baseExecutor := exec.NewBaseExecutor(
+		ctx,
+		module.Name,
+		mod,
+		p.wasmRuntime.InstanceCacheEnabled(),
+		inputs,
+		module.BinaryEntrypoint,
+		tracer,
+	)
+	if recordStoreReads {
+		baseExecutor.RecordStoreReads()
+	}
+	if filter := module.BlockFilter; filter != nil {
+		baseExecutor.FilterBlocks(filter.Module)
+	}
+	return exec.NewStoreModuleExecutor(baseExecutor, outputStore)
+}
+
+// fullOutputStoreExecutor executes the output store of a tier2 store job over
+// Stores.fullOutputStore, next to the executor of its partial store. It is
+// only there to provide the store and its deltas to the cached output module,
+// so the module execution hooks and budget only account for the other one.
+type fullOutputStoreExecutor struct {
+	exec.ModuleExecutor
+}
+
 func returnModuleDataOutputs(
 	clock *pbsubstreams.Clock,
 	cursor *bstream.Cursor,
 	mapModuleOutput *pbsubstreamsrpc.MapModuleOutput,
+	otherOutputs []*pbsubstreamsrpc.MapModuleOutput,
 	extraMapModuleOutputs []*pbsubstreamsrpc.MapModuleOutput,
 	extraStoreModuleOutputs []*pbsubstreamsrpc.StoreModuleOutput,
+	storeModuleOutputs []*pbsubstreamsrpc.StoreModuleOutput,
 	respFunc substreams.ResponseFunc,
 ) error {
 	out := &pbsubstreamsrpc.BlockScopedData{
@@ -458,6 +699,7 @@ func returnModuleDataOutputs(
 		Output:            mapModuleOutput,
 		DebugMapOutputs:   extraMapModuleOutputs,
 		DebugStoreOutputs: extraStoreModuleOutputs,
+		StoreOutputs:      storeModuleOutputs,
 		Cursor:            cursor.ToOpaque(),
 		FinalBlockHeight:  cursor.LIB.Num(),
 	}
@@ -466,11 +708,22 @@ func returnModuleDataOutputs(
 		return fmt.Errorf("calling return func: %w", err)
 	}
 
+	// the outputs of the other output modules follow, with the same cursor
+	for _, output := range otherOutputs {
+		if err := respFunc(substreams.NewBlockScopedDataResponse(&pbsubstreamsrpc.BlockScopedData{
+			Clock:            clock,
+			Output:           output,
+			Cursor:           out.Cursor,
+			FinalBlockHeight: out.FinalBlockHeight,
+		})); err != nil {
+			return fmt.Errorf("calling return func: %w", err)
+		}
+	}
+
 	return nil
 }
 
 func (p *Pipeline) renderWasmInputs(module *pbsubstreams.Module) (out []wasm.Argument, err error) {
-	storeAccessor := p.stores.StoreMap
 	for _, input := range module.Inputs {
 		switch in := input.Input.(type) {
 		case *pbsubstreams.Module_Input_Params_:
@@ -482,7 +735,7 @@ func (p *Pipeline) renderWasmInputs(module *pbsubstreams.Module) (out []wasm.Arg
 			if input.GetStore().Mode == pbsubstreams.Module_Input_Store_DELTAS {
 				out = append(out, wasm.NewMapInput(inputName))
 			} else {
-				inputStore, found := storeAccessor.Get(inputName)
+				inputStore, found := p.stores.readStore(inputName)
 				if !found {
 					return nil, fmt.Errorf("store %q npt found", inputName)
 				}
@@ -135,8 +135,9 @@ func TestSetupSubrequestStores(t *testing.T) {
 		ctx := withTestRequest(t, "mod3", 10)
 
 		storeMap, err := p.setupSubrequestStores(ctx)
-
 		require.NoError(t, err)
+		require.NoError(t, p.awaitSubrequestStores(ctx, storeMap))
+
 		assert.Len(t, storeMap, 3)
 
 		fullKV := storeMap["mod1"].(*store2.FullKV)
@@ -0,0 +1,86 @@
+package pipeline
+
+import (
+	"context"
+	"sort"
+
+	"github.com/abourget/llerrgroup"
+
+	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
+	"github.com/streamingfast/substreams/storage/store"
+)
+
+// storePrefetchParallelism bounds the complete store snapshots loaded at the
+// same time by a tier2 job.
+const storePrefetchParallelism = 4
+
+// storePrefetch loads the complete snapshots of the stores of a tier2 job in
+// the background, while its WASM modules are compiled and instantiated, so
+// that the start of the job waits for the slowest of both instead of their sum.
+type storePrefetch struct {
+	done chan struct{}
+	err  error
+}
+
+// prefetchStores starts loading `stores` from their complete snapshot at
+// `startBlock`, in the order given, see storesByDepth and loadFullStore.
+func prefetchStores(ctx context.Context, stores []*store.FullKV, startBlock, interval uint64) *storePrefetch {
+	f := &storePrefetch{done: make(chan struct{})}
+
+	go func() {
+		defer close(f.done)
+
+		eg := llerrgroup.New(storePrefetchParallelism)
+		for _, fullStore := range stores {
+			if eg.Stop() {
+				break
+			}
+
+			fullStore := fullStore
+			eg.Go(func() error {
+				return loadFullStore(ctx, fullStore, startBlock, interval)
+			})
+		}
+		f.err = eg.Wait()
+	}()
+	return f
+}
+
+// wait returns once all the stores are loaded, with the first loading error.
+func (f *storePrefetch) wait(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-f.done:
+		return f.err
+	}
+}
+
+// storesByDepth returns the names of `names` sorted by dependency depth, the
+// stores of the earliest of `stages` first, since the modules of the first
+// stages are the first to read them. The stores missing from `stages` come
+// last, ties are broken by name.
+func storesByDepth(names []string, stages [][]*pbsubstreams.Module) []string {
+	depths := make(map[string]int)
+	for depth, stage := range stages {
+		for _, module := range stage {
+			depths[module.Name] = depth
+		}
+	}
+
+	depthOf := func(name string) int {
+		if depth, found := depths[name]; found {
+			return depth
+		}
+		return len(stages)
+	}
+
+	out := append([]string{}, names...)
+	sort.Slice(out, func(i, j int) bool {
+		if di, dj := depthOf(out[i]), depthOf(out[j]); di != dj {
+			return di < dj
+		}
+		return out[i] < out[j]
+	})
+	return out
+}
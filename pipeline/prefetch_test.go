@@ -0,0 +1,23 @@
+package pipeline
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
+)
+
+func Test_storesByDepth(t *testing.T) {
+	stages := [][]*pbsubstreams.Module{
+		{{Name: "store_b"}, {Name: "store_a"}},
+		{{Name: "map_c"}},
+		{{Name: "store_d"}},
+	}
+
+	assert.Equal(t,
+		[]string{"store_a", "store_b", "store_d", "store_z"},
+		storesByDepth([]string{"store_z", "store_d", "store_b", "store_a"}, stages),
+	)
+	assert.Equal(t, []string{"store_a", "store_b"}, storesByDepth([]string{"store_b", "store_a"}, nil))
+}
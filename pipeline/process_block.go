@@ -7,11 +7,14 @@ import (
 	"io"
 	"runtime/debug"
 	"sync"
+	"time"
 
 	"github.com/streamingfast/bstream"
 	"go.uber.org/zap"
 	"google.golang.org/protobuf/types/known/timestamppb"
 
+	"github.com/streamingfast/substreams"
+	"github.com/streamingfast/substreams/billing"
 	"github.com/streamingfast/substreams/metrics"
 	pbssinternal "github.com/streamingfast/substreams/pb/sf/substreams/intern/v2"
 	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
@@ -53,6 +56,7 @@ func (p *Pipeline) ProcessBlock(block *bstream.Block, obj interface{}) (err erro
 	reorgJunctionBlock := obj.(bstream.Stepable).ReorgJunctionBlock()
 
 	reqctx.ReqStats(ctx).RecordBlock(block.AsRef())
+	billing.UsageFromContext(ctx).AddBlocks(1)
 	p.gate.processBlock(block.Number, step)
 	if err = p.processBlock(ctx, block, clock, cursor, step, finalBlockHeight, reorgJunctionBlock); err != nil {
 		return err // watch out, io.EOF needs to go through undecorated
@@ -116,6 +120,9 @@ func (p *Pipeline) processBlock(
 		if err != nil {
 			return fmt.Errorf("handling step irreversible: %w", err)
 		}
+		if !eof {
+			p.resumePoints.maybeSave(ctx, clock, p.stores)
+		}
 
 	case bstream.StepIrreversible:
 		err = p.handleStepFinal(clock)
@@ -133,6 +140,7 @@ func (p *Pipeline) processBlock(
 func (p *Pipeline) handleStepStalled(clock *pbsubstreams.Clock) error {
 	p.execOutputCache.HandleStalled(clock)
 	p.forkHandler.removeReversibleOutput(clock.Id)
+	p.stores.handleStalled(clock)
 	return nil
 }
 
@@ -141,12 +149,41 @@ func (p *Pipeline) handleStepUndo(ctx context.Context, clock *pbsubstreams.Clock
 	if err := p.forkHandler.handleUndo(clock, cursor); err != nil {
 		return fmt.Errorf("reverting outputs: %w", err)
 	}
+	if err := p.stores.handleUndo(clock); err != nil {
+		return fmt.Errorf("reverting stores: %w", err)
+	}
+	// the block may come back after the reorganization, with new outputs
+	undoneOutputs := p.forkHandler.reversibleOutput(clock.Id)
+	p.forkHandler.removeReversibleOutput(clock.Id)
+
+	reqDetails := reqctx.Details(ctx)
+	if reqDetails.HasCapability(substreams.CapabilityPerBlockUndo) {
+		p.insideReorgUpTo = reorgJunctionBlock
+
+		signal := undoSignal(cursor, reorgJunctionBlock)
+		signal.UndoneBlock = &pbsubstreams.BlockRef{Id: clock.Id, Number: clock.Number}
+		p.setUndoneOutputs(signal, undoneOutputs, reqDetails.ProductionMode)
+		return p.respFunc(&pbsubstreamsrpc.Response{
+			Message: &pbsubstreamsrpc.Response_BlockUndoSignal{BlockUndoSignal: signal},
+		})
+	}
 
 	if bstream.EqualsBlockRefs(p.insideReorgUpTo, reorgJunctionBlock) {
 		return nil
 	}
 	p.insideReorgUpTo = reorgJunctionBlock
 
+	return p.respFunc(
+		&pbsubstreamsrpc.Response{
+			Message: &pbsubstreamsrpc.Response_BlockUndoSignal{
+				BlockUndoSignal: undoSignal(cursor, reorgJunctionBlock),
+			},
+		})
+}
+
+// undoSignal returns the signal rewinding the client to `reorgJunctionBlock`,
+// the last block still valid.
+func undoSignal(cursor *bstream.Cursor, reorgJunctionBlock bstream.BlockRef) *pbsubstreamsrpc.BlockUndoSignal {
 	targetCursor := &bstream.Cursor{
 		Step:      bstream.StepNew,
 		Block:     reorgJunctionBlock,
@@ -154,17 +191,42 @@ func (p *Pipeline) handleStepUndo(ctx context.Context, clock *pbsubstreams.Clock
 		HeadBlock: cursor.HeadBlock,
 	}
 
-	targetClock := blockRefToPB(reorgJunctionBlock)
+	return &pbsubstreamsrpc.BlockUndoSignal{
+		LastValidBlock:  blockRefToPB(reorgJunctionBlock),
+		LastValidCursor: targetCursor.ToOpaque(),
+	}
+}
 
-	return p.respFunc(
-		&pbsubstreamsrpc.Response{
-			Message: &pbsubstreamsrpc.Response_BlockUndoSignal{
-				BlockUndoSignal: &pbsubstreamsrpc.BlockUndoSignal{
-					LastValidBlock:  targetClock,
-					LastValidCursor: targetCursor.ToOpaque(),
-				},
-			},
-		})
+// setUndoneOutputs attaches to `signal` the outputs that were sent for the
+// undone block, split like in `saveModuleOutput`.
+func (p *Pipeline) setUndoneOutputs(signal *pbsubstreamsrpc.BlockUndoSignal, outputs []*pbssinternal.ModuleOutput, isProduction bool) {
+	for _, output := range outputs {
+		if p.isOutputModule(output.ModuleName) {
+			if output.ModuleName != p.outputGraph.OutputModule().Name {
+				if mapOutput := toRPCMapModuleOutputs(output); mapOutput != nil {
+					signal.UndoneExtraOutputs = append(signal.UndoneExtraOutputs, mapOutput)
+				}
+				continue
+			}
+			signal.UndoneOutput = toRPCMapModuleOutputs(output)
+			continue
+		}
+		if p.storeDeltaModules[output.ModuleName] {
+			if storeOutputs := toRPCStoreDeltas(output); storeOutputs != nil {
+				signal.UndoneStoreOutputs = append(signal.UndoneStoreOutputs, storeOutputs)
+			}
+		}
+		if isProduction {
+			continue
+		}
+
+		if storeOutputs := toRPCStoreModuleOutputs(output); storeOutputs != nil {
+			signal.UndoneDebugStoreOutputs = append(signal.UndoneDebugStoreOutputs, storeOutputs)
+		}
+		if mapOutput := toRPCMapModuleOutputs(output); mapOutput != nil {
+			signal.UndoneDebugMapOutputs = append(signal.UndoneDebugMapOutputs, mapOutput)
+		}
+	}
 }
 
 func (p *Pipeline) handleStepFinal(clock *pbsubstreams.Clock) error {
@@ -174,6 +236,7 @@ func (p *Pipeline) handleStepFinal(clock *pbsubstreams.Clock) error {
 		return fmt.Errorf("exec output cache: handle final: %w", err)
 	}
 	p.forkHandler.removeReversibleOutput(clock.Id)
+	p.stores.handleFinal(clock)
 	return nil
 }
 
@@ -183,6 +246,10 @@ func (p *Pipeline) handleStepNew(ctx context.Context, block *bstream.Block, cloc
 	if isBlockOverStopBlock(clock.Number, reqDetails.StopBlockNum) {
 		return io.EOF
 	}
+	if reason := p.stopConditions.beforeBlock(clock); reason != "" {
+		p.terminationReason = reason
+		return io.EOF
+	}
 
 	if err := p.stores.flushStores(ctx, clock.Number); err != nil {
 		return fmt.Errorf("step new irr: stores end of stream: %w", err)
@@ -204,6 +271,9 @@ func (p *Pipeline) handleStepNew(ctx context.Context, block *bstream.Block, cloc
 	if err := p.runPreBlockHooks(ctx, clock); err != nil {
 		return fmt.Errorf("pre block hook: %w", err)
 	}
+	if err := p.runOnBlockStartHooks(ctx, clock); err != nil {
+		return err
+	}
 
 	//blockDuration = 0
 	//exec.Timer = 0
@@ -218,7 +288,7 @@ func (p *Pipeline) handleStepNew(ctx context.Context, block *bstream.Block, cloc
 		if reqDetails.IsSubRequest {
 			forceSend := (clock.Number+1)%p.runtimeConfig.CacheSaveInterval == 0
 
-			if err = p.returnInternalModuleProgressOutputs(clock, forceSend); err != nil {
+			if err = p.returnInternalModuleProgressOutputs(ctx, clock, forceSend); err != nil {
 				return fmt.Errorf("failed to return modules progress %w", err)
 			}
 		} else {
@@ -228,7 +298,8 @@ func (p *Pipeline) handleStepNew(ctx context.Context, block *bstream.Block, cloc
 		}
 	}
 
-	if p.gate.shouldSendOutputs() {
+	mapModuleOutput, otherOutputs := p.outputModuleOutputs()
+	if p.gate.shouldSendOutputs() && (p.pendingUndoMessage != nil || p.outputSampler.shouldSend(clock.Number, p.mapModuleOutput, append(otherOutputs, p.extraMapModuleOutputs...), p.extraStoreModuleOutputs)) {
 		logger.Debug("will return module outputs")
 		if p.pendingUndoMessage != nil {
 			if err := p.respFunc(p.pendingUndoMessage); err != nil {
@@ -236,13 +307,20 @@ func (p *Pipeline) handleStepNew(ctx context.Context, block *bstream.Block, cloc
 			}
 		}
 		p.pendingUndoMessage = nil
-		if err = returnModuleDataOutputs(clock, cursor, p.mapModuleOutput, p.extraMapModuleOutputs, p.extraStoreModuleOutputs, p.respFunc); err != nil {
+		if err = returnModuleDataOutputs(clock, cursor, mapModuleOutput, otherOutputs, p.extraMapModuleOutputs, p.extraStoreModuleOutputs, p.storeModuleOutputs, p.respFunc); err != nil {
 			return fmt.Errorf("failed to return module data output: %w", err)
 		}
 	}
 
-	p.stores.resetStores()
+	reason := p.stopConditions.afterBlock(p.mapModuleOutput, p.stores.StoreMap)
+	p.stores.recordUndo(clock)
+	p.stores.resetStores(clock.Number)
 	logger.Debug("block processed", zap.Uint64("block_num", block.Number))
+	if reason != "" {
+		logger.Info("stop condition met", zap.String("reason", reason), zap.Uint64("block_num", block.Number))
+		p.terminationReason = reason
+		return io.EOF
+	}
 	return nil
 }
 
@@ -258,8 +336,10 @@ func (p *Pipeline) executeModules(ctx context.Context, execOutput execout.Execut
 	//  Would pave the way towards PATCH'd modules too.
 
 	p.mapModuleOutput = nil
+	p.otherOutputs = nil
 	p.extraMapModuleOutputs = nil
 	p.extraStoreModuleOutputs = nil
+	p.storeModuleOutputs = nil
 	for _, stage := range p.moduleExecutors {
 		//t0 := time.Now()
 		//
@@ -290,7 +370,9 @@ func (p *Pipeline) executeModules(ctx context.Context, execOutput execout.Execut
 			for i, result := range results {
 				executor := stage[i]
 				if result.err != nil {
-					//p.returnFailureProgress(ctx, err, executor)
+					if err := p.returnLimitExceededProgress(ctx, executor.Name(), result.err); err != nil {
+						return err
+					}
 					return fmt.Errorf("running executor %q: %w", executor.Name(), result.err)
 				}
 				if err := p.applyExecutionResult(ctx, executor, result, execOutput); err != nil {
@@ -305,9 +387,10 @@ func (p *Pipeline) executeModules(ctx context.Context, execOutput execout.Execut
 }
 
 type resultObj struct {
-	output *pbssinternal.ModuleOutput
-	bytes  []byte
-	err    error
+	output   *pbssinternal.ModuleOutput
+	bytes    []byte
+	err      error
+	duration time.Duration
 }
 
 func (p *Pipeline) execute(ctx context.Context, executor exec.ModuleExecutor, execOutput execout.ExecutionOutput) resultObj {
@@ -316,8 +399,59 @@ func (p *Pipeline) execute(ctx context.Context, executor exec.ModuleExecutor, ex
 	executorName := executor.Name()
 	logger.Debug("executing", zap.Uint64("block", execOutput.Clock().Number), zap.String("module_name", executorName))
 
+	if p.cpuHeavyModules[executorName] {
+		if err := p.acquireCPUHeavySlot(ctx); err != nil {
+			return resultObj{err: fmt.Errorf("waiting to execute cpu heavy module: %w", err)}
+		}
+		defer p.releaseCPUHeavySlot()
+	}
+
+	t0 := time.Now()
 	moduleOutput, outputBytes, runError := exec.RunModule(ctx, executor, execOutput)
-	return resultObj{moduleOutput, outputBytes, runError}
+	duration := time.Since(t0)
+
+	if runError == nil && !moduleOutput.Cached && p.determinismAudit {
+		runError = p.replay(ctx, executor, execOutput, outputBytes)
+	}
+	return resultObj{moduleOutput, outputBytes, runError, duration}
+}
+
+// replay executes `executor` again to audit its determinism. The executor of
+// the full output store of a tier2 store job is not replayed, it runs the same
+// code as the executor of the partial store.
+func (p *Pipeline) replay(ctx context.Context, executor exec.ModuleExecutor, execOutput execout.ExecutionOutput, outputBytes []byte) error {
+	if _, ok := executor.(*fullOutputStoreExecutor); ok {
+		return nil
+	}
+
+	err := exec.ReplayModule(ctx, executor, execOutput, outputBytes)
+	if errors.Is(err, exec.ErrNonDeterministicExec) {
+		metrics.NonDeterministicExecutions.Inc()
+		reqctx.Logger(ctx).Error("module execution is not deterministic", zap.String("module_name", executor.Name()), zap.Error(err))
+	}
+	return err
+}
+
+// acquireCPUHeavySlot waits for one of the slots shared by the pipelines of the
+// process to execute a `cpu_heavy` module, the other modules of the stage
+// executing meanwhile. There is no limit without runtimeConfig.CPUHeavyModuleSlots.
+func (p *Pipeline) acquireCPUHeavySlot(ctx context.Context) error {
+	if p.runtimeConfig.CPUHeavyModuleSlots == nil {
+		return nil
+	}
+	select {
+	case p.runtimeConfig.CPUHeavyModuleSlots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *Pipeline) releaseCPUHeavySlot() {
+	if p.runtimeConfig.CPUHeavyModuleSlots == nil {
+		return
+	}
+	<-p.runtimeConfig.CPUHeavyModuleSlots
 }
 
 func (p *Pipeline) applyExecutionResult(ctx context.Context, executor exec.ModuleExecutor, res resultObj, execOutput execout.ExecutionOutput) (err error) {
@@ -325,7 +459,18 @@ func (p *Pipeline) applyExecutionResult(ctx context.Context, executor exec.Modul
 	hasValidOutput := executor.HasValidOutput()
 
 	moduleOutput, outputBytes, runError := res.output, res.bytes, res.err
+	if _, ok := executor.(*fullOutputStoreExecutor); !ok {
+		if err := p.runOnModuleExecutedHooks(ctx, execOutput.Clock(), executorName, moduleOutput, runError); err != nil {
+			return err
+		}
+		if err := p.checkExecutionBudget(ctx, executorName, execOutput.Clock().Number, res.duration); err != nil {
+			return err
+		}
+	}
 	if runError != nil {
+		if err := p.returnLimitExceededProgress(ctx, executorName, runError); err != nil {
+			return err
+		}
 		if hasValidOutput {
 			p.saveModuleOutput(moduleOutput, executor.Name(), reqctx.Details(ctx).ProductionMode)
 		}
@@ -347,9 +492,21 @@ func (p *Pipeline) applyExecutionResult(ctx context.Context, executor exec.Modul
 
 func (p *Pipeline) saveModuleOutput(output *pbssinternal.ModuleOutput, moduleName string, isProduction bool) {
 	if p.isOutputModule(moduleName) {
+		if moduleName != p.outputGraph.OutputModule().Name {
+			if p.otherOutputs == nil {
+				p.otherOutputs = make(map[string]*pbsubstreamsrpc.MapModuleOutput)
+			}
+			p.otherOutputs[moduleName] = toRPCMapModuleOutputs(output)
+			return
+		}
 		p.mapModuleOutput = toRPCMapModuleOutputs(output)
 		return
 	}
+	if p.storeDeltaModules[moduleName] {
+		if storeOutputs := toRPCStoreDeltas(output); storeOutputs != nil {
+			p.storeModuleOutputs = append(p.storeModuleOutputs, storeOutputs)
+		}
+	}
 	if isProduction {
 		return
 	}
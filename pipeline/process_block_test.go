@@ -0,0 +1,127 @@
+package pipeline
+
+import (
+	"context"
+	"testing"
+
+	"github.com/streamingfast/bstream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	"github.com/streamingfast/substreams"
+	"github.com/streamingfast/substreams/manifest"
+	pbssinternal "github.com/streamingfast/substreams/pb/sf/substreams/intern/v2"
+	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
+	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
+	"github.com/streamingfast/substreams/pipeline/outputmodules"
+	"github.com/streamingfast/substreams/reqctx"
+	"github.com/streamingfast/substreams/service/config"
+)
+
+func TestPipeline_acquireCPUHeavySlot(t *testing.T) {
+	slots := make(chan struct{}, 1)
+	p := &Pipeline{runtimeConfig: config.RuntimeConfig{CPUHeavyModuleSlots: slots}}
+	other := &Pipeline{runtimeConfig: config.RuntimeConfig{CPUHeavyModuleSlots: slots}}
+
+	require.NoError(t, p.acquireCPUHeavySlot(context.Background()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, other.acquireCPUHeavySlot(ctx), context.Canceled, "slots are shared across pipelines")
+
+	p.releaseCPUHeavySlot()
+	require.NoError(t, other.acquireCPUHeavySlot(context.Background()))
+	other.releaseCPUHeavySlot()
+
+	unlimited := &Pipeline{}
+	require.NoError(t, unlimited.acquireCPUHeavySlot(ctx))
+	unlimited.releaseCPUHeavySlot()
+}
+
+func TestPipeline_handleStepUndo(t *testing.T) {
+	outputGraph, err := outputmodules.NewOutputModuleGraph("C", false, &pbsubstreams.Modules{Modules: manifest.NewTestModules(), Binaries: []*pbsubstreams.Binary{{}}})
+	require.NoError(t, err)
+
+	junction := bstream.NewBlockRef("10a", 10)
+	cursor := &bstream.Cursor{
+		Step:      bstream.StepUndo,
+		Block:     bstream.NewBlockRef("12a", 12),
+		LIB:       bstream.NewBlockRef("5a", 5),
+		HeadBlock: bstream.NewBlockRef("12a", 12),
+	}
+	undone := []*pbsubstreams.Clock{{Id: "12a", Number: 12}, {Id: "11a", Number: 11}}
+
+	tests := []struct {
+		name           string
+		capabilities   []string
+		productionMode bool
+		check          func(t *testing.T, signals []*pbsubstreamsrpc.BlockUndoSignal)
+	}{
+		{
+			name: "single signal per fork",
+			check: func(t *testing.T, signals []*pbsubstreamsrpc.BlockUndoSignal) {
+				require.Len(t, signals, 1)
+				assert.Equal(t, uint64(10), signals[0].LastValidBlock.Number)
+				assert.Nil(t, signals[0].UndoneBlock)
+				assert.Nil(t, signals[0].UndoneOutput)
+			},
+		},
+		{
+			name:         "per block",
+			capabilities: []string{substreams.CapabilityPerBlockUndo},
+			check: func(t *testing.T, signals []*pbsubstreamsrpc.BlockUndoSignal) {
+				require.Len(t, signals, 2)
+				for i, signal := range signals {
+					assert.Equal(t, uint64(10), signal.LastValidBlock.Number)
+					assert.Equal(t, undone[i].Id, signal.UndoneBlock.Id)
+					assert.Equal(t, undone[i].Id, string(signal.UndoneOutput.MapOutput.Value))
+					require.Len(t, signal.UndoneDebugStoreOutputs, 1)
+					assert.Equal(t, "As", signal.UndoneDebugStoreOutputs[0].Name)
+				}
+				assert.Equal(t, signals[0].LastValidCursor, signals[1].LastValidCursor)
+			},
+		},
+		{
+			name:           "per block in production mode",
+			capabilities:   []string{substreams.CapabilityPerBlockUndo},
+			productionMode: true,
+			check: func(t *testing.T, signals []*pbsubstreamsrpc.BlockUndoSignal) {
+				require.Len(t, signals, 2)
+				assert.NotNil(t, signals[0].UndoneOutput)
+				assert.Empty(t, signals[0].UndoneDebugStoreOutputs)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := reqctx.WithRequest(context.Background(), &reqctx.RequestDetails{ProductionMode: test.productionMode, Capabilities: test.capabilities})
+
+			var signals []*pbsubstreamsrpc.BlockUndoSignal
+			p := &Pipeline{
+				forkHandler: NewForkHandler(),
+				outputGraph: outputGraph,
+				respFunc: func(resp substreams.ResponseFromAnyTier) error {
+					signals = append(signals, resp.(*pbsubstreamsrpc.Response).GetBlockUndoSignal())
+					return nil
+				},
+			}
+			for _, clock := range undone {
+				p.forkHandler.addReversibleOutput(&pbssinternal.ModuleOutput{
+					ModuleName: "As",
+					Data:       &pbssinternal.ModuleOutput_StoreDeltas{StoreDeltas: &pbssinternal.StoreDeltas{}},
+				}, clock.Id)
+				p.forkHandler.addReversibleOutput(&pbssinternal.ModuleOutput{
+					ModuleName: "C",
+					Data:       &pbssinternal.ModuleOutput_MapOutput{MapOutput: &anypb.Any{Value: []byte(clock.Id)}},
+				}, clock.Id)
+			}
+
+			for _, clock := range undone {
+				require.NoError(t, p.handleStepUndo(ctx, clock, cursor, junction))
+			}
+			test.check(t, signals)
+		})
+	}
+}
@@ -40,7 +40,12 @@ func BuildRequestDetails(
 		return nil, nil, err
 	}
 
-	linearHandoff, err := computeLiveHandoffBlockNum(request.ProductionMode, req.ResolvedStartBlockNum, request.StopBlockNum, getRecentFinalBlock)
+	// the store deltas are not in the cached outputs of the output modules, and
+	// the stop conditions are evaluated on the executed blocks: the blocks
+	// streaming them are executed like in development mode
+	parallelOutputs := request.ProductionMode && len(request.StoreDeltaModules) == 0 && request.StopConditions == nil
+
+	linearHandoff, err := computeLiveHandoffBlockNum(parallelOutputs, req.ResolvedStartBlockNum, request.StopBlockNum, getRecentFinalBlock)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -54,6 +59,7 @@ func BuildRequestDetailsFromSubrequest(request *pbssinternal.ProcessRangeRequest
 	req = &reqctx.RequestDetails{
 		Modules:               request.Modules,
 		OutputModule:          request.OutputModule,
+		CachedOutputModule:    request.CachedOutputModule,
 		ProductionMode:        true,
 		IsSubRequest:          true,
 		StopBlockNum:          request.StopBlockNum,
@@ -261,4 +261,44 @@ func TestBuildRequestDetails(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, 10, int(req.ResolvedStartBlockNum))
 	assert.Equal(t, 999, int(req.LinearHandoffBlockNum))
+
+	req, _, err = BuildRequestDetails(
+		context.Background(),
+		&pbsubstreamsrpc.Request{
+			StartBlockNum:     10,
+			ProductionMode:    true,
+			OutputModule:      "",
+			StoreDeltaModules: []string{"store_a"},
+		},
+		func() (uint64, error) {
+			return 999, nil
+		},
+		newTestCursorResolver().resolveCursor,
+		func() (uint64, error) {
+			t.Error("should not pass here")
+			return 0, nil
+		},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, 10, int(req.ResolvedStartBlockNum))
+	assert.Equal(t, 10, int(req.LinearHandoffBlockNum), "store deltas are not in the cached outputs")
+
+	req, _, err = BuildRequestDetails(
+		context.Background(),
+		&pbsubstreamsrpc.Request{
+			StartBlockNum:  10,
+			ProductionMode: true,
+			OutputModules:  []string{"map_a", "map_b"},
+		},
+		func() (uint64, error) {
+			return 999, nil
+		},
+		newTestCursorResolver().resolveCursor,
+		func() (uint64, error) {
+			t.Error("should not pass here")
+			return 0, nil
+		},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, 999, int(req.LinearHandoffBlockNum), "the cached outputs are read for all the output modules")
 }
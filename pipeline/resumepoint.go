@@ -0,0 +1,155 @@
+package pipeline
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
+	"github.com/streamingfast/substreams/reqctx"
+	"github.com/streamingfast/substreams/storage/store"
+)
+
+// resumePoints periodically saves complete snapshots of the stores of the
+// tier1 linear pipeline right after a final block was processed, and its
+// outputs sent along with its cursor. A request resuming from that cursor is
+// planned from these snapshots, like from the ones on the store save interval
+// boundaries, instead of backprocessing from the previous boundary.
+//
+// Each snapshot is the exact content of its store up to the cursor's block, so
+// that a resume point partially written is still consistent: the stores
+// missing it are planned from their own previous snapshot. The resume points
+// of a request are saved under its own prefix, named after the block of their
+// cursor, see store.NewResumePointFileInfo: the previous one is deleted once a
+// new one is written, without touching the snapshots of the other requests,
+// and the last one once the request ends cleanly, see deleteAll. Those of the
+// requests that never do are swept by store.PartialReaper once old enough.
+type resumePoints struct {
+	interval  time.Duration
+	requestID string // prefix of the resume points, unique to the request
+	lastSaved time.Time
+
+	mu       sync.Mutex
+	saving   bool
+	ended    bool // the resume points written are deleted, see deleteAll
+	previous map[string]*store.FileInfo
+}
+
+func newResumePoints(interval time.Duration) *resumePoints {
+	if interval == 0 {
+		return nil
+	}
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+	return &resumePoints{interval: interval, requestID: hex.EncodeToString(id)}
+}
+
+// maybeSave saves the stores at the end of the final block `clock`, unless the
+// last resume point was saved less than `interval` ago or is still being
+// written. Only the keys of the stores are copied in the block path, the
+// snapshots are marshalled and written in the background, failing to write
+// them does not fail the request.
+func (r *resumePoints) maybeSave(ctx context.Context, clock *pbsubstreams.Clock, stores *Stores) {
+	if r == nil || reqctx.Details(ctx).IsSubRequest {
+		return
+	}
+	endBlock := clock.Number + 1
+	if endBlock%stores.interval == 0 || time.Since(r.lastSaved) < r.interval {
+		return // the snapshots on the boundaries are saved by flushStores
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.saving || r.ended {
+		return
+	}
+
+	files := make(map[string]*store.FileInfo)
+	var writes []func() error
+	for name, oneStore := range stores.StoreMap.All() {
+		fullStore, ok := oneStore.(*store.FullKV)
+		if !ok || fullStore.InitialBlock() >= endBlock || reqctx.Details(ctx).SkipSnapshotSave(name) {
+			continue
+		}
+		file := store.NewResumePointFileInfo(fullStore.InitialBlock(), endBlock, clock.Id, r.requestID)
+		writer := fullStore.SaveResumePoint(file)
+		files[name] = file
+		writes = append(writes, func() error { return writer.Write(ctx) })
+	}
+
+	r.saving = true
+	r.lastSaved = time.Now()
+	go r.write(ctx, clock, stores.configs, files, writes)
+}
+
+func (r *resumePoints) write(ctx context.Context, clock *pbsubstreams.Clock, configs store.ConfigMap, files map[string]*store.FileInfo, writes []func() error) {
+	logger := reqctx.Logger(ctx)
+
+	var err error
+	for _, write := range writes {
+		// all the writes are run, releasing the snapshots they hold
+		if writeErr := write(); writeErr != nil && err == nil {
+			err = writeErr
+		}
+	}
+	if err != nil {
+		logger.Warn("cannot write resume point", zap.Uint64("block_num", clock.Number), zap.Error(err))
+	} else {
+		logger.Debug("resume point written", zap.Uint64("block_num", clock.Number), zap.String("block_id", clock.Id))
+	}
+
+	r.mu.Lock()
+	var obsolete map[string]*store.FileInfo
+	if err == nil {
+		obsolete, r.previous = r.previous, files
+	}
+	r.mu.Unlock()
+	deleteResumePoints(ctx, configs, obsolete)
+
+	r.mu.Lock()
+	r.saving = false
+	obsolete = nil
+	if r.ended {
+		// some of them may be written when failing
+		obsolete, r.previous = files, nil
+	}
+	r.mu.Unlock()
+	deleteResumePoints(ctx, configs, obsolete)
+}
+
+// deleteAll deletes the last resume point of the request once it ended
+// cleanly, nothing being left to resume. A resume point still being written is
+// deleted once written.
+func (r *resumePoints) deleteAll(ctx context.Context, configs store.ConfigMap) {
+	if r == nil || reqctx.Details(ctx).IsSubRequest {
+		return
+	}
+
+	r.mu.Lock()
+	r.ended = true
+	if r.saving {
+		r.mu.Unlock()
+		return
+	}
+	files := r.previous
+	r.previous = nil
+	r.mu.Unlock()
+
+	deleteResumePoints(ctx, configs, files)
+}
+
+func deleteResumePoints(ctx context.Context, configs store.ConfigMap, files map[string]*store.FileInfo) {
+	for name, file := range files {
+		storeConfig, found := configs[name]
+		if !found {
+			continue
+		}
+		if err := storeConfig.DeleteResumePoint(ctx, file); err != nil {
+			reqctx.Logger(ctx).Info("cannot delete resume point", zap.String("store", name), zap.String("file_name", file.Filename), zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/streamingfast/dstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
+	"github.com/streamingfast/substreams/reqctx"
+	"github.com/streamingfast/substreams/storage/store"
+)
+
+func TestResumePoints(t *testing.T) {
+	ctx := reqctx.WithRequest(context.Background(), &reqctx.RequestDetails{OutputModule: "map_a"})
+
+	config, err := store.NewConfig("store_a", 0, "store_a", pbsubstreams.Module_KindStore_UPDATE_POLICY_SET, "string", dstore.NewMockStore(nil), "")
+	require.NoError(t, err)
+	stores := NewStores(store.ConfigMap{"store_a": config}, 100, 0, 0, false, "tier1")
+	storeMap := store.NewMap()
+	fullKV := config.NewFullKV(zap.NewNop())
+	fullKV.Set(0, "k", "v")
+	storeMap.Set(fullKV)
+	stores.SetStoreMap(storeMap)
+
+	r := newResumePoints(time.Hour)
+	saveAt := func(blockNum uint64) {
+		r.lastSaved = time.Time{}
+		r.maybeSave(ctx, &pbsubstreams.Clock{Number: blockNum, Id: fmt.Sprintf("block%d", blockNum)}, stores)
+		require.Eventually(t, func() bool {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			return !r.saving
+		}, time.Second, time.Millisecond)
+	}
+	exists := func(endBlock uint64) bool {
+		found, err := config.FileExists(ctx, store.NewResumePointFileInfo(0, endBlock, fmt.Sprintf("block%d", endBlock-1), r.requestID))
+		require.NoError(t, err)
+		return found
+	}
+
+	saveAt(10)
+	assert.True(t, exists(11))
+
+	r.maybeSave(ctx, &pbsubstreams.Clock{Number: 20}, stores)
+	assert.False(t, exists(21), "saved less than an interval ago")
+
+	saveAt(20)
+	assert.True(t, exists(21))
+	assert.False(t, exists(11), "previous resume point deleted")
+
+	saveAt(99)
+	assert.False(t, exists(100), "boundaries are saved by the store flushes")
+	assert.True(t, exists(21))
+
+	files, err := config.ListResumePoints(ctx, 100)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, uint64(21), files[0].Range.ExclusiveEndBlock)
+
+	snapshots, err := config.ListSnapshotFiles(ctx, 100)
+	require.NoError(t, err)
+	assert.Empty(t, snapshots, "resume points are not listed with the boundary snapshots")
+
+	other := newResumePoints(time.Hour)
+	other.maybeSave(ctx, &pbsubstreams.Clock{Number: 30, Id: "block30"}, stores)
+	require.Eventually(t, func() bool {
+		other.mu.Lock()
+		defer other.mu.Unlock()
+		return !other.saving
+	}, time.Second, time.Millisecond)
+	saveAt(40)
+	assert.False(t, exists(21))
+	files, err = config.ListResumePoints(ctx, 100)
+	require.NoError(t, err)
+	assert.Len(t, files, 2, "the resume points of the other requests are kept")
+
+	r.deleteAll(ctx, stores.configs)
+	assert.False(t, exists(41), "deleted once the request ended cleanly")
+	files, err = config.ListResumePoints(ctx, 100)
+	require.NoError(t, err)
+	assert.Len(t, files, 1, "the resume points of the other requests are kept")
+	saveAt(50)
+	assert.False(t, exists(51), "not saved once the request ended")
+}
+
+func TestResumePoints_Disabled(t *testing.T) {
+	assert.Nil(t, newResumePoints(0))
+}
@@ -0,0 +1,68 @@
+package pipeline
+
+import (
+	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
+)
+
+// outputSampler decides which `BlockScopedData` are sent back to a client that
+// negotiated output sampling (ex: the terminal GUI in development mode), so
+// that slow renderers are not flooded. Every `every`-th block is always sent,
+// as well as any block for which at least one module produced something
+// (a non-empty output, store deltas or logs).
+type outputSampler struct {
+	every uint64
+}
+
+func newOutputSampler(every uint64) *outputSampler {
+	if every <= 1 {
+		return nil
+	}
+	return &outputSampler{every: every}
+}
+
+func (s *outputSampler) shouldSend(
+	blockNum uint64,
+	mapModuleOutput *pbsubstreamsrpc.MapModuleOutput,
+	extraMapModuleOutputs []*pbsubstreamsrpc.MapModuleOutput,
+	extraStoreModuleOutputs []*pbsubstreamsrpc.StoreModuleOutput,
+) bool {
+	if s == nil {
+		return true
+	}
+
+	if blockNum%s.every == 0 || mapOutputMatches(mapModuleOutput) {
+		return true
+	}
+	for _, out := range extraMapModuleOutputs {
+		if mapOutputMatches(out) {
+			return true
+		}
+	}
+	for _, out := range extraStoreModuleOutputs {
+		if storeOutputMatches(out) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func mapOutputMatches(out *pbsubstreamsrpc.MapModuleOutput) bool {
+	if out == nil {
+		return false
+	}
+	if len(out.MapOutput.GetValue()) != 0 {
+		return true
+	}
+	return len(out.DebugInfo.GetLogs()) != 0
+}
+
+func storeOutputMatches(out *pbsubstreamsrpc.StoreModuleOutput) bool {
+	if out == nil {
+		return false
+	}
+	if len(out.DebugStoreDeltas) != 0 {
+		return true
+	}
+	return len(out.DebugInfo.GetLogs()) != 0
+}
@@ -0,0 +1,44 @@
+package pipeline
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
+)
+
+func TestOutputSampler(t *testing.T) {
+	emptyOutput := &pbsubstreamsrpc.MapModuleOutput{Name: "A", MapOutput: &anypb.Any{}}
+	dataOutput := &pbsubstreamsrpc.MapModuleOutput{Name: "A", MapOutput: &anypb.Any{Value: []byte{0x01}}}
+	logOutput := &pbsubstreamsrpc.MapModuleOutput{Name: "B", DebugInfo: &pbsubstreamsrpc.OutputDebugInfo{Logs: []string{"hello"}}}
+	deltasOutput := &pbsubstreamsrpc.StoreModuleOutput{Name: "C", DebugStoreDeltas: []*pbsubstreamsrpc.StoreDelta{{Operation: pbsubstreamsrpc.StoreDelta_CREATE}}}
+
+	tests := []struct {
+		name        string
+		every       uint64
+		blockNum    uint64
+		output      *pbsubstreamsrpc.MapModuleOutput
+		extraMaps   []*pbsubstreamsrpc.MapModuleOutput
+		extraStores []*pbsubstreamsrpc.StoreModuleOutput
+		expectSend  bool
+	}{
+		{"disabled", 0, 11, emptyOutput, nil, nil, true},
+		{"every block", 1, 11, emptyOutput, nil, nil, true},
+		{"sampled block", 10, 20, emptyOutput, nil, nil, true},
+		{"skipped block", 10, 21, emptyOutput, nil, nil, false},
+		{"skipped block, nil output", 10, 21, nil, nil, nil, false},
+		{"output data", 10, 21, dataOutput, nil, nil, true},
+		{"extra map logs", 10, 21, emptyOutput, []*pbsubstreamsrpc.MapModuleOutput{logOutput}, nil, true},
+		{"extra store deltas", 10, 21, emptyOutput, nil, []*pbsubstreamsrpc.StoreModuleOutput{deltasOutput}, true},
+		{"extra empty store", 10, 21, emptyOutput, nil, []*pbsubstreamsrpc.StoreModuleOutput{{Name: "C"}}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newOutputSampler(test.every)
+			assert.Equal(t, test.expectSend, s.shouldSend(test.blockNum, test.output, test.extraMaps, test.extraStores))
+		})
+	}
+}
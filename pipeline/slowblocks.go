@@ -0,0 +1,124 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/streamingfast/substreams"
+	"github.com/streamingfast/substreams/metrics"
+	pbssinternal "github.com/streamingfast/substreams/pb/sf/substreams/intern/v2"
+	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
+	"github.com/streamingfast/substreams/reqctx"
+)
+
+// slowBlocksDetector tracks, per module, the blocks on which the module's execution
+// time exceeded the execution budget. Once a module exceeded it on `repeat` blocks,
+// those blocks are reported and tracking starts over, so pathological blocks (huge
+// logs, decoding bombs) get surfaced to the user instead of looking like a stalled
+// server.
+type slowBlocksDetector struct {
+	budget  time.Duration
+	repeat  int
+	pending map[string][]slowBlock
+}
+
+type slowBlock struct {
+	blockNum uint64
+	duration time.Duration
+}
+
+func newSlowBlocksDetector(budget time.Duration, repeat uint64) *slowBlocksDetector {
+	if budget == 0 {
+		return nil
+	}
+	if repeat == 0 {
+		repeat = 1
+	}
+	return &slowBlocksDetector{
+		budget:  budget,
+		repeat:  int(repeat),
+		pending: map[string][]slowBlock{},
+	}
+}
+
+// observe records the execution time of `moduleName` on `blockNum`. `slow` is true
+// when it exceeded the budget, `report` holds the blocks to report when the module
+// exceeded the budget `repeat` times.
+func (d *slowBlocksDetector) observe(moduleName string, blockNum uint64, duration time.Duration) (slow bool, report []slowBlock) {
+	if d == nil || duration <= d.budget {
+		return false, nil
+	}
+
+	blocks := append(d.pending[moduleName], slowBlock{blockNum: blockNum, duration: duration})
+	if len(blocks) < d.repeat {
+		d.pending[moduleName] = blocks
+		return true, nil
+	}
+
+	delete(d.pending, moduleName)
+	return true, blocks
+}
+
+func (p *Pipeline) checkExecutionBudget(ctx context.Context, moduleName string, blockNum uint64, duration time.Duration) error {
+	slow, report := p.slowBlocks.observe(moduleName, blockNum, duration)
+	if slow {
+		metrics.ModuleSlowBlocks.Inc()
+	}
+	if report == nil {
+		return nil
+	}
+
+	blockNums := make([]uint64, len(report))
+	for i, block := range report {
+		blockNums[i] = block.blockNum
+	}
+	reqctx.Logger(ctx).Warn("module execution repeatedly exceeded the execution budget",
+		zap.String("module_name", moduleName),
+		zap.Duration("budget", p.slowBlocks.budget),
+		zap.Uint64s("block_nums", blockNums),
+	)
+
+	if p.respFunc == nil {
+		return nil
+	}
+	if reqDetails := reqctx.Details(ctx); !reqDetails.IsSubRequest && !reqDetails.HasCapability(substreams.CapabilitySlowExecutionProgress) {
+		return nil
+	}
+	if err := p.respFunc(p.toSlowExecutionResponse(ctx, moduleName, report)); err != nil {
+		return fmt.Errorf("sending slow execution progress: %w", err)
+	}
+	return nil
+}
+
+func (p *Pipeline) toSlowExecutionResponse(ctx context.Context, moduleName string, report []slowBlock) substreams.ResponseFromAnyTier {
+	budgetMs := uint64(p.slowBlocks.budget.Milliseconds())
+
+	if reqctx.Details(ctx).IsSubRequest {
+		blocks := make([]*pbssinternal.SlowBlock, len(report))
+		for i, block := range report {
+			blocks[i] = &pbssinternal.SlowBlock{BlockNum: block.blockNum, DurationMs: uint64(block.duration.Milliseconds())}
+		}
+		return &pbssinternal.ProcessRangeResponse{
+			ModuleName: moduleName,
+			Type: &pbssinternal.ProcessRangeResponse_SlowExecution{
+				SlowExecution: &pbssinternal.SlowExecution{BudgetMs: budgetMs, Blocks: blocks},
+			},
+		}
+	}
+
+	blocks := make([]*pbsubstreamsrpc.ModuleProgress_SlowBlock, len(report))
+	for i, block := range report {
+		blocks[i] = &pbsubstreamsrpc.ModuleProgress_SlowBlock{BlockNum: block.blockNum, DurationMs: uint64(block.duration.Milliseconds())}
+	}
+	return substreams.NewModulesProgressResponse([]*pbsubstreamsrpc.ModuleProgress{
+		{
+			Name: moduleName,
+			Type: &pbsubstreamsrpc.ModuleProgress_SlowExecution_{
+				SlowExecution: &pbsubstreamsrpc.ModuleProgress_SlowExecution{BudgetMs: budgetMs, Blocks: blocks},
+			},
+		},
+	})
+}
@@ -0,0 +1,101 @@
+package pipeline
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/streamingfast/substreams"
+	pbssinternal "github.com/streamingfast/substreams/pb/sf/substreams/intern/v2"
+	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
+	"github.com/streamingfast/substreams/reqctx"
+)
+
+func TestSlowBlocksDetector(t *testing.T) {
+	d := newSlowBlocksDetector(100*time.Millisecond, 2)
+
+	slow, report := d.observe("A", 10, 50*time.Millisecond)
+	assert.False(t, slow)
+	assert.Nil(t, report)
+
+	slow, report = d.observe("A", 11, 150*time.Millisecond)
+	assert.True(t, slow)
+	assert.Nil(t, report)
+
+	slow, report = d.observe("B", 11, 150*time.Millisecond)
+	assert.True(t, slow)
+	assert.Nil(t, report)
+
+	slow, report = d.observe("A", 12, 200*time.Millisecond)
+	assert.True(t, slow)
+	assert.Equal(t, []slowBlock{{11, 150 * time.Millisecond}, {12, 200 * time.Millisecond}}, report)
+
+	_, report = d.observe("A", 13, 200*time.Millisecond)
+	assert.Nil(t, report, "tracking starts over after a report")
+
+	disabled := newSlowBlocksDetector(0, 2)
+	slow, report = disabled.observe("A", 12, time.Hour)
+	assert.False(t, slow)
+	assert.Nil(t, report)
+}
+
+func TestPipeline_checkExecutionBudget(t *testing.T) {
+	tests := []struct {
+		name         string
+		isSubRequest bool
+		capabilities []string
+		check        func(t *testing.T, resp substreams.ResponseFromAnyTier) // nil when no response is expected
+	}{
+		{
+			name:         "tier1",
+			capabilities: []string{substreams.CapabilitySlowExecutionProgress},
+			check: func(t *testing.T, resp substreams.ResponseFromAnyTier) {
+				progress := resp.(*pbsubstreamsrpc.Response).GetProgress().Modules[0]
+				assert.Equal(t, "A", progress.Name)
+				assert.Equal(t, uint64(100), progress.GetSlowExecution().BudgetMs)
+				assert.Equal(t, uint64(10), progress.GetSlowExecution().Blocks[0].BlockNum)
+				assert.Equal(t, uint64(150), progress.GetSlowExecution().Blocks[0].DurationMs)
+			},
+		},
+		{
+			name: "tier1 without capability",
+		},
+		{
+			name:         "tier2",
+			isSubRequest: true,
+			check: func(t *testing.T, resp substreams.ResponseFromAnyTier) {
+				progress := resp.(*pbssinternal.ProcessRangeResponse)
+				assert.Equal(t, "A", progress.ModuleName)
+				assert.Equal(t, uint64(100), progress.GetSlowExecution().BudgetMs)
+				assert.Equal(t, uint64(10), progress.GetSlowExecution().Blocks[0].BlockNum)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := reqctx.WithRequest(context.Background(), &reqctx.RequestDetails{IsSubRequest: test.isSubRequest, Capabilities: test.capabilities})
+
+			var responses []substreams.ResponseFromAnyTier
+			p := &Pipeline{
+				slowBlocks: newSlowBlocksDetector(100*time.Millisecond, 1),
+				respFunc: func(resp substreams.ResponseFromAnyTier) error {
+					responses = append(responses, resp)
+					return nil
+				},
+			}
+
+			require.NoError(t, p.checkExecutionBudget(ctx, "A", 9, 50*time.Millisecond))
+			require.NoError(t, p.checkExecutionBudget(ctx, "A", 10, 150*time.Millisecond))
+			if test.check == nil {
+				assert.Empty(t, responses)
+				return
+			}
+			require.Len(t, responses, 1)
+			test.check(t, responses[0])
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package pipeline
+
+import (
+	"context"
+	"sync"
+)
+
+// snapshotWriter writes the store snapshots in the background, one after the
+// other in the order they were saved, so that the blocks are processed while
+// they are uploaded. At most `queueSize` snapshots wait to be written: saving
+// another one blocks until the oldest one is written.
+//
+// The first write failure stops the writer, it is returned by the following
+// calls to enqueue and failure, and by wait, failing the request.
+type snapshotWriter struct {
+	queue chan func(ctx context.Context) error
+	done  chan struct{}
+	start sync.Once
+
+	mu  sync.Mutex
+	err error
+}
+
+func newSnapshotWriter(queueSize uint64) *snapshotWriter {
+	if queueSize == 0 {
+		return nil
+	}
+	return &snapshotWriter{
+		queue: make(chan func(ctx context.Context) error, queueSize),
+		done:  make(chan struct{}),
+	}
+}
+
+// enqueue schedules `write` after the snapshots already enqueued, once there
+// is room in the queue.
+func (w *snapshotWriter) enqueue(ctx context.Context, write func(ctx context.Context) error) error {
+	if err := w.failure(); err != nil {
+		return err
+	}
+	w.start.Do(func() { go w.run(ctx) })
+
+	select {
+	case w.queue <- write:
+		return nil
+	case <-w.done:
+		return w.failure()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (w *snapshotWriter) run(ctx context.Context) {
+	defer close(w.done)
+	for {
+		select {
+		case write, ok := <-w.queue:
+			if !ok {
+				return
+			}
+			if err := write(ctx); err != nil {
+				w.mu.Lock()
+				w.err = err
+				w.mu.Unlock()
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// failure returns the error of the write that failed, if any.
+func (w *snapshotWriter) failure() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+// wait returns once all the snapshots enqueued are written, or one of them
+// failed. No snapshot can be enqueued afterwards.
+func (w *snapshotWriter) wait(ctx context.Context) error {
+	started := true
+	w.start.Do(func() { started = false })
+	close(w.queue)
+	if !started {
+		return nil
+	}
+
+	select {
+	case <-w.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return w.failure()
+}
@@ -0,0 +1,64 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotWriter_Order(t *testing.T) {
+	ctx := context.Background()
+	w := newSnapshotWriter(2)
+
+	var mu sync.Mutex
+	var written []int
+	release := make(chan struct{})
+	for i := 0; i < 5; i++ {
+		i := i
+		require.NoError(t, w.enqueue(ctx, func(ctx context.Context) error {
+			if i == 0 {
+				<-release // the queue fills up while the first snapshot is written
+			}
+			mu.Lock()
+			written = append(written, i)
+			mu.Unlock()
+			return nil
+		}))
+		if i == 2 {
+			close(release)
+		}
+	}
+
+	require.NoError(t, w.wait(ctx))
+	assert.Equal(t, []int{0, 1, 2, 3, 4}, written)
+}
+
+func TestSnapshotWriter_Failure(t *testing.T) {
+	ctx := context.Background()
+	w := newSnapshotWriter(1)
+
+	written := make(chan struct{})
+	require.NoError(t, w.enqueue(ctx, func(ctx context.Context) error {
+		defer close(written)
+		return fmt.Errorf("bucket unavailable")
+	}))
+	<-written
+
+	require.Eventually(t, func() bool { return w.failure() != nil }, time.Second, time.Millisecond)
+	assert.EqualError(t, w.enqueue(ctx, func(ctx context.Context) error { return nil }), "bucket unavailable")
+	assert.EqualError(t, w.wait(ctx), "bucket unavailable")
+}
+
+func TestSnapshotWriter_Disabled(t *testing.T) {
+	assert.Nil(t, newSnapshotWriter(0))
+	assert.NoError(t, (&Stores{}).waitSnapshots(context.Background()))
+}
+
+func TestSnapshotWriter_WaitNotStarted(t *testing.T) {
+	assert.NoError(t, newSnapshotWriter(1).wait(context.Background()))
+}
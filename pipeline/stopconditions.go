@@ -0,0 +1,81 @@
+package pipeline
+
+import (
+	"bytes"
+	"time"
+
+	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
+	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
+	"github.com/streamingfast/substreams/storage/store"
+)
+
+// Termination reasons of a stream that ended gracefully, see `substreams.TerminationReasonTrailer`.
+const (
+	TerminationReasonStopBlock  = "stop_block"
+	TerminationReasonMaxOutputs = "max_outputs"
+	TerminationReasonStoreValue = "store_value"
+	TerminationReasonStopAtTime = "stop_at_time"
+)
+
+// stopConditions evaluates the `StopConditions` of a request, block after
+// block, to end the stream before its stop block.
+type stopConditions struct {
+	maxOutputs uint64
+	outputs    uint64 // blocks where the output module produced data so far
+
+	storeValue *pbsubstreamsrpc.StoreValueCondition
+	stopAtTime time.Time // zero when not set
+}
+
+func newStopConditions(conditions *pbsubstreamsrpc.StopConditions) *stopConditions {
+	if conditions == nil {
+		return nil
+	}
+
+	out := &stopConditions{
+		maxOutputs: conditions.MaxOutputs,
+		storeValue: conditions.StoreValue,
+	}
+	if conditions.StopAtTime != nil {
+		out.stopAtTime = conditions.StopAtTime.AsTime()
+	}
+	return out
+}
+
+// beforeBlock returns the termination reason when the stream must end before
+// the block of `clock` is executed, or an empty string.
+func (c *stopConditions) beforeBlock(clock *pbsubstreams.Clock) string {
+	if c == nil || c.stopAtTime.IsZero() {
+		return ""
+	}
+	if !clock.Timestamp.AsTime().Before(c.stopAtTime) {
+		return TerminationReasonStopAtTime
+	}
+	return ""
+}
+
+// afterBlock returns the termination reason when the stream must end once the
+// block, whose output module output is `mapModuleOutput`, is sent, or an empty
+// string. It must be called once per executed block, before the deltas of the
+// stores are reset.
+func (c *stopConditions) afterBlock(mapModuleOutput *pbsubstreamsrpc.MapModuleOutput, stores store.Map) string {
+	if c == nil {
+		return ""
+	}
+
+	if c.maxOutputs != 0 && len(mapModuleOutput.GetMapOutput().GetValue()) != 0 {
+		c.outputs++
+		if c.outputs >= c.maxOutputs {
+			return TerminationReasonMaxOutputs
+		}
+	}
+
+	if c.storeValue != nil {
+		if s, found := stores.Get(c.storeValue.ModuleName); found {
+			if value, found := s.GetLast(c.storeValue.Key); found && bytes.Equal(value, c.storeValue.Value) {
+				return TerminationReasonStoreValue
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,60 @@
+package pipeline
+
+import (
+	"testing"
+	"time"
+
+	"github.com/streamingfast/dstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
+	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
+	"github.com/streamingfast/substreams/storage/store"
+)
+
+func TestStopConditions(t *testing.T) {
+	emptyOutput := &pbsubstreamsrpc.MapModuleOutput{Name: "A", MapOutput: &anypb.Any{}}
+	dataOutput := &pbsubstreamsrpc.MapModuleOutput{Name: "A", MapOutput: &anypb.Any{Value: []byte{0x01}}}
+
+	config, err := store.NewConfig("B", 0, "B", pbsubstreams.Module_KindStore_UPDATE_POLICY_SET, "string", dstore.NewMockStore(nil), "")
+	require.NoError(t, err)
+	fullKV := config.NewFullKV(zap.NewNop())
+	stores := store.Map{"B": fullKV}
+
+	t.Run("none", func(t *testing.T) {
+		c := newStopConditions(nil)
+		assert.Equal(t, "", c.beforeBlock(&pbsubstreams.Clock{Timestamp: timestamppb.Now()}))
+		assert.Equal(t, "", c.afterBlock(dataOutput, stores))
+	})
+
+	t.Run("max outputs", func(t *testing.T) {
+		c := newStopConditions(&pbsubstreamsrpc.StopConditions{MaxOutputs: 2})
+		assert.Equal(t, "", c.afterBlock(dataOutput, stores))
+		assert.Equal(t, "", c.afterBlock(emptyOutput, stores), "empty outputs are not counted")
+		assert.Equal(t, "", c.afterBlock(nil, stores))
+		assert.Equal(t, TerminationReasonMaxOutputs, c.afterBlock(dataOutput, stores))
+	})
+
+	t.Run("store value", func(t *testing.T) {
+		c := newStopConditions(&pbsubstreamsrpc.StopConditions{
+			StoreValue: &pbsubstreamsrpc.StoreValueCondition{ModuleName: "B", Key: "k", Value: []byte("done")},
+		})
+		assert.Equal(t, "", c.afterBlock(dataOutput, stores))
+		fullKV.Set(0, "k", "pending")
+		assert.Equal(t, "", c.afterBlock(dataOutput, stores))
+		fullKV.Set(1, "k", "done")
+		assert.Equal(t, TerminationReasonStoreValue, c.afterBlock(emptyOutput, stores))
+	})
+
+	t.Run("stop at time", func(t *testing.T) {
+		stopAt := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+		c := newStopConditions(&pbsubstreamsrpc.StopConditions{StopAtTime: timestamppb.New(stopAt)})
+		assert.Equal(t, "", c.beforeBlock(&pbsubstreams.Clock{Timestamp: timestamppb.New(stopAt.Add(-time.Second))}))
+		assert.Equal(t, TerminationReasonStopAtTime, c.beforeBlock(&pbsubstreams.Clock{Timestamp: timestamppb.New(stopAt)}))
+		assert.Equal(t, "", c.afterBlock(dataOutput, stores))
+	})
+}
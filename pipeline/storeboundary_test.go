@@ -1,8 +1,17 @@
 package pipeline
 
 import (
-	"github.com/stretchr/testify/assert"
+	"context"
 	"testing"
+
+	"github.com/streamingfast/dstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
+	"github.com/streamingfast/substreams/reqctx"
+	"github.com/streamingfast/substreams/storage/store"
 )
 
 func TestNew(t *testing.T) {
@@ -153,3 +162,67 @@ func TestNew(t *testing.T) {
 		})
 	}
 }
+
+func TestStores_flushStores_PerStoreBoundaries(t *testing.T) {
+	ctx := reqctx.WithRequest(context.Background(), &reqctx.RequestDetails{})
+
+	configs := store.ConfigMap{}
+	storeMap := store.NewMap()
+	for name, initialBlock := range map[string]uint64{"store_a": 0, "store_b": 250} {
+		config, err := store.NewConfig(name, initialBlock, name, pbsubstreams.Module_KindStore_UPDATE_POLICY_SET, "string", dstore.NewMockStore(nil), "")
+		require.NoError(t, err)
+		configs[name] = config
+		storeMap.Set(config.NewFullKV(zap.NewNop()))
+	}
+	stores := NewStores(configs, 100, 0, 0, false, "tier1")
+	stores.SetStoreMap(storeMap)
+
+	require.NoError(t, stores.flushStores(ctx, 300))
+
+	exists := func(name string, initialBlock, endBlock uint64) bool {
+		found, err := configs[name].FileExists(ctx, store.NewCompleteFileInfo(initialBlock, endBlock))
+		require.NoError(t, err)
+		return found
+	}
+	assert.True(t, exists("store_a", 0, 100))
+	assert.True(t, exists("store_a", 0, 300))
+	assert.False(t, exists("store_b", 250, 200), "boundary before the store's initial block")
+	assert.True(t, exists("store_b", 250, 300))
+}
+
+func TestStores_flushStores_Commit(t *testing.T) {
+	ctx := reqctx.WithRequest(context.Background(), &reqctx.RequestDetails{})
+	stateStore, err := dstore.NewStore("file://"+t.TempDir(), "zst", "zstd", true)
+	require.NoError(t, err)
+	commits := store.NewCommits(stateStore)
+
+	configs := store.ConfigMap{}
+	storeMap := store.NewMap()
+	for _, name := range []string{"store_a", "store_b"} {
+		config, err := store.NewConfig(name, 0, name, pbsubstreams.Module_KindStore_UPDATE_POLICY_SET, "string", stateStore, "trace")
+		require.NoError(t, err)
+		config.SetCommits(commits)
+		configs[name] = config
+		storeMap.Set(config.NewFullKV(zap.NewNop()))
+	}
+	stores := NewStores(configs, 100, 0, 0, false, "tier1")
+	stores.SetStoreMap(storeMap)
+	stores.writer = newSnapshotWriter(1)
+	stores.traceID = "trace"
+
+	require.NoError(t, stores.flushStores(ctx, 100))
+	require.NoError(t, stores.waitSnapshots(ctx))
+
+	for _, moduleHash := range []string{"store_a", "store_b"} {
+		committed, err := stateStore.FileExists(ctx, moduleHash+"/commits/0000000100-trace.commit.json")
+		require.NoError(t, err)
+		assert.True(t, committed)
+		pending, err := stateStore.FileExists(ctx, moduleHash+"/commits/0000000100-trace.pending.json")
+		require.NoError(t, err)
+		assert.False(t, pending)
+	}
+
+	uncommitted, err := commits.Uncommitted(ctx, "store_a", 200)
+	require.NoError(t, err)
+	assert.False(t, uncommitted.Discards(store.NewPartialFileInfo(0, 100, "trace")))
+}
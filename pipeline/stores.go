@@ -3,32 +3,52 @@ package pipeline
 import (
 	"context"
 	"fmt"
-	"github.com/streamingfast/substreams/block"
-	pbssinternal "github.com/streamingfast/substreams/pb/sf/substreams/intern/v2"
+	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
 	"github.com/streamingfast/substreams/reqctx"
 	"github.com/streamingfast/substreams/storage/store"
 	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
+	"io"
+	"sort"
 )
 
 type Stores struct {
 	isSubRequest    bool
-	bounder         *storeBoundary
+	interval        uint64                    // store snapshot save interval
+	bounders        map[string]*storeBoundary // by store name, see flushStores
 	configs         store.ConfigMap
 	StoreMap        store.Map
-	partialsWritten block.Ranges // when backprocessing, to report back to orchestrator
+	partialsWritten store.FileInfos // when backprocessing, to report back to orchestrator
 	tier            string
+
+	// fullOutputStore is a complete copy of the output store of a tier2 store
+	// job carrying the outputs of a map module, see
+	// reqctx.RequestDetails.CachedOutputModule. The partial output store only
+	// holds the changes of the job's range, so that map reads this one instead.
+	fullOutputStore store.Store
+
+	onStoreFlush func(ctx context.Context, storeName string, file *store.FileInfo) error
+	journal      *undoJournal    // the store changes of the reversible blocks, nil for tier2
+	writer       *snapshotWriter // if set, the snapshots are written in the background
+	traceID      string          // of the request, naming the flushes committed
 }
 
 func NewStores(storeConfigs store.ConfigMap, storeSnapshotSaveInterval, requestStartBlockNum, stopBlockNum uint64, isSubRequest bool, tier string) *Stores {
-	// FIXME(abourget): a StoreBoundary should exist for EACH Store
-	//  because the module's Initial Block could change the range of each
-	//  store.
-	bounder := NewStoreBoundary(storeSnapshotSaveInterval, requestStartBlockNum, stopBlockNum)
+	// Each store has its own boundaries, starting after its module's initial
+	// block: a store is not saved on the boundaries preceding it.
+	bounders := make(map[string]*storeBoundary, len(storeConfigs))
+	for name, config := range storeConfigs {
+		startBlockNum := requestStartBlockNum
+		if config.ModuleInitialBlock() > startBlockNum {
+			startBlockNum = config.ModuleInitialBlock()
+		}
+		bounders[name] = NewStoreBoundary(storeSnapshotSaveInterval, startBlockNum, stopBlockNum)
+	}
 	return &Stores{
 		configs:      storeConfigs,
 		isSubRequest: isSubRequest,
-		bounder:      bounder,
+		interval:     storeSnapshotSaveInterval,
+		bounders:     bounders,
 		tier:         tier,
 	}
 }
@@ -37,8 +57,42 @@ func (s *Stores) SetStoreMap(storeMap store.Map) {
 	s.StoreMap = storeMap
 }
 
-func (s *Stores) resetStores() {
-	for _, s := range s.StoreMap.All() {
+// readStore returns the store read by the modules depending on `name`.
+func (s *Stores) readStore(name string) (store.Store, bool) {
+	if s.fullOutputStore != nil && s.fullOutputStore.Name() == name {
+		return s.fullOutputStore, true
+	}
+	return s.StoreMap.Get(name)
+}
+
+// allStores returns the stores of the StoreMap along with fullOutputStore.
+func (s *Stores) allStores() []store.Store {
+	var out []store.Store
+	for _, oneStore := range s.StoreMap.All() {
+		out = append(out, oneStore)
+	}
+	if s.fullOutputStore != nil {
+		out = append(out, s.fullOutputStore)
+	}
+	return out
+}
+
+// Close releases the resources held by the stores, like their spill files.
+func (s *Stores) Close(ctx context.Context) {
+	for _, oneStore := range s.allStores() {
+		if closer, ok := oneStore.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				reqctx.Logger(ctx).Warn("closing store", zap.String("store", oneStore.Name()), zap.Error(err))
+			}
+		}
+	}
+}
+
+func (s *Stores) resetStores(blockNum uint64) {
+	for _, s := range s.allStores() {
+		if expirer, ok := s.(store.Expirer); ok {
+			expirer.TrackUpdates(blockNum)
+		}
 		if resetableStore, ok := s.(store.Resettable); ok {
 			resetableStore.Reset()
 		}
@@ -47,57 +101,199 @@ func (s *Stores) resetStores() {
 
 func (s *Stores) flushStores(ctx context.Context, blockNum uint64) (err error) {
 	logger := reqctx.Logger(ctx)
-	boundaryIntervals := s.bounder.GetStoreFlushRanges(s.isSubRequest, s.bounder.requestStopBlock, blockNum)
+	if s.writer != nil {
+		if err := s.writer.failure(); err != nil {
+			return fmt.Errorf("writing stores snapshot: %w", err)
+		}
+	}
+
+	storesByBoundary := make(map[uint64][]string)
+	for name, bounder := range s.bounders {
+		initialBlock := s.configs[name].ModuleInitialBlock()
+		for _, boundaryBlock := range bounder.GetStoreFlushRanges(s.isSubRequest, bounder.requestStopBlock, blockNum) {
+			if boundaryBlock <= initialBlock {
+				continue // a request stopping before the store's initial block
+			}
+			storesByBoundary[boundaryBlock] = append(storesByBoundary[boundaryBlock], name)
+		}
+	}
+
+	boundaryIntervals := make([]uint64, 0, len(storesByBoundary))
+	for boundaryBlock, names := range storesByBoundary {
+		boundaryIntervals = append(boundaryIntervals, boundaryBlock)
+		sort.Strings(names)
+	}
+	sort.Slice(boundaryIntervals, func(i, j int) bool { return boundaryIntervals[i] < boundaryIntervals[j] })
+
 	if len(boundaryIntervals) > 0 {
 		logger.Info("flushing boundaries", zap.Uint64s("boundaries", boundaryIntervals))
 	}
 	reqctx.Span(ctx).SetAttributes(attribute.Int("pipeline.stores.boundary_reached", len(boundaryIntervals)))
 	for _, boundaryBlock := range boundaryIntervals {
-		if err := s.saveStoresSnapshots(ctx, boundaryBlock); err != nil {
+		if err := s.saveStoresSnapshots(ctx, boundaryBlock, storesByBoundary[boundaryBlock]); err != nil {
 			return fmt.Errorf("saving stores snapshot at bound %d: %w", boundaryBlock, err)
 		}
 	}
 	return nil
 }
 
-func (s *Stores) storesHandleUndo(moduleOutput *pbssinternal.ModuleOutput) {
-	if s, found := s.StoreMap.Get(moduleOutput.ModuleName); found {
-		if deltaStore, ok := s.(store.DeltaAccessor); ok {
-			deltaStore.ApplyDeltasReverse(moduleOutput.GetStoreDeltas().StoreDeltas)
-		}
+// recordUndo retains the deltas of the block `clock` in the undo journal,
+// before the stores are reset.
+func (s *Stores) recordUndo(clock *pbsubstreams.Clock) {
+	if s == nil || s.journal == nil {
+		return
 	}
+	s.journal.record(clock, s.allStores())
 }
 
-func (s *Stores) saveStoresSnapshots(ctx context.Context, boundaryBlock uint64) (err error) {
+// handleUndo rolls back the changes of the block `clock` from the stores.
+func (s *Stores) handleUndo(clock *pbsubstreams.Clock) error {
+	if s == nil || s.journal == nil {
+		return nil
+	}
+	return s.journal.undo(clock, s.StoreMap)
+}
+
+func (s *Stores) handleFinal(clock *pbsubstreams.Clock) {
+	if s == nil || s.journal == nil {
+		return
+	}
+	s.journal.final(clock.Number)
+}
+
+func (s *Stores) handleStalled(clock *pbsubstreams.Clock) {
+	if s == nil || s.journal == nil {
+		return
+	}
+	s.journal.stalled(clock.Id)
+}
+
+// saveStoresSnapshots saves the snapshots of the stores `names` reaching the
+// boundary `boundaryBlock`. When several are saved, the flush is committed
+// once they are all written, see store.Commits.
+func (s *Stores) saveStoresSnapshots(ctx context.Context, boundaryBlock uint64, names []string) (err error) {
 	reqDetails := reqctx.Details(ctx)
 
-	for name, oneStore := range s.StoreMap.All() {
+	var saveStores []store.Store
+	for _, name := range names {
+		oneStore, found := s.StoreMap.Get(name)
+		if !found {
+			continue
+		}
+		// Stores whose snapshot is not saved here are still expired, their
+		// content must match the one of the snapshots saved by other requests.
+		s.expireStore(ctx, oneStore, boundaryBlock)
 		if reqDetails.SkipSnapshotSave(name) {
 			continue
 		}
-		if err := s.saveStoreSnapshot(ctx, oneStore, boundaryBlock); err != nil {
+		saveStores = append(saveStores, oneStore)
+	}
+	if s.fullOutputStore != nil {
+		s.expireStore(ctx, s.fullOutputStore, boundaryBlock)
+	}
+
+	flush, err := s.beginFlush(ctx, boundaryBlock, saveStores)
+	if err != nil {
+		return err
+	}
+	for i, saveStore := range saveStores {
+		file, err := s.saveStoreSnapshot(ctx, saveStore, boundaryBlock)
+		if err != nil {
 			return fmt.Errorf("save store snapshot: %w", err)
 		}
+		if flush != nil {
+			flush.Stores[i].Filename = file.Filename
+		}
 	}
-	return nil
+	if flush == nil {
+		return nil
+	}
+
+	commit := func(ctx context.Context) error {
+		if err := s.configs.Commits().Commit(ctx, flush); err != nil {
+			return fmt.Errorf("committing stores flush at boundary %d: %w", boundaryBlock, err)
+		}
+		return nil
+	}
+	if s.writer != nil {
+		// written after the snapshots enqueued before it
+		return s.writer.enqueue(ctx, commit)
+	}
+	return commit(ctx)
+}
+
+// beginFlush writes the pending manifest of the snapshots of `saveStores`,
+// when there are several of them. It returns nil when the flush is not
+// committed.
+func (s *Stores) beginFlush(ctx context.Context, boundaryBlock uint64, saveStores []store.Store) (*store.Flush, error) {
+	commits := s.configs.Commits()
+	if commits == nil || len(saveStores) < 2 {
+		return nil, nil
+	}
+
+	flush := &store.Flush{
+		BoundaryBlock: boundaryBlock,
+		TraceID:       s.traceID,
+	}
+	for _, saveStore := range saveStores {
+		flush.Stores = append(flush.Stores, &store.FlushedStore{
+			Name:       saveStore.Name(),
+			ModuleHash: s.configs[saveStore.Name()].ModuleHash(),
+		})
+	}
+	if err := commits.Begin(ctx, flush); err != nil {
+		return nil, fmt.Errorf("beginning stores flush at boundary %d: %w", boundaryBlock, err)
+	}
+	return flush, nil
 }
 
-func (s *Stores) saveStoreSnapshot(ctx context.Context, saveStore store.Store, boundaryBlock uint64) (err error) {
-	ctx, span := reqctx.WithSpan(ctx, fmt.Sprintf("substreams/%s/stores/save_store_snapshot", s.tier))
+// expireStore enforces the retention policy of `expireStore` on the store save
+// interval boundaries, see store.Expirer.
+func (s *Stores) expireStore(ctx context.Context, expireStore store.Store, boundaryBlock uint64) {
+	expirer, ok := expireStore.(store.Expirer)
+	if !ok || boundaryBlock%s.interval != 0 {
+		return
+	}
+	if deleted := expirer.Expire(boundaryBlock); deleted > 0 {
+		reqctx.Logger(ctx).Debug("expired store keys", zap.String("store", expireStore.Name()), zap.Int("deleted_count", deleted), zap.Uint64("boundary_block", boundaryBlock))
+	}
+}
+
+func (s *Stores) saveStoreSnapshot(ctx context.Context, saveStore store.Store, boundaryBlock uint64) (file *store.FileInfo, err error) {
+	spanCtx, span := reqctx.WithSpan(ctx, fmt.Sprintf("substreams/%s/stores/save_store_snapshot", s.tier))
 	span.SetAttributes(attribute.String("subtreams.store", saveStore.Name()))
 	defer span.EndWithErr(&err)
 
 	file, writer, err := saveStore.Save(boundaryBlock)
 	if err != nil {
-		return fmt.Errorf("saving store %q at boundary %d: %w", saveStore.Name(), boundaryBlock, err)
+		return nil, fmt.Errorf("saving store %q at boundary %d: %w", saveStore.Name(), boundaryBlock, err)
 	}
 
-	if err = writer.Write(ctx); err != nil {
-		return fmt.Errorf("failed to write store: %w", err)
+	write := func(ctx context.Context) error {
+		if err := writer.Write(ctx); err != nil {
+			return fmt.Errorf("failed to write store: %w", err)
+		}
+		file.Size = writer.Size()
+
+		if s.onStoreFlush != nil {
+			return s.onStoreFlush(ctx, saveStore.Name(), file)
+		}
+		return nil
+	}
+
+	returnWritten := reqctx.Details(ctx).ShouldReturnWrittenPartials(saveStore.Name())
+	if _, isPartial := saveStore.(store.PartialStore); s.writer != nil && (!isPartial || returnWritten) {
+		// The snapshot does not change with the store once saved, the partial
+		// stores streaming theirs are rolled below.
+		if err := s.writer.enqueue(ctx, write); err != nil {
+			return nil, fmt.Errorf("writing store %q at boundary %d: %w", saveStore.Name(), boundaryBlock, err)
+		}
+	} else if err := write(spanCtx); err != nil {
+		return nil, err
 	}
 
-	if reqctx.Details(ctx).ShouldReturnWrittenPartials(saveStore.Name()) {
-		s.partialsWritten = append(s.partialsWritten, file.Range)
+	if returnWritten {
+		s.partialsWritten = append(s.partialsWritten, file)
 		reqctx.Logger(ctx).Debug("adding partials written",
 			zap.Stringer("range", file.Range),
 			zap.Stringer("ranges", s.partialsWritten),
@@ -105,9 +301,21 @@ func (s *Stores) saveStoreSnapshot(ctx context.Context, saveStore store.Store, b
 		)
 
 		if v, ok := saveStore.(store.PartialStore); ok {
-			reqctx.Span(ctx).AddEvent("store_roll_trigger")
+			reqctx.Span(spanCtx).AddEvent("store_roll_trigger")
 			v.Roll(boundaryBlock)
 		}
 	}
+	return file, nil
+}
+
+// waitSnapshots returns once the snapshots saved are written, see
+// snapshotWriter.
+func (s *Stores) waitSnapshots(ctx context.Context) error {
+	if s.writer == nil {
+		return nil
+	}
+	if err := s.writer.wait(ctx); err != nil {
+		return fmt.Errorf("writing stores snapshot: %w", err)
+	}
 	return nil
 }
@@ -0,0 +1,121 @@
+package pipeline
+
+import (
+	"fmt"
+
+	pbssinternal "github.com/streamingfast/substreams/pb/sf/substreams/intern/v2"
+	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
+	"github.com/streamingfast/substreams/storage/store"
+)
+
+// undoJournal retains the deltas applied to the stores by each reversible
+// block, in processing order, to roll them back when the block is undone, one
+// block after the other on deep reorganizations. A block's entry is dropped
+// once it is final, stalled or undone.
+//
+// When `maxDepth` is set, only the entries of the last `maxDepth` blocks are
+// retained: undoing an older block fails the request instead of leaving the
+// stores with the changes of a block that is no longer part of the chain.
+type undoJournal struct {
+	maxDepth uint64
+	entries  []*undoEntry
+
+	evictedUpTo uint64 // highest number of the blocks whose entry was evicted over maxDepth
+}
+
+type undoEntry struct {
+	blockNum uint64
+	blockID  string
+	deltas   []*storeUndoDeltas
+}
+
+type storeUndoDeltas struct {
+	storeName string
+	deltas    []*pbssinternal.StoreDelta
+}
+
+func newUndoJournal(maxDepth uint64) *undoJournal {
+	return &undoJournal{maxDepth: maxDepth}
+}
+
+// record retains the deltas of `stores` for the block `clock`, before they are
+// reset.
+func (j *undoJournal) record(clock *pbsubstreams.Clock, stores []store.Store) {
+	entry := &undoEntry{blockNum: clock.Number, blockID: clock.Id}
+	for _, oneStore := range stores {
+		accessor, ok := oneStore.(store.DeltaAccessor)
+		if !ok {
+			continue
+		}
+		if deltas := accessor.GetDeltas(); len(deltas) != 0 {
+			entry.deltas = append(entry.deltas, &storeUndoDeltas{storeName: oneStore.Name(), deltas: deltas})
+		}
+	}
+	j.entries = append(j.entries, entry)
+
+	if j.maxDepth != 0 && uint64(len(j.entries)) > j.maxDepth {
+		evicted := j.entries[:uint64(len(j.entries))-j.maxDepth]
+		for _, e := range evicted {
+			if e.blockNum > j.evictedUpTo {
+				j.evictedUpTo = e.blockNum
+			}
+		}
+		j.entries = append([]*undoEntry(nil), j.entries[len(evicted):]...)
+	}
+}
+
+// undo reverts the deltas of the block `clock` from the stores of `storeMap`.
+// A block without entry was not processed by this request, unless its entry
+// was evicted.
+func (j *undoJournal) undo(clock *pbsubstreams.Clock, storeMap store.Map) error {
+	idx := j.find(clock.Id)
+	if idx == -1 {
+		if clock.Number <= j.evictedUpTo {
+			return fmt.Errorf("cannot undo block %s: reorganization deeper than the %d blocks retained", clock.Id, j.maxDepth)
+		}
+		return nil
+	}
+
+	entry := j.entries[idx]
+	for i := len(entry.deltas) - 1; i >= 0; i-- {
+		undoDeltas := entry.deltas[i]
+		oneStore, found := storeMap.Get(undoDeltas.storeName)
+		if !found {
+			continue
+		}
+		if accessor, ok := oneStore.(store.DeltaAccessor); ok {
+			accessor.ApplyDeltasReverse(undoDeltas.deltas)
+		}
+	}
+	j.entries = append(j.entries[:idx], j.entries[idx+1:]...)
+	return nil
+}
+
+// final drops the entries of the blocks up to `blockNum`, now final: they
+// cannot be undone anymore.
+func (j *undoJournal) final(blockNum uint64) {
+	kept := j.entries[:0]
+	for _, entry := range j.entries {
+		if entry.blockNum > blockNum {
+			kept = append(kept, entry)
+		}
+	}
+	j.entries = kept
+}
+
+// stalled drops the entry of the block `blockID`, forked out of the chain
+// after its reorganization became final.
+func (j *undoJournal) stalled(blockID string) {
+	if idx := j.find(blockID); idx != -1 {
+		j.entries = append(j.entries[:idx], j.entries[idx+1:]...)
+	}
+}
+
+func (j *undoJournal) find(blockID string) int {
+	for i := len(j.entries) - 1; i >= 0; i-- {
+		if j.entries[i].blockID == blockID {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,87 @@
+package pipeline
+
+import (
+	"testing"
+
+	"github.com/streamingfast/dstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
+	"github.com/streamingfast/substreams/storage/store"
+)
+
+func newTestJournalStore(t *testing.T) (*store.FullKV, store.Map) {
+	t.Helper()
+	config, err := store.NewConfig("store_a", 0, "store_a", pbsubstreams.Module_KindStore_UPDATE_POLICY_SET, "string", dstore.NewMockStore(nil), "")
+	require.NoError(t, err)
+	fullKV := config.NewFullKV(zap.NewNop())
+	storeMap := store.NewMap()
+	storeMap.Set(fullKV)
+	return fullKV, storeMap
+}
+
+func processTestBlock(j *undoJournal, fullKV *store.FullKV, clock *pbsubstreams.Clock, value string) {
+	fullKV.Set(0, "key", value)
+	fullKV.Set(1, "key_"+clock.Id, value)
+	j.record(clock, []store.Store{fullKV})
+	fullKV.Reset()
+}
+
+func TestUndoJournal_DeepReorg(t *testing.T) {
+	fullKV, storeMap := newTestJournalStore(t)
+	j := newUndoJournal(0)
+
+	processTestBlock(j, fullKV, &pbsubstreams.Clock{Number: 10, Id: "10a"}, "10")
+	processTestBlock(j, fullKV, &pbsubstreams.Clock{Number: 11, Id: "11a"}, "11")
+	processTestBlock(j, fullKV, &pbsubstreams.Clock{Number: 12, Id: "12a"}, "12")
+	j.final(10)
+
+	require.NoError(t, j.undo(&pbsubstreams.Clock{Number: 12, Id: "12a"}, storeMap))
+	require.NoError(t, j.undo(&pbsubstreams.Clock{Number: 11, Id: "11a"}, storeMap))
+
+	value, _ := fullKV.GetLast("key")
+	assert.Equal(t, []byte("10"), value)
+	assert.False(t, fullKV.HasLast("key_11a"))
+	assert.False(t, fullKV.HasLast("key_12a"))
+
+	// the undone block comes back, undoing it again only reverts its new changes
+	processTestBlock(j, fullKV, &pbsubstreams.Clock{Number: 11, Id: "11a"}, "11")
+	require.NoError(t, j.undo(&pbsubstreams.Clock{Number: 11, Id: "11a"}, storeMap))
+	value, _ = fullKV.GetLast("key")
+	assert.Equal(t, []byte("10"), value)
+	assert.True(t, fullKV.HasLast("key_10a"))
+}
+
+func TestUndoJournal_MaxDepth(t *testing.T) {
+	fullKV, storeMap := newTestJournalStore(t)
+	j := newUndoJournal(2)
+
+	processTestBlock(j, fullKV, &pbsubstreams.Clock{Number: 10, Id: "10a"}, "10")
+	processTestBlock(j, fullKV, &pbsubstreams.Clock{Number: 11, Id: "11a"}, "11")
+	processTestBlock(j, fullKV, &pbsubstreams.Clock{Number: 12, Id: "12a"}, "12")
+
+	require.NoError(t, j.undo(&pbsubstreams.Clock{Number: 12, Id: "12a"}, storeMap))
+	require.NoError(t, j.undo(&pbsubstreams.Clock{Number: 11, Id: "11a"}, storeMap))
+	assert.EqualError(t, j.undo(&pbsubstreams.Clock{Number: 10, Id: "10a"}, storeMap), "cannot undo block 10a: reorganization deeper than the 2 blocks retained")
+
+	// blocks never processed have nothing to undo
+	assert.NoError(t, j.undo(&pbsubstreams.Clock{Number: 13, Id: "13b"}, storeMap))
+}
+
+func TestUndoJournal_FinalAndStalled(t *testing.T) {
+	fullKV, _ := newTestJournalStore(t)
+	j := newUndoJournal(0)
+
+	processTestBlock(j, fullKV, &pbsubstreams.Clock{Number: 10, Id: "10a"}, "10")
+	processTestBlock(j, fullKV, &pbsubstreams.Clock{Number: 11, Id: "11a"}, "11")
+	processTestBlock(j, fullKV, &pbsubstreams.Clock{Number: 11, Id: "11b"}, "11")
+	processTestBlock(j, fullKV, &pbsubstreams.Clock{Number: 12, Id: "12b"}, "12")
+
+	j.stalled("11a")
+	assert.Equal(t, -1, j.find("11a"))
+	j.final(11)
+	require.Len(t, j.entries, 1)
+	assert.Equal(t, "12b", j.entries[0].blockID)
+}
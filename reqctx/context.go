@@ -19,6 +19,7 @@ var tracerKey = contextKeyType(2)
 var spanKey = contextKeyType(3)
 var reqStatsKey = contextKeyType(4)
 var moduleExecutionTracingConfigKey = contextKeyType(5)
+var moduleMeterKey = contextKeyType(6)
 
 func Logger(ctx context.Context) *zap.Logger {
 	return logging.Logger(ctx, zap.NewNop())
@@ -50,6 +51,17 @@ func WithReqStats(ctx context.Context, stats metrics.Stats) context.Context {
 	return context.WithValue(ctx, reqStatsKey, stats)
 }
 
+// ModuleMeter returns the meter of the modules of the request, nil when their
+// usage is not accounted, a nil meter only exporting the metrics.
+func ModuleMeter(ctx context.Context) *metrics.ModuleMeter {
+	meter, _ := ctx.Value(moduleMeterKey).(*metrics.ModuleMeter)
+	return meter
+}
+
+func WithModuleMeter(ctx context.Context, meter *metrics.ModuleMeter) context.Context {
+	return context.WithValue(ctx, moduleMeterKey, meter)
+}
+
 func Span(ctx context.Context) ISpan {
 	s := ctx.Value(spanKey)
 	if t, ok := s.(*span); ok {
@@ -13,6 +13,9 @@ type RequestDetails struct {
 
 	DebugInitialStoreSnapshotForModules []string
 	OutputModule                        string
+	// CachedOutputModule is the map module whose outputs a tier2 store job
+	// writes to the cache on top of its partial store, see pbssinternal.ProcessRangeRequest.
+	CachedOutputModule string
 	// What the user requested, derived from either the Request.StartBlockNum or Request.Cursor
 	ResolvedStartBlockNum uint64
 	ResolvedCursor        string
@@ -24,12 +27,33 @@ type RequestDetails struct {
 
 	ProductionMode bool
 	IsSubRequest   bool
+
+	Capabilities []string // negotiated with the client, see substreams.NegotiateCapabilities
+
+	// UncachedModules are the modules importing the `block::is_final` host
+	// function, and the modules depending on them, whose state depends on when
+	// the blocks are processed: the linear pipeline of tier1 never saves their
+	// stores, see SkipSnapshotSave.
+	UncachedModules map[string]bool
 }
 
 func (d *RequestDetails) UniqueIDString() string {
 	return strconv.FormatUint(d.UniqueID, 10)
 }
 
+// HasCapability returns whether `capability` was negotiated for the request.
+func (d *RequestDetails) HasCapability(capability string) bool {
+	if d == nil {
+		return false
+	}
+	for _, c := range d.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
 func (d *RequestDetails) IsOutputModule(modName string) bool {
 	return modName == d.OutputModule
 }
@@ -38,8 +62,12 @@ func (d *RequestDetails) IsOutputModule(modName string) bool {
 // when we're doing parallel processing and we are concerned only with writing the
 // leaf stores we've been asked to produce.  We know the scheduler will have
 // created jobs to produce those stores we're skipping here.
+//
+// The stores of the UncachedModules are not saved either: the snapshots of
+// tier2, where every block is final, are the only ones whose content doesn't
+// depend on when the blocks were processed.
 func (d *RequestDetails) SkipSnapshotSave(modName string) bool {
-	return d.IsSubRequest && !d.IsOutputModule(modName)
+	return (d.IsSubRequest && !d.IsOutputModule(modName)) || d.UncachedModules[modName]
 }
 
 func (d *RequestDetails) ShouldReturnWrittenPartials(modName string) bool {
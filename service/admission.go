@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/streamingfast/substreams"
+	"github.com/streamingfast/substreams/metrics"
+	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
+	"github.com/streamingfast/substreams/reqctx"
+)
+
+// queueFullRetryAfter is the delay after which the clients rejected because
+// the admission queue is full are told to retry.
+const queueFullRetryAfter = 30 * time.Second
+
+var errAdmissionQueueFull = errors.New("admission queue full")
+
+// requestAdmission limits the requests served at the same time by tier1. The
+// requests over the limit wait in a bounded queue, in arrival order, until a
+// request completes and hands its slot over.
+type requestAdmission struct {
+	maxActive uint64
+	maxQueued uint64
+
+	lock   sync.Mutex
+	active uint64
+	queue  []*queuedRequest
+}
+
+type queuedRequest struct {
+	admitted chan struct{} // closed when the request got a slot
+	moved    chan struct{} // signaled when the request moved in the queue
+}
+
+// admitRequest waits until the request can be served, sending its position in
+// the queue to the client meanwhile if it negotiated the `queue_progress`
+// capability.
+func (s *Tier1Service) admitRequest(ctx context.Context, activeRequest *activeRequest, respFunc substreams.ResponseFunc) (release func(), err error) {
+	logger := reqctx.Logger(ctx)
+	sendQueueProgress := reqctx.Details(ctx).HasCapability(substreams.CapabilityQueueProgress)
+
+	release, err = s.admission.admit(ctx, func(position, queued uint64) {
+		activeRequest.queuePosition.Store(position)
+		logger.Debug("request queued", zap.Uint64("position", position), zap.Uint64("queued_requests", queued))
+		if sendQueueProgress {
+			respFunc(&pbsubstreamsrpc.Response{
+				Message: &pbsubstreamsrpc.Response_Progress{
+					Progress: &pbsubstreamsrpc.ModulesProgress{
+						Queue: &pbsubstreamsrpc.QueueProgress{Position: position, QueuedRequests: queued},
+					},
+				},
+			})
+		}
+	})
+	activeRequest.queuePosition.Store(0)
+	if errors.Is(err, errAdmissionQueueFull) {
+		metrics.RejectedRequests.Inc()
+		logger.Info("rejecting request, admission queue full", zap.Uint64("max_concurrent_requests", s.admission.maxActive), zap.Uint64("max_queued_requests", s.admission.maxQueued))
+		return nil, queueFullError()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("waiting in admission queue: %w", err)
+	}
+	return release, nil
+}
+
+func newRequestAdmission(maxActive, maxQueued uint64) *requestAdmission {
+	return &requestAdmission{
+		maxActive: maxActive,
+		maxQueued: maxQueued,
+	}
+}
+
+// admit waits for a slot for the request, calling `onQueued` with its position
+// in the queue (1 being the next request admitted) and the length of the queue
+// each time its position changes. It returns errAdmissionQueueFull right away
+// when the queue is full. Once admitted, `release` must be called when the
+// request completes.
+func (a *requestAdmission) admit(ctx context.Context, onQueued func(position, queued uint64)) (release func(), err error) {
+	a.lock.Lock()
+	if a.active < a.maxActive && len(a.queue) == 0 {
+		a.active++
+		metrics.ActiveRequests.SetUint64(a.active)
+		a.lock.Unlock()
+		return a.release, nil
+	}
+	if uint64(len(a.queue)) >= a.maxQueued {
+		a.lock.Unlock()
+		return nil, errAdmissionQueueFull
+	}
+	req := &queuedRequest{admitted: make(chan struct{}), moved: make(chan struct{}, 1)}
+	a.queue = append(a.queue, req)
+	metrics.QueuedRequests.SetUint64(uint64(len(a.queue)))
+	a.lock.Unlock()
+
+	var lastPosition uint64
+	for {
+		a.lock.Lock()
+		position, queued := a.position(req), uint64(len(a.queue))
+		a.lock.Unlock()
+		if position != 0 && position != lastPosition {
+			onQueued(position, queued)
+			lastPosition = position
+		}
+
+		select {
+		case <-req.admitted:
+			return a.release, nil
+		case <-req.moved:
+		case <-ctx.Done():
+			a.lock.Lock()
+			removed := a.remove(req)
+			a.lock.Unlock()
+			if !removed {
+				// admitted while being canceled, hand the slot over
+				a.release()
+			}
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// release hands the slot of a completed request over to the first queued
+// request, if any.
+func (a *requestAdmission) release() {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if len(a.queue) == 0 {
+		a.active--
+		metrics.ActiveRequests.SetUint64(a.active)
+		return
+	}
+
+	next := a.queue[0]
+	a.queue = a.queue[1:]
+	metrics.QueuedRequests.SetUint64(uint64(len(a.queue)))
+	close(next.admitted)
+	a.notifyMoved()
+}
+
+// position returns the 1-based position of `req` in the queue, 0 when it is
+// not queued anymore. Must be called with the lock held.
+func (a *requestAdmission) position(req *queuedRequest) uint64 {
+	for i, queued := range a.queue {
+		if queued == req {
+			return uint64(i + 1)
+		}
+	}
+	return 0
+}
+
+// remove drops `req` from the queue, returning false if it was not queued
+// anymore. Must be called with the lock held.
+func (a *requestAdmission) remove(req *queuedRequest) bool {
+	for i, queued := range a.queue {
+		if queued == req {
+			a.queue = append(a.queue[:i], a.queue[i+1:]...)
+			metrics.QueuedRequests.SetUint64(uint64(len(a.queue)))
+			a.notifyMoved()
+			return true
+		}
+	}
+	return false
+}
+
+func (a *requestAdmission) notifyMoved() {
+	for _, queued := range a.queue {
+		select {
+		case queued.moved <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// queueFullError tells the client to retry later, with the delay in the
+// `RetryInfo` details of the error.
+func queueFullError() error {
+	st := status.New(codes.ResourceExhausted, "too many requests in progress on this endpoint, please retry later")
+	if withDetails, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(queueFullRetryAfter)}); err == nil {
+		st = withDetails
+	}
+	return st.Err()
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRequestAdmission(t *testing.T) {
+	ctx := context.Background()
+	admission := newRequestAdmission(1, 2)
+	noQueue := func(position, queued uint64) { t.Fatalf("unexpected queue position %d", position) }
+
+	releaseFirst, err := admission.admit(ctx, noQueue)
+	require.NoError(t, err)
+
+	type admitted struct {
+		release func()
+		err     error
+	}
+	queue := func(ctx context.Context, positions chan uint64) chan admitted {
+		done := make(chan admitted, 1)
+		go func() {
+			release, err := admission.admit(ctx, func(position, _ uint64) { positions <- position })
+			done <- admitted{release, err}
+		}()
+		return done
+	}
+
+	secondPositions := make(chan uint64, 10)
+	second := queue(ctx, secondPositions)
+	assert.Equal(t, uint64(1), <-secondPositions)
+
+	canceledCtx, cancel := context.WithCancel(ctx)
+	thirdPositions := make(chan uint64, 10)
+	third := queue(canceledCtx, thirdPositions)
+	assert.Equal(t, uint64(2), <-thirdPositions)
+
+	_, err = admission.admit(ctx, noQueue)
+	assert.ErrorIs(t, err, errAdmissionQueueFull)
+
+	cancel()
+	assert.ErrorIs(t, (<-third).err, context.Canceled)
+
+	fourthPositions := make(chan uint64, 10)
+	fourth := queue(ctx, fourthPositions)
+	assert.Equal(t, uint64(2), <-fourthPositions)
+
+	releaseFirst()
+	secondAdmitted := <-second
+	require.NoError(t, secondAdmitted.err)
+	assert.Equal(t, uint64(1), <-fourthPositions, "moves up when the second request is admitted")
+
+	select {
+	case <-fourth:
+		t.Fatal("admitted while the second request is active")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	secondAdmitted.release()
+	fourthAdmitted := <-fourth
+	require.NoError(t, fourthAdmitted.err)
+	fourthAdmitted.release()
+
+	assert.Equal(t, uint64(0), admission.active)
+	assert.Len(t, admission.queue, 0)
+}
+
+func TestQueueFullError(t *testing.T) {
+	st := status.Convert(queueFullError())
+	assert.Equal(t, codes.ResourceExhausted, st.Code())
+	require.Len(t, st.Details(), 1)
+	assert.Equal(t, queueFullRetryAfter, st.Details()[0].(*errdetails.RetryInfo).RetryDelay.AsDuration())
+}
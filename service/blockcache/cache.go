@@ -0,0 +1,296 @@
+// Package blockcache implements a worker-local cache of merged blocks files,
+// shared by all the jobs running concurrently on a tier2 instance.
+//
+// Jobs for different modules over the same range read the same merged blocks
+// files, the cache avoids downloading them over and over again. Only merged
+// blocks files are cached: they contain irreversible blocks only and are never
+// affected by forks, the forked blocks store must never be wrapped.
+package blockcache
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/streamingfast/dstore"
+	"github.com/streamingfast/substreams/metrics"
+	"go.uber.org/zap"
+)
+
+type entry struct {
+	key  string
+	size uint64
+	data []byte // nil for disk entries
+}
+
+type tier struct {
+	maxBytes uint64
+	bytes    uint64
+	entries  map[string]*list.Element
+	lru      *list.List
+}
+
+func newTier(maxBytes uint64) *tier {
+	return &tier{
+		maxBytes: maxBytes,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+func (t *tier) get(key string) (*entry, bool) {
+	el, found := t.entries[key]
+	if !found {
+		return nil, false
+	}
+	t.lru.MoveToFront(el)
+	return el.Value.(*entry), true
+}
+
+// add inserts the entry and returns the entries evicted to make room for it.
+func (t *tier) add(e *entry) (evicted []*entry) {
+	if e.size > t.maxBytes {
+		return nil
+	}
+	if el, found := t.entries[e.key]; found {
+		t.lru.MoveToFront(el)
+		return nil
+	}
+
+	t.entries[e.key] = t.lru.PushFront(e)
+	t.bytes += e.size
+	for t.bytes > t.maxBytes {
+		oldest := t.lru.Back()
+		old := t.lru.Remove(oldest).(*entry)
+		delete(t.entries, old.key)
+		t.bytes -= old.size
+		evicted = append(evicted, old)
+	}
+	return evicted
+}
+
+func (t *tier) remove(key string) {
+	el, found := t.entries[key]
+	if !found {
+		return
+	}
+	t.lru.Remove(el)
+	delete(t.entries, key)
+	t.bytes -= el.Value.(*entry).size
+}
+
+type call struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+// Cache keeps merged blocks files in two tiers: a memory tier for the most
+// recently used files and a larger disk tier. Concurrent reads of the same
+// file are coalesced into a single download.
+type Cache struct {
+	mu       sync.Mutex
+	memory   *tier
+	disk     *tier
+	diskDir  string
+	inflight map[string]*call
+	logger   *zap.Logger
+}
+
+// New creates a cache holding up to `memoryMaxBytes` in memory and up to `diskMaxBytes`
+// in `diskDir`. The disk tier is disabled when `diskDir` is empty.
+func New(memoryMaxBytes uint64, diskDir string, diskMaxBytes uint64, logger *zap.Logger) (*Cache, error) {
+	c := &Cache{
+		memory:   newTier(memoryMaxBytes),
+		inflight: make(map[string]*call),
+		logger:   logger,
+	}
+
+	if diskDir != "" {
+		// files from a previous run are not indexed, start from a clean slate
+		c.diskDir = filepath.Join(diskDir, "substreams-block-cache")
+		if err := os.RemoveAll(c.diskDir); err != nil {
+			return nil, fmt.Errorf("cleaning disk cache directory: %w", err)
+		}
+		if err := os.MkdirAll(c.diskDir, 0755); err != nil {
+			return nil, fmt.Errorf("creating disk cache directory: %w", err)
+		}
+		c.disk = newTier(diskMaxBytes)
+	}
+
+	return c, nil
+}
+
+// Wrap returns a store whose `OpenObject` calls are served from the cache. Cached
+// content is the decompressed content returned by `store`.
+func (c *Cache) Wrap(store dstore.Store) dstore.Store {
+	cached := &cachedStore{Store: store, cache: c}
+	if _, ok := store.(dstore.Clonable); ok {
+		return &clonableCachedStore{cached}
+	}
+	return cached
+}
+
+// get returns the content of `key`, fetching it when it is not cached. The
+// fetch is shared by all the concurrent reads of `key`: it runs detached from
+// the context of the read that started it, so that cancelling one read does
+// not fail the others, each read only waiting for it until its own context is
+// done.
+func (c *Cache) get(ctx context.Context, key string, fetch func(ctx context.Context) ([]byte, error)) ([]byte, error) {
+	c.mu.Lock()
+	if e, found := c.memory.get(key); found {
+		c.mu.Unlock()
+		metrics.BlockCacheRequests.Inc("memory_hit")
+		return e.data, nil
+	}
+
+	cl, found := c.inflight[key]
+	if found {
+		metrics.BlockCacheRequests.Inc("coalesced")
+	} else {
+		cl = &call{done: make(chan struct{})}
+		c.inflight[key] = cl
+		_, onDisk := c.diskGet(key)
+		go c.load(detachedContext{ctx}, key, onDisk, cl, fetch)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-cl.done:
+		return cl.data, cl.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *Cache) load(ctx context.Context, key string, onDisk bool, cl *call, fetch func(ctx context.Context) ([]byte, error)) {
+	defer close(cl.done)
+
+	if onDisk {
+		cl.data, cl.err = os.ReadFile(c.diskPath(key))
+		if cl.err == nil {
+			metrics.BlockCacheRequests.Inc("disk_hit")
+		} else {
+			c.logger.Warn("unable to read block file from disk cache", zap.String("key", key), zap.Error(cl.err))
+			c.diskRemove(key)
+			onDisk = false
+		}
+	}
+	if !onDisk {
+		metrics.BlockCacheRequests.Inc("miss")
+		cl.data, cl.err = fetch(ctx)
+	}
+
+	written := false
+	if cl.err == nil && !onDisk {
+		written = c.diskWrite(key, cl.data)
+	}
+
+	c.mu.Lock()
+	delete(c.inflight, key)
+	var evicted []*entry
+	if cl.err == nil {
+		c.memory.add(&entry{key: key, size: uint64(len(cl.data)), data: cl.data})
+		if written {
+			evicted = c.disk.add(&entry{key: key, size: uint64(len(cl.data))})
+		}
+	}
+	c.mu.Unlock()
+
+	for _, old := range evicted {
+		if err := os.Remove(c.diskPath(old.key)); err != nil {
+			c.logger.Warn("unable to remove evicted block file from disk cache", zap.String("key", old.key), zap.Error(err))
+		}
+	}
+}
+
+func (c *Cache) diskGet(key string) (*entry, bool) {
+	if c.disk == nil {
+		return nil, false
+	}
+	return c.disk.get(key)
+}
+
+// diskWrite writes the disk tier file of `key`, without the lock held: it is
+// only indexed in the disk tier once written.
+func (c *Cache) diskWrite(key string, data []byte) bool {
+	if c.disk == nil || uint64(len(data)) > c.disk.maxBytes {
+		return false
+	}
+
+	if err := os.WriteFile(c.diskPath(key), data, 0644); err != nil {
+		c.logger.Warn("unable to write block file to disk cache", zap.String("key", key), zap.Error(err))
+		return false
+	}
+	return true
+}
+
+// diskRemove drops `key` from the disk tier and removes its file, so that a
+// file that cannot be read is fetched again instead of being retried.
+func (c *Cache) diskRemove(key string) {
+	c.mu.Lock()
+	c.disk.remove(key)
+	c.mu.Unlock()
+
+	if err := os.Remove(c.diskPath(key)); err != nil && !os.IsNotExist(err) {
+		c.logger.Warn("unable to remove block file from disk cache", zap.String("key", key), zap.Error(err))
+	}
+}
+
+func (c *Cache) diskPath(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.diskDir, hex.EncodeToString(sum[:]))
+}
+
+type cachedStore struct {
+	dstore.Store
+	cache *Cache
+}
+
+func (s *cachedStore) OpenObject(ctx context.Context, name string) (io.ReadCloser, error) {
+	data, err := s.cache.get(ctx, s.Store.ObjectURL(name), func(ctx context.Context) ([]byte, error) {
+		reader, err := s.Store.OpenObject(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		return io.ReadAll(reader)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// clonableCachedStore keeps the cache when cloned, so that per-request
+// metered clones of the merged blocks store still share it.
+type clonableCachedStore struct {
+	*cachedStore
+}
+
+func (s *clonableCachedStore) Clone(ctx context.Context) (dstore.Store, error) {
+	cloned, err := s.Store.(dstore.Clonable).Clone(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.cache.Wrap(cloned), nil
+}
+
+// detachedContext holds the values of its context, without its deadline and
+// cancellation.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool)         { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}               { return nil }
+func (detachedContext) Err() error                          { return nil }
+func (c detachedContext) Value(key interface{}) interface{} { return c.parent.Value(key) }
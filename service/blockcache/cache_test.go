@@ -0,0 +1,154 @@
+package blockcache
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/streamingfast/dstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type countingStore struct {
+	dstore.Store
+	opens atomic.Int32
+}
+
+func (s *countingStore) OpenObject(ctx context.Context, name string) (io.ReadCloser, error) {
+	s.opens.Add(1)
+	return s.Store.OpenObject(ctx, name)
+}
+
+func newTestStore(t *testing.T, files map[string]string) *countingStore {
+	t.Helper()
+
+	store, err := dstore.NewStore("file://"+t.TempDir(), "", "", false)
+	require.NoError(t, err)
+	for name, content := range files {
+		require.NoError(t, store.WriteObject(context.Background(), name, bytes.NewReader([]byte(content))))
+	}
+	return &countingStore{Store: store}
+}
+
+func read(t *testing.T, store dstore.Store, name string) string {
+	t.Helper()
+
+	reader, err := store.OpenObject(context.Background(), name)
+	require.NoError(t, err)
+	content, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	return string(content)
+}
+
+func TestCache_MemoryTier(t *testing.T) {
+	base := newTestStore(t, map[string]string{"0000000000": "aaaa", "0000000100": "bbbb", "0000000200": "cccc"})
+	cache, err := New(8, "", 0, zap.NewNop())
+	require.NoError(t, err)
+	store := cache.Wrap(base)
+
+	assert.Equal(t, "aaaa", read(t, store, "0000000000"))
+	assert.Equal(t, "aaaa", read(t, store, "0000000000"))
+	assert.Equal(t, int32(1), base.opens.Load())
+
+	assert.Equal(t, "bbbb", read(t, store, "0000000100"))
+	assert.Equal(t, "cccc", read(t, store, "0000000200")) // evicts 0000000000
+	assert.Equal(t, int32(3), base.opens.Load())
+
+	assert.Equal(t, "aaaa", read(t, store, "0000000000"))
+	assert.Equal(t, int32(4), base.opens.Load())
+}
+
+func TestCache_DiskTier(t *testing.T) {
+	base := newTestStore(t, map[string]string{"0000000000": "aaaa", "0000000100": "bbbb"})
+	cache, err := New(4, t.TempDir(), 1024, zap.NewNop())
+	require.NoError(t, err)
+	store := cache.Wrap(base)
+
+	assert.Equal(t, "aaaa", read(t, store, "0000000000"))
+	assert.Equal(t, "bbbb", read(t, store, "0000000100")) // evicts 0000000000 from memory, still on disk
+	assert.Equal(t, "aaaa", read(t, store, "0000000000"))
+	assert.Equal(t, int32(2), base.opens.Load())
+}
+
+func TestCache_Coalescing(t *testing.T) {
+	base := newTestStore(t, map[string]string{"0000000000": "aaaa"})
+	cache, err := New(1024, "", 0, zap.NewNop())
+	require.NoError(t, err)
+	store := cache.Wrap(base)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Equal(t, "aaaa", read(t, store, "0000000000"))
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), base.opens.Load())
+}
+
+type blockingStore struct {
+	dstore.Store
+	release chan struct{}
+}
+
+func (s *blockingStore) OpenObject(ctx context.Context, name string) (io.ReadCloser, error) {
+	select {
+	case <-s.release:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return s.Store.OpenObject(ctx, name)
+}
+
+func TestCache_CoalescingCancelledRead(t *testing.T) {
+	base := &blockingStore{Store: newTestStore(t, map[string]string{"0000000000": "aaaa"}), release: make(chan struct{})}
+	cache, err := New(1024, "", 0, zap.NewNop())
+	require.NoError(t, err)
+	store := cache.Wrap(base)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error)
+	go func() {
+		_, err := store.OpenObject(ctx, "0000000000")
+		firstErr <- err
+	}()
+	require.Eventually(t, func() bool {
+		cache.mu.Lock()
+		defer cache.mu.Unlock()
+		return len(cache.inflight) == 1
+	}, time.Second, time.Millisecond)
+
+	second := make(chan string)
+	go func() { second <- read(t, store, "0000000000") }()
+
+	cancel()
+	assert.ErrorIs(t, <-firstErr, context.Canceled)
+	close(base.release)
+	assert.Equal(t, "aaaa", <-second, "the fetch is not cancelled with the read that started it")
+}
+
+func TestCache_DiskReadFailure(t *testing.T) {
+	base := newTestStore(t, map[string]string{"0000000000": "aaaa", "0000000100": "bbbb"})
+	cache, err := New(4, t.TempDir(), 1024, zap.NewNop())
+	require.NoError(t, err)
+	store := cache.Wrap(base)
+
+	assert.Equal(t, "aaaa", read(t, store, "0000000000"))
+	assert.Equal(t, "bbbb", read(t, store, "0000000100")) // evicts 0000000000 from memory
+	require.NoError(t, os.Remove(cache.diskPath(base.ObjectURL("0000000000"))))
+
+	assert.Equal(t, "aaaa", read(t, store, "0000000000"))
+	assert.Equal(t, int32(3), base.opens.Load())
+	_, onDisk := cache.diskGet(base.ObjectURL("0000000000"))
+	assert.True(t, onDisk, "fetched again and written back to disk")
+}
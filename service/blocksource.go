@@ -0,0 +1,280 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/streamingfast/bstream"
+	"github.com/streamingfast/bstream/stream"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/streamingfast/substreams/metrics"
+)
+
+// BlockSourcePolicy selects where tier1 reads the blocks of its streams from:
+// the merged blocks files, or the live source of the hub holding the blocks
+// near the head. The zero value reads all the blocks held by the live source
+// from it, the older ones from the merged blocks files.
+type BlockSourcePolicy struct {
+	// LiveOnly fails the streams starting below the lowest block of the live
+	// source instead of reading the merged blocks files.
+	LiveOnly bool
+	// MergedFilesDistance, if not 0, reads the blocks at least that many
+	// blocks below the head from the merged blocks files, even when the live
+	// source holds them.
+	MergedFilesDistance uint64
+}
+
+// ParseBlockSourcePolicy parses the value of the
+// `substreams.BlockSourceHeader` header: `live-only`, `merged-files-distance=<blocks>`
+// or `default`.
+func ParseBlockSourcePolicy(in string) (BlockSourcePolicy, error) {
+	switch value := strings.TrimSpace(in); {
+	case value == "default":
+		return BlockSourcePolicy{}, nil
+	case value == "live-only":
+		return BlockSourcePolicy{LiveOnly: true}, nil
+	case strings.HasPrefix(value, "merged-files-distance="):
+		distance, err := strconv.ParseUint(strings.TrimPrefix(value, "merged-files-distance="), 10, 64)
+		if err != nil {
+			return BlockSourcePolicy{}, fmt.Errorf("invalid block source %q: %w", in, err)
+		}
+		return BlockSourcePolicy{MergedFilesDistance: distance}, nil
+	}
+	return BlockSourcePolicy{}, fmt.Errorf("invalid block source %q, expected `default`, `live-only` or `merged-files-distance=<blocks>`", in)
+}
+
+func (p BlockSourcePolicy) String() string {
+	switch {
+	case p.LiveOnly:
+		return "live-only"
+	case p.MergedFilesDistance != 0:
+		return fmt.Sprintf("merged-files-distance=%d", p.MergedFilesDistance)
+	}
+	return "default"
+}
+
+type blockSourcePolicyKey struct{}
+
+// withBlockSourcePolicy overrides the block source policy of the server for
+// the stream created with `ctx`.
+func withBlockSourcePolicy(ctx context.Context, policy BlockSourcePolicy) context.Context {
+	return context.WithValue(ctx, blockSourcePolicyKey{}, policy)
+}
+
+func blockSourcePolicyFromContext(ctx context.Context, defaultPolicy BlockSourcePolicy) BlockSourcePolicy {
+	if policy, ok := ctx.Value(blockSourcePolicyKey{}).(BlockSourcePolicy); ok {
+		return policy
+	}
+	return defaultPolicy
+}
+
+// liveSourceFactory is the live source of the hub, see hub.ForkableHub.
+type liveSourceFactory interface {
+	bstream.ForkableSourceFactory
+	bstream.LowSourceLimitGetter
+	HeadNum() uint64
+}
+
+// policyLiveSource only serves the blocks allowed by the policy from the live
+// source, so that the joining source reads the others from the merged blocks
+// files.
+type policyLiveSource struct {
+	live     liveSourceFactory
+	distance uint64
+}
+
+// LowestBlockNum is the lowest block served, the joining source switching to
+// the live source once the merged blocks files reach it.
+func (s *policyLiveSource) LowestBlockNum() uint64 {
+	lowest := s.live.LowestBlockNum()
+	if s.distance == 0 {
+		return lowest
+	}
+	if head := s.live.HeadNum(); head >= s.distance && head-s.distance+1 > lowest {
+		lowest = head - s.distance + 1
+	}
+	return lowest
+}
+
+func (s *policyLiveSource) serves(blockNum uint64) bool {
+	return s.distance == 0 || blockNum+s.distance > s.live.HeadNum()
+}
+
+func (s *policyLiveSource) SourceFromBlockNum(blockNum uint64, h bstream.Handler) bstream.Source {
+	if !s.serves(blockNum) {
+		return nil
+	}
+	return s.live.SourceFromBlockNum(blockNum, countBlocks("live", h))
+}
+
+func (s *policyLiveSource) SourceFromCursor(cursor *bstream.Cursor, h bstream.Handler) bstream.Source {
+	if !s.serves(cursor.Block.Num()) {
+		return nil
+	}
+	return s.live.SourceFromCursor(cursor, countBlocks("live", h))
+}
+
+func (s *policyLiveSource) SourceThroughCursor(startBlock uint64, cursor *bstream.Cursor, h bstream.Handler) bstream.Source {
+	if !s.serves(startBlock) {
+		return nil
+	}
+	return s.live.SourceThroughCursor(startBlock, cursor, countBlocks("live", h))
+}
+
+// mergedFilesSource counts the blocks read from the merged blocks files, it
+// serves none in live only streams.
+type mergedFilesSource struct {
+	files    bstream.ForkableSourceFactory
+	liveOnly bool
+}
+
+func (s *mergedFilesSource) SourceFromBlockNum(blockNum uint64, h bstream.Handler) bstream.Source {
+	if s.liveOnly {
+		return nil
+	}
+	return s.files.SourceFromBlockNum(blockNum, countBlocks("merged_files", h))
+}
+
+func (s *mergedFilesSource) SourceFromCursor(cursor *bstream.Cursor, h bstream.Handler) bstream.Source {
+	if s.liveOnly {
+		return nil
+	}
+	return s.files.SourceFromCursor(cursor, countBlocks("merged_files", h))
+}
+
+func (s *mergedFilesSource) SourceThroughCursor(startBlock uint64, cursor *bstream.Cursor, h bstream.Handler) bstream.Source {
+	if s.liveOnly {
+		return nil
+	}
+	return s.files.SourceThroughCursor(startBlock, cursor, countBlocks("merged_files", h))
+}
+
+func countBlocks(source string, h bstream.Handler) bstream.Handler {
+	return bstream.HandlerFunc(func(blk *bstream.Block, obj interface{}) error {
+		metrics.BlocksBySource.Inc(source)
+		return h.ProcessBlock(blk, obj)
+	})
+}
+
+// policyStream is the stream of blocks of tier1, like stream.Stream, joining
+// the merged blocks files to the live source according to a BlockSourcePolicy.
+type policyStream struct {
+	source *bstream.JoiningSource
+	logger *zap.Logger
+}
+
+func (s *policyStream) Run(ctx context.Context) error {
+	go func() {
+		select {
+		case <-s.source.Terminated():
+			return
+		case <-ctx.Done():
+			s.source.Shutdown(ctx.Err())
+		}
+	}()
+
+	s.source.Run()
+	if err := s.source.Err(); err != nil {
+		s.logger.Debug("source shutting down", zap.Error(err))
+		if errors.Is(err, bstream.ErrResolveCursor) {
+			return stream.NewErrInvalidArg("%s", err.Error())
+		}
+		return err
+	}
+	return nil
+}
+
+func newPolicyStream(
+	policy BlockSourcePolicy,
+	files bstream.ForkableSourceFactory,
+	live liveSourceFactory,
+	h bstream.Handler,
+	startBlockNum int64,
+	stopBlockNum uint64,
+	cursor *bstream.Cursor,
+	finalBlocksOnly bool,
+	cursorIsTarget bool,
+	logger *zap.Logger,
+) (*policyStream, error) {
+	var absoluteStartBlockNum uint64
+	if startBlockNum < 0 {
+		if head := live.HeadNum(); head > uint64(-startBlockNum) {
+			absoluteStartBlockNum = head - uint64(-startBlockNum)
+		}
+	} else {
+		absoluteStartBlockNum = uint64(startBlockNum)
+	}
+	if absoluteStartBlockNum < bstream.GetProtocolFirstStreamableBlock {
+		absoluteStartBlockNum = bstream.GetProtocolFirstStreamableBlock
+	}
+	if stopBlockNum > 0 && absoluteStartBlockNum > stopBlockNum {
+		return nil, stream.NewErrInvalidArg("start block %d is after stop block %d", absoluteStartBlockNum, stopBlockNum)
+	}
+
+	hasCursor := !cursor.IsEmpty()
+	if finalBlocksOnly && hasCursor && !cursor.IsOnFinalBlock() {
+		return nil, stream.NewErrInvalidArg("cannot stream with final-blocks-only from this non-final cursor")
+	}
+	if policy.LiveOnly {
+		fromBlock := absoluteStartBlockNum
+		if hasCursor && !cursorIsTarget {
+			fromBlock = cursor.Block.Num()
+		}
+		if lowest := live.LowestBlockNum(); fromBlock < lowest {
+			return nil, status.Errorf(codes.OutOfRange, "block %d is not held by the live source anymore (lowest block %d), and the request only reads live blocks", fromBlock, lowest)
+		}
+	}
+
+	handler := h
+	if stopBlockNum != 0 {
+		handler = stopBlockHandler(stopBlockNum, handler)
+	}
+	if finalBlocksOnly {
+		handler = stepFilterHandler(bstream.StepIrreversible, handler)
+	} else {
+		handler = stepFilterHandler(bstream.StepsAll, handler) // substreams always wants new, undo, new+irreversible, irreversible, stalled
+	}
+
+	return &policyStream{
+		source: bstream.NewJoiningSource(
+			&mergedFilesSource{files: files, liveOnly: policy.LiveOnly},
+			&policyLiveSource{live: live, distance: policy.MergedFilesDistance},
+			handler,
+			absoluteStartBlockNum,
+			cursor,
+			cursorIsTarget,
+			logger,
+		),
+		logger: logger,
+	}, nil
+}
+
+func stepFilterHandler(step bstream.StepType, h bstream.Handler) bstream.Handler {
+	return bstream.HandlerFunc(func(blk *bstream.Block, obj interface{}) error {
+		if obj.(bstream.Stepable).Step().Matches(step) {
+			return h.ProcessBlock(blk, obj)
+		}
+		return nil
+	})
+}
+
+func stopBlockHandler(stopBlockNum uint64, h bstream.Handler) bstream.Handler {
+	return bstream.HandlerFunc(func(blk *bstream.Block, obj interface{}) error {
+		if blk.Number > stopBlockNum {
+			return stream.ErrStopBlockReached
+		}
+		if err := h.ProcessBlock(blk, obj); err != nil {
+			return err
+		}
+		if blk.Number == stopBlockNum {
+			return stream.ErrStopBlockReached
+		}
+		return nil
+	})
+}
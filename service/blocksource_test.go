@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/streamingfast/bstream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestParseBlockSourcePolicy(t *testing.T) {
+	tests := []struct {
+		in        string
+		expect    BlockSourcePolicy
+		expectErr bool
+	}{
+		{in: "default", expect: BlockSourcePolicy{}},
+		{in: "live-only", expect: BlockSourcePolicy{LiveOnly: true}},
+		{in: " merged-files-distance=1000 ", expect: BlockSourcePolicy{MergedFilesDistance: 1000}},
+		{in: "merged-files-distance=abc", expectErr: true},
+		{in: "files", expectErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.in, func(t *testing.T) {
+			policy, err := ParseBlockSourcePolicy(test.in)
+			if test.expectErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expect, policy)
+
+			roundTrip, err := ParseBlockSourcePolicy(policy.String())
+			require.NoError(t, err)
+			assert.Equal(t, policy, roundTrip)
+		})
+	}
+}
+
+type testLiveSource struct {
+	lowest, head uint64
+	requested    []uint64
+}
+
+func (s *testLiveSource) SourceFromBlockNum(blockNum uint64, h bstream.Handler) bstream.Source {
+	s.requested = append(s.requested, blockNum)
+	if blockNum < s.lowest {
+		return nil
+	}
+	return bstream.NewMockSource(nil, h)
+}
+
+func (s *testLiveSource) SourceFromCursor(cursor *bstream.Cursor, h bstream.Handler) bstream.Source {
+	return s.SourceFromBlockNum(cursor.Block.Num(), h)
+}
+
+func (s *testLiveSource) SourceThroughCursor(startBlock uint64, cursor *bstream.Cursor, h bstream.Handler) bstream.Source {
+	return s.SourceFromBlockNum(startBlock, h)
+}
+
+func (s *testLiveSource) LowestBlockNum() uint64 { return s.lowest }
+func (s *testLiveSource) HeadNum() uint64        { return s.head }
+
+func TestPolicyLiveSource(t *testing.T) {
+	live := &testLiveSource{lowest: 800, head: 1000}
+	h := bstream.HandlerFunc(func(blk *bstream.Block, obj interface{}) error { return nil })
+
+	unrestricted := &policyLiveSource{live: live}
+	assert.Equal(t, uint64(800), unrestricted.LowestBlockNum())
+	assert.NotNil(t, unrestricted.SourceFromBlockNum(850, h))
+
+	restricted := &policyLiveSource{live: live, distance: 100}
+	assert.Equal(t, uint64(901), restricted.LowestBlockNum())
+	assert.Nil(t, restricted.SourceFromBlockNum(850, h), "read from the merged blocks files")
+	assert.NotNil(t, restricted.SourceFromBlockNum(950, h))
+	assert.Equal(t, []uint64{850, 950}, live.requested)
+
+	// a distance larger than the live source leaves its lowest block unchanged
+	assert.Equal(t, uint64(800), (&policyLiveSource{live: live, distance: 5000}).LowestBlockNum())
+}
+
+func TestNewPolicyStream_LiveOnly(t *testing.T) {
+	live := &testLiveSource{lowest: 800, head: 1000}
+	h := bstream.HandlerFunc(func(blk *bstream.Block, obj interface{}) error { return nil })
+
+	_, err := newPolicyStream(BlockSourcePolicy{LiveOnly: true}, nil, live, h, 500, 0, nil, false, false, zap.NewNop())
+	assert.Equal(t, codes.OutOfRange, status.Code(err))
+
+	_, err = newPolicyStream(BlockSourcePolicy{LiveOnly: true}, nil, live, h, 900, 0, nil, false, false, zap.NewNop())
+	assert.NoError(t, err)
+
+	_, err = newPolicyStream(BlockSourcePolicy{}, nil, live, h, 500, 0, nil, false, false, zap.NewNop())
+	assert.NoError(t, err, "read from the merged blocks files")
+}
+
+func TestBlockSourcePolicyFromContext(t *testing.T) {
+	serverPolicy := BlockSourcePolicy{MergedFilesDistance: 100}
+	assert.Equal(t, serverPolicy, blockSourcePolicyFromContext(context.Background(), serverPolicy))
+
+	ctx := withBlockSourcePolicy(context.Background(), BlockSourcePolicy{LiveOnly: true})
+	assert.Equal(t, BlockSourcePolicy{LiveOnly: true}, blockSourcePolicyFromContext(ctx, serverPolicy))
+}
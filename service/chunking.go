@@ -0,0 +1,215 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	tracing "github.com/streamingfast/sf-tracing"
+	"go.uber.org/zap"
+
+	"github.com/streamingfast/substreams"
+	"github.com/streamingfast/substreams/block"
+	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
+	"github.com/streamingfast/substreams/pipeline"
+	"github.com/streamingfast/substreams/pipeline/cache"
+	"github.com/streamingfast/substreams/pipeline/outputmodules"
+	"github.com/streamingfast/substreams/reqctx"
+	"github.com/streamingfast/substreams/storage/execout"
+	"github.com/streamingfast/substreams/storage/store"
+	"github.com/streamingfast/substreams/wasm"
+)
+
+// requestChunks splits the backprocessing of the range from `startBlock` to
+// `handoffBlock` in chunks of `chunkSize` blocks, rounded up to the store save
+// `interval` so that each chunk starts from the snapshots saved by the
+// previous one. The chunks are aligned on their size, and the last one,
+// ending on `handoffBlock`, is not returned: it is served by the request
+// pipeline itself. Nothing is returned when the range fits in a single chunk.
+func requestChunks(startBlock, handoffBlock, chunkSize, interval uint64) (out []*block.Range) {
+	if chunkSize == 0 {
+		return nil
+	}
+	if interval != 0 && chunkSize%interval != 0 {
+		chunkSize += interval - chunkSize%interval
+	}
+	if handoffBlock <= startBlock || handoffBlock-startBlock <= chunkSize {
+		return nil
+	}
+
+	for start := startBlock; ; {
+		end := start - start%chunkSize + chunkSize
+		if end >= handoffBlock {
+			return out
+		}
+		out = append(out, block.NewRange(start, end))
+		start = end
+	}
+}
+
+// backprocessChunks serves the cached outputs of the request over `chunks`,
+// one chunk at a time, each with its own parallel processor and stores which
+// are released before the next chunk starts. This caps the resources held by
+// requests spanning enormous ranges, the client receiving the same responses
+// as if the range was processed at once. The cursor of the last block sent by
+// each chunk is its continuation cursor, sent in a ChunkProgress to the
+// clients negotiating the `chunk_progress` capability.
+func (s *Tier1Service) backprocessChunks(
+	ctx context.Context,
+	chunks []*block.Range,
+	outputGraph *outputmodules.Graph,
+	storeConfigs store.ConfigMap,
+	execOutputConfigs *execout.Configs,
+	wasmRuntime *wasm.Registry,
+	undoMessage *pbsubstreamsrpc.Response,
+	respFunc substreams.ResponseFunc,
+) error {
+	logger := reqctx.Logger(ctx)
+	requestDetails := reqctx.Details(ctx)
+
+	var continuationCursor string
+	chunkRespFunc := func(resp substreams.ResponseFromAnyTier) error {
+		if resp, ok := resp.(*pbsubstreamsrpc.Response); ok {
+			if data := resp.GetBlockScopedData(); data != nil {
+				continuationCursor = data.Cursor
+			}
+		}
+		return respFunc(resp)
+	}
+
+	for i, chunk := range chunks {
+		chunkDetails := *requestDetails
+		chunkDetails.ResolvedStartBlockNum = chunk.StartBlock
+		chunkDetails.LinearHandoffBlockNum = chunk.ExclusiveEndBlock
+		chunkDetails.StopBlockNum = chunk.ExclusiveEndBlock
+		chunkCtx := reqctx.WithRequest(ctx, &chunkDetails)
+
+		logger.Info("backprocessing request chunk", zap.Int("chunk", i+1), zap.Int("chunk_count", len(chunks)+1), zap.Stringer("range", chunk))
+
+		var opts []pipeline.Option
+		if i == 0 && undoMessage != nil {
+			opts = append(opts, pipeline.WithPendingUndoMessage(undoMessage))
+		}
+		if err := s.backprocessChunk(chunkCtx, outputGraph, storeConfigs, execOutputConfigs, wasmRuntime, chunkRespFunc, opts); err != nil {
+			return fmt.Errorf("backprocessing request chunk %s: %w", chunk, err)
+		}
+
+		logger.Info("request chunk completed", zap.Stringer("range", chunk), zap.String("continuation_cursor", continuationCursor))
+		if requestDetails.HasCapability(substreams.CapabilityChunkProgress) {
+			if err := respFunc(&pbsubstreamsrpc.Response{
+				Message: &pbsubstreamsrpc.Response_Progress{
+					Progress: &pbsubstreamsrpc.ModulesProgress{
+						Chunk: &pbsubstreamsrpc.ChunkProgress{EndBlock: chunk.ExclusiveEndBlock, ContinuationCursor: continuationCursor},
+					},
+				},
+			}); err != nil {
+				return fmt.Errorf("sending request chunk progress: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// backprocessChunk runs the parallel processing of a single chunk, the
+// chunk's range being the request details of `ctx`, with the pipeline options
+// of the service for that range.
+func (s *Tier1Service) backprocessChunk(
+	ctx context.Context,
+	outputGraph *outputmodules.Graph,
+	storeConfigs store.ConfigMap,
+	execOutputConfigs *execout.Configs,
+	wasmRuntime *wasm.Registry,
+	respFunc substreams.ResponseFunc,
+	opts []pipeline.Option,
+) error {
+	requestDetails := reqctx.Details(ctx)
+	stores := pipeline.NewStores(storeConfigs, s.runtimeConfig.CacheSaveInterval, requestDetails.LinearHandoffBlockNum, requestDetails.StopBlockNum, false, "tier1")
+
+	execOutputCacheEngine, err := cache.NewEngine(ctx, s.runtimeConfig, nil, s.blockType)
+	if err != nil {
+		return fmt.Errorf("error building caching engine: %w", err)
+	}
+
+	opts = append(s.buildPipelineOptions(ctx), opts...)
+	pipe := pipeline.New(
+		ctx,
+		outputGraph,
+		stores,
+		execOutputConfigs,
+		wasmRuntime,
+		execOutputCacheEngine,
+		s.runtimeConfig,
+		respFunc,
+		"tier1",
+		tracing.GetTraceID(ctx).String(),
+		opts...,
+	)
+	if err := pipe.InitStoresAndBackprocess(ctx); err != nil {
+		return fmt.Errorf("error during init_stores_and_backprocess: %w", err)
+	}
+	return nil
+}
+
+// handoffCatchUp returns the range of the blocks finalized beyond
+// `handoffBlock`, up to `recentFinalBlock` rounded down to the store save
+// `interval`, so that the stream can start from the snapshots saved at its
+// end. It stays below `stopBlock`, and nil is returned when it spans less
+// than `minBlocks` blocks.
+func handoffCatchUp(handoffBlock, stopBlock, recentFinalBlock, minBlocks, interval uint64) *block.Range {
+	end := recentFinalBlock
+	if stopBlock != 0 && end >= stopBlock {
+		end = stopBlock - 1
+	}
+	if interval != 0 {
+		end -= end % interval
+	}
+	if end <= handoffBlock || end-handoffBlock < minBlocks {
+		return nil
+	}
+	return block.NewRange(handoffBlock, end)
+}
+
+// catchUpHandoff backprocesses the blocks finalized while the request was
+// backprocessed up to its linear handoff block, and the ones finalized while
+// these were, until less than `handoffCatchUpBlocks` were. The stream then
+// executes only the blocks produced meanwhile, instead of all the blocks
+// finalized since the request started. It returns the new linear handoff
+// block, unchanged if nothing was backprocessed, as when the request starts
+// beyond its linear handoff block: nothing below its start block is sent.
+func (s *Tier1Service) catchUpHandoff(
+	ctx context.Context,
+	stopBlock uint64,
+	outputGraph *outputmodules.Graph,
+	storeConfigs store.ConfigMap,
+	execOutputConfigs *execout.Configs,
+	wasmRuntime *wasm.Registry,
+	respFunc substreams.ResponseFunc,
+) (uint64, error) {
+	logger := reqctx.Logger(ctx)
+	requestDetails := reqctx.Details(ctx)
+
+	handoff := requestDetails.LinearHandoffBlockNum
+	if handoff <= requestDetails.ResolvedStartBlockNum {
+		return handoff, nil
+	}
+	for {
+		recentFinalBlock, err := s.getRecentFinalBlock()
+		if err != nil {
+			logger.Warn("cannot determine a recent finalized block, handing off to the stream", zap.Error(err))
+			return handoff, nil
+		}
+		catchUp := handoffCatchUp(handoff, stopBlock, recentFinalBlock, s.handoffCatchUpBlocks, s.runtimeConfig.CacheSaveInterval)
+		if catchUp == nil {
+			return handoff, nil
+		}
+
+		logger.Info("backprocessing the blocks finalized since the handoff", zap.Stringer("range", catchUp))
+		catchUpDetails := *requestDetails
+		catchUpDetails.ResolvedStartBlockNum = catchUp.StartBlock
+		catchUpDetails.LinearHandoffBlockNum = catchUp.ExclusiveEndBlock
+		catchUpDetails.StopBlockNum = catchUp.ExclusiveEndBlock
+		if err := s.backprocessChunk(reqctx.WithRequest(ctx, &catchUpDetails), outputGraph, storeConfigs, execOutputConfigs, wasmRuntime, respFunc, nil); err != nil {
+			return 0, fmt.Errorf("backprocessing blocks %s finalized since the handoff: %w", catchUp, err)
+		}
+		handoff = catchUp.ExclusiveEndBlock
+	}
+}
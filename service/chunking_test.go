@@ -0,0 +1,85 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/streamingfast/substreams/block"
+)
+
+func TestRequestChunks(t *testing.T) {
+	tests := []struct {
+		name         string
+		startBlock   uint64
+		handoffBlock uint64
+		chunkSize    uint64
+		interval     uint64
+		expect       []*block.Range
+	}{
+		{"disabled", 0, 10_000, 0, 100, nil},
+		{"single chunk", 150, 1_100, 1_000, 100, nil},
+		{"no backprocessing", 5_000, 5_000, 1_000, 100, nil},
+		{
+			name:         "aligned on the chunk size",
+			startBlock:   150,
+			handoffBlock: 3_420,
+			chunkSize:    1_000,
+			interval:     100,
+			expect: []*block.Range{
+				block.NewRange(150, 1_000),
+				block.NewRange(1_000, 2_000),
+				block.NewRange(2_000, 3_000),
+			},
+		},
+		{
+			name:         "last chunk ending on handoff served by the pipeline",
+			startBlock:   0,
+			handoffBlock: 2_000,
+			chunkSize:    1_000,
+			interval:     100,
+			expect:       []*block.Range{block.NewRange(0, 1_000)},
+		},
+		{
+			name:         "chunk size rounded up to the save interval",
+			startBlock:   0,
+			handoffBlock: 2_500,
+			chunkSize:    950,
+			interval:     100,
+			expect: []*block.Range{
+				block.NewRange(0, 1_000),
+				block.NewRange(1_000, 2_000),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expect, requestChunks(test.startBlock, test.handoffBlock, test.chunkSize, test.interval))
+		})
+	}
+}
+
+func TestHandoffCatchUp(t *testing.T) {
+	tests := []struct {
+		name             string
+		handoffBlock     uint64
+		stopBlock        uint64
+		recentFinalBlock uint64
+		minBlocks        uint64
+		expect           *block.Range
+	}{
+		{"nothing finalized since", 5_000, 0, 5_000, 100, nil},
+		{"less than the minimum", 5_000, 0, 5_050, 100, nil},
+		{"rounded down to the save interval", 4_950, 0, 7_250, 100, block.NewRange(4_950, 7_000)},
+		{"rounded down below the minimum", 5_000, 0, 5_950, 100, nil},
+		{"below the stop block", 5_000, 7_000, 9_000, 100, block.NewRange(5_000, 6_000)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expect, handoffCatchUp(test.handoffBlock, test.stopBlock, test.recentFinalBlock, test.minBlocks, 1_000))
+		})
+	}
+	assert.Equal(t, block.NewRange(5_000, 5_250), handoffCatchUp(5_000, 0, 5_250, 100, 0), "not rounded without interval")
+}
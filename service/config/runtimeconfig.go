@@ -1,9 +1,17 @@
 package config
 
 import (
+	"context"
+	"time"
+
 	"github.com/streamingfast/dstore"
 
+	"github.com/streamingfast/substreams"
+	"github.com/streamingfast/substreams/metrics"
 	"github.com/streamingfast/substreams/orchestrator/work"
+	"github.com/streamingfast/substreams/storage/execout"
+	"github.com/streamingfast/substreams/storage/idempotency"
+	"github.com/streamingfast/substreams/wasm"
 )
 
 // RuntimeConfig is a global configuration for the service.
@@ -11,17 +19,60 @@ import (
 type RuntimeConfig struct {
 	CacheSaveInterval uint64
 
-	MaxWasmFuel                uint64 // if not 0, enable fuel consumption monitoring to stop runaway wasm module processing forever
-	SubrequestsSplitSize       uint64 // in multiple of the SaveIntervals above
-	MaxJobsAhead               uint64 // limit execution of depencency jobs so they don't go too far ahead of the modules that depend on them (ex: module X is 2 million blocks ahead of module Y that depends on it, we don't want to schedule more module X jobs until Y caught up a little bit)
-	DefaultParallelSubrequests uint64 // how many sub-jobs to launch for a given user
+	MaxWasmFuel                uint64        // if not 0, enable fuel consumption monitoring to stop runaway wasm module processing forever
+	ModuleExecutionTimeout     time.Duration // if not 0, the executions of a module on a single block taking longer are stopped, failing the request
+	SubrequestsSplitSize       uint64        // in multiple of the SaveIntervals above
+	MaxJobsAhead               uint64        // limit execution of depencency jobs so they don't go too far ahead of the modules that depend on them (ex: module X is 2 million blocks ahead of module Y that depends on it, we don't want to schedule more module X jobs until Y caught up a little bit)
+	DefaultParallelSubrequests uint64        // how many sub-jobs to launch for a given user
 	// derives substores `states/`, for `store` modules snapshots (full and partial)
 	// and `outputs/` for execution output of both `map` and `store` module kinds
 	BaseObjectStore dstore.Store
 	WorkerFactory   work.WorkerFactory
+	ReserveJob      func(context.Context, *work.Job) error // if set, called once per backprocessing job before its first attempt, the error returned failing the job
 
 	WithRequestStats       bool
 	ModuleExecutionTracing bool
+
+	JobPriority                func(*work.Job) int   // if set, replaces the default priority of the backprocessing jobs, see work.Plan.Reprioritize
+	MaxConcurrentJobsPerModule uint64                // if not 0, limits the backprocessing jobs of a single module running at the same time
+	SchedulerEventLog          bool                  // if true, tier1 writes the decisions of its scheduler under `events/<trace_id>.events.jsonl`
+	PackageStats               *metrics.PackageStats // if set, tier1 aggregates the orchestration of its requests by package, see metrics.PackageStats
+	PlanCheckpoints            bool                  // if true, tier1 checkpoints its work plan under `plans/` to resume backprocessing after a restart
+	PlanCheckpointMaxAge       time.Duration         // the plan checkpoints saved longer than this ago are not resumed from
+	ThroughputStats            bool                  // if true, tier1 persists the throughput measured for each module under `stats/<module_hash>.json` and plans from it
+	AdaptiveJobDuration        time.Duration         // if not 0, the jobs of the modules with a measured throughput (see ThroughputStats) are sized to take about this duration, see work.Splitter
+	WorkerPoolAutoscaler       work.Autoscaler       // if set, resizes the worker pool of each request from its demand, see work.Demand
+	MaxConcurrentSquashes      uint64                // if not 0, limits the partial stores merged at the same time by a request, across its store modules
+	MaxPendingMergeBytes       uint64                // if not 0, the dispatch of jobs slows down while the partial stores of a request not merged yet exceed it
+	SquashLoadParallelism      uint64                // if above 1, the squashers load up to that many partial stores at the same time, ahead of the one they merge
+	StoreJobsProduceOutputs    bool                  // store jobs also produce the outputs of the output map module over their range when its inputs are available, see work.Plan.CarryOutputJobs
+	DevModeDiscardOutputs      bool                  // the jobs of development mode requests discard their execution outputs instead of writing them, see execout.DiscardWriter
+
+	ModuleExecutionBudget       time.Duration // if not 0, a module whose execution on a single block exceeds it is reported
+	ModuleExecutionBudgetRepeat uint64        // number of blocks exceeding the budget before a module is reported
+	CPUHeavyModuleSlots         chan struct{} // if set, shared by the pipelines of the process to bound the `cpu_heavy` modules executing at the same time
+
+	ExtensionBreakers *wasm.ExtensionBreakers // if set, the calls to the WASM extensions of a failing provider fail immediately for a while, see wasm.ExtensionBreakers
+
+	DisabledCapabilities []string // capabilities never negotiated with the clients, see substreams.SupportedCapabilities
+
+	ExecOutAccessTracker *execout.AccessTracker // if set, records the accesses to the execution outputs segments, for the execout pruner
+	IdempotencyLedger    *idempotency.Ledger    // if set, the store snapshots, execution outputs and flush manifests already written are not written again, see idempotency.Ledger
+
+	CommitStoreFlushes bool // if true, the stores flushed together at a boundary are committed with manifests, see store.Commits
+
+	ContentAddressedOutputs bool // if true, the execution outputs segments are written content-addressed, shared by the modules producing the same outputs, see execout.BlobsDir
+
+	PinnedCache        dstore.Store // read-only cache maintained by another provider, serving the files of the modules below, see package `pinned`
+	PinnedModuleHashes []string     // modules always complete in PinnedCache, never scheduled
+
+	MaxReorgDepth uint64 // if not 0, tier1 retains the store changes of at most that many reversible blocks, a deeper reorganization fails the request
+
+	ResumePointInterval time.Duration // if not 0, tier1 saves the stores of its linear pipeline at the final blocks it sends, at most once per interval, so that a request resumed from a cursor is planned from there
+
+	SnapshotWriteQueueSize uint64 // if not 0, the store snapshots are written in the background while the blocks are processed, up to that many waiting to be written
+
+	StoreSeedURLPrefixes []string // URLs the servers fetch the store seeds from must start with one of these, see outputmodules.Graph.ValidateStoreSeeds
 }
 
 func NewRuntimeConfig(
@@ -45,3 +96,20 @@ func NewRuntimeConfig(
 		ModuleExecutionTracing: false,
 	}
 }
+
+// EnabledCapabilities returns the supported capabilities that are not disabled.
+func (c RuntimeConfig) EnabledCapabilities() (out []string) {
+	for _, capability := range substreams.SupportedCapabilities {
+		disabled := false
+		for _, d := range c.DisabledCapabilities {
+			if d == capability {
+				disabled = true
+				break
+			}
+		}
+		if !disabled {
+			out = append(out, capability)
+		}
+	}
+	return
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	connect_go "github.com/bufbuild/connect-go"
+	"google.golang.org/grpc/status"
+)
+
+// grpcStatusInterceptor turns the gRPC status errors returned by the handlers
+// into connect errors of the same code, message and details (like the
+// `RetryInfo` of a full request queue). connect-go only knows its own errors,
+// the others reach the clients of every protocol it serves (Connect, gRPC-Web
+// and gRPC) with the `Unknown` code.
+type grpcStatusInterceptor struct{}
+
+func (grpcStatusInterceptor) WrapUnary(next connect_go.UnaryFunc) connect_go.UnaryFunc {
+	return func(ctx context.Context, req connect_go.AnyRequest) (connect_go.AnyResponse, error) {
+		resp, err := next(ctx, req)
+		return resp, toConnectError(err)
+	}
+}
+
+func (grpcStatusInterceptor) WrapStreamingClient(next connect_go.StreamingClientFunc) connect_go.StreamingClientFunc {
+	return next
+}
+
+func (grpcStatusInterceptor) WrapStreamingHandler(next connect_go.StreamingHandlerFunc) connect_go.StreamingHandlerFunc {
+	return func(ctx context.Context, conn connect_go.StreamingHandlerConn) error {
+		return toConnectError(next(ctx, conn))
+	}
+}
+
+func toConnectError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var connectErr *connect_go.Error
+	if errors.As(err, &connectErr) {
+		return err
+	}
+	var withStatus interface{ GRPCStatus() *status.Status }
+	if !errors.As(err, &withStatus) {
+		return err
+	}
+
+	st := withStatus.GRPCStatus()
+	out := connect_go.NewError(connect_go.Code(st.Code()), errors.New(st.Message()))
+	for _, detail := range st.Proto().Details {
+		if d, err := connect_go.NewErrorDetail(detail); err == nil {
+			out.AddDetail(d)
+		}
+	}
+	return out
+}
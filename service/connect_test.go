@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	connect_go "github.com/bufbuild/connect-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
+	ssconnect "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2/pbsubstreamsrpcconnect"
+)
+
+type testStreamHandler struct {
+	ssconnect.UnimplementedStreamHandler
+
+	release chan struct{}
+}
+
+func (h *testStreamHandler) Blocks(ctx context.Context, req *connect_go.Request[pbsubstreamsrpc.Request], stream *connect_go.ServerStream[pbsubstreamsrpc.Response]) error {
+	if err := stream.Send(&pbsubstreamsrpc.Response{Message: &pbsubstreamsrpc.Response_Session{Session: &pbsubstreamsrpc.SessionInit{TraceId: "trace"}}}); err != nil {
+		return err
+	}
+	<-h.release
+
+	st, _ := status.New(codes.ResourceExhausted, "queue full").WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(time.Second)})
+	return st.Err()
+}
+
+func TestBlocks_Protocols(t *testing.T) {
+	mux := http.NewServeMux()
+	handler := &testStreamHandler{release: make(chan struct{})}
+	mux.Handle(ssconnect.NewStreamHandler(handler, connect_go.WithInterceptors(grpcStatusInterceptor{})))
+
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	for name, protocol := range map[string][]connect_go.ClientOption{
+		"connect":  nil,
+		"grpc":     {connect_go.WithGRPC()},
+		"grpc-web": {connect_go.WithGRPCWeb()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cli := ssconnect.NewStreamClient(server.Client(), server.URL, protocol...)
+			stream, err := cli.Blocks(context.Background(), connect_go.NewRequest(&pbsubstreamsrpc.Request{}))
+			require.NoError(t, err)
+			defer stream.Close()
+
+			// received while the handler is still running: each message is flushed
+			require.True(t, stream.Receive(), "%v", stream.Err())
+			assert.Equal(t, "trace", stream.Msg().GetSession().TraceId)
+
+			handler.release <- struct{}{}
+			require.False(t, stream.Receive())
+
+			var connectErr *connect_go.Error
+			require.True(t, errors.As(stream.Err(), &connectErr), "%v", stream.Err())
+			assert.Equal(t, connect_go.CodeResourceExhausted, connectErr.Code())
+			assert.Equal(t, "queue full", connectErr.Message())
+			require.Len(t, connectErr.Details(), 1)
+			detail, err := connectErr.Details()[0].Value()
+			require.NoError(t, err)
+			assert.Equal(t, time.Second, detail.(*errdetails.RetryInfo).RetryDelay.AsDuration())
+		})
+	}
+}
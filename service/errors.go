@@ -0,0 +1,175 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/streamingfast/bstream/stream"
+	"github.com/streamingfast/dgrpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/streamingfast/substreams"
+	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
+	"github.com/streamingfast/substreams/pipeline/exec"
+	"github.com/streamingfast/substreams/storage"
+	"github.com/streamingfast/substreams/wasm"
+)
+
+// missingDependencyError is the failure of a request whose modules depend on
+// features the endpoint lacks.
+type missingDependencyError struct {
+	module string
+	reason string
+}
+
+func (e *missingDependencyError) Error() string {
+	return e.reason
+}
+
+// toGRPCError turns an `err` into a gRPC error if it's non-nil, in the `nil` case,
+// `nil` is returned right away.
+//
+// The status of the gRPC error carries the `Error` describing `err` in its
+// details, see toRPCError, so the clients can tell the fatal errors from the
+// retryable ones.
+//
+// If the `err` has its in chain any error constructed through `status.Error` (and its variants), then
+// we return the first found error of such type, because it's already a gRPC error, the `Error` being
+// added to its details when it has none (ex: the errors of the admission and of the quotas).
+func toGRPCError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if grpcError := dgrpc.AsGRPCError(err); grpcError != nil {
+		if substreams.ErrorDetails(err) != nil {
+			return grpcError.Err()
+		}
+		details := errorFromCode(grpcError.Code(), grpcError.Message())
+		if withDetails, err := grpcError.WithDetails(details); err == nil {
+			return withDetails.Err()
+		}
+		return grpcError.Err()
+	}
+
+	code, details := toRPCError(err)
+	return substreams.NewStatusError(code, details)
+}
+
+// toRPCError classifies `err`, which is not a gRPC error, returning the code of
+// the gRPC error it becomes and the `Error` describing it.
+func toRPCError(err error) (codes.Code, *pbsubstreamsrpc.Error) {
+	if errors.Is(err, context.Canceled) {
+		return codes.Canceled, &pbsubstreamsrpc.Error{Code: pbsubstreamsrpc.ErrorCode_ERROR_CODE_CANCELED, Reason: "source canceled", Retryable: true}
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return codes.DeadlineExceeded, &pbsubstreamsrpc.Error{Code: pbsubstreamsrpc.ErrorCode_ERROR_CODE_DEADLINE_EXCEEDED, Reason: "source deadline exceeded", Retryable: true}
+	}
+
+	out := &pbsubstreamsrpc.Error{Reason: err.Error()}
+	var errExecution *exec.ExecutionError
+	if errors.As(err, &errExecution) {
+		out.Module = errExecution.Module
+		out.BlockNum = errExecution.BlockNum
+	}
+
+	if errors.Is(err, exec.ErrWasmDeterministicExec) {
+		out.Code = pbsubstreamsrpc.ErrorCode_ERROR_CODE_USER_MODULE_PANIC
+		return codes.InvalidArgument, out
+	}
+
+	if errors.Is(err, exec.ErrNonDeterministicExec) {
+		out.Code = pbsubstreamsrpc.ErrorCode_ERROR_CODE_NON_DETERMINISTIC_MODULE
+		return codes.InvalidArgument, out
+	}
+
+	var errLimitExceeded *wasm.LimitExceededError
+	if errors.As(err, &errLimitExceeded) {
+		out.Code = pbsubstreamsrpc.ErrorCode_ERROR_CODE_LIMIT_EXCEEDED
+		out.BlockNum = errLimitExceeded.BlockNum
+		return codes.InvalidArgument, out
+	}
+
+	var errExtensionUnavailable *wasm.ExtensionUnavailableError
+	if errors.As(err, &errExtensionUnavailable) {
+		out.Code = pbsubstreamsrpc.ErrorCode_ERROR_CODE_UNAVAILABLE
+		out.Retryable = true
+		return codes.Unavailable, out
+	}
+
+	var errMissingDependency *missingDependencyError
+	if errors.As(err, &errMissingDependency) {
+		out.Code = pbsubstreamsrpc.ErrorCode_ERROR_CODE_MISSING_DEPENDENCY
+		out.Module = errMissingDependency.module
+		return codes.InvalidArgument, out
+	}
+
+	var errStorageUnavailable *storage.UnavailableError
+	if errors.As(err, &errStorageUnavailable) {
+		out.Code = pbsubstreamsrpc.ErrorCode_ERROR_CODE_STORAGE_UNAVAILABLE
+		out.Retryable = true
+		return codes.Unavailable, out
+	}
+
+	var errInvalidArg *stream.ErrInvalidArg
+	if errors.As(err, &errInvalidArg) {
+		out.Code = pbsubstreamsrpc.ErrorCode_ERROR_CODE_INVALID_REQUEST
+		out.Reason = errInvalidArg.Error()
+		return codes.InvalidArgument, out
+	}
+
+	// Do we want to print the full cause as coming from Golang? Would we like to maybe trim off "operational"
+	// data?
+	out.Code = pbsubstreamsrpc.ErrorCode_ERROR_CODE_INTERNAL
+	out.Retryable = true
+	return codes.Internal, out
+}
+
+// errorFromCode returns the `Error` of a gRPC error of `code` carrying none.
+func errorFromCode(code codes.Code, reason string) *pbsubstreamsrpc.Error {
+	out := &pbsubstreamsrpc.Error{Reason: reason}
+	switch code {
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange, codes.Unimplemented,
+		codes.NotFound, codes.AlreadyExists, codes.PermissionDenied, codes.Unauthenticated:
+		out.Code = pbsubstreamsrpc.ErrorCode_ERROR_CODE_INVALID_REQUEST
+	case codes.ResourceExhausted:
+		out.Code = pbsubstreamsrpc.ErrorCode_ERROR_CODE_LIMIT_EXCEEDED
+		out.Retryable = true
+	case codes.Unavailable, codes.Aborted:
+		out.Code = pbsubstreamsrpc.ErrorCode_ERROR_CODE_UNAVAILABLE
+		out.Retryable = true
+	case codes.Canceled:
+		out.Code = pbsubstreamsrpc.ErrorCode_ERROR_CODE_CANCELED
+		out.Retryable = true
+	case codes.DeadlineExceeded:
+		out.Code = pbsubstreamsrpc.ErrorCode_ERROR_CODE_DEADLINE_EXCEEDED
+		out.Retryable = true
+	default:
+		out.Code = pbsubstreamsrpc.ErrorCode_ERROR_CODE_INTERNAL
+		out.Retryable = true
+	}
+	return out
+}
+
+// structuredErrors tells whether the `Error` of a failed request is sent to its
+// client in a last `Response`, see substreams.CapabilityStructuredErrors.
+func (s *Tier1Service) structuredErrors(request *pbsubstreamsrpc.Request) bool {
+	for _, capability := range substreams.NegotiateCapabilities(request.Capabilities, s.runtimeConfig.EnabledCapabilities()) {
+		if capability == substreams.CapabilityStructuredErrors {
+			return true
+		}
+	}
+	return false
+}
+
+// sendErrorResponse sends the `Error` of `grpcError`, returned by toGRPCError,
+// to the client of respFunc, see substreams.CapabilityStructuredErrors.
+func sendErrorResponse(respFunc substreams.ResponseFunc, grpcError error) {
+	details := substreams.ErrorDetails(grpcError)
+	if details == nil {
+		details = errorFromCode(status.Code(grpcError), status.Convert(grpcError).Message())
+	}
+	_ = respFunc(substreams.NewErrorResponse(details))
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/streamingfast/bstream/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/streamingfast/substreams"
+	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
+	"github.com/streamingfast/substreams/pipeline/exec"
+	"github.com/streamingfast/substreams/storage"
+	"github.com/streamingfast/substreams/wasm"
+)
+
+func TestToGRPCError(t *testing.T) {
+	tests := []struct {
+		name          string
+		err           error
+		expectCode    codes.Code
+		expectDetails *pbsubstreamsrpc.Error
+	}{
+		{
+			"module panic",
+			fmt.Errorf("running module: %w", &exec.ExecutionError{Module: "map_a", BlockNum: 12, Err: fmt.Errorf("%w: boom", exec.ErrWasmDeterministicExec)}),
+			codes.InvalidArgument,
+			&pbsubstreamsrpc.Error{Code: pbsubstreamsrpc.ErrorCode_ERROR_CODE_USER_MODULE_PANIC, Module: "map_a", BlockNum: 12},
+		},
+		{
+			"non deterministic",
+			&exec.ExecutionError{Module: "map_a", BlockNum: 12, Err: exec.ErrNonDeterministicExec},
+			codes.InvalidArgument,
+			&pbsubstreamsrpc.Error{Code: pbsubstreamsrpc.ErrorCode_ERROR_CODE_NON_DETERMINISTIC_MODULE, Module: "map_a", BlockNum: 12},
+		},
+		{
+			"execution limit",
+			&exec.ExecutionError{Module: "map_a", BlockNum: 12, Err: &wasm.LimitExceededError{Limit: wasm.ExecutionLimitFuel, Fuel: 10, BlockNum: 12}},
+			codes.InvalidArgument,
+			&pbsubstreamsrpc.Error{Code: pbsubstreamsrpc.ErrorCode_ERROR_CODE_LIMIT_EXCEEDED, Module: "map_a", BlockNum: 12},
+		},
+		{
+			"missing dependency",
+			&missingDependencyError{module: "map_a", reason: "unsupported"},
+			codes.InvalidArgument,
+			&pbsubstreamsrpc.Error{Code: pbsubstreamsrpc.ErrorCode_ERROR_CODE_MISSING_DEPENDENCY, Module: "map_a"},
+		},
+		{
+			"storage unavailable",
+			fmt.Errorf("loading store: %w", &storage.UnavailableError{Operation: "open_object", Err: errors.New("throttled")}),
+			codes.Unavailable,
+			&pbsubstreamsrpc.Error{Code: pbsubstreamsrpc.ErrorCode_ERROR_CODE_STORAGE_UNAVAILABLE, Retryable: true},
+		},
+		{
+			"invalid request",
+			stream.NewErrInvalidArg("bad"),
+			codes.InvalidArgument,
+			&pbsubstreamsrpc.Error{Code: pbsubstreamsrpc.ErrorCode_ERROR_CODE_INVALID_REQUEST},
+		},
+		{
+			"canceled",
+			fmt.Errorf("stream: %w", context.Canceled),
+			codes.Canceled,
+			&pbsubstreamsrpc.Error{Code: pbsubstreamsrpc.ErrorCode_ERROR_CODE_CANCELED, Retryable: true},
+		},
+		{
+			"internal",
+			errors.New("unexpected"),
+			codes.Internal,
+			&pbsubstreamsrpc.Error{Code: pbsubstreamsrpc.ErrorCode_ERROR_CODE_INTERNAL, Retryable: true},
+		},
+		{
+			"gRPC error without details",
+			status.Error(codes.FailedPrecondition, "sunset"),
+			codes.FailedPrecondition,
+			&pbsubstreamsrpc.Error{Code: pbsubstreamsrpc.ErrorCode_ERROR_CODE_INVALID_REQUEST},
+		},
+		{
+			"gRPC error with details, from tier2",
+			fmt.Errorf("job failed: %w", substreams.NewStatusError(codes.InvalidArgument, &pbsubstreamsrpc.Error{Code: pbsubstreamsrpc.ErrorCode_ERROR_CODE_LIMIT_EXCEEDED, Reason: "timeout", Module: "map_b"})),
+			codes.InvalidArgument,
+			&pbsubstreamsrpc.Error{Code: pbsubstreamsrpc.ErrorCode_ERROR_CODE_LIMIT_EXCEEDED, Module: "map_b"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			grpcError := toGRPCError(test.err)
+			assert.Equal(t, test.expectCode, status.Code(grpcError))
+
+			details := substreams.ErrorDetails(grpcError)
+			require.NotNil(t, details)
+			assert.True(t, proto.Equal(details, substreams.ErrorDetails(toGRPCError(grpcError))), "idempotent")
+
+			assert.NotEmpty(t, details.Reason)
+			details.Reason = ""
+			assert.True(t, proto.Equal(test.expectDetails, details), "got %s", details)
+		})
+	}
+
+	assert.Nil(t, toGRPCError(nil))
+}
+
+func TestSendErrorResponse(t *testing.T) {
+	var sent []substreams.ResponseFromAnyTier
+	respFunc := func(resp substreams.ResponseFromAnyTier) error {
+		sent = append(sent, resp)
+		return nil
+	}
+
+	sendErrorResponse(respFunc, toGRPCError(errors.New("unexpected")))
+	require.Len(t, sent, 1)
+	resp := sent[0].(*pbsubstreamsrpc.Response).GetError()
+	assert.Equal(t, pbsubstreamsrpc.ErrorCode_ERROR_CODE_INTERNAL, resp.Code)
+	assert.Equal(t, "unexpected", resp.Reason)
+}
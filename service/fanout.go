@@ -0,0 +1,511 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/streamingfast/dmetering"
+
+	"github.com/streamingfast/substreams"
+	"github.com/streamingfast/substreams/billing"
+	"github.com/streamingfast/substreams/metrics"
+	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
+	"github.com/streamingfast/substreams/pipeline/outputmodules"
+	"github.com/streamingfast/substreams/reqctx"
+)
+
+// fanOutSubscriberBuffer is the number of responses a subscriber of a shared
+// pipeline can lag behind before being dropped, so that a slow client never
+// stalls the others.
+const fanOutSubscriberBuffer = 1000
+
+var errFanOutSubscriberTooSlow = status.Error(codes.Unavailable, "client fell behind the shared live stream, reconnect from your last cursor")
+
+// fanOut runs a single pipeline for the live requests producing the same
+// responses, see fanOutKey, and fans its responses out to all of them.
+//
+// The first request of a key starts the shared pipeline. The next ones join
+// it when their cursor, or their start block, is covered by the last
+// `replayBlocks` blocks it sent, replayed to them first. The others run their
+// own pipeline.
+//
+// The usage of the shared pipeline is attributed to its subscribers, see
+// sharedUsage.
+type fanOut struct {
+	replayBlocks uint64
+	terminating  <-chan struct{} // cancels the shared pipelines
+
+	mu         sync.Mutex
+	broadcasts map[string]*broadcast
+}
+
+func newFanOut(replayBlocks uint64, terminating <-chan struct{}) *fanOut {
+	return &fanOut{
+		replayBlocks: replayBlocks,
+		terminating:  terminating,
+		broadcasts:   make(map[string]*broadcast),
+	}
+}
+
+// fanOutKey returns the key of the requests whose responses are the same, false
+// when `request` is not served by a shared pipeline: only the production mode
+// requests streaming live from their start, without backprocessing, stop
+// conditions nor pending undo, are.
+func fanOutKey(request *pbsubstreamsrpc.Request, requestDetails *reqctx.RequestDetails, outputGraph *outputmodules.Graph, outputSampling uint64, undoSignal *pbsubstreamsrpc.BlockUndoSignal) (string, bool) {
+	if !request.ProductionMode || request.StopBlockNum != 0 || request.StopConditions != nil || undoSignal != nil {
+		return "", false
+	}
+	if len(request.DebugInitialStoreSnapshotForModules) != 0 {
+		return "", false
+	}
+	if requestDetails.ResolvedStartBlockNum < requestDetails.LinearHandoffBlockNum {
+		return "", false
+	}
+
+	return fmt.Sprintf("%s:%t:%s:%s:%d",
+		outputModuleHashes(outputGraph),
+		request.FinalBlocksOnly,
+		sortedJoin(request.StoreDeltaModules),
+		sortedJoin(requestDetails.Capabilities),
+		outputSampling,
+	), true
+}
+
+// outputModuleHashes identifies the output modules of `outputGraph`, in their
+// order.
+func outputModuleHashes(outputGraph *outputmodules.Graph) string {
+	hashes := make([]string, len(outputGraph.OutputModules()))
+	for i, module := range outputGraph.OutputModules() {
+		hashes[i] = outputGraph.ModuleHashes().Get(module.Name)
+	}
+	return strings.Join(hashes, ",")
+}
+
+func sortedJoin(values []string) string {
+	sorted := append([]string{}, values...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ",")
+}
+
+// serve sends the responses of the shared pipeline of `key` from
+// `startCursor`, or from `startBlock` without cursor, to `respFunc`, until
+// `ctx` is done or the pipeline ends. It runs `run` itself, sending to
+// `respFunc`, when the shared pipeline does not cover that start.
+//
+// The shared pipeline is started with `run` when there is none. It runs in a
+// context detached from `ctx`, holding its values but its usage accounting,
+// until all its subscribers left.
+func (f *fanOut) serve(ctx context.Context, key string, startCursor string, startBlock uint64, respFunc substreams.ResponseFunc, run func(ctx context.Context, respFunc substreams.ResponseFunc) error) error {
+	logger := reqctx.Logger(ctx)
+
+	f.mu.Lock()
+	b := f.broadcasts[key]
+	var sub *subscriber
+	switch {
+	case b == nil:
+		b = newBroadcast(f.replayBlocks)
+		sub = b.subscribe(usageAccountFromContext(ctx))
+		f.broadcasts[key] = b
+		go f.run(ctx, key, b, run)
+		metrics.RequestFanOut.Inc("started")
+		logger.Info("starting shared live pipeline", zap.String("fan_out_key", key))
+	default:
+		sub = b.join(startCursor, startBlock, usageAccountFromContext(ctx))
+	}
+	f.mu.Unlock()
+
+	if sub == nil {
+		metrics.RequestFanOut.Inc("own_pipeline")
+		logger.Debug("start not covered by the shared live pipeline, running own pipeline", zap.String("fan_out_key", key))
+		return run(ctx, respFunc)
+	}
+	if !sub.creator {
+		metrics.RequestFanOut.Inc("joined")
+		logger.Info("joined shared live pipeline", zap.String("fan_out_key", key))
+	}
+
+	defer b.leave(sub)
+	return sub.forward(ctx, respFunc)
+}
+
+func (f *fanOut) run(ctx context.Context, key string, b *broadcast, run func(ctx context.Context, respFunc substreams.ResponseFunc) error) {
+	ctx, cancel := context.WithCancel(b.usage.attach(detachedContext{ctx}))
+	b.setCancel(cancel)
+	defer cancel()
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-f.terminating:
+			cancel()
+		}
+	}()
+
+	err := run(ctx, b.send)
+
+	f.mu.Lock()
+	if f.broadcasts[key] == b {
+		delete(f.broadcasts, key)
+	}
+	f.mu.Unlock()
+
+	b.end(err)
+}
+
+// broadcast is a shared pipeline, sending its responses to its subscribers.
+type broadcast struct {
+	replayBlocks uint64
+	usage        *sharedUsage
+
+	mu          sync.Mutex
+	cancel      context.CancelFunc
+	subscribers map[*subscriber]bool
+	ended       bool
+	replay      []*pbsubstreamsrpc.Response // the block responses of the last replayBlocks blocks
+}
+
+func newBroadcast(replayBlocks uint64) *broadcast {
+	return &broadcast{
+		replayBlocks: replayBlocks,
+		usage:        newSharedUsage(),
+		subscribers:  make(map[*subscriber]bool),
+	}
+}
+
+func (b *broadcast) setCancel(cancel context.CancelFunc) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.cancel = cancel
+	if len(b.subscribers) == 0 {
+		cancel()
+	}
+}
+
+// subscribe adds the subscriber that started the broadcast, receiving all its
+// responses, its usage attributed to `account`.
+func (b *broadcast) subscribe(account usageAccount) *subscriber {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub := newSubscriber(0, 0, account)
+	sub.creator = true
+	b.subscribers[sub] = true
+	return sub
+}
+
+// join adds a subscriber from `startCursor`, or from `startBlock` without
+// cursor, the block responses sent since being replayed to it first, its usage
+// attributed to `account` from then on. It returns nil when the broadcast ended
+// or its replay does not cover that start.
+func (b *broadcast) join(startCursor string, startBlock uint64, account usageAccount) *subscriber {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.ended || len(b.replay) == 0 {
+		return nil
+	}
+
+	var replay []*pbsubstreamsrpc.Response
+	if startCursor != "" {
+		found := false
+		for i, resp := range b.replay {
+			if responseCursor(resp) == startCursor {
+				replay, found = b.replay[i+1:], true
+				break
+			}
+		}
+		if !found {
+			return nil
+		}
+		startBlock = 0
+	} else {
+		first := b.replay[0].GetBlockScopedData()
+		if first == nil || first.Clock.Number > startBlock {
+			return nil
+		}
+		replay = b.replay
+	}
+
+	sub := newSubscriber(startBlock, len(replay), account)
+	for _, resp := range replay {
+		sub.push(resp)
+	}
+	b.subscribers[sub] = true
+	return sub
+}
+
+func (b *broadcast) leave(sub *subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.subscribers, sub)
+	if len(b.subscribers) == 0 && b.cancel != nil {
+		b.cancel()
+	}
+}
+
+// send is the response function of the shared pipeline.
+func (b *broadcast) send(respAny substreams.ResponseFromAnyTier) error {
+	resp, ok := respAny.(*pbsubstreamsrpc.Response)
+	if !ok {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if isBlockResponse(resp) {
+		b.replay = append(b.replay, resp)
+		b.trimReplay()
+	}
+	if resp.GetBlockScopedData() != nil {
+		b.attributeUsage()
+	}
+	for sub := range b.subscribers {
+		if !sub.push(resp) {
+			sub.close(errFanOutSubscriberTooSlow)
+			delete(b.subscribers, sub)
+		}
+	}
+	if len(b.subscribers) == 0 && b.cancel != nil {
+		b.cancel()
+	}
+	return nil
+}
+
+// trimReplay drops the block responses before the last replayBlocks blocks.
+func (b *broadcast) trimReplay() {
+	var blocks uint64
+	for i := len(b.replay) - 1; i >= 0; i-- {
+		if b.replay[i].GetBlockScopedData() == nil {
+			continue
+		}
+		blocks++
+		if blocks == b.replayBlocks {
+			b.replay = b.replay[i:]
+			return
+		}
+	}
+}
+
+// attributeUsage attributes the usage of the shared pipeline since the
+// previous call to each of its subscribers.
+func (b *broadcast) attributeUsage() {
+	// Called with locked mutex
+	delta := b.usage.take()
+	for sub := range b.subscribers {
+		sub.account.add(delta)
+	}
+}
+
+// end ends the subscriptions with `err`, the error of the shared pipeline.
+func (b *broadcast) end(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.attributeUsage()
+	b.ended = true
+	for sub := range b.subscribers {
+		sub.close(err)
+	}
+}
+
+// subscriber receives the responses of a broadcast, the block responses of
+// the blocks before `startBlock` skipped.
+type subscriber struct {
+	creator bool
+	account usageAccount
+
+	responses  chan *pbsubstreamsrpc.Response
+	startBlock uint64 // 0 once the first block response was received
+
+	closeOnce sync.Once
+	done      chan struct{}
+	err       error
+}
+
+func newSubscriber(startBlock uint64, replayed int, account usageAccount) *subscriber {
+	return &subscriber{
+		account:    account,
+		responses:  make(chan *pbsubstreamsrpc.Response, replayed+fanOutSubscriberBuffer),
+		startBlock: startBlock,
+		done:       make(chan struct{}),
+	}
+}
+
+// push queues `resp`, returning false when the subscriber lags too far behind.
+func (s *subscriber) push(resp *pbsubstreamsrpc.Response) bool {
+	if s.startBlock != 0 && isBlockResponse(resp) {
+		data := resp.GetBlockScopedData()
+		if data == nil || data.Clock.Number < s.startBlock {
+			return true
+		}
+		s.startBlock = 0
+	}
+
+	select {
+	case s.responses <- resp:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *subscriber) close(err error) {
+	s.closeOnce.Do(func() {
+		s.err = err
+		close(s.done)
+	})
+}
+
+// forward sends the responses received to `respFunc`, a copy of each as the
+// response function encodes them in place, until `ctx` is done or the
+// broadcast ended, returning its error once the queued responses were sent.
+func (s *subscriber) forward(ctx context.Context, respFunc substreams.ResponseFunc) error {
+	send := func(resp *pbsubstreamsrpc.Response) error {
+		return respFunc(proto.Clone(resp).(*pbsubstreamsrpc.Response))
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case resp := <-s.responses:
+			if err := send(resp); err != nil {
+				return err
+			}
+		case <-s.done:
+			// nothing is queued after closing, send what was queued before
+			for {
+				select {
+				case resp := <-s.responses:
+					if err := send(resp); err != nil {
+						return err
+					}
+				default:
+					return s.err
+				}
+			}
+		}
+	}
+}
+
+// sharedUsage accounts the usage of a shared pipeline, in place of the request
+// starting it: each subscriber is charged in its own accounting, see
+// usageAccount, the usage of the blocks sent while it is subscribed, as with
+// its own pipeline, the blocks replayed to it being free. The
+// shared pipeline does not backprocess, so it reserves no blocks on the quota
+// leases, and the bytes it streams are counted by the response function of
+// each subscriber.
+type sharedUsage struct {
+	billing *billing.Usage
+	modules *metrics.ModuleMeter
+	bytes   dmetering.Meter // set by attach
+
+	blocks       uint64 // attributed so far
+	wasmTime     time.Duration
+	bytesRead    uint64
+	bytesWritten uint64
+	moduleDeltas *metrics.ModuleUsageDeltas
+}
+
+func newSharedUsage() *sharedUsage {
+	return &sharedUsage{
+		billing:      &billing.Usage{},
+		modules:      metrics.NewModuleMeter(),
+		bytes:        dmetering.NoopBytesMeter,
+		moduleDeltas: metrics.NewModuleUsageDeltas(),
+	}
+}
+
+// attach returns a copy of `ctx` accounting the usage of the shared pipeline
+// in `u` rather than in the accounting of the request it holds.
+func (u *sharedUsage) attach(ctx context.Context) context.Context {
+	ctx = dmetering.WithBytesMeter(ctx)
+	u.bytes = dmetering.GetBytesMeter(ctx)
+	ctx = billing.WithUsage(ctx, u.billing)
+	ctx = reqctx.WithModuleMeter(ctx, u.modules)
+	return withQuotaLease(ctx, nil)
+}
+
+// usageDelta is the usage of a shared pipeline between two blocks.
+type usageDelta struct {
+	blocks       uint64
+	wasmTime     time.Duration
+	bytesRead    uint64
+	bytesWritten uint64
+	modules      []metrics.ModuleUsage
+}
+
+// take returns the usage since the previous call.
+func (u *sharedUsage) take() (out usageDelta) {
+	blocks, wasmTime := u.billing.Totals()
+	bytesRead, bytesWritten := u.bytes.BytesRead(), u.bytes.BytesWritten()
+
+	out.blocks, out.wasmTime = blocks-u.blocks, wasmTime-u.wasmTime
+	out.bytesRead, out.bytesWritten = bytesRead-u.bytesRead, bytesWritten-u.bytesWritten
+	for _, usage := range u.modules.Changed() {
+		out.modules = append(out.modules, u.moduleDeltas.Of(usage))
+	}
+
+	u.blocks, u.wasmTime, u.bytesRead, u.bytesWritten = blocks, wasmTime, bytesRead, bytesWritten
+	return out
+}
+
+// usageAccount is the usage accounting of a request, where the usage of the
+// shared pipeline it subscribes to is added.
+type usageAccount struct {
+	billing *billing.Usage
+	bytes   dmetering.Meter
+	modules *metrics.ModuleMeter
+}
+
+func usageAccountFromContext(ctx context.Context) usageAccount {
+	return usageAccount{
+		billing: billing.UsageFromContext(ctx),
+		bytes:   dmetering.GetBytesMeter(ctx),
+		modules: reqctx.ModuleMeter(ctx),
+	}
+}
+
+func (a usageAccount) add(delta usageDelta) {
+	a.billing.AddBlocks(delta.blocks)
+	a.billing.AddWasmExecutionTime(delta.wasmTime)
+	if a.bytes != nil {
+		a.bytes.AddBytesRead(int(delta.bytesRead))
+		a.bytes.AddBytesWritten(int(delta.bytesWritten))
+	}
+	for _, usage := range delta.modules {
+		a.modules.Add(usage)
+	}
+}
+
+func isBlockResponse(resp *pbsubstreamsrpc.Response) bool {
+	return resp.GetBlockScopedData() != nil || resp.GetBlockUndoSignal() != nil
+}
+
+func responseCursor(resp *pbsubstreamsrpc.Response) string {
+	if data := resp.GetBlockScopedData(); data != nil {
+		return data.Cursor
+	}
+	return resp.GetBlockUndoSignal().GetLastValidCursor()
+}
+
+// detachedContext holds the values of its context, without its deadline and
+// cancellation.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool)         { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}               { return nil }
+func (detachedContext) Err() error                          { return nil }
+func (c detachedContext) Value(key interface{}) interface{} { return c.parent.Value(key) }
@@ -0,0 +1,243 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/streamingfast/substreams"
+	"github.com/streamingfast/substreams/billing"
+	"github.com/streamingfast/substreams/manifest"
+	"github.com/streamingfast/substreams/metrics"
+	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
+	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
+	"github.com/streamingfast/substreams/pipeline/outputmodules"
+	"github.com/streamingfast/substreams/reqctx"
+)
+
+func TestFanOutKey(t *testing.T) {
+	modules := &pbsubstreams.Modules{
+		Modules:  manifest.NewSimpleTestModules(),
+		Binaries: []*pbsubstreams.Binary{{Type: "wasm/rust-v1", Content: []byte{1}}},
+	}
+	graph, err := outputmodules.NewOutputModuleGraph("E", true, modules)
+	require.NoError(t, err)
+
+	live := func() *pbsubstreamsrpc.Request {
+		return &pbsubstreamsrpc.Request{OutputModule: "E", ProductionMode: true, StartBlockNum: -1}
+	}
+	details := func(capabilities ...string) *reqctx.RequestDetails {
+		return &reqctx.RequestDetails{ResolvedStartBlockNum: 100, LinearHandoffBlockNum: 100, Capabilities: capabilities}
+	}
+	key, ok := fanOutKey(live(), details("b", "a"), graph, 0, nil)
+	require.True(t, ok)
+	other, ok := fanOutKey(&pbsubstreamsrpc.Request{OutputModule: "E", ProductionMode: true, StartCursor: "c", OutputEncoding: pbsubstreamsrpc.OutputEncoding_OUTPUT_ENCODING_JSON}, details("a", "b"), graph, 0, nil)
+	require.True(t, ok)
+	assert.Equal(t, key, other, "start and encoding do not change the responses shared")
+
+	finalOnly := live()
+	finalOnly.FinalBlocksOnly = true
+	other, _ = fanOutKey(finalOnly, details("a", "b"), graph, 0, nil)
+	assert.NotEqual(t, key, other)
+
+	other, _ = fanOutKey(live(), details("a", "b"), graph, 10, nil)
+	assert.NotEqual(t, key, other, "output sampling")
+
+	for name, request := range map[string]func(r *pbsubstreamsrpc.Request){
+		"development mode": func(r *pbsubstreamsrpc.Request) { r.ProductionMode = false },
+		"stop block":       func(r *pbsubstreamsrpc.Request) { r.StopBlockNum = 100 },
+		"stop conditions":  func(r *pbsubstreamsrpc.Request) { r.StopConditions = &pbsubstreamsrpc.StopConditions{} },
+	} {
+		r := live()
+		request(r)
+		_, ok := fanOutKey(r, details(), graph, 0, nil)
+		assert.False(t, ok, name)
+	}
+	_, ok = fanOutKey(live(), details(), graph, 0, &pbsubstreamsrpc.BlockUndoSignal{})
+	assert.False(t, ok, "pending undo")
+	_, ok = fanOutKey(live(), &reqctx.RequestDetails{ResolvedStartBlockNum: 10, LinearHandoffBlockNum: 100}, graph, 0, nil)
+	assert.False(t, ok, "backprocessing")
+}
+
+func blockResponse(num uint64) *pbsubstreamsrpc.Response {
+	return &pbsubstreamsrpc.Response{Message: &pbsubstreamsrpc.Response_BlockScopedData{BlockScopedData: &pbsubstreamsrpc.BlockScopedData{
+		Clock:  &pbsubstreams.Clock{Number: num},
+		Cursor: fmt.Sprintf("cursor-%d", num),
+	}}}
+}
+
+// testSharedPipeline is run by the fan-out, sending the blocks pushed to it.
+type testSharedPipeline struct {
+	runs   chan struct{}
+	blocks chan uint64
+	ended  chan struct{}
+}
+
+func newTestSharedPipeline() *testSharedPipeline {
+	return &testSharedPipeline{runs: make(chan struct{}, 10), blocks: make(chan uint64), ended: make(chan struct{}, 10)}
+}
+
+func (p *testSharedPipeline) run(ctx context.Context, respFunc substreams.ResponseFunc) error {
+	p.runs <- struct{}{}
+	defer func() { p.ended <- struct{}{} }()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case num, ok := <-p.blocks:
+			if !ok {
+				return status.Error(codes.Internal, "pipeline failed")
+			}
+			if err := respFunc(blockResponse(num)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// collect serves a subscriber from the fan-out, sending the block numbers it
+// receives to the returned channel.
+func collect(ctx context.Context, f *fanOut, cursor string, startBlock uint64, p *testSharedPipeline) (chan uint64, chan error) {
+	received := make(chan uint64, 100)
+	done := make(chan error, 1)
+	go func() {
+		done <- f.serve(ctx, "key", cursor, startBlock, func(resp substreams.ResponseFromAnyTier) error {
+			received <- resp.(*pbsubstreamsrpc.Response).GetBlockScopedData().Clock.Number
+			return nil
+		}, p.run)
+	}()
+	return received, done
+}
+
+func receive(t *testing.T, received chan uint64, expected ...uint64) {
+	t.Helper()
+	for _, num := range expected {
+		select {
+		case got := <-received:
+			assert.Equal(t, num, got)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("block %d not received", num)
+		}
+	}
+}
+
+func TestFanOut(t *testing.T) {
+	terminating := make(chan struct{})
+	f := newFanOut(2, terminating)
+	p := newTestSharedPipeline()
+
+	firstCtx, cancelFirst := context.WithCancel(context.Background())
+	first, firstDone := collect(firstCtx, f, "", 10, p)
+	<-p.runs
+	p.blocks <- 10
+	p.blocks <- 11
+	p.blocks <- 12
+	receive(t, first, 10, 11, 12)
+
+	// replays the blocks after its cursor
+	byCursor, byCursorDone := collect(context.Background(), f, "cursor-11", 0, p)
+	receive(t, byCursor, 12)
+
+	// skips the blocks before its start block
+	byBlock, _ := collect(context.Background(), f, "", 12, p)
+	receive(t, byBlock, 12)
+
+	// not covered by the last 2 blocks: runs its own pipeline
+	own := newTestSharedPipeline()
+	ownCtx, cancelOwn := context.WithCancel(context.Background())
+	ownReceived, ownDone := collect(ownCtx, f, "", 10, own)
+	<-own.runs
+	own.blocks <- 10
+	receive(t, ownReceived, 10)
+	cancelOwn()
+	assert.ErrorIs(t, <-ownDone, context.Canceled)
+
+	// the shared pipeline outlives the subscriber starting it
+	cancelFirst()
+	assert.ErrorIs(t, <-firstDone, context.Canceled)
+	p.blocks <- 13
+	receive(t, byCursor, 13)
+	receive(t, byBlock, 13)
+
+	close(p.blocks)
+	assert.Equal(t, codes.Internal, status.Code(<-byCursorDone), "subscribers end with the error of the shared pipeline")
+	assert.Empty(t, p.runs, "a single shared pipeline")
+}
+
+func TestFanOut_LastSubscriberCancels(t *testing.T) {
+	f := newFanOut(2, make(chan struct{}))
+	p := newTestSharedPipeline()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, done := collect(ctx, f, "", 0, p)
+	<-p.runs
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+
+	select {
+	case <-p.ended:
+	case <-time.After(5 * time.Second):
+		t.Fatal("shared pipeline not canceled")
+	}
+	assert.Eventually(t, func() bool {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		return len(f.broadcasts) == 0
+	}, 5*time.Second, time.Millisecond)
+}
+
+func TestBroadcast_UsageAttributedToSubscribers(t *testing.T) {
+	b := newBroadcast(2)
+	ctx := b.usage.attach(context.Background())
+	shared := billing.UsageFromContext(ctx)
+
+	creator, joiner := &billing.Usage{}, &billing.Usage{}
+	creatorSub := b.subscribe(usageAccount{billing: creator})
+	shared.AddBlocks(1)
+	shared.AddWasmExecutionTime(time.Second)
+	reqctx.ModuleMeter(ctx).RecordExecution("A", time.Second, 2, 0)
+	require.NoError(t, b.send(blockResponse(10)))
+
+	joinerSub := b.join("cursor-10", 0, usageAccount{billing: joiner, modules: metrics.NewModuleMeter()})
+	require.NotNil(t, joinerSub)
+	b.leave(creatorSub)
+	shared.AddBlocks(1)
+	shared.AddWasmExecutionTime(2 * time.Second)
+	reqctx.ModuleMeter(ctx).RecordExecution("A", 2*time.Second, 3, 0)
+	require.NoError(t, b.send(blockResponse(11)))
+
+	blocks, wasmTime := creator.Totals()
+	assert.Equal(t, uint64(1), blocks)
+	assert.Equal(t, time.Second, wasmTime)
+
+	blocks, wasmTime = joiner.Totals()
+	assert.Equal(t, uint64(1), blocks, "charged the blocks sent after it joined, once the creator left")
+	assert.Equal(t, 2*time.Second, wasmTime)
+	assert.Equal(t, []metrics.ModuleUsage{{Module: "A", WasmExecution: 2 * time.Second, StoreOperations: 3}}, joinerSub.account.modules.Changed())
+}
+
+func TestBroadcast_SlowSubscriberDropped(t *testing.T) {
+	b := newBroadcast(1)
+	slow := b.subscribe(usageAccount{})
+	for i := 0; i < fanOutSubscriberBuffer; i++ {
+		require.NoError(t, b.send(blockResponse(uint64(i))))
+	}
+	assert.Len(t, b.subscribers, 1)
+
+	require.NoError(t, b.send(blockResponse(fanOutSubscriberBuffer)))
+	assert.Empty(t, b.subscribers)
+
+	var received int
+	err := slow.forward(context.Background(), func(resp substreams.ResponseFromAnyTier) error {
+		received++
+		return nil
+	})
+	assert.Equal(t, fanOutSubscriberBuffer, received, "the responses queued are sent first")
+	assert.Equal(t, errFanOutSubscriberTooSlow, err)
+}
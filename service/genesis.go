@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/streamingfast/bstream"
+	"github.com/streamingfast/dstore"
+	"go.uber.org/zap"
+)
+
+const (
+	genesisRetryBackoff    = 5 * time.Second
+	genesisRetryMaxBackoff = 5 * time.Minute
+)
+
+// genesisBlock reads the ID of the genesis block of the chain served, from the
+// first merged blocks file, the first time it is needed. The network declared
+// by the requests is checked against it, see manifest.ValidateNetwork.
+type genesisBlock struct {
+	mergedBlocksStore dstore.Store
+	now               func() time.Time
+
+	lock     sync.Mutex
+	id       string
+	resolved bool
+	reading  bool          // a call is reading the first merged blocks file
+	retryAt  time.Time     // no read before, the last one failed
+	backoff  time.Duration // before the next retry, doubled on each failure
+}
+
+func newGenesisBlock(mergedBlocksStore dstore.Store) *genesisBlock {
+	return &genesisBlock{mergedBlocksStore: mergedBlocksStore, now: time.Now}
+}
+
+// ID returns the ID of the genesis block, empty when the merged blocks don't
+// start at the genesis block or cannot be read. A single call reads it, the
+// others getting an empty ID meanwhile, without waiting. A failed read is
+// retried after a backoff, doubled on each failure up to
+// genesisRetryMaxBackoff.
+func (g *genesisBlock) ID(ctx context.Context, logger *zap.Logger) string {
+	if g == nil || g.mergedBlocksStore == nil || bstream.GetBlockReaderFactory == nil {
+		return ""
+	}
+
+	g.lock.Lock()
+	if g.resolved || g.reading || g.now().Before(g.retryAt) {
+		id := g.id
+		g.lock.Unlock()
+		return id
+	}
+	g.reading = true
+	g.lock.Unlock()
+
+	id, err := g.read(ctx)
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.reading = false
+	if err != nil {
+		g.backoff *= 2
+		if g.backoff < genesisRetryBackoff {
+			g.backoff = genesisRetryBackoff
+		}
+		if g.backoff > genesisRetryMaxBackoff {
+			g.backoff = genesisRetryMaxBackoff
+		}
+		g.retryAt = g.now().Add(g.backoff)
+		logger.Warn("cannot read the genesis block of the chain, the networks of the requests are not checked", zap.Duration("retry_in", g.backoff), zap.Error(err))
+		return ""
+	}
+	g.id, g.resolved = id, true
+	return id
+}
+
+func (g *genesisBlock) read(ctx context.Context) (string, error) {
+	reader, err := g.mergedBlocksStore.OpenObject(ctx, fmt.Sprintf("%010d", 0))
+	if err == dstore.ErrNotFound {
+		return "", nil // the chain is not served from its genesis block
+	}
+	if err != nil {
+		return "", fmt.Errorf("opening first merged blocks file: %w", err)
+	}
+	defer reader.Close()
+
+	blockReader, err := bstream.GetBlockReaderFactory.New(reader)
+	if err != nil {
+		return "", fmt.Errorf("reading first merged blocks file: %w", err)
+	}
+	blk, err := blockReader.Read()
+	if err != nil {
+		return "", fmt.Errorf("reading first block: %w", err)
+	}
+	if blk.Number != 0 {
+		return "", nil
+	}
+	return bstream.NormalizeBlockID(blk.Id), nil
+}
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/streamingfast/bstream"
+	"github.com/streamingfast/dstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestGenesisBlock(t *testing.T) {
+	previous := bstream.GetBlockReaderFactory
+	bstream.GetBlockReaderFactory = bstream.TestBlockReaderFactory
+	defer func() { bstream.GetBlockReaderFactory = previous }()
+
+	ctx := context.Background()
+	store := dstore.NewMockStore(nil)
+	genesis := newGenesisBlock(store)
+	assert.Equal(t, "", genesis.ID(ctx, zap.NewNop()), "merged blocks not starting at the genesis block")
+
+	store = dstore.NewMockStore(nil)
+	require.NoError(t, store.WriteObject(ctx, "0000000000", strings.NewReader(`{"id":"00000000aa","prev":""}`+"\n")))
+	genesis = newGenesisBlock(store)
+	assert.Equal(t, "00000000aa", genesis.ID(ctx, zap.NewNop()))
+
+	failing := dstore.NewMockStore(nil)
+	reads := 0
+	failing.OpenObjectFunc = func(ctx context.Context, name string) (io.ReadCloser, error) {
+		reads++
+		return nil, fmt.Errorf("unavailable")
+	}
+	now := time.Now()
+	genesis = newGenesisBlock(failing)
+	genesis.now = func() time.Time { return now }
+	assert.Equal(t, "", genesis.ID(ctx, zap.NewNop()))
+	assert.Equal(t, "", genesis.ID(ctx, zap.NewNop()))
+	assert.Equal(t, 1, reads, "failure cached until the backoff elapses")
+	now = now.Add(genesisRetryBackoff)
+	assert.Equal(t, "", genesis.ID(ctx, zap.NewNop()))
+	assert.Equal(t, 2, reads)
+	assert.Equal(t, 2*genesisRetryBackoff, genesis.backoff)
+
+	var unknown *genesisBlock
+	assert.Equal(t, "", unknown.ID(ctx, zap.NewNop()))
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	connect_go "github.com/bufbuild/connect-go"
+	dgrpcserver "github.com/streamingfast/dgrpc/server"
+	connectweb "github.com/streamingfast/dgrpc/server/connect-web"
+	"google.golang.org/grpc"
+	pbhealth "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const healthServicePath = "/grpc.health.v1.Health/"
+
+// unauthenticatedMethodPrefixes are the gRPC methods served without
+// authentication: the load balancers and the debugging tools (grpcurl)
+// probing the servers hold no credentials.
+var unauthenticatedMethodPrefixes = []string{
+	healthServicePath,
+	"/grpc.reflection.",
+}
+
+func isUnauthenticatedMethod(fullMethod string) bool {
+	for _, prefix := range unauthenticatedMethodPrefixes {
+		if strings.HasPrefix(fullMethod, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// skipAuthUnary applies `interceptor` to the methods requiring authentication.
+func skipAuthUnary(interceptor grpc.UnaryServerInterceptor) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if isUnauthenticatedMethod(info.FullMethod) {
+			return handler(ctx, req)
+		}
+		return interceptor(ctx, req, info, handler)
+	}
+}
+
+// skipAuthStream applies `interceptor` to the methods requiring authentication.
+func skipAuthStream(interceptor grpc.StreamServerInterceptor) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if isUnauthenticatedMethod(info.FullMethod) {
+			return handler(srv, ss)
+		}
+		return interceptor(srv, ss, info, handler)
+	}
+}
+
+// healthHandlerGetter serves the `grpc.health.v1.Health` service over connect
+// from `check`, the connect server of tier1 only serving it over HTTP
+// (`/healthz`). The handler options are ignored: they hold the authentication
+// interceptor.
+func healthHandlerGetter(check dgrpcserver.HealthCheck) connectweb.HandlerGetter {
+	health := dgrpcserver.NewHealthGRPCHandler(check)
+
+	return func(_ ...connect_go.HandlerOption) (string, http.Handler) {
+		mux := http.NewServeMux()
+		mux.Handle(healthServicePath+"Check", connect_go.NewUnaryHandler(
+			healthServicePath+"Check",
+			func(ctx context.Context, req *connect_go.Request[pbhealth.HealthCheckRequest]) (*connect_go.Response[pbhealth.HealthCheckResponse], error) {
+				resp, err := health.Check(ctx, req.Msg)
+				if err != nil {
+					return nil, err
+				}
+				return connect_go.NewResponse(resp), nil
+			},
+		))
+		mux.Handle(healthServicePath+"Watch", connect_go.NewServerStreamHandler(
+			healthServicePath+"Watch",
+			func(ctx context.Context, req *connect_go.Request[pbhealth.HealthCheckRequest], stream *connect_go.ServerStream[pbhealth.HealthCheckResponse]) error {
+				return health.Watch(req.Msg, &healthWatchStream{ctx: ctx, stream: stream})
+			},
+		))
+		return healthServicePath, mux
+	}
+}
+
+// healthWatchStream adapts a connect stream to the gRPC stream expected by
+// dgrpcserver.HealthGRPCHandler.Watch, which only uses Context and Send.
+type healthWatchStream struct {
+	grpc.ServerStream
+
+	ctx    context.Context
+	stream *connect_go.ServerStream[pbhealth.HealthCheckResponse]
+}
+
+func (s *healthWatchStream) Context() context.Context { return s.ctx }
+
+func (s *healthWatchStream) Send(resp *pbhealth.HealthCheckResponse) error {
+	return s.stream.Send(resp)
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
+	"github.com/streamingfast/substreams/wasm"
+	"github.com/streamingfast/substreams/wasm/wasmimports"
+)
+
+// validateHostFunctions rejects the modules whose binary declares, or imports,
+// host functions neither built in the runtimes nor provided by `extensions`,
+// which would fail to instantiate once the request is running. The binaries
+// which cannot be read are left to the runtime to reject.
+func validateHostFunctions(modules *pbsubstreams.Modules, usedModules []*pbsubstreams.Module, extensions []wasm.WASMExtensioner) error {
+	checked := make(map[uint32]bool)
+	for _, module := range usedModules {
+		if checked[module.BinaryIndex] {
+			continue
+		}
+		checked[module.BinaryIndex] = true
+		binary := modules.Binaries[module.BinaryIndex]
+
+		if namespaces := wasm.UnsupportedNamespaces(binary.Imports, extensions); len(namespaces) != 0 {
+			return &missingDependencyError{
+				module: module.Name,
+				reason: fmt.Sprintf("module %q declares host functions not supported by this endpoint: %s", module.Name, strings.Join(namespaces, ", ")),
+			}
+		}
+
+		unsupported, err := wasm.UnsupportedImports(binary.Content, extensions)
+		if err != nil || len(unsupported) == 0 {
+			continue
+		}
+
+		names := make([]string, len(unsupported))
+		for i, imp := range unsupported {
+			names[i] = imp.String()
+		}
+		return &missingDependencyError{
+			module: module.Name,
+			reason: fmt.Sprintf("module %q imports host functions not supported by this endpoint: %s", module.Name, strings.Join(names, ", ")),
+		}
+	}
+	return nil
+}
+
+// blockIsFinalModules returns the modules of `usedModules` whose binary imports
+// the `block::is_final` host function, and the modules depending on them: their
+// outputs and stores depend on when the blocks are processed, see
+// reqctx.RequestDetails.UncachedModules.
+func blockIsFinalModules(modules *pbsubstreams.Modules, usedModules []*pbsubstreams.Module) map[string]bool {
+	out := make(map[string]bool)
+	for _, module := range usedModules {
+		imports, _ := wasmimports.FunctionImports(modules.Binaries[module.BinaryIndex].Content)
+		for _, imp := range imports {
+			if imp.Namespace == "block" && imp.Name == "is_final" {
+				out[module.Name] = true
+				break
+			}
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for _, module := range usedModules {
+			if out[module.Name] {
+				continue
+			}
+			for _, input := range module.Inputs {
+				if out[input.GetMap().GetModuleName()] || out[input.GetStore().GetModuleName()] {
+					out[module.Name] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
+)
+
+// isFinalModule imports the function `block::is_final`.
+var isFinalModule = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00,
+	// types: () -> i32
+	0x01, 0x05, 0x01, 0x60, 0x00, 0x01, 0x7f,
+	// imports
+	0x02, 0x12, 0x01,
+	0x05, 'b', 'l', 'o', 'c', 'k', 0x08, 'i', 's', '_', 'f', 'i', 'n', 'a', 'l', 0x00, 0x00,
+}
+
+func TestBlockIsFinalModules(t *testing.T) {
+	mapInput := func(name string) *pbsubstreams.Module_Input {
+		return &pbsubstreams.Module_Input{Input: &pbsubstreams.Module_Input_Map_{Map: &pbsubstreams.Module_Input_Map{ModuleName: name}}}
+	}
+	storeInput := func(name string) *pbsubstreams.Module_Input {
+		return &pbsubstreams.Module_Input{Input: &pbsubstreams.Module_Input_Store_{Store: &pbsubstreams.Module_Input_Store{ModuleName: name}}}
+	}
+
+	modules := &pbsubstreams.Modules{
+		Binaries: []*pbsubstreams.Binary{
+			{Content: []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}},
+			{Content: isFinalModule},
+		},
+	}
+	used := []*pbsubstreams.Module{
+		{Name: "output", BinaryIndex: 0, Inputs: []*pbsubstreams.Module_Input{storeInput("store_final"), mapInput("plain")}},
+		{Name: "store_final", BinaryIndex: 0, Inputs: []*pbsubstreams.Module_Input{mapInput("map_final")}},
+		{Name: "map_final", BinaryIndex: 1},
+		{Name: "plain", BinaryIndex: 0},
+	}
+
+	assert.Equal(t, map[string]bool{"map_final": true, "store_final": true, "output": true}, blockIsFinalModules(modules, used))
+	assert.Nil(t, blockIsFinalModules(modules, used[3:]))
+}
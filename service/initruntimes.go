@@ -1,6 +1,6 @@
 package service
 
 import (
-	_ "github.com/streamingfast/substreams/wasm/wasmtime"
+	_ "github.com/streamingfast/substreams/wasm/hostfunctions"
 	_ "github.com/streamingfast/substreams/wasm/wazero"
 )
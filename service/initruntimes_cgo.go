@@ -0,0 +1,9 @@
+//go:build cgo
+
+package service
+
+// The wasmtime runtime binds its C library, it is left out of the builds
+// without cgo, wazero being pure Go.
+import (
+	_ "github.com/streamingfast/substreams/wasm/wasmtime"
+)
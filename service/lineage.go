@@ -0,0 +1,21 @@
+package service
+
+import (
+	"github.com/streamingfast/dstore"
+
+	"github.com/streamingfast/substreams/pipeline/outputmodules"
+	"github.com/streamingfast/substreams/storage/lineage"
+)
+
+// withLineage returns the state store of a request running the modules of
+// `graph`, serving the caches of the modules declaring an output compatibility
+// from the caches of the compatible modules, see package `lineage`.
+func withLineage(stateStore dstore.Store, graph *outputmodules.Graph) dstore.Store {
+	return lineage.NewStore(stateStore, lineageLinks(graph))
+}
+
+// lineageLinks returns the output compatibilities declared by the modules of
+// `graph`, by their own hash.
+func lineageLinks(graph *outputmodules.Graph) map[string]lineage.Link {
+	return lineage.Links(graph.UsedModules(), graph.ModuleHashes().Get)
+}
@@ -4,11 +4,18 @@ import (
 	"context"
 	"time"
 
+	"github.com/streamingfast/dauth"
 	"github.com/streamingfast/dmetering"
 	"google.golang.org/protobuf/proto"
+
+	"github.com/streamingfast/substreams/billing"
+	"github.com/streamingfast/substreams/pipeline/outputencoding"
 )
 
-func sendMetering(meter dmetering.Meter, userID, apiKeyID, ip, endpoint string, resp proto.Message) {
+// sendMetering emits the metering event of `resp`, with the cost of
+// re-encoding its outputs when `encoded` is set (see Request.output_encoding):
+// the time spent and the bytes produced, per encoding.
+func sendMetering(meter dmetering.Meter, userID, apiKeyID, ip, endpoint string, resp proto.Message, encoder *outputencoding.Encoder, encoded *outputencoding.Stats) {
 	bytesRead := meter.BytesReadDelta()
 	bytesWritten := meter.BytesWrittenDelta()
 
@@ -25,7 +32,22 @@ func sendMetering(meter dmetering.Meter, userID, apiKeyID, ip, endpoint string,
 		},
 		Timestamp: time.Now(),
 	}
+	if encoded != nil && encoded.Outputs != 0 {
+		event.Metrics["output_encoding_ns"] = float64(encoded.Duration.Nanoseconds())
+		event.Metrics[encoder.Name()+"_encoded_bytes"] = float64(encoded.Bytes)
+	}
 
 	// we send metering even if context is canceled
 	dmetering.Emit(context.Background(), event)
 }
+
+// billingRequest identifies the request `requestID` of `ctx`, served by
+// `endpoint`, in its billing events.
+func billingRequest(ctx context.Context, requestID, endpoint string) billing.Request {
+	request := billing.Request{ID: requestID, Endpoint: endpoint}
+	if auth := dauth.FromContext(ctx); auth != nil {
+		request.APIKeyID = auth.APIKeyID()
+		request.UserID = auth.UserID()
+	}
+	return request
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/streamingfast/substreams"
+	"github.com/streamingfast/substreams/metrics"
+	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
+	"github.com/streamingfast/substreams/reqctx"
+)
+
+// moduleStatsInterval is the interval between the `ModuleStats` progress
+// messages of a module whose usage changed.
+var moduleStatsInterval = time.Second
+
+// startModuleStats sends the usage of the modules accounted by `meter` to the
+// client every moduleStatsInterval, the modules whose usage did not change
+// being skipped. The stop function returned sends the usage left, it must be
+// called before the stream ends.
+func startModuleStats(ctx context.Context, meter *metrics.ModuleMeter, respFunc substreams.ResponseFunc) (stop func()) {
+	send := func() {
+		changed := meter.Changed()
+		if len(changed) == 0 {
+			return
+		}
+		if err := respFunc(toModuleStatsResponse(changed)); err != nil {
+			reqctx.Logger(ctx).Debug("unable to send module stats", zap.Error(err))
+		}
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(moduleStatsInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				send()
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+		if ctx.Err() == nil {
+			send()
+		}
+	}
+}
+
+func toModuleStatsResponse(usages []metrics.ModuleUsage) *pbsubstreamsrpc.Response {
+	modules := make([]*pbsubstreamsrpc.ModuleProgress, len(usages))
+	for i, usage := range usages {
+		modules[i] = &pbsubstreamsrpc.ModuleProgress{
+			Name: usage.Module,
+			Type: &pbsubstreamsrpc.ModuleProgress_ModuleStats_{
+				ModuleStats: &pbsubstreamsrpc.ModuleProgress_ModuleStats{
+					WasmExecutionNs:    uint64(usage.WasmExecution.Nanoseconds()),
+					StoreOperations:    usage.StoreOperations,
+					StorePeakSizeBytes: usage.StorePeakSizeBytes,
+				},
+			},
+		}
+	}
+	return substreams.NewModulesProgressResponse(modules)
+}
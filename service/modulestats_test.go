@@ -0,0 +1,45 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/streamingfast/substreams"
+	"github.com/streamingfast/substreams/metrics"
+	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
+)
+
+func TestStartModuleStats(t *testing.T) {
+	defer func(interval time.Duration) { moduleStatsInterval = interval }(moduleStatsInterval)
+	moduleStatsInterval = time.Millisecond
+
+	var mu sync.Mutex
+	var sent []*pbsubstreamsrpc.ModuleProgress
+	respFunc := func(resp substreams.ResponseFromAnyTier) error {
+		mu.Lock()
+		defer mu.Unlock()
+		sent = append(sent, resp.(*pbsubstreamsrpc.Response).GetProgress().Modules...)
+		return nil
+	}
+
+	meter := metrics.NewModuleMeter()
+	stop := startModuleStats(context.Background(), meter, respFunc)
+	meter.Add(metrics.ModuleUsage{Module: "store_b", WasmExecution: time.Second, StoreOperations: 3, StorePeakSizeBytes: 100})
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(sent) == 1
+	}, 5*time.Second, time.Millisecond)
+
+	meter.Add(metrics.ModuleUsage{Module: "store_b", StoreOperations: 1})
+	stop()
+
+	require.Len(t, sent, 2, "the usage left is sent when stopping")
+	assert.Equal(t, "store_b", sent[1].Name)
+	assert.Equal(t, &pbsubstreamsrpc.ModuleProgress_ModuleStats{WasmExecutionNs: uint64(time.Second), StoreOperations: 4, StorePeakSizeBytes: 100}, sent[1].GetModuleStats(), "totals of the request")
+}
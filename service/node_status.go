@@ -0,0 +1,217 @@
+package service
+
+import (
+	"context"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/streamingfast/dstore"
+	"go.uber.org/atomic"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/streamingfast/substreams/metrics"
+	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
+	"github.com/streamingfast/substreams/reqctx"
+)
+
+// storageProbeTimeout bounds the time spent probing each storage backend.
+const storageProbeTimeout = 5 * time.Second
+
+// activeRequests tracks the `Blocks` requests being served by tier1, for
+// GetNodeStatus.
+type activeRequests struct {
+	lock     sync.Mutex
+	requests map[string]*activeRequest // by request ID
+}
+
+type activeRequest struct {
+	status    *pbsubstreamsrpc.ActiveRequest // fields set at registration only
+	startedAt time.Time
+
+	lastBlock     atomic.Uint64
+	blocksSent    atomic.Uint64
+	queuePosition atomic.Uint64
+	lastCursor    atomic.String
+
+	reload *moduleReload // nil unless the modules of the request can be reloaded, see ReloadModule
+}
+
+func newActiveRequests() *activeRequests {
+	return &activeRequests{requests: map[string]*activeRequest{}}
+}
+
+// add registers a request until `remove` is called with its request ID. The
+// request ID is unique on the node, unlike the trace ID which can be set by
+// the client.
+func (r *activeRequests) add(status *pbsubstreamsrpc.ActiveRequest) *activeRequest {
+	req := &activeRequest{status: status, startedAt: time.Now()}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.requests[status.RequestId] = req
+	return req
+}
+
+func (r *activeRequests) get(requestID string) *activeRequest {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.requests[requestID]
+}
+
+func (r *activeRequests) remove(requestID string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.requests, requestID)
+}
+
+// snapshot returns the status of the active requests of `userID`, or of all
+// the users if `allUsers`, the oldest first.
+func (r *activeRequests) snapshot(userID string, allUsers bool) []*pbsubstreamsrpc.ActiveRequest {
+	r.lock.Lock()
+	requests := make([]*activeRequest, 0, len(r.requests))
+	for _, req := range r.requests {
+		if allUsers || req.status.UserId == userID {
+			requests = append(requests, req)
+		}
+	}
+	r.lock.Unlock()
+
+	sort.Slice(requests, func(i, j int) bool { return requests[i].startedAt.Before(requests[j].startedAt) })
+	out := make([]*pbsubstreamsrpc.ActiveRequest, len(requests))
+	for i, req := range requests {
+		status := proto.Clone(req.status).(*pbsubstreamsrpc.ActiveRequest)
+		status.LastBlock = req.lastBlock.Load()
+		status.BlocksSent = req.blocksSent.Load()
+		status.QueuePosition = req.queuePosition.Load()
+		status.RunningMs = uint64(time.Since(req.startedAt).Milliseconds())
+		out[i] = status
+	}
+	return out
+}
+
+// observe records the progress of the request from the responses sent to
+// its client.
+func (r *activeRequest) observe(resp *pbsubstreamsrpc.Response) {
+	if data := resp.GetBlockScopedData(); data != nil {
+		r.lastBlock.Store(data.Clock.GetNumber())
+		r.blocksSent.Inc()
+		r.lastCursor.Store(data.Cursor)
+	}
+}
+
+// GetNodeStatus reports the state of this node in a single call, for the
+// operators dashboards polling it. The requests of the other users are only
+// reported to the operators of the node, see WithNodeStatus.
+func (s *Tier1Service) GetNodeStatus(
+	ctx context.Context,
+	req *connect.Request[pbsubstreamsrpc.NodeStatusRequest],
+) (*connect.Response[pbsubstreamsrpc.NodeStatusResponse], error) {
+	if !s.nodeStatusEnabled {
+		return nil, status.Error(codes.Unimplemented, "node status is not enabled on this endpoint")
+	}
+	reqctx.Logger(ctx).Debug("incoming Substreams GetNodeStatus request")
+	caller := userID(ctx)
+
+	out := &pbsubstreamsrpc.NodeStatusResponse{
+		ActiveRequests: s.activeRequests.snapshot(caller, s.nodeStatusOperators[caller]),
+		WorkerPool: &pbsubstreamsrpc.WorkerPoolStatus{
+			Workers:           uint64(metrics.Value(metrics.WorkerPoolSize)),
+			RunningJobs:       uint64(metrics.Value(metrics.RunningJobs)),
+			ReadyJobs:         uint64(metrics.Value(metrics.ReadyJobs)),
+			WaitingJobs:       uint64(metrics.Value(metrics.WaitingJobs)),
+			PendingMergeBytes: uint64(metrics.Value(metrics.PendingMergeBytes)),
+			QueuedRequests:    uint64(metrics.Value(metrics.QueuedRequests)),
+		},
+		Storages: []*pbsubstreamsrpc.StorageStatus{
+			probeStorage(ctx, "state_store", s.runtimeConfig.BaseObjectStore),
+			probeStorage(ctx, "merged_blocks_store", s.mergedBlocksStore),
+		},
+		Caches: []*pbsubstreamsrpc.CacheStatus{
+			blockCacheStatus(),
+		},
+		Gc: gcStatus(),
+		BackgroundTasks: []*pbsubstreamsrpc.BackgroundTaskStatus{
+			{
+				Name: "partial_reaper",
+				Values: map[string]uint64{
+					"orphaned_files": uint64(metrics.Value(metrics.PartialReaperOrphanedFiles)),
+					"deleted_files":  uint64(metrics.Value(metrics.PartialReaperDeletedFiles)),
+					"errors":         uint64(metrics.Value(metrics.PartialReaperErrors)),
+				},
+			},
+			{
+				Name: "execout_pruner",
+				Values: map[string]uint64{
+					"segments":         uint64(metrics.Value(metrics.ExecOutPrunerSegments)),
+					"expired_segments": uint64(metrics.Value(metrics.ExecOutPrunerExpiredSegments)),
+					"deleted_segments": uint64(metrics.Value(metrics.ExecOutPrunerDeletedSegments)),
+					"deleted_blobs":    uint64(metrics.Value(metrics.ExecOutPrunerDeletedBlobs)),
+					"errors":           uint64(metrics.Value(metrics.ExecOutPrunerErrors)),
+				},
+			},
+		},
+	}
+	return connect.NewResponse(out), nil
+}
+
+// probeStorage measures the latency of a single object lookup in `store`,
+// the object looked up needs not exist.
+func probeStorage(ctx context.Context, name string, store dstore.Store) *pbsubstreamsrpc.StorageStatus {
+	out := &pbsubstreamsrpc.StorageStatus{Name: name}
+	if store == nil {
+		out.Error = "not configured"
+		return out
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, storageProbeTimeout)
+	defer cancel()
+
+	start := time.Now()
+	_, err := store.FileExists(ctx, "substreams-node-status-probe")
+	out.LatencyMs = uint64(time.Since(start).Milliseconds())
+	if err != nil {
+		out.Error = err.Error()
+	}
+	return out
+}
+
+// blockCacheStatus reports the tier2 block cache lookups of this process,
+// none when tier2 runs in other processes.
+func blockCacheStatus() *pbsubstreamsrpc.CacheStatus {
+	byResult := metrics.ValuesByLabel(metrics.BlockCacheRequests, "result")
+	out := &pbsubstreamsrpc.CacheStatus{
+		Name:   "tier2_block_cache",
+		Hits:   uint64(byResult["memory_hit"] + byResult["disk_hit"] + byResult["coalesced"]),
+		Misses: uint64(byResult["miss"]),
+	}
+	if total := out.Hits + out.Misses; total != 0 {
+		out.HitRate = float64(out.Hits) / float64(total)
+	}
+	return out
+}
+
+func gcStatus() *pbsubstreamsrpc.GCStatus {
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	var gcStats debug.GCStats
+	debug.ReadGCStats(&gcStats)
+
+	out := &pbsubstreamsrpc.GCStatus{
+		NumGc:          memStats.NumGC,
+		PauseTotalMs:   uint64(gcStats.PauseTotal.Milliseconds()),
+		HeapAllocBytes: memStats.HeapAlloc,
+		HeapSysBytes:   memStats.HeapSys,
+		NextGcBytes:    memStats.NextGC,
+		Goroutines:     uint64(runtime.NumGoroutine()),
+	}
+	if !gcStats.LastGC.IsZero() {
+		out.LastGcAgoMs = uint64(time.Since(gcStats.LastGC).Milliseconds())
+	}
+	return out
+}
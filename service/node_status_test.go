@@ -0,0 +1,32 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
+)
+
+func TestActiveRequests(t *testing.T) {
+	requests := newActiveRequests()
+	requests.add(&pbsubstreamsrpc.ActiveRequest{RequestId: "1", TraceId: "trace", UserId: "alice"})
+	requests.add(&pbsubstreamsrpc.ActiveRequest{RequestId: "2", TraceId: "trace", UserId: "bob"})
+
+	assert.Equal(t, "alice", requests.get("1").status.UserId, "requests sharing a trace ID are kept apart")
+	assert.Equal(t, "bob", requests.get("2").status.UserId)
+
+	ids := func(statuses []*pbsubstreamsrpc.ActiveRequest) (out []string) {
+		for _, status := range statuses {
+			out = append(out, status.RequestId)
+		}
+		return out
+	}
+	assert.Equal(t, []string{"1"}, ids(requests.snapshot("alice", false)))
+	assert.Empty(t, requests.snapshot("carol", false))
+	assert.ElementsMatch(t, []string{"1", "2"}, ids(requests.snapshot("carol", true)))
+
+	requests.remove("1")
+	assert.Nil(t, requests.get("1"))
+	assert.NotNil(t, requests.get("2"))
+}
@@ -1,7 +1,19 @@
 package service
 
 import (
+	"time"
+
+	"github.com/streamingfast/dstore"
+
+	"github.com/streamingfast/substreams/billing"
+	"github.com/streamingfast/substreams/metrics"
+	"github.com/streamingfast/substreams/orchestrator/work"
 	"github.com/streamingfast/substreams/pipeline"
+	"github.com/streamingfast/substreams/service/blockcache"
+	"github.com/streamingfast/substreams/storage/execout"
+	"github.com/streamingfast/substreams/storage/idempotency"
+	"github.com/streamingfast/substreams/storage/layout"
+	"github.com/streamingfast/substreams/storage/store"
 	"github.com/streamingfast/substreams/wasm"
 )
 
@@ -57,6 +69,9 @@ func WithRequestStats() Option {
 	}
 }
 
+// WithMaxWasmFuelPerBlockModule stops the executions of a module on a single
+// block consuming more than `maxFuel`, like WithModuleExecutionTimeout. Fuel is
+// only metered by the wasmtime runtime.
 func WithMaxWasmFuelPerBlockModule(maxFuel uint64) Option {
 	return func(a anyTierService) {
 		switch s := a.(type) {
@@ -68,6 +83,20 @@ func WithMaxWasmFuelPerBlockModule(maxFuel uint64) Option {
 	}
 }
 
+// WithModuleExecutionTimeout stops the executions of a module on a single block
+// taking longer than `timeout`, failing the request with a `Failed` progress
+// message naming the limit, so that a pathological module can't wedge a worker.
+func WithModuleExecutionTimeout(timeout time.Duration) Option {
+	return func(a anyTierService) {
+		switch s := a.(type) {
+		case *Tier1Service:
+			s.runtimeConfig.ModuleExecutionTimeout = timeout
+		case *Tier2Service:
+			s.runtimeConfig.ModuleExecutionTimeout = timeout
+		}
+	}
+}
+
 func WithModuleExecutionTracing() Option {
 	return func(a anyTierService) {
 		switch s := a.(type) {
@@ -78,3 +107,626 @@ func WithModuleExecutionTracing() Option {
 		}
 	}
 }
+
+// WithJobPriority replaces the default priority of the jobs scheduled by tier1
+// when backprocessing by the one returned by `priority`, higher running first.
+// It has no effect on tier2.
+func WithJobPriority(priority func(*work.Job) int) Option {
+	return func(a anyTierService) {
+		switch s := a.(type) {
+		case *Tier1Service:
+			s.runtimeConfig.JobPriority = priority
+		}
+	}
+}
+
+// WithMaxConcurrentJobsPerModule limits the number of jobs of a single module
+// that tier1 runs at the same time when backprocessing, so that heavy modules
+// don't occupy all the tier2 workers while lighter modules wait. 0 means no
+// limit. It has no effect on tier2.
+func WithMaxConcurrentJobsPerModule(max uint64) Option {
+	return func(a anyTierService) {
+		switch s := a.(type) {
+		case *Tier1Service:
+			s.runtimeConfig.MaxConcurrentJobsPerModule = max
+		}
+	}
+}
+
+// WithMaxConcurrentSquashes limits the number of partial stores that tier1
+// merges at the same time for a single request, across its store modules, to
+// bound the memory and CPU taken by the squashing. 0 means no limit. It has no
+// effect on tier2.
+func WithMaxConcurrentSquashes(max uint64) Option {
+	return func(a anyTierService) {
+		switch s := a.(type) {
+		case *Tier1Service:
+			s.runtimeConfig.MaxConcurrentSquashes = max
+		}
+	}
+}
+
+// WithSquashLoadParallelism makes tier1 download and decode up to `parallelism`
+// partial stores of a store module at the same time, ahead of the one being
+// merged, to cut the squashing latency of deep backfills. The partial stores
+// loaded ahead are held in memory outside of the merge slots bounded by
+// WithMaxConcurrentSquashes. It has no effect on tier2.
+func WithSquashLoadParallelism(parallelism uint64) Option {
+	return func(a anyTierService) {
+		switch s := a.(type) {
+		case *Tier1Service:
+			s.runtimeConfig.SquashLoadParallelism = parallelism
+		}
+	}
+}
+
+// WithStoreJobsProduceOutputs makes the store jobs dispatched by tier1 also
+// produce the outputs of the output map module over their range when all the
+// stores it needs are complete up to the start of that range, instead of
+// running a separate job for it that executes the same dependencies again.
+// The tier2 servers must support the `cached_output_module` of the
+// ProcessRangeRequest, older ones only produce the store. It has no effect on
+// tier2.
+func WithStoreJobsProduceOutputs() Option {
+	return func(a anyTierService) {
+		switch s := a.(type) {
+		case *Tier1Service:
+			s.runtimeConfig.StoreJobsProduceOutputs = true
+		}
+	}
+}
+
+// WithDevModeDiscardOutputs makes the jobs dispatched by tier1 for the
+// development mode requests discard their execution outputs instead of writing
+// them to the outputs cache: nobody replays the outputs of these requests, and
+// not writing them spares the shared buckets. The tier2
+// servers must support the `discard_outputs` of the ProcessRangeRequest,
+// older ones still write them. It has no effect on tier2.
+func WithDevModeDiscardOutputs() Option {
+	return func(a anyTierService) {
+		switch s := a.(type) {
+		case *Tier1Service:
+			s.runtimeConfig.DevModeDiscardOutputs = true
+		}
+	}
+}
+
+// WithMaxConcurrentCPUHeavyModules limits the number of modules with the
+// `cpu_heavy` execution hint executing at the same time, across all the
+// requests of the process, when the modules of a stage run in parallel.
+// Modules hinted `io_bound` and those without a hint are not limited. 0 means
+// no limit.
+func WithMaxConcurrentCPUHeavyModules(max uint64) Option {
+	return func(a anyTierService) {
+		if max == 0 {
+			return
+		}
+		slots := make(chan struct{}, max)
+		switch s := a.(type) {
+		case *Tier1Service:
+			s.runtimeConfig.CPUHeavyModuleSlots = slots
+		case *Tier2Service:
+			s.runtimeConfig.CPUHeavyModuleSlots = slots
+		}
+	}
+}
+
+// WithMaxPendingMergeBytes slows down the dispatch of the jobs of a request by
+// tier1 while the partial stores written and not merged yet by its squashers
+// exceed `max` bytes, so they do not pile up when the squashers cannot keep up.
+// 0 means no backpressure. It has no effect on tier2.
+func WithMaxPendingMergeBytes(max uint64) Option {
+	return func(a anyTierService) {
+		switch s := a.(type) {
+		case *Tier1Service:
+			s.runtimeConfig.MaxPendingMergeBytes = max
+		}
+	}
+}
+
+// WithSchedulerEventLog makes tier1 record the decisions of its scheduler (jobs
+// dispatched, completed, retried, preempted, squashes triggered) for each request
+// in the state store, under the request's trace ID, see `substreams tools
+// scheduler-timeline`. It has no effect on tier2.
+func WithSchedulerEventLog() Option {
+	return func(a anyTierService) {
+		switch s := a.(type) {
+		case *Tier1Service:
+			s.runtimeConfig.SchedulerEventLog = true
+		}
+	}
+}
+
+// WithPackageStats makes tier1 aggregate the orchestration of its requests
+// (jobs run, segments produced, their duration, the blocks read from the
+// caches) by package in `stats`, exported by metrics.PackageStats.Run. It has
+// no effect on tier2.
+func WithPackageStats(stats *metrics.PackageStats) Option {
+	return func(a anyTierService) {
+		switch s := a.(type) {
+		case *Tier1Service:
+			s.runtimeConfig.PackageStats = stats
+		}
+	}
+}
+
+// WithPlanCheckpoints makes tier1 checkpoint its work plan in the state store
+// while backprocessing, so that a request sent again after a tier1 restart
+// resumes from the checkpoint instead of planning the work from scratch,
+// unless it was saved longer than `maxAge` ago. It has no effect on tier2.
+func WithPlanCheckpoints(maxAge time.Duration) Option {
+	return func(a anyTierService) {
+		switch s := a.(type) {
+		case *Tier1Service:
+			s.runtimeConfig.PlanCheckpoints = true
+			s.runtimeConfig.PlanCheckpointMaxAge = maxAge
+		}
+	}
+}
+
+// WithThroughputStats makes tier1 persist, at the end of each backprocessing, the
+// throughput measured for the jobs of each module in the state store, keyed by
+// module hash, and load it in the work plans of the following requests. It has
+// no effect on tier2.
+func WithThroughputStats() Option {
+	return func(a anyTierService) {
+		switch s := a.(type) {
+		case *Tier1Service:
+			s.runtimeConfig.ThroughputStats = true
+		}
+	}
+}
+
+// WithAdaptiveJobDuration makes tier1 size the backprocessing jobs of each module
+// so that they take about `duration`, from the throughput measured for the module
+// (see WithThroughputStats): slow modules get smaller jobs and cheap ones larger
+// jobs. Modules without measured throughput keep the default job size. It has no
+// effect on tier2.
+func WithAdaptiveJobDuration(duration time.Duration) Option {
+	return func(a anyTierService) {
+		switch s := a.(type) {
+		case *Tier1Service:
+			s.runtimeConfig.AdaptiveJobDuration = duration
+		}
+	}
+}
+
+// WithWorkerPoolAutoscaler makes tier1 resize the backprocessing worker pool of
+// each request with `autoscaler`, from the jobs of the request queued by stage,
+// between 1 worker and the parallel jobs allowed to the request. The demand of
+// all requests is also published in the `substreams_tier1_*_jobs` metrics, to
+// scale the tier2 fleet from. It has no effect on tier2.
+func WithWorkerPoolAutoscaler(autoscaler work.Autoscaler) Option {
+	return func(a anyTierService) {
+		switch s := a.(type) {
+		case *Tier1Service:
+			s.runtimeConfig.WorkerPoolAutoscaler = autoscaler
+		}
+	}
+}
+
+// WithModuleExecutionBudget reports the modules whose execution on a single block
+// exceeded `budget` on `repeat` blocks, through a warning log, the
+// `substreams_module_slow_blocks` metric and a `SlowExecution` progress message
+// naming the blocks.
+func WithModuleExecutionBudget(budget time.Duration, repeat uint64) Option {
+	return func(a anyTierService) {
+		switch s := a.(type) {
+		case *Tier1Service:
+			s.runtimeConfig.ModuleExecutionBudget = budget
+			s.runtimeConfig.ModuleExecutionBudgetRepeat = repeat
+		case *Tier2Service:
+			s.runtimeConfig.ModuleExecutionBudget = budget
+			s.runtimeConfig.ModuleExecutionBudgetRepeat = repeat
+		}
+	}
+}
+
+// WithDisabledCapabilities prevents negotiating `capabilities` with the clients,
+// so that the behaviors they enable can be rolled back without redeploying. It
+// has no effect on tier2, capabilities being negotiated by tier1.
+func WithDisabledCapabilities(capabilities []string) Option {
+	return func(a anyTierService) {
+		switch s := a.(type) {
+		case *Tier1Service:
+			s.runtimeConfig.DisabledCapabilities = capabilities
+		}
+	}
+}
+
+// WithNodeStatus serves GetNodeStatus, reporting the state of the node and the
+// requests of the caller, or of all the users when the caller's user ID is one
+// of `operators`. It has no effect on tier2.
+func WithNodeStatus(operators []string) Option {
+	return func(a anyTierService) {
+		switch s := a.(type) {
+		case *Tier1Service:
+			s.nodeStatusEnabled = true
+			s.nodeStatusOperators = make(map[string]bool, len(operators))
+			for _, operator := range operators {
+				if operator != "" {
+					s.nodeStatusOperators[operator] = true
+				}
+			}
+		}
+	}
+}
+
+// WithModuleReload serves ReloadModule, replacing the code of a module of the
+// development mode requests being served. It has no effect on tier2.
+func WithModuleReload() Option {
+	return func(a anyTierService) {
+		switch s := a.(type) {
+		case *Tier1Service:
+			s.moduleReload = true
+		}
+	}
+}
+
+// WithMaxConcurrentRequests limits the requests served at the same time by
+// tier1 to `maxActive`, up to `maxQueued` requests over it wait for one to
+// complete and the others are rejected. It has no effect on tier2.
+func WithMaxConcurrentRequests(maxActive, maxQueued uint64) Option {
+	return func(a anyTierService) {
+		switch s := a.(type) {
+		case *Tier1Service:
+			s.admission = newRequestAdmission(maxActive, maxQueued)
+		}
+	}
+}
+
+// WithRequestChunkSize makes tier1 serve the requests whose backprocessing
+// spans more than `blocks` blocks in sequential chunks of that many blocks,
+// rounded up to the cache save interval, releasing the backprocessing
+// resources of each chunk before starting the next one. It has no effect on
+// tier2.
+func WithRequestChunkSize(blocks uint64) Option {
+	return func(a anyTierService) {
+		switch s := a.(type) {
+		case *Tier1Service:
+			s.requestChunkSize = blocks
+		}
+	}
+}
+
+// WithAdmissionController makes tier1 enforce the quotas of `controller` on
+// each request, keyed by its API key, see AdmissionController. It has no
+// effect on tier2.
+func WithAdmissionController(controller AdmissionController) Option {
+	return func(a anyTierService) {
+		switch s := a.(type) {
+		case *Tier1Service:
+			s.admissionController = controller
+		}
+	}
+}
+
+// WithBillingReporter reports the usage of each request to `reporter`: the
+// bytes read and written, the blocks processed and the WASM execution time,
+// keyed by the trace ID and API key of the request.
+func WithBillingReporter(reporter *billing.Reporter) Option {
+	return func(a anyTierService) {
+		switch s := a.(type) {
+		case *Tier1Service:
+			s.billingReporter = reporter
+		case *Tier2Service:
+			s.billingReporter = reporter
+		}
+	}
+}
+
+// WithRequestFanOut makes tier1 run a single pipeline for the production mode
+// live requests producing the same responses, fanning its responses out to
+// them. A request joins a shared pipeline when its start is within the last
+// `replayBlocks` blocks it sent. It has no effect on tier2.
+func WithRequestFanOut(replayBlocks uint64) Option {
+	return func(a anyTierService) {
+		switch s := a.(type) {
+		case *Tier1Service:
+			s.fanOutReplayBlocks = replayBlocks
+		}
+	}
+}
+
+// WithBlockSourcePolicy sets where tier1 reads the blocks of its streams from,
+// the merged blocks files or the live source, unless the request sets the
+// `substreams.BlockSourceHeader` header. It has no effect on tier2.
+func WithBlockSourcePolicy(policy BlockSourcePolicy) Option {
+	return func(a anyTierService) {
+		switch s := a.(type) {
+		case *Tier1Service:
+			s.blockSourcePolicy = policy
+		}
+	}
+}
+
+// WithNetwork sets the name of the network served by tier1, ex: `mainnet`,
+// sent to the clients in the SessionInit. It is informative only: the network
+// of the requests is checked against the genesis block of the chain, read from
+// the merged blocks, see manifest.ValidateNetwork. It has no effect on tier2.
+func WithNetwork(network string) Option {
+	return func(a anyTierService) {
+		switch s := a.(type) {
+		case *Tier1Service:
+			s.network = network
+		}
+	}
+}
+
+// WithStoreDeltaStreams lets the requests ask for the deltas of their stores
+// with each block, in production mode too. It has no effect on tier2.
+func WithStoreDeltaStreams() Option {
+	return func(a anyTierService) {
+		switch s := a.(type) {
+		case *Tier1Service:
+			s.storeDeltaStreams = true
+		}
+	}
+}
+
+// WithStorageLayoutV2 writes store snapshots and execution outputs using the
+// sharded v2 layout (see package `layout`), files written with the v1 layout
+// are still read.
+func WithStorageLayoutV2() Option {
+	return func(a anyTierService) {
+		switch s := a.(type) {
+		case *Tier1Service:
+			s.runtimeConfig.BaseObjectStore = layout.NewStore(s.runtimeConfig.BaseObjectStore)
+		case *Tier2Service:
+			s.runtimeConfig.BaseObjectStore = layout.NewStore(s.runtimeConfig.BaseObjectStore)
+		}
+	}
+}
+
+// WithPinnedModules serves the files of the modules whose hash is in
+// `moduleHashes` from `cache`, a read-only bucket maintained by another provider,
+// before the state store (see package `pinned`). Tier1 treats their ranges as
+// always complete and never schedules jobs to produce them.
+func WithPinnedModules(cache dstore.Store, moduleHashes []string) Option {
+	return func(a anyTierService) {
+		switch s := a.(type) {
+		case *Tier1Service:
+			s.runtimeConfig.PinnedCache = cache
+			s.runtimeConfig.PinnedModuleHashes = moduleHashes
+		case *Tier2Service:
+			s.runtimeConfig.PinnedCache = cache
+			s.runtimeConfig.PinnedModuleHashes = moduleHashes
+		}
+	}
+}
+
+// WithBlockCache serves the merged blocks files read by tier2 jobs from `cache`,
+// sharing them across concurrent jobs. It has no effect on tier1.
+func WithBlockCache(cache *blockcache.Cache) Option {
+	return func(a anyTierService) {
+		switch s := a.(type) {
+		case *Tier2Service:
+			s.blockCache = cache
+		}
+	}
+}
+
+// WithWASMCompilationCache makes tier2 reuse the compiled WASM modules found in
+// `cache` and publish the ones it compiles. It has no effect on tier1.
+func WithWASMCompilationCache(cache *wasm.CompilationCache) Option {
+	return func(a anyTierService) {
+		switch s := a.(type) {
+		case *Tier2Service:
+			s.wasmCompilationCache = cache
+		}
+	}
+}
+
+// WithWASMModulePool makes tier2 keep up to `maxIdle` WASM modules once their
+// job is done, reused by the next jobs running the same code instead of
+// compiling it again. It has no effect on tier1.
+func WithWASMModulePool(maxIdle uint64) Option {
+	return func(a anyTierService) {
+		switch s := a.(type) {
+		case *Tier2Service:
+			s.wasmModulePool = wasm.NewModulePool(int(maxIdle))
+		}
+	}
+}
+
+// WithDeterminismAudit makes tier2 execute each module twice on every block
+// of a random `fraction` of its jobs (0 to 1) and compare the outputs, failing
+// the job before any cache is written from it when they differ, so that the
+// modules which are not deterministic are flagged before their caches are
+// used by other requests. It has no effect on tier1.
+func WithDeterminismAudit(fraction float64) Option {
+	return func(a anyTierService) {
+		switch s := a.(type) {
+		case *Tier2Service:
+			s.determinismAuditFraction = fraction
+		}
+	}
+}
+
+// WithStoreSpill makes the stores of tier2 jobs move their entries to files in
+// `dir` (the default temporary directory when empty) whenever the ones held in
+// memory exceed `thresholdBytes`, so that very large stores don't exhaust the
+// memory of the workers. It has no effect on tier1.
+func WithStoreSpill(dir string, thresholdBytes uint64) Option {
+	return func(a anyTierService) {
+		switch s := a.(type) {
+		case *Tier2Service:
+			s.storeSpillDir = dir
+			s.storeSpillThreshold = thresholdBytes
+		}
+	}
+}
+
+// WithStoreFileCache makes tier2 jobs load the complete store snapshots through
+// `cache`, so that the jobs depending on the same upstream store don't
+// download the same snapshot again. It has no effect on tier1.
+func WithStoreFileCache(cache *store.FileCache) Option {
+	return func(a anyTierService) {
+		switch s := a.(type) {
+		case *Tier2Service:
+			s.storeFileCache = cache
+		}
+	}
+}
+
+// WithExecOutAccessTracking makes the requests record the last access of the
+// execution outputs segments they load, at most once per `resolution` for the
+// same segment, so that the execout pruner deletes only the unused ones.
+func WithExecOutAccessTracking(resolution time.Duration) Option {
+	return func(a anyTierService) {
+		tracker := execout.NewAccessTracker(resolution, zlog)
+		switch s := a.(type) {
+		case *Tier1Service:
+			s.runtimeConfig.ExecOutAccessTracker = tracker
+		case *Tier2Service:
+			s.runtimeConfig.ExecOutAccessTracker = tracker
+		}
+	}
+}
+
+// WithIdempotentWrites checks the internal writes (store snapshots, execution
+// outputs, flush manifests) against a ledger recorded in the state store, so
+// that the retries of a job, a flush or a request never write an object
+// already written again, see idempotency.Ledger.
+func WithIdempotentWrites() Option {
+	return func(a anyTierService) {
+		switch s := a.(type) {
+		case *Tier1Service:
+			s.runtimeConfig.IdempotencyLedger = idempotency.NewLedger(s.runtimeConfig.BaseObjectStore)
+		case *Tier2Service:
+			s.runtimeConfig.IdempotencyLedger = idempotency.NewLedger(s.runtimeConfig.BaseObjectStore)
+		}
+	}
+}
+
+// WithStoreFlushCommits commits the snapshots of the stores flushed together
+// at a boundary with manifests written in the state store, so that the partial
+// snapshots of a flush interrupted midway are not used, see store.Commits.
+func WithStoreFlushCommits() Option {
+	return func(a anyTierService) {
+		switch s := a.(type) {
+		case *Tier1Service:
+			s.runtimeConfig.CommitStoreFlushes = true
+		case *Tier2Service:
+			s.runtimeConfig.CommitStoreFlushes = true
+		}
+	}
+}
+
+// WithContentAddressedOutputs writes the segments of the execution outputs as
+// blobs named after the hash of their content, the segment files of the
+// modules only referencing them, so that the modules producing the same
+// outputs share a single copy, see execout.BlobsDir. The servers of this
+// version read the segments written either way, but the older ones cannot read
+// the reference files: enable it once all the servers sharing the state store
+// are upgraded.
+func WithContentAddressedOutputs() Option {
+	return func(a anyTierService) {
+		switch s := a.(type) {
+		case *Tier1Service:
+			s.runtimeConfig.ContentAddressedOutputs = true
+		case *Tier2Service:
+			s.runtimeConfig.ContentAddressedOutputs = true
+		}
+	}
+}
+
+// WithMaxReorgDepth bounds the reversible blocks whose store changes tier1
+// retains to roll them back on reorganizations. A request undoing an older
+// block fails instead of streaming from corrupted stores. It has no effect on
+// tier2.
+func WithMaxReorgDepth(depth uint64) Option {
+	return func(a anyTierService) {
+		switch s := a.(type) {
+		case *Tier1Service:
+			s.runtimeConfig.MaxReorgDepth = depth
+		}
+	}
+}
+
+// WithResumePoints makes tier1 save complete snapshots of the stores of its
+// linear pipelines right after sending a final block, at most once per
+// `interval`, so that a stream restarted from its cursor, after a crash for
+// example, does not backprocess again from the previous store boundary. It has
+// no effect on tier2.
+func WithResumePoints(interval time.Duration) Option {
+	return func(a anyTierService) {
+		switch s := a.(type) {
+		case *Tier1Service:
+			s.runtimeConfig.ResumePointInterval = interval
+		}
+	}
+}
+
+// WithAsyncSnapshotWrites writes the store snapshots in the background, in
+// the order they are saved, instead of pausing the processing of the blocks
+// while they are uploaded. At most `queueSize` snapshots of a request wait to
+// be written, a request saving more waits for the oldest one to be written. A
+// failed write fails the request.
+func WithAsyncSnapshotWrites(queueSize uint64) Option {
+	return func(a anyTierService) {
+		switch s := a.(type) {
+		case *Tier1Service:
+			s.runtimeConfig.SnapshotWriteQueueSize = queueSize
+		case *Tier2Service:
+			s.runtimeConfig.SnapshotWriteQueueSize = queueSize
+		}
+	}
+}
+
+// WithStoreSeedURLPrefixes allows the packages to seed their stores from the
+// URLs starting with one of `prefixes`. Without it, only the seeds shipped in
+// the packages are accepted.
+func WithStoreSeedURLPrefixes(prefixes []string) Option {
+	return func(a anyTierService) {
+		switch s := a.(type) {
+		case *Tier1Service:
+			s.runtimeConfig.StoreSeedURLPrefixes = prefixes
+		case *Tier2Service:
+			s.runtimeConfig.StoreSeedURLPrefixes = prefixes
+		}
+	}
+}
+
+// WithExtensionBreakers trips a circuit breaker per WASM extension provider,
+// shared by all the requests, once its calls keep failing or timing out: the
+// modules calling it then fail with a transient error, reported to the
+// clients as `Unavailable`, until the provider recovers.
+func WithExtensionBreakers(config wasm.ExtensionBreakerConfig) Option {
+	return func(a anyTierService) {
+		breakers := wasm.NewExtensionBreakers(config, zlog)
+		switch s := a.(type) {
+		case *Tier1Service:
+			s.runtimeConfig.ExtensionBreakers = breakers
+		case *Tier2Service:
+			s.runtimeConfig.ExtensionBreakers = breakers
+		}
+	}
+}
+
+// WithProgressMessagesPerSecond makes tier1 coalesce the modules progress sent
+// to each client into at most `messagesPerSecond` messages per second, merging
+// the progress of the modules reported in between. It has no effect on tier2.
+func WithProgressMessagesPerSecond(messagesPerSecond uint64) Option {
+	return func(a anyTierService) {
+		switch s := a.(type) {
+		case *Tier1Service:
+			s.progressMessagesPerSecond = messagesPerSecond
+		}
+	}
+}
+
+// WithHandoffCatchUp makes tier1, once the backprocessing of a production mode
+// request reached its linear handoff block, backprocess the blocks finalized
+// in the meantime too when they are at least `minBlocks`, before handing off
+// to the stream of blocks. The stream starts exactly where the backprocessing
+// ended, replaying the blocks produced during the switch from the merged
+// blocks files and the live source. It has no effect on tier2.
+func WithHandoffCatchUp(minBlocks uint64) Option {
+	return func(a anyTierService) {
+		switch s := a.(type) {
+		case *Tier1Service:
+			s.handoffCatchUpBlocks = minBlocks
+		}
+	}
+}
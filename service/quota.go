@@ -0,0 +1,261 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/streamingfast/dauth"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/streamingfast/substreams/metrics"
+	"github.com/streamingfast/substreams/orchestrator/work"
+)
+
+// Quotas enforced per key, reported in QuotaExceededError.
+const (
+	QuotaConcurrentStreams = "concurrent_streams"
+	QuotaBackprocessBlocks = "backprocess_blocks"
+	QuotaStreamedBytes     = "streamed_bytes"
+)
+
+// AdmissionController enforces the quotas of the requests served by tier1,
+// by key: the API key of the request, or its user ID without API key. See
+// WithAdmissionController.
+type AdmissionController interface {
+	// Admit is called before a request of `key` is served, the lease returned
+	// accounting its usage until it is released, once the request completed.
+	// It returns a *QuotaExceededError when the request is over a quota.
+	Admit(ctx context.Context, key string) (QuotaLease, error)
+}
+
+// QuotaLease accounts the usage of an admitted request. Its methods return a
+// *QuotaExceededError once a quota is exceeded, failing the request.
+type QuotaLease interface {
+	// ReserveBlocks is called before the request backprocesses `blocks`
+	// blocks on tier2.
+	ReserveBlocks(blocks uint64) error
+	// AddStreamedBytes is called once `bytes` bytes were sent to the client.
+	AddStreamedBytes(bytes uint64) error
+	Release()
+}
+
+// QuotaExceededError is returned when a request is over the quota `Quota` of
+// its key. It is sent to the client with the `RESOURCE_EXHAUSTED` code, the
+// `QuotaFailure` and, when known, the `RetryInfo` details.
+type QuotaExceededError struct {
+	Quota      string
+	Limit      uint64
+	RetryAfter time.Duration // 0 when unknown
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("quota %s exceeded (limit %d), retry in %s", e.Quota, e.Limit, e.RetryAfter)
+}
+
+func (e *QuotaExceededError) GRPCStatus() *status.Status {
+	st := status.New(codes.ResourceExhausted, e.Error())
+	violation := &errdetails.QuotaFailure{Violations: []*errdetails.QuotaFailure_Violation{{
+		Subject:     e.Quota,
+		Description: fmt.Sprintf("limit of %d", e.Limit),
+	}}}
+	withDetails, err := st.WithDetails(violation)
+	if err != nil {
+		return st
+	}
+	if e.RetryAfter != 0 {
+		if withRetry, err := withDetails.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(e.RetryAfter)}); err == nil {
+			withDetails = withRetry
+		}
+	}
+	return withDetails
+}
+
+// quotaKey returns the key of the quotas of the request of `ctx`.
+func quotaKey(ctx context.Context) string {
+	auth := dauth.FromContext(ctx)
+	if auth == nil {
+		return ""
+	}
+	if apiKeyID := auth.APIKeyID(); apiKeyID != "" {
+		return apiKeyID
+	}
+	return auth.UserID()
+}
+
+// recordQuotaExceeded counts the quota exceeded by `err`, if any.
+func recordQuotaExceeded(err error) {
+	var quotaErr *QuotaExceededError
+	if errors.As(err, &quotaErr) {
+		metrics.QuotaExceeded.Inc(quotaErr.Quota)
+	}
+}
+
+type quotaLeaseKey struct{}
+
+func withQuotaLease(ctx context.Context, lease QuotaLease) context.Context {
+	return context.WithValue(ctx, quotaLeaseKey{}, lease)
+}
+
+func quotaLeaseFromContext(ctx context.Context) QuotaLease {
+	lease, _ := ctx.Value(quotaLeaseKey{}).(QuotaLease)
+	return lease
+}
+
+// reserveJobQuota reserves the blocks of `job` on the quota lease of the
+// request, called by the scheduler once per job, whatever its retries, see
+// config.RuntimeConfig.ReserveJob.
+func reserveJobQuota(ctx context.Context, job *work.Job) error {
+	lease := quotaLeaseFromContext(ctx)
+	if lease == nil {
+		return nil
+	}
+	if err := lease.ReserveBlocks(job.RequestRange.ExclusiveEndBlock - job.RequestRange.StartBlock); err != nil {
+		recordQuotaExceeded(err)
+		return err
+	}
+	return nil
+}
+
+// KeyQuotaLimits are the limits of each key enforced by NewKeyQuotas, 0 for no
+// limit. The blocks and bytes are budgets over fixed windows of `Window`.
+type KeyQuotaLimits struct {
+	MaxConcurrentStreams uint64
+	MaxBackprocessBlocks uint64
+	MaxStreamedBytes     uint64
+	Window               time.Duration
+}
+
+// NewKeyQuotas returns the AdmissionController enforcing `limits` on each key,
+// in memory.
+func NewKeyQuotas(limits KeyQuotaLimits) AdmissionController {
+	return &keyQuotas{
+		limits: limits,
+		usages: make(map[string]*keyUsage),
+		now:    time.Now,
+	}
+}
+
+type keyQuotas struct {
+	limits KeyQuotaLimits
+	now    func() time.Time
+
+	lock   sync.Mutex
+	usages map[string]*keyUsage
+}
+
+type keyUsage struct {
+	streams     uint64
+	windowStart time.Time
+	blocks      uint64
+	bytes       uint64
+}
+
+func (q *keyQuotas) Admit(_ context.Context, key string) (QuotaLease, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	usage := q.usage(key)
+	if q.limits.MaxConcurrentStreams != 0 && usage.streams >= q.limits.MaxConcurrentStreams {
+		return nil, &QuotaExceededError{Quota: QuotaConcurrentStreams, Limit: q.limits.MaxConcurrentStreams, RetryAfter: queueFullRetryAfter}
+	}
+	// rejected once a budget is exhausted, no block left
+	if err := q.checkBudgets(usage, 1); err != nil {
+		return nil, err
+	}
+
+	usage.streams++
+	return &keyLease{quotas: q, key: key}, nil
+}
+
+// usage returns the usage of `key`, starting a new window when the current
+// one is over. Must be called with the lock held.
+func (q *keyQuotas) usage(key string) *keyUsage {
+	usage, found := q.usages[key]
+	if !found {
+		usage = &keyUsage{windowStart: q.now()}
+		q.usages[key] = usage
+	}
+	if q.limits.Window != 0 && q.now().Sub(usage.windowStart) >= q.limits.Window {
+		usage.windowStart = q.now()
+		usage.blocks = 0
+		usage.bytes = 0
+	}
+	return usage
+}
+
+// checkBudgets returns a *QuotaExceededError when a budget of `usage` is
+// exhausted, `blocks` more blocks counting in its blocks budget. Must be called
+// with the lock held.
+func (q *keyQuotas) checkBudgets(usage *keyUsage, blocks uint64) error {
+	var retryAfter time.Duration
+	if q.limits.Window != 0 {
+		retryAfter = usage.windowStart.Add(q.limits.Window).Sub(q.now())
+	}
+	if q.limits.MaxBackprocessBlocks != 0 && usage.blocks+blocks > q.limits.MaxBackprocessBlocks {
+		return &QuotaExceededError{Quota: QuotaBackprocessBlocks, Limit: q.limits.MaxBackprocessBlocks, RetryAfter: retryAfter}
+	}
+	if q.limits.MaxStreamedBytes != 0 && usage.bytes >= q.limits.MaxStreamedBytes {
+		return &QuotaExceededError{Quota: QuotaStreamedBytes, Limit: q.limits.MaxStreamedBytes, RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// reserveBlocks counts `blocks` in the blocks budget of `key`, unless they
+// exceed it.
+func (q *keyQuotas) reserveBlocks(key string, blocks uint64) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	usage := q.usage(key)
+	if err := q.checkBudgets(usage, blocks); err != nil {
+		return err
+	}
+	usage.blocks += blocks
+	return nil
+}
+
+// addBytes counts `bytes`, already sent, in the bytes budget of `key`.
+func (q *keyQuotas) addBytes(key string, bytes uint64) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	usage := q.usage(key)
+	usage.bytes += bytes
+	return q.checkBudgets(usage, 0)
+}
+
+func (q *keyQuotas) release(key string) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	usage := q.usage(key)
+	usage.streams--
+	if usage.streams == 0 && usage.blocks == 0 && usage.bytes == 0 {
+		delete(q.usages, key)
+	}
+}
+
+type keyLease struct {
+	quotas *keyQuotas
+	key    string
+
+	releaseOnce sync.Once
+}
+
+func (l *keyLease) ReserveBlocks(blocks uint64) error {
+	return l.quotas.reserveBlocks(l.key, blocks)
+}
+
+func (l *keyLease) AddStreamedBytes(bytes uint64) error {
+	return l.quotas.addBytes(l.key, bytes)
+}
+
+func (l *keyLease) Release() {
+	l.releaseOnce.Do(func() { l.quotas.release(l.key) })
+}
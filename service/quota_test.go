@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/streamingfast/substreams/orchestrator/work"
+	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
+)
+
+func newTestKeyQuotas(limits KeyQuotaLimits) (*keyQuotas, *time.Time) {
+	now := time.Unix(1000, 0)
+	q := NewKeyQuotas(limits).(*keyQuotas)
+	q.now = func() time.Time { return now }
+	return q, &now
+}
+
+func assertQuotaExceeded(t *testing.T, err error, quota string, retryAfter time.Duration) {
+	t.Helper()
+	var quotaErr *QuotaExceededError
+	require.ErrorAs(t, err, &quotaErr)
+	assert.Equal(t, quota, quotaErr.Quota)
+	assert.Equal(t, retryAfter, quotaErr.RetryAfter)
+}
+
+func TestKeyQuotas_ConcurrentStreams(t *testing.T) {
+	q, _ := newTestKeyQuotas(KeyQuotaLimits{MaxConcurrentStreams: 1})
+	ctx := context.Background()
+
+	first, err := q.Admit(ctx, "a")
+	require.NoError(t, err)
+	_, err = q.Admit(ctx, "a")
+	assertQuotaExceeded(t, err, QuotaConcurrentStreams, queueFullRetryAfter)
+
+	other, err := q.Admit(ctx, "b")
+	require.NoError(t, err, "quotas are per key")
+	other.Release()
+
+	first.Release()
+	first.Release()
+	_, err = q.Admit(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), q.usages["a"].streams, "released once")
+}
+
+func TestKeyQuotas_Budgets(t *testing.T) {
+	q, now := newTestKeyQuotas(KeyQuotaLimits{MaxBackprocessBlocks: 1000, MaxStreamedBytes: 100, Window: time.Hour})
+	ctx := context.Background()
+
+	lease, err := q.Admit(ctx, "a")
+	require.NoError(t, err)
+
+	require.NoError(t, lease.ReserveBlocks(600))
+	*now = now.Add(10 * time.Minute)
+	assertQuotaExceeded(t, lease.ReserveBlocks(600), QuotaBackprocessBlocks, 50*time.Minute)
+	require.NoError(t, lease.ReserveBlocks(400), "the blocks refused are not counted")
+
+	require.NoError(t, lease.AddStreamedBytes(60))
+	assertQuotaExceeded(t, lease.AddStreamedBytes(40), QuotaStreamedBytes, 50*time.Minute)
+	lease.Release()
+
+	_, err = q.Admit(ctx, "a")
+	assertQuotaExceeded(t, err, QuotaBackprocessBlocks, 50*time.Minute)
+
+	*now = now.Add(50 * time.Minute)
+	lease, err = q.Admit(ctx, "a")
+	require.NoError(t, err, "budgets start over with the next window")
+	require.NoError(t, lease.ReserveBlocks(1000))
+	lease.Release()
+}
+
+func TestQuotaExceededError_GRPCStatus(t *testing.T) {
+	err := fmt.Errorf("job failed: %w", &QuotaExceededError{Quota: QuotaStreamedBytes, Limit: 100, RetryAfter: time.Minute})
+
+	st := status.Convert(toGRPCError(err))
+	assert.Equal(t, codes.ResourceExhausted, st.Code())
+	require.Len(t, st.Details(), 3)
+	assert.Equal(t, QuotaStreamedBytes, st.Details()[0].(*errdetails.QuotaFailure).Violations[0].Subject)
+	assert.Equal(t, time.Minute, st.Details()[1].(*errdetails.RetryInfo).RetryDelay.AsDuration())
+	assert.Equal(t, pbsubstreamsrpc.ErrorCode_ERROR_CODE_LIMIT_EXCEEDED, st.Details()[2].(*pbsubstreamsrpc.Error).Code)
+	assert.True(t, st.Details()[2].(*pbsubstreamsrpc.Error).Retryable)
+}
+
+type testQuotaLease struct {
+	QuotaLease
+	reserved []uint64
+	err      error
+}
+
+func (l *testQuotaLease) ReserveBlocks(blocks uint64) error {
+	l.reserved = append(l.reserved, blocks)
+	return l.err
+}
+
+func TestReserveJobQuota(t *testing.T) {
+	job := work.TestJob("A", "100-200", 1)
+
+	assert.NoError(t, reserveJobQuota(context.Background(), job), "without lease")
+
+	lease := &testQuotaLease{}
+	ctx := withQuotaLease(context.Background(), lease)
+	assert.NoError(t, reserveJobQuota(ctx, job))
+	assert.Equal(t, []uint64{100}, lease.reserved)
+
+	lease.err = &QuotaExceededError{Quota: QuotaBackprocessBlocks}
+	assert.Equal(t, lease.err, reserveJobQuota(ctx, job))
+}
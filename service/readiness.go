@@ -0,0 +1,170 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/streamingfast/dstore"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	pbhealth "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/streamingfast/substreams/client"
+)
+
+// readinessProbeInterval is the interval between two probes of the
+// dependencies of a tier, see readiness.
+const readinessProbeInterval = 15 * time.Second
+
+var errNotProbed = errors.New("dependencies not probed yet")
+
+// readinessProbe checks that a dependency of a tier is reachable.
+type readinessProbe struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// readiness holds the result of the last probes of the dependencies of a tier,
+// run in the background so that the health checks, polled by the load
+// balancers, never reach the dependencies themselves.
+type readiness struct {
+	probes []readinessProbe
+	logger *zap.Logger
+
+	mu  sync.RWMutex
+	err error // of the first probe failing, errNotProbed until the probes ran
+}
+
+func newReadiness(logger *zap.Logger, probes ...readinessProbe) *readiness {
+	return &readiness{
+		probes: probes,
+		logger: logger,
+		err:    errNotProbed,
+	}
+}
+
+// run probes the dependencies every `interval`, until `ctx` is done.
+func (r *readiness) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		r.probe(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *readiness) probe(ctx context.Context) {
+	var err error
+	for _, p := range r.probes {
+		probeCtx, cancel := context.WithTimeout(ctx, storageProbeTimeout)
+		probeErr := p.check(probeCtx)
+		cancel()
+		if probeErr != nil {
+			err = fmt.Errorf("%s: %w", p.name, probeErr)
+			break
+		}
+	}
+	if ctx.Err() != nil {
+		return
+	}
+
+	r.mu.Lock()
+	previous := r.err
+	r.err = err
+	r.mu.Unlock()
+
+	switch {
+	case err != nil && previous == nil:
+		r.logger.Warn("dependency unreachable, reporting not ready", zap.Error(err))
+	case err == nil && previous != nil:
+		r.logger.Info("dependencies reachable, reporting ready")
+	}
+}
+
+// check returns the error of the last probes, nil when all the dependencies
+// were reachable.
+func (r *readiness) check() error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.err
+}
+
+// storageReadinessProbe checks that `store` can be reached, the object looked
+// up needs not exist.
+func storageReadinessProbe(name string, store dstore.Store) readinessProbe {
+	return readinessProbe{
+		name: name,
+		check: func(ctx context.Context) error {
+			_, err := store.FileExists(ctx, "substreams-readiness-probe")
+			return err
+		},
+	}
+}
+
+// workerPoolReadinessProbe checks that the tier2 endpoint of `config`, where
+// tier1 schedules its jobs, is serving.
+func workerPoolReadinessProbe(config *client.SubstreamsClientConfig) readinessProbe {
+	// probes run sequentially, see readiness.run
+	var (
+		cli      pbhealth.HealthClient
+		callOpts []grpc.CallOption
+	)
+
+	return readinessProbe{
+		name: "tier2",
+		check: func(ctx context.Context) error {
+			if cli == nil {
+				var err error
+				// the connection is kept open, it is closed with the process
+				cli, _, callOpts, err = client.NewInternalHealthClient(config)
+				if err != nil {
+					return err
+				}
+			}
+
+			resp, err := cli.Check(ctx, &pbhealth.HealthCheckRequest{}, callOpts...)
+			if err != nil {
+				return err
+			}
+			if resp.Status != pbhealth.HealthCheckResponse_SERVING {
+				return fmt.Errorf("status %s", resp.Status)
+			}
+			return nil
+		},
+	}
+}
+
+// RunReadinessProbes probes the storages and the tier2 workers every
+// readinessProbeInterval, until `ctx` is done, see Ready.
+func (s *Tier1Service) RunReadinessProbes(ctx context.Context) {
+	s.readiness.run(ctx, readinessProbeInterval)
+}
+
+// Ready returns the reason the service is not ready to serve requests: the
+// error of the last probe of its dependencies failing, or of RunReadinessProbes
+// not having probed them yet.
+func (s *Tier1Service) Ready() error {
+	return s.readiness.check()
+}
+
+// RunReadinessProbes probes the storages every readinessProbeInterval, until
+// `ctx` is done, see Ready.
+func (s *Tier2Service) RunReadinessProbes(ctx context.Context) {
+	s.readiness.run(ctx, readinessProbeInterval)
+}
+
+// Ready returns the reason the service is not ready to serve requests: the
+// error of the last probe of its dependencies failing, or of RunReadinessProbes
+// not having probed them yet.
+func (s *Tier2Service) Ready() error {
+	return s.readiness.check()
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	connect_go "github.com/bufbuild/connect-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	pbhealth "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestReadiness(t *testing.T) {
+	ctx := context.Background()
+	var storageErr error
+	r := newReadiness(zap.NewNop(),
+		readinessProbe{name: "first", check: func(ctx context.Context) error { return nil }},
+		readinessProbe{name: "storage", check: func(ctx context.Context) error { return storageErr }},
+	)
+	assert.ErrorIs(t, r.check(), errNotProbed)
+
+	r.probe(ctx)
+	assert.NoError(t, r.check())
+
+	storageErr = errors.New("unreachable")
+	r.probe(ctx)
+	assert.EqualError(t, r.check(), "storage: unreachable")
+
+	storageErr = nil
+	r.probe(ctx)
+	assert.NoError(t, r.check())
+
+	canceledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	storageErr = context.Canceled
+	r.probe(canceledCtx)
+	assert.NoError(t, r.check(), "probes interrupted by shutdown are not recorded")
+}
+
+func TestHealthHandlerGetter(t *testing.T) {
+	ready := false
+	pattern, handler := healthHandlerGetter(func(ctx context.Context) (bool, interface{}, error) {
+		return ready, nil, nil
+	})()
+	assert.Equal(t, healthServicePath, pattern)
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	cli := connect_go.NewClient[pbhealth.HealthCheckRequest, pbhealth.HealthCheckResponse](server.Client(), server.URL+healthServicePath+"Check")
+	check := func() pbhealth.HealthCheckResponse_ServingStatus {
+		resp, err := cli.CallUnary(context.Background(), connect_go.NewRequest(&pbhealth.HealthCheckRequest{}))
+		require.NoError(t, err)
+		return resp.Msg.Status
+	}
+
+	assert.Equal(t, pbhealth.HealthCheckResponse_NOT_SERVING, check())
+	ready = true
+	assert.Equal(t, pbhealth.HealthCheckResponse_SERVING, check())
+}
+
+func TestIsUnauthenticatedMethod(t *testing.T) {
+	assert.True(t, isUnauthenticatedMethod("/grpc.health.v1.Health/Check"))
+	assert.True(t, isUnauthenticatedMethod("/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo"))
+	assert.False(t, isUnauthenticatedMethod("/sf.substreams.internal.v2.Substreams/ProcessRange"))
+}
@@ -0,0 +1,204 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/bufbuild/connect-go"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
+	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
+	"github.com/streamingfast/substreams/pipeline/outputmodules"
+	"github.com/streamingfast/substreams/reqctx"
+)
+
+// moduleReload holds the modules of a development mode request, replaced by
+// ReloadModule. Its methods are no-ops on a nil moduleReload.
+type moduleReload struct {
+	request *pbsubstreamsrpc.Request // as validated when the request started, never modified
+
+	lock      sync.Mutex
+	modules   *pbsubstreams.Modules
+	pending   bool               // the modules were replaced since the pipeline running them started
+	cancelRun context.CancelFunc // stops the pipeline running the modules
+}
+
+func newModuleReload(request *pbsubstreamsrpc.Request) *moduleReload {
+	return &moduleReload{request: request, modules: request.Modules}
+}
+
+func (r *moduleReload) current() *pbsubstreams.Modules {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.modules
+}
+
+// replace sets the modules of the request and stops the pipeline running the
+// previous ones, the request resuming with `modules` once `take` returns them.
+func (r *moduleReload) replace(modules *pbsubstreams.Modules) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.modules = modules
+	r.pending = true
+	if r.cancelRun != nil {
+		r.cancelRun()
+	}
+}
+
+// start registers the pipeline running the modules, canceled right away when
+// they were replaced since the previous one stopped.
+func (r *moduleReload) start(cancelRun context.CancelFunc) {
+	if r == nil {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.cancelRun = cancelRun
+	if r.pending {
+		cancelRun()
+	}
+}
+
+// take returns the modules replaced since the pipeline running them started,
+// nil if they were not.
+func (r *moduleReload) take() *pbsubstreams.Modules {
+	if r == nil {
+		return nil
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if !r.pending {
+		return nil
+	}
+	r.pending = false
+	r.cancelRun = nil
+	return r.modules
+}
+
+// ReloadModule replaces the code of a module of a development mode `Blocks`
+// request being served by this node. The request restarts from the last block
+// it sent with the new code: the modules whose hash is unchanged resume from
+// their cached snapshots, only the module reloaded and the modules depending on
+// it are rebuilt.
+func (s *Tier1Service) ReloadModule(
+	ctx context.Context,
+	req *connect.Request[pbsubstreamsrpc.ReloadModuleRequest],
+) (*connect.Response[pbsubstreamsrpc.ReloadModuleResponse], error) {
+	if !s.moduleReload {
+		return nil, status.Error(codes.Unimplemented, "module reload is not enabled on this endpoint")
+	}
+
+	request := req.Msg
+	if request.Binary == nil || len(request.Binary.Content) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "missing binary in request")
+	}
+
+	activeRequest := s.activeRequests.get(request.RequestId)
+	if activeRequest == nil {
+		return nil, status.Errorf(codes.NotFound, "no request with ID %q is being served by this node", request.RequestId)
+	}
+	if activeRequest.status.UserId != userID(ctx) {
+		return nil, status.Errorf(codes.PermissionDenied, "request with ID %q belongs to another user", request.RequestId)
+	}
+	if activeRequest.reload == nil {
+		return nil, status.Error(codes.FailedPrecondition, "the modules of production mode requests cannot be reloaded")
+	}
+
+	outputModules := activeRequest.reload.request.OutputModuleNames()
+	previousModules := activeRequest.reload.current()
+	previousGraph, err := outputmodules.NewOutputModulesGraph(outputModules, false, previousModules)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	modules, err := reloadModule(previousModules, request.Module, request.Binary)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	// the request resumes with the new modules without being validated again,
+	// they are validated like the ones of a new request
+	reloaded := reloadedRequest(activeRequest.reload.request, modules, "")
+	if err := outputmodules.ValidateTier1Request(reloaded, s.blockType); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "validate reloaded request: %s", err)
+	}
+	graph, err := outputmodules.NewOutputModulesGraph(outputModules, false, modules)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := s.validateOutputGraph(reloaded, graph); err != nil {
+		return nil, err
+	}
+
+	invalidated := invalidatedModules(previousGraph, graph)
+	if len(invalidated) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "module %q is not used by the request or its code is unchanged", request.Module)
+	}
+
+	out := &pbsubstreamsrpc.ReloadModuleResponse{
+		ModuleHash:         graph.ModuleHashes().Get(request.Module),
+		InvalidatedModules: invalidated,
+	}
+	if activeRequest.blocksSent.Load() != 0 {
+		out.ResumeBlock = activeRequest.lastBlock.Load() + 1
+	}
+
+	activeRequest.reload.replace(modules)
+	reqctx.Logger(ctx).Info("reloaded module of request",
+		zap.String("request_id", request.RequestId),
+		zap.String("trace_id", activeRequest.status.TraceId),
+		zap.String("module", request.Module),
+		zap.String("module_hash", out.ModuleHash),
+		zap.Strings("invalidated_modules", out.InvalidatedModules),
+		zap.Uint64("resume_block", out.ResumeBlock),
+	)
+	return connect.NewResponse(out), nil
+}
+
+// reloadModule returns a copy of `modules` whose module `name` runs the code of
+// `binary`, appended to the binaries so that the other modules sharing the
+// previous one keep it. `binary` has the type of the previous binary when not
+// set.
+func reloadModule(modules *pbsubstreams.Modules, name string, binary *pbsubstreams.Binary) (*pbsubstreams.Modules, error) {
+	out := proto.Clone(modules).(*pbsubstreams.Modules)
+	for _, module := range out.Modules {
+		if module.Name != name {
+			continue
+		}
+
+		binary = proto.Clone(binary).(*pbsubstreams.Binary)
+		if binary.Type == "" {
+			binary.Type = out.Binaries[module.BinaryIndex].Type
+		}
+		out.Binaries = append(out.Binaries, binary)
+		module.BinaryIndex = uint32(len(out.Binaries) - 1)
+		return out, nil
+	}
+	return nil, fmt.Errorf("module %q not found", name)
+}
+
+// invalidatedModules returns the modules of `reloaded` whose hash differs from
+// `previous`, in the order they are used.
+func invalidatedModules(previous, reloaded *outputmodules.Graph) (out []string) {
+	for _, module := range reloaded.UsedModules() {
+		if previous.ModuleHashes().Get(module.Name) != reloaded.ModuleHashes().Get(module.Name) {
+			out = append(out, module.Name)
+		}
+	}
+	return out
+}
+
+// reloadedRequest returns a copy of `request` running `modules`, resuming from
+// `cursor`, the cursor of the last block sent, if any.
+func reloadedRequest(request *pbsubstreamsrpc.Request, modules *pbsubstreams.Modules, cursor string) *pbsubstreamsrpc.Request {
+	out := proto.Clone(request).(*pbsubstreamsrpc.Request)
+	out.Modules = modules
+	if cursor != "" {
+		out.StartCursor = cursor
+	}
+	return out
+}
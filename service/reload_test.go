@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/streamingfast/substreams/manifest"
+	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
+	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
+	"github.com/streamingfast/substreams/pipeline/outputmodules"
+)
+
+func TestReloadModule(t *testing.T) {
+	modules := &pbsubstreams.Modules{
+		Modules:  manifest.NewSimpleTestModules(),
+		Binaries: []*pbsubstreams.Binary{{Type: "wasm/rust-v1", Content: []byte{1}}},
+	}
+	previousGraph, err := outputmodules.NewOutputModuleGraph("E", false, modules)
+	require.NoError(t, err)
+
+	reloaded, err := reloadModule(modules, "C", &pbsubstreams.Binary{Content: []byte{2}})
+	require.NoError(t, err)
+	require.Len(t, reloaded.Binaries, 2)
+	assert.Equal(t, "wasm/rust-v1", reloaded.Binaries[1].Type)
+	assert.Len(t, modules.Binaries, 1, "modules of the request unchanged")
+
+	graph, err := outputmodules.NewOutputModuleGraph("E", false, reloaded)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"C", "D", "E"}, invalidatedModules(previousGraph, graph))
+
+	_, err = reloadModule(modules, "unknown", &pbsubstreams.Binary{Content: []byte{2}})
+	assert.Error(t, err)
+
+	request := reloadedRequest(&pbsubstreamsrpc.Request{OutputModule: "E", Modules: modules, StartBlockNum: 10}, reloaded, "cursor")
+	assert.Equal(t, reloaded, request.Modules)
+	assert.Equal(t, "cursor", request.StartCursor)
+	assert.Equal(t, int64(10), request.StartBlockNum)
+}
+
+func TestTier1Service_ReloadModule(t *testing.T) {
+	modules := &pbsubstreams.Modules{
+		Modules: []*pbsubstreams.Module{
+			{
+				Name:   "A",
+				Kind:   &pbsubstreams.Module_KindMap_{KindMap: &pbsubstreams.Module_KindMap{}},
+				Inputs: []*pbsubstreams.Module_Input{{Input: &pbsubstreams.Module_Input_Source_{Source: &pbsubstreams.Module_Input_Source{Type: "sf.substreams.v1.test.Block"}}}},
+			},
+			{
+				Name:   "B",
+				Kind:   &pbsubstreams.Module_KindMap_{KindMap: &pbsubstreams.Module_KindMap{}},
+				Inputs: []*pbsubstreams.Module_Input{{Input: &pbsubstreams.Module_Input_Map_{Map: &pbsubstreams.Module_Input_Map{ModuleName: "A"}}}},
+			},
+		},
+		Binaries: []*pbsubstreams.Binary{{Type: "wasm/rust-v1", Content: []byte{1}}},
+	}
+	s := &Tier1Service{moduleReload: true, activeRequests: newActiveRequests(), blockType: "sf.substreams.v1.test.Block"}
+	activeRequest := s.activeRequests.add(&pbsubstreamsrpc.ActiveRequest{RequestId: "1"})
+	activeRequest.reload = newModuleReload(&pbsubstreamsrpc.Request{OutputModule: "B", Modules: modules, StopBlockNum: 100})
+
+	reload := func(binary *pbsubstreams.Binary) error {
+		_, err := s.ReloadModule(context.Background(), connect.NewRequest(&pbsubstreamsrpc.ReloadModuleRequest{RequestId: "1", Module: "A", Binary: binary}))
+		return err
+	}
+
+	err := reload(&pbsubstreams.Binary{Type: "wasm/other", Content: []byte{2}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err), "reloaded request validated: %v", err)
+	assert.Same(t, modules, activeRequest.reload.current(), "modules not replaced")
+
+	require.NoError(t, reload(&pbsubstreams.Binary{Content: []byte{2}}))
+	assert.NotSame(t, modules, activeRequest.reload.current())
+}
+
+func TestModuleReload(t *testing.T) {
+	modules := &pbsubstreams.Modules{}
+	reload := newModuleReload(&pbsubstreamsrpc.Request{Modules: modules})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	reload.start(cancel)
+	assert.Nil(t, reload.take())
+
+	reloaded := &pbsubstreams.Modules{}
+	reload.replace(reloaded)
+	assert.Error(t, ctx.Err(), "running pipeline canceled")
+	assert.Same(t, reloaded, reload.take())
+	assert.Nil(t, reload.take())
+
+	// replaced between two runs
+	reload.replace(modules)
+	ctx, cancel = context.WithCancel(context.Background())
+	reload.start(cancel)
+	assert.Error(t, ctx.Err())
+	assert.Same(t, modules, reload.take())
+
+	var disabled *moduleReload
+	disabled.start(cancel)
+	assert.Nil(t, disabled.take())
+}
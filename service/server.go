@@ -19,6 +19,7 @@ import (
 	"go.opentelemetry.io/otel"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	pbhealth "google.golang.org/grpc/health/grpc_health_v1"
 )
 
 func GetCommonServerOptions(listenAddr string, logger *zap.Logger, healthcheck dgrpcserver.HealthCheck) []dgrpcserver.Option {
@@ -50,6 +51,8 @@ func ListenTier1(
 	options := GetCommonServerOptions(addr, logger, healthcheck)
 
 	options = append(options, dgrpcserver.WithConnectInterceptor(dauthconnect.NewAuthInterceptor(auth)))
+	// innermost, so that the logging interceptors see the error codes
+	options = append(options, dgrpcserver.WithConnectInterceptor(grpcStatusInterceptor{}))
 	options = append(options, dgrpcserver.WithConnectStrictContentType(false))
 
 	streamHandlerGetter := func(opts ...connect_go.HandlerOption) (string, http.Handler) {
@@ -57,7 +60,11 @@ func ListenTier1(
 	}
 
 	options = append(options, dgrpcserver.WithPermissiveCORS())
-	srv := connectweb.New([]connectweb.HandlerGetter{streamHandlerGetter}, options...)
+	options = append(options,
+		dgrpcserver.WithReflection(ssconnect.StreamName),
+		dgrpcserver.WithReflection(pbhealth.Health_ServiceDesc.ServiceName),
+	)
+	srv := connectweb.New([]connectweb.HandlerGetter{streamHandlerGetter, healthHandlerGetter(healthcheck)}, options...)
 	addr = strings.ReplaceAll(addr, "*", "")
 	srv.Launch(addr)
 	<-srv.Terminated()
@@ -77,8 +84,8 @@ func ListenTier2(
 		options = append(options, dgrpcserver.WithServiceDiscoveryURL(serviceDiscoveryURL))
 	}
 	options = append(options,
-		dgrpcserver.WithPostUnaryInterceptor(dauthgrpc.UnaryAuthChecker(auth)),
-		dgrpcserver.WithPostStreamInterceptor(dauthgrpc.StreamAuthChecker(auth)),
+		dgrpcserver.WithPostUnaryInterceptor(skipAuthUnary(dauthgrpc.UnaryAuthChecker(auth))),
+		dgrpcserver.WithPostStreamInterceptor(skipAuthStream(dauthgrpc.StreamAuthChecker(auth))),
 	)
 
 	grpcServer := factory.ServerFromOptions(options...)
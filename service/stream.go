@@ -17,6 +17,7 @@ type StreamFactory struct {
 	mergedBlocksStore dstore.Store
 	forkedBlocksStore dstore.Store
 	hub               *hub.ForkableHub
+	blockSourcePolicy BlockSourcePolicy // where the blocks are read from when there is a hub, unless the request overrides it
 }
 
 func (sf *StreamFactory) New(
@@ -38,8 +39,10 @@ func (sf *StreamFactory) New(
 		options = append(options, stream.WithFinalBlocksOnly())
 	}
 
+	var cur *bstream.Cursor
 	if cursor != "" {
-		cur, err := bstream.CursorFromOpaque(cursor)
+		var err error
+		cur, err = bstream.CursorFromOpaque(cursor)
 		if err != nil {
 			return nil, status.Errorf(codes.InvalidArgument, "invalid StartCursor %q: %s", cursor, err)
 		}
@@ -74,6 +77,15 @@ func (sf *StreamFactory) New(
 		logger.Debug("mergedBlocksStore cannot be cloned, will not be metered")
 	}
 
+	if sf.hub != nil {
+		var fileSourceOptions []bstream.FileSourceOption
+		if stopBlockNum != 0 {
+			fileSourceOptions = append(fileSourceOptions, bstream.FileSourceWithStopBlock(stopBlockNum))
+		}
+		files := bstream.NewFileSourceFactory(mergedBlocksStore, forkedBlocksStore, logger, fileSourceOptions...)
+		return newPolicyStream(blockSourcePolicyFromContext(ctx, sf.blockSourcePolicy), files, sf.hub, h, startBlockNum, stopBlockNum, cur, finalBlocksOnly, cursorIsTarget, logger)
+	}
+
 	return stream.New(
 		forkedBlocksStore,
 		mergedBlocksStore,
@@ -6,6 +6,7 @@ import (
 
 	"github.com/streamingfast/bstream/stream"
 	"github.com/streamingfast/substreams"
+	"github.com/streamingfast/substreams/manifest"
 	pbssinternal "github.com/streamingfast/substreams/pb/sf/substreams/intern/v2"
 	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
 	"github.com/streamingfast/substreams/pipeline/outputmodules"
@@ -33,18 +34,34 @@ func TestNewService(runtimeConfig config.RuntimeConfig, linearHandoffBlockNum ui
 			}
 			return 0, fmt.Errorf("no live feed")
 		},
-		tracer: nil,
-		logger: zlog,
+		tracer:         nil,
+		logger:         zlog,
+		activeRequests: newActiveRequests(),
+	}
+}
+
+// TestWithRecentFinalBlock makes tier1 get the recent finalized block from
+// `getRecentFinalBlock` instead of the linear handoff block of TestNewService.
+func TestWithRecentFinalBlock(getRecentFinalBlock func() (uint64, error)) Option {
+	return func(a anyTierService) {
+		switch s := a.(type) {
+		case *Tier1Service:
+			s.getRecentFinalBlock = getRecentFinalBlock
+		}
 	}
 }
 
 func (s *Tier1Service) TestBlocks(ctx context.Context, isSubRequest bool, request *pbsubstreamsrpc.Request, respFunc substreams.ResponseFunc) error {
-	outputGraph, err := outputmodules.NewOutputModuleGraph(request.OutputModule, request.ProductionMode, request.Modules)
+	request.OutputModule = request.OutputModuleNames()[0]
+	if err := manifest.ApplyModuleParams(request.Modules, request.Params); err != nil {
+		return stream.NewErrInvalidArg(err.Error())
+	}
+	outputGraph, err := outputmodules.NewOutputModulesGraph(request.OutputModuleNames(), request.ProductionMode, request.Modules)
 	if err != nil {
 		return stream.NewErrInvalidArg(err.Error())
 	}
 
-	return s.blocks(ctx, request, outputGraph, respFunc)
+	return s.blocks(ctx, request, outputGraph, 0, respFunc, nil)
 }
 
 func TestNewServiceTier2(runtimeConfig config.RuntimeConfig, streamFactoryFunc StreamFactoryFunc) *Tier2Service {
@@ -2,43 +2,53 @@ package service
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"github.com/streamingfast/bstream/hub"
 	"github.com/streamingfast/bstream/stream"
 	bsstream "github.com/streamingfast/bstream/stream"
 	"github.com/streamingfast/dauth"
-	"github.com/streamingfast/dgrpc"
 	"github.com/streamingfast/dmetering"
 	"github.com/streamingfast/dstore"
 	"github.com/streamingfast/logging"
 	tracing "github.com/streamingfast/sf-tracing"
 	"github.com/streamingfast/shutter"
+	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/bufbuild/connect-go"
 	"github.com/streamingfast/substreams"
+	"github.com/streamingfast/substreams/billing"
+	"github.com/streamingfast/substreams/block"
 	"github.com/streamingfast/substreams/client"
+	"github.com/streamingfast/substreams/manifest"
 	"github.com/streamingfast/substreams/metrics"
+	"github.com/streamingfast/substreams/orchestrator"
+	"github.com/streamingfast/substreams/orchestrator/responses"
 	"github.com/streamingfast/substreams/orchestrator/work"
 	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
 	ssconnect "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2/pbsubstreamsrpcconnect"
+	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
 	"github.com/streamingfast/substreams/pipeline"
 	"github.com/streamingfast/substreams/pipeline/cache"
-	"github.com/streamingfast/substreams/pipeline/exec"
+	"github.com/streamingfast/substreams/pipeline/outputencoding"
 	"github.com/streamingfast/substreams/pipeline/outputmodules"
 	"github.com/streamingfast/substreams/reqctx"
 	"github.com/streamingfast/substreams/service/config"
 	"github.com/streamingfast/substreams/storage/execout"
+	"github.com/streamingfast/substreams/storage/pinned"
 	"github.com/streamingfast/substreams/storage/store"
+	"github.com/streamingfast/substreams/storage/traced"
 	"github.com/streamingfast/substreams/wasm"
 	"go.opentelemetry.io/otel/attribute"
 	ttrace "go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 )
 
 type Tier1Service struct {
@@ -58,6 +68,31 @@ type Tier1Service struct {
 	getRecentFinalBlock func() (uint64, error)
 	resolveCursor       pipeline.CursorResolver
 	getHeadBlock        func() (uint64, error)
+
+	mergedBlocksStore   dstore.Store
+	activeRequests      *activeRequests
+	readiness           *readiness
+	nodeStatusEnabled   bool
+	nodeStatusOperators map[string]bool   // user IDs of the callers of GetNodeStatus shown the requests of all the users
+	moduleReload        bool              // the modules of development mode requests can be reloaded, see ReloadModule
+	admission           *requestAdmission // nil when the concurrent requests are not limited
+	requestChunkSize    uint64            // if not 0, the backprocessing of longer ranges is served in sequential chunks of that many blocks
+	storeDeltaStreams   bool              // requests can ask for the deltas of their stores, see `Request.store_delta_modules`
+	blockSourcePolicy   BlockSourcePolicy // where the blocks of the streams are read from, unless the request sets `substreams.BlockSourceHeader`
+
+	fanOutReplayBlocks uint64  // if not 0, identical live requests share a pipeline, see WithRequestFanOut
+	fanOut             *fanOut // nil when the live requests don't share pipelines
+
+	admissionController AdmissionController // nil when no quota is enforced per key
+
+	billingReporter *billing.Reporter // nil when the usage of the requests is not reported
+
+	progressMessagesPerSecond uint64 // if not 0, the modules progress sent to each client is coalesced to that many messages per second
+
+	handoffCatchUpBlocks uint64 // if not 0, the blocks finalized while a request was backprocessed are backprocessed too, see WithHandoffCatchUp
+
+	network string        // name of the network served, informative only, see WithNetwork
+	genesis *genesisBlock // the requests declaring another network are rejected
 }
 
 func NewTier1(
@@ -91,6 +126,7 @@ func NewTier1(
 			return work.NewRemoteWorker(clientFactory, logger)
 		},
 	)
+	runtimeConfig.ReserveJob = reserveJobQuota
 	s := &Tier1Service{
 		Shutter:        shutter.New(),
 		runtimeConfig:  runtimeConfig,
@@ -99,6 +135,15 @@ func NewTier1(
 		failedRequests: make(map[string]*recordedFailure),
 		resolveCursor:  pipeline.NewCursorResolver(hub, mergedBlocksStore, forkedBlocksStore),
 		logger:         logger,
+
+		mergedBlocksStore: mergedBlocksStore,
+		genesis:           newGenesisBlock(mergedBlocksStore),
+		activeRequests:    newActiveRequests(),
+		readiness: newReadiness(logger,
+			storageReadinessProbe("state_store", stateStore),
+			storageReadinessProbe("merged_blocks_store", mergedBlocksStore),
+			workerPoolReadinessProbe(substreamsClientConfig),
+		),
 	}
 
 	sf := &StreamFactory{
@@ -115,6 +160,17 @@ func NewTier1(
 	for _, opt := range opts {
 		opt(s)
 	}
+	sf.blockSourcePolicy = s.blockSourcePolicy
+	if s.fanOutReplayBlocks != 0 {
+		s.fanOut = newFanOut(s.fanOutReplayBlocks, s.Terminating())
+	}
+
+	if s.runtimeConfig.PinnedCache != nil {
+		// outermost, see pinned.Store
+		s.runtimeConfig.BaseObjectStore = pinned.NewStore(s.runtimeConfig.BaseObjectStore, s.runtimeConfig.PinnedCache, s.runtimeConfig.PinnedModuleHashes)
+	}
+	// records the state store calls in the trace of the request making them
+	s.runtimeConfig.BaseObjectStore = traced.NewStore(s.runtimeConfig.BaseObjectStore)
 
 	return s
 }
@@ -131,12 +187,15 @@ func (s *Tier1Service) Blocks(
 	ctx context.Context,
 	req *connect.Request[pbsubstreamsrpc.Request],
 	stream *connect.ServerStream[pbsubstreamsrpc.Response],
-) error {
+) (grpcError error) {
 
 	// We keep `err` here as the unaltered error from `blocks` call, this is used in the EndSpan to record the full error
 	// and not only the `grpcError` one which is a subset view of the full `err`.
 	var err error
 
+	// every error returned carries its `Error` in its status details, see toGRPCError
+	defer func() { grpcError = toGRPCError(grpcError) }()
+
 	logger := reqctx.Logger(ctx).Named("tier1")
 
 	ctx = logging.WithLogger(ctx, logger)
@@ -156,14 +215,27 @@ func (s *Tier1Service) Blocks(
 		mut.Unlock()
 	}()
 
-	respFunc := tier1ResponseHandler(respContext, &mut, logger, stream)
-
 	span.SetAttributes(attribute.Int64("substreams.tier", 1))
 
 	request := req.Msg
 	if request.Modules == nil {
 		return status.Error(codes.InvalidArgument, "missing modules in request")
 	}
+
+	encoder, err := outputencoding.New(request.OutputEncoding, request.OutputProtoFiles)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, fmt.Sprintf("output encoding: %s", err))
+	}
+
+	respFunc := tier1ResponseHandler(respContext, &mut, logger, stream, encoder)
+	if s.structuredErrors(request) {
+		defer func() {
+			if grpcError != nil {
+				sendErrorResponse(respFunc, toGRPCError(grpcError))
+			}
+		}()
+	}
+
 	moduleNames := make([]string, len(request.Modules.Modules))
 	for i := 0; i < len(moduleNames); i++ {
 		moduleNames[i] = request.Modules.Modules[i].Name
@@ -173,7 +245,7 @@ func (s *Tier1Service) Blocks(
 		zap.Uint64("stop_block", request.StopBlockNum),
 		zap.String("cursor", request.StartCursor),
 		zap.Strings("modules", moduleNames),
-		zap.String("output_module", request.OutputModule),
+		zap.Strings("output_modules", request.OutputModuleNames()),
 	}
 	fields = append(fields, zap.Bool("production_mode", request.ProductionMode))
 
@@ -186,20 +258,31 @@ func (s *Tier1Service) Blocks(
 	if err := outputmodules.ValidateTier1Request(request, s.blockType); err != nil {
 		return toGRPCError(bsstream.NewErrInvalidArg(fmt.Errorf("validate request: %w", err).Error()))
 	}
+	request.OutputModule = request.OutputModuleNames()[0]
+	if err := manifest.ValidateNetwork(request.Network, s.genesis.ID(ctx, logger)); err != nil {
+		return toGRPCError(bsstream.NewErrInvalidArg(err.Error()))
+	}
+	if err := manifest.ApplyModuleParams(request.Modules, request.Params); err != nil {
+		return toGRPCError(bsstream.NewErrInvalidArg(err.Error()))
+	}
 
-	outputGraph, err := outputmodules.NewOutputModuleGraph(request.OutputModule, request.ProductionMode, request.Modules)
+	outputGraph, err := outputmodules.NewOutputModulesGraph(request.OutputModuleNames(), request.ProductionMode, request.Modules)
 	if err != nil {
 		return bsstream.NewErrInvalidArg(err.Error())
 	}
+	if err := s.validateOutputGraph(request, outputGraph); err != nil {
+		return err
+	}
 
-	requestID := fmt.Sprintf("%s:%d:%d:%s:%t:%t:%s",
-		outputGraph.ModuleHashes().Get(request.OutputModule),
+	requestID := fmt.Sprintf("%s:%d:%d:%s:%t:%t:%s:%s",
+		outputModuleHashes(outputGraph),
 		request.StartBlockNum,
 		request.StopBlockNum,
 		request.StartCursor,
 		request.ProductionMode,
 		request.FinalBlocksOnly,
 		strings.Join(request.DebugInitialStoreSnapshotForModules, ","),
+		strings.Join(request.StoreDeltaModules, ","),
 	)
 
 	//	s.resolveCursor
@@ -220,7 +303,24 @@ func (s *Tier1Service) Blocks(
 		}
 	}()
 
-	err = s.blocks(runningContext, request, outputGraph, respFunc)
+	var outputSampling uint64
+	if !request.ProductionMode {
+		if sampling := req.Header().Get(substreams.OutputSamplingHeader); sampling != "" {
+			if ll, err := strconv.ParseUint(sampling, 10, 64); err == nil {
+				outputSampling = ll
+			}
+		}
+	}
+
+	if blockSource := req.Header().Get(substreams.BlockSourceHeader); blockSource != "" {
+		policy, err := ParseBlockSourcePolicy(blockSource)
+		if err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+		runningContext = withBlockSourcePolicy(runningContext, policy)
+	}
+
+	err = s.blocks(runningContext, request, outputGraph, outputSampling, respFunc, stream.ResponseTrailer())
 	if s.IsTerminating() {
 		return status.Error(codes.Canceled, "endpoint is shutting down, please reconnect")
 	}
@@ -244,21 +344,14 @@ func (s *Tier1Service) Blocks(
 	return nil
 }
 
-func (s *Tier1Service) blocks(ctx context.Context, request *pbsubstreamsrpc.Request, outputGraph *outputmodules.Graph, respFunc substreams.ResponseFunc) error {
+// blocks sets the `substreams.TerminationReasonTrailer` of `trailer`, when not
+// nil, once the stream ended without error.
+func (s *Tier1Service) blocks(ctx context.Context, request *pbsubstreamsrpc.Request, outputGraph *outputmodules.Graph, outputSampling uint64, respFunc substreams.ResponseFunc, trailer http.Header) error {
 	logger := reqctx.Logger(ctx)
 
-	requestDetails, undoSignal, err := pipeline.BuildRequestDetails(ctx, request, s.getRecentFinalBlock, s.resolveCursor, s.getHeadBlock)
+	requestDetails, undoSignal, err := s.buildRequestDetails(ctx, request, outputGraph)
 	if err != nil {
-		return fmt.Errorf("build request details: %w", err)
-	}
-
-	requestDetails.MaxParallelJobs = s.runtimeConfig.DefaultParallelSubrequests
-	if auth := dauth.FromContext(ctx); auth != nil {
-		if parallelJobs := auth.Get("X-Sf-Substreams-Parallel-Jobs"); parallelJobs != "" {
-			if ll, err := strconv.ParseUint(parallelJobs, 10, 64); err == nil {
-				requestDetails.MaxParallelJobs = ll
-			}
-		}
+		return err
 	}
 
 	if s.runtimeConfig.WithRequestStats {
@@ -268,13 +361,46 @@ func (s *Tier1Service) blocks(ctx context.Context, request *pbsubstreamsrpc.Requ
 	}
 
 	traceId := tracing.GetTraceID(ctx).String()
+	requestID := requestDetails.UniqueIDString()
+	activeRequest := s.activeRequests.add(&pbsubstreamsrpc.ActiveRequest{
+		RequestId:          requestID,
+		TraceId:            traceId,
+		UserId:             userID(ctx),
+		OutputModule:       request.OutputModule,
+		ProductionMode:     request.ProductionMode,
+		ResolvedStartBlock: requestDetails.ResolvedStartBlockNum,
+		LinearHandoffBlock: requestDetails.LinearHandoffBlockNum,
+		StopBlock:          request.StopBlockNum,
+	})
+	defer s.activeRequests.remove(requestID)
+	if s.billingReporter != nil {
+		var stopBilling func()
+		ctx, stopBilling = s.billingReporter.Track(ctx, billingRequest(ctx, traceId, "sf.substreams.rpc.v2/Blocks"), dmetering.GetBytesMeter(ctx))
+		defer stopBilling()
+	}
+	if s.moduleReload && !request.ProductionMode {
+		activeRequest.reload = newModuleReload(request)
+	}
+	clientRespFunc := respFunc
+	respFunc = func(resp substreams.ResponseFromAnyTier) error {
+		if resp, ok := resp.(*pbsubstreamsrpc.Response); ok {
+			activeRequest.observe(resp)
+		}
+		return clientRespFunc(resp)
+	}
+
 	respFunc(&pbsubstreamsrpc.Response{
 		Message: &pbsubstreamsrpc.Response_Session{
 			Session: &pbsubstreamsrpc.SessionInit{
-				TraceId:            traceId,
-				ResolvedStartBlock: requestDetails.ResolvedStartBlockNum,
-				LinearHandoffBlock: requestDetails.LinearHandoffBlockNum,
-				MaxParallelWorkers: requestDetails.MaxParallelJobs,
+				TraceId:             traceId,
+				ResolvedStartBlock:  requestDetails.ResolvedStartBlockNum,
+				LinearHandoffBlock:  requestDetails.LinearHandoffBlockNum,
+				MaxParallelWorkers:  requestDetails.MaxParallelJobs,
+				EnabledCapabilities: requestDetails.Capabilities,
+				DeprecatedModules:   outputGraph.DeprecatedModules(time.Now()),
+				Network:             s.network,
+				RequestId:           requestID,
+				GenesisBlockId:      s.genesis.ID(ctx, logger),
 			},
 		},
 	})
@@ -288,66 +414,261 @@ func (s *Tier1Service) blocks(ctx context.Context, request *pbsubstreamsrpc.Requ
 		return stream.NewErrInvalidArg(err.Error())
 	}
 
+	if s.admissionController != nil {
+		lease, err := s.admissionController.Admit(ctx, quotaKey(ctx))
+		if err != nil {
+			recordQuotaExceeded(err)
+			logger.Info("rejecting request", zap.Error(err))
+			return err
+		}
+		defer lease.Release()
+		ctx = withQuotaLease(ctx, lease)
+
+		leasedRespFunc := respFunc
+		respFunc = func(resp substreams.ResponseFromAnyTier) error {
+			if err := leasedRespFunc(resp); err != nil {
+				return err
+			}
+			if resp, ok := resp.(*pbsubstreamsrpc.Response); ok {
+				err := lease.AddStreamedBytes(uint64(proto.Size(resp)))
+				recordQuotaExceeded(err)
+				return err
+			}
+			return nil
+		}
+	}
+
+	if s.admission != nil {
+		release, err := s.admitRequest(ctx, activeRequest, respFunc)
+		if err != nil {
+			return err
+		}
+		defer release()
+	}
+
+	if s.progressMessagesPerSecond != 0 {
+		progress := responses.NewStream(respFunc, s.progressMessagesPerSecond)
+		respFunc = progress.Send
+		defer progress.Close()
+	}
+
+	moduleMeter := metrics.NewModuleMeter()
+	ctx = reqctx.WithModuleMeter(ctx, moduleMeter)
+	if requestDetails.HasCapability(substreams.CapabilityModuleStats) {
+		defer startModuleStats(ctx, moduleMeter, respFunc)()
+	}
+
+	for {
+		runCtx, cancelRun := context.WithCancel(ctx)
+		activeRequest.reload.start(cancelRun)
+		err := s.runRequestPipeline(runCtx, request, requestDetails, undoSignal, outputGraph, outputSampling, respFunc, trailer)
+		cancelRun()
+
+		modules := activeRequest.reload.take()
+		if modules == nil || err == nil || ctx.Err() != nil {
+			return err
+		}
+
+		request = reloadedRequest(request, modules, activeRequest.lastCursor.Load())
+		logger.Info("resuming request with reloaded modules", zap.String("cursor", request.StartCursor))
+		if err := manifest.ApplyModuleParams(request.Modules, request.Params); err != nil {
+			return stream.NewErrInvalidArg(err.Error())
+		}
+
+		outputGraph, err = outputmodules.NewOutputModulesGraph(request.OutputModuleNames(), request.ProductionMode, request.Modules)
+		if err != nil {
+			return stream.NewErrInvalidArg(err.Error())
+		}
+		requestDetails, undoSignal, err = s.buildRequestDetails(ctx, request, outputGraph)
+		if err != nil {
+			return err
+		}
+		ctx = reqctx.WithRequest(ctx, requestDetails)
+	}
+}
+
+// runRequestPipeline runs the pipeline of `request`, or serves it from the
+// shared pipeline of the identical live requests, see fanOut.
+func (s *Tier1Service) runRequestPipeline(ctx context.Context, request *pbsubstreamsrpc.Request, requestDetails *reqctx.RequestDetails, undoSignal *pbsubstreamsrpc.BlockUndoSignal, outputGraph *outputmodules.Graph, outputSampling uint64, respFunc substreams.ResponseFunc, trailer http.Header) error {
+	if s.fanOut != nil {
+		if key, ok := fanOutKey(request, requestDetails, outputGraph, outputSampling, undoSignal); ok {
+			return s.fanOut.serve(ctx, key, request.StartCursor, requestDetails.ResolvedStartBlockNum, respFunc, func(ctx context.Context, respFunc substreams.ResponseFunc) error {
+				// without trailer: a live request only ends on errors, and the shared pipeline can outlive the request starting it
+				return s.runPipeline(ctx, request, requestDetails, undoSignal, outputGraph, outputSampling, respFunc, nil)
+			})
+		}
+	}
+	return s.runPipeline(ctx, request, requestDetails, undoSignal, outputGraph, outputSampling, respFunc, trailer)
+}
+
+func (s *Tier1Service) buildRequestDetails(ctx context.Context, request *pbsubstreamsrpc.Request, outputGraph *outputmodules.Graph) (*reqctx.RequestDetails, *pbsubstreamsrpc.BlockUndoSignal, error) {
+	requestDetails, undoSignal, err := pipeline.BuildRequestDetails(ctx, request, s.getRecentFinalBlock, s.resolveCursor, s.getHeadBlock)
+	if err != nil {
+		return nil, nil, fmt.Errorf("build request details: %w", err)
+	}
+
+	requestDetails.MaxParallelJobs = s.maxParallelJobs(ctx)
+	requestDetails.Capabilities = substreams.NegotiateCapabilities(request.Capabilities, s.runtimeConfig.EnabledCapabilities())
+
+	if uncached := blockIsFinalModules(request.Modules, outputGraph.UsedModules()); len(uncached) != 0 {
+		if !requestDetails.HasCapability(substreams.CapabilityBlockIsFinal) {
+			names := make([]string, 0, len(uncached))
+			for name := range uncached {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return nil, nil, bsstream.NewErrInvalidArg(fmt.Sprintf("modules %s use block::is_final, whose result depends on when a block is processed: the request must announce the %q capability", strings.Join(names, ", "), substreams.CapabilityBlockIsFinal))
+		}
+		requestDetails.UncachedModules = uncached
+	}
+	return requestDetails, undoSignal, nil
+}
+
+// runPipeline serves `request` from its resolved start block, with the
+// modules of `outputGraph`.
+func (s *Tier1Service) runPipeline(ctx context.Context, request *pbsubstreamsrpc.Request, requestDetails *reqctx.RequestDetails, undoSignal *pbsubstreamsrpc.BlockUndoSignal, outputGraph *outputmodules.Graph, outputSampling uint64, respFunc substreams.ResponseFunc, trailer http.Header) error {
+	logger := reqctx.Logger(ctx)
+
 	wasmRuntime := wasm.NewRegistry(s.wasmExtensions, s.runtimeConfig.MaxWasmFuel)
+	wasmRuntime.SetExecutionTimeout(s.runtimeConfig.ModuleExecutionTimeout)
+	wasmRuntime.SetExtensionBreakers(s.runtimeConfig.ExtensionBreakers)
+
+	stateStore := s.runtimeConfig.BaseObjectStore
+	if requestDetails.ProductionMode {
+		stateStore = withLineage(stateStore, outputGraph)
+	}
 
-	execOutputConfigs, err := execout.NewConfigs(s.runtimeConfig.BaseObjectStore, outputGraph.UsedModules(), outputGraph.ModuleHashes(), s.runtimeConfig.CacheSaveInterval, logger)
+	execOutputConfigs, err := execout.NewConfigs(stateStore, outputGraph.UsedModules(), outputGraph.ModuleHashes(), s.runtimeConfig.CacheSaveInterval, logger)
 	if err != nil {
 		return fmt.Errorf("new config map: %w", err)
 	}
+	execOutputConfigs.SetAccessTracker(s.runtimeConfig.ExecOutAccessTracker)
+	execOutputConfigs.SetIdempotencyLedger(s.runtimeConfig.IdempotencyLedger, tracing.GetTraceID(ctx).String())
+	if s.runtimeConfig.ContentAddressedOutputs {
+		execOutputConfigs.SetContentAddressed()
+	}
 
-	storeConfigs, err := store.NewConfigMap(s.runtimeConfig.BaseObjectStore, outputGraph.Stores(), outputGraph.ModuleHashes(), tracing.GetTraceID(ctx).String())
+	storeConfigs, err := store.NewConfigMap(stateStore, outputGraph.Stores(), outputGraph.ModuleHashes(), tracing.GetTraceID(ctx).String())
 	if err != nil {
 		return fmt.Errorf("configuring stores: %w", err)
 	}
-
-	stores := pipeline.NewStores(storeConfigs, s.runtimeConfig.CacheSaveInterval, requestDetails.LinearHandoffBlockNum, request.StopBlockNum, false, "tier1")
-
-	execOutputCacheEngine, err := cache.NewEngine(ctx, s.runtimeConfig, nil, s.blockType)
-	if err != nil {
-		return fmt.Errorf("error building caching engine: %w", err)
+	if requestDetails.ProductionMode {
+		storeConfigs.SetLineageLinks(lineageLinks(outputGraph))
+	}
+	storeConfigs.SetIdempotencyLedger(s.runtimeConfig.IdempotencyLedger)
+	if s.runtimeConfig.CommitStoreFlushes {
+		storeConfigs.SetCommits(store.NewCommits(stateStore))
 	}
 
-	opts := s.buildPipelineOptions(ctx)
+	var undoMessage *pbsubstreamsrpc.Response
 	if undoSignal != nil {
-		opts = append(opts, pipeline.WithPendingUndoMessage(
-			&pbsubstreamsrpc.Response{
-				Message: &pbsubstreamsrpc.Response_BlockUndoSignal{
-					BlockUndoSignal: undoSignal,
-				},
-			}))
+		undoMessage = &pbsubstreamsrpc.Response{
+			Message: &pbsubstreamsrpc.Response_BlockUndoSignal{
+				BlockUndoSignal: undoSignal,
+			},
+		}
 	}
-	if request.FinalBlocksOnly {
-		opts = append(opts, pipeline.WithFinalBlocksOnly())
+
+	cursorIsTarget := requestDetails.ResolvedStartBlockNum != requestDetails.LinearHandoffBlockNum
+	if chunks := requestChunks(requestDetails.ResolvedStartBlockNum, requestDetails.LinearHandoffBlockNum, s.requestChunkSize, s.runtimeConfig.CacheSaveInterval); len(chunks) != 0 {
+		if err := s.backprocessChunks(ctx, chunks, outputGraph, storeConfigs, execOutputConfigs, wasmRuntime, undoMessage, respFunc); err != nil {
+			return err
+		}
+
+		// the pipeline serves the last chunk, from where the previous one ended
+		remaining := *requestDetails
+		remaining.ResolvedStartBlockNum = chunks[len(chunks)-1].ExclusiveEndBlock
+		requestDetails = &remaining
+		ctx = reqctx.WithRequest(ctx, requestDetails)
+		undoMessage = nil
 	}
 
-	pipe := pipeline.New(
-		ctx,
-		outputGraph,
-		stores,
-		execOutputConfigs,
-		wasmRuntime,
-		execOutputCacheEngine,
-		s.runtimeConfig,
-		respFunc,
-		"tier1",
-		tracing.GetTraceID(ctx).String(),
-		opts...,
-	)
+	if outputSampling > 1 {
+		logger.Info("sampling module outputs sent to client", zap.Uint64("every_nth_block", outputSampling))
+	}
 
-	logger.Info("initializing pipeline",
-		zap.Int64("request_start_block", request.StartBlockNum),
-		zap.Uint64("resolved_start_block", requestDetails.ResolvedStartBlockNum),
-		zap.Uint64("request_stop_block", request.StopBlockNum),
-		zap.String("request_start_cursor", request.StartCursor),
-		zap.String("resolved_cursor", requestDetails.ResolvedCursor),
-		zap.String("output_module", request.OutputModule),
-	)
+	// newPipe builds the pipeline serving the request details of `ctx`, and
+	// backprocesses its stores and outputs up to their linear handoff block
+	newPipe := func(ctx context.Context, undoMessage *pbsubstreamsrpc.Response) (*pipeline.Pipeline, error) {
+		requestDetails := reqctx.Details(ctx)
+		stores := pipeline.NewStores(storeConfigs, s.runtimeConfig.CacheSaveInterval, requestDetails.LinearHandoffBlockNum, request.StopBlockNum, false, "tier1")
 
-	if err := pipe.InitStoresAndBackprocess(ctx); err != nil {
-		return fmt.Errorf("error during init_stores_and_backprocess: %w", err)
+		execOutputCacheEngine, err := cache.NewEngine(ctx, s.runtimeConfig, nil, s.blockType)
+		if err != nil {
+			return nil, fmt.Errorf("error building caching engine: %w", err)
+		}
+
+		opts := s.buildPipelineOptions(ctx)
+		if undoMessage != nil {
+			opts = append(opts, pipeline.WithPendingUndoMessage(undoMessage))
+		}
+		if request.FinalBlocksOnly {
+			opts = append(opts, pipeline.WithFinalBlocksOnly())
+		}
+		if len(request.StoreDeltaModules) != 0 {
+			opts = append(opts, pipeline.WithStoreDeltaModules(request.StoreDeltaModules))
+		}
+		if outputSampling > 1 {
+			opts = append(opts, pipeline.WithOutputSampling(outputSampling))
+		}
+		if request.StopConditions != nil {
+			opts = append(opts, pipeline.WithStopConditions(request.StopConditions))
+		}
+
+		pipe := pipeline.New(
+			ctx,
+			outputGraph,
+			stores,
+			execOutputConfigs,
+			wasmRuntime,
+			execOutputCacheEngine,
+			s.runtimeConfig,
+			respFunc,
+			"tier1",
+			tracing.GetTraceID(ctx).String(),
+			opts...,
+		)
+
+		logger.Info("initializing pipeline",
+			zap.Int64("request_start_block", request.StartBlockNum),
+			zap.Uint64("resolved_start_block", requestDetails.ResolvedStartBlockNum),
+			zap.Uint64("linear_handoff_block", requestDetails.LinearHandoffBlockNum),
+			zap.Uint64("request_stop_block", request.StopBlockNum),
+			zap.String("request_start_cursor", request.StartCursor),
+			zap.String("resolved_cursor", requestDetails.ResolvedCursor),
+			zap.String("output_module", request.OutputModule),
+		)
+
+		if err := pipe.InitStoresAndBackprocess(ctx); err != nil {
+			return nil, fmt.Errorf("error during init_stores_and_backprocess: %w", err)
+		}
+		return pipe, nil
+	}
+
+	pipe, err := newPipe(ctx, undoMessage)
+	if err != nil {
+		return err
+	}
+
+	if s.handoffCatchUpBlocks != 0 && requestDetails.ResolvedStartBlockNum < requestDetails.LinearHandoffBlockNum {
+		handoff, err := s.catchUpHandoff(ctx, request.StopBlockNum, outputGraph, storeConfigs, execOutputConfigs, wasmRuntime, respFunc)
+		if err != nil {
+			return err
+		}
+		if handoff != requestDetails.LinearHandoffBlockNum {
+			// the stream starts where the catch-up ended, with the stores saved there
+			caughtUp := *requestDetails
+			caughtUp.ResolvedStartBlockNum = handoff
+			caughtUp.LinearHandoffBlockNum = handoff
+			requestDetails = &caughtUp
+			ctx = reqctx.WithRequest(ctx, requestDetails)
+			if pipe, err = newPipe(ctx, nil); err != nil {
+				return err
+			}
+		}
 	}
 	if requestDetails.LinearHandoffBlockNum == request.StopBlockNum {
-		return pipe.OnStreamTerminated(ctx, nil)
+		return onStreamTerminated(ctx, pipe, nil, trailer)
 	}
 
 	if err := pipe.InitWASM(ctx); err != nil {
@@ -356,10 +677,6 @@ func (s *Tier1Service) blocks(ctx context.Context, request *pbsubstreamsrpc.Requ
 
 	var streamErr error
 	cursor := requestDetails.ResolvedCursor
-	var cursorIsTarget bool
-	if requestDetails.ResolvedStartBlockNum != requestDetails.LinearHandoffBlockNum {
-		cursorIsTarget = true
-	}
 	logger.Info("creating firehose stream",
 		zap.Uint64("handoff_block", requestDetails.LinearHandoffBlockNum),
 		zap.Uint64("stop_block", request.StopBlockNum),
@@ -384,7 +701,204 @@ func (s *Tier1Service) blocks(ctx context.Context, request *pbsubstreamsrpc.Requ
 	streamErr = blockStream.Run(ctx)
 	span.EndWithErr(&streamErr)
 
-	return pipe.OnStreamTerminated(ctx, streamErr)
+	return onStreamTerminated(ctx, pipe, streamErr, trailer)
+}
+
+func onStreamTerminated(ctx context.Context, pipe *pipeline.Pipeline, streamErr error, trailer http.Header) error {
+	if err := pipe.OnStreamTerminated(ctx, streamErr); err != nil {
+		return err
+	}
+	if trailer != nil {
+		trailer.Set(substreams.TerminationReasonTrailer, pipe.TerminationReason())
+	}
+	return nil
+}
+
+// Explain builds the backprocessing plan of the request, the way `Blocks` does,
+// and returns it without executing any of its jobs.
+func (s *Tier1Service) Explain(
+	ctx context.Context,
+	req *connect.Request[pbsubstreamsrpc.Request],
+) (*connect.Response[pbsubstreamsrpc.ExplainResponse], error) {
+	logger := reqctx.Logger(ctx).Named("tier1")
+	ctx = logging.WithLogger(ctx, logger)
+
+	request := req.Msg
+	if request.Modules == nil {
+		return nil, status.Error(codes.InvalidArgument, "missing modules in request")
+	}
+
+	logger.Info("incoming Substreams Explain request",
+		zap.Int64("start_block", request.StartBlockNum),
+		zap.Uint64("stop_block", request.StopBlockNum),
+		zap.Strings("output_modules", request.OutputModuleNames()),
+		zap.Bool("production_mode", request.ProductionMode),
+	)
+
+	if err := outputmodules.ValidateTier1Request(request, s.blockType); err != nil {
+		return nil, toGRPCError(bsstream.NewErrInvalidArg(fmt.Errorf("validate request: %w", err).Error()))
+	}
+	request.OutputModule = request.OutputModuleNames()[0]
+	if err := manifest.ValidateNetwork(request.Network, s.genesis.ID(ctx, logger)); err != nil {
+		return nil, toGRPCError(bsstream.NewErrInvalidArg(err.Error()))
+	}
+	if err := manifest.ApplyModuleParams(request.Modules, request.Params); err != nil {
+		return nil, toGRPCError(bsstream.NewErrInvalidArg(err.Error()))
+	}
+
+	outputGraph, err := outputmodules.NewOutputModulesGraph(request.OutputModuleNames(), request.ProductionMode, request.Modules)
+	if err != nil {
+		return nil, toGRPCError(bsstream.NewErrInvalidArg(err.Error()))
+	}
+
+	explanation, err := s.explain(ctx, request, outputGraph)
+	if err != nil {
+		return nil, toGRPCError(err)
+	}
+	return connect.NewResponse(explanation), nil
+}
+
+func (s *Tier1Service) explain(ctx context.Context, request *pbsubstreamsrpc.Request, outputGraph *outputmodules.Graph) (*pbsubstreamsrpc.ExplainResponse, error) {
+	logger := reqctx.Logger(ctx)
+
+	requestDetails, _, err := pipeline.BuildRequestDetails(ctx, request, s.getRecentFinalBlock, s.resolveCursor, s.getHeadBlock)
+	if err != nil {
+		return nil, fmt.Errorf("build request details: %w", err)
+	}
+	requestDetails.MaxParallelJobs = s.maxParallelJobs(ctx)
+	ctx = reqctx.WithRequest(ctx, requestDetails)
+
+	if err := outputGraph.ValidateRequestStartBlock(requestDetails.ResolvedStartBlockNum); err != nil {
+		return nil, stream.NewErrInvalidArg(err.Error())
+	}
+
+	stateStore := s.runtimeConfig.BaseObjectStore
+	if requestDetails.ProductionMode {
+		stateStore = withLineage(stateStore, outputGraph)
+	}
+
+	execOutputConfigs, err := execout.NewConfigs(stateStore, outputGraph.UsedModules(), outputGraph.ModuleHashes(), s.runtimeConfig.CacheSaveInterval, logger)
+	if err != nil {
+		return nil, fmt.Errorf("new config map: %w", err)
+	}
+
+	storeConfigs, err := store.NewConfigMap(stateStore, outputGraph.Stores(), outputGraph.ModuleHashes(), tracing.GetTraceID(ctx).String())
+	if err != nil {
+		return nil, fmt.Errorf("configuring stores: %w", err)
+	}
+	if s.runtimeConfig.CommitStoreFlushes {
+		storeConfigs.SetCommits(store.NewCommits(stateStore))
+	}
+
+	return orchestrator.ExplainPlan(ctx, requestDetails, s.runtimeConfig, outputGraph, execOutputConfigs, storeConfigs)
+}
+
+// StoreKeyHistory replays the deltas of a single key of a store module over a
+// block range from the module's cached outputs, without executing anything.
+func (s *Tier1Service) StoreKeyHistory(
+	ctx context.Context,
+	req *connect.Request[pbsubstreamsrpc.StoreKeyHistoryRequest],
+) (*connect.Response[pbsubstreamsrpc.StoreKeyHistoryResponse], error) {
+	logger := reqctx.Logger(ctx).Named("tier1")
+	ctx = logging.WithLogger(ctx, logger)
+
+	request := req.Msg
+	if request.Modules == nil {
+		return nil, status.Error(codes.InvalidArgument, "missing modules in request")
+	}
+	if request.StopBlock <= request.StartBlock {
+		return nil, status.Error(codes.InvalidArgument, "stop block must be greater than start block")
+	}
+
+	logger.Info("incoming Substreams StoreKeyHistory request",
+		zap.String("module", request.Module),
+		zap.String("key", request.Key),
+		zap.Uint64("start_block", request.StartBlock),
+		zap.Uint64("stop_block", request.StopBlock),
+	)
+
+	outputGraph, err := outputmodules.NewOutputModuleGraph(request.Module, false, request.Modules)
+	if err != nil {
+		return nil, toGRPCError(bsstream.NewErrInvalidArg(err.Error()))
+	}
+
+	execOutputConfigs, err := execout.NewConfigs(withLineage(s.runtimeConfig.BaseObjectStore, outputGraph), outputGraph.UsedModules(), outputGraph.ModuleHashes(), s.runtimeConfig.CacheSaveInterval, logger)
+	if err != nil {
+		return nil, toGRPCError(fmt.Errorf("new config map: %w", err))
+	}
+	if kind := execOutputConfigs.ConfigMap[request.Module].ModuleKind(); kind != pbsubstreams.ModuleKindStore {
+		return nil, toGRPCError(bsstream.NewErrInvalidArg(fmt.Sprintf("module %q is not a store", request.Module)))
+	}
+
+	mutations, missing, err := execOutputConfigs.KeyHistory(ctx, request.Module, request.Key, block.NewRange(request.StartBlock, request.StopBlock))
+	if err != nil {
+		return nil, toGRPCError(fmt.Errorf("store key history: %w", err))
+	}
+
+	out := &pbsubstreamsrpc.StoreKeyHistoryResponse{}
+	for _, mutation := range mutations {
+		out.Mutations = append(out.Mutations, &pbsubstreamsrpc.StoreKeyMutation{
+			BlockNum: mutation.BlockNum,
+			BlockId:  mutation.BlockID,
+			Delta:    pipeline.ToRPCDelta(mutation.Delta),
+		})
+	}
+	for _, rng := range missing {
+		out.MissingRanges = append(out.MissingRanges, &pbsubstreamsrpc.BlockRange{
+			StartBlock: rng.StartBlock,
+			EndBlock:   rng.ExclusiveEndBlock,
+		})
+	}
+	return connect.NewResponse(out), nil
+}
+
+// validateOutputGraph checks the modules of `outputGraph`, built from the
+// modules of `request`, against the options of the request and of the server.
+func (s *Tier1Service) validateOutputGraph(request *pbsubstreamsrpc.Request, outputGraph *outputmodules.Graph) error {
+	if len(request.StoreDeltaModules) != 0 {
+		if !s.storeDeltaStreams {
+			return status.Error(codes.Unimplemented, "store delta streaming is not enabled on this endpoint")
+		}
+		if err := outputGraph.ValidateStoreDeltaModules(request.StoreDeltaModules); err != nil {
+			return toGRPCError(bsstream.NewErrInvalidArg(err.Error()))
+		}
+	}
+	if err := outputGraph.ValidateStopConditions(request.StopConditions); err != nil {
+		return toGRPCError(bsstream.NewErrInvalidArg(err.Error()))
+	}
+	if err := outputGraph.ValidateStoreSeeds(s.runtimeConfig.StoreSeedURLPrefixes); err != nil {
+		return toGRPCError(bsstream.NewErrInvalidArg(err.Error()))
+	}
+	if err := validateHostFunctions(request.Modules, outputGraph.UsedModules(), s.wasmExtensions); err != nil {
+		return toGRPCError(err)
+	}
+	if !request.AllowSunsetModules {
+		if err := outputGraph.ValidateSunsets(time.Now()); err != nil {
+			return status.Error(codes.FailedPrecondition, err.Error())
+		}
+	}
+	return nil
+}
+
+// userID is the user ID of the authenticated caller, empty if unknown.
+func userID(ctx context.Context) string {
+	if auth := dauth.FromContext(ctx); auth != nil {
+		return auth.UserID()
+	}
+	return ""
+}
+
+// maxParallelJobs is the number of jobs a request can run in parallel, from the
+// `X-Sf-Substreams-Parallel-Jobs` authentication header if set.
+func (s *Tier1Service) maxParallelJobs(ctx context.Context) uint64 {
+	if auth := dauth.FromContext(ctx); auth != nil {
+		if parallelJobs := auth.Get("X-Sf-Substreams-Parallel-Jobs"); parallelJobs != "" {
+			if ll, err := strconv.ParseUint(parallelJobs, 10, 64); err == nil {
+				return ll
+			}
+		}
+	}
+	return s.runtimeConfig.DefaultParallelSubrequests
 }
 
 func (s *Tier1Service) buildPipelineOptions(ctx context.Context) (opts []pipeline.Option) {
@@ -395,7 +909,9 @@ func (s *Tier1Service) buildPipelineOptions(ctx context.Context) (opts []pipelin
 	return
 }
 
-func tier1ResponseHandler(ctx context.Context, mut *sync.Mutex, logger *zap.Logger, streamSrv *connect.ServerStream[pbsubstreamsrpc.Response]) substreams.ResponseFunc {
+// tier1ResponseHandler sends the responses to the client, re-encoding their
+// outputs with `encoder` if not nil.
+func tier1ResponseHandler(ctx context.Context, mut *sync.Mutex, logger *zap.Logger, streamSrv *connect.ServerStream[pbsubstreamsrpc.Response], encoder *outputencoding.Encoder) substreams.ResponseFunc {
 	auth := dauth.FromContext(ctx)
 	userID := auth.UserID()
 	apiKeyID := auth.APIKeyID()
@@ -411,12 +927,21 @@ func tier1ResponseHandler(ctx context.Context, mut *sync.Mutex, logger *zap.Logg
 		if ctx.Err() != nil {
 			return ctx.Err()
 		}
+
+		var encoded *outputencoding.Stats
+		if encoder != nil {
+			var err error
+			if encoded, err = encoder.EncodeResponse(resp); err != nil {
+				return status.Error(codes.InvalidArgument, fmt.Sprintf("output encoding: %s", err))
+			}
+		}
+
 		if err := streamSrv.Send(resp); err != nil {
 			logger.Info("unable to send block probably due to client disconnecting", zap.Error(err))
 			return status.Error(codes.Unavailable, err.Error())
 		}
 
-		sendMetering(meter, userID, apiKeyID, ip, "sf.substreams.rpc.v2/Blocks", resp)
+		sendMetering(meter, userID, apiKeyID, ip, "sf.substreams.rpc.v2/Blocks", resp, encoder, encoded)
 		return nil
 	}
 }
@@ -434,46 +959,3 @@ func setupRequestStats(ctx context.Context, requestDetails *reqctx.RequestDetail
 	}, logger)
 	return reqctx.WithReqStats(ctx, stats), stats
 }
-
-// toGRPCError turns an `err` into a gRPC error if it's non-nil, in the `nil` case,
-// `nil` is returned right away.
-//
-// If the `err` has in its chain of error either `context.Canceled`, `context.DeadlineExceeded`
-// or `stream.ErrInvalidArg`, error is turned into a proper gRPC error respectively of code
-// `Canceled`, `DeadlineExceeded` or `InvalidArgument`.
-//
-// If the `err` has its in chain any error constructed through `status.Error` (and its variants), then
-// we return the first found error of such type directly, because it's already a gRPC error.
-//
-// Otherwise, the error is assumed to be an internal error and turned backed into a proper
-// `status.Error(codes.Internal, err.Error())`.
-func toGRPCError(err error) error {
-	if err == nil {
-		return nil
-	}
-
-	if grpcError := dgrpc.AsGRPCError(err); grpcError != nil {
-		return grpcError.Err()
-	}
-
-	if errors.Is(err, context.Canceled) {
-		return status.Error(codes.Canceled, "source canceled")
-	}
-
-	if errors.Is(err, context.DeadlineExceeded) {
-		return status.Error(codes.DeadlineExceeded, "source deadline exceeded")
-	}
-
-	if errors.Is(err, exec.ErrWasmDeterministicExec) {
-		return status.Error(codes.InvalidArgument, err.Error())
-	}
-
-	var errInvalidArg *stream.ErrInvalidArg
-	if errors.As(err, &errInvalidArg) {
-		return status.Error(codes.InvalidArgument, errInvalidArg.Error())
-	}
-
-	// Do we want to print the full cause as coming from Golang? Would we like to maybe trim off "operational"
-	// data?
-	return status.Error(codes.Internal, err.Error())
-}
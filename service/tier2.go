@@ -9,18 +9,24 @@ import (
 	"github.com/streamingfast/dstore"
 	"github.com/streamingfast/logging"
 	tracing "github.com/streamingfast/sf-tracing"
+	"math/rand"
 	"os"
 
 	"github.com/streamingfast/substreams"
+	"github.com/streamingfast/substreams/billing"
 	"github.com/streamingfast/substreams/metrics"
 	pbssinternal "github.com/streamingfast/substreams/pb/sf/substreams/intern/v2"
 	"github.com/streamingfast/substreams/pipeline"
 	"github.com/streamingfast/substreams/pipeline/cache"
 	"github.com/streamingfast/substreams/pipeline/outputmodules"
 	"github.com/streamingfast/substreams/reqctx"
+	"github.com/streamingfast/substreams/service/blockcache"
 	"github.com/streamingfast/substreams/service/config"
 	"github.com/streamingfast/substreams/storage/execout"
+	"github.com/streamingfast/substreams/storage/index"
+	"github.com/streamingfast/substreams/storage/pinned"
 	"github.com/streamingfast/substreams/storage/store"
+	"github.com/streamingfast/substreams/storage/traced"
 	"github.com/streamingfast/substreams/wasm"
 	"go.opentelemetry.io/otel/attribute"
 	ttrace "go.opentelemetry.io/otel/trace"
@@ -31,13 +37,23 @@ import (
 )
 
 type Tier2Service struct {
-	blockType         string
-	wasmExtensions    []wasm.WASMExtensioner
-	pipelineOptions   []pipeline.PipelineOptioner
-	streamFactoryFunc StreamFactoryFunc
-	runtimeConfig     config.RuntimeConfig
-	tracer            ttrace.Tracer
-	logger            *zap.Logger
+	blockType            string
+	wasmExtensions       []wasm.WASMExtensioner
+	pipelineOptions      []pipeline.PipelineOptioner
+	streamFactoryFunc    StreamFactoryFunc
+	runtimeConfig        config.RuntimeConfig
+	blockCache           *blockcache.Cache
+	wasmCompilationCache *wasm.CompilationCache
+	wasmModulePool       *wasm.ModulePool // nil when the modules are not reused across jobs
+	storeSpillDir        string
+	storeSpillThreshold  uint64
+	storeFileCache       *store.FileCache
+	readiness            *readiness
+	billingReporter      *billing.Reporter // nil when the usage of the requests is not reported
+	tracer               ttrace.Tracer
+	logger               *zap.Logger
+
+	determinismAuditFraction float64 // fraction of the jobs whose modules are executed twice, see WithDeterminismAudit
 }
 
 func NewTier2(
@@ -66,20 +82,35 @@ func NewTier2(
 		blockType:     blockType,
 		tracer:        tracing.GetTracer(),
 		logger:        logger,
+		readiness: newReadiness(logger,
+			storageReadinessProbe("state_store", stateStore),
+			storageReadinessProbe("merged_blocks_store", mergedBlocksStore),
+		),
 	}
 
-	sf := &StreamFactory{
-		mergedBlocksStore: mergedBlocksStore,
-	}
-
-	s.streamFactoryFunc = sf.New
-
 	metrics.RegisterMetricSet(logger)
 
 	for _, opt := range opts {
 		opt(s)
 	}
 
+	if s.runtimeConfig.PinnedCache != nil {
+		// outermost, see pinned.Store
+		s.runtimeConfig.BaseObjectStore = pinned.NewStore(s.runtimeConfig.BaseObjectStore, s.runtimeConfig.PinnedCache, s.runtimeConfig.PinnedModuleHashes)
+	}
+	// records the state store calls in the trace of the request making them
+	s.runtimeConfig.BaseObjectStore = traced.NewStore(s.runtimeConfig.BaseObjectStore)
+
+	if s.blockCache != nil {
+		mergedBlocksStore = s.blockCache.Wrap(mergedBlocksStore)
+	}
+
+	sf := &StreamFactory{
+		mergedBlocksStore: mergedBlocksStore,
+	}
+
+	s.streamFactoryFunc = sf.New
+
 	return s
 }
 
@@ -135,8 +166,15 @@ func (s *Tier2Service) ProcessRange(request *pbssinternal.ProcessRangeRequest, s
 	}
 	logger.Info("incoming substreams ProcessRange request", fields...)
 
+	traceID := tracing.GetTraceID(ctx).String()
+	if s.billingReporter != nil {
+		var stopBilling func()
+		ctx, stopBilling = s.billingReporter.Track(ctx, billingRequest(ctx, traceID, "sf.substreams.internal.v2/ProcessRange"), dmetering.GetBytesMeter(ctx))
+		defer stopBilling()
+	}
+
 	respFunc := tier2ResponseHandler(ctx, logger, streamSrv)
-	err = s.processRange(ctx, request, respFunc, tracing.GetTraceID(ctx).String())
+	err = s.processRange(ctx, request, respFunc, traceID)
 	grpcError = toGRPCError(err)
 
 	if grpcError != nil && status.Code(grpcError) == codes.Internal {
@@ -153,13 +191,20 @@ func (s *Tier2Service) processRange(ctx context.Context, request *pbssinternal.P
 		return stream.NewErrInvalidArg(fmt.Errorf("validate request: %w", err).Error())
 	}
 
-	outputGraph, err := outputmodules.NewOutputModuleGraph(request.OutputModule, true, request.Modules)
+	// A store job carrying the outputs of a map module runs the graph of that
+	// map, which includes the job's store and writes the map's outputs.
+	graphOutputModule := request.OutputModule
+	if request.CachedOutputModule != "" {
+		graphOutputModule = request.CachedOutputModule
+	}
+	outputGraph, err := outputmodules.NewOutputModuleGraph(graphOutputModule, true, request.Modules)
 	if err != nil {
 		return stream.NewErrInvalidArg(err.Error())
 	}
 
 	requestDetails := pipeline.BuildRequestDetailsFromSubrequest(request)
 	ctx = reqctx.WithRequest(ctx, requestDetails)
+	ctx = reqctx.WithModuleMeter(ctx, metrics.NewModuleMeter())
 	if s.runtimeConfig.ModuleExecutionTracing {
 		ctx = reqctx.WithModuleExecutionTracing(ctx)
 	}
@@ -173,19 +218,56 @@ func (s *Tier2Service) processRange(ctx context.Context, request *pbssinternal.P
 	if err := outputGraph.ValidateRequestStartBlock(requestDetails.ResolvedStartBlockNum); err != nil {
 		return stream.NewErrInvalidArg(err.Error())
 	}
+	if err := outputGraph.ValidateStoreSeeds(s.runtimeConfig.StoreSeedURLPrefixes); err != nil {
+		return stream.NewErrInvalidArg(err.Error())
+	}
+	if err := validateHostFunctions(request.Modules, outputGraph.UsedModules(), s.wasmExtensions); err != nil {
+		return err
+	}
 
 	wasmRuntime := wasm.NewRegistry(s.wasmExtensions, s.runtimeConfig.MaxWasmFuel)
+	wasmRuntime.SetExecutionTimeout(s.runtimeConfig.ModuleExecutionTimeout)
+	wasmRuntime.SetExtensionBreakers(s.runtimeConfig.ExtensionBreakers)
+	if s.wasmCompilationCache != nil {
+		wasmRuntime.SetCompilationCache(s.wasmCompilationCache)
+	}
+	if s.wasmModulePool != nil {
+		wasmRuntime.SetModulePool(s.wasmModulePool)
+	}
+
+	// The jobs are only run for the ranges tier1 found missing, its production
+	// mode requests having planned them with the caches of the compatible modules.
+	stateStore := withLineage(s.runtimeConfig.BaseObjectStore, outputGraph)
 
-	execOutputConfigs, err := execout.NewConfigs(s.runtimeConfig.BaseObjectStore, outputGraph.UsedModules(), outputGraph.ModuleHashes(), s.runtimeConfig.CacheSaveInterval, logger)
+	execOutputConfigs, err := execout.NewConfigs(stateStore, outputGraph.UsedModules(), outputGraph.ModuleHashes(), s.runtimeConfig.CacheSaveInterval, logger)
 	if err != nil {
 		return fmt.Errorf("new config map: %w", err)
 	}
+	execOutputConfigs.SetAccessTracker(s.runtimeConfig.ExecOutAccessTracker)
+	execOutputConfigs.SetIdempotencyLedger(s.runtimeConfig.IdempotencyLedger, traceID)
+	if s.runtimeConfig.ContentAddressedOutputs {
+		execOutputConfigs.SetContentAddressed()
+	}
 
-	storeConfigs, err := store.NewConfigMap(s.runtimeConfig.BaseObjectStore, outputGraph.Stores(), outputGraph.ModuleHashes(), traceID)
+	storeConfigs, err := store.NewConfigMap(stateStore, outputGraph.Stores(), outputGraph.ModuleHashes(), traceID)
 	if err != nil {
 		return fmt.Errorf("configuring stores: %w", err)
 	}
+	storeConfigs.SetLineageLinks(lineageLinks(outputGraph))
+	storeConfigs.SetIdempotencyLedger(s.runtimeConfig.IdempotencyLedger)
+	if s.runtimeConfig.CommitStoreFlushes {
+		storeConfigs.SetCommits(store.NewCommits(stateStore))
+	}
+	for _, storeConfig := range storeConfigs {
+		if s.storeSpillThreshold != 0 {
+			storeConfig.SetSpill(s.storeSpillDir, s.storeSpillThreshold)
+		}
+		if s.storeFileCache != nil {
+			storeConfig.SetFileCache(s.storeFileCache)
+		}
+	}
 	stores := pipeline.NewStores(storeConfigs, s.runtimeConfig.CacheSaveInterval, requestDetails.ResolvedStartBlockNum, request.StopBlockNum, true, "tier2")
+	defer stores.Close(ctx)
 
 	// TODO(abourget): why would this start at the LinearHandoffBlockNum ?
 	//  * in direct mode, this would mean we start writing files after the handoff,
@@ -193,21 +275,38 @@ func (s *Tier2Service) processRange(ctx context.Context, request *pbssinternal.P
 	//    and the OutputWriter doesn't know if that `initialBlockBoundary` is the  module's init Block?
 	//  *
 	outputModule := outputGraph.OutputModule()
-	execOutWriter := execout.NewWriter(
-		requestDetails.ResolvedStartBlockNum,
-		requestDetails.StopBlockNum,
-		outputModule.Name,
-		execOutputConfigs,
-		true,
-	)
+	var execOutWriter execout.OutputWriter
+	if request.DiscardOutputs {
+		execOutWriter = execout.DiscardWriter{}
+	} else {
+		execOutWriter = execout.NewWriter(
+			requestDetails.ResolvedStartBlockNum,
+			requestDetails.StopBlockNum,
+			outputModule.Name,
+			execOutputConfigs,
+			true,
+		)
+	}
 
 	execOutputCacheEngine, err := cache.NewEngine(ctx, s.runtimeConfig, execOutWriter, s.blockType)
 	if err != nil {
 		return fmt.Errorf("error building caching engine: %w", err)
 	}
 
+	indexWriter, err := newIndexWriter(s.runtimeConfig, outputGraph, requestDetails.ResolvedStartBlockNum)
+	if err != nil {
+		return fmt.Errorf("block indexes: %w", err)
+	}
+	if indexWriter != nil {
+		execOutputCacheEngine.SetIndexWriter(indexWriter)
+	}
+
 	opts := s.buildPipelineOptions(ctx, request)
 	opts = append(opts, pipeline.WithFinalBlocksOnly())
+	if s.determinismAuditFraction > 0 && rand.Float64() < s.determinismAuditFraction {
+		logger.Info("auditing the determinism of the modules of this job")
+		opts = append(opts, pipeline.WithDeterminismAudit())
+	}
 
 	pipe := pipeline.New(
 		ctx,
@@ -228,6 +327,7 @@ func (s *Tier2Service) processRange(ctx context.Context, request *pbssinternal.P
 		zap.Uint64("request_start_block", requestDetails.ResolvedStartBlockNum),
 		zap.Uint64("request_stop_block", request.StopBlockNum),
 		zap.String("output_module", request.OutputModule),
+		zap.String("cached_output_module", request.CachedOutputModule),
 	)
 	if err := pipe.InitStoresAndBackprocess(ctx); err != nil {
 		return fmt.Errorf("error building pipeline: %w", err)
@@ -281,7 +381,7 @@ func tier2ResponseHandler(ctx context.Context, logger *zap.Logger, streamSrv pbs
 			return status.Error(codes.Unavailable, err.Error())
 		}
 
-		sendMetering(meter, userID, apiKeyID, ip, "sf.substreams.internal.v2/ProcessRange", resp)
+		sendMetering(meter, userID, apiKeyID, ip, "sf.substreams.internal.v2/ProcessRange", resp, nil, nil)
 		return nil
 	}
 }
@@ -301,3 +401,23 @@ func updateStreamHeadersHostname(setHeader func(metadata.MD) error, logger *zap.
 	}
 	return hostname
 }
+
+// newIndexWriter returns the writer of the bitmaps of the block index modules
+// executed by a job starting at `startBlock`, or nil if there are none.
+func newIndexWriter(runtimeConfig config.RuntimeConfig, outputGraph *outputmodules.Graph, startBlock uint64) (*index.Writer, error) {
+	var w *index.Writer
+	for _, mod := range outputGraph.UsedModules() {
+		if mod.GetKindBlockIndex() == nil {
+			continue
+		}
+		indexStore, err := index.NewStore(runtimeConfig.BaseObjectStore, outputGraph.ModuleHashes().Get(mod.Name), runtimeConfig.CacheSaveInterval)
+		if err != nil {
+			return nil, fmt.Errorf("module %q: %w", mod.Name, err)
+		}
+		if w == nil {
+			w = index.NewWriter(startBlock)
+		}
+		w.AddModule(mod.Name, mod.InitialBlock, indexStore)
+	}
+	return w, nil
+}
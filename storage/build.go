@@ -13,14 +13,17 @@ import (
 	"go.uber.org/zap"
 )
 
-func BuildModuleStorageStateMap(ctx context.Context, storeConfigMap store.ConfigMap, cacheSaveInterval uint64, mapConfigs *execout.Configs, requestStartBlock, linearHandoffBlock, storeLinearHandoffBlock uint64) (ModuleStorageStateMap, error) {
+// BuildModuleStorageStateMap returns the storage states of the stores of
+// `storeConfigMap` and, in production mode, of the output maps
+// `outputMappers`, whose cached outputs are streamed.
+func BuildModuleStorageStateMap(ctx context.Context, storeConfigMap store.ConfigMap, cacheSaveInterval uint64, mapConfigs *execout.Configs, outputMappers []string, requestStartBlock, linearHandoffBlock, storeLinearHandoffBlock uint64) (ModuleStorageStateMap, error) {
 	out := make(ModuleStorageStateMap)
 	if err := buildStoresStorageState(ctx, storeConfigMap, cacheSaveInterval, storeLinearHandoffBlock, out); err != nil {
 		return nil, err
 	}
 	// dev mode does not manage mappers states (output caches)
 	if details := reqctx.Details(ctx); details.ProductionMode {
-		if err := buildMappersStorageState(ctx, mapConfigs, cacheSaveInterval, requestStartBlock, linearHandoffBlock, details.OutputModule, out); err != nil {
+		if err := buildMappersStorageState(ctx, mapConfigs, cacheSaveInterval, requestStartBlock, linearHandoffBlock, outputMappers, out); err != nil {
 			return nil, err
 		}
 	}
@@ -54,13 +57,12 @@ func buildStoresStorageState(ctx context.Context, storeConfigMap store.ConfigMap
 	return nil
 }
 
-func buildMappersStorageState(ctx context.Context, execoutConfigs *execout.Configs, execOutputSaveInterval, requestStartBlock, linearHandoffBlock uint64, outputModule string, out ModuleStorageStateMap) error {
-	stateMap, err := execoutState.FetchMappersState(ctx, execoutConfigs, outputModule)
+func buildMappersStorageState(ctx context.Context, execoutConfigs *execout.Configs, execOutputSaveInterval, requestStartBlock, linearHandoffBlock uint64, outputMappers []string, out ModuleStorageStateMap) error {
+	stateMap, err := execoutState.FetchMappersState(ctx, execoutConfigs, outputMappers)
 	if err != nil {
 		return fmt.Errorf("fetching execout states: %w", err)
 	}
 
-	// note: there is only a single state in this map
 	for modName, ranges := range stateMap.Snapshots {
 		if out[modName] != nil {
 			return fmt.Errorf("attempting to overwrite storage state for module %q", modName)
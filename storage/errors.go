@@ -0,0 +1,18 @@
+package storage
+
+// UnavailableError is the failure of the call `Operation` to the state store
+// for another reason than the object missing (ex: the object store timing out
+// or throttling), see package `traced`. It goes away by itself, the request
+// failing because of it can be retried.
+type UnavailableError struct {
+	Operation string
+	Err       error
+}
+
+func (e *UnavailableError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *UnavailableError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,91 @@
+package execout
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/streamingfast/dstore"
+	"go.uber.org/zap"
+)
+
+// AccessedDir is the module directory (`<module_hash>/accessed/`) holding the
+// access markers of the segments of its outputs, see AccessTracker.
+const AccessedDir = "accessed"
+
+// DefaultAccessResolution is the default interval between two writes of the
+// access marker of the same segment by an AccessTracker.
+const DefaultAccessResolution = time.Hour
+
+const accessMarkerWriteTimeout = 30 * time.Second
+
+// maxTrackedAccesses bounds the segments remembered by an AccessTracker, those
+// touched more than its resolution ago are forgotten above it.
+const maxTrackedAccesses = 100_000
+
+// AccessTracker records the last access of the segments of the execution
+// outputs, as an empty marker object per segment, `<module_hash>/accessed/<segment filename>`,
+// whose modification time is the last time it was loaded. The Pruner deletes
+// the segments unused for too long from them.
+//
+// The marker of a segment is written at most once per resolution by a
+// tracker, so that the segments read by every request don't cost a write per
+// read. The writes are done in the background, a failed write being retried on
+// the next access.
+type AccessTracker struct {
+	resolution time.Duration
+	logger     *zap.Logger
+
+	mu      sync.Mutex
+	touched map[string]time.Time // by `<module_hash>/<segment filename>`
+}
+
+func NewAccessTracker(resolution time.Duration, logger *zap.Logger) *AccessTracker {
+	return &AccessTracker{
+		resolution: resolution,
+		logger:     logger.Named("execout_access"),
+		touched:    map[string]time.Time{},
+	}
+}
+
+// touch records the access of the segment `filename` of the module of `config`.
+func (t *AccessTracker) touch(config *Config, filename string) {
+	key := config.moduleHash + "/" + filename
+	now := time.Now()
+
+	t.mu.Lock()
+	if last, found := t.touched[key]; found && now.Sub(last) < t.resolution {
+		t.mu.Unlock()
+		return
+	}
+	if len(t.touched) >= maxTrackedAccesses {
+		for k, last := range t.touched {
+			if now.Sub(last) >= t.resolution {
+				delete(t.touched, k)
+			}
+		}
+	}
+	t.touched[key] = now
+	t.mu.Unlock()
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), accessMarkerWriteTimeout)
+		defer cancel()
+
+		if err := writeAccessMarker(ctx, config.accessedStore, filename); err != nil {
+			t.logger.Warn("writing execout access marker", zap.String("module_hash", config.moduleHash), zap.String("file_name", filename), zap.Error(err))
+			t.mu.Lock()
+			delete(t.touched, key)
+			t.mu.Unlock()
+		}
+	}()
+}
+
+func writeAccessMarker(ctx context.Context, accessedStore dstore.Store, filename string) error {
+	if err := accessedStore.WriteObject(ctx, filename, bytes.NewReader(nil)); err != nil {
+		return fmt.Errorf("writing access marker %q: %w", filename, err)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package execout
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// BlobsDir is the directory of the state store holding the segments of the
+// execution outputs written content-addressed, named after the hash of their
+// content, see Configs.SetContentAddressed.
+//
+// The segment file of a module then only holds a reference to its blob, so
+// that the modules producing the same outputs over the same range (the same
+// code packaged with different module hashes, or the same outputs produced by
+// different code) share a single copy, written once. The Pruner deletes the
+// blobs no segment file references anymore.
+const BlobsDir = "outputs-blobs"
+
+// blobRefreshAge is the age above which a blob written again by another
+// segment is rewritten instead of deduplicated, refreshing its last
+// modification time for the Pruner.
+const blobRefreshAge = time.Hour
+
+var blobRefPrefix = []byte("substreams-execout-blob:")
+
+// maxBlobRefLen is the length of the segment files holding a blob reference.
+var maxBlobRefLen = len(blobRef(blobFilename(nil)))
+
+// blobFilename returns the name of the blob holding `content`.
+func blobFilename(content []byte) string {
+	return fmt.Sprintf("%x.output", sha256.Sum256(content))
+}
+
+func blobRef(blobFilename string) []byte {
+	return append(append([]byte{}, blobRefPrefix...), blobFilename...)
+}
+
+// parseBlobRef returns the name of the blob referenced by the segment file
+// `data`, false when it holds the outputs themselves.
+func parseBlobRef(data []byte) (string, bool) {
+	if !bytes.HasPrefix(data, blobRefPrefix) {
+		return "", false
+	}
+	filename := string(data[len(blobRefPrefix):])
+	if strings.ContainsAny(filename, "/\\") {
+		return "", false
+	}
+	return filename, true
+}
@@ -0,0 +1,77 @@
+package execout
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/streamingfast/dstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/streamingfast/substreams/block"
+	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
+)
+
+func TestFile_ContentAddressed(t *testing.T) {
+	ctx := context.Background()
+	baseStore, err := dstore.NewStore("file://"+t.TempDir(), "", "", false)
+	require.NoError(t, err)
+
+	segment := block.NewBoundedRange(0, 10, 0, 10)
+	save := func(moduleHash string, contentAddressed bool) *Config {
+		config, err := NewConfig("A", 0, pbsubstreams.ModuleKindMap, moduleHash, baseStore, zap.NewNop())
+		require.NoError(t, err)
+		config.contentAddressed = contentAddressed
+
+		file := config.NewFile(segment)
+		file.SetItem(&pbsubstreams.Clock{Id: "5a", Number: 5}, []byte("out5"))
+		file.SetItem(&pbsubstreams.Clock{Id: "3a", Number: 3}, []byte("out3"))
+		write, err := file.Save(ctx)
+		require.NoError(t, err)
+		write()
+		return config
+	}
+	load := func(config *Config) (*File, error) {
+		file := config.NewFile(segment)
+		return file, file.Load(ctx)
+	}
+
+	first := save("aaaaaa", true)
+	second := save("bbbbbb", true)
+	plain := save("cccccc", false)
+
+	var blobs []string
+	require.NoError(t, baseStore.Walk(ctx, BlobsDir+"/", func(filename string) error {
+		blobs = append(blobs, filename)
+		return nil
+	}))
+	assert.Len(t, blobs, 1, "both modules share the same blob")
+
+	for _, config := range []*Config{first, second, plain} {
+		file, err := load(config)
+		require.NoError(t, err)
+		out, found := file.GetAtBlock(5)
+		assert.True(t, found)
+		assert.Equal(t, "out5", string(out))
+		assert.Len(t, file.SortedItems(), 2)
+	}
+
+	require.NoError(t, baseStore.DeleteObject(ctx, blobs[0]))
+	_, err = load(first)
+	var invalidErr *InvalidFileError
+	assert.True(t, errors.As(err, &invalidErr), "a file whose blob is missing is invalid, got %v", err)
+}
+
+func Test_parseBlobRef(t *testing.T) {
+	blob, ok := parseBlobRef(blobRef("abc.output"))
+	assert.True(t, ok)
+	assert.Equal(t, "abc.output", blob)
+
+	_, ok = parseBlobRef([]byte("outputs"))
+	assert.False(t, ok)
+
+	_, ok = parseBlobRef(blobRef("../abc.output"))
+	assert.False(t, ok)
+}
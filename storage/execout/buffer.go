@@ -14,9 +14,10 @@ import (
 type Buffer struct {
 	values map[string][]byte
 	clock  *pbsubstreams.Clock
+	final  bool
 } // TODO(abourget): rename to `Buffer`
 
-func NewBuffer(blockType string, block *bstream.Block, clock *pbsubstreams.Clock) (*Buffer, error) {
+func NewBuffer(blockType string, block *bstream.Block, clock *pbsubstreams.Clock, final bool) (*Buffer, error) {
 	blkBytes, err := block.Payload.Get()
 	if err != nil {
 		return nil, fmt.Errorf("getting block %d %q: %w", block.Number, block.Id, err)
@@ -28,6 +29,7 @@ func NewBuffer(blockType string, block *bstream.Block, clock *pbsubstreams.Clock
 
 	return &Buffer{
 		clock: clock,
+		final: final,
 		values: map[string][]byte{
 			blockType:      blkBytes,
 			wasm.ClockType: clockBytes,
@@ -39,6 +41,10 @@ func (i *Buffer) Clock() *pbsubstreams.Clock {
 	return i.clock
 }
 
+func (i *Buffer) Final() bool {
+	return i.final
+}
+
 func (i *Buffer) Get(moduleName string) (value []byte, cached bool, err error) {
 	val, found := i.values[moduleName]
 	if !found {
@@ -0,0 +1,39 @@
+package execout
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+)
+
+// Outputs files (and blobs) end with a footer holding the sha256 of their
+// content followed by checksumMagic, verified when they are loaded. Files
+// written before the footer was introduced don't end with the magic and are
+// read unverified.
+var checksumMagic = []byte("\x00sxsum01")
+
+const checksumFooterSize = sha256.Size + 8
+
+func withChecksum(content []byte) []byte {
+	sum := sha256.Sum256(content)
+	out := make([]byte, 0, len(content)+checksumFooterSize)
+	out = append(out, content...)
+	out = append(out, sum[:]...)
+	return append(out, checksumMagic...)
+}
+
+// verifyChecksum returns the content of `data`, stripped of its footer once
+// verified. Data without a footer is returned as is.
+func verifyChecksum(data []byte) ([]byte, error) {
+	if len(data) < checksumFooterSize || !bytes.HasSuffix(data, checksumMagic) {
+		return data, nil
+	}
+
+	content := data[:len(data)-checksumFooterSize]
+	expected := data[len(content) : len(content)+sha256.Size]
+	actual := sha256.Sum256(content)
+	if !bytes.Equal(expected, actual[:]) {
+		return nil, fmt.Errorf("content checksum is %x, footer expects %x", actual[:], expected)
+	}
+	return content, nil
+}
@@ -0,0 +1,24 @@
+package execout
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChecksum_Verify(t *testing.T) {
+	data := withChecksum([]byte("content"))
+
+	content, err := verifyChecksum(data)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("content"), content)
+
+	content, err = verifyChecksum([]byte("legacy"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("legacy"), content)
+
+	data[1] ^= 0xff
+	_, err = verifyChecksum(data)
+	assert.ErrorContains(t, err, "content checksum is")
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/streamingfast/substreams/block"
 	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
 	pboutput "github.com/streamingfast/substreams/storage/execout/pb"
+	"github.com/streamingfast/substreams/storage/idempotency"
 	"go.uber.org/zap"
 )
 
@@ -17,6 +18,15 @@ type Config struct {
 	moduleHash string
 	objStore   dstore.Store
 
+	accessedStore dstore.Store   // `<module_hash>/accessed`, see AccessTracker
+	accessTracker *AccessTracker // nil when the accesses are not tracked
+
+	blobStore        dstore.Store // `outputs-blobs`, see BlobsDir
+	contentAddressed bool         // the files are written to blobStore, see Configs.SetContentAddressed
+
+	ledger  *idempotency.Ledger // nil when the writes are not checked, see Configs.SetIdempotencyLedger
+	traceID string
+
 	modKind            pbsubstreams.ModuleKind
 	moduleInitialBlock uint64
 
@@ -28,10 +38,20 @@ func NewConfig(name string, moduleInitialBlock uint64, modKind pbsubstreams.Modu
 	if err != nil {
 		return nil, fmt.Errorf("creating sub store: %w", err)
 	}
+	accessedStore, err := baseStore.SubStore(fmt.Sprintf("%s/%s", moduleHash, AccessedDir))
+	if err != nil {
+		return nil, fmt.Errorf("creating accessed sub store: %w", err)
+	}
+	blobStore, err := baseStore.SubStore(BlobsDir)
+	if err != nil {
+		return nil, fmt.Errorf("creating blobs sub store: %w", err)
+	}
 
 	return &Config{
 		name:               name,
 		objStore:           subStore,
+		accessedStore:      accessedStore,
+		blobStore:          blobStore,
 		modKind:            modKind,
 		moduleInitialBlock: moduleInitialBlock,
 		moduleHash:         moduleHash,
@@ -46,6 +66,18 @@ func (c *Config) NewFile(targetRange *block.BoundedRange) *File {
 		store:        c.objStore,
 		BoundedRange: targetRange,
 		logger:       c.logger,
+		onLoad:       c.onFileLoaded,
+		ledger:       c.ledger,
+		traceID:      c.traceID,
+
+		blobStore:        c.blobStore,
+		contentAddressed: c.contentAddressed,
+	}
+}
+
+func (c *Config) onFileLoaded(filename string) {
+	if c.accessTracker != nil {
+		c.accessTracker.touch(c, filename)
 	}
 }
 
@@ -70,7 +102,7 @@ func (c *Config) ListSnapshotFiles(ctx context.Context) (files FileInfos, err er
 		})
 	})
 	if err != nil {
-		return nil, fmt.Errorf("walking files: %s", err)
+		return nil, fmt.Errorf("walking files: %w", err)
 	}
 
 	return files, nil
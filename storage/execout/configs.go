@@ -10,6 +10,7 @@ import (
 	"github.com/streamingfast/dstore"
 	"github.com/streamingfast/substreams/manifest"
 	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
+	"github.com/streamingfast/substreams/storage/idempotency"
 )
 
 type Configs struct {
@@ -42,6 +43,40 @@ func NewConfigs(baseObjectStore dstore.Store, allRequestedModules []*pbsubstream
 	}, nil
 }
 
+// SetAccessTracker makes the files of the modules loaded from now on record
+// their accesses with `tracker`, see AccessTracker. A nil tracker is ignored.
+func (c *Configs) SetAccessTracker(tracker *AccessTracker) {
+	if tracker == nil {
+		return
+	}
+	for _, config := range c.ConfigMap {
+		config.accessTracker = tracker
+	}
+}
+
+// SetIdempotencyLedger makes the files of the modules written from now on by
+// the request `traceID` checked against `ledger` before being written, see
+// idempotency.Ledger. A nil ledger is ignored.
+func (c *Configs) SetIdempotencyLedger(ledger *idempotency.Ledger, traceID string) {
+	if ledger == nil {
+		return
+	}
+	for _, config := range c.ConfigMap {
+		config.ledger = ledger
+		config.traceID = traceID
+	}
+}
+
+// SetContentAddressed makes the files of the modules written from now on hold
+// a reference to a blob named after the hash of their content, shared by all
+// the modules producing the same outputs, see BlobsDir. Files written either
+// way are always read, but not by the servers predating the blobs.
+func (c *Configs) SetContentAddressed() {
+	for _, config := range c.ConfigMap {
+		config.contentAddressed = true
+	}
+}
+
 func (c *Configs) NewFile(moduleName string, targetRange *block.BoundedRange) *File {
 	return c.ConfigMap[moduleName].NewFile(targetRange)
 }
@@ -0,0 +1,20 @@
+package execout
+
+import (
+	"context"
+
+	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
+)
+
+// DiscardWriter drops the outputs of the output module, in place of the
+// Writer, for the jobs of development mode requests whose outputs nobody
+// replays: no outputs cache file is written.
+type DiscardWriter struct{}
+
+func (DiscardWriter) Write(clock *pbsubstreams.Clock, buffer *Buffer) {}
+
+func (DiscardWriter) MaybeRotate(ctx context.Context, clockNumber uint64) error {
+	return nil
+}
+
+func (DiscardWriter) Close() {}
@@ -3,13 +3,13 @@ package execout
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"math"
 	"sort"
-	"strconv"
-	"strings"
 	"sync"
+	"time"
 
 	pboutput "github.com/streamingfast/substreams/storage/execout/pb"
 
@@ -18,7 +18,9 @@ import (
 	"github.com/streamingfast/derr"
 	"github.com/streamingfast/dstore"
 	"github.com/streamingfast/substreams/block"
+	"github.com/streamingfast/substreams/metrics"
 	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
+	"github.com/streamingfast/substreams/storage/idempotency"
 	"go.uber.org/zap"
 )
 
@@ -32,6 +34,13 @@ type File struct {
 	kv         map[string]*pboutput.Item
 	store      dstore.Store
 	logger     *zap.Logger
+	onLoad     func(filename string) // called with the filename once loaded, see Config.onFileLoaded
+
+	blobStore        dstore.Store // `outputs-blobs`, see BlobsDir
+	contentAddressed bool         // written to blobStore, see Configs.SetContentAddressed
+
+	ledger  *idempotency.Ledger // nil when the writes are not checked, see Configs.SetIdempotencyLedger
+	traceID string
 }
 
 // NOTE(abourget): this File could be split in a BoundedFile which would know about NextFile() as well the BoundedRange,
@@ -49,7 +58,13 @@ func (c *File) NextFile() *File {
 		ModuleName:   c.ModuleName,
 		store:        c.store,
 		logger:       c.logger,
+		onLoad:       c.onLoad,
 		BoundedRange: nextBoundary,
+		ledger:       c.ledger,
+		traceID:      c.traceID,
+
+		blobStore:        c.blobStore,
+		contentAddressed: c.contentAddressed,
 	}
 }
 
@@ -134,18 +149,86 @@ func (c *File) Load(ctx context.Context) error {
 			return fmt.Errorf("reading store file %s: %w", filename, err)
 		}
 
+		if blob, ok := parseBlobRef(bytes); ok {
+			bytes, err = c.readBlob(ctx, blob)
+			if err == dstore.ErrNotFound {
+				return derr.NewFatalError(&InvalidFileError{Filename: filename, Reason: fmt.Sprintf("blob %s not found", blob)})
+			}
+			if err != nil {
+				return fmt.Errorf("reading blob %s of file %s: %w", blob, filename, err)
+			}
+		}
+
+		bytes, err = verifyChecksum(bytes)
+		if err != nil {
+			return derr.NewFatalError(&InvalidFileError{Filename: filename, Reason: err.Error()})
+		}
+
 		outputData := &pboutput.Map{}
-		if err = outputData.UnmarshalFast(bytes); err != nil {
-			return fmt.Errorf("unmarshalling file %s: %w", filename, err)
+		trailer, err := outputData.UnmarshalFast(bytes)
+		if err != nil {
+			return derr.NewFatalError(&InvalidFileError{Filename: filename, Reason: err.Error()})
+		}
+		if err := validateItems(c.Range, outputData.Kv, trailer); err != nil {
+			return derr.NewFatalError(&InvalidFileError{Filename: filename, Reason: err.Error()})
 		}
 
 		c.kv = outputData.Kv
+		if c.onLoad != nil {
+			c.onLoad(filename)
+		}
 
 		c.logger.Debug("outputs data loaded", zap.Int("output_count", len(c.kv)), zap.Stringer("block_range", c.BoundedRange))
 		return nil
 	})
 }
 
+// InvalidFileError is returned when loading a cached outputs file that cannot be
+// decoded, doesn't match its checksum, or whose outputs don't match its range or trailer, for example because
+// it was truncated by a crash while being written.
+type InvalidFileError struct {
+	Filename string
+	Reason   string
+}
+
+func (e *InvalidFileError) Error() string {
+	return fmt.Sprintf("invalid cached outputs file %s: %s", e.Filename, e.Reason)
+}
+
+// validateItems checks that the outputs are all within `blockRange`, one per block,
+// and, for files written with a trailer, that none is missing.
+func validateItems(blockRange *block.Range, items map[string]*pboutput.Item, trailer *pboutput.Trailer) error {
+	seen := make(map[uint64]bool, len(items))
+	var first, last uint64
+	for _, item := range items {
+		if !blockRange.Contains(item.BlockNum) {
+			return fmt.Errorf("output of block %d is outside of range %s", item.BlockNum, blockRange)
+		}
+		if seen[item.BlockNum] {
+			return fmt.Errorf("block %d has more than one output", item.BlockNum)
+		}
+		seen[item.BlockNum] = true
+
+		if len(seen) == 1 || item.BlockNum < first {
+			first = item.BlockNum
+		}
+		if item.BlockNum > last {
+			last = item.BlockNum
+		}
+	}
+
+	if trailer == nil {
+		return nil
+	}
+	if uint64(len(items)) != trailer.ItemCount {
+		return fmt.Errorf("found %d outputs, trailer expects %d", len(items), trailer.ItemCount)
+	}
+	if len(items) != 0 && (first != trailer.FirstBlockNum || last != trailer.LastBlockNum) {
+		return fmt.Errorf("found outputs from block %d to %d, trailer expects %d to %d", first, last, trailer.FirstBlockNum, trailer.LastBlockNum)
+	}
+	return nil
+}
+
 func (c *File) Save(ctx context.Context) (func(), error) {
 	if len(c.kv) == 0 {
 		c.logger.Info("not saving cache, because empty", zap.Stringer("block_range", c.BoundedRange))
@@ -161,19 +244,73 @@ func (c *File) Save(ctx context.Context) (func(), error) {
 	if err != nil {
 		return nil, fmt.Errorf("unmarshalling file %s: %w", filename, err)
 	}
+	cnt = withChecksum(cnt)
+
+	if c.contentAddressed {
+		blob := blobFilename(cnt)
+		return func() {
+			// The blob is written outside of the ledger, so that the blob of
+			// a file already written but since deleted is written again.
+			if err := c.writeBlob(ctx, blob, cnt); err != nil {
+				c.logger.Warn("failed writing output cache blob", zap.String("blob", blob), zap.Error(err))
+				return
+			}
+			c.write(ctx, filename, blobRef(blob))
+		}, nil
+	}
 
 	return func() {
-		c.logger.Info("writing execution output file", zap.String("filename", filename))
+		c.write(ctx, filename, cnt)
+	}, nil
+}
 
-		err = derr.RetryContext(ctx, 5, func(ctx context.Context) error {
+func (c *File) write(ctx context.Context, filename string, cnt []byte) {
+	c.logger.Info("writing execution output file", zap.String("filename", filename))
+
+	_, err := c.ledger.Write(ctx, c.store, filename, c.traceID, func(ctx context.Context) error {
+		return derr.RetryContext(ctx, 5, func(ctx context.Context) error {
 			reader := bytes.NewReader(cnt)
 			err := c.store.WriteObject(ctx, filename, reader)
 			return err
 		})
-		if err != nil {
-			c.logger.Warn("failed writing output cache", zap.Error(err))
+	})
+	if err != nil {
+		c.logger.Warn("failed writing output cache", zap.Error(err))
+	}
+}
+
+// writeBlob writes the blob `blob` holding `cnt`, unless it was already
+// written, by this module or another one, less than blobRefreshAge ago. An
+// older blob is written again, so that the Pruner, which sweeps the blobs
+// unmodified for longer than its maximum age plus blobRefreshAge, never
+// deletes a blob getting a new reference after its scan.
+func (c *File) writeBlob(ctx context.Context, blob string, cnt []byte) error {
+	attrs, err := c.blobStore.ObjectAttributes(ctx, blob)
+	if err != nil && !errors.Is(err, dstore.ErrNotFound) {
+		return fmt.Errorf("reading blob attributes: %w", err)
+	}
+	result := "written"
+	if err == nil {
+		if time.Since(attrs.LastModified) < blobRefreshAge {
+			metrics.ExecOutBlobWrites.Inc("deduplicated")
+			return nil
 		}
-	}, nil
+		result = "refreshed"
+	}
+
+	metrics.ExecOutBlobWrites.Inc(result)
+	return derr.RetryContext(ctx, 5, func(ctx context.Context) error {
+		return c.blobStore.WriteObject(ctx, blob, bytes.NewReader(cnt))
+	})
+}
+
+func (c *File) readBlob(ctx context.Context, blob string) ([]byte, error) {
+	reader, err := c.blobStore.OpenObject(ctx, blob)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
 }
 
 func (c *File) String() string {
@@ -232,12 +369,12 @@ func findBlockRange(ctx context.Context, store dstore.Store, prefixStartBlock ui
 	biggestEndBlock := uint64(0)
 
 	for _, file := range files {
-		endBlock, err := getExclusiveEndBlock(file)
+		fileRange, err := fileNameToRange(file)
 		if err != nil {
 			return nil, false, fmt.Errorf("getting exclusive end block from file %s: %w", file, err)
 		}
-		if endBlock > biggestEndBlock {
-			biggestEndBlock = endBlock
+		if fileRange.ExclusiveEndBlock > biggestEndBlock {
+			biggestEndBlock = fileRange.ExclusiveEndBlock
 		}
 	}
 
@@ -257,22 +394,3 @@ func pad(blockNumber uint64) string {
 func ComputeStartBlock(startBlock uint64, saveBlockInterval uint64) uint64 {
 	return startBlock - startBlock%saveBlockInterval
 }
-
-func getExclusiveEndBlock(filename string) (uint64, error) {
-	endBlock := strings.Split(strings.Split(filename, "-")[1], ".")[0]
-	parsedInt, err := strconv.ParseInt(strings.TrimLeft(endBlock, "0"), 10, 64)
-
-	if err != nil {
-		return 0, fmt.Errorf("parsing int %d: %w", parsedInt, err)
-	}
-
-	return uint64(parsedInt), nil
-}
-
-func mustAtoi(s string) int {
-	i, err := strconv.Atoi(s)
-	if err != nil {
-		panic(err)
-	}
-	return i
-}
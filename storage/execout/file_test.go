@@ -0,0 +1,46 @@
+package execout
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/streamingfast/substreams/block"
+	pboutput "github.com/streamingfast/substreams/storage/execout/pb"
+)
+
+func Test_validateItems(t *testing.T) {
+	items := func(blockNums ...uint64) map[string]*pboutput.Item {
+		out := map[string]*pboutput.Item{}
+		for i, num := range blockNums {
+			id := string(rune('a' + i))
+			out[id] = &pboutput.Item{BlockNum: num, BlockId: id}
+		}
+		return out
+	}
+
+	tests := []struct {
+		name      string
+		items     map[string]*pboutput.Item
+		trailer   *pboutput.Trailer
+		expectErr string
+	}{
+		{"valid", items(10, 11, 13), &pboutput.Trailer{ItemCount: 3, FirstBlockNum: 10, LastBlockNum: 13}, ""},
+		{"valid empty", items(), &pboutput.Trailer{}, ""},
+		{"legacy without trailer", items(10, 13), nil, ""},
+		{"out of range", items(10, 20), nil, "output of block 20 is outside of range [10, 20)"},
+		{"same block twice", items(10, 10), nil, "block 10 has more than one output"},
+		{"missing outputs", items(10, 11), &pboutput.Trailer{ItemCount: 3, FirstBlockNum: 10, LastBlockNum: 13}, "found 2 outputs, trailer expects 3"},
+		{"wrong bounds", items(10, 11), &pboutput.Trailer{ItemCount: 2, FirstBlockNum: 10, LastBlockNum: 12}, "found outputs from block 10 to 11, trailer expects 10 to 12"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateItems(block.NewRange(10, 20), test.items, test.trailer)
+			if test.expectErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, test.expectErr)
+			}
+		})
+	}
+}
@@ -36,11 +36,5 @@ func fileNameToRange(filename string) (*block.Range, error) {
 		return nil, fmt.Errorf("invalid output cache filename, %q", filename)
 	}
 
-	start := uint64(mustAtoi(res[0][1]))
-	end := uint64(mustAtoi(res[0][2]))
-
-	return &block.Range{
-		StartBlock:        start,
-		ExclusiveEndBlock: end,
-	}, nil
+	return block.NewRangeFromString(res[0][1] + "-" + res[0][2])
 }
@@ -1,6 +1,7 @@
 package execout
 
 import (
+	"context"
 	"errors"
 
 	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
@@ -8,6 +9,7 @@ import (
 
 type ExecutionOutputGetter interface {
 	Clock() *pbsubstreams.Clock
+	Final() bool // the block of Clock is final
 	Get(name string) (value []byte, cached bool, err error)
 }
 
@@ -21,4 +23,12 @@ type ExecutionOutput interface {
 	ExecutionOutputSetter
 }
 
+// OutputWriter keeps the outputs of the output module on the final blocks,
+// see Writer and DiscardWriter.
+type OutputWriter interface {
+	Write(clock *pbsubstreams.Clock, buffer *Buffer)
+	MaybeRotate(ctx context.Context, clockNumber uint64) error
+	Close()
+}
+
 var NotFound = errors.New("inputs module value not found")
@@ -0,0 +1,85 @@
+package execout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/streamingfast/dstore"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/streamingfast/substreams/block"
+	pbssinternal "github.com/streamingfast/substreams/pb/sf/substreams/intern/v2"
+	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
+	"github.com/streamingfast/substreams/utils"
+)
+
+// KeyMutation is a delta of a single key of a store module, with the block it
+// was produced on, see KeyHistory.
+type KeyMutation struct {
+	BlockNum uint64
+	BlockID  string
+	Delta    *pbssinternal.StoreDelta
+}
+
+// KeyHistory replays the deltas of the store module `moduleName` recorded in its
+// cached outputs over `rng`, and returns those of `key`, by block and ordinal.
+// The segments of `rng` without cached outputs (not processed yet, or
+// invalid) are returned as `missing`, the mutations of `key` in them are unknown.
+func (c *Configs) KeyHistory(ctx context.Context, moduleName string, key string, rng *block.Range) (mutations []*KeyMutation, missing block.Ranges, err error) {
+	config := c.ConfigMap[moduleName]
+	if config == nil {
+		return nil, nil, fmt.Errorf("module %q not found", moduleName)
+	}
+	if config.ModuleKind() != pbsubstreams.ModuleKindStore {
+		return nil, nil, fmt.Errorf("module %q is not a store", moduleName)
+	}
+
+	startBlock := rng.StartBlock
+	if startBlock < config.ModuleInitialBlock() {
+		startBlock = config.ModuleInitialBlock()
+	}
+	if startBlock >= rng.ExclusiveEndBlock {
+		return nil, nil, nil
+	}
+
+	// Segments are always loaded whole, the deltas outside `rng` are skipped.
+	segmentsEnd := rng.ExclusiveEndBlock
+	if rest := segmentsEnd % c.execOutputSaveInterval; rest != 0 {
+		segmentsEnd += c.execOutputSaveInterval - rest
+	}
+
+	file := config.NewFile(block.NewBoundedRange(config.ModuleInitialBlock(), c.execOutputSaveInterval, startBlock, segmentsEnd))
+	for ; file != nil && file.Range != nil; file = file.NextFile() {
+		if err := file.Load(ctx); err != nil {
+			var invalidErr *InvalidFileError
+			if err == dstore.ErrNotFound || errors.As(err, &invalidErr) {
+				missing = append(missing, block.NewRange(utils.MaxOf(file.StartBlock, startBlock), utils.MinOf(file.ExclusiveEndBlock, rng.ExclusiveEndBlock)))
+				continue
+			}
+			return nil, nil, fmt.Errorf("loading %s cache %q: %w", moduleName, file.Filename(), err)
+		}
+
+		for _, item := range file.SortedItems() {
+			if item.BlockNum < startBlock || item.BlockNum >= rng.ExclusiveEndBlock {
+				continue
+			}
+
+			deltas := &pbssinternal.StoreDeltas{}
+			if err := proto.Unmarshal(item.Payload, deltas); err != nil {
+				return nil, nil, fmt.Errorf("unmarshalling deltas of block %d: %w", item.BlockNum, err)
+			}
+			for _, delta := range deltas.StoreDeltas {
+				if delta.Key == key {
+					mutations = append(mutations, &KeyMutation{
+						BlockNum: item.BlockNum,
+						BlockID:  item.BlockId,
+						Delta:    delta,
+					})
+				}
+			}
+		}
+	}
+
+	return mutations, missing.Coalesce(), nil
+}
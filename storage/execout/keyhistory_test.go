@@ -0,0 +1,67 @@
+package execout
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/streamingfast/dstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/streamingfast/substreams/block"
+	pbssinternal "github.com/streamingfast/substreams/pb/sf/substreams/intern/v2"
+	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
+)
+
+func TestConfigs_KeyHistory(t *testing.T) {
+	ctx := context.Background()
+	baseStore, err := dstore.NewStore("file://"+t.TempDir(), "", "", false)
+	require.NoError(t, err)
+	config, err := NewConfig("S", 5, pbsubstreams.ModuleKindStore, "abcdef", baseStore, zap.NewNop())
+	require.NoError(t, err)
+	configs := &Configs{ConfigMap: map[string]*Config{"S": config}, execOutputSaveInterval: 10, logger: zap.NewNop()}
+
+	writeSegment := func(start, end uint64, deltas map[uint64][]*pbssinternal.StoreDelta) {
+		file := config.NewFile(block.NewBoundedRange(5, 10, start, end))
+		for blockNum := start; blockNum < end; blockNum++ {
+			data, err := proto.Marshal(&pbssinternal.StoreDeltas{StoreDeltas: deltas[blockNum]})
+			require.NoError(t, err)
+			file.SetItem(&pbsubstreams.Clock{Id: fmt.Sprintf("%da", blockNum), Number: blockNum}, data)
+		}
+		write, err := file.Save(ctx)
+		require.NoError(t, err)
+		write()
+	}
+
+	created := &pbssinternal.StoreDelta{Operation: pbssinternal.StoreDelta_CREATE, Ordinal: 1, Key: "k", NewValue: []byte("1")}
+	other := &pbssinternal.StoreDelta{Operation: pbssinternal.StoreDelta_CREATE, Ordinal: 2, Key: "other", NewValue: []byte("x")}
+	updated := &pbssinternal.StoreDelta{Operation: pbssinternal.StoreDelta_UPDATE, Ordinal: 3, Key: "k", OldValue: []byte("1"), NewValue: []byte("2")}
+	deleted := &pbssinternal.StoreDelta{Operation: pbssinternal.StoreDelta_DELETE, Ordinal: 1, Key: "k", OldValue: []byte("2")}
+	writeSegment(5, 10, map[uint64][]*pbssinternal.StoreDelta{7: {created, other}, 9: {updated}})
+	// segment [10, 20) never processed
+	writeSegment(20, 30, map[uint64][]*pbssinternal.StoreDelta{21: {deleted}, 28: {created}})
+
+	mutations, missing, err := configs.KeyHistory(ctx, "S", "k", block.NewRange(0, 25))
+	require.NoError(t, err)
+	require.Len(t, mutations, 3)
+	assert.Equal(t, uint64(7), mutations[0].BlockNum)
+	assert.Equal(t, "7a", mutations[0].BlockID)
+	assert.True(t, proto.Equal(created, mutations[0].Delta))
+	assert.True(t, proto.Equal(updated, mutations[1].Delta))
+	assert.Equal(t, uint64(21), mutations[2].BlockNum)
+	assert.True(t, proto.Equal(deleted, mutations[2].Delta))
+	assert.Equal(t, block.Ranges{block.NewRange(10, 20)}, missing)
+
+	mutations, missing, err = configs.KeyHistory(ctx, "S", "k", block.NewRange(8, 40))
+	require.NoError(t, err)
+	require.Len(t, mutations, 3)
+	assert.Equal(t, uint64(9), mutations[0].BlockNum)
+	assert.Equal(t, uint64(28), mutations[2].BlockNum)
+	assert.Equal(t, block.Ranges{block.NewRange(10, 20), block.NewRange(30, 40)}, missing)
+
+	_, _, err = configs.KeyHistory(ctx, "M", "k", block.NewRange(0, 10))
+	assert.EqualError(t, err, `module "M" not found`)
+}
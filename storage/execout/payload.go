@@ -0,0 +1,90 @@
+package execout
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/streamingfast/bstream"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// chainProtocols maps the package prefix of the block types of each chain to
+// the payload kind of their blocks, as reported by bstream.
+var chainProtocols = map[string]string{
+	"sf.ethereum.": "ETH",
+	"sf.near.":     "NEAR",
+	"sf.solana.":   "SOLANA",
+	"sf.cosmos.":   "COSMOS",
+	"sf.antelope.": "EOS",
+}
+
+// ValidateBlockPayload checks that the payload of `block` is a `blockType`
+// message, so that a server reading the blocks of another chain than the one
+// its modules expect fails with a clear error instead of the modules failing
+// to decode their input.
+//
+// The payload kind of the block is checked against the chain of `blockType`.
+// When the descriptor of `blockType` is linked in the binary, the payload is
+// decoded with it: its required fields must be set and its `number` field, if
+// any, must match the block number. Unknown fields are allowed, the chains
+// adding fields to their blocks before the servers know them. Otherwise, the
+// payload must at least be a well-formed protobuf message.
+func ValidateBlockPayload(blockType string, block *bstream.Block) error {
+	if err := validateBlockPayload(blockType, block); err != nil {
+		return status.Errorf(codes.FailedPrecondition, "block %s is not a %q: %s, check that the server reads the blocks of the chain of the requested modules", block.AsRef(), blockType, err)
+	}
+	return nil
+}
+
+func validateBlockPayload(blockType string, block *bstream.Block) error {
+	for prefix, protocol := range chainProtocols {
+		if strings.HasPrefix(blockType, prefix) && block.PayloadKind != 0 && block.PayloadKind.String() != protocol {
+			return fmt.Errorf("payload kind is %s, expected %s", block.PayloadKind, protocol)
+		}
+	}
+
+	payload, err := block.Payload.Get()
+	if err != nil {
+		return fmt.Errorf("getting payload: %w", err)
+	}
+
+	msgType, err := protoregistry.GlobalTypes.FindMessageByName(protoreflect.FullName(blockType))
+	if err != nil {
+		return validateWireFormat(payload)
+	}
+
+	msg := msgType.New()
+	if err := proto.Unmarshal(payload, msg.Interface()); err != nil {
+		return fmt.Errorf("decoding payload: %w", err)
+	}
+	if field := msg.Descriptor().Fields().ByName("number"); field != nil && field.Kind() == protoreflect.Uint64Kind {
+		if number := msg.Get(field).Uint(); number != block.Number {
+			return fmt.Errorf("payload is block number %d", number)
+		}
+	}
+	return nil
+}
+
+// validateWireFormat checks that the top-level fields of `payload` are
+// well-formed.
+func validateWireFormat(payload []byte) error {
+	for len(payload) > 0 {
+		num, typ, n := protowire.ConsumeTag(payload)
+		if n < 0 {
+			return fmt.Errorf("malformed payload: %w", protowire.ParseError(n))
+		}
+		payload = payload[n:]
+
+		n = protowire.ConsumeFieldValue(num, typ, payload)
+		if n < 0 {
+			return fmt.Errorf("malformed payload at field %d: %w", num, protowire.ParseError(n))
+		}
+		payload = payload[n:]
+	}
+	return nil
+}
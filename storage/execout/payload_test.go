@@ -0,0 +1,58 @@
+package execout
+
+import (
+	"testing"
+
+	"github.com/streamingfast/bstream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
+	pbsubstreamstest "github.com/streamingfast/substreams/pb/sf/substreams/v1/test"
+)
+
+func TestValidateBlockPayload(t *testing.T) {
+	newBlock := func(number uint64, msg proto.Message, raw []byte) *bstream.Block {
+		if msg != nil {
+			var err error
+			raw, err = proto.Marshal(msg)
+			require.NoError(t, err)
+		}
+		blk := &bstream.Block{Id: "abc", Number: number}
+		_, err := bstream.MemoryBlockPayloadSetter(blk, raw)
+		require.NoError(t, err)
+		return blk
+	}
+
+	testBlock := &pbsubstreamstest.Block{Id: "abc", Number: 10}
+
+	tests := []struct {
+		name        string
+		blockType   string
+		block       *bstream.Block
+		expectError bool
+	}{
+		{"matching block", "sf.substreams.v1.test.Block", newBlock(10, testBlock, nil), false},
+		{"number mismatch", "sf.substreams.v1.test.Block", newBlock(11, testBlock, nil), true},
+		{"unknown fields", "sf.substreams.v1.test.Block", newBlock(10, &pbsubstreams.Clock{Id: "abc", Number: 10, Timestamp: timestamppb.Now()}, nil), false},
+		{"other message", "sf.substreams.v1.test.Block", newBlock(10, &pbsubstreams.Module{Name: "map", InitialBlock: 5, BinaryIndex: 2}, nil), true},
+		{"unregistered type", "sf.unknown.v1.Block", newBlock(10, testBlock, nil), false},
+		{"unregistered type malformed", "sf.unknown.v1.Block", newBlock(10, nil, []byte{0x0a, 0x05, 'a'}), true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidateBlockPayload(test.blockType, test.block)
+			if test.expectError {
+				require.Error(t, err)
+				assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"google.golang.org/protobuf/types/known/timestamppb"
 	io "io"
 	reflect "reflect"
+	"sort"
 	"unsafe"
 )
 
@@ -15,31 +16,44 @@ func unsafeGetString(bs []byte) string {
 	return *(*string)(unsafe.Pointer(&bs))
 }
 
-// Faster marshalling through conversion to Array
+// Faster marshalling through conversion to Array, followed by its Trailer. The
+// items are sorted by block number, the same outputs always marshalling to the
+// same bytes.
 func (m *Map) MarshalFast() (dAtA []byte, err error) {
 	s := &Array{
-		Items: make([]*Item, len(m.Kv)),
+		Items:   make([]*Item, len(m.Kv)),
+		Trailer: &Trailer{ItemCount: uint64(len(m.Kv))},
 	}
 	i := 0
 	for _, item := range m.Kv {
 		s.Items[i] = item
+		if i == 0 || item.BlockNum < s.Trailer.FirstBlockNum {
+			s.Trailer.FirstBlockNum = item.BlockNum
+		}
+		if item.BlockNum > s.Trailer.LastBlockNum {
+			s.Trailer.LastBlockNum = item.BlockNum
+		}
 		i++
 	}
+	sort.Slice(s.Items, func(i, j int) bool {
+		return s.Items[i].BlockNum < s.Items[j].BlockNum
+	})
 	return s.MarshalVT()
 }
 
-// Faster unmarshalling when it was converted to array first
-func (m *Map) UnmarshalFast(dAtA []byte) error {
+// Faster unmarshalling when it was converted to array first. It returns the
+// Trailer of the data, nil if it was marshalled before trailers were introduced.
+func (m *Map) UnmarshalFast(dAtA []byte) (*Trailer, error) {
 	o := &Array{}
 	if err := o.UnmarshalVTNoAlloc(dAtA); err != nil {
-		return fmt.Errorf("unmarshalling data: %w", err)
+		return nil, fmt.Errorf("unmarshalling data: %w", err)
 	}
 
 	m.Kv = make(map[string]*Item)
 	for _, item := range o.Items {
 		m.Kv[item.BlockId] = item
 	}
-	return nil
+	return o.Trailer, nil
 }
 
 // Copy of Array's UnmarshalVT method, with unsafeGetString
@@ -106,6 +120,42 @@ func (m *Array) UnmarshalVTNoAlloc(dAtA []byte) error {
 				return err
 			}
 			iNdEx = postIndex
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Trailer", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflow
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLength
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLength
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if m.Trailer == nil {
+				m.Trailer = &Trailer{}
+			}
+			if err := m.Trailer.UnmarshalVT(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skip(dAtA[iNdEx:])
@@ -0,0 +1,321 @@
+package execout
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/streamingfast/dstore"
+	"go.uber.org/zap"
+
+	"github.com/streamingfast/substreams/metrics"
+	"github.com/streamingfast/substreams/storage/layout"
+	"github.com/streamingfast/substreams/storage/lease"
+)
+
+// Pruner deletes the segments of the execution outputs unused for longer than
+// a maximum age, so that the outputs of modules no longer requested don't
+// accumulate forever. The last use of a segment is the latest of its write
+// and of the write of its access marker (see AccessTracker), so the accesses
+// must be tracked by all the tier1 and tier2 servers reading the outputs.
+// The segments of the modules with an active lease (see package `lease`) are
+// left alone.
+//
+// The blobs of the segments written content-addressed (see BlobsDir) are
+// swept once no segment file references them anymore, provided they were
+// written longer than the maximum age plus blobRefreshAge ago: a blob is
+// written, or written again when older than blobRefreshAge, before the segment
+// files referencing it, so a blob referenced after the scan is never that old.
+type Pruner struct {
+	stateStore dstore.Store
+	maxAge     time.Duration
+	interval   time.Duration
+	dryRun     bool
+	logger     *zap.Logger
+
+	now func() time.Time
+}
+
+// NewPruner returns a pruner scanning `stateStore`, the root of the state
+// store, files laid out in v1 or v2 (see package `layout`). In `dryRun` mode,
+// the expired segments are only logged and counted.
+func NewPruner(stateStore dstore.Store, maxAge, interval time.Duration, dryRun bool, logger *zap.Logger) *Pruner {
+	return &Pruner{
+		stateStore: stateStore,
+		maxAge:     maxAge,
+		interval:   interval,
+		dryRun:     dryRun,
+		logger:     logger.Named("execout_pruner"),
+		now:        time.Now,
+	}
+}
+
+// Run scans the state store every interval, until `ctx` is done.
+func (p *Pruner) Run(ctx context.Context) {
+	p.logger.Info("starting execout pruner", zap.Duration("max_age", p.maxAge), zap.Duration("interval", p.interval), zap.Bool("dry_run", p.dryRun))
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		start := time.Now()
+		deleted, err := p.Prune(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			metrics.ExecOutPrunerErrors.Inc()
+			p.logger.Warn("pruning execout segments", zap.Error(err))
+			continue
+		}
+		p.logger.Info("pruned execout segments", zap.Int("deleted_count", len(deleted)), zap.Duration("duration", time.Since(start)))
+	}
+}
+
+type prunedSegment struct {
+	filePath   string // empty for the markers whose segment is gone
+	markerPath string // empty for the segments never accessed
+}
+
+// Prune scans the state store once and deletes the segments unused for longer
+// than the maximum age, with their access marker, then the blobs referenced by
+// no segment left, returning their paths. The access markers of deleted
+// segments are deleted once expired. In dry-run mode, nothing is deleted and
+// the returned paths are those that would have been.
+func (p *Pruner) Prune(ctx context.Context) (deleted []string, err error) {
+	segments, outputs, blobs, err := p.scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var expired []*prunedSegment
+	var segmentCount uint64
+	for _, segment := range segments {
+		if segment.filePath != "" {
+			segmentCount++
+		}
+		lastUse, err := p.lastUse(ctx, segment)
+		if err != nil {
+			metrics.ExecOutPrunerErrors.Inc()
+			p.logger.Warn("reading execout segment last use", zap.String("path", segment.filePath), zap.String("marker_path", segment.markerPath), zap.Error(err))
+			continue
+		}
+		if p.now().Sub(lastUse) >= p.maxAge {
+			expired = append(expired, segment)
+		}
+	}
+	metrics.ExecOutPrunerSegments.SetUint64(segmentCount)
+	metrics.ExecOutPrunerExpiredSegments.SetUint64(uint64(len(expired)))
+
+	for _, segment := range expired {
+		if p.dryRun {
+			p.logger.Info("would delete unused execout segment", zap.String("path", segment.filePath), zap.String("marker_path", segment.markerPath))
+			deleted = append(deleted, segment.paths()...)
+			continue
+		}
+
+		if err := p.delete(ctx, segment); err != nil {
+			metrics.ExecOutPrunerErrors.Inc()
+			p.logger.Warn("deleting unused execout segment", zap.String("path", segment.filePath), zap.Error(err))
+			continue
+		}
+		if segment.filePath != "" {
+			metrics.ExecOutPrunerDeletedSegments.Inc()
+		}
+		deleted = append(deleted, segment.paths()...)
+	}
+
+	if len(blobs) != 0 {
+		deletedBlobs, err := p.sweepBlobs(ctx, outputs, blobs, expired)
+		if err != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, deletedBlobs...)
+	}
+	return deleted, nil
+}
+
+// sweepBlobs deletes the blobs referenced by none of the segment files
+// `outputs` left once the `expired` segments are deleted, see BlobsDir.
+func (p *Pruner) sweepBlobs(ctx context.Context, outputs, blobs []string, expired []*prunedSegment) (deleted []string, err error) {
+	gone := make(map[string]bool, len(expired))
+	for _, segment := range expired {
+		gone[segment.filePath] = true
+	}
+	referenced := make(map[string]bool)
+	for _, filePath := range outputs {
+		if gone[filePath] {
+			continue
+		}
+		blob, err := p.readBlobRef(ctx, filePath)
+		if err == dstore.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			// a blob left unmarked could still be referenced, sweep none
+			return nil, fmt.Errorf("reading execout segment %q: %w", filePath, err)
+		}
+		if blob != "" {
+			referenced[blob] = true
+		}
+	}
+
+	for _, blobPath := range blobs {
+		if referenced[path.Base(blobPath)] {
+			continue
+		}
+		attrs, err := p.stateStore.ObjectAttributes(ctx, blobPath)
+		if err != nil {
+			metrics.ExecOutPrunerErrors.Inc()
+			p.logger.Warn("reading execout blob attributes", zap.String("path", blobPath), zap.Error(err))
+			continue
+		}
+		if p.now().Sub(attrs.LastModified) < p.maxAge+blobRefreshAge {
+			continue // its segment files may not be written yet, or after the scan
+		}
+
+		if p.dryRun {
+			p.logger.Info("would delete unreferenced execout blob", zap.String("path", blobPath))
+			deleted = append(deleted, blobPath)
+			continue
+		}
+		if err := p.stateStore.DeleteObject(ctx, blobPath); err != nil {
+			metrics.ExecOutPrunerErrors.Inc()
+			p.logger.Warn("deleting unreferenced execout blob", zap.String("path", blobPath), zap.Error(err))
+			continue
+		}
+		metrics.ExecOutPrunerDeletedBlobs.Inc()
+		deleted = append(deleted, blobPath)
+	}
+	return deleted, nil
+}
+
+// readBlobRef returns the blob referenced by the segment file `filePath`,
+// empty when it holds the outputs themselves. Only the beginning of the file
+// is read.
+func (p *Pruner) readBlobRef(ctx context.Context, filePath string) (string, error) {
+	reader, err := p.stateStore.OpenObject(ctx, filePath)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(io.LimitReader(reader, int64(maxBlobRefLen)+1))
+	if err != nil {
+		return "", err
+	}
+	if len(data) > maxBlobRefLen {
+		return "", nil
+	}
+	blob, _ := parseBlobRef(data)
+	return blob, nil
+}
+
+func (s *prunedSegment) paths() (out []string) {
+	for _, filePath := range []string{s.filePath, s.markerPath} {
+		if filePath != "" {
+			out = append(out, filePath)
+		}
+	}
+	return
+}
+
+// delete deletes the segment before its marker, so that a segment is never
+// left without the marker of its last use.
+func (p *Pruner) delete(ctx context.Context, segment *prunedSegment) error {
+	for _, filePath := range segment.paths() {
+		if err := p.stateStore.DeleteObject(ctx, filePath); err != nil {
+			return fmt.Errorf("deleting %q: %w", filePath, err)
+		}
+	}
+	return nil
+}
+
+func (p *Pruner) lastUse(ctx context.Context, segment *prunedSegment) (out time.Time, err error) {
+	for _, filePath := range segment.paths() {
+		attrs, err := p.stateStore.ObjectAttributes(ctx, filePath)
+		if err != nil {
+			return out, fmt.Errorf("reading attributes of %q: %w", filePath, err)
+		}
+		if attrs.LastModified.After(out) {
+			out = attrs.LastModified
+		}
+	}
+	return out, nil
+}
+
+// scan returns the segments of the execution outputs and the access markers of
+// the modules of the state store not leased, sorted by path, along with the
+// segment files of all the modules and the blobs, see BlobsDir.
+func (p *Pruner) scan(ctx context.Context) (out []*prunedSegment, outputs, blobs []string, err error) {
+	leases, err := lease.Active(ctx, p.stateStore)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	segments := map[string]*prunedSegment{} // by `<module_hash>/<segment filename>`
+	err = p.stateStore.Walk(ctx, "", func(filePath string) error {
+		if strings.HasPrefix(filePath, BlobsDir+"/") {
+			blobs = append(blobs, filePath)
+			return nil
+		}
+
+		v1Path := filePath
+		if v, ok := layout.V1Path(filePath); ok {
+			v1Path = v
+		}
+
+		dir, filename := path.Split(v1Path)
+		moduleHash, kind := path.Split(strings.TrimSuffix(dir, "/"))
+		moduleHash = strings.TrimSuffix(moduleHash, "/")
+		if moduleHash == "" || strings.Contains(moduleHash, "/") {
+			return nil
+		}
+		if kind != "outputs" && kind != AccessedDir {
+			return nil
+		}
+		if _, err := fileNameToRange(filename); err != nil {
+			return nil
+		}
+		if kind == "outputs" {
+			outputs = append(outputs, filePath)
+		}
+		if leases[moduleHash] != nil {
+			return nil
+		}
+
+		key := moduleHash + "/" + filename
+		segment := segments[key]
+		if segment == nil {
+			segment = &prunedSegment{}
+			segments[key] = segment
+		}
+		if kind == AccessedDir {
+			segment.markerPath = filePath
+		} else {
+			segment.filePath = filePath
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("walking state store: %w", err)
+	}
+
+	out = make([]*prunedSegment, 0, len(segments))
+	for _, segment := range segments {
+		out = append(out, segment)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].paths()[0] < out[j].paths()[0]
+	})
+	return out, outputs, blobs, nil
+}
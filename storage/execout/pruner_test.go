@@ -0,0 +1,222 @@
+package execout
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/streamingfast/dstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/streamingfast/substreams/block"
+	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
+	"github.com/streamingfast/substreams/storage/lease"
+)
+
+func TestPruner_Prune(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	stateStore, err := dstore.NewStore("file://"+dir, "", "", true)
+	require.NoError(t, err)
+
+	now := time.Now()
+	for file, age := range map[string]time.Duration{
+		"abc/outputs/0000000000-0000001000.output":               30 * time.Hour, // accessed recently
+		"abc/accessed/0000000000-0000001000.output":              time.Hour,
+		"abc/outputs/0000001000-0000002000.output":               30 * time.Hour, // accessed long ago
+		"abc/accessed/0000001000-0000002000.output":              25 * time.Hour,
+		"abc/outputs/0000002000-0000003000.output":               30 * time.Hour, // never accessed
+		"abc/outputs/0000003000-0000004000.output":               time.Hour,      // written recently
+		"abc/accessed/0000008000-0000009000.output":              25 * time.Hour, // segment gone
+		"abc/states/0000001000-0000000000.kv":                    30 * time.Hour,
+		"de/def/outputs/0000000000/0000000000-0000001000.output": 30 * time.Hour,
+		"ghi/outputs/0000000000-0000001000.output":               30 * time.Hour, // leased
+	} {
+		require.NoError(t, stateStore.WriteObject(ctx, file, strings.NewReader("{}")))
+		mtime := now.Add(-age)
+		require.NoError(t, os.Chtimes(filepath.Join(dir, file), mtime, mtime))
+	}
+	_, err = lease.Acquire(ctx, stateStore, "ghi", "migration", "", time.Hour)
+	require.NoError(t, err)
+
+	expected := []string{
+		"abc/outputs/0000001000-0000002000.output",
+		"abc/accessed/0000001000-0000002000.output",
+		"abc/outputs/0000002000-0000003000.output",
+		"abc/accessed/0000008000-0000009000.output",
+		"de/def/outputs/0000000000/0000000000-0000001000.output",
+	}
+
+	dryRun := NewPruner(stateStore, 24*time.Hour, time.Hour, true, zap.NewNop())
+	deleted, err := dryRun.Prune(ctx)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, expected, deleted)
+	for _, file := range expected {
+		exists, err := stateStore.FileExists(ctx, file)
+		require.NoError(t, err)
+		assert.True(t, exists, "dry run keeps %s", file)
+	}
+
+	pruner := NewPruner(stateStore, 24*time.Hour, time.Hour, false, zap.NewNop())
+	deleted, err = pruner.Prune(ctx)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, expected, deleted)
+	for _, file := range expected {
+		exists, err := stateStore.FileExists(ctx, file)
+		require.NoError(t, err)
+		assert.False(t, exists, file)
+	}
+
+	pruner.now = func() time.Time { return now.Add(48 * time.Hour) }
+	deleted, err = pruner.Prune(ctx)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		"abc/outputs/0000000000-0000001000.output",
+		"abc/accessed/0000000000-0000001000.output",
+		"abc/outputs/0000003000-0000004000.output",
+	}, deleted)
+
+	exists, err := stateStore.FileExists(ctx, "abc/states/0000001000-0000000000.kv")
+	require.NoError(t, err)
+	assert.True(t, exists, "store snapshots are not pruned")
+	exists, err = stateStore.FileExists(ctx, "ghi/outputs/0000000000-0000001000.output")
+	require.NoError(t, err)
+	assert.True(t, exists, "leased modules are not pruned")
+}
+
+func TestPruner_Blobs(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	stateStore, err := dstore.NewStore("file://"+dir, "", "", true)
+	require.NoError(t, err)
+
+	blob := func(content string) string { return blobFilename([]byte(content)) }
+	now := time.Now()
+	for file, content := range map[string]string{
+		"abc/outputs/0000000000-0000001000.output":  string(blobRef(blob("a"))), // accessed recently
+		"abc/accessed/0000000000-0000001000.output": "{}",
+		"abc/outputs/0000001000-0000002000.output":  string(blobRef(blob("b"))), // expired, blob still referenced by a leased module
+		"abc/outputs/0000002000-0000003000.output":  string(blobRef(blob("c"))), // expired
+		"ghi/outputs/0000000000-0000001000.output":  string(blobRef(blob("b"))), // leased
+		BlobsDir + "/" + blob("a"):                  "a",
+		BlobsDir + "/" + blob("b"):                  "b",
+		BlobsDir + "/" + blob("c"):                  "c",
+		BlobsDir + "/" + blob("d"):                  "d", // unreferenced
+	} {
+		require.NoError(t, stateStore.WriteObject(ctx, file, strings.NewReader(content)))
+		mtime := now.Add(-30 * time.Hour)
+		if strings.HasPrefix(file, "abc/accessed/") {
+			mtime = now.Add(-time.Hour)
+		}
+		require.NoError(t, os.Chtimes(filepath.Join(dir, file), mtime, mtime))
+	}
+	require.NoError(t, stateStore.WriteObject(ctx, BlobsDir+"/"+blob("e"), strings.NewReader("e"))) // written recently, unreferenced
+	_, err = lease.Acquire(ctx, stateStore, "ghi", "migration", "", time.Hour)
+	require.NoError(t, err)
+
+	expected := []string{
+		"abc/outputs/0000001000-0000002000.output",
+		"abc/outputs/0000002000-0000003000.output",
+		BlobsDir + "/" + blob("c"),
+		BlobsDir + "/" + blob("d"),
+	}
+
+	dryRun := NewPruner(stateStore, 24*time.Hour, time.Hour, true, zap.NewNop())
+	deleted, err := dryRun.Prune(ctx)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, expected, deleted)
+
+	pruner := NewPruner(stateStore, 24*time.Hour, time.Hour, false, zap.NewNop())
+	deleted, err = pruner.Prune(ctx)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, expected, deleted)
+	for _, content := range []string{"a", "b", "e"} {
+		exists, err := stateStore.FileExists(ctx, BlobsDir+"/"+blob(content))
+		require.NoError(t, err)
+		assert.True(t, exists, "blob %q kept", content)
+	}
+}
+
+func TestPruner_BlobLateReference(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	stateStore, err := dstore.NewStore("file://"+dir, "", "", true)
+	require.NoError(t, err)
+
+	pruner := NewPruner(stateStore, 24*time.Hour, time.Hour, false, zap.NewNop())
+	save := func(moduleHash string) {
+		config, err := NewConfig("A", 0, pbsubstreams.ModuleKindMap, moduleHash, stateStore, zap.NewNop())
+		require.NoError(t, err)
+		config.contentAddressed = true
+		file := config.NewFile(block.NewBoundedRange(0, 1000, 0, 1000))
+		file.SetItem(&pbsubstreams.Clock{Number: 10, Id: "10a"}, []byte("data"))
+		write, err := file.Save(ctx)
+		require.NoError(t, err)
+		write()
+	}
+
+	// a blob written long ago, unreferenced when scanned
+	save("abc")
+	var blobs []string
+	require.NoError(t, stateStore.Walk(ctx, BlobsDir+"/", func(filename string) error {
+		blobs = append(blobs, filename)
+		return nil
+	}))
+	require.Len(t, blobs, 1)
+	blobPath := blobs[0]
+	require.NoError(t, stateStore.DeleteObject(ctx, "abc/outputs/0000000000-0000001000.output"))
+	mtime := time.Now().Add(-30 * time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(dir, blobPath), mtime, mtime))
+
+	segments, outputs, _, err := pruner.scan(ctx)
+	require.NoError(t, err)
+	require.Empty(t, segments)
+
+	// deduplicated by a segment written after the scan
+	save("def")
+
+	deleted, err := pruner.sweepBlobs(ctx, outputs, []string{blobPath}, nil)
+	require.NoError(t, err)
+	assert.Empty(t, deleted)
+	exists, err := stateStore.FileExists(ctx, blobPath)
+	require.NoError(t, err)
+	assert.True(t, exists, "a blob referenced after the scan is kept")
+}
+
+func TestAccessTracker(t *testing.T) {
+	ctx := context.Background()
+	baseStore, err := dstore.NewStore("file://"+t.TempDir(), "", "", true)
+	require.NoError(t, err)
+
+	config, err := NewConfig("A", 0, pbsubstreams.ModuleKindMap, "abc", baseStore, zap.NewNop())
+	require.NoError(t, err)
+	configs := &Configs{ConfigMap: map[string]*Config{"A": config}}
+
+	file := configs.NewFile("A", block.NewBoundedRange(0, 1000, 0, 1000))
+	file.SetItem(&pbsubstreams.Clock{Number: 10, Id: "10a"}, []byte("data"))
+	write, err := file.Save(ctx)
+	require.NoError(t, err)
+	write()
+
+	configs.SetAccessTracker(NewAccessTracker(time.Hour, zap.NewNop()))
+	file = configs.NewFile("A", block.NewBoundedRange(0, 1000, 0, 1000))
+	require.NoError(t, file.Load(ctx))
+
+	markerPath := "abc/accessed/0000000000-0000001000.output"
+	require.Eventually(t, func() bool {
+		exists, err := baseStore.FileExists(ctx, markerPath)
+		return err == nil && exists
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, baseStore.DeleteObject(ctx, markerPath))
+	require.NoError(t, file.Load(ctx))
+	time.Sleep(50 * time.Millisecond)
+	exists, err := baseStore.FileExists(ctx, markerPath)
+	require.NoError(t, err)
+	assert.False(t, exists, "the marker is written at most once per resolution")
+}
@@ -2,32 +2,53 @@ package execout
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"github.com/streamingfast/dstore"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/streamingfast/bstream"
+	"github.com/streamingfast/dstore"
 	"github.com/streamingfast/shutter"
 	"go.uber.org/zap"
 	"google.golang.org/protobuf/types/known/anypb"
 
 	"github.com/streamingfast/substreams"
+	"github.com/streamingfast/substreams/block"
 	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
 	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
 	"github.com/streamingfast/substreams/reqctx"
 	pboutput "github.com/streamingfast/substreams/storage/execout/pb"
 )
 
+// MissingSegmentFunc is called when the cached outputs of a segment cannot be found, or are invalid.
+// It returns `handled == false` when the segment is expected to be produced by a
+// scheduled job, in which case the reader keeps waiting for it. Otherwise, it
+// re-executes the module over the segment, writing its cached outputs back.
+type MissingSegmentFunc func(ctx context.Context, segment *block.Range) (handled bool, err error)
+
+// SkipSegmentFunc tells if the cached outputs of a segment that cannot be found
+// are empty, the module matching no block of its block filter over it. The
+// reader then skips the segment instead of waiting for it.
+type SkipSegmentFunc func(ctx context.Context, segment *block.Range) (bool, error)
+
 type LinearReader struct {
 	*shutter.Shutter
 	requestStartBlock  uint64
 	exclusiveEndBlock  uint64
 	responseFunc       substreams.ResponseFunc
 	pendingUndoMessage *pbsubstreamsrpc.Response
-	module             *pbsubstreams.Module
-	firstFile          *File
-	cacheItems         chan *pboutput.Item
+	modules            []*readerModule       // the output module first, then the others, see AddOutputModule
+	cacheBlocks        chan []*pboutput.Item // the items of a block, by module, nil for the modules with no output on it
+}
+
+// readerModule is an output module whose cached outputs are read.
+type readerModule struct {
+	module           *pbsubstreams.Module
+	firstFile        *File
+	onMissingSegment MissingSegmentFunc
+	skipSegment      SkipSegmentFunc // nil when the module is not filtered
 }
 
 func NewLinearReader(
@@ -38,22 +59,38 @@ func NewLinearReader(
 	responseFunc substreams.ResponseFunc,
 	execOutputSaveInterval uint64,
 	pendingUndoMessage *pbsubstreamsrpc.Response,
+	onMissingSegment MissingSegmentFunc,
 ) *LinearReader {
 	return &LinearReader{
 		Shutter:            shutter.New(),
 		requestStartBlock:  startBlock,
 		exclusiveEndBlock:  exclusiveEndBlock,
-		module:             module,
-		firstFile:          firstFile,
+		modules:            []*readerModule{{module: module, firstFile: firstFile, onMissingSegment: onMissingSegment}},
 		responseFunc:       responseFunc,
 		pendingUndoMessage: pendingUndoMessage,
-		cacheItems:         make(chan *pboutput.Item, execOutputSaveInterval*2),
+		cacheBlocks:        make(chan []*pboutput.Item, execOutputSaveInterval*2),
 	}
 }
 
+// SetSkipSegment makes the reader skip the segments of the output module
+// without cached outputs for which `f` returns true, see SkipSegmentFunc.
+func (r *LinearReader) SetSkipSegment(f SkipSegmentFunc) {
+	r.modules[0].skipSegment = f
+}
+
+// AddOutputModule makes the reader also stream the cached outputs of `module`,
+// starting with `firstFile`, for the requests with several output modules.
+// Each block is then sent as one BlockScopedData per module, in the order they
+// were added after the output module, all with the block's cursor, like the
+// linear pipeline does. The modules without output on a block get an output
+// without data. `skipSegment` may be nil, see SetSkipSegment.
+func (r *LinearReader) AddOutputModule(module *pbsubstreams.Module, firstFile *File, onMissingSegment MissingSegmentFunc, skipSegment SkipSegmentFunc) {
+	r.modules = append(r.modules, &readerModule{module: module, firstFile: firstFile, onMissingSegment: onMissingSegment, skipSegment: skipSegment})
+}
+
 func (r *LinearReader) Launch(ctx context.Context) {
 	logger := reqctx.Logger(ctx)
-	logger.Info("launching downloader", zap.Uint64("start_block", r.requestStartBlock), zap.Uint64("exclusive_end_block", r.exclusiveEndBlock))
+	logger.Info("launching downloader", zap.Uint64("start_block", r.requestStartBlock), zap.Uint64("exclusive_end_block", r.exclusiveEndBlock), zap.Int("module_count", len(r.modules)))
 
 	go func() {
 		ctx, span := reqctx.WithSpan(ctx, "substreams/tier1/pipeline/linear_reader")
@@ -67,10 +104,10 @@ func (r *LinearReader) run(ctx context.Context) error {
 	logger := reqctx.Logger(ctx)
 
 	go func() {
-		if err := r.download(ctx, r.firstFile); err != nil {
+		if err := r.download(ctx); err != nil {
 			r.Shutdown(err)
 		}
-		close(r.cacheItems)
+		close(r.cacheBlocks)
 	}()
 
 	for {
@@ -79,11 +116,12 @@ func (r *LinearReader) run(ctx context.Context) error {
 			return nil
 		case <-r.Terminating():
 			return nil
-		case item := <-r.cacheItems:
-			if item == nil {
+		case items := <-r.cacheBlocks:
+			if items == nil {
 				return nil
 			}
-			if item.BlockNum < r.requestStartBlock {
+			clock := toClock(firstItem(items))
+			if clock.Number < r.requestStartBlock {
 				continue
 			}
 
@@ -94,16 +132,20 @@ func (r *LinearReader) run(ctx context.Context) error {
 				r.pendingUndoMessage = nil
 			}
 
-			blockScopedData, err := toBlockScopedData(r.module, item)
-			err = r.responseFunc(substreams.NewBlockScopedDataResponse(blockScopedData))
+			blockScopedDatas, err := r.toBlockScopedDatas(clock, items)
 			if err != nil {
-				return fmt.Errorf("calling response func: %w", err)
+				return fmt.Errorf("block scoped data: %w", err)
+			}
+			for _, blockScopedData := range blockScopedDatas {
+				if err := r.responseFunc(substreams.NewBlockScopedDataResponse(blockScopedData)); err != nil {
+					return fmt.Errorf("calling response func: %w", err)
+				}
 			}
 
-			if blockScopedData.Clock.Number >= r.exclusiveEndBlock {
+			if clock.Number >= r.exclusiveEndBlock {
 				logger.Info("stop pulling block scoped data, end block reach",
 					zap.Uint64("exclusive_end_block_num", r.exclusiveEndBlock),
-					zap.Uint64("cache_item_block_num", blockScopedData.Clock.Number),
+					zap.Uint64("cache_item_block_num", clock.Number),
 				)
 				return nil
 			}
@@ -111,37 +153,71 @@ func (r *LinearReader) run(ctx context.Context) error {
 	}
 }
 
-func (r *LinearReader) download(ctx context.Context, file *File) error {
+// download reads the cached outputs of the modules segment by segment, and
+// sends the items of each block, by module, in block order. All the modules
+// start at or before the request start block, their segments are aligned.
+func (r *LinearReader) download(ctx context.Context) error {
+	files := make([]*File, len(r.modules))
+	for i, module := range r.modules {
+		files[i] = module.firstFile
+	}
+
 	for {
-		sortedCachedItems, err := r.downloadFile(ctx, file)
-		if err != nil {
-			return fmt.Errorf("getting sorted cache items: %w", err)
+		var segmentEnd uint64
+		for _, file := range files {
+			if file != nil && (segmentEnd == 0 || file.ExclusiveEndBlock < segmentEnd) {
+				segmentEnd = file.ExclusiveEndBlock
+			}
+		}
+		if segmentEnd == 0 {
+			return nil
 		}
 
-		for _, cachedItem := range sortedCachedItems {
+		blocks := map[uint64][]*pboutput.Item{}
+		var blockNums []uint64
+		for i, file := range files {
+			if file == nil || file.ExclusiveEndBlock != segmentEnd {
+				continue
+			}
+			sortedCachedItems, err := r.downloadFile(ctx, r.modules[i], file)
+			if err != nil {
+				return fmt.Errorf("getting sorted cache items: %w", err)
+			}
+			for _, cachedItem := range sortedCachedItems {
+				items := blocks[cachedItem.BlockNum]
+				if items == nil {
+					items = make([]*pboutput.Item, len(files))
+					blocks[cachedItem.BlockNum] = items
+					blockNums = append(blockNums, cachedItem.BlockNum)
+				}
+				items[i] = cachedItem
+			}
+			files[i] = file.NextFile()
+		}
+		sort.Slice(blockNums, func(i, j int) bool { return blockNums[i] < blockNums[j] })
+
+		for _, blockNum := range blockNums {
 			select {
-			case r.cacheItems <- cachedItem:
+			case r.cacheBlocks <- blocks[blockNum]:
 			case <-r.Terminating():
 				return nil
 			case <-ctx.Done():
 				return nil
 			}
 		}
-
-		file = file.NextFile()
-		if file == nil {
-			return nil
-		}
 	}
 }
 
-func (r *LinearReader) downloadFile(ctx context.Context, file *File) ([]*pboutput.Item, error) {
+func (r *LinearReader) downloadFile(ctx context.Context, module *readerModule, file *File) ([]*pboutput.Item, error) {
 	logger := reqctx.Logger(ctx)
+	reexecuted := false
 	for {
 		logger.Debug("loading next cache", zap.Object("file", file))
 
 		err := file.Load(ctx)
-		if err != nil && err != dstore.ErrNotFound {
+		var invalidErr *InvalidFileError
+		isInvalid := errors.As(err, &invalidErr)
+		if err != nil && err != dstore.ErrNotFound && !isInvalid {
 			return nil, fmt.Errorf("loading %s cache %q: %w", file.ModuleName, file.Filename(), err)
 		}
 
@@ -150,9 +226,44 @@ func (r *LinearReader) downloadFile(ctx context.Context, file *File) ([]*pboutpu
 			return file.SortedItems(), nil
 		}
 
+		if err == dstore.ErrNotFound && module.skipSegment != nil {
+			skip, err := module.skipSegment(ctx, file.Range)
+			if err != nil {
+				return nil, fmt.Errorf("checking %s block filter over %s: %w", file.ModuleName, file.Range, err)
+			}
+			if skip {
+				logger.Debug("skipping segment matching no block", zap.Object("file", file))
+				return nil, nil
+			}
+		}
+
+		if isInvalid {
+			// never serve a partial segment, re-executing it overwrites the invalid file
+			logger.Warn("cached outputs segment invalid", zap.String("module", file.ModuleName), zap.Error(err))
+		}
+
 		// TODO(abourget): if file.IsPartial(), we should delete it, it would mean it'd be left
 		// over, and never reused, unless an EXACT request would come and use it.
 
+		if module.onMissingSegment != nil {
+			if reexecuted {
+				return nil, fmt.Errorf("%s cache %q still missing after re-executing the segment: %w", file.ModuleName, file.Filename(), err)
+			}
+
+			handled, err := module.onMissingSegment(ctx, file.Range)
+			if err != nil {
+				return nil, fmt.Errorf("re-executing %s over missing segment %s: %w", file.ModuleName, file.Range, err)
+			}
+			if handled {
+				reexecuted = true
+				continue
+			}
+		}
+
+		if isInvalid {
+			return nil, fmt.Errorf("%s cache %q cannot be served: %w", file.ModuleName, file.Filename(), err)
+		}
+
 		logger.Debug("cache not found, waiting 2s", zap.Object("file", file))
 		select {
 		case <-time.After(2 * time.Second):
@@ -165,8 +276,9 @@ func (r *LinearReader) downloadFile(ctx context.Context, file *File) ([]*pboutpu
 	}
 }
 
-func toBlockScopedData(module *pbsubstreams.Module, cacheItem *pboutput.Item) (*pbsubstreamsrpc.BlockScopedData, error) {
-	clock := toClock(cacheItem)
+// toBlockScopedDatas returns the responses of the block `clock`, one per
+// module, from its cached outputs `items`, by module.
+func (r *LinearReader) toBlockScopedDatas(clock *pbsubstreams.Clock, items []*pboutput.Item) ([]*pbsubstreamsrpc.BlockScopedData, error) {
 	blockRef := bstream.NewBlockRef(clock.Id, clock.Number)
 	cursor := bstream.Cursor{
 		Step:      bstream.StepNewIrreversible,
@@ -174,21 +286,36 @@ func toBlockScopedData(module *pbsubstreams.Module, cacheItem *pboutput.Item) (*
 		LIB:       blockRef,
 		HeadBlock: blockRef,
 	}
-	out := &pbsubstreamsrpc.BlockScopedData{
-		Cursor:           cursor.ToOpaque(),
-		Clock:            clock,
-		FinalBlockHeight: blockRef.Num(),
-	}
+	opaqueCursor := cursor.ToOpaque()
 
-	m, err := toModuleOutput(module, cacheItem)
-	if err != nil {
-		return nil, fmt.Errorf("module output: %w", err)
+	out := make([]*pbsubstreamsrpc.BlockScopedData, len(items))
+	for i, item := range items {
+		m := &pbsubstreamsrpc.MapModuleOutput{Name: r.modules[i].module.Name}
+		if item != nil {
+			var err error
+			if m, err = toModuleOutput(r.modules[i].module, item); err != nil {
+				return nil, fmt.Errorf("module output: %w", err)
+			}
+		}
+		out[i] = &pbsubstreamsrpc.BlockScopedData{
+			Cursor:           opaqueCursor,
+			Clock:            clock,
+			FinalBlockHeight: blockRef.Num(),
+			Output:           m,
+		}
 	}
-	out.Output = m
-
 	return out, nil
 }
 
+func firstItem(items []*pboutput.Item) *pboutput.Item {
+	for _, item := range items {
+		if item != nil {
+			return item
+		}
+	}
+	return nil
+}
+
 func toModuleOutput(module *pbsubstreams.Module, cacheItem *pboutput.Item) (*pbsubstreamsrpc.MapModuleOutput, error) {
 	outputType := strings.TrimPrefix(module.Output.Type, "proto:")
 
@@ -0,0 +1,142 @@
+package execout
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/streamingfast/dstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/streamingfast/substreams"
+	"github.com/streamingfast/substreams/block"
+	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
+	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
+	pboutput "github.com/streamingfast/substreams/storage/execout/pb"
+)
+
+func TestLinearReader_MissingSegment(t *testing.T) {
+	ctx := context.Background()
+	baseStore, err := dstore.NewStore("file://"+t.TempDir(), "", "", false)
+	require.NoError(t, err)
+	config, err := NewConfig("A", 0, pbsubstreams.ModuleKindMap, "abcdef", baseStore, zap.NewNop())
+	require.NoError(t, err)
+
+	newFile := func() *File { return config.NewFile(block.NewBoundedRange(0, 10, 0, 10)) }
+
+	var reexecuted []*block.Range
+	reexecute := func(writeFile bool) MissingSegmentFunc {
+		return func(ctx context.Context, segment *block.Range) (bool, error) {
+			reexecuted = append(reexecuted, segment)
+			if writeFile {
+				file := newFile()
+				file.SetItem(&pbsubstreams.Clock{Id: "5a", Number: 5}, []byte("out"))
+				write, err := file.Save(ctx)
+				require.NoError(t, err)
+				write()
+			}
+			return true, nil
+		}
+	}
+
+	reader := NewLinearReader(0, 10, nil, nil, nil, 10, nil, reexecute(false))
+	_, err = reader.downloadFile(ctx, reader.modules[0], newFile())
+	assert.ErrorContains(t, err, "still missing after re-executing the segment")
+	assert.Equal(t, []*block.Range{block.NewRange(0, 10)}, reexecuted)
+
+	reexecuted = nil
+	reader = NewLinearReader(0, 10, nil, nil, nil, 10, nil, reexecute(true))
+	items, err := reader.downloadFile(ctx, reader.modules[0], newFile())
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, uint64(5), items[0].BlockNum)
+	assert.Len(t, reexecuted, 1)
+}
+
+func TestLinearReader_InvalidSegment(t *testing.T) {
+	ctx := context.Background()
+	baseStore, err := dstore.NewStore("file://"+t.TempDir(), "", "", false)
+	require.NoError(t, err)
+	config, err := NewConfig("A", 0, pbsubstreams.ModuleKindMap, "abcdef", baseStore, zap.NewNop())
+	require.NoError(t, err)
+
+	newFile := func() *File { return config.NewFile(block.NewBoundedRange(0, 10, 0, 10)) }
+
+	// a file truncated by a crash while being written
+	content, err := (&pboutput.Map{Kv: map[string]*pboutput.Item{
+		"4a": {BlockNum: 4, BlockId: "4a", Payload: []byte("out")},
+		"5a": {BlockNum: 5, BlockId: "5a", Payload: []byte("out")},
+	}}).MarshalFast()
+	require.NoError(t, err)
+	require.NoError(t, config.objStore.WriteObject(ctx, newFile().Filename(), bytes.NewReader(content[:len(content)-3])))
+
+	reader := NewLinearReader(0, 10, nil, nil, nil, 10, nil, nil)
+	_, err = reader.downloadFile(ctx, reader.modules[0], newFile())
+	assert.ErrorContains(t, err, "cannot be served")
+
+	var reexecuted []*block.Range
+	reader = NewLinearReader(0, 10, nil, nil, nil, 10, nil, func(ctx context.Context, segment *block.Range) (bool, error) {
+		reexecuted = append(reexecuted, segment)
+		file := newFile()
+		file.SetItem(&pbsubstreams.Clock{Id: "4a", Number: 4}, []byte("out"))
+		file.SetItem(&pbsubstreams.Clock{Id: "5a", Number: 5}, []byte("out"))
+		write, err := file.Save(ctx)
+		require.NoError(t, err)
+		write()
+		return true, nil
+	})
+	items, err := reader.downloadFile(ctx, reader.modules[0], newFile())
+	require.NoError(t, err)
+	assert.Len(t, items, 2)
+	assert.Equal(t, []*block.Range{block.NewRange(0, 10)}, reexecuted)
+}
+
+func TestLinearReader_OutputModules(t *testing.T) {
+	ctx := context.Background()
+	baseStore, err := dstore.NewStore("file://"+t.TempDir(), "", "", false)
+	require.NoError(t, err)
+
+	newFile := func(name string, rng *block.BoundedRange, outputs map[uint64]string) *File {
+		config, err := NewConfig(name, 0, pbsubstreams.ModuleKindMap, "hash"+name, baseStore, zap.NewNop())
+		require.NoError(t, err)
+		file := config.NewFile(rng)
+		for blockNum, output := range outputs {
+			file.SetItem(&pbsubstreams.Clock{Id: fmt.Sprintf("%da", blockNum), Number: blockNum}, []byte(output))
+		}
+		if len(outputs) != 0 {
+			write, err := file.Save(ctx)
+			require.NoError(t, err)
+			write()
+		}
+		return config.NewFile(rng)
+	}
+	module := func(name string) *pbsubstreams.Module {
+		return &pbsubstreams.Module{Name: name, Output: &pbsubstreams.Module_Output{Type: "proto:test"}}
+	}
+
+	newFile("A", block.NewBoundedRange(0, 10, 10, 20), map[uint64]string{11: "a11"})
+	newFile("B", block.NewBoundedRange(0, 10, 10, 20), map[uint64]string{11: "b11", 12: "b12"})
+	firstA := newFile("A", block.NewBoundedRange(0, 10, 5, 20), map[uint64]string{5: "a5", 6: "a6"})
+	firstB := newFile("B", block.NewBoundedRange(0, 10, 5, 20), map[uint64]string{6: "b6"})
+
+	var received []string
+	reader := NewLinearReader(5, 20, module("A"), firstA, func(resp substreams.ResponseFromAnyTier) error {
+		data := resp.(*pbsubstreamsrpc.Response).GetBlockScopedData()
+		received = append(received, fmt.Sprintf("%d:%s=%s", data.Clock.Number, data.Output.Name, data.Output.MapOutput.GetValue()))
+		return nil
+	}, 10, nil, nil)
+	reader.AddOutputModule(module("B"), firstB, nil, nil)
+	reader.Launch(ctx)
+	<-reader.Terminated()
+	require.NoError(t, reader.Err())
+
+	assert.Equal(t, []string{
+		"5:A=a5", "5:B=",
+		"6:A=a6", "6:B=b6",
+		"11:A=a11", "11:B=b11",
+		"12:A=", "12:B=b12",
+	}, received)
+}
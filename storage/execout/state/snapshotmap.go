@@ -24,20 +24,21 @@ func (s *SnapshotsMap) String() string {
 	return strings.Join(out, ", ")
 }
 
-func FetchMappersState(ctx context.Context, configs *execout.Configs, outputModule string) (*SnapshotsMap, error) {
-
-	config := configs.ConfigMap[outputModule]
-
-	if config == nil {
-		return nil, nil
+// FetchMappersState lists the cached outputs segments of each of the map
+// modules `outputModules`, by module name.
+func FetchMappersState(ctx context.Context, configs *execout.Configs, outputModules []string) (*SnapshotsMap, error) {
+	out := &SnapshotsMap{Snapshots: map[string]block.Ranges{}}
+	for _, outputModule := range outputModules {
+		config := configs.ConfigMap[outputModule]
+		if config == nil {
+			continue
+		}
+
+		snapshots, err := listSnapshots(ctx, config)
+		if err != nil {
+			return nil, err
+		}
+		out.Snapshots[outputModule] = snapshots
 	}
-
-	snapshots, err := listSnapshots(ctx, config)
-	if err != nil {
-		return nil, err
-	}
-
-	return &SnapshotsMap{
-		Snapshots: map[string]block.Ranges{outputModule: snapshots},
-	}, nil
+	return out, nil
 }
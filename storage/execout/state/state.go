@@ -12,11 +12,12 @@ type ExecOutputStorageState struct {
 
 	SegmentsPresent block.Ranges
 	SegmentsMissing block.Ranges
+	SegmentsSkipped block.Ranges // missing, but matching no block of the module's block filter, see SkipSegments
 }
 
 func (m ExecOutputStorageState) Name() string { return m.ModuleName }
 func (m ExecOutputStorageState) InitialProgressRanges() block.Ranges {
-	return m.SegmentsPresent.Merged()
+	return m.SegmentsPresent.Union(m.SegmentsSkipped)
 }
 func (m ExecOutputStorageState) ReadyUpToBlock() uint64 {
 	if len(m.SegmentsMissing) != 0 {
@@ -62,3 +63,22 @@ func NewExecOutputStorageState(config *execout.Config, saveInterval, requestStar
 
 	return
 }
+
+// SkipSegments moves the missing segments for which `skip` returns true to
+// SegmentsSkipped, no job being planned for them.
+func (m *ExecOutputStorageState) SkipSegments(skip func(segment *block.Range) (bool, error)) error {
+	var missing block.Ranges
+	for _, segment := range m.SegmentsMissing {
+		skipped, err := skip(segment)
+		if err != nil {
+			return err
+		}
+		if skipped {
+			m.SegmentsSkipped = append(m.SegmentsSkipped, segment)
+			continue
+		}
+		missing = append(missing, segment)
+	}
+	m.SegmentsMissing = missing
+	return nil
+}
@@ -0,0 +1,284 @@
+// Package faulty injects faults in the calls to a storage backend, to test
+// and harden the scheduler and the squashers against the object stores
+// misbehaving, see Store.
+package faulty
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/streamingfast/dstore"
+)
+
+var _ dstore.Store = (*Store)(nil)
+var _ dstore.Clonable = (*Store)(nil)
+
+// Config is the rate of each fault, from 0 (never) to 1 (every call).
+type Config struct {
+	MaxLatency       time.Duration // random latency, up to this duration, added to every call
+	ThrottleRate     float64       // calls failing as throttled by the object store (HTTP 429)
+	PartialWriteRate float64       // writes storing only the beginning of the content, then failing
+	CorruptReadRate  float64       // reads returning the content with a byte flipped, without error
+	Seed             int64         // seed of the faults, 0 for a random one
+}
+
+// ParseConfig parses the comma-separated `key=value` faults of `in`, keys
+// being `latency`, `throttle`, `partial_write`, `corrupt_read` and `seed`
+// (ex: `latency=50ms,throttle=0.01,partial_write=0.005`).
+func ParseConfig(in string) (*Config, error) {
+	config := &Config{}
+	for _, field := range strings.Split(in, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		key, value, found := strings.Cut(field, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid fault %q, expected key=value", field)
+		}
+
+		var err error
+		switch key {
+		case "latency":
+			config.MaxLatency, err = time.ParseDuration(value)
+		case "throttle":
+			config.ThrottleRate, err = parseRate(value)
+		case "partial_write":
+			config.PartialWriteRate, err = parseRate(value)
+		case "corrupt_read":
+			config.CorruptReadRate, err = parseRate(value)
+		case "seed":
+			config.Seed, err = strconv.ParseInt(value, 10, 64)
+		default:
+			return nil, fmt.Errorf("unknown fault %q, valid faults are 'latency', 'throttle', 'partial_write', 'corrupt_read' and 'seed'", key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("fault %q: %w", key, err)
+		}
+	}
+	return config, nil
+}
+
+func parseRate(in string) (float64, error) {
+	rate, err := strconv.ParseFloat(in, 64)
+	if err != nil {
+		return 0, err
+	}
+	if rate < 0 || rate > 1 {
+		return 0, fmt.Errorf("rate %s not between 0 and 1", in)
+	}
+	return rate, nil
+}
+
+// Fault is the kind of an injected failure.
+type Fault string
+
+const (
+	FaultThrottled    Fault = "throttled"
+	FaultPartialWrite Fault = "partial_write"
+)
+
+// Error is returned by the calls failed by an injected fault.
+type Error struct {
+	Fault Fault
+	Op    string
+	Name  string
+}
+
+func (e *Error) Error() string {
+	if e.Fault == FaultThrottled {
+		return fmt.Sprintf("%s %q: injected fault: 429 Too Many Requests", e.Op, e.Name)
+	}
+	return fmt.Sprintf("%s %q: injected fault: %s", e.Op, e.Name, e.Fault)
+}
+
+// Store wraps a store and injects the faults of its config in the calls to
+// it. The stores returned by SubStore and Clone share the random source of
+// the store they come from, so that a seeded config replays the same faults
+// for the same sequence of calls.
+type Store struct {
+	dstore.Store
+
+	config *Config
+	random *random
+}
+
+func NewStore(base dstore.Store, config *Config) *Store {
+	seed := config.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &Store{Store: base, config: config, random: &random{rand: rand.New(rand.NewSource(seed))}}
+}
+
+func (s *Store) wrap(base dstore.Store) *Store {
+	return &Store{Store: base, config: s.config, random: s.random}
+}
+
+// before injects the latency and the throttling common to every call.
+func (s *Store) before(ctx context.Context, op, name string) error {
+	if s.config.MaxLatency > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(s.random.duration(s.config.MaxLatency)):
+		}
+	}
+	if s.random.hit(s.config.ThrottleRate) {
+		return &Error{Fault: FaultThrottled, Op: op, Name: name}
+	}
+	return nil
+}
+
+func (s *Store) OpenObject(ctx context.Context, name string) (io.ReadCloser, error) {
+	if err := s.before(ctx, "open object", name); err != nil {
+		return nil, err
+	}
+
+	reader, err := s.Store.OpenObject(ctx, name)
+	if err != nil || !s.random.hit(s.config.CorruptReadRate) {
+		return reader, err
+	}
+	defer reader.Close()
+
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	if len(content) != 0 {
+		content[s.random.intn(len(content))] ^= 0xff
+	}
+	return io.NopCloser(bytes.NewReader(content)), nil
+}
+
+func (s *Store) WriteObject(ctx context.Context, name string, f io.Reader) error {
+	if err := s.before(ctx, "write object", name); err != nil {
+		return err
+	}
+	if !s.random.hit(s.config.PartialWriteRate) {
+		return s.Store.WriteObject(ctx, name, f)
+	}
+
+	content, err := io.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	if err := s.Store.WriteObject(ctx, name, bytes.NewReader(content[:len(content)/2])); err != nil {
+		return err
+	}
+	return &Error{Fault: FaultPartialWrite, Op: "write object", Name: name}
+}
+
+func (s *Store) FileExists(ctx context.Context, name string) (bool, error) {
+	if err := s.before(ctx, "file exists", name); err != nil {
+		return false, err
+	}
+	return s.Store.FileExists(ctx, name)
+}
+
+func (s *Store) ObjectAttributes(ctx context.Context, name string) (*dstore.ObjectAttributes, error) {
+	if err := s.before(ctx, "object attributes", name); err != nil {
+		return nil, err
+	}
+	return s.Store.ObjectAttributes(ctx, name)
+}
+
+func (s *Store) CopyObject(ctx context.Context, src, dest string) error {
+	if err := s.before(ctx, "copy object", src); err != nil {
+		return err
+	}
+	return s.Store.CopyObject(ctx, src, dest)
+}
+
+func (s *Store) PushLocalFile(ctx context.Context, localFile, toBaseName string) error {
+	if err := s.before(ctx, "push local file", toBaseName); err != nil {
+		return err
+	}
+	return s.Store.PushLocalFile(ctx, localFile, toBaseName)
+}
+
+func (s *Store) DeleteObject(ctx context.Context, name string) error {
+	if err := s.before(ctx, "delete object", name); err != nil {
+		return err
+	}
+	return s.Store.DeleteObject(ctx, name)
+}
+
+func (s *Store) Walk(ctx context.Context, prefix string, f func(filename string) error) error {
+	if err := s.before(ctx, "walk", prefix); err != nil {
+		return err
+	}
+	return s.Store.Walk(ctx, prefix, f)
+}
+
+func (s *Store) WalkFrom(ctx context.Context, prefix, startingPoint string, f func(filename string) error) error {
+	if err := s.before(ctx, "walk", prefix); err != nil {
+		return err
+	}
+	return s.Store.WalkFrom(ctx, prefix, startingPoint, f)
+}
+
+func (s *Store) ListFiles(ctx context.Context, prefix string, max int) ([]string, error) {
+	if err := s.before(ctx, "list files", prefix); err != nil {
+		return nil, err
+	}
+	return s.Store.ListFiles(ctx, prefix, max)
+}
+
+func (s *Store) SubStore(subFolder string) (dstore.Store, error) {
+	base, err := s.Store.SubStore(subFolder)
+	if err != nil {
+		return nil, err
+	}
+	return s.wrap(base), nil
+}
+
+// Clone clones the wrapped store when it is clonable, and shares it
+// otherwise.
+func (s *Store) Clone(ctx context.Context) (dstore.Store, error) {
+	clonable, ok := s.Store.(dstore.Clonable)
+	if !ok {
+		return s.wrap(s.Store), nil
+	}
+
+	base, err := clonable.Clone(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.wrap(base), nil
+}
+
+type random struct {
+	lock sync.Mutex
+	rand *rand.Rand
+}
+
+func (r *random) hit(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.rand.Float64() < rate
+}
+
+func (r *random) intn(n int) int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.rand.Intn(n)
+}
+
+func (r *random) duration(max time.Duration) time.Duration {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return time.Duration(r.rand.Int63n(int64(max)))
+}
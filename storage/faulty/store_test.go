@@ -0,0 +1,75 @@
+package faulty
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/streamingfast/dstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseConfig(t *testing.T) {
+	config, err := ParseConfig("latency=50ms, throttle=0.01,partial_write=0.5,corrupt_read=1,seed=42")
+	require.NoError(t, err)
+	assert.Equal(t, &Config{
+		MaxLatency:       50 * time.Millisecond,
+		ThrottleRate:     0.01,
+		PartialWriteRate: 0.5,
+		CorruptReadRate:  1,
+		Seed:             42,
+	}, config)
+
+	_, err = ParseConfig("throttle=2")
+	assert.Error(t, err)
+	_, err = ParseConfig("unknown=1")
+	assert.Error(t, err)
+	_, err = ParseConfig("latency")
+	assert.Error(t, err)
+}
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	base := newLocalStore(t)
+	content := []byte("0123456789")
+
+	throttled := NewStore(base, &Config{ThrottleRate: 1})
+	err := throttled.WriteObject(ctx, "file", bytes.NewReader(content))
+	var faultErr *Error
+	require.True(t, errors.As(err, &faultErr))
+	assert.Equal(t, FaultThrottled, faultErr.Fault)
+
+	sub, err := NewStore(base, &Config{PartialWriteRate: 1}).SubStore("sub")
+	require.NoError(t, err)
+	err = sub.WriteObject(ctx, "file", bytes.NewReader(content))
+	require.True(t, errors.As(err, &faultErr))
+	assert.Equal(t, FaultPartialWrite, faultErr.Fault)
+	assert.Equal(t, "01234", readObject(t, base, "sub/file"))
+
+	require.NoError(t, base.WriteObject(ctx, "file", bytes.NewReader(content)))
+	corrupted := readObject(t, NewStore(base, &Config{CorruptReadRate: 1}), "file")
+	assert.Len(t, corrupted, len(content))
+	assert.NotEqual(t, string(content), corrupted)
+
+	assert.Equal(t, string(content), readObject(t, NewStore(base, &Config{}), "file"))
+}
+
+func newLocalStore(t *testing.T) dstore.Store {
+	store, err := dstore.NewStore("file://"+t.TempDir(), "", "", true)
+	require.NoError(t, err)
+	return store
+}
+
+func readObject(t *testing.T, store dstore.Store, name string) string {
+	reader, err := store.OpenObject(context.Background(), name)
+	require.NoError(t, err)
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	return string(data)
+}
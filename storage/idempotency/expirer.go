@@ -0,0 +1,130 @@
+package idempotency
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/streamingfast/dstore"
+	"go.uber.org/zap"
+
+	"github.com/streamingfast/substreams/metrics"
+)
+
+// Expirer deletes the idempotency records of the objects since deleted (ex:
+// by the partial store reaper or the execution outputs pruner), so that the
+// records live as long as the objects they guard. The records written by
+// previous versions, one per object by hash of its URL, are deleted too.
+type Expirer struct {
+	stateStore dstore.Store
+	interval   time.Duration
+	logger     *zap.Logger
+}
+
+// NewExpirer returns an expirer scanning `stateStore`, the root of the state
+// store the ledgers record into, without layout translation.
+func NewExpirer(stateStore dstore.Store, interval time.Duration, logger *zap.Logger) *Expirer {
+	return &Expirer{
+		stateStore: stateStore,
+		interval:   interval,
+		logger:     logger.Named("idempotency_expirer"),
+	}
+}
+
+// Run expires the records every interval, until `ctx` is done.
+func (e *Expirer) Run(ctx context.Context) {
+	e.logger.Info("starting idempotency records expirer", zap.Duration("interval", e.interval))
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		start := time.Now()
+		expired, err := e.Expire(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			metrics.IdempotencyExpirerErrors.Inc()
+			e.logger.Warn("expiring idempotency records", zap.Error(err))
+			continue
+		}
+		e.logger.Info("expired idempotency records", zap.Int("expired_count", len(expired)), zap.Duration("duration", time.Since(start)))
+	}
+}
+
+// Expire deletes the records whose object doesn't exist anymore, returning
+// their paths. The objects are listed once per directory, after the records,
+// an object being always written before its record.
+func (e *Expirer) Expire(ctx context.Context) (expired []string, err error) {
+	var stale []string
+	records := map[string][]string{} // record names by object directory
+	err = e.stateStore.Walk(ctx, ledgerDir, func(filename string) error {
+		dir, name := path.Split(strings.TrimPrefix(filename, ledgerDir))
+		if _, _, ok := parseRecordName(name); !ok {
+			stale = append(stale, filename)
+			return nil
+		}
+		if dir != externalDir && dir != "" {
+			records[dir] = append(records[dir], name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("walking idempotency records: %w", err)
+	}
+
+	dirs := make([]string, 0, len(records))
+	for dir := range records {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	for _, dir := range dirs {
+		objects, err := e.objects(ctx, dir)
+		if err != nil {
+			return expired, err
+		}
+		for _, name := range records[dir] {
+			if objectName, _, _ := parseRecordName(name); !objects[objectName] {
+				stale = append(stale, ledgerDir+dir+name)
+			}
+		}
+	}
+
+	for _, recordPath := range stale {
+		if err := e.stateStore.DeleteObject(ctx, recordPath); err != nil {
+			metrics.IdempotencyExpirerErrors.Inc()
+			e.logger.Warn("deleting expired idempotency record", zap.String("path", recordPath), zap.Error(err))
+			continue
+		}
+		metrics.IdempotencyRecordsExpired.Inc()
+		expired = append(expired, recordPath)
+	}
+	return expired, nil
+}
+
+// objects returns the names of the objects directly in `dir`.
+func (e *Expirer) objects(ctx context.Context, dir string) (map[string]bool, error) {
+	files, err := e.stateStore.ListFiles(ctx, dir, math.MaxInt64)
+	if err != nil {
+		return nil, fmt.Errorf("listing objects of %q: %w", dir, err)
+	}
+	out := make(map[string]bool, len(files))
+	for _, file := range files {
+		if name := strings.TrimPrefix(file, dir); !strings.Contains(name, "/") {
+			out[name] = true
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,258 @@
+// Package idempotency makes the internal writes of the orchestration safe to
+// retry at least once, anywhere: the partial and full store snapshots, the
+// module outputs and the flush manifests.
+//
+// Every write carries a Key, derived from the trace ID of the request writing
+// and the unit it writes (the object). Once an object is written, the Ledger
+// records the key that completed it in the state store, under
+// `idempotency/<object_path>@<trace_id>`, the path of the object being relative
+// to the state store. Writers check the ledger first: an object already
+// completed, by a retry of the same unit or by another request writing the
+// same deterministic content, is not written again, so that retries never
+// produce duplicate or conflicting files. An object recorded but missing, since
+// deleted, is written again.
+//
+// The records of a directory are listed at once and kept for recordsTTL, so
+// that writing an object costs a single extra round trip to the state store,
+// the write of its record. The records of the objects since deleted are
+// expired by the Expirer.
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/streamingfast/dstore"
+
+	"github.com/streamingfast/substreams/metrics"
+)
+
+const ledgerDir = "idempotency/"
+
+// externalDir holds the records of the objects outside of the state store,
+// by hash of their URL, which are never expired.
+const externalDir = "_external/"
+
+// recordsTTL is how long the records listed from a directory are used before
+// being listed again. The records written meanwhile by other processes are
+// missed, their objects then being written again, like by concurrent writes.
+const recordsTTL = time.Minute
+
+// Key identifies a write: the request writing, by its trace ID, and the unit
+// written.
+type Key struct {
+	TraceID string `json:"trace_id"`
+	Unit    string `json:"unit"`
+}
+
+func NewKey(traceID, unit string) Key {
+	return Key{TraceID: traceID, Unit: unit}
+}
+
+func (k Key) String() string {
+	return k.TraceID + "/" + k.Unit
+}
+
+// Ledger records the key that completed each object written through it, see
+// Write. It is shared by all the requests of the process, a nil Ledger writes
+// without checking.
+type Ledger struct {
+	stateStore dstore.Store
+	urlPrefix  string // of the URLs of the objects of the state store, see relativePath
+	urlSuffix  string
+
+	mu          sync.Mutex
+	inflight    map[string]chan struct{} // by record path, closed once written
+	directories map[string]*directory    // by record directory
+}
+
+// directory holds the records of a directory, listed at once.
+type directory struct {
+	listedAt time.Time
+	records  map[string]string // trace ID by object name
+}
+
+func NewLedger(stateStore dstore.Store) *Ledger {
+	probe := stateStore.ObjectURL("_")
+	sep := strings.LastIndex(probe, "_")
+	return &Ledger{
+		stateStore:  stateStore,
+		urlPrefix:   probe[:sep],
+		urlSuffix:   probe[sep+1:],
+		inflight:    map[string]chan struct{}{},
+		directories: map[string]*directory{},
+	}
+}
+
+// Write writes `filename` to `store` by calling `write`, unless the object was
+// already completed and still exists. The writes of the same object by the
+// process are serialized. It returns whether `write` was called.
+func (l *Ledger) Write(ctx context.Context, store dstore.Store, filename string, traceID string, write func(ctx context.Context) error) (written bool, err error) {
+	if l == nil {
+		return true, write(ctx)
+	}
+
+	unit := store.ObjectURL(filename)
+	recordDir, objectName := l.recordLocation(unit)
+
+	release, err := l.acquire(ctx, recordDir+objectName)
+	if err != nil {
+		return false, err
+	}
+	defer release()
+
+	completedBy, completed, err := l.completedBy(ctx, recordDir, objectName)
+	if err != nil {
+		return false, err
+	}
+	if completed {
+		exists, err := store.FileExists(ctx, filename)
+		if err != nil {
+			return false, fmt.Errorf("checking %s exists: %w", filename, err)
+		}
+		if exists {
+			reason := "retry"
+			if completedBy != traceID {
+				reason = "conflict"
+			}
+			metrics.IdempotentWritesSkipped.Inc(reason)
+			return false, nil
+		}
+	}
+
+	if err := write(ctx); err != nil {
+		return true, err
+	}
+	if err := l.record(ctx, recordDir, objectName, NewKey(traceID, unit)); err != nil {
+		return true, err
+	}
+	if completed && completedBy != traceID {
+		// the record of the deleted object, replaced
+		_ = l.stateStore.DeleteObject(ctx, recordDir+recordName(objectName, completedBy))
+	}
+	return true, nil
+}
+
+// acquire waits for the write of the same object by the process, if any.
+func (l *Ledger) acquire(ctx context.Context, recordPath string) (release func(), err error) {
+	for {
+		l.mu.Lock()
+		done, found := l.inflight[recordPath]
+		if !found {
+			done = make(chan struct{})
+			l.inflight[recordPath] = done
+			l.mu.Unlock()
+			return func() {
+				l.mu.Lock()
+				delete(l.inflight, recordPath)
+				l.mu.Unlock()
+				close(done)
+			}, nil
+		}
+		l.mu.Unlock()
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// recordLocation returns the directory of the record of the object at `unit`
+// and the name of the object in it.
+func (l *Ledger) recordLocation(unit string) (recordDir, objectName string) {
+	if !strings.HasPrefix(unit, l.urlPrefix) || !strings.HasSuffix(unit, l.urlSuffix) {
+		hash := sha256.Sum256([]byte(unit))
+		return ledgerDir + externalDir, hex.EncodeToString(hash[:])
+	}
+	dir, name := path.Split(strings.TrimSuffix(strings.TrimPrefix(unit, l.urlPrefix), l.urlSuffix))
+	return ledgerDir + dir, name
+}
+
+func recordName(objectName, traceID string) string {
+	return objectName + "@" + traceID
+}
+
+// parseRecordName returns the name of the object and the trace ID of the
+// request which completed it, false when `name` is not the name of a record.
+func parseRecordName(name string) (objectName, traceID string, ok bool) {
+	sep := strings.LastIndex(name, "@")
+	if sep <= 0 {
+		return "", "", false
+	}
+	return name[:sep], name[sep+1:], true
+}
+
+// completedBy returns the trace ID of the request which completed the object
+// `objectName`, from the records of `recordDir` listed at most recordsTTL ago.
+func (l *Ledger) completedBy(ctx context.Context, recordDir, objectName string) (traceID string, completed bool, err error) {
+	l.mu.Lock()
+	dir := l.directories[recordDir]
+	l.mu.Unlock()
+
+	if dir == nil || time.Since(dir.listedAt) > recordsTTL {
+		if dir, err = l.list(ctx, recordDir); err != nil {
+			return "", false, err
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	traceID, completed = dir.records[objectName]
+	return traceID, completed, nil
+}
+
+func (l *Ledger) list(ctx context.Context, recordDir string) (*directory, error) {
+	dir := &directory{listedAt: time.Now(), records: map[string]string{}}
+	files, err := l.stateStore.ListFiles(ctx, recordDir, math.MaxInt64)
+	if err != nil {
+		return nil, fmt.Errorf("listing idempotency records of %q: %w", recordDir, err)
+	}
+	for _, file := range files {
+		name := strings.TrimPrefix(file, recordDir)
+		if name == file || strings.Contains(name, "/") {
+			continue
+		}
+		if objectName, traceID, ok := parseRecordName(name); ok {
+			dir.records[objectName] = traceID
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key, other := range l.directories {
+		if time.Since(other.listedAt) > recordsTTL {
+			delete(l.directories, key)
+		}
+	}
+	l.directories[recordDir] = dir
+	return dir, nil
+}
+
+func (l *Ledger) record(ctx context.Context, recordDir, objectName string, key Key) error {
+	content, err := json.Marshal(key)
+	if err != nil {
+		return fmt.Errorf("encoding idempotency record: %w", err)
+	}
+	recordPath := recordDir + recordName(objectName, key.TraceID)
+	if err := l.stateStore.WriteObject(ctx, recordPath, bytes.NewReader(content)); err != nil {
+		return fmt.Errorf("writing idempotency record %q: %w", recordPath, err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if dir := l.directories[recordDir]; dir != nil {
+		dir.records[objectName] = key.TraceID
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/streamingfast/dstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestLedger_Write(t *testing.T) {
+	ctx := context.Background()
+	stateStore, err := dstore.NewStore("file://"+t.TempDir(), "", "", true)
+	require.NoError(t, err)
+	moduleStore, err := stateStore.SubStore("abc/states")
+	require.NoError(t, err)
+	ledger := NewLedger(stateStore)
+
+	var writes int
+	write := func(content string) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			writes++
+			return moduleStore.WriteObject(ctx, "0000001000-0000000000.kv", bytes.NewReader([]byte(content)))
+		}
+	}
+
+	written, err := ledger.Write(ctx, moduleStore, "0000001000-0000000000.kv", "trace1", write("a"))
+	require.NoError(t, err)
+	assert.True(t, written)
+
+	written, err = ledger.Write(ctx, moduleStore, "0000001000-0000000000.kv", "trace1", write("a"))
+	require.NoError(t, err)
+	assert.False(t, written, "retry of the same write")
+
+	written, err = ledger.Write(ctx, moduleStore, "0000001000-0000000000.kv", "trace2", write("a"))
+	require.NoError(t, err)
+	assert.False(t, written, "written by another request")
+	assert.Equal(t, 1, writes)
+
+	require.NoError(t, moduleStore.DeleteObject(ctx, "0000001000-0000000000.kv"))
+	written, err = ledger.Write(ctx, moduleStore, "0000001000-0000000000.kv", "trace2", write("a"))
+	require.NoError(t, err)
+	assert.True(t, written, "deleted since written")
+
+	// a failed write is not recorded
+	written, err = ledger.Write(ctx, moduleStore, "0000002000-0000001000.kv", "trace1", func(ctx context.Context) error {
+		return errors.New("failed")
+	})
+	require.Error(t, err)
+	assert.True(t, written)
+	written, err = ledger.Write(ctx, moduleStore, "0000002000-0000001000.kv", "trace1", func(ctx context.Context) error {
+		return moduleStore.WriteObject(ctx, "0000002000-0000001000.kv", bytes.NewReader([]byte("b")))
+	})
+	require.NoError(t, err)
+	assert.True(t, written)
+
+	var disabled *Ledger
+	written, err = disabled.Write(ctx, moduleStore, "0000001000-0000000000.kv", "trace1", write("a"))
+	require.NoError(t, err)
+	assert.True(t, written)
+	assert.Equal(t, 3, writes)
+}
+
+type listCountingStore struct {
+	dstore.Store
+	lists int
+}
+
+func (s *listCountingStore) ListFiles(ctx context.Context, prefix string, max int) ([]string, error) {
+	s.lists++
+	return s.Store.ListFiles(ctx, prefix, max)
+}
+
+func TestLedger_WriteListsRecordsOnce(t *testing.T) {
+	ctx := context.Background()
+	base, err := dstore.NewStore("file://"+t.TempDir(), "", "", true)
+	require.NoError(t, err)
+	stateStore := &listCountingStore{Store: base}
+	moduleStore, err := base.SubStore("abc/states")
+	require.NoError(t, err)
+
+	write := func(filename string) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			return moduleStore.WriteObject(ctx, filename, bytes.NewReader([]byte("a")))
+		}
+	}
+
+	ledger := NewLedger(stateStore)
+	for _, filename := range []string{"0000001000-0000000000.kv", "0000002000-0000001000.kv", "0000001000-0000000000.kv"} {
+		_, err := ledger.Write(ctx, moduleStore, filename, "trace1", write(filename))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 1, stateStore.lists, "the records of the directory are listed once")
+
+	exists, err := base.FileExists(ctx, "idempotency/abc/states/0000002000-0000001000.kv@trace1")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	written, err := NewLedger(stateStore).Write(ctx, moduleStore, "0000002000-0000001000.kv", "trace2", write("0000002000-0000001000.kv"))
+	require.NoError(t, err)
+	assert.False(t, written, "recorded by another process")
+}
+
+func TestExpirer_Expire(t *testing.T) {
+	ctx := context.Background()
+	stateStore, err := dstore.NewStore("file://"+t.TempDir(), "", "", true)
+	require.NoError(t, err)
+	moduleStore, err := stateStore.SubStore("abc/states")
+	require.NoError(t, err)
+	ledger := NewLedger(stateStore)
+
+	for _, filename := range []string{"0000001000-0000000000.kv", "0000002000-0000001000.kv"} {
+		_, err := ledger.Write(ctx, moduleStore, filename, "trace1", func(ctx context.Context) error {
+			return moduleStore.WriteObject(ctx, filename, bytes.NewReader([]byte("a")))
+		})
+		require.NoError(t, err)
+	}
+	require.NoError(t, moduleStore.DeleteObject(ctx, "0000001000-0000000000.kv"))
+	require.NoError(t, stateStore.WriteObject(ctx, "idempotency/0123abcd.json", bytes.NewReader([]byte("{}"))))
+
+	expired, err := NewExpirer(stateStore, time.Hour, zap.NewNop()).Expire(ctx)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		"idempotency/0123abcd.json",
+		"idempotency/abc/states/0000001000-0000000000.kv@trace1",
+	}, expired)
+
+	files, err := stateStore.ListFiles(ctx, "idempotency/", 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"idempotency/abc/states/0000002000-0000001000.kv@trace1"}, files)
+}
@@ -0,0 +1,205 @@
+// Package index caches the blocks matched by the block index modules, one
+// bitmap per segment, so that the modules they filter skip the segments
+// matching none, see `Module.block_filter`.
+package index
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/streamingfast/derr"
+	"github.com/streamingfast/dstore"
+
+	"github.com/streamingfast/substreams/block"
+	"github.com/streamingfast/substreams/storage/execout"
+)
+
+// Bitmap holds the blocks of a segment matched by a block index module, a
+// block matching when the module's output on it is not empty.
+type Bitmap struct {
+	*block.Range
+	bits []byte
+}
+
+func NewBitmap(segment *block.Range) *Bitmap {
+	return &Bitmap{
+		Range: segment,
+		bits:  make([]byte, (segment.Size()+7)/8),
+	}
+}
+
+// Set marks `blockNum` as matched, it is ignored when outside of the segment.
+func (b *Bitmap) Set(blockNum uint64) {
+	if !b.Contains(blockNum) {
+		return
+	}
+	offset := blockNum - b.StartBlock
+	b.bits[offset/8] |= 1 << (offset % 8)
+}
+
+func (b *Bitmap) Matches(blockNum uint64) bool {
+	if !b.Contains(blockNum) {
+		return false
+	}
+	offset := blockNum - b.StartBlock
+	return b.bits[offset/8]&(1<<(offset%8)) != 0
+}
+
+// MatchesNoneOf tells if no block of `r` within the segment is matched.
+func (b *Bitmap) MatchesNoneOf(r *block.Range) bool {
+	start, end := r.StartBlock, r.ExclusiveEndBlock
+	if start < b.StartBlock {
+		start = b.StartBlock
+	}
+	if end > b.ExclusiveEndBlock {
+		end = b.ExclusiveEndBlock
+	}
+	for blockNum := start; blockNum < end; blockNum++ {
+		if b.Matches(blockNum) {
+			return false
+		}
+	}
+	return true
+}
+
+// Store reads and writes the bitmaps of a block index module, under
+// `<module_hash>/index` in the state store, one per segment of `interval`
+// blocks.
+type Store struct {
+	store    dstore.Store
+	interval uint64
+}
+
+func NewStore(baseStore dstore.Store, moduleHash string, interval uint64) (*Store, error) {
+	subStore, err := baseStore.SubStore(fmt.Sprintf("%s/index", moduleHash))
+	if err != nil {
+		return nil, fmt.Errorf("creating sub store: %w", err)
+	}
+	return &Store{store: subStore, interval: interval}, nil
+}
+
+// Segment returns the segment containing `blockNum`.
+func (s *Store) Segment(blockNum uint64) *block.Range {
+	start := blockNum - blockNum%s.interval
+	return block.NewRange(start, start+s.interval)
+}
+
+// Save writes `bitmap`, which must cover a whole segment: the blocks it does
+// not hold would be taken as not matched.
+func (s *Store) Save(ctx context.Context, bitmap *Bitmap) error {
+	return derr.RetryContext(ctx, 5, func(ctx context.Context) error {
+		return s.store.WriteObject(ctx, filename(bitmap.Range), bytes.NewReader(bitmap.bits))
+	})
+}
+
+// Load reads the bitmap of `segment`, returning dstore.ErrNotFound when it was
+// not written yet.
+func (s *Store) Load(ctx context.Context, segment *block.Range) (*Bitmap, error) {
+	name := filename(segment)
+	reader, err := s.store.OpenObject(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	bits, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", name, err)
+	}
+	bitmap := NewBitmap(segment)
+	if len(bits) != len(bitmap.bits) {
+		return nil, fmt.Errorf("invalid bitmap %s: %d bytes, expected %d", name, len(bits), len(bitmap.bits))
+	}
+	bitmap.bits = bits
+	return bitmap, nil
+}
+
+// MatchesNone tells if the module matched none of the blocks of `r`, which
+// is only known when the bitmaps of all the segments overlapped by `r` were
+// written.
+func (s *Store) MatchesNone(ctx context.Context, r *block.Range) (bool, error) {
+	for start := r.StartBlock; start < r.ExclusiveEndBlock; {
+		segment := s.Segment(start)
+		bitmap, err := s.Load(ctx, segment)
+		if err == dstore.ErrNotFound {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if !bitmap.MatchesNoneOf(r) {
+			return false, nil
+		}
+		start = segment.ExclusiveEndBlock
+	}
+	return true, nil
+}
+
+func filename(segment *block.Range) string {
+	return fmt.Sprintf("%010d-%010d.index", segment.StartBlock, segment.ExclusiveEndBlock)
+}
+
+// Writer records the blocks matched by the block index modules executed by a
+// tier2 job, saving the bitmap of each segment once the job went through it.
+type Writer struct {
+	startBlock uint64 // first block executed by the job
+	modules    []*writerModule
+}
+
+type writerModule struct {
+	name         string
+	initialBlock uint64
+	store        *Store
+	current      *Bitmap
+}
+
+// NewWriter returns the Writer of a job starting at `startBlock`.
+func NewWriter(startBlock uint64) *Writer {
+	return &Writer{startBlock: startBlock}
+}
+
+// AddModule makes the writer record the blocks matched by the block index
+// module `name`, in `store`.
+func (w *Writer) AddModule(name string, initialBlock uint64, store *Store) {
+	w.modules = append(w.modules, &writerModule{
+		name:         name,
+		initialBlock: initialBlock,
+		store:        store,
+	})
+}
+
+// Write marks `blockNum` as matched by the modules whose output in `outputs`
+// is not empty.
+func (w *Writer) Write(blockNum uint64, outputs execout.ExecutionOutputGetter) {
+	for _, mod := range w.modules {
+		if mod.current == nil {
+			mod.current = NewBitmap(mod.store.Segment(blockNum))
+		}
+		if value, _, err := outputs.Get(mod.name); err == nil && len(value) != 0 {
+			mod.current.Set(blockNum)
+		}
+	}
+}
+
+// MaybeRotate saves the bitmaps of the segments ending at or before
+// `blockNum`. The bitmap of a segment the job started within is dropped, the
+// blocks before the start not being recorded, unless they precede the
+// module's initial block.
+func (w *Writer) MaybeRotate(ctx context.Context, blockNum uint64) error {
+	for _, mod := range w.modules {
+		bitmap := mod.current
+		if bitmap == nil || blockNum < bitmap.ExclusiveEndBlock {
+			continue
+		}
+		mod.current = nil
+		if bitmap.StartBlock < w.startBlock && w.startBlock > mod.initialBlock {
+			continue
+		}
+		if err := mod.store.Save(ctx, bitmap); err != nil {
+			return fmt.Errorf("saving %s index of %s: %w", mod.name, bitmap.Range, err)
+		}
+	}
+	return nil
+}
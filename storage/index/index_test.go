@@ -0,0 +1,79 @@
+package index
+
+import (
+	"context"
+	"testing"
+
+	"github.com/streamingfast/dstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/streamingfast/substreams/block"
+	"github.com/streamingfast/substreams/storage/execout"
+)
+
+func TestBitmap(t *testing.T) {
+	bitmap := NewBitmap(block.NewRange(100, 110))
+	bitmap.Set(103)
+	bitmap.Set(120)
+
+	assert.True(t, bitmap.Matches(103))
+	assert.False(t, bitmap.Matches(104))
+	assert.False(t, bitmap.Matches(120))
+	assert.True(t, bitmap.MatchesNoneOf(block.NewRange(104, 200)))
+	assert.False(t, bitmap.MatchesNoneOf(block.NewRange(0, 104)))
+}
+
+func TestWriter(t *testing.T) {
+	ctx := context.Background()
+	base, err := dstore.NewStore("file://"+t.TempDir(), "", "", false)
+	require.NoError(t, err)
+	store, err := NewStore(base, "abcdef", 10)
+	require.NoError(t, err)
+
+	// a job starting within the first segment, after the module's initial block
+	w := NewWriter(15)
+	w.AddModule("index", 0, store)
+	for blockNum := uint64(15); blockNum < 35; blockNum++ {
+		require.NoError(t, w.MaybeRotate(ctx, blockNum))
+		out := &outputs{}
+		if blockNum == 17 || blockNum == 32 {
+			out.value = []byte("matched")
+		}
+		w.Write(blockNum, out)
+	}
+	require.NoError(t, w.MaybeRotate(ctx, 35))
+
+	_, err = store.Load(ctx, block.NewRange(10, 20))
+	assert.ErrorIs(t, err, dstore.ErrNotFound, "segment not fully executed")
+
+	none, err := store.MatchesNone(ctx, block.NewRange(20, 30))
+	require.NoError(t, err)
+	assert.True(t, none)
+
+	none, err = store.MatchesNone(ctx, block.NewRange(20, 40))
+	require.NoError(t, err)
+	assert.False(t, none, "segment not saved yet")
+
+	require.NoError(t, w.MaybeRotate(ctx, 40))
+	none, err = store.MatchesNone(ctx, block.NewRange(20, 40))
+	require.NoError(t, err)
+	assert.False(t, none)
+
+	bitmap, err := store.Load(ctx, block.NewRange(30, 40))
+	require.NoError(t, err)
+	assert.True(t, bitmap.Matches(32))
+	assert.False(t, bitmap.Matches(33))
+}
+
+type outputs struct {
+	execout.ExecutionOutputGetter
+	value []byte
+}
+
+func (o *outputs) Get(name string) ([]byte, bool, error) {
+	if o.value == nil {
+		return nil, false, execout.NotFound
+	}
+	return o.value, false, nil
+}
@@ -0,0 +1,116 @@
+// Package layout maps the object paths of module files (store snapshots and
+// execution outputs) between the original layout and the sharded one.
+//
+// The v1 layout puts every file of a module directly under a single prefix:
+//
+//	<module_hash>/states/<file>
+//	<module_hash>/outputs/<file>
+//	<module_hash>/accessed/<file>
+//
+// On large deployments, this ends up with millions of objects under a few
+// prefixes, which makes listings slow and hits per-prefix rate limits of
+// object storage providers. The v2 layout shards by module hash prefix and
+// groups files in buckets of `BucketSize` blocks:
+//
+//	<module_hash[:2]>/<module_hash>/states/<bucket>/<file>
+//	<module_hash[:2]>/<module_hash>/outputs/<bucket>/<file>
+//	<module_hash[:2]>/<module_hash>/accessed/<bucket>/<file>
+package layout
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+type Version int
+
+const (
+	V1 Version = 1
+	V2 Version = 2
+)
+
+// BucketSize is the amount of blocks grouped under a single bucket in the v2 layout.
+const BucketSize uint64 = 1_000_000
+
+var moduleKinds = map[string]bool{"states": true, "outputs": true, "accessed": true}
+
+func ParseVersion(in string) (Version, error) {
+	switch in {
+	case "v1", "1":
+		return V1, nil
+	case "v2", "2":
+		return V2, nil
+	}
+	return 0, fmt.Errorf("unknown storage layout %q, valid values are 'v1' and 'v2'", in)
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("v%d", int(v))
+}
+
+// V2Dir returns the v2 location of the v1 module directory `dir` (`<module_hash>/<kind>`).
+// Returns false if `dir` is not a module directory.
+func V2Dir(dir string) (string, bool) {
+	moduleHash, kind, ok := splitModuleDir(dir)
+	if !ok {
+		return "", false
+	}
+	return path.Join(shard(moduleHash), moduleHash, kind), true
+}
+
+// V2Path returns the v2 location of the v1 path `v1Path` (`<module_hash>/<kind>/<file>`).
+// Returns false if `v1Path` is not the path of a module file.
+func V2Path(v1Path string) (string, bool) {
+	dir, file := path.Split(v1Path)
+	v2Dir, ok := V2Dir(strings.TrimSuffix(dir, "/"))
+	if !ok || file == "" {
+		return "", false
+	}
+	return path.Join(v2Dir, Bucket(file), file), true
+}
+
+// V1Path returns the v1 location of the v2 path `v2Path`. Returns false
+// if `v2Path` is not the path of a module file laid out in v2.
+func V1Path(v2Path string) (string, bool) {
+	parts := strings.Split(v2Path, "/")
+	if len(parts) != 5 {
+		return "", false
+	}
+	shardPrefix, moduleHash, kind, bucket, file := parts[0], parts[1], parts[2], parts[3], parts[4]
+	if !moduleKinds[kind] || shard(moduleHash) != shardPrefix || Bucket(file) != bucket {
+		return "", false
+	}
+	return path.Join(moduleHash, kind, file), true
+}
+
+// Bucket returns the bucket a module file belongs to in the v2 layout, derived
+// from the leading block number of its filename.
+func Bucket(filename string) string {
+	end := strings.IndexFunc(filename, func(r rune) bool { return r < '0' || r > '9' })
+	if end == -1 {
+		end = len(filename)
+	}
+
+	blockNum, err := strconv.ParseUint(filename[:end], 10, 64)
+	if err != nil {
+		return "unbucketed"
+	}
+	return fmt.Sprintf("%010d", blockNum-blockNum%BucketSize)
+}
+
+func shard(moduleHash string) string {
+	if len(moduleHash) < 2 {
+		return "00"
+	}
+	return moduleHash[:2]
+}
+
+func splitModuleDir(dir string) (moduleHash, kind string, ok bool) {
+	parts := strings.Split(strings.Trim(dir, "/"), "/")
+	if len(parts) != 2 || parts[0] == "" || !moduleKinds[parts[1]] {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
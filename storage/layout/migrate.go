@@ -0,0 +1,49 @@
+package layout
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/streamingfast/dstore"
+)
+
+// Migrate copies every module file of `base` laid out in v1 to its v2 location. When
+// `deleteSource` is set, the v1 file is deleted once copied. With `dryRun`, nothing is
+// copied nor deleted, `onFile` is still called for every file that would be migrated.
+//
+// Because `Store` reads both layouts, a migration can safely run while servers are
+// serving requests.
+func Migrate(ctx context.Context, base dstore.Store, deleteSource, dryRun bool, onFile func(from, to string)) (migrated int, err error) {
+	var files [][2]string
+	if err := base.Walk(ctx, "", func(filename string) error {
+		if v2Path, ok := V2Path(filename); ok {
+			files = append(files, [2]string{filename, v2Path})
+		}
+		return nil
+	}); err != nil {
+		return 0, fmt.Errorf("walking store: %w", err)
+	}
+
+	for _, file := range files {
+		from, to := file[0], file[1]
+		if onFile != nil {
+			onFile(from, to)
+		}
+		if dryRun {
+			migrated++
+			continue
+		}
+
+		if err := base.CopyObject(ctx, from, to); err != nil {
+			return migrated, fmt.Errorf("copying %q to %q: %w", from, to, err)
+		}
+		if deleteSource {
+			if err := base.DeleteObject(ctx, from); err != nil {
+				return migrated, fmt.Errorf("deleting %q: %w", from, err)
+			}
+		}
+		migrated++
+	}
+
+	return migrated, nil
+}
@@ -0,0 +1,212 @@
+package layout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/streamingfast/dstore"
+)
+
+var _ dstore.Store = (*Store)(nil)
+var _ dstore.Clonable = (*Store)(nil)
+
+// Store wraps the root state store and writes module files using the v2 layout,
+// while still reading (listing, opening, deleting) files written with the v1 layout.
+//
+// Consumers keep addressing files with v1 paths (ex: through `SubStore("<hash>/states")`),
+// the path translation is done transparently. Paths that are not module files are
+// passed through unmodified.
+type Store struct {
+	base   dstore.Store
+	prefix string
+}
+
+func NewStore(base dstore.Store) *Store {
+	return &Store{base: base}
+}
+
+func (s *Store) v1Path(name string) string {
+	return path.Join(s.prefix, name)
+}
+
+func (s *Store) v2Path(name string) string {
+	v1Path := s.v1Path(name)
+	if v2Path, ok := V2Path(v1Path); ok {
+		return v2Path
+	}
+	return v1Path
+}
+
+func (s *Store) OpenObject(ctx context.Context, name string) (io.ReadCloser, error) {
+	out, err := s.base.OpenObject(ctx, s.v2Path(name))
+	if errors.Is(err, dstore.ErrNotFound) {
+		return s.base.OpenObject(ctx, s.v1Path(name))
+	}
+	return out, err
+}
+
+func (s *Store) FileExists(ctx context.Context, name string) (bool, error) {
+	exists, err := s.base.FileExists(ctx, s.v2Path(name))
+	if err != nil || exists {
+		return exists, err
+	}
+	return s.base.FileExists(ctx, s.v1Path(name))
+}
+
+func (s *Store) ObjectPath(name string) string {
+	return s.base.ObjectPath(s.v2Path(name))
+}
+
+func (s *Store) ObjectURL(name string) string {
+	return s.base.ObjectURL(s.v2Path(name))
+}
+
+func (s *Store) ObjectAttributes(ctx context.Context, name string) (*dstore.ObjectAttributes, error) {
+	attrs, err := s.base.ObjectAttributes(ctx, s.v2Path(name))
+	if errors.Is(err, dstore.ErrNotFound) {
+		return s.base.ObjectAttributes(ctx, s.v1Path(name))
+	}
+	return attrs, err
+}
+
+func (s *Store) WriteObject(ctx context.Context, name string, f io.Reader) error {
+	return s.base.WriteObject(ctx, s.v2Path(name), f)
+}
+
+func (s *Store) PushLocalFile(ctx context.Context, localFile, toBaseName string) error {
+	return s.base.PushLocalFile(ctx, localFile, s.v2Path(toBaseName))
+}
+
+func (s *Store) CopyObject(ctx context.Context, src, dest string) error {
+	srcPath := s.v2Path(src)
+	exists, err := s.base.FileExists(ctx, srcPath)
+	if err != nil {
+		return fmt.Errorf("checking %q existence: %w", srcPath, err)
+	}
+	if !exists {
+		srcPath = s.v1Path(src)
+	}
+	return s.base.CopyObject(ctx, srcPath, s.v2Path(dest))
+}
+
+func (s *Store) Overwrite() bool             { return s.base.Overwrite() }
+func (s *Store) SetOverwrite(enabled bool)   { s.base.SetOverwrite(enabled) }
+func (s *Store) BaseURL() *url.URL           { return s.base.BaseURL() }
+func (s *Store) SetMeter(meter dstore.Meter) { s.base.SetMeter(meter) }
+
+func (s *Store) DeleteObject(ctx context.Context, name string) error {
+	err := s.base.DeleteObject(ctx, s.v2Path(name))
+	if errors.Is(err, dstore.ErrNotFound) {
+		return s.base.DeleteObject(ctx, s.v1Path(name))
+	}
+	return err
+}
+
+func (s *Store) SubStore(subFolder string) (dstore.Store, error) {
+	return &Store{base: s.base, prefix: path.Join(s.prefix, subFolder)}, nil
+}
+
+func (s *Store) Clone(ctx context.Context) (dstore.Store, error) {
+	clonable, ok := s.base.(dstore.Clonable)
+	if !ok {
+		return nil, fmt.Errorf("base store %T is not clonable", s.base)
+	}
+	base, err := clonable.Clone(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{base: base, prefix: s.prefix}, nil
+}
+
+// Walk lists the files of both layouts, sorted, as if they were all laid out in
+// v1. A file present in both, being migrated, is listed once, so that a module
+// partly migrated is seen whole while Migrate runs.
+func (s *Store) Walk(ctx context.Context, prefix string, f func(filename string) error) error {
+	names, err := s.list(ctx, prefix)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if err := f(name); err != nil {
+			if errors.Is(err, dstore.StopIteration) {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) WalkFrom(ctx context.Context, prefix, startingPoint string, f func(filename string) error) error {
+	return s.Walk(ctx, prefix, func(filename string) error {
+		if filename < startingPoint {
+			return nil
+		}
+		return f(filename)
+	})
+}
+
+func (s *Store) ListFiles(ctx context.Context, prefix string, max int) (out []string, err error) {
+	err = s.Walk(ctx, prefix, func(filename string) error {
+		if len(out) >= max {
+			return dstore.StopIteration
+		}
+		out = append(out, filename)
+		return nil
+	})
+	return
+}
+
+func (s *Store) list(ctx context.Context, prefix string) ([]string, error) {
+	var out []string
+
+	if v2Dir, ok := V2Dir(s.prefix); ok {
+		if err := s.base.Walk(ctx, v2Dir+"/", func(filename string) error {
+			v1Path, ok := V1Path(filename)
+			if !ok {
+				return nil
+			}
+			if name := s.relative(v1Path); strings.HasPrefix(name, prefix) {
+				out = append(out, name)
+			}
+			return nil
+		}); err != nil {
+			return nil, fmt.Errorf("walking v2 layout: %w", err)
+		}
+	}
+
+	seen := make(map[string]bool, len(out))
+	for _, name := range out {
+		seen[name] = true
+	}
+
+	v1Prefix := s.v1Path(prefix)
+	if prefix == "" && s.prefix != "" {
+		v1Prefix += "/"
+	}
+	if err := s.base.Walk(ctx, v1Prefix, func(filename string) error {
+		if name := s.relative(filename); !seen[name] {
+			out = append(out, name)
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("walking v1 layout: %w", err)
+	}
+
+	sort.Strings(out)
+	return out, nil
+}
+
+func (s *Store) relative(v1Path string) string {
+	if s.prefix == "" {
+		return v1Path
+	}
+	return strings.TrimPrefix(v1Path, s.prefix+"/")
+}
@@ -0,0 +1,119 @@
+package layout
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/streamingfast/dstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestV2Path(t *testing.T) {
+	tests := []struct {
+		in        string
+		expectOut string
+		expectOk  bool
+	}{
+		{"abcdef/states/0000002000-0000001000.kv", "ab/abcdef/states/0000000000/0000002000-0000001000.kv", true},
+		{"abcdef/outputs/0001000000-0001001000.output", "ab/abcdef/outputs/0001000000/0001000000-0001001000.output", true},
+		{"abcdef/states/0003500000-0003400000.trace.partial", "ab/abcdef/states/0003000000/0003500000-0003400000.trace.partial", true},
+		{"abcdef/other/0000002000-0000001000.kv", "", false},
+		{"abcdef/states", "", false},
+		{"0000002000-0000001000.kv", "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.in, func(t *testing.T) {
+			out, ok := V2Path(test.in)
+			assert.Equal(t, test.expectOk, ok)
+			assert.Equal(t, test.expectOut, out)
+
+			if ok {
+				back, ok := V1Path(out)
+				assert.True(t, ok)
+				assert.Equal(t, test.in, back)
+			}
+		})
+	}
+}
+
+func TestStore_DualRead(t *testing.T) {
+	ctx := context.Background()
+	base, err := dstore.NewStore("file://"+t.TempDir(), "", "", false)
+	require.NoError(t, err)
+
+	// v1 file, written before the layout change
+	require.NoError(t, base.WriteObject(ctx, "abcdef/states/0000002000-0000001000.kv", bytes.NewReader([]byte("v1"))))
+
+	sub, err := NewStore(base).SubStore("abcdef/states")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"0000002000-0000001000.kv"}, walk(t, sub), "v1 only")
+
+	require.NoError(t, sub.WriteObject(ctx, "0000003000-0000001000.kv", bytes.NewReader([]byte("v2"))))
+
+	exists, err := base.FileExists(ctx, "ab/abcdef/states/0000000000/0000003000-0000001000.kv")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	assert.Equal(t, "v1", readObject(t, sub, "0000002000-0000001000.kv"))
+	assert.Equal(t, "v2", readObject(t, sub, "0000003000-0000001000.kv"))
+
+	assert.Equal(t, []string{"0000002000-0000001000.kv", "0000003000-0000001000.kv"}, walk(t, sub), "both layouts listed")
+
+	migrated, err := Migrate(ctx, base, true, false, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, migrated)
+
+	exists, err = base.FileExists(ctx, "abcdef/states/0000002000-0000001000.kv")
+	require.NoError(t, err)
+	assert.False(t, exists)
+	assert.Equal(t, "v1", readObject(t, sub, "0000002000-0000001000.kv"))
+	assert.Equal(t, []string{"0000002000-0000001000.kv", "0000003000-0000001000.kv"}, walk(t, sub))
+}
+
+func TestStore_ListHalfMigrated(t *testing.T) {
+	ctx := context.Background()
+	base, err := dstore.NewStore("file://"+t.TempDir(), "", "", false)
+	require.NoError(t, err)
+
+	for _, name := range []string{"0000001000-0000000000.kv", "0000002000-0000000000.kv", "0000003000-0000000000.kv"} {
+		require.NoError(t, base.WriteObject(ctx, "abcdef/states/"+name, bytes.NewReader([]byte("v1"))))
+	}
+	// the first one copied and its source deleted, the second one copied only
+	require.NoError(t, base.CopyObject(ctx, "abcdef/states/0000001000-0000000000.kv", "ab/abcdef/states/0000000000/0000001000-0000000000.kv"))
+	require.NoError(t, base.DeleteObject(ctx, "abcdef/states/0000001000-0000000000.kv"))
+	require.NoError(t, base.CopyObject(ctx, "abcdef/states/0000002000-0000000000.kv", "ab/abcdef/states/0000000000/0000002000-0000000000.kv"))
+
+	sub, err := NewStore(base).SubStore("abcdef/states")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"0000001000-0000000000.kv", "0000002000-0000000000.kv", "0000003000-0000000000.kv"}, walk(t, sub))
+
+	files, err := sub.ListFiles(ctx, "0000002", 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"0000002000-0000000000.kv"}, files)
+}
+
+func walk(t *testing.T, store dstore.Store) (files []string) {
+	t.Helper()
+
+	require.NoError(t, store.Walk(context.Background(), "", func(filename string) error {
+		files = append(files, filename)
+		return nil
+	}))
+	return files
+}
+
+func readObject(t *testing.T, store dstore.Store, name string) string {
+	t.Helper()
+
+	reader, err := store.OpenObject(context.Background(), name)
+	require.NoError(t, err)
+	defer reader.Close()
+
+	content, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	return string(content)
+}
@@ -0,0 +1,192 @@
+// Package lease coordinates the external tools mutating the state of a module
+// (migrations, manual repairs) with the garbage collection of the state store.
+//
+// A lease is taken on a module hash for a limited time, and recorded in the
+// state store under `leases/<module_hash>.json`. While it is active, the
+// partial store reaper and the snapshot compaction leave the files of the
+// module alone. Leases are advisory: the state store offers no conditional
+// writes, so two holders acquiring the same lease at the same time may both
+// believe they got it; Acquire reads the lease back to make that unlikely.
+package lease
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/streamingfast/dstore"
+)
+
+const leasesDir = "leases/"
+
+// Lease is the lease of `Holder` on the state of the module `ModuleHash`,
+// until `ExpiresAt`.
+type Lease struct {
+	ModuleHash string    `json:"module_hash"`
+	Holder     string    `json:"holder"`
+	Reason     string    `json:"reason,omitempty"`
+	AcquiredAt time.Time `json:"acquired_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+func (l *Lease) String() string {
+	return fmt.Sprintf("lease of %q on module %s until %s", l.Holder, l.ModuleHash, l.ExpiresAt.Format(time.RFC3339))
+}
+
+// Active tells if the lease has not expired at `now`.
+func (l *Lease) Active(now time.Time) bool {
+	return now.Before(l.ExpiresAt)
+}
+
+// HeldError is returned when acquiring or releasing a lease held by another
+// holder.
+type HeldError struct {
+	Lease *Lease
+}
+
+func (e *HeldError) Error() string {
+	return fmt.Sprintf("module state already leased: %s", e.Lease)
+}
+
+func leaseFilename(moduleHash string) string {
+	return leasesDir + moduleHash + ".json"
+}
+
+// Acquire takes the lease on the state of `moduleHash` for `holder`, for `ttl`.
+// An active lease of the same holder is renewed. A *HeldError is returned when
+// another holder has an active lease on it.
+func Acquire(ctx context.Context, stateStore dstore.Store, moduleHash, holder, reason string, ttl time.Duration) (*Lease, error) {
+	if holder == "" {
+		return nil, fmt.Errorf("lease holder is required")
+	}
+	if ttl <= 0 {
+		return nil, fmt.Errorf("lease duration must be positive")
+	}
+
+	current, err := Get(ctx, stateStore, moduleHash)
+	if err != nil {
+		return nil, err
+	}
+	if current != nil && current.Holder != holder {
+		return nil, &HeldError{Lease: current}
+	}
+
+	now := time.Now().UTC()
+	lease := &Lease{
+		ModuleHash: moduleHash,
+		Holder:     holder,
+		Reason:     reason,
+		AcquiredAt: now,
+		ExpiresAt:  now.Add(ttl),
+	}
+	if current != nil {
+		lease.AcquiredAt = current.AcquiredAt
+	}
+
+	content, err := json.Marshal(lease)
+	if err != nil {
+		return nil, fmt.Errorf("encoding lease: %w", err)
+	}
+	if err := stateStore.WriteObject(ctx, leaseFilename(moduleHash), bytes.NewReader(content)); err != nil {
+		return nil, fmt.Errorf("writing lease %q: %w", leaseFilename(moduleHash), err)
+	}
+
+	// another holder acquiring it at the same time overwrote ours
+	written, err := read(ctx, stateStore, leaseFilename(moduleHash))
+	if err != nil {
+		return nil, err
+	}
+	if written == nil {
+		return nil, fmt.Errorf("lease %q not found after writing it", leaseFilename(moduleHash))
+	}
+	if written.Holder != holder {
+		return nil, &HeldError{Lease: written}
+	}
+	return lease, nil
+}
+
+// Release gives back the lease of `holder` on the state of `moduleHash`. A
+// *HeldError is returned when another holder has an active lease on it,
+// unless `force` is set. Releasing a lease that expired or doesn't exist is a
+// no-op.
+func Release(ctx context.Context, stateStore dstore.Store, moduleHash, holder string, force bool) error {
+	current, err := Get(ctx, stateStore, moduleHash)
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		return nil
+	}
+	if current.Holder != holder && !force {
+		return &HeldError{Lease: current}
+	}
+
+	if err := stateStore.DeleteObject(ctx, leaseFilename(moduleHash)); err != nil && !errors.Is(err, dstore.ErrNotFound) {
+		return fmt.Errorf("deleting lease %q: %w", leaseFilename(moduleHash), err)
+	}
+	return nil
+}
+
+// Get returns the active lease on the state of `moduleHash`, nil if there is
+// none.
+func Get(ctx context.Context, stateStore dstore.Store, moduleHash string) (*Lease, error) {
+	lease, err := read(ctx, stateStore, leaseFilename(moduleHash))
+	if err != nil || lease == nil || !lease.Active(time.Now()) {
+		return nil, err
+	}
+	return lease, nil
+}
+
+// Active returns the active leases of the state store, by module hash.
+func Active(ctx context.Context, stateStore dstore.Store) (map[string]*Lease, error) {
+	var filenames []string
+	err := stateStore.Walk(ctx, leasesDir, func(filename string) error {
+		if strings.HasSuffix(filename, ".json") {
+			filenames = append(filenames, filename)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing leases: %w", err)
+	}
+
+	now := time.Now()
+	out := make(map[string]*Lease, len(filenames))
+	for _, filename := range filenames {
+		lease, err := read(ctx, stateStore, filename)
+		if err != nil {
+			return nil, err
+		}
+		if lease != nil && lease.Active(now) {
+			out[lease.ModuleHash] = lease
+		}
+	}
+	return out, nil
+}
+
+func read(ctx context.Context, stateStore dstore.Store, filename string) (*Lease, error) {
+	reader, err := stateStore.OpenObject(ctx, filename)
+	if err != nil {
+		if errors.Is(err, dstore.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("opening lease %q: %w", filename, err)
+	}
+	defer reader.Close()
+
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("reading lease %q: %w", filename, err)
+	}
+
+	out := &Lease{}
+	if err := json.Unmarshal(content, out); err != nil {
+		return nil, fmt.Errorf("decoding lease %q: %w", filename, err)
+	}
+	return out, nil
+}
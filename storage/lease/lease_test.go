@@ -0,0 +1,53 @@
+package lease
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/streamingfast/dstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLease(t *testing.T) {
+	ctx := context.Background()
+	stateStore, err := dstore.NewStore("file://"+t.TempDir(), "zst", "zstd", true)
+	require.NoError(t, err)
+
+	lease, err := Acquire(ctx, stateStore, "abc", "migration", "rewriting keys", time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, "migration", lease.Holder)
+
+	_, err = Acquire(ctx, stateStore, "abc", "repair", "", time.Hour)
+	var heldErr *HeldError
+	require.ErrorAs(t, err, &heldErr)
+	assert.Equal(t, "migration", heldErr.Lease.Holder)
+
+	renewed, err := Acquire(ctx, stateStore, "abc", "migration", "rewriting keys", 2*time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, lease.AcquiredAt, renewed.AcquiredAt)
+	assert.True(t, renewed.ExpiresAt.After(lease.ExpiresAt))
+
+	_, err = Acquire(ctx, stateStore, "def", "repair", "", time.Nanosecond)
+	require.NoError(t, err)
+	time.Sleep(time.Millisecond)
+
+	active, err := Active(ctx, stateStore)
+	require.NoError(t, err)
+	require.Len(t, active, 1)
+	assert.Equal(t, "migration", active["abc"].Holder)
+
+	// the expired lease of "def" is free to take
+	_, err = Acquire(ctx, stateStore, "def", "migration", "", time.Hour)
+	require.NoError(t, err)
+
+	require.ErrorAs(t, Release(ctx, stateStore, "abc", "repair", false), &heldErr)
+	require.NoError(t, Release(ctx, stateStore, "abc", "migration", false))
+	require.NoError(t, Release(ctx, stateStore, "def", "repair", true))
+	require.NoError(t, Release(ctx, stateStore, "ghi", "repair", false))
+
+	active, err = Active(ctx, stateStore)
+	require.NoError(t, err)
+	assert.Empty(t, active)
+}
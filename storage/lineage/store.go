@@ -0,0 +1,258 @@
+// Package lineage serves the caches of the modules declaring an output
+// compatibility with another module from the caches of that module, see Store.
+package lineage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/streamingfast/dstore"
+
+	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
+)
+
+var _ dstore.Store = (*Store)(nil)
+var _ dstore.Clonable = (*Store)(nil)
+
+// Link is the output compatibility declared by a module: its outputs and store
+// are the same as those of the module `ModuleHash` before `UntilBlock`.
+type Link struct {
+	ModuleHash string
+	UntilBlock uint64
+}
+
+// Links returns the links of the modules of `modules` declaring an output
+// compatibility, by their own hash, given by `moduleHash`.
+func Links(modules []*pbsubstreams.Module, moduleHash func(name string) string) map[string]Link {
+	out := map[string]Link{}
+	for _, module := range modules {
+		c := module.OutputCompatibility
+		if c == nil || c.ModuleHash == "" || c.UntilBlock == 0 {
+			continue
+		}
+		hash := moduleHash(module.Name)
+		if hash == c.ModuleHash {
+			continue
+		}
+		out[hash] = Link{ModuleHash: c.ModuleHash, UntilBlock: c.UntilBlock}
+	}
+	return out
+}
+
+// Store wraps the state store of a request and serves the files of the modules
+// linked to a compatible module, addressed by module hash (through
+// `SubStore("<module_hash>/states")` or `SubStore("<module_hash>/outputs")`),
+// from the files of the compatible module ending at or before the block of the
+// link, when the module has no such file itself. Files are always written to
+// and deleted from the module's own files.
+//
+// Other paths are passed through to the state store unmodified. Like
+// pinned.Store, Store must be the outermost wrapper of the state store.
+type Store struct {
+	dstore.Store
+
+	links map[string]Link
+}
+
+// NewStore returns `base` when there are no links.
+func NewStore(base dstore.Store, links map[string]Link) dstore.Store {
+	if len(links) == 0 {
+		return base
+	}
+	return &Store{Store: base, links: links}
+}
+
+func (s *Store) SubStore(subFolder string) (dstore.Store, error) {
+	base, err := s.Store.SubStore(subFolder)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := strings.Split(strings.TrimPrefix(subFolder, "/"), "/")
+	link, found := s.links[parts[0]]
+	if !found || len(parts) != 2 || (parts[1] != "states" && parts[1] != "outputs") {
+		return base, nil
+	}
+
+	compatible, err := s.Store.SubStore(path.Join(link.ModuleHash, parts[1]))
+	if err != nil {
+		return nil, fmt.Errorf("compatible module %s: %w", link.ModuleHash, err)
+	}
+	return &moduleStore{Store: base, compatible: compatible, untilBlock: link.UntilBlock}, nil
+}
+
+func (s *Store) Clone(ctx context.Context) (dstore.Store, error) {
+	base, err := clone(ctx, s.Store)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{Store: base, links: s.links}, nil
+}
+
+// moduleStore holds the files of a linked module: reads are served by its own
+// files, then by the files of the compatible module ending at or before
+// `untilBlock`. Listings include both, the planner and the readers must see
+// the ranges reused.
+type moduleStore struct {
+	dstore.Store // the module's own files
+
+	compatible dstore.Store
+	untilBlock uint64
+}
+
+var rangeFilenameRegex = regexp.MustCompile(`^(\d+)-(\d+)\.`)
+
+// reused returns whether the file `filename` of the compatible module is
+// served, the files of the store snapshots (`<end>-<start>.kv`) and of the
+// outputs (`<start>-<end>.output`) ending at or before untilBlock.
+func (s *moduleStore) reused(filename string) bool {
+	match := rangeFilenameRegex.FindStringSubmatch(path.Base(filename))
+	if match == nil {
+		return false
+	}
+	first, err := strconv.ParseUint(match[1], 10, 64)
+	if err != nil {
+		return false
+	}
+	second, err := strconv.ParseUint(match[2], 10, 64)
+	if err != nil {
+		return false
+	}
+	end := first
+	if second > end {
+		end = second
+	}
+	return end <= s.untilBlock
+}
+
+func (s *moduleStore) OpenObject(ctx context.Context, name string) (io.ReadCloser, error) {
+	out, err := s.Store.OpenObject(ctx, name)
+	if errors.Is(err, dstore.ErrNotFound) && s.reused(name) {
+		return s.compatible.OpenObject(ctx, name)
+	}
+	return out, err
+}
+
+func (s *moduleStore) FileExists(ctx context.Context, name string) (bool, error) {
+	exists, err := s.Store.FileExists(ctx, name)
+	if err != nil || exists || !s.reused(name) {
+		return exists, err
+	}
+	return s.compatible.FileExists(ctx, name)
+}
+
+func (s *moduleStore) ObjectAttributes(ctx context.Context, name string) (*dstore.ObjectAttributes, error) {
+	attrs, err := s.Store.ObjectAttributes(ctx, name)
+	if errors.Is(err, dstore.ErrNotFound) && s.reused(name) {
+		return s.compatible.ObjectAttributes(ctx, name)
+	}
+	return attrs, err
+}
+
+func (s *moduleStore) Walk(ctx context.Context, prefix string, f func(filename string) error) error {
+	return s.WalkFrom(ctx, prefix, "", f)
+}
+
+func (s *moduleStore) WalkFrom(ctx context.Context, prefix, startingPoint string, f func(filename string) error) error {
+	seen := map[string]bool{}
+	if err := s.Store.WalkFrom(ctx, prefix, startingPoint, func(filename string) error {
+		seen[filename] = true
+		return nil
+	}); err != nil {
+		return err
+	}
+	if err := s.compatible.WalkFrom(ctx, prefix, startingPoint, func(filename string) error {
+		if s.reused(filename) {
+			seen[filename] = true
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	for _, filename := range sortedNames(seen) {
+		if err := f(filename); err != nil {
+			if errors.Is(err, dstore.StopIteration) {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *moduleStore) ListFiles(ctx context.Context, prefix string, max int) ([]string, error) {
+	seen := map[string]bool{}
+	files, err := s.Store.ListFiles(ctx, prefix, max)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		seen[file] = true
+	}
+
+	// listed without limit, its files not reused would count in `max`
+	files, err = s.compatible.ListFiles(ctx, prefix, -1)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		if s.reused(file) {
+			seen[file] = true
+		}
+	}
+
+	out := sortedNames(seen)
+	if max >= 0 && len(out) > max {
+		out = out[:max]
+	}
+	return out, nil
+}
+
+func (s *moduleStore) SubStore(subFolder string) (dstore.Store, error) {
+	base, err := s.Store.SubStore(subFolder)
+	if err != nil {
+		return nil, err
+	}
+	compatible, err := s.compatible.SubStore(subFolder)
+	if err != nil {
+		return nil, fmt.Errorf("compatible module: %w", err)
+	}
+	return &moduleStore{Store: base, compatible: compatible, untilBlock: s.untilBlock}, nil
+}
+
+func (s *moduleStore) Clone(ctx context.Context) (dstore.Store, error) {
+	base, err := clone(ctx, s.Store)
+	if err != nil {
+		return nil, err
+	}
+	compatible, err := clone(ctx, s.compatible)
+	if err != nil {
+		return nil, err
+	}
+	return &moduleStore{Store: base, compatible: compatible, untilBlock: s.untilBlock}, nil
+}
+
+func sortedNames(names map[string]bool) []string {
+	out := make([]string, 0, len(names))
+	for name := range names {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func clone(ctx context.Context, store dstore.Store) (dstore.Store, error) {
+	clonable, ok := store.(dstore.Clonable)
+	if !ok {
+		return nil, fmt.Errorf("store %T is not clonable", store)
+	}
+	return clonable.Clone(ctx)
+}
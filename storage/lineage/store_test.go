@@ -0,0 +1,83 @@
+package lineage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/streamingfast/dstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
+)
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	base, err := dstore.NewStore("file://"+t.TempDir(), "", "", false)
+	require.NoError(t, err)
+
+	write := func(name, content string) {
+		require.NoError(t, base.WriteObject(ctx, name, bytes.NewReader([]byte(content))))
+	}
+	write("old/states/0000001000-0000000000.kv", "old")
+	write("old/states/0000002000-0000000000.kv", "old")
+	write("old/states/0000003000-0000000000.kv", "old")
+	write("old/outputs/0000001000-0000002000.output", "old")
+	write("old/outputs/0000002000-0000003000.output", "old")
+	write("new/states/0000002000-0000000000.kv", "new")
+
+	store := NewStore(base, map[string]Link{"new": {ModuleHash: "old", UntilBlock: 2000}})
+
+	states, err := store.SubStore("new/states")
+	require.NoError(t, err)
+	assert.Equal(t, "old", readObject(t, states, "0000001000-0000000000.kv"))
+	assert.Equal(t, "new", readObject(t, states, "0000002000-0000000000.kv"), "own files first")
+	_, err = states.OpenObject(ctx, "0000003000-0000000000.kv")
+	assert.ErrorIs(t, err, dstore.ErrNotFound, "past the until block")
+
+	files, err := states.ListFiles(ctx, "", 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"0000001000-0000000000.kv", "0000002000-0000000000.kv"}, files)
+
+	outputs, err := store.SubStore("new/outputs")
+	require.NoError(t, err)
+	var walked []string
+	require.NoError(t, outputs.Walk(ctx, "", func(filename string) error {
+		walked = append(walked, filename)
+		return nil
+	}))
+	assert.Equal(t, []string{"0000001000-0000002000.output"}, walked)
+
+	require.NoError(t, states.WriteObject(ctx, "0000003000-0000000000.kv", bytes.NewReader([]byte("new"))))
+	assert.Equal(t, "new", readObject(t, states, "0000003000-0000000000.kv"))
+	assert.Equal(t, "old", readObject(t, base, "old/states/0000003000-0000000000.kv"), "compatible module never written to")
+
+	accessed, err := store.SubStore("new/accessed")
+	require.NoError(t, err)
+	exists, err := accessed.FileExists(ctx, "0000001000-0000002000.output")
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestLinks(t *testing.T) {
+	hashes := map[string]string{"map_a": "aaaa", "map_b": "bbbb", "map_c": "cccc"}
+	links := Links([]*pbsubstreams.Module{
+		{Name: "map_a", OutputCompatibility: &pbsubstreams.Module_OutputCompatibility{ModuleHash: "0a0a", UntilBlock: 10}},
+		{Name: "map_b", OutputCompatibility: &pbsubstreams.Module_OutputCompatibility{ModuleHash: "bbbb", UntilBlock: 10}},
+		{Name: "map_c"},
+	}, func(name string) string { return hashes[name] })
+	assert.Equal(t, map[string]Link{"aaaa": {ModuleHash: "0a0a", UntilBlock: 10}}, links)
+}
+
+func readObject(t *testing.T, store dstore.Store, name string) string {
+	t.Helper()
+
+	reader, err := store.OpenObject(context.Background(), name)
+	require.NoError(t, err)
+	defer reader.Close()
+	content, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	return string(content)
+}
@@ -0,0 +1,184 @@
+// Package pinned serves the files of pinned modules from a read-only cache
+// maintained by another provider, see Store.
+package pinned
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/streamingfast/dstore"
+
+	"github.com/streamingfast/substreams/storage/replica"
+)
+
+var _ dstore.Store = (*Store)(nil)
+var _ dstore.Clonable = (*Store)(nil)
+
+// Store wraps the root state store and serves the files of the pinned modules,
+// addressed by module hash (through `SubStore("<module_hash>/states")` or
+// `SubStore("<module_hash>/outputs")`), from `cache` before the state store.
+// The cache is never written to: files written for a pinned module (ex: the
+// snapshots saved by tier1 past the linear handoff) go to the state store.
+//
+// Other paths are passed through to the state store unmodified. Store must be
+// the outermost wrapper of the state store, the wrappers mapping paths (see
+// package `layout`) not calling SubStore on the store they wrap.
+type Store struct {
+	dstore.Store
+
+	cache        dstore.Store
+	moduleHashes map[string]bool
+}
+
+func NewStore(base dstore.Store, cache dstore.Store, moduleHashes []string) *Store {
+	pinned := make(map[string]bool, len(moduleHashes))
+	for _, hash := range moduleHashes {
+		pinned[hash] = true
+	}
+	return &Store{Store: base, cache: cache, moduleHashes: pinned}
+}
+
+func (s *Store) SubStore(subFolder string) (dstore.Store, error) {
+	base, err := s.Store.SubStore(subFolder)
+	if err != nil {
+		return nil, err
+	}
+
+	moduleHash := strings.Split(strings.TrimPrefix(subFolder, "/"), "/")[0]
+	if !s.moduleHashes[moduleHash] {
+		return base, nil
+	}
+
+	cache, err := s.cache.SubStore(subFolder)
+	if err != nil {
+		return nil, fmt.Errorf("pinned cache: %w", err)
+	}
+	return newModuleStore(subFolder, base, cache), nil
+}
+
+func (s *Store) Clone(ctx context.Context) (dstore.Store, error) {
+	base, err := clone(ctx, s.Store)
+	if err != nil {
+		return nil, err
+	}
+	cache, err := clone(ctx, s.cache)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{Store: base, cache: cache, moduleHashes: s.moduleHashes}, nil
+}
+
+// moduleStore holds the files of a pinned module: reads are served by the cache,
+// then by the state store, see replica.Store. Listings include the files of
+// both, the planner and the readers must see the cached ranges.
+type moduleStore struct {
+	*replica.Store
+
+	prefix string // of the names, relative to the root of the state store
+	base   dstore.Store
+	cache  dstore.Store
+}
+
+func newModuleStore(prefix string, base, cache dstore.Store) *moduleStore {
+	return &moduleStore{
+		Store:  replica.NewSubStore(prefix, base, cache),
+		prefix: prefix,
+		base:   base,
+		cache:  cache,
+	}
+}
+
+func (s *moduleStore) Walk(ctx context.Context, prefix string, f func(filename string) error) error {
+	return s.WalkFrom(ctx, prefix, "", f)
+}
+
+func (s *moduleStore) WalkFrom(ctx context.Context, prefix, startingPoint string, f func(filename string) error) error {
+	seen := map[string]bool{}
+	for _, store := range []dstore.Store{s.cache, s.base} {
+		if err := store.WalkFrom(ctx, prefix, startingPoint, func(filename string) error {
+			seen[filename] = true
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+
+	for _, filename := range sortedNames(seen) {
+		if err := f(filename); err != nil {
+			if errors.Is(err, dstore.StopIteration) {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *moduleStore) ListFiles(ctx context.Context, prefix string, max int) ([]string, error) {
+	seen := map[string]bool{}
+	for _, store := range []dstore.Store{s.cache, s.base} {
+		files, err := store.ListFiles(ctx, prefix, max)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			seen[file] = true
+		}
+	}
+
+	out := sortedNames(seen)
+	if max >= 0 && len(out) > max {
+		out = out[:max]
+	}
+	return out, nil
+}
+
+// DeleteObject only deletes from the state store, the cache is read-only.
+func (s *moduleStore) DeleteObject(ctx context.Context, name string) error {
+	return s.base.DeleteObject(ctx, name)
+}
+
+func (s *moduleStore) SubStore(subFolder string) (dstore.Store, error) {
+	base, err := s.base.SubStore(subFolder)
+	if err != nil {
+		return nil, err
+	}
+	cache, err := s.cache.SubStore(subFolder)
+	if err != nil {
+		return nil, fmt.Errorf("pinned cache: %w", err)
+	}
+	return newModuleStore(path.Join(s.prefix, subFolder), base, cache), nil
+}
+
+func (s *moduleStore) Clone(ctx context.Context) (dstore.Store, error) {
+	base, err := clone(ctx, s.base)
+	if err != nil {
+		return nil, err
+	}
+	cache, err := clone(ctx, s.cache)
+	if err != nil {
+		return nil, err
+	}
+	return newModuleStore(s.prefix, base, cache), nil
+}
+
+func sortedNames(names map[string]bool) []string {
+	out := make([]string, 0, len(names))
+	for name := range names {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func clone(ctx context.Context, store dstore.Store) (dstore.Store, error) {
+	clonable, ok := store.(dstore.Clonable)
+	if !ok {
+		return nil, fmt.Errorf("store %T is not clonable", store)
+	}
+	return clonable.Clone(ctx)
+}
@@ -0,0 +1,73 @@
+package pinned
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/streamingfast/dstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	base := newLocalStore(t)
+	cache := newLocalStore(t)
+
+	require.NoError(t, cache.WriteObject(ctx, "abcdef/states/0000001000-0000000000.kv", bytes.NewReader([]byte("cache"))))
+	require.NoError(t, cache.WriteObject(ctx, "123456/states/0000001000-0000000000.kv", bytes.NewReader([]byte("cache"))))
+	require.NoError(t, base.WriteObject(ctx, "abcdef/states/0000002000-0000000000.kv", bytes.NewReader([]byte("local"))))
+
+	store := NewStore(base, cache, []string{"abcdef"})
+
+	pinned, err := store.SubStore("abcdef/states")
+	require.NoError(t, err)
+	assert.Equal(t, "cache", readObject(t, pinned, "0000001000-0000000000.kv"))
+	assert.Equal(t, "local", readObject(t, pinned, "0000002000-0000000000.kv"))
+
+	files, err := pinned.ListFiles(ctx, "", 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"0000001000-0000000000.kv", "0000002000-0000000000.kv"}, files)
+
+	var walked []string
+	require.NoError(t, pinned.Walk(ctx, "", func(filename string) error {
+		walked = append(walked, filename)
+		return dstore.StopIteration
+	}))
+	assert.Equal(t, []string{"0000001000-0000000000.kv"}, walked)
+
+	require.NoError(t, pinned.WriteObject(ctx, "0000003000-0000000000.kv", bytes.NewReader([]byte("new"))))
+	exists, err := cache.FileExists(ctx, "abcdef/states/0000003000-0000000000.kv")
+	require.NoError(t, err)
+	assert.False(t, exists, "cache is never written to")
+
+	require.NoError(t, pinned.DeleteObject(ctx, "0000003000-0000000000.kv"))
+	assert.ErrorIs(t, pinned.DeleteObject(ctx, "0000001000-0000000000.kv"), dstore.ErrNotFound, "cache is never deleted from")
+
+	notPinned, err := store.SubStore("123456/states")
+	require.NoError(t, err)
+	_, err = notPinned.OpenObject(ctx, "0000001000-0000000000.kv")
+	assert.ErrorIs(t, err, dstore.ErrNotFound)
+}
+
+func newLocalStore(t *testing.T) dstore.Store {
+	t.Helper()
+
+	store, err := dstore.NewStore("file://"+t.TempDir(), "", "", false)
+	require.NoError(t, err)
+	return store
+}
+
+func readObject(t *testing.T, store dstore.Store, name string) string {
+	t.Helper()
+
+	reader, err := store.OpenObject(context.Background(), name)
+	require.NoError(t, err)
+	defer reader.Close()
+
+	content, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	return string(content)
+}
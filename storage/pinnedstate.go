@@ -0,0 +1,35 @@
+package storage
+
+import "github.com/streamingfast/substreams/block"
+
+var _ ModuleStorageState = (*PinnedStorageState)(nil)
+
+// PinnedStorageState is the state of a module pinned to a cache maintained by
+// another provider (see package `pinned`): its range is always complete and no
+// job is ever planned to produce it.
+type PinnedStorageState struct {
+	ModuleName   string
+	InitialBlock uint64
+	UpToBlock    uint64
+}
+
+func NewPinnedStorageState(moduleName string, initialBlock, upToBlock uint64) *PinnedStorageState {
+	return &PinnedStorageState{
+		ModuleName:   moduleName,
+		InitialBlock: initialBlock,
+		UpToBlock:    upToBlock,
+	}
+}
+
+func (s *PinnedStorageState) Name() string { return s.ModuleName }
+
+func (s *PinnedStorageState) InitialProgressRanges() block.Ranges {
+	if s.InitialBlock >= s.UpToBlock {
+		return nil
+	}
+	return block.Ranges{block.NewRange(s.InitialBlock, s.UpToBlock)}
+}
+
+func (s *PinnedStorageState) ReadyUpToBlock() uint64 { return s.UpToBlock }
+
+func (s *PinnedStorageState) BatchRequests(subrequestSplitSize uint64) block.Ranges { return nil }
@@ -0,0 +1,7 @@
+package replica
+
+import (
+	"github.com/streamingfast/logging"
+)
+
+var zlog, _ = logging.PackageLogger("replica", "github.com/streamingfast/substreams/storage/replica")
@@ -0,0 +1,228 @@
+package replica
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/streamingfast/dstore"
+	"go.uber.org/zap"
+)
+
+var _ dstore.Store = (*Store)(nil)
+var _ dstore.Clonable = (*Store)(nil)
+
+// Store writes to a primary state store and reads from its replicas, for
+// deployments running tier2 workers in multiple regions, the replicas being
+// kept in sync with the primary by the storage provider.
+//
+// Only the module files (store snapshots, execution outputs segments and their
+// blobs, see isModuleFile) are read from the replicas, trying them in the
+// configured order (nearest or cheapest first) and falling back to the next
+// one, then to the primary, when the file is missing (the replica may lag
+// behind) or the replica fails. A module file rewritten under the same name
+// (ex: a job retried, a corrupted snapshot produced again) is served in its
+// previous version by a replica lagging behind, until it catches up: the module
+// files being deterministic, both versions hold the same content unless the
+// previous one was corrupted.
+//
+// The other files are control files updated in place or deciding what the
+// garbage collection deletes (leases, access markers, plan checkpoints, flush
+// manifests, idempotency records, resume points, throughput stats): they are
+// always read from the primary, a lagging replica would show an expired lease
+// or a stale last access.
+//
+// Listings are always served by the primary, the cleanup of partial files and
+// the checkpoints decide from them and must see the authoritative content.
+// Deletions are applied to the primary then, on a best-effort basis, to the
+// replicas, so that a deleted file is not served anymore from a replica: the
+// storage provider deletes it from a replica failing to do so.
+type Store struct {
+	primary  dstore.Store
+	replicas []dstore.Store
+	prefix   string // of the names, relative to the root of the state store
+}
+
+func NewStore(primary dstore.Store, replicas ...dstore.Store) *Store {
+	return &Store{primary: primary, replicas: replicas}
+}
+
+// NewSubStore is NewStore for stores already rooted at `prefix`, relative to
+// the root of the state store (ex: `<module_hash>/states`), so that their
+// module files are recognized.
+func NewSubStore(prefix string, primary dstore.Store, replicas ...dstore.Store) *Store {
+	return &Store{primary: primary, replicas: replicas, prefix: strings.Trim(prefix, "/")}
+}
+
+// NewStoreFromURLs creates the primary and replica stores from their URLs,
+// with the same options as `dstore.NewStore`.
+func NewStoreFromURLs(primaryURL string, replicaURLs []string, extension, compressionType string, overwrite bool) (*Store, error) {
+	primary, err := dstore.NewStore(primaryURL, extension, compressionType, overwrite)
+	if err != nil {
+		return nil, fmt.Errorf("primary store %q: %w", primaryURL, err)
+	}
+
+	var replicas []dstore.Store
+	for _, replicaURL := range replicaURLs {
+		replica, err := dstore.NewStore(replicaURL, extension, compressionType, overwrite)
+		if err != nil {
+			return nil, fmt.Errorf("replica store %q: %w", replicaURL, err)
+		}
+		replicas = append(replicas, replica)
+	}
+	return NewStore(primary, replicas...), nil
+}
+
+// readStores returns the stores to read `name` from, in order.
+func (s *Store) readStores(name string) []dstore.Store {
+	if !isModuleFile(path.Join(s.prefix, name)) {
+		return []dstore.Store{s.primary}
+	}
+	return append(append([]dstore.Store{}, s.replicas...), s.primary)
+}
+
+func (s *Store) allStores() []dstore.Store {
+	return append(append([]dstore.Store{}, s.replicas...), s.primary)
+}
+
+// isModuleFile returns whether `filePath`, relative to the root of the state
+// store, is a store snapshot or an execution outputs segment laid out in v1
+// (`<module_hash>/<states|outputs>/<file>`) or v2 (see package `layout`), or
+// an execution outputs blob (`outputs-blobs/<file>`, see execout.BlobsDir).
+func isModuleFile(filePath string) bool {
+	parts := strings.Split(filePath, "/")
+	switch len(parts) {
+	case 2:
+		return parts[0] == "outputs-blobs"
+	case 3:
+		return parts[1] == "states" || parts[1] == "outputs"
+	case 5:
+		return parts[2] == "states" || parts[2] == "outputs"
+	}
+	return false
+}
+
+func (s *Store) OpenObject(ctx context.Context, name string) (out io.ReadCloser, err error) {
+	for _, store := range s.readStores(name) {
+		out, err = store.OpenObject(ctx, name)
+		if err == nil {
+			return out, nil
+		}
+	}
+	return nil, err
+}
+
+func (s *Store) FileExists(ctx context.Context, name string) (exists bool, err error) {
+	for _, store := range s.readStores(name) {
+		exists, err = store.FileExists(ctx, name)
+		if err == nil && exists {
+			return true, nil
+		}
+	}
+	return exists, err
+}
+
+func (s *Store) ObjectAttributes(ctx context.Context, name string) (attrs *dstore.ObjectAttributes, err error) {
+	for _, store := range s.readStores(name) {
+		attrs, err = store.ObjectAttributes(ctx, name)
+		if err == nil {
+			return attrs, nil
+		}
+	}
+	return nil, err
+}
+
+func (s *Store) ObjectPath(name string) string { return s.primary.ObjectPath(name) }
+func (s *Store) ObjectURL(name string) string  { return s.primary.ObjectURL(name) }
+func (s *Store) BaseURL() *url.URL             { return s.primary.BaseURL() }
+func (s *Store) Overwrite() bool               { return s.primary.Overwrite() }
+
+func (s *Store) WriteObject(ctx context.Context, name string, f io.Reader) error {
+	return s.primary.WriteObject(ctx, name, f)
+}
+
+func (s *Store) PushLocalFile(ctx context.Context, localFile, toBaseName string) error {
+	return s.primary.PushLocalFile(ctx, localFile, toBaseName)
+}
+
+func (s *Store) CopyObject(ctx context.Context, src, dest string) error {
+	return s.primary.CopyObject(ctx, src, dest)
+}
+
+func (s *Store) Walk(ctx context.Context, prefix string, f func(filename string) error) error {
+	return s.primary.Walk(ctx, prefix, f)
+}
+
+func (s *Store) WalkFrom(ctx context.Context, prefix, startingPoint string, f func(filename string) error) error {
+	return s.primary.WalkFrom(ctx, prefix, startingPoint, f)
+}
+
+func (s *Store) ListFiles(ctx context.Context, prefix string, max int) ([]string, error) {
+	return s.primary.ListFiles(ctx, prefix, max)
+}
+
+func (s *Store) DeleteObject(ctx context.Context, name string) error {
+	if err := s.primary.DeleteObject(ctx, name); err != nil {
+		return err
+	}
+	for _, replica := range s.replicas {
+		if err := replica.DeleteObject(ctx, name); err != nil && !errors.Is(err, dstore.ErrNotFound) {
+			zlog.Warn("cannot delete file from replica, it is deleted from the primary", zap.String("file", name), zap.Stringer("replica", replica.BaseURL()), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+func (s *Store) SetOverwrite(enabled bool) {
+	for _, store := range s.allStores() {
+		store.SetOverwrite(enabled)
+	}
+}
+
+func (s *Store) SetMeter(meter dstore.Meter) {
+	for _, store := range s.allStores() {
+		store.SetMeter(meter)
+	}
+}
+
+func (s *Store) SubStore(subFolder string) (dstore.Store, error) {
+	primary, err := s.primary.SubStore(subFolder)
+	if err != nil {
+		return nil, err
+	}
+
+	replicas := make([]dstore.Store, len(s.replicas))
+	for i, replica := range s.replicas {
+		if replicas[i], err = replica.SubStore(subFolder); err != nil {
+			return nil, fmt.Errorf("replica %q: %w", replica.BaseURL(), err)
+		}
+	}
+	return &Store{primary: primary, replicas: replicas, prefix: path.Join(s.prefix, subFolder)}, nil
+}
+
+func (s *Store) Clone(ctx context.Context) (dstore.Store, error) {
+	primary, err := clone(ctx, s.primary)
+	if err != nil {
+		return nil, err
+	}
+
+	replicas := make([]dstore.Store, len(s.replicas))
+	for i, replica := range s.replicas {
+		if replicas[i], err = clone(ctx, replica); err != nil {
+			return nil, err
+		}
+	}
+	return &Store{primary: primary, replicas: replicas, prefix: s.prefix}, nil
+}
+
+func clone(ctx context.Context, store dstore.Store) (dstore.Store, error) {
+	clonable, ok := store.(dstore.Clonable)
+	if !ok {
+		return nil, fmt.Errorf("store %T is not clonable", store)
+	}
+	return clonable.Clone(ctx)
+}
@@ -0,0 +1,139 @@
+package replica
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/streamingfast/dstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/streamingfast/substreams/storage/lease"
+)
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	primary := newLocalStore(t)
+	nearReplica := newLocalStore(t)
+	farReplica := newLocalStore(t)
+
+	// "both" was replicated, "lagging" not yet, "far" only reached the far replica
+	require.NoError(t, primary.WriteObject(ctx, "abcdef/states/both.kv", bytes.NewReader([]byte("primary"))))
+	require.NoError(t, nearReplica.WriteObject(ctx, "abcdef/states/both.kv", bytes.NewReader([]byte("near"))))
+	require.NoError(t, primary.WriteObject(ctx, "abcdef/states/lagging.kv", bytes.NewReader([]byte("primary"))))
+	require.NoError(t, farReplica.WriteObject(ctx, "abcdef/states/far.kv", bytes.NewReader([]byte("far"))))
+
+	sub, err := NewStore(primary, nearReplica, farReplica).SubStore("abcdef/states")
+	require.NoError(t, err)
+
+	assert.Equal(t, "near", readObject(t, sub, "both.kv"))
+	assert.Equal(t, "primary", readObject(t, sub, "lagging.kv"))
+	assert.Equal(t, "far", readObject(t, sub, "far.kv"))
+
+	exists, err := sub.FileExists(ctx, "lagging.kv")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	_, err = sub.OpenObject(ctx, "missing.kv")
+	assert.ErrorIs(t, err, dstore.ErrNotFound)
+
+	require.NoError(t, sub.WriteObject(ctx, "new.kv", bytes.NewReader([]byte("new"))))
+	exists, err = primary.FileExists(ctx, "abcdef/states/new.kv")
+	require.NoError(t, err)
+	assert.True(t, exists)
+	exists, err = nearReplica.FileExists(ctx, "abcdef/states/new.kv")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	files, err := sub.ListFiles(ctx, "", 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"both.kv", "lagging.kv", "new.kv"}, files)
+
+	require.NoError(t, sub.DeleteObject(ctx, "both.kv"))
+	_, err = sub.OpenObject(ctx, "both.kv")
+	assert.ErrorIs(t, err, dstore.ErrNotFound)
+}
+
+func TestStore_ControlFilesReadFromPrimary(t *testing.T) {
+	ctx := context.Background()
+	primary := newLocalStore(t)
+	replica := newLocalStore(t)
+
+	// the replica still holds the lease, expired, before its renewal on the primary
+	_, err := lease.Acquire(ctx, replica, "abcdef", "tier1-a", "squashing", time.Millisecond)
+	require.NoError(t, err)
+	time.Sleep(5 * time.Millisecond)
+	_, err = lease.Acquire(ctx, primary, "abcdef", "tier1-a", "squashing", time.Hour)
+	require.NoError(t, err)
+
+	store := NewStore(primary, replica)
+	renewed, err := lease.Get(ctx, store, "abcdef")
+	require.NoError(t, err)
+	require.NotNil(t, renewed, "the lease renewed on the primary is active")
+
+	active, err := lease.Active(ctx, store)
+	require.NoError(t, err)
+	assert.Contains(t, active, "abcdef")
+
+	require.NoError(t, replica.WriteObject(ctx, "abcdef/accessed/0000001000-0000000000", bytes.NewReader([]byte("stale"))))
+	_, err = store.OpenObject(ctx, "abcdef/accessed/0000001000-0000000000")
+	assert.ErrorIs(t, err, dstore.ErrNotFound, "access markers are read from the primary")
+}
+
+func TestIsModuleFile(t *testing.T) {
+	assert.True(t, isModuleFile("abcdef/states/0000001000-0000000000.kv"))
+	assert.True(t, isModuleFile("abcdef/outputs/0000001000-0000000000.output"))
+	assert.True(t, isModuleFile("ab/abcdef/states/0000000000/0000001000-0000000000.kv"))
+	assert.True(t, isModuleFile("outputs-blobs/0123.output"))
+
+	assert.False(t, isModuleFile("abcdef/accessed/0000001000-0000000000"))
+	assert.False(t, isModuleFile("abcdef/states/resume/request/0000001000-0000000000.id.kv"))
+	assert.False(t, isModuleFile("abcdef/commits/0000001000-trace"))
+	assert.False(t, isModuleFile("leases/abcdef.json"))
+	assert.False(t, isModuleFile("plans/0123.json"))
+	assert.False(t, isModuleFile("idempotency/abcdef/states/0000001000-0000000000.kv@trace"))
+}
+
+func TestStore_DeleteReplicaFailure(t *testing.T) {
+	ctx := context.Background()
+	primary := newLocalStore(t)
+	replica := &undeletableStore{Store: newLocalStore(t)}
+	require.NoError(t, primary.WriteObject(ctx, "file.kv", bytes.NewReader([]byte("primary"))))
+
+	require.NoError(t, NewStore(primary, replica).DeleteObject(ctx, "file.kv"), "replica deletion is best-effort")
+	exists, err := primary.FileExists(ctx, "file.kv")
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
+
+type undeletableStore struct {
+	dstore.Store
+}
+
+func (s *undeletableStore) DeleteObject(ctx context.Context, name string) error {
+	return fmt.Errorf("permission denied")
+}
+
+func newLocalStore(t *testing.T) dstore.Store {
+	t.Helper()
+
+	store, err := dstore.NewStore("file://"+t.TempDir(), "", "", false)
+	require.NoError(t, err)
+	return store
+}
+
+func readObject(t *testing.T, store dstore.Store, name string) string {
+	t.Helper()
+
+	reader, err := store.OpenObject(context.Background(), name)
+	require.NoError(t, err)
+	defer reader.Close()
+
+	content, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	return string(content)
+}
@@ -6,6 +6,7 @@ import (
 	pbssinternal "github.com/streamingfast/substreams/pb/sf/substreams/intern/v2"
 	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
 	"github.com/streamingfast/substreams/storage/store/marshaller"
+	pbstore "github.com/streamingfast/substreams/storage/store/marshaller/pb"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
@@ -14,11 +15,20 @@ type baseStore struct {
 	*Config
 
 	kv             map[string][]byte          // kv is the state, and assumes all deltas were already applied to it.
+	keyIndex       *keyIndex                  // keys of kv in order, nil until a prefix or range deletion needs it
 	deltas         []*pbssinternal.StoreDelta // deltas are always deltas for the given block.
 	lastOrdinal    uint64
 	marshaller     marshaller.Marshaller
 	totalSizeBytes uint64
 
+	spill    *spill // values moved to disk once the kv map exceeds the spill threshold, see Config.SetSpill
+	memBytes uint64 // size of the keys and values held in the kv map
+
+	lineage       *pbstore.Lineage         // lineage of the loaded file, or of the last merged partial
+	lineageInputs []*pbstore.InputSnapshot // input stores snapshots recorded in the saved files lineage
+
+	updatedAt map[string]uint64 // block of the last update of the keys, only tracked with a retention policy
+
 	logger *zap.Logger
 }
 
@@ -34,7 +44,7 @@ func (b *baseStore) MarshalLogObject(enc zapcore.ObjectEncoder) error {
 	enc.AddString("name", b.name)
 	enc.AddString("hash", b.moduleHash)
 	enc.AddUint64("module_initial_block", b.moduleInitialBlock)
-	enc.AddInt("key_count", len(b.kv))
+	enc.AddInt("key_count", b.keyCount())
 	enc.AddUint64("total_size_bytes", b.totalSizeBytes)
 
 	return nil
@@ -42,7 +52,7 @@ func (b *baseStore) MarshalLogObject(enc zapcore.ObjectEncoder) error {
 
 func (b *baseStore) Reset() {
 	if tracer.Enabled() {
-		b.logger.Debug("flushing store", zap.Int("delta_count", len(b.deltas)), zap.Int("entry_count", len(b.kv)), zap.Uint64("total_size_bytes", b.totalSizeBytes))
+		b.logger.Debug("flushing store", zap.Int("delta_count", len(b.deltas)), zap.Int("entry_count", b.keyCount()), zap.Uint64("total_size_bytes", b.totalSizeBytes))
 	}
 	b.deltas = nil
 	b.lastOrdinal = 0
@@ -0,0 +1,56 @@
+package store
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// Store files end with a footer holding the sha256 of their content followed
+// by checksumMagic, verified when they are loaded. Files written before the
+// footer was introduced don't end with the magic and are read unverified.
+var checksumMagic = []byte("\x00sssum01")
+
+const checksumFooterSize = sha256.Size + 8
+
+// CorruptedStateFileError is returned when loading a store file whose content
+// doesn't match the checksum of its footer, for example because it was
+// corrupted by the object store.
+type CorruptedStateFileError struct {
+	Filename         string
+	ExpectedChecksum string
+	ActualChecksum   string
+}
+
+func (e *CorruptedStateFileError) Error() string {
+	return fmt.Sprintf("corrupted state file %s: content checksum is %s, footer expects %s", e.Filename, e.ActualChecksum, e.ExpectedChecksum)
+}
+
+func withChecksum(content []byte) []byte {
+	sum := sha256.Sum256(content)
+	out := make([]byte, 0, len(content)+checksumFooterSize)
+	out = append(out, content...)
+	out = append(out, sum[:]...)
+	return append(out, checksumMagic...)
+}
+
+// verifyChecksum returns the content of `data`, stripped of its footer once
+// verified. Data without a footer is returned as is.
+func verifyChecksum(filename string, data []byte) ([]byte, error) {
+	if len(data) < checksumFooterSize || !bytes.HasSuffix(data, checksumMagic) {
+		return data, nil
+	}
+
+	content := data[:len(data)-checksumFooterSize]
+	expected := data[len(content) : len(content)+sha256.Size]
+	actual := sha256.Sum256(content)
+	if !bytes.Equal(expected, actual[:]) {
+		return nil, &CorruptedStateFileError{
+			Filename:         filename,
+			ExpectedChecksum: hex.EncodeToString(expected),
+			ActualChecksum:   hex.EncodeToString(actual[:]),
+		}
+	}
+	return content, nil
+}
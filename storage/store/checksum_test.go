@@ -0,0 +1,69 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/streamingfast/dstore"
+	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestChecksum_SaveLoad(t *testing.T) {
+	ctx := context.Background()
+	var written []byte
+	objStore := dstore.NewMockStore(func(base string, f io.Reader) (err error) {
+		written, err = io.ReadAll(f)
+		return err
+	})
+	objStore.OpenObjectFunc = func(ctx context.Context, name string) (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(written)), nil
+	}
+
+	config, err := NewConfig("mod", 0, "abc", pbsubstreams.Module_KindStore_UPDATE_POLICY_SET, "string", objStore, "")
+	require.NoError(t, err)
+	s := config.NewFullKV(zap.NewNop())
+	partial := s.DerivePartialStore(0)
+	partial.Set(0, "key", "value")
+	file, writer, err := partial.Save(10)
+	require.NoError(t, err)
+	require.NoError(t, writer.Write(ctx))
+	assert.True(t, bytes.HasSuffix(written, checksumMagic))
+	assert.Equal(t, uint64(len(written)), writer.Size())
+
+	loaded := s.DerivePartialStore(0)
+	require.NoError(t, loaded.Load(ctx, file))
+	value, found := loaded.GetLast("key")
+	require.True(t, found)
+	assert.Equal(t, "value", string(value))
+
+	// files written before the footer was introduced are read unverified
+	written = written[:len(written)-checksumFooterSize]
+	loaded = s.DerivePartialStore(0)
+	require.NoError(t, loaded.Load(ctx, file))
+	assert.Equal(t, 1, loaded.keyCount())
+}
+
+func TestChecksum_Verify(t *testing.T) {
+	data := withChecksum([]byte("content"))
+
+	content, err := verifyChecksum("file.kv", data)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("content"), content)
+
+	content, err = verifyChecksum("file.kv", []byte("legacy"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("legacy"), content)
+
+	data[0] = 'C'
+	_, err = verifyChecksum("file.kv", data)
+	var corrupted *CorruptedStateFileError
+	require.True(t, errors.As(err, &corrupted))
+	assert.Equal(t, "file.kv", corrupted.Filename)
+	assert.NotEqual(t, corrupted.ExpectedChecksum, corrupted.ActualChecksum)
+}
@@ -0,0 +1,225 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/streamingfast/dstore"
+	"github.com/streamingfast/logging"
+	"go.uber.org/zap"
+
+	"github.com/streamingfast/substreams/storage/idempotency"
+)
+
+// Flush commits are recorded in the state store under
+// `<module_hash>/commits/`, for each of the stores flushed. Before the
+// snapshots of several stores reaching the same boundary are written, a pending
+// manifest naming them is written; once they are all written, the commit
+// manifest is written last. A pending manifest without its commit manifest is
+// a flush interrupted midway, or still in progress: the partial snapshots its
+// request wrote at that boundary are ignored when planning, see Uncommitted.
+//
+// A pending manifest older than PendingFlushTTL is abandoned: it is deleted
+// when listed, like the commit manifests left without their pending manifest.
+//
+// Snapshots written before commits existed, or by a single store flush, have no
+// manifest and are used as is.
+const commitsDir = "commits/"
+
+const (
+	pendingSuffix = ".pending.json"
+	commitSuffix  = ".commit.json"
+)
+
+// PendingFlushTTL is the age after which a pending manifest is no longer
+// considered, its flush being abandoned.
+var PendingFlushTTL = time.Hour
+
+// Flush is the manifest of the snapshots of several stores saved at the same
+// boundary by the request `TraceID`.
+type Flush struct {
+	BoundaryBlock uint64          `json:"boundary_block"`
+	TraceID       string          `json:"trace_id"`
+	StartedAt     time.Time       `json:"started_at"`
+	Stores        []*FlushedStore `json:"stores"`
+}
+
+type FlushedStore struct {
+	Name       string `json:"name"`
+	ModuleHash string `json:"module_hash"`
+	Filename   string `json:"filename,omitempty"` // set in the commit manifest
+}
+
+func (f *Flush) key(moduleHash string) string {
+	return fmt.Sprintf("%s/%s%010d-%s", moduleHash, commitsDir, f.BoundaryBlock, f.TraceID)
+}
+
+// Commits reads and writes the flush manifests of a state store, it is shared
+// by the configs of a ConfigMap.
+type Commits struct {
+	objStore dstore.Store
+	ledger   *idempotency.Ledger // nil when the manifests are not checked, see ConfigMap.SetIdempotencyLedger
+}
+
+func NewCommits(stateStore dstore.Store) *Commits {
+	return &Commits{objStore: stateStore}
+}
+
+// Begin writes the pending manifest of `flush` for each of its stores, before
+// their snapshots.
+func (c *Commits) Begin(ctx context.Context, flush *Flush) error {
+	if flush.StartedAt.IsZero() {
+		flush.StartedAt = time.Now()
+	}
+	for _, flushed := range flush.Stores {
+		if err := c.write(ctx, flush.key(flushed.ModuleHash)+pendingSuffix, flush); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Commit writes the commit manifest of `flush` for each of its stores, once
+// all its snapshots are written, and deletes its pending manifests.
+func (c *Commits) Commit(ctx context.Context, flush *Flush) error {
+	for _, flushed := range flush.Stores {
+		if err := c.write(ctx, flush.key(flushed.ModuleHash)+commitSuffix, flush); err != nil {
+			return err
+		}
+	}
+	for _, flushed := range flush.Stores {
+		if err := c.objStore.DeleteObject(ctx, flush.key(flushed.ModuleHash)+pendingSuffix); err != nil && !errors.Is(err, dstore.ErrNotFound) {
+			return fmt.Errorf("deleting pending flush manifest: %w", err)
+		}
+	}
+	return nil
+}
+
+func (c *Commits) write(ctx context.Context, filename string, flush *Flush) error {
+	content, err := json.Marshal(flush)
+	if err != nil {
+		return fmt.Errorf("encoding flush manifest: %w", err)
+	}
+	_, err = c.ledger.Write(ctx, c.objStore, filename, flush.TraceID, func(ctx context.Context) error {
+		return c.objStore.WriteObject(ctx, filename, bytes.NewReader(content))
+	})
+	if err != nil {
+		return fmt.Errorf("writing flush manifest %q: %w", filename, err)
+	}
+	return nil
+}
+
+func (c *Commits) read(ctx context.Context, filename string) (*Flush, error) {
+	reader, err := c.objStore.OpenObject(ctx, filename)
+	if err != nil {
+		return nil, fmt.Errorf("opening flush manifest %q: %w", filename, err)
+	}
+	defer reader.Close()
+
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("reading flush manifest %q: %w", filename, err)
+	}
+
+	out := &Flush{}
+	if err := json.Unmarshal(content, out); err != nil {
+		return nil, fmt.Errorf("decoding flush manifest %q: %w", filename, err)
+	}
+	return out, nil
+}
+
+// Uncommitted returns the flushes of the store of `moduleHash` at boundaries
+// below `below` whose commit manifest was never written, and that are not
+// abandoned yet.
+//
+// A pending manifest is also seen while its flush is in progress: the partial
+// snapshots of its request are then ignored until committed, which only costs
+// reprocessing them.
+func (c *Commits) Uncommitted(ctx context.Context, moduleHash string, below uint64) (*UncommittedFlushes, error) {
+	dir := moduleHash + "/" + commitsDir
+	pending := map[string]bool{}
+	committed := map[string]bool{}
+	err := c.objStore.Walk(ctx, dir, func(filename string) error {
+		boundary, err := strconv.ParseUint(strings.SplitN(strings.TrimPrefix(filename, dir), "-", 2)[0], 10, 64)
+		if err != nil {
+			return nil
+		}
+		if boundary >= below {
+			return dstore.StopIteration
+		}
+		switch {
+		case strings.HasSuffix(filename, pendingSuffix):
+			pending[strings.TrimSuffix(filename, pendingSuffix)] = true
+		case strings.HasSuffix(filename, commitSuffix):
+			committed[strings.TrimSuffix(filename, commitSuffix)] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing flush manifests: %w", err)
+	}
+
+	for key := range committed {
+		if !pending[key] {
+			c.delete(ctx, key+commitSuffix)
+		}
+	}
+
+	out := &UncommittedFlushes{}
+	for key := range pending {
+		if committed[key] {
+			c.delete(ctx, key+pendingSuffix) // deleting it on commit failed
+			continue
+		}
+		flush, err := c.read(ctx, key+pendingSuffix)
+		if err != nil {
+			if errors.Is(err, dstore.ErrNotFound) {
+				continue // committed since listed
+			}
+			return nil, err
+		}
+		if time.Since(flush.StartedAt) > PendingFlushTTL {
+			c.delete(ctx, key+pendingSuffix)
+			continue
+		}
+		out.flushes = append(out.flushes, flush)
+	}
+	return out, nil
+}
+
+// delete deletes the manifest `filename`, the manifests left behind being
+// deleted again the next time they are listed.
+func (c *Commits) delete(ctx context.Context, filename string) {
+	if err := c.objStore.DeleteObject(ctx, filename); err != nil && !errors.Is(err, dstore.ErrNotFound) {
+		logging.Logger(ctx, zlog).Warn("deleting flush manifest", zap.String("filename", filename), zap.Error(err))
+	}
+}
+
+// UncommittedFlushes are the flushes of a store interrupted midway, see
+// Commits.
+type UncommittedFlushes struct {
+	flushes []*Flush
+}
+
+// Discards tells if the snapshot `file` was written by an uncommitted flush,
+// and must not be used. Only the partial snapshots of the request of the flush
+// are: the complete ones are named after their range only, and may as well
+// have been written by another request.
+func (u *UncommittedFlushes) Discards(file *FileInfo) bool {
+	if u == nil || !file.Partial {
+		return false
+	}
+	for _, flush := range u.flushes {
+		if flush.BoundaryBlock == file.Range.ExclusiveEndBlock && file.TraceID == flush.TraceID {
+			return true
+		}
+	}
+	return false
+}
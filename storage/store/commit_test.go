@@ -0,0 +1,75 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/streamingfast/dstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommits(t *testing.T) {
+	ctx := context.Background()
+	stateStore, err := dstore.NewStore("file://"+t.TempDir(), "zst", "zstd", true)
+	require.NoError(t, err)
+	commits := NewCommits(stateStore)
+
+	completeA := NewCompleteFileInfo(0, 1000)
+	partialB := NewPartialFileInfo(0, 1000, "trace1")
+	flush := &Flush{
+		BoundaryBlock: 1000,
+		TraceID:       "trace1",
+		Stores:        []*FlushedStore{{Name: "store_a", ModuleHash: "aaa"}, {Name: "store_b", ModuleHash: "bbb"}},
+	}
+	require.NoError(t, commits.Begin(ctx, flush))
+
+	uncommitted, err := commits.Uncommitted(ctx, "bbb", 2000)
+	require.NoError(t, err)
+	assert.True(t, uncommitted.Discards(partialB))
+	assert.False(t, uncommitted.Discards(NewPartialFileInfo(0, 1000, "trace2")), "partial of another request")
+	assert.False(t, uncommitted.Discards(NewPartialFileInfo(0, 2000, "trace1")), "other boundary")
+	assert.False(t, uncommitted.Discards(completeA), "complete snapshots may be written by any request")
+
+	uncommitted, err = commits.Uncommitted(ctx, "ccc", 2000)
+	require.NoError(t, err)
+	assert.False(t, uncommitted.Discards(NewPartialFileInfo(0, 1000, "trace1")), "store not flushed")
+
+	uncommitted, err = commits.Uncommitted(ctx, "bbb", 1000)
+	require.NoError(t, err)
+	assert.False(t, uncommitted.Discards(partialB), "flush above the boundaries listed")
+
+	flush.Stores[0].Filename = completeA.Filename
+	flush.Stores[1].Filename = partialB.Filename
+	require.NoError(t, commits.Commit(ctx, flush))
+	uncommitted, err = commits.Uncommitted(ctx, "bbb", 2000)
+	require.NoError(t, err)
+	assert.False(t, uncommitted.Discards(partialB))
+	committed, err := stateStore.FileExists(ctx, "bbb/commits/0000001000-trace1.commit.json")
+	require.NoError(t, err)
+	assert.False(t, committed, "commit manifest deleted once its pending manifest is")
+
+	assert.False(t, (*UncommittedFlushes)(nil).Discards(partialB))
+}
+
+func TestCommits_Abandoned(t *testing.T) {
+	ctx := context.Background()
+	stateStore, err := dstore.NewStore("file://"+t.TempDir(), "zst", "zstd", true)
+	require.NoError(t, err)
+	commits := NewCommits(stateStore)
+
+	require.NoError(t, commits.Begin(ctx, &Flush{
+		BoundaryBlock: 1000,
+		TraceID:       "trace1",
+		StartedAt:     time.Now().Add(-PendingFlushTTL - time.Minute),
+		Stores:        []*FlushedStore{{Name: "store_a", ModuleHash: "aaa"}, {Name: "store_b", ModuleHash: "bbb"}},
+	}))
+
+	uncommitted, err := commits.Uncommitted(ctx, "aaa", 2000)
+	require.NoError(t, err)
+	assert.False(t, uncommitted.Discards(NewPartialFileInfo(0, 1000, "trace1")))
+	pending, err := stateStore.FileExists(ctx, "aaa/commits/0000001000-trace1.pending.json")
+	require.NoError(t, err)
+	assert.False(t, pending, "abandoned pending manifest deleted")
+}
@@ -3,6 +3,7 @@ package store
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 
@@ -26,16 +27,50 @@ func saveStore(ctx context.Context, store dstore.Store, filename string, content
 	})
 }
 
-func loadStore(ctx context.Context, store dstore.Store, filename string) (out []byte, err error) {
+// streamStore writes `filename` with the content `write` produces, through a
+// pipe instead of holding it in memory. `write` runs again on each attempt, it
+// returns the size of the content written.
+func streamStore(ctx context.Context, store dstore.Store, filename string, write func(w io.Writer) (uint64, error)) (size uint64, err error) {
 	if cloned, ok := store.(dstore.Clonable); ok {
 		store, err = cloned.Clone(ctx)
 		if err != nil {
-			return nil, fmt.Errorf("cloning store: %w", err)
+			return 0, fmt.Errorf("cloning store: %w", err)
 		}
 		store.SetMeter(dmetering.GetBytesMeter(ctx))
 	}
 
 	err = derr.RetryContext(ctx, 5, func(ctx context.Context) error {
+		reader, writer := io.Pipe()
+		written := make(chan uint64, 1)
+		go func() {
+			n, err := write(writer)
+			written <- n
+			writer.CloseWithError(err)
+		}()
+
+		err := store.WriteObject(ctx, filename, reader)
+		// unblocks the writes of `write` when WriteObject did not read it all
+		reader.CloseWithError(fmt.Errorf("writing %s: aborted", filename))
+		size = <-written
+		return err
+	})
+	return size, err
+}
+
+// loadStore reads `filename`, verifies its checksum and decodes its content
+// with `decode`, see decodeStateFile. The file is read again when verifying or
+// decoding fails, it may have been read while being rewritten or corrupted in
+// transit, but not when its version is not supported.
+func loadStore(ctx context.Context, store dstore.Store, filename string, decode func(data []byte) error) (err error) {
+	if cloned, ok := store.(dstore.Clonable); ok {
+		store, err = cloned.Clone(ctx)
+		if err != nil {
+			return fmt.Errorf("cloning store: %w", err)
+		}
+		store.SetMeter(dmetering.GetBytesMeter(ctx))
+	}
+
+	return derr.RetryContext(ctx, 5, func(ctx context.Context) error {
 		r, err := store.OpenObject(ctx, filename)
 		if err != nil {
 			return fmt.Errorf("opening file: %w", err)
@@ -47,8 +82,14 @@ func loadStore(ctx context.Context, store dstore.Store, filename string) (out []
 			return fmt.Errorf("reading data: %w", err)
 		}
 
-		out = data
-		return nil
+		content, err := decodeStateFile(filename, data)
+		if err != nil {
+			var versionErr *UnsupportedStateFileVersionError
+			if errors.As(err, &versionErr) {
+				return derr.NewFatalError(err)
+			}
+			return err
+		}
+		return decode(content)
 	})
-	return out, err
 }
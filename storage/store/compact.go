@@ -0,0 +1,84 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/streamingfast/dstore"
+
+	"github.com/streamingfast/substreams/storage/lease"
+)
+
+// CompactSnapshots thins out the complete snapshots (`.kv`) of the modules of
+// `stateStore`, keeping only those ending on a multiple of `interval` and the
+// last one of each module. A complete snapshot holds the whole store from the
+// module's initial block, so the snapshots kept are the coarser snapshots the
+// deleted ones were merged into: requests starting between two of them
+// process the blocks from the previous one.
+//
+// Only the modules of `moduleHashes` are compacted, all of them when empty.
+// The modules with an active lease (see package `lease`) are skipped.
+// With `dryRun`, nothing is deleted, `onFile` is still called for every file
+// that would be.
+func CompactSnapshots(ctx context.Context, stateStore dstore.Store, moduleHashes []string, interval uint64, dryRun bool, onFile func(filePath string)) (deleted int, err error) {
+	if interval == 0 {
+		return 0, fmt.Errorf("interval must be greater than 0")
+	}
+
+	selected := make(map[string]bool, len(moduleHashes))
+	for _, moduleHash := range moduleHashes {
+		selected[moduleHash] = true
+	}
+
+	type snapshot struct {
+		filePath string
+		endBlock uint64
+	}
+	leases, err := lease.Active(ctx, stateStore)
+	if err != nil {
+		return 0, err
+	}
+
+	modules := map[string][]snapshot{} // by v1 directory, `<module_hash>/states/`
+	err = walkStateFiles(ctx, stateStore, func(moduleDir, filePath string, fileInfo *FileInfo) {
+		if fileInfo.Partial {
+			return
+		}
+		moduleHash := moduleHashOf(moduleDir)
+		if (len(selected) != 0 && !selected[moduleHash]) || leases[moduleHash] != nil {
+			return
+		}
+		modules[moduleDir] = append(modules[moduleDir], snapshot{filePath: filePath, endBlock: fileInfo.Range.ExclusiveEndBlock})
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var toDelete []string
+	for _, snapshots := range modules {
+		sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].endBlock < snapshots[j].endBlock })
+		for _, snapshot := range snapshots[:len(snapshots)-1] {
+			if snapshot.endBlock%interval != 0 {
+				toDelete = append(toDelete, snapshot.filePath)
+			}
+		}
+	}
+	sort.Strings(toDelete)
+
+	for _, filePath := range toDelete {
+		if onFile != nil {
+			onFile(filePath)
+		}
+		if dryRun {
+			deleted++
+			continue
+		}
+
+		if err := stateStore.DeleteObject(ctx, filePath); err != nil {
+			return deleted, fmt.Errorf("deleting %q: %w", filePath, err)
+		}
+		deleted++
+	}
+	return deleted, nil
+}
@@ -0,0 +1,57 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	"github.com/streamingfast/dstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompactSnapshots(t *testing.T) {
+	newStateStore := func() *dstore.MockStore {
+		stateStore := dstore.NewMockStore(nil)
+		for _, file := range []string{
+			"abc/states/0000001000-0000000010.kv",
+			"abc/states/0000002000-0000000010.kv",
+			"abc/states/0000003000-0000000010.kv",
+			"abc/states/0000004000-0000000010.kv",
+			"abc/states/0000005000-0000000010.kv",
+			"abc/states/0000004000-0000003000.partial",
+			"de/def/states/0000000000/0000001000-0000000000.kv",
+			"de/def/states/0000000000/0000002000-0000000000.kv",
+			"de/def/states/0000000000/0000003000-0000000000.kv",
+		} {
+			stateStore.SetFile(file, []byte("{}"))
+		}
+		return stateStore
+	}
+
+	stateStore := newStateStore()
+	var printed []string
+	deleted, err := CompactSnapshots(context.Background(), stateStore, nil, 2000, true, func(filePath string) {
+		printed = append(printed, filePath)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, deleted)
+	assert.Equal(t, []string{
+		"abc/states/0000001000-0000000010.kv",
+		"abc/states/0000003000-0000000010.kv",
+		"de/def/states/0000000000/0000001000-0000000000.kv",
+	}, printed)
+	assert.Len(t, stateStore.Files, 9)
+
+	deleted, err = CompactSnapshots(context.Background(), stateStore, nil, 2000, false, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 3, deleted)
+	assert.Len(t, stateStore.Files, 6)
+	assert.Contains(t, stateStore.Files, "abc/states/0000005000-0000000010.kv", "the last snapshot is always kept")
+	assert.Contains(t, stateStore.Files, "abc/states/0000004000-0000003000.partial")
+
+	stateStore = newStateStore()
+	deleted, err = CompactSnapshots(context.Background(), stateStore, []string{"def"}, 2000, false, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+	assert.NotContains(t, stateStore.Files, "de/def/states/0000000000/0000001000-0000000000.kv")
+}
@@ -3,11 +3,14 @@ package store
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/streamingfast/derr"
 	"github.com/streamingfast/dstore"
 	"github.com/streamingfast/logging"
 	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
+	"github.com/streamingfast/substreams/storage/idempotency"
+	"github.com/streamingfast/substreams/storage/lineage"
 	"github.com/streamingfast/substreams/storage/store/marshaller"
 	"go.uber.org/zap"
 )
@@ -20,11 +23,24 @@ type Config struct {
 	moduleInitialBlock uint64
 	updatePolicy       pbsubstreams.Module_KindStore_UpdatePolicy
 	valueType          string
+	immutable          bool
+	marshaller         marshaller.Marshaller // nil for the default codec
+	ttlBlocks          uint64                // keys not updated in that many blocks are deleted, 0 keeps them forever
 
 	appendLimit    uint64
 	totalSizeLimit uint64
 	itemSizeLimit  uint64
 
+	spillDir       string // directory of the spill files, the default temporary directory when empty
+	spillThreshold uint64 // size of the entries held in memory above which they are spilled to disk, 0 disables spilling
+
+	fileCache *FileCache          // if set, serves the complete snapshots loaded by the full stores
+	seed      *storeSeed          // if set, the content of the full stores at the module's initial block, see SetSeed
+	commits   *Commits            // if set, the stores flushed together at a boundary are committed, see Commits
+	ledger    *idempotency.Ledger // if set, the snapshots already written are not written again, see idempotency.Ledger
+
+	lineageLinks map[string]lineage.Link // output compatibilities of the modules of the request, see SetLineageLinks
+
 	// traceID uniquely identifies the connection ID so that store can be
 	// written to unique filename preventing some races when multiple Substreams
 	// request works on the same range.
@@ -64,8 +80,70 @@ func (c *Config) newBaseStore(logger *zap.Logger) *baseStore {
 		Config:     c,
 		kv:         make(map[string][]byte),
 		logger:     logger.Named("store").With(zap.String("store_name", c.name), zap.String("module_hash", c.moduleHash)),
-		marshaller: marshaller.Default(),
+		marshaller: c.Marshaller(),
+	}
+}
+
+// SetCodec selects the format of the files written by the stores of this
+// config, see marshaller.ForCodec. Files are read whatever their codec.
+func (c *Config) SetCodec(codec string) error {
+	m, err := marshaller.ForCodec(codec)
+	if err != nil {
+		return err
+	}
+	c.marshaller = m
+	return nil
+}
+
+// SetSpill makes the stores of this config move their entries to a file in
+// `dir` whenever the ones held in memory exceed `thresholdBytes`, bounding the
+// memory used by very large stores. Only the keys stay in memory.
+func (c *Config) SetSpill(dir string, thresholdBytes uint64) {
+	c.spillDir = dir
+	c.spillThreshold = thresholdBytes
+}
+
+// SetFileCache makes the full stores of this config load their complete
+// snapshots through `cache`, shared with the other configs using it.
+func (c *Config) SetFileCache(cache *FileCache) {
+	c.fileCache = cache
+}
+
+// loadCompleteFile loads the complete snapshot `filename`, through the file
+// cache when one is set.
+func (c *Config) loadCompleteFile(ctx context.Context, filename string, decode func(data []byte) error) error {
+	if c.fileCache == nil {
+		return loadStore(ctx, c.objStore, filename, decode)
 	}
+	return c.fileCache.load(ctx, c.moduleHash+"/"+filename, decode, func(ctx context.Context, decode func(data []byte) error) error {
+		return loadStore(ctx, c.objStore, filename, decode)
+	})
+}
+
+// SetCommits makes the flushes of several stores of this config and others
+// at a boundary committed through `commits`, see Commits.
+func (c *Config) SetCommits(commits *Commits) {
+	c.commits = commits
+}
+
+// Commits returns the flush manifests of the state store, nil when the
+// flushes are not committed.
+func (c *Config) Commits() *Commits {
+	return c.commits
+}
+
+// SetIdempotencyLedger makes the snapshots of the stores of this config
+// checked against `ledger` before being written, see idempotency.Ledger.
+func (c *Config) SetIdempotencyLedger(ledger *idempotency.Ledger) {
+	c.ledger = ledger
+}
+
+// Marshaller returns the marshaller writing the files of the stores of this config.
+func (c *Config) Marshaller() marshaller.Marshaller {
+	if c.marshaller == nil {
+		return marshaller.Default()
+	}
+	return c.marshaller
 }
 
 func (c *Config) Name() string {
@@ -84,12 +162,23 @@ func (c *Config) UpdatePolicy() pbsubstreams.Module_KindStore_UpdatePolicy {
 	return c.updatePolicy
 }
 
+// Immutable tells if existing keys of the store can't be overwritten, see ImmutableKeyError.
+func (c *Config) Immutable() bool {
+	return c.immutable
+}
+
+// TTLBlocks returns the retention policy of the stores, keys not updated in
+// that many blocks are deleted from the snapshots. 0 keeps them forever.
+func (c *Config) TTLBlocks() uint64 {
+	return c.ttlBlocks
+}
+
 func (c *Config) ModuleInitialBlock() uint64 {
 	return c.moduleInitialBlock
 }
 
 func (c *Config) NewFullKV(logger *zap.Logger) *FullKV {
-	return &FullKV{c.newBaseStore(logger), "N/A"}
+	return &FullKV{baseStore: c.newBaseStore(logger), loadedFrom: "N/A"}
 }
 
 func (c *Config) NewPartialKV(initialBlock uint64, logger *zap.Logger) *PartialKV {
@@ -117,6 +206,10 @@ func (c *Config) FileSize(ctx context.Context, fileInfo *FileInfo) (int64, error
 	return size, nil
 }
 
+func (c *Config) FileExists(ctx context.Context, fileInfo *FileInfo) (bool, error) {
+	return c.objStore.FileExists(ctx, fileInfo.Filename)
+}
+
 func (c *Config) ListSnapshotFiles(ctx context.Context, below uint64) (files []*FileInfo, err error) {
 	if below == 0 {
 		return nil, nil
@@ -128,6 +221,9 @@ func (c *Config) ListSnapshotFiles(ctx context.Context, below uint64) (files []*
 		files = nil
 
 		return c.objStore.Walk(ctx, "", func(filename string) (err error) {
+			if strings.HasPrefix(filename, resumePointsDir) {
+				return nil // see ListResumePoints
+			}
 			fileInfo, ok := parseFileName(filename)
 			if !ok {
 				logger.Warn("seen snapshot file that we don't know how to parse", zap.String("filename", filename))
@@ -143,7 +239,7 @@ func (c *Config) ListSnapshotFiles(ctx context.Context, below uint64) (files []*
 		})
 	})
 	if err != nil {
-		return nil, fmt.Errorf("walking files: %s", err)
+		return nil, fmt.Errorf("walking files: %w", err)
 	}
 
 	return files, nil
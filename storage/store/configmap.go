@@ -6,6 +6,8 @@ import (
 	"github.com/streamingfast/dstore"
 	"github.com/streamingfast/substreams/manifest"
 	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
+	"github.com/streamingfast/substreams/storage/idempotency"
+	"github.com/streamingfast/substreams/storage/lineage"
 )
 
 type ConfigMap map[string]*Config
@@ -25,7 +27,58 @@ func NewConfigMap(baseObjectStore dstore.Store, storeModules []*pbsubstreams.Mod
 		if err != nil {
 			return nil, fmt.Errorf("new store config for %q: %w", storeModule.Name, err)
 		}
+		c.immutable = storeModule.GetKindStore().Immutable
+		c.ttlBlocks = storeModule.GetKindStore().TtlBlocks
+		c.SetSeed(storeModule.GetKindStore().Seed)
+		if err := c.SetCodec(storeModule.GetKindStore().Codec); err != nil {
+			return nil, fmt.Errorf("store config for %q: %w", storeModule.Name, err)
+		}
 		out[storeModule.Name] = c
 	}
 	return out, nil
 }
+
+// SetCommits makes the stores of the configs flushed together at a boundary
+// committed through `commits`, see Commits. A nil `commits` is ignored.
+func (m ConfigMap) SetCommits(commits *Commits) {
+	if commits == nil {
+		return
+	}
+	for _, config := range m {
+		config.SetCommits(commits)
+	}
+}
+
+// SetLineageLinks sets the output compatibilities declared by the modules of
+// the request on all the configs, see Config.SetLineageLinks.
+func (m ConfigMap) SetLineageLinks(links map[string]lineage.Link) {
+	for _, config := range m {
+		config.SetLineageLinks(links)
+	}
+}
+
+// Commits returns the flush manifests shared by the configs, nil when the
+// flushes are not committed.
+func (m ConfigMap) Commits() *Commits {
+	for _, config := range m {
+		if config.commits != nil {
+			return config.commits
+		}
+	}
+	return nil
+}
+
+// SetIdempotencyLedger makes the snapshots of the stores and the flush
+// manifests checked against `ledger` before being written, see
+// idempotency.Ledger. A nil ledger is ignored.
+func (m ConfigMap) SetIdempotencyLedger(ledger *idempotency.Ledger) {
+	if ledger == nil {
+		return
+	}
+	for _, config := range m {
+		config.SetIdempotencyLedger(ledger)
+		if config.commits != nil {
+			config.commits.ledger = ledger
+		}
+	}
+}
@@ -2,11 +2,20 @@ package store
 
 import (
 	"fmt"
+	"sort"
 
 	pbssinternal "github.com/streamingfast/substreams/pb/sf/substreams/intern/v2"
 )
 
 func (b *baseStore) ApplyDelta(delta *pbssinternal.StoreDelta) {
+	if delta.Operation == pbssinternal.StoreDelta_DELETE_RANGE {
+		for key, val := range delta.Deleted {
+			b.deleteKey(key)
+			b.totalSizeBytes -= uint64(len(key) + len(val))
+		}
+		return
+	}
+
 	// Keys need to have at least one character, and mustn't start with 0xFF is reserved for internal use.
 	if len(delta.Key) == 0 {
 		panic(fmt.Sprintf("key invalid, must be at least 1 character for module %q", b.name))
@@ -20,7 +29,7 @@ func (b *baseStore) ApplyDelta(delta *pbssinternal.StoreDelta) {
 	keySize := uint64(len(delta.Key))
 	switch delta.Operation {
 	case pbssinternal.StoreDelta_UPDATE:
-		b.kv[delta.Key] = delta.NewValue
+		b.setKey(delta.Key, delta.NewValue)
 		switch {
 		case newSize > oldSize:
 			b.totalSizeBytes += (newSize - oldSize)
@@ -29,12 +38,12 @@ func (b *baseStore) ApplyDelta(delta *pbssinternal.StoreDelta) {
 		}
 
 	case pbssinternal.StoreDelta_CREATE:
-		b.kv[delta.Key] = delta.NewValue
+		b.setKey(delta.Key, delta.NewValue)
 		b.totalSizeBytes += newSize
 		b.totalSizeBytes += keySize
 
 	case pbssinternal.StoreDelta_DELETE:
-		delete(b.kv, delta.Key)
+		b.deleteKey(delta.Key)
 		b.totalSizeBytes -= oldSize
 		b.totalSizeBytes -= keySize
 		return
@@ -54,7 +63,7 @@ func (b *baseStore) ApplyDeltasReverse(deltas []*pbssinternal.StoreDelta) {
 		keySize := uint64(len(delta.Key))
 		switch delta.Operation {
 		case pbssinternal.StoreDelta_UPDATE:
-			b.kv[delta.Key] = delta.OldValue
+			b.setKey(delta.Key, delta.OldValue)
 			switch {
 			case newSize > oldSize:
 				b.totalSizeBytes -= (newSize - oldSize)
@@ -63,17 +72,61 @@ func (b *baseStore) ApplyDeltasReverse(deltas []*pbssinternal.StoreDelta) {
 			}
 
 		case pbssinternal.StoreDelta_CREATE:
-			delete(b.kv, delta.Key)
+			b.deleteKey(delta.Key)
 			b.totalSizeBytes -= newSize
 			b.totalSizeBytes -= keySize
 
 		case pbssinternal.StoreDelta_DELETE:
-			b.kv[delta.Key] = delta.OldValue
+			b.setKey(delta.Key, delta.OldValue)
 			b.totalSizeBytes += oldSize
 			b.totalSizeBytes += keySize
-			return
+
+		case pbssinternal.StoreDelta_DELETE_RANGE:
+			for key, val := range delta.Deleted {
+				b.setKey(key, val)
+				b.totalSizeBytes += uint64(len(key) + len(val))
+			}
+		}
+	}
+}
+
+// ExpandDeltas replaces the DELETE_RANGE deltas by a DELETE delta for each of
+// the keys they deleted, in key order, for the consumers of the deltas knowing
+// only of per-key operations.
+func ExpandDeltas(deltas []*pbssinternal.StoreDelta) []*pbssinternal.StoreDelta {
+	expand := false
+	for _, delta := range deltas {
+		if delta.Operation == pbssinternal.StoreDelta_DELETE_RANGE {
+			expand = true
+			break
+		}
+	}
+	if !expand {
+		return deltas
+	}
+
+	out := make([]*pbssinternal.StoreDelta, 0, len(deltas))
+	for _, delta := range deltas {
+		if delta.Operation != pbssinternal.StoreDelta_DELETE_RANGE {
+			out = append(out, delta)
+			continue
+		}
+
+		keys := make([]string, 0, len(delta.Deleted))
+		for key := range delta.Deleted {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			out = append(out, &pbssinternal.StoreDelta{
+				Operation: pbssinternal.StoreDelta_DELETE,
+				Ordinal:   delta.Ordinal,
+				Key:       key,
+				OldValue:  delta.Deleted[key],
+			})
 		}
 	}
+	return out
 }
 
 func (b *baseStore) GetDeltas() []*pbssinternal.StoreDelta {
@@ -129,3 +129,69 @@ func Test_baseStore_SetDeltas(t *testing.T) {
 	assert.Equal(t, uint64(4), s.totalSizeBytes)
 	assert.Len(t, s.deltas, 4)
 }
+
+func Test_baseStore_DeleteRange(t *testing.T) {
+	s := &baseStore{
+		Config:         baseStoreConfig,
+		kv:             map[string][]byte{"a": []byte("1"), "b:1": []byte("2"), "b:2": []byte("3"), "c": []byte("4")},
+		totalSizeBytes: 12,
+	}
+	s.DeleteRange(1, "b", "c")
+
+	assert.Equal(t, map[string][]byte{"a": []byte("1"), "c": []byte("4")}, s.kv)
+	assert.Equal(t, uint64(4), s.totalSizeBytes)
+	assert.Len(t, s.deltas, 1)
+	assert.Equal(t, pbssinternal.StoreDelta_DELETE_RANGE, s.deltas[0].Operation)
+
+	_, found := s.GetLast("b:1")
+	assert.False(t, found)
+	_, found = s.GetAt(0, "b:1")
+	assert.True(t, found)
+
+	s.ApplyDeltasReverse(s.deltas)
+	assert.Equal(t, map[string][]byte{"a": []byte("1"), "b:1": []byte("2"), "b:2": []byte("3"), "c": []byte("4")}, s.kv)
+	assert.Equal(t, uint64(12), s.totalSizeBytes)
+}
+
+func Test_baseStore_ApplyDeltasReverse_DeleteRange(t *testing.T) {
+	initialKV := map[string][]byte{"a": []byte("1"), "b:1": []byte("2"), "b:2": []byte("3"), "c": []byte("4")}
+	s := &baseStore{
+		Config:         &Config{totalSizeLimit: 9999, itemSizeLimit: 9999},
+		kv:             map[string][]byte{},
+		totalSizeBytes: 12,
+	}
+	for k, v := range initialKV {
+		s.kv[k] = v
+	}
+
+	s.Set(1, "b:3", "5")
+	s.DeleteRange(2, "b", "c")
+	s.DeletePrefix(3, "a")
+	s.DeleteRange(4, "x", "z")
+	s.Set(5, "b:1", "6")
+	assert.Equal(t, map[string][]byte{"b:1": []byte("6"), "c": []byte("4")}, s.kv)
+	assert.Len(t, s.deltas, 4, "the empty range records no delta")
+
+	s.ApplyDeltasReverse(s.deltas)
+	assert.Equal(t, initialKV, s.kv)
+	assert.Equal(t, uint64(12), s.totalSizeBytes)
+}
+
+func TestExpandDeltas(t *testing.T) {
+	create := &pbssinternal.StoreDelta{Operation: pbssinternal.StoreDelta_CREATE, Ordinal: 1, Key: "a", NewValue: []byte("1")}
+	deltas := []*pbssinternal.StoreDelta{create}
+	assert.Equal(t, deltas, ExpandDeltas(deltas))
+
+	deltas = append(deltas, &pbssinternal.StoreDelta{
+		Operation: pbssinternal.StoreDelta_DELETE_RANGE,
+		Ordinal:   2,
+		Key:       "b",
+		EndKey:    "c",
+		Deleted:   map[string][]byte{"b:2": []byte("3"), "b:1": []byte("2")},
+	})
+	assert.Equal(t, []*pbssinternal.StoreDelta{
+		create,
+		{Operation: pbssinternal.StoreDelta_DELETE, Ordinal: 2, Key: "b:1", OldValue: []byte("2")},
+		{Operation: pbssinternal.StoreDelta_DELETE, Ordinal: 2, Key: "b:2", OldValue: []byte("3")},
+	}, ExpandDeltas(deltas))
+}
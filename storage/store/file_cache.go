@@ -0,0 +1,115 @@
+package store
+
+import (
+	"container/list"
+	"context"
+	"sync"
+
+	"github.com/streamingfast/substreams/metrics"
+)
+
+// FileCache keeps the content of the most recently loaded complete store
+// snapshots, shared by the jobs running on a tier2 instance: consecutive jobs
+// depending on the same upstream store load the same snapshot, and only the
+// first one downloads it from the state store.
+//
+// Entries are keyed by module hash and file name, that is by range. A cached
+// snapshot that fails to decode, read while it was being rewritten for
+// example, is evicted and downloaded again.
+type FileCache struct {
+	mu       sync.Mutex
+	maxBytes uint64
+	bytes    uint64
+	entries  map[string]*list.Element
+	lru      *list.List
+}
+
+type fileCacheEntry struct {
+	key  string
+	data []byte
+}
+
+// NewFileCache creates a cache holding up to `maxBytes` of snapshots.
+func NewFileCache(maxBytes uint64) *FileCache {
+	return &FileCache{
+		maxBytes: maxBytes,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+func (c *FileCache) get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, found := c.entries[key]
+	if !found {
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+	return el.Value.(*fileCacheEntry).data, true
+}
+
+func (c *FileCache) add(key string, data []byte) {
+	if uint64(len(data)) > c.maxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, found := c.entries[key]; found {
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(&fileCacheEntry{key: key, data: data})
+	c.bytes += uint64(len(data))
+	for c.bytes > c.maxBytes {
+		c.removeElement(c.lru.Back())
+	}
+}
+
+func (c *FileCache) evict(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, found := c.entries[key]; found {
+		c.removeElement(el)
+	}
+}
+
+// removeElement must be called with the lock held
+func (c *FileCache) removeElement(el *list.Element) {
+	entry := c.lru.Remove(el).(*fileCacheEntry)
+	delete(c.entries, entry.key)
+	c.bytes -= uint64(len(entry.data))
+}
+
+// load decodes the content of the snapshot `key` from the cache, or fetched
+// with `fetch` and cached once decoded. The decoded stores may reference the
+// cached content, it must never be modified.
+func (c *FileCache) load(ctx context.Context, key string, decode func(data []byte) error, fetch func(ctx context.Context, decode func(data []byte) error) error) error {
+	if data, found := c.get(key); found {
+		if err := decode(data); err == nil {
+			metrics.StoreFileCacheRequests.Inc("hit")
+			return nil
+		}
+		metrics.StoreFileCacheRequests.Inc("invalid")
+		c.evict(key)
+	}
+
+	metrics.StoreFileCacheRequests.Inc("miss")
+	var fetched []byte
+	err := fetch(ctx, func(data []byte) error {
+		if err := decode(data); err != nil {
+			return err
+		}
+		fetched = data
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	c.add(key, fetched)
+	return nil
+}
@@ -0,0 +1,52 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileCache_Load(t *testing.T) {
+	ctx := context.Background()
+	cache := NewFileCache(10)
+
+	files := map[string][]byte{"a": []byte("aaaa"), "b": []byte("bbbb"), "c": []byte("cccc")}
+	var fetched []string
+	fetch := func(key string) func(ctx context.Context, decode func(data []byte) error) error {
+		return func(ctx context.Context, decode func(data []byte) error) error {
+			fetched = append(fetched, key)
+			return decode(files[key])
+		}
+	}
+	load := func(key string) string {
+		var out string
+		require.NoError(t, cache.load(ctx, key, func(data []byte) error {
+			if string(data) == "bad" {
+				return fmt.Errorf("cannot decode")
+			}
+			out = string(data)
+			return nil
+		}, fetch(key)))
+		return out
+	}
+
+	assert.Equal(t, "aaaa", load("a"))
+	assert.Equal(t, "bbbb", load("b"))
+	assert.Equal(t, "aaaa", load("a"))
+	assert.Equal(t, []string{"a", "b"}, fetched)
+
+	// "b", the least recently used, is evicted to make room for "c"
+	assert.Equal(t, "cccc", load("c"))
+	assert.Equal(t, "bbbb", load("b"))
+	assert.Equal(t, []string{"a", "b", "c", "b"}, fetched)
+	assert.LessOrEqual(t, cache.bytes, uint64(10))
+
+	// cached content failing to decode is fetched again
+	cache.evict("c")
+	cache.add("c", []byte("bad"))
+	assert.Equal(t, "cccc", load("c"))
+	assert.Equal(t, []string{"a", "b", "c", "b", "c"}, fetched)
+}
@@ -3,7 +3,6 @@ package store
 import (
 	"fmt"
 	"regexp"
-	"strconv"
 	"strings"
 
 	"github.com/streamingfast/substreams/block"
@@ -34,11 +33,20 @@ func (f FileInfos) String() string {
 	return strings.Join(ranges, ",")
 }
 
+// Size is the total size of the files, see FileInfo.Size.
+func (f FileInfos) Size() (out uint64) {
+	for _, file := range f {
+		out += file.Size
+	}
+	return
+}
+
 type FileInfo struct {
 	Filename string
 	Range    *block.Range
 	TraceID  string
 	Partial  bool
+	Size     uint64 // in bytes, of the written file, 0 when unknown (ex: files listed from the store)
 }
 
 func NewCompleteFileInfo(moduleInitialBlock uint64, exlusiveEnd uint64) *FileInfo {
@@ -68,9 +76,14 @@ func parseFileName(filename string) (*FileInfo, bool) {
 		return nil, false
 	}
 
+	blockRange, err := block.NewRangeFromString(res[0][2] + "-" + res[0][1])
+	if err != nil {
+		return nil, false
+	}
+
 	return &FileInfo{
 		Filename: filename,
-		Range:    block.NewRange(uint64(mustAtoi(res[0][2])), uint64(mustAtoi(res[0][1]))),
+		Range:    blockRange,
 		TraceID:  res[0][3],
 		Partial:  res[0][4] == "partial",
 	}, true
@@ -110,10 +123,15 @@ func fileFromRange(kind string, in string, params ...FileInfoParam) *FileInfo {
 }
 
 func fileFromRanges(kind string, in string, params ...FileInfoParam) FileInfos {
-	ranges := block.ParseRanges(in)
-
-	files := make([]*FileInfo, len(ranges))
-	for i, blockRange := range ranges {
+	files := FileInfos{}
+	for _, e := range strings.Split(in, ",") {
+		if strings.TrimSpace(e) == "" {
+			continue
+		}
+		blockRange, err := block.NewRangeFromString(e) // overlapping files are allowed
+		if err != nil {
+			panic(err)
+		}
 		file := &FileInfo{
 			Range:   blockRange,
 			Partial: kind == "partial",
@@ -124,7 +142,7 @@ func fileFromRanges(kind string, in string, params ...FileInfoParam) FileInfos {
 		}
 
 		file.Filename = PartialFileName(blockRange, file.TraceID)
-		files[i] = file
+		files = append(files, file)
 	}
 
 	return files
@@ -152,11 +170,3 @@ func PartialFileName(r *block.Range, traceID string) string {
 func FullStateFileName(r *block.Range) string {
 	return fmt.Sprintf("%010d-%010d.kv", r.ExclusiveEndBlock, r.StartBlock)
 }
-
-func mustAtoi(s string) int {
-	i, err := strconv.Atoi(s)
-	if err != nil {
-		panic(err)
-	}
-	return i
-}
@@ -33,6 +33,12 @@ func Test_parseFileName(t *testing.T) {
 			&FileInfo{Filename: "0000000100-0000000000.kv", Range: block.NewRange(0, 100), TraceID: "", Partial: false},
 			true,
 		},
+		{
+			"reversed",
+			fmt.Sprintf("%010d-%010d.kv", 0, 100),
+			nil,
+			false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -1,9 +1,11 @@
 package store
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 
+	"github.com/streamingfast/substreams/block"
 	"github.com/streamingfast/substreams/storage/store/marshaller"
 	"go.uber.org/zap"
 )
@@ -13,7 +15,8 @@ var _ Store = (*FullKV)(nil)
 type FullKV struct {
 	*baseStore
 
-	loadedFrom string
+	loadedFrom     string
+	loadedEndBlock uint64
 }
 
 func (s *FullKV) Marshaller() marshaller.Marshaller {
@@ -25,7 +28,7 @@ func (s *FullKV) DerivePartialStore(initialBlock uint64) *PartialKV {
 		Config:     s.Config,
 		kv:         make(map[string][]byte),
 		logger:     s.logger,
-		marshaller: marshaller.Default(),
+		marshaller: s.Config.Marshaller(),
 	}
 	return &PartialKV{
 		baseStore:    b,
@@ -38,23 +41,26 @@ func (s *FullKV) Load(ctx context.Context, file *FileInfo) error {
 	s.loadedFrom = file.Filename
 	s.logger.Debug("loading full store state from file", zap.String("fileName", file.Filename))
 
-	data, err := loadStore(ctx, s.objStore, file.Filename)
+	var storeData *marshaller.StoreData
+	var size uint64
+	err := s.loadCompleteFile(ctx, file.Filename, func(content []byte) (err error) {
+		storeData, size, err = s.marshaller.Unmarshal(content)
+		if err != nil {
+			return fmt.Errorf("unmarshal store: %w", err)
+		}
+		return nil
+	})
 	if err != nil {
 		return fmt.Errorf("load full store %s at %s: %w", s.name, file.Filename, err)
 	}
 
-	storeData, size, err := s.marshaller.Unmarshal(data)
-	if err != nil {
-		return fmt.Errorf("unmarshal store: %w", err)
-	}
-
-	s.kv = storeData.Kv
+	s.resetKeys(storeData.Kv)
 	s.totalSizeBytes = size
-	if s.kv == nil {
-		s.kv = make(map[string][]byte)
-	}
+	s.lineage = storeData.Lineage
+	s.loadUpdatedKeys(storeData.UpdatedKeys)
+	s.loadedEndBlock = file.Range.ExclusiveEndBlock
 
-	s.logger.Debug("full store loaded", zap.String("fileName", file.Filename), zap.Int("key_count", len(s.kv)), zap.Uint64("data_size", size))
+	s.logger.Debug("full store loaded", zap.String("fileName", file.Filename), zap.Int("key_count", s.keyCount()), zap.Uint64("data_size", size))
 	return nil
 }
 
@@ -65,10 +71,11 @@ func (s *FullKV) Save(endBoundaryBlock uint64) (*FileInfo, *fileWriter, error) {
 	s.logger.Debug("writing full store state", zap.Object("store", s))
 
 	stateData := &marshaller.StoreData{
-		Kv: s.kv,
+		Lineage:     s.newLineage(s.moduleInitialBlock, endBoundaryBlock),
+		UpdatedKeys: s.updatedKeys(),
 	}
 
-	content, err := s.marshaller.Marshal(stateData)
+	content, err := s.marshal(stateData)
 	if err != nil {
 		return nil, nil, fmt.Errorf("marshal kv state: %w", err)
 	}
@@ -83,20 +90,59 @@ func (s *FullKV) Save(endBoundaryBlock uint64) (*FileInfo, *fileWriter, error) {
 	fw := &fileWriter{
 		store:    s.objStore,
 		filename: file.Filename,
-		content:  content,
+		ledger:   s.ledger,
+		traceID:  s.traceID,
+		content:  encodeStateFile(content),
 	}
 
 	return file, fw, nil
 }
 
+// marshal encodes `stateData` with the entries of the store, the spilled
+// values being read one at a time when the marshaller streams them.
+func (s *FullKV) marshal(stateData *marshaller.StoreData) ([]byte, error) {
+	if streamer, ok := s.marshaller.(marshaller.StreamMarshaller); ok {
+		entries := s.streamEntries()
+		defer entries.release()
+		stateData.Entries = entries
+
+		buf := bytes.NewBuffer(nil)
+		if err := streamer.MarshalTo(buf, stateData); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	kv, err := s.entries()
+	if err != nil {
+		return nil, fmt.Errorf("reading store entries: %w", err)
+	}
+	stateData.Kv = kv
+	return s.marshaller.Marshal(stateData)
+}
+
 func (s *FullKV) Reset() {
 	if tracer.Enabled() {
-		s.logger.Debug("flushing store", zap.Int("delta_count", len(s.deltas)), zap.Int("entry_count", len(s.kv)))
+		s.logger.Debug("flushing store", zap.Int("delta_count", len(s.deltas)), zap.Int("entry_count", s.keyCount()))
 	}
 	s.deltas = nil
 	s.lastOrdinal = 0
 }
 
 func (s *FullKV) String() string {
-	return fmt.Sprintf("fullKV name %s moduleInitialBlock %d  keyCount %d loadFrom %s deltasCount %d", s.Name(), s.moduleInitialBlock, len(s.kv), s.loadedFrom, len(s.deltas))
+	return fmt.Sprintf("fullKV name %s moduleInitialBlock %d  keyCount %d loadFrom %s deltasCount %d", s.Name(), s.moduleInitialBlock, s.keyCount(), s.loadedFrom, len(s.deltas))
+}
+
+// ShouldSaveFullKV tells if a full KV file needs to be written once the partial
+// covering `squashableRange` has been merged into a full store.
+func ShouldSaveFullKV(storeInitialBlock, storeSaveInterval uint64, squashableRange *block.Range) bool {
+	// we check if the squashableRange we just merged into our FullKV store, ends on a storeInterval boundary block
+
+	// squashable range must end on a store boundary block
+	isSaveIntervalReached := squashableRange.ExclusiveEndBlock%storeSaveInterval == 0
+	// we expect the range to be equal to the store save interval, except if the range start block
+	// is the same as the store initial block
+	isFirstKvForModule := isSaveIntervalReached && squashableRange.StartBlock == storeInitialBlock
+	isCompletedKv := isSaveIntervalReached && squashableRange.Len()-storeSaveInterval == 0
+	return isFirstKvForModule || isCompletedKv
 }
@@ -69,6 +69,7 @@ type Named interface {
 
 type Iterable interface {
 	Length() uint64
+	SizeBytes() uint64 // of the keys and values
 	Iter(func(key string, value []byte) error) error
 }
 
@@ -114,8 +115,8 @@ type Appender interface {
 
 type Deleter interface {
 	DeletePrefix(ord uint64, prefix string)
-	//// Deletes a range of keys, lexicographically between `lowKey` and `highKey`
-	//DeleteRange(lowKey, highKey string)
+	// DeleteRange deletes the keys lexicographically from `startKey` (inclusive) to `endKey` (exclusive)
+	DeleteRange(ord uint64, startKey, endKey string)
 	//// Deletes a range of keys, first considering the _value_ of such keys as a _pointerSeparator_-separated list of keys to _also_ delete.
 	//DeleteRangePointers(lowKey, highKey, pointerSeparator string)
 }
@@ -0,0 +1,183 @@
+package store
+
+import (
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// keyIndexBlockSize is the number of keys held by a block of the key index
+// before it is split in two.
+const keyIndexBlockSize = 512
+
+// keyIndex keeps the keys of a store in order, for the prefix and range
+// deletions to visit the matching keys only instead of the whole kv map. The
+// keys are held in sorted blocks of at most keyIndexBlockSize keys, so that
+// inserting or deleting a key moves a single block around.
+type keyIndex struct {
+	blocks [][]string // sorted, and sorted between them
+}
+
+func newKeyIndex(keys []string) *keyIndex {
+	sort.Strings(keys)
+
+	idx := &keyIndex{}
+	for len(keys) > 0 {
+		size := keyIndexBlockSize / 2
+		if size > len(keys) {
+			size = len(keys)
+		}
+		idx.blocks = append(idx.blocks, append(make([]string, 0, keyIndexBlockSize), keys[:size]...))
+		keys = keys[size:]
+	}
+	return idx
+}
+
+// blockFor returns the index of the block that holds, or would hold, `key`.
+func (idx *keyIndex) blockFor(key string) int {
+	i := sort.Search(len(idx.blocks), func(i int) bool { return idx.blocks[i][0] > key })
+	if i > 0 {
+		i--
+	}
+	return i
+}
+
+// insert adds `key`, which must not be in the index already.
+func (idx *keyIndex) insert(key string) {
+	if len(idx.blocks) == 0 {
+		idx.blocks = [][]string{append(make([]string, 0, keyIndexBlockSize), key)}
+		return
+	}
+
+	bi := idx.blockFor(key)
+	block := idx.blocks[bi]
+	i := sort.SearchStrings(block, key)
+	block = append(block, "")
+	copy(block[i+1:], block[i:])
+	block[i] = key
+
+	if len(block) <= keyIndexBlockSize {
+		idx.blocks[bi] = block
+		return
+	}
+
+	half := len(block) / 2
+	second := append(make([]string, 0, keyIndexBlockSize), block[half:]...)
+	idx.blocks[bi] = block[:half:half]
+	idx.blocks = append(idx.blocks, nil)
+	copy(idx.blocks[bi+2:], idx.blocks[bi+1:])
+	idx.blocks[bi+1] = second
+}
+
+func (idx *keyIndex) delete(key string) {
+	if len(idx.blocks) == 0 {
+		return
+	}
+
+	bi := idx.blockFor(key)
+	block := idx.blocks[bi]
+	i := sort.SearchStrings(block, key)
+	if i == len(block) || block[i] != key {
+		return
+	}
+
+	if len(block) == 1 {
+		idx.blocks = append(idx.blocks[:bi], idx.blocks[bi+1:]...)
+		return
+	}
+	idx.blocks[bi] = append(block[:i], block[i+1:]...)
+}
+
+// rangeKeys returns the keys from `startKey` (inclusive) to `endKey`
+// (exclusive), in order.
+func (idx *keyIndex) rangeKeys(startKey, endKey string) (out []string) {
+	for bi := idx.blockFor(startKey); bi < len(idx.blocks); bi++ {
+		block := idx.blocks[bi]
+		for _, key := range block[sort.SearchStrings(block, startKey):] {
+			if key >= endKey {
+				return out
+			}
+			out = append(out, key)
+		}
+	}
+	return out
+}
+
+// prefixKeys returns the keys starting with `prefix`, in order.
+func (idx *keyIndex) prefixKeys(prefix string) (out []string) {
+	for bi := idx.blockFor(prefix); bi < len(idx.blocks); bi++ {
+		block := idx.blocks[bi]
+		for _, key := range block[sort.SearchStrings(block, prefix):] {
+			if !strings.HasPrefix(key, prefix) {
+				return out
+			}
+			out = append(out, key)
+		}
+	}
+	return out
+}
+
+// keys returns the index of the store keys, built on first use and then
+// maintained by setKey and deleteKey. It is dropped when the kv map is
+// replaced, see resetKeys.
+func (b *baseStore) keys() *keyIndex {
+	if b.keyIndex == nil {
+		b.keyIndex = newKeyIndex(b.allKeys())
+	}
+	return b.keyIndex
+}
+
+// setKey sets the value of `key` in the kv map, the size accounting being
+// left to the caller.
+func (b *baseStore) setKey(key string, value []byte) {
+	prev, inMemory := b.kv[key]
+	switch {
+	case inMemory:
+		b.memBytes -= uint64(len(prev))
+	case b.spill != nil && b.spill.has(key):
+		b.spill.drop(key)
+		b.memBytes += uint64(len(key))
+	default:
+		if b.keyIndex != nil {
+			b.keyIndex.insert(key)
+		}
+		b.memBytes += uint64(len(key))
+	}
+	b.kv[key] = value
+	b.memBytes += uint64(len(value))
+	b.maybeSpill()
+}
+
+// deleteKey deletes `key` from the kv map, the size accounting being left to
+// the caller.
+func (b *baseStore) deleteKey(key string) {
+	if value, found := b.kv[key]; found {
+		b.memBytes -= uint64(len(key) + len(value))
+		delete(b.kv, key)
+	} else if b.spill != nil && b.spill.has(key) {
+		b.spill.drop(key)
+	} else {
+		return
+	}
+	if b.keyIndex != nil {
+		b.keyIndex.delete(key)
+	}
+}
+
+// resetKeys replaces the kv map, the index being rebuilt on next use.
+func (b *baseStore) resetKeys(kv map[string][]byte) {
+	if kv == nil {
+		kv = make(map[string][]byte)
+	}
+	if err := b.Close(); err != nil {
+		b.logger.Warn("closing store spill file", zap.Error(err))
+	}
+	b.kv = kv
+	b.keyIndex = nil
+	b.memBytes = 0
+	for key, value := range kv {
+		b.memBytes += uint64(len(key) + len(value))
+	}
+	b.maybeSpill()
+}
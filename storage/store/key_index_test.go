@@ -0,0 +1,91 @@
+package store
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
+)
+
+func TestKeyIndex(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	kv := map[string][]byte{}
+	for i := 0; i < 3000; i++ {
+		kv[fmt.Sprintf("k:%d:%d", random.Intn(20), random.Intn(1000))] = nil
+	}
+	var keys []string
+	for key := range kv {
+		keys = append(keys, key)
+	}
+	idx := newKeyIndex(keys)
+
+	for i := 0; i < 5000; i++ {
+		key := fmt.Sprintf("k:%d:%d", random.Intn(20), random.Intn(1000))
+		if _, found := kv[key]; found {
+			idx.delete(key)
+			delete(kv, key)
+		} else {
+			idx.insert(key)
+			kv[key] = nil
+		}
+	}
+
+	sorted := make([]string, 0, len(kv))
+	for key := range kv {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+
+	assert.Equal(t, sorted, idx.rangeKeys("", "\xff"))
+	for _, block := range idx.blocks {
+		assert.LessOrEqual(t, len(block), keyIndexBlockSize)
+	}
+
+	var withPrefix, inRange []string
+	for _, key := range sorted {
+		if strings.HasPrefix(key, "k:1:") {
+			withPrefix = append(withPrefix, key)
+		}
+		if key >= "k:12:5" && key < "k:3" {
+			inRange = append(inRange, key)
+		}
+	}
+	assert.Equal(t, withPrefix, idx.prefixKeys("k:1:"))
+	assert.Equal(t, inRange, idx.rangeKeys("k:12:5", "k:3"))
+	assert.Empty(t, idx.prefixKeys("z"))
+}
+
+func TestBaseStore_KeyIndexMaintained(t *testing.T) {
+	config := &Config{
+		updatePolicy:   pbsubstreams.Module_KindStore_UPDATE_POLICY_SET,
+		valueType:      "string",
+		totalSizeLimit: 1_000_000,
+		itemSizeLimit:  1_000,
+	}
+	s := config.NewFullKV(zap.NewNop())
+
+	s.Set(0, "a:1", "1")
+	s.Set(1, "b:1", "2")
+	s.DeletePrefix(2, "c:") // builds the index
+	require.NotNil(t, s.keyIndex)
+
+	s.Set(3, "a:2", "3")
+	s.Set(4, "a:3", "4")
+	s.DeletePrefix(5, "a:")
+	assert.Equal(t, map[string][]byte{"b:1": []byte("2")}, s.kv)
+
+	s.ApplyDeltasReverse(s.GetDeltas())
+	assert.Empty(t, s.kv)
+	assert.Empty(t, s.keyIndex.rangeKeys("", "\xff"))
+
+	s.resetKeys(map[string][]byte{"d:1": []byte("5"), "d:2": []byte("6")})
+	s.DeleteRange(6, "d:1", "d:2")
+	assert.Equal(t, map[string][]byte{"d:2": []byte("6")}, s.kv)
+}
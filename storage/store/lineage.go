@@ -0,0 +1,93 @@
+package store
+
+import (
+	"fmt"
+
+	"github.com/streamingfast/substreams/storage/lineage"
+	pbstore "github.com/streamingfast/substreams/storage/store/marshaller/pb"
+)
+
+// SetLineageInputs records the input stores snapshots this store is derived
+// from, they are written in the lineage of the files it saves.
+func (b *baseStore) SetLineageInputs(inputs []*pbstore.InputSnapshot) {
+	b.lineageInputs = inputs
+}
+
+// SetLineageLinks sets the output compatibilities declared by the modules of
+// the request, by their own hash, see lineage.Links. An input store derived
+// from a compatible module is accepted in place of that module, up to the
+// block of the link, when verifying the lineage of the merged partials.
+func (c *Config) SetLineageLinks(links map[string]lineage.Link) {
+	c.lineageLinks = links
+}
+
+// Lineage returns the lineage of the file this store was loaded from, or of the
+// last partial merged into it. It is nil when unknown, for files written before
+// lineage was recorded.
+func (b *baseStore) Lineage() *pbstore.Lineage {
+	return b.lineage
+}
+
+func (b *baseStore) newLineage(startBlock, endBlock uint64) *pbstore.Lineage {
+	return &pbstore.Lineage{
+		ModuleHash: b.moduleHash,
+		StartBlock: startBlock,
+		EndBlock:   endBlock,
+		Inputs:     b.lineageInputs,
+	}
+}
+
+// InputSnapshot describes the snapshot this store was loaded from, to be recorded
+// in the lineage of the stores derived from it.
+func (s *FullKV) InputSnapshot() *pbstore.InputSnapshot {
+	return &pbstore.InputSnapshot{
+		ModuleName: s.name,
+		ModuleHash: s.moduleHash,
+		EndBlock:   s.loadedEndBlock,
+	}
+}
+
+// verifyLineage checks that `partial` continues the lineage of `b`. Both sides
+// must have been produced for the same module hash, from input stores with the
+// same module hashes, and the partial must start where `b` ends. An input
+// store of the partial may also be a module declaring an output compatibility
+// with the input store of `b`, when `b` ends at or before the block of the
+// link: that is the case of a snapshot of a compatible module reused, whose
+// lineage holds the input stores of that module (see package `lineage`).
+// Stores without lineage (written by older versions) are not verified.
+func (b *baseStore) verifyLineage(partial *PartialKV) error {
+	next := partial.lineage
+	if next == nil {
+		return nil
+	}
+
+	if next.ModuleHash != b.moduleHash {
+		return fmt.Errorf("partial store was produced for module hash %q, expected %q", next.ModuleHash, b.moduleHash)
+	}
+	if next.StartBlock != partial.initialBlock {
+		return fmt.Errorf("partial store lineage starts at block %d, but its file starts at block %d", next.StartBlock, partial.initialBlock)
+	}
+
+	prev := b.lineage
+	if prev == nil {
+		return nil
+	}
+	if prev.EndBlock != next.StartBlock {
+		return fmt.Errorf("lineage discontinuity: store ends at block %d, partial starts at block %d", prev.EndBlock, next.StartBlock)
+	}
+
+	prevInputs := make(map[string]string, len(prev.Inputs))
+	for _, input := range prev.Inputs {
+		prevInputs[input.ModuleName] = input.ModuleHash
+	}
+	for _, input := range next.Inputs {
+		hash, found := prevInputs[input.ModuleName]
+		if !found || hash == input.ModuleHash {
+			continue
+		}
+		if link, linked := b.lineageLinks[input.ModuleHash]; !linked || link.ModuleHash != hash || prev.EndBlock > link.UntilBlock {
+			return fmt.Errorf("incompatible input store %q: partial was derived from module hash %q, previous one from %q", input.ModuleName, input.ModuleHash, hash)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	"github.com/streamingfast/dstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/streamingfast/substreams/manifest"
+	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
+	"github.com/streamingfast/substreams/storage/lineage"
+	pbstore "github.com/streamingfast/substreams/storage/store/marshaller/pb"
+)
+
+func TestStore_MergeVerifiesLineage(t *testing.T) {
+	inputs := func(hash string) []*pbstore.InputSnapshot {
+		return []*pbstore.InputSnapshot{{ModuleName: "store_a", ModuleHash: hash}}
+	}
+	lineageOf := func(moduleHash string, start, end uint64, inputsHash string) *pbstore.Lineage {
+		return &pbstore.Lineage{ModuleHash: moduleHash, StartBlock: start, EndBlock: end, Inputs: inputs(inputsHash)}
+	}
+
+	tests := []struct {
+		name          string
+		prev          *pbstore.Lineage
+		next          *pbstore.Lineage
+		nextStart     uint64
+		expectedError string
+	}{
+		{"no lineage", nil, nil, 100, ""},
+		{"first partial", nil, lineageOf("abc", 100, 200, "a1"), 100, ""},
+		{"continuous", lineageOf("abc", 0, 100, "a1"), lineageOf("abc", 100, 200, "a1"), 100, ""},
+		{"older partial without lineage", lineageOf("abc", 0, 100, "a1"), nil, 100, ""},
+		{"other module hash", nil, lineageOf("def", 100, 200, "a1"), 100, `partial store was produced for module hash "def", expected "abc"`},
+		{"lineage not matching file", nil, lineageOf("abc", 0, 200, "a1"), 100, "partial store lineage starts at block 0, but its file starts at block 100"},
+		{"discontinuity", lineageOf("abc", 0, 100, "a1"), lineageOf("abc", 150, 200, "a1"), 150, "lineage discontinuity: store ends at block 100, partial starts at block 150"},
+		{"incompatible inputs", lineageOf("abc", 0, 100, "a1"), lineageOf("abc", 100, 200, "a2"), 100, `incompatible input store "store_a"`},
+		{"compatible inputs", lineageOf("old", 0, 100, "a1"), lineageOf("abc", 100, 200, "a3"), 100, ""},
+		{"compatible inputs beyond the link", lineageOf("old", 0, 150, "a1"), lineageOf("abc", 150, 200, "a3"), 150, `incompatible input store "store_a"`},
+		{"compatible with other inputs", lineageOf("old", 0, 100, "a2"), lineageOf("abc", 100, 200, "a3"), 100, `incompatible input store "store_a"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			full := newStore(map[string][]byte{}, pbsubstreams.Module_KindStore_UPDATE_POLICY_SET, manifest.OutputValueTypeString)
+			full.moduleHash = "abc"
+			full.SetLineageLinks(map[string]lineage.Link{"a3": {ModuleHash: "a1", UntilBlock: 100}})
+			full.lineage = test.prev
+
+			partial := newPartialStore(map[string][]byte{}, pbsubstreams.Module_KindStore_UPDATE_POLICY_SET, manifest.OutputValueTypeString, nil)
+			partial.initialBlock = test.nextStart
+			partial.lineage = test.next
+
+			err := full.Merge(partial)
+			if test.expectedError != "" {
+				assert.ErrorContains(t, err, test.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			if test.next == nil {
+				assert.Nil(t, full.Lineage())
+				return
+			}
+			assert.Equal(t, test.next.EndBlock, full.Lineage().EndBlock)
+			assert.Equal(t, test.next.Inputs, full.Lineage().Inputs)
+		})
+	}
+}
+
+func TestStore_SquashAcrossLineageLink(t *testing.T) {
+	ctx := context.Background()
+	base, err := dstore.NewStore("file://"+t.TempDir(), "", "", false)
+	require.NoError(t, err)
+
+	newConfig := func(moduleHash string, stateStore dstore.Store) *Config {
+		config, err := NewConfig("store_b", 0, moduleHash, pbsubstreams.Module_KindStore_UPDATE_POLICY_SET, manifest.OutputValueTypeString, stateStore, "trace")
+		require.NoError(t, err)
+		return config
+	}
+	inputs := func(hash string) []*pbstore.InputSnapshot {
+		return []*pbstore.InputSnapshot{{ModuleName: "store_a", ModuleHash: hash}}
+	}
+
+	// the complete snapshot of the compatible module, derived from the
+	// compatible revision of its input store
+	old := newConfig("old", base).NewFullKV(zap.NewNop())
+	old.SetLineageInputs(inputs("a1"))
+	old.Set(0, "key", "old")
+	_, writer, err := old.Save(100)
+	require.NoError(t, err)
+	require.NoError(t, writer.Write(ctx))
+
+	// both store_b and its input store_a are new compatible revisions
+	links := map[string]lineage.Link{
+		"new": {ModuleHash: "old", UntilBlock: 100},
+		"a2":  {ModuleHash: "a1", UntilBlock: 100},
+	}
+	config := newConfig("new", lineage.NewStore(base, links))
+	partial := config.NewPartialKV(100, zap.NewNop())
+	partial.SetLineageInputs(inputs("a2"))
+	partial.Set(150, "key", "new")
+	partialFile, writer, err := partial.Save(200)
+	require.NoError(t, err)
+	require.NoError(t, writer.Write(ctx))
+
+	squash := func(links map[string]lineage.Link) (*FullKV, error) {
+		config.SetLineageLinks(links)
+		full := config.NewFullKV(zap.NewNop())
+		require.NoError(t, full.Load(ctx, NewCompleteFileInfo(0, 100)))
+		require.Equal(t, "old", full.Lineage().ModuleHash, "snapshot of the compatible module reused")
+
+		partial := config.NewPartialKV(100, zap.NewNop())
+		require.NoError(t, partial.Load(ctx, partialFile))
+		return full, full.Merge(partial)
+	}
+
+	_, err = squash(nil)
+	assert.ErrorContains(t, err, `incompatible input store "store_a"`)
+
+	full, err := squash(links)
+	require.NoError(t, err)
+	value, found := full.GetLast("key")
+	require.True(t, found)
+	assert.Equal(t, "new", string(value))
+	assert.Equal(t, "new", full.Lineage().ModuleHash)
+	assert.Equal(t, inputs("a2")[0].ModuleHash, full.Lineage().Inputs[0].ModuleHash)
+}
@@ -0,0 +1,87 @@
+package store
+
+import (
+	"context"
+	"fmt"
+)
+
+// LoadPartials loads the partial stores of `files`, deriving from `s`, up to
+// `parallelism` of them at the same time, and calls `f` with each of them in
+// the order of `files`. The downloads and decoding of the next files overlap
+// with `f` handling the previous ones, at most `parallelism` stores being
+// loaded ahead of `f`.
+//
+// The first error of a load or of `f` stops the loading and is returned.
+func (s *FullKV) LoadPartials(ctx context.Context, files FileInfos, parallelism int, f func(file *FileInfo, partial *PartialKV) error) error {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		partial *PartialKV
+		err     error
+	}
+	results := make([]chan result, len(files))
+	for i := range results {
+		results[i] = make(chan result, 1)
+	}
+
+	slots := make(chan struct{}, parallelism)
+	go func() {
+		for i, file := range files {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+
+			go func(file *FileInfo, out chan<- result) {
+				partial := s.DerivePartialStore(file.Range.StartBlock)
+				if err := partial.Load(ctx, file); err != nil {
+					out <- result{err: fmt.Errorf("loading partial store %q: %w", file.Filename, err)}
+					return
+				}
+				out <- result{partial: partial}
+			}(file, results[i])
+		}
+	}()
+
+	for i, file := range files {
+		var res result
+		select {
+		case res = <-results[i]:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if res.err != nil {
+			return res.err
+		}
+
+		err := f(file, res.partial)
+		<-slots
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadRanges merges the partial stores of `files` into `s`, in order, loading
+// up to `parallelism` of them at the same time. The files must be contiguous.
+func (s *FullKV) LoadRanges(ctx context.Context, files FileInfos, parallelism int) error {
+	for i := 1; i < len(files); i++ {
+		if files[i].Range.StartBlock != files[i-1].Range.ExclusiveEndBlock {
+			return fmt.Errorf("non contiguous ranges %s and %s", files[i-1].Range, files[i].Range)
+		}
+	}
+
+	return s.LoadPartials(ctx, files, parallelism, func(file *FileInfo, partial *PartialKV) error {
+		if err := s.Merge(partial); err != nil {
+			return fmt.Errorf("merging partial store %q: %w", file.Filename, err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,60 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/streamingfast/dstore"
+	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestFullKV_LoadRanges(t *testing.T) {
+	ctx := context.Background()
+	stateStore, err := dstore.NewStore("file://"+t.TempDir(), "", "", true)
+	require.NoError(t, err)
+
+	config, err := NewConfig("mod", 0, "abc", pbsubstreams.Module_KindStore_UPDATE_POLICY_SET, "string", stateStore, "")
+	require.NoError(t, err)
+
+	var files FileInfos
+	for start := uint64(0); start < 50; start += 10 {
+		partial := config.NewFullKV(zap.NewNop()).DerivePartialStore(start)
+		partial.Set(0, "last", fmt.Sprintf("%d", start))
+		partial.Set(0, fmt.Sprintf("key%d", start), "v")
+
+		file, writer, err := partial.Save(start + 10)
+		require.NoError(t, err)
+		require.NoError(t, writer.Write(ctx))
+		files = append(files, file)
+	}
+
+	for _, parallelism := range []int{1, 3, 10} {
+		t.Run(fmt.Sprintf("parallelism %d", parallelism), func(t *testing.T) {
+			full := config.NewFullKV(zap.NewNop())
+			require.NoError(t, full.LoadRanges(ctx, files, parallelism))
+
+			last, found := full.GetLast("last")
+			require.True(t, found)
+			assert.Equal(t, "40", string(last), "merged in order")
+			assert.Equal(t, uint64(6), full.Length())
+		})
+	}
+
+	full := config.NewFullKV(zap.NewNop())
+	assert.Error(t, full.LoadRanges(ctx, FileInfos{files[0], files[2]}, 2), "non contiguous")
+
+	var seen []uint64
+	err = full.LoadPartials(ctx, files, 2, func(file *FileInfo, partial *PartialKV) error {
+		seen = append(seen, file.Range.StartBlock)
+		if file.Range.StartBlock == 10 {
+			return fmt.Errorf("failed")
+		}
+		return nil
+	})
+	assert.EqualError(t, err, "failed")
+	assert.Equal(t, []uint64{0, 10}, seen)
+}
@@ -5,8 +5,12 @@ import (
 	"fmt"
 	"reflect"
 	"unsafe"
+
+	pbstore "github.com/streamingfast/substreams/storage/store/marshaller/pb"
 )
 
+// Binary writes the entries of the store, followed by its lineage, if any,
+// prefixed by its length. Older readers stop after the entries.
 type Binary struct{}
 
 // TODO: does not support delimted
@@ -16,11 +20,20 @@ func (k *Binary) Marshal(data *StoreData) ([]byte, error) {
 		return nil, fmt.Errorf("marshalling map string bytes kv state: %w", err)
 	}
 
+	if data.Lineage != nil {
+		lineage, err := data.Lineage.MarshalVT()
+		if err != nil {
+			return nil, fmt.Errorf("marshalling lineage: %w", err)
+		}
+		content = binary.AppendUvarint(content, uint64(len(lineage)))
+		content = append(content, lineage...)
+	}
+
 	return content, nil
 }
 
 func (k *Binary) Unmarshal(in []byte) (*StoreData, uint64, error) {
-	kv, err := readMapStringBytes(in)
+	kv, rest, err := readMapStringBytes(in)
 	if err != nil {
 		return nil, 0, fmt.Errorf("unmarshalling  map string bytes kv state: %w", err)
 	}
@@ -28,9 +41,31 @@ func (k *Binary) Unmarshal(in []byte) (*StoreData, uint64, error) {
 	out := &StoreData{
 		Kv: kv,
 	}
+	if len(rest) != 0 {
+		if out.Lineage, err = readLineage(rest); err != nil {
+			return nil, 0, fmt.Errorf("unmarshalling lineage: %w", err)
+		}
+	}
 	return out, 0, nil
 }
 
+func readLineage(in []byte) (*pbstore.Lineage, error) {
+	size, n := binary.Uvarint(in)
+	if n <= 0 {
+		return nil, fmt.Errorf("no bytes to read from cursor for lineage length")
+	}
+	in = in[n:]
+	if uint64(len(in)) < size {
+		return nil, fmt.Errorf("accessing lineage out of bytes slice")
+	}
+
+	lineage := &pbstore.Lineage{}
+	if err := lineage.UnmarshalVT(in[:size]); err != nil {
+		return nil, err
+	}
+	return lineage, nil
+}
+
 func writeMapStringBytes(entries map[string][]byte) ([]byte, error) {
 	sizeInBytes := uvarintByteCount(uint64(len(entries)))
 	for key, value := range entries {
@@ -60,12 +95,14 @@ func writeMapStringBytes(entries map[string][]byte) ([]byte, error) {
 	return buffer, nil
 }
 
-func readMapStringBytes(in []byte) (map[string][]byte, error) {
+// readMapStringBytes returns the entries read from `in`, and the bytes left
+// after them.
+func readMapStringBytes(in []byte) (map[string][]byte, []byte, error) {
 	cursor := in
 
 	entries, n := binary.Uvarint(cursor)
 	if n == 0 {
-		return nil, fmt.Errorf("no bytes to read from cursor")
+		return nil, nil, fmt.Errorf("no bytes to read from cursor")
 	}
 	cursor = cursor[n:]
 
@@ -74,29 +111,29 @@ func readMapStringBytes(in []byte) (map[string][]byte, error) {
 	for i := uint64(0); i < entries; i++ {
 		keyLen, bytesCountRead := binary.Uvarint(cursor)
 		if bytesCountRead == 0 {
-			return nil, fmt.Errorf("no bytes to read from cursor for key")
+			return nil, nil, fmt.Errorf("no bytes to read from cursor for key")
 		}
 		cursor = cursor[bytesCountRead:]
 
 		if uint64(len(cursor)) < keyLen {
-			return nil, fmt.Errorf("accessing key out of bytes slice")
+			return nil, nil, fmt.Errorf("accessing key out of bytes slice")
 		}
 		ks := unsafeGetString(cursor[:keyLen])
 		cursor = cursor[keyLen:]
 
 		valueLen, bytesCountRead := binary.Uvarint(cursor)
 		if bytesCountRead == 0 {
-			return nil, fmt.Errorf("no bytes to read from cursor for value")
+			return nil, nil, fmt.Errorf("no bytes to read from cursor for value")
 		}
 		cursor = cursor[bytesCountRead:]
 
 		if uint64(len(cursor)) < valueLen {
-			return nil, fmt.Errorf("accessing value out of bytes slice")
+			return nil, nil, fmt.Errorf("accessing value out of bytes slice")
 		}
 		out[ks] = cursor[:valueLen]
 		cursor = cursor[valueLen:]
 	}
-	return out, nil
+	return out, cursor, nil
 }
 
 // Get the string from a '[]byte' without any allocation
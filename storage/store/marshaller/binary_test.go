@@ -69,7 +69,7 @@ func Test_readMapStringBytes(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := readMapStringBytes(tt.args.in)
+			got, _, err := readMapStringBytes(tt.args.in)
 			if !tt.wantErr(t, err, fmt.Sprintf("readMapStringBytes(%v)", tt.args.in)) {
 				return
 			}
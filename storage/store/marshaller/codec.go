@@ -0,0 +1,59 @@
+package marshaller
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Codecs select the format of the files written by a store, set per module
+// with the `codec` of its manifest.
+const (
+	// CodecDefault writes the `StoreData` protobuf message, the format of the
+	// files written before codecs were introduced.
+	CodecDefault = ""
+	// CodecZstd writes the default format compressed with zstd, see Zstd.
+	CodecZstd = "zstd"
+	// CodecColumnar writes the keys and the values of the store in two
+	// separate columns, see Columnar.
+	CodecColumnar = "columnar"
+)
+
+// Files written with a codec other than the default one start with a header
+// naming it. Protobuf messages never start with a zero byte (field number 0
+// is invalid), so files without a header are read as the default format.
+var (
+	zstdHeader     = []byte("\x00ssz1")
+	columnarHeader = []byte("\x00ssc1")
+)
+
+// ForCodec returns the marshaller writing the files of stores using `codec`.
+// Whatever their codec, the marshallers returned read the files of all
+// codecs, detected from their header, so that a module can change codec
+// without invalidating the files already written.
+func ForCodec(codec string) (Marshaller, error) {
+	switch codec {
+	case CodecDefault:
+		return Default(), nil
+	case CodecZstd:
+		return &Zstd{}, nil
+	case CodecColumnar:
+		return &Columnar{}, nil
+	}
+	return nil, fmt.Errorf("unknown store codec %q, valid values are %q and %q", codec, CodecZstd, CodecColumnar)
+}
+
+// unmarshalAny reads `in` with the codec named by its header, or as the
+// default format without one.
+func unmarshalAny(in []byte) (*StoreData, uint64, error) {
+	switch {
+	case bytes.HasPrefix(in, zstdHeader):
+		return (&Zstd{}).Unmarshal(in)
+	case bytes.HasPrefix(in, columnarHeader):
+		return (&Columnar{}).Unmarshal(in)
+	}
+	return unmarshalDefault(in)
+}
+
+func hasCodecHeader(in []byte) bool {
+	return bytes.HasPrefix(in, zstdHeader) || bytes.HasPrefix(in, columnarHeader)
+}
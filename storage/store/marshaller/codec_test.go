@@ -0,0 +1,81 @@
+package marshaller
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForCodec(t *testing.T) {
+	in := &StoreData{
+		Kv:             map[string][]byte{"b": []byte("2"), "a": []byte("1"), "empty": {}},
+		DeletePrefixes: []string{"prefix"},
+	}
+	legacy, err := (&VTproto{}).Marshal(in)
+	require.NoError(t, err)
+
+	files := map[string][]byte{"legacy": legacy}
+	for _, codec := range []string{CodecDefault, CodecZstd, CodecColumnar} {
+		m, err := ForCodec(codec)
+		require.NoError(t, err)
+		files[codec], err = m.Marshal(in)
+		require.NoError(t, err)
+	}
+	assert.NotEqual(t, files[CodecDefault], files[CodecColumnar])
+
+	for _, codec := range []string{CodecDefault, CodecZstd, CodecColumnar} {
+		m, err := ForCodec(codec)
+		require.NoError(t, err)
+		for name, data := range files {
+			out, size, err := m.Unmarshal(data)
+			require.NoError(t, err, "codec %q reading %q", codec, name)
+			assert.Equal(t, in.Kv, out.Kv, "codec %q reading %q", codec, name)
+			assert.Equal(t, in.DeletePrefixes, out.DeletePrefixes, "codec %q reading %q", codec, name)
+			assert.Equal(t, uint64(9), size, "codec %q reading %q", codec, name)
+		}
+	}
+
+	_, err = ForCodec("gzip")
+	assert.Error(t, err)
+}
+
+func TestColumnar_Truncated(t *testing.T) {
+	data, err := (&Columnar{}).Marshal(&StoreData{Kv: map[string][]byte{"key": []byte("value")}})
+	require.NoError(t, err)
+
+	for i := len(columnarHeader); i < len(data); i++ {
+		_, _, err := (&Columnar{}).Unmarshal(data[:i])
+		assert.Error(t, err, "truncated at %d", i)
+	}
+}
+
+func TestMarshalTo(t *testing.T) {
+	in := &StoreData{
+		Kv:             map[string][]byte{"b": []byte("2"), "a": []byte("1"), "empty": {}},
+		DeletePrefixes: []string{"prefix"},
+	}
+
+	for _, codec := range []string{CodecDefault, CodecZstd, CodecColumnar} {
+		m, err := ForCodec(codec)
+		require.NoError(t, err)
+		streamer, ok := m.(StreamMarshaller)
+		require.True(t, ok, "codec %q", codec)
+
+		buf := &bytes.Buffer{}
+		require.NoError(t, streamer.MarshalTo(buf, in))
+
+		out, size, err := m.Unmarshal(buf.Bytes())
+		require.NoError(t, err, "codec %q", codec)
+		assert.Equal(t, in.Kv, out.Kv, "codec %q", codec)
+		assert.Equal(t, in.DeletePrefixes, out.DeletePrefixes, "codec %q", codec)
+		assert.Equal(t, uint64(9), size, "codec %q", codec)
+	}
+
+	marshalled, err := (&Columnar{}).Marshal(in)
+	require.NoError(t, err)
+	streamed := &bytes.Buffer{}
+	require.NoError(t, (&Columnar{}).MarshalTo(streamed, in))
+	assert.Equal(t, marshalled, streamed.Bytes(), "columnar files are sorted, streamed the same")
+}
@@ -0,0 +1,186 @@
+package marshaller
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+
+	pbstore "github.com/streamingfast/substreams/storage/store/marshaller/pb"
+)
+
+// Columnar writes the keys of the store, sorted, then all of their values,
+// after the other fields of `StoreData` (delete prefixes and ranges,
+// lineage, updated keys). Keys sharing prefixes and values of the same type end up next to
+// each other, which the compression of the state store objects takes
+// advantage of.
+//
+// Layout, after the header: the length of the other fields and their
+// `StoreData` protobuf encoding, the key count, the length of each key, the
+// length of each value, the keys and the values, lengths as uvarints.
+type Columnar struct{}
+
+func (c *Columnar) Marshal(data *StoreData) ([]byte, error) {
+	meta, keys, err := columnarLayout(mapEntries(data.Kv), data)
+	if err != nil {
+		return nil, err
+	}
+
+	size := len(columnarHeader) + uvarintByteCount(uint64(len(meta))) + len(meta) + uvarintByteCount(uint64(len(keys)))
+	for key, value := range data.Kv {
+		size += uvarintByteCount(uint64(len(key))) + len(key) + uvarintByteCount(uint64(len(value))) + len(value)
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, size))
+	if err := writeColumnar(out, meta, keys, mapEntries(data.Kv)); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func (c *Columnar) MarshalTo(w io.Writer, data *StoreData) error {
+	entries := data.entries()
+	meta, keys, err := columnarLayout(entries, data)
+	if err != nil {
+		return err
+	}
+	return writeColumnar(w, meta, keys, entries)
+}
+
+// columnarLayout returns the encoding of the fields of `data` other than its
+// entries, and the keys of `entries` sorted.
+func columnarLayout(entries Entries, data *StoreData) (meta []byte, keys []string, err error) {
+	meta, err = (&pbstore.StoreData{
+		DeletePrefixes: data.DeletePrefixes,
+		Lineage:        data.Lineage,
+		DeleteRanges:   data.DeleteRanges,
+		UpdatedKeys:    data.UpdatedKeys,
+	}).MarshalVT()
+	if err != nil {
+		return nil, nil, fmt.Errorf("marshalling store metadata: %w", err)
+	}
+
+	keys = entries.Keys()
+	sort.Strings(keys)
+	return meta, keys, nil
+}
+
+func writeColumnar(w io.Writer, meta []byte, keys []string, entries Entries) error {
+	buf := make([]byte, 0, len(columnarHeader)+2*binary.MaxVarintLen64+len(meta))
+	buf = append(buf, columnarHeader...)
+	buf = binary.AppendUvarint(buf, uint64(len(meta)))
+	buf = append(buf, meta...)
+	buf = binary.AppendUvarint(buf, uint64(len(keys)))
+	if _, err := w.Write(buf); err != nil {
+		return err
+	}
+
+	writeLength := func(length int) error {
+		_, err := w.Write(binary.AppendUvarint(buf[:0], uint64(length)))
+		return err
+	}
+	for _, key := range keys {
+		if err := writeLength(len(key)); err != nil {
+			return err
+		}
+	}
+	for _, key := range keys {
+		if err := writeLength(entries.ValueLen(key)); err != nil {
+			return err
+		}
+	}
+	for _, key := range keys {
+		if _, err := io.WriteString(w, key); err != nil {
+			return err
+		}
+	}
+	for _, key := range keys {
+		value, err := entries.Value(key)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Columnar) Unmarshal(in []byte) (*StoreData, uint64, error) {
+	if !bytes.HasPrefix(in, columnarHeader) {
+		return unmarshalAny(in)
+	}
+	cursor := in[len(columnarHeader):]
+
+	readLength := func(what string) (int, error) {
+		length, n := binary.Uvarint(cursor)
+		if n <= 0 {
+			return 0, fmt.Errorf("reading %s length", what)
+		}
+		cursor = cursor[n:]
+		return int(length), nil
+	}
+	readBytes := func(what string, length int) ([]byte, error) {
+		if length > len(cursor) {
+			return nil, fmt.Errorf("reading %s: %d bytes out of %d left", what, length, len(cursor))
+		}
+		out := cursor[:length]
+		cursor = cursor[length:]
+		return out, nil
+	}
+
+	metaLength, err := readLength("metadata")
+	if err != nil {
+		return nil, 0, err
+	}
+	meta, err := readBytes("metadata", metaLength)
+	if err != nil {
+		return nil, 0, err
+	}
+	metaData := &pbstore.StoreData{}
+	if err := metaData.UnmarshalVT(meta); err != nil {
+		return nil, 0, fmt.Errorf("unmarshalling store metadata: %w", err)
+	}
+
+	count, err := readLength("key count")
+	if err != nil {
+		return nil, 0, err
+	}
+	if count > len(cursor) {
+		return nil, 0, fmt.Errorf("invalid key count %d", count)
+	}
+	lengths := make([]int, 2*count) // keys, then values
+	for i := range lengths {
+		if lengths[i], err = readLength("entry"); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	kv := make(map[string][]byte, count)
+	keys := make([]string, count)
+	var dataSize uint64
+	for i := 0; i < count; i++ {
+		key, err := readBytes("key", lengths[i])
+		if err != nil {
+			return nil, 0, err
+		}
+		keys[i] = unsafeGetString(key)
+	}
+	for i := 0; i < count; i++ {
+		value, err := readBytes("value", lengths[count+i])
+		if err != nil {
+			return nil, 0, err
+		}
+		kv[keys[i]] = value
+		dataSize += uint64(len(keys[i]) + len(value))
+	}
+
+	return &StoreData{
+		Kv:             kv,
+		DeletePrefixes: metaData.DeletePrefixes,
+		Lineage:        metaData.Lineage,
+		DeleteRanges:   metaData.DeleteRanges,
+		UpdatedKeys:    metaData.UpdatedKeys,
+	}, dataSize, nil
+}
@@ -1,8 +1,18 @@
 package marshaller
 
+import (
+	"io"
+
+	pbstore "github.com/streamingfast/substreams/storage/store/marshaller/pb"
+)
+
 type StoreData struct {
 	Kv             map[string][]byte
+	Entries        Entries // if set, written by a StreamMarshaller in place of Kv
 	DeletePrefixes []string
+	Lineage        *pbstore.Lineage // nil on files written before lineage was recorded
+	DeleteRanges   []*pbstore.KeyRange
+	UpdatedKeys    []*pbstore.UpdatedKeys // only recorded for stores with a retention policy
 }
 
 type Marshaller interface {
@@ -10,6 +20,42 @@ type Marshaller interface {
 	Marshal(data *StoreData) ([]byte, error)
 }
 
+// StreamMarshaller writes the encoding of the store data as it goes, the same
+// `Marshal` returns, without holding all of it in memory.
+type StreamMarshaller interface {
+	MarshalTo(w io.Writer, data *StoreData) error
+}
+
+// Entries are the entries of a store, whose values are read one at a time
+// instead of being held in memory together, see StoreData.Entries.
+type Entries interface {
+	// Keys returns the keys of the entries, in no particular order.
+	Keys() []string
+	ValueLen(key string) int
+	Value(key string) ([]byte, error)
+}
+
+type mapEntries map[string][]byte
+
+func (m mapEntries) Keys() []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func (m mapEntries) ValueLen(key string) int          { return len(m[key]) }
+func (m mapEntries) Value(key string) ([]byte, error) { return m[key], nil }
+
+// entries returns the Entries of `data`, Kv when they are not set.
+func (data *StoreData) entries() Entries {
+	if data.Entries != nil {
+		return data.Entries
+	}
+	return mapEntries(data.Kv)
+}
+
 func Default() Marshaller {
 	return &VTproto{}
 }
@@ -6,8 +6,12 @@ import (
 	"strconv"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/atomic"
+	"google.golang.org/protobuf/proto"
+
+	pbstore "github.com/streamingfast/substreams/storage/store/marshaller/pb"
 )
 
 var marshallers = []struct {
@@ -18,6 +22,8 @@ var marshallers = []struct {
 	{"proto", &Proto{}},
 	{"protoingFast", &ProtoingFast{}},
 	{"vtproto", &VTproto{}},
+	{"zstd", &Zstd{}},
+	{"columnar", &Columnar{}},
 }
 
 var ranges = []int{10_000, 100_000, 1_000_000, 10_000_000}
@@ -101,3 +107,81 @@ func Benchmark_Unmarshall(b *testing.B) {
 		}
 	}
 }
+
+func TestMarshaller_Lineage(t *testing.T) {
+	in := &StoreData{
+		Kv:             map[string][]byte{"key": []byte("value")},
+		DeletePrefixes: []string{"prefix"},
+		Lineage: &pbstore.Lineage{
+			ModuleHash: "abc",
+			StartBlock: 100,
+			EndBlock:   200,
+			Inputs:     []*pbstore.InputSnapshot{{ModuleName: "store_a", ModuleHash: "def", EndBlock: 100}},
+		},
+	}
+
+	for _, m := range marshallers {
+		t.Run(m.name, func(t *testing.T) {
+			data, err := m.m.Marshal(in)
+			require.NoError(t, err)
+
+			out, _, err := m.m.Unmarshal(data)
+			require.NoError(t, err)
+			assert.Equal(t, in.Kv, out.Kv)
+			if m.name != "binary" { // does not support delete prefixes
+				assert.Equal(t, in.DeletePrefixes, out.DeletePrefixes)
+			}
+			assert.True(t, proto.Equal(in.Lineage, out.Lineage))
+		})
+	}
+}
+
+func TestMarshaller_DeleteRanges(t *testing.T) {
+	in := &StoreData{
+		Kv:           map[string][]byte{"key": []byte("value")},
+		DeleteRanges: []*pbstore.KeyRange{{StartKey: "a", EndKey: "c"}, {StartKey: "x:", EndKey: "x;"}},
+	}
+
+	for _, m := range marshallers {
+		if m.name == "binary" {
+			continue // does not support delete ranges
+		}
+		t.Run(m.name, func(t *testing.T) {
+			data, err := m.m.Marshal(in)
+			require.NoError(t, err)
+
+			out, _, err := m.m.Unmarshal(data)
+			require.NoError(t, err)
+			assert.Equal(t, in.Kv, out.Kv)
+			require.Len(t, out.DeleteRanges, 2)
+			for i := range in.DeleteRanges {
+				assert.True(t, proto.Equal(in.DeleteRanges[i], out.DeleteRanges[i]))
+			}
+		})
+	}
+}
+
+func TestMarshaller_UpdatedKeys(t *testing.T) {
+	in := &StoreData{
+		Kv:          map[string][]byte{"a": []byte("1"), "b": []byte("2")},
+		UpdatedKeys: []*pbstore.UpdatedKeys{{Block: 10, Keys: []string{"a"}}, {Block: 12, Keys: []string{"b"}}},
+	}
+
+	for _, m := range marshallers {
+		if m.name == "binary" {
+			continue // does not support updated keys
+		}
+		t.Run(m.name, func(t *testing.T) {
+			data, err := m.m.Marshal(in)
+			require.NoError(t, err)
+
+			out, _, err := m.m.Unmarshal(data)
+			require.NoError(t, err)
+			assert.Equal(t, in.Kv, out.Kv)
+			require.Len(t, out.UpdatedKeys, 2)
+			for i := range in.UpdatedKeys {
+				assert.True(t, proto.Equal(in.UpdatedKeys[i], out.UpdatedKeys[i]))
+			}
+		})
+	}
+}
@@ -17,6 +17,9 @@ func (p *Proto) Unmarshal(in []byte) (*StoreData, uint64, error) {
 	return &StoreData{
 		Kv:             stateData.GetKv(),
 		DeletePrefixes: stateData.GetDeletePrefixes(),
+		Lineage:        stateData.GetLineage(),
+		DeleteRanges:   stateData.GetDeleteRanges(),
+		UpdatedKeys:    stateData.GetUpdatedKeys(),
 	}, 0, nil
 }
 
@@ -24,6 +27,9 @@ func (p *Proto) Marshal(data *StoreData) ([]byte, error) {
 	stateData := &pbsubstreams.StoreData{
 		Kv:             data.Kv,
 		DeletePrefixes: data.DeletePrefixes,
+		Lineage:        data.Lineage,
+		DeleteRanges:   data.DeleteRanges,
+		UpdatedKeys:    data.UpdatedKeys,
 	}
 	return proto.Marshal(stateData)
 }
@@ -12,6 +12,9 @@ const KVEntryProtoTag = 0x0a
 const KVEntryKeyProtoTag = 0x0a
 const KVEntryValueProtoTag = 0x12
 const DeletePrefixEntryProtoTag = 0x12
+const LineageProtoTag = 0x1a
+const DeleteRangeProtoTag = 0x22
+const UpdatedKeysProtoTag = 0x2a
 
 // ProtoingFast is a custom proto marshaller, that will marshal and unmarshall the storeData into a predefined
 // proto struct (see below). The motivation here is that we want to write a proto message, making it readable by
@@ -20,6 +23,9 @@ const DeletePrefixEntryProtoTag = 0x12
 //	message StoreData {
 //		map<string, bytes> kv = 1;
 //		repeated string delete_prefixes = 2;
+//		Lineage lineage = 3;
+//		repeated KeyRange delete_ranges = 4;
+//		repeated UpdatedKeys updated_keys = 5;
 //	}
 type ProtoingFast struct{}
 
@@ -31,16 +37,49 @@ func (p *ProtoingFast) Unmarshal(in []byte) (*StoreData, uint64, error) {
 	return &StoreData{
 		Kv:             stateData.GetKv(),
 		DeletePrefixes: stateData.GetDeletePrefixes(),
+		Lineage:        stateData.GetLineage(),
+		DeleteRanges:   stateData.GetDeleteRanges(),
+		UpdatedKeys:    stateData.GetUpdatedKeys(),
 	}, 0, nil
 }
 
 func (p *ProtoingFast) Marshal(data *StoreData) ([]byte, error) {
+	var lineage []byte
+	if data.Lineage != nil {
+		var err error
+		if lineage, err = data.Lineage.MarshalVT(); err != nil {
+			return nil, fmt.Errorf("marshal lineage: %w", err)
+		}
+	}
+
+	deleteRanges := make([][]byte, len(data.DeleteRanges))
+	for i, keyRange := range data.DeleteRanges {
+		var err error
+		if deleteRanges[i], err = keyRange.MarshalVT(); err != nil {
+			return nil, fmt.Errorf("marshal delete range: %w", err)
+		}
+	}
+
+	updatedKeys := make([][]byte, len(data.UpdatedKeys))
+	for i, keys := range data.UpdatedKeys {
+		var err error
+		if updatedKeys[i], err = keys.MarshalVT(); err != nil {
+			return nil, fmt.Errorf("marshal updated keys: %w", err)
+		}
+	}
+
 	sizeInBytes := p.kvByteSize(data.Kv)
 	sizeInBytes += p.listByteSize(data.DeletePrefixes)
+	sizeInBytes += p.lineageByteSize(lineage)
+	sizeInBytes += p.messagesByteSize(deleteRanges)
+	sizeInBytes += p.messagesByteSize(updatedKeys)
 	buffer := make([]byte, sizeInBytes)
 	cursor := buffer
 	cursor = p.writeKV(cursor, data.Kv)
-	p.writeDeletePrefix(cursor, data.DeletePrefixes)
+	cursor = p.writeDeletePrefix(cursor, data.DeletePrefixes)
+	cursor = p.writeLineage(cursor, lineage)
+	cursor = p.writeMessages(cursor, DeleteRangeProtoTag, deleteRanges)
+	p.writeMessages(cursor, UpdatedKeysProtoTag, updatedKeys)
 	return buffer, nil
 
 }
@@ -76,6 +115,21 @@ func (p *ProtoingFast) listByteSize(list []string) int {
 	return size
 }
 
+func (p *ProtoingFast) lineageByteSize(lineage []byte) int {
+	if lineage == nil {
+		return 0
+	}
+	return 1 + uvarintByteCount(uint64(len(lineage))) + len(lineage) // Lineage proto tag 0x1a (field number 3, type LEN [message]), length and message
+}
+
+func (p *ProtoingFast) messagesByteSize(messages [][]byte) int {
+	size := 0
+	for _, message := range messages {
+		size += 1 + uvarintByteCount(uint64(len(message))) + len(message) // Repeated message proto tag (field number 4 or 5, type LEN [message]), length and message
+	}
+	return size
+}
+
 func (p *ProtoingFast) writeKV(cursor []byte, entries map[string][]byte) []byte {
 	for key, value := range entries {
 		copy(cursor, []byte{KVEntryProtoTag})
@@ -118,3 +172,31 @@ func (p *ProtoingFast) writeDeletePrefix(cursor []byte, entries []string) []byte
 	}
 	return cursor
 }
+
+func (p *ProtoingFast) writeLineage(cursor []byte, lineage []byte) []byte {
+	if lineage == nil {
+		return cursor
+	}
+	copy(cursor, []byte{LineageProtoTag})
+	cursor = cursor[1:]
+
+	written := binary.PutUvarint(cursor, uint64(len(lineage)))
+	cursor = cursor[written:]
+
+	copy(cursor, lineage)
+	return cursor[len(lineage):]
+}
+
+func (p *ProtoingFast) writeMessages(cursor []byte, tag byte, messages [][]byte) []byte {
+	for _, message := range messages {
+		copy(cursor, []byte{tag})
+		cursor = cursor[1:]
+
+		written := binary.PutUvarint(cursor, uint64(len(message)))
+		cursor = cursor[written:]
+
+		copy(cursor, message)
+		cursor = cursor[len(message):]
+	}
+	return cursor
+}
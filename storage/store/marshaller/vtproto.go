@@ -4,12 +4,22 @@ import (
 	"fmt"
 	"io"
 
+	"google.golang.org/protobuf/encoding/protowire"
+
 	pbstore "github.com/streamingfast/substreams/storage/store/marshaller/pb"
 )
 
 type VTproto struct{}
 
+// Unmarshal also reads the files written with the other codecs, see ForCodec.
 func (p *VTproto) Unmarshal(in []byte) (*StoreData, uint64, error) {
+	if hasCodecHeader(in) {
+		return unmarshalAny(in)
+	}
+	return unmarshalDefault(in)
+}
+
+func unmarshalDefault(in []byte) (*StoreData, uint64, error) {
 	stateData := &pbstore.StoreData{}
 	dataSize, err := unmarshalVT(stateData, in)
 	if err != nil {
@@ -18,6 +28,9 @@ func (p *VTproto) Unmarshal(in []byte) (*StoreData, uint64, error) {
 	return &StoreData{
 		Kv:             stateData.GetKv(),
 		DeletePrefixes: stateData.GetDeletePrefixes(),
+		Lineage:        stateData.GetLineage(),
+		DeleteRanges:   stateData.GetDeleteRanges(),
+		UpdatedKeys:    stateData.GetUpdatedKeys(),
 	}, dataSize, nil
 }
 
@@ -25,11 +38,53 @@ func (p *VTproto) Marshal(data *StoreData) ([]byte, error) {
 	stateData := &pbstore.StoreData{
 		Kv:             data.Kv,
 		DeletePrefixes: data.DeletePrefixes,
+		Lineage:        data.Lineage,
+		DeleteRanges:   data.DeleteRanges,
+		UpdatedKeys:    data.UpdatedKeys,
 	}
 
 	return stateData.MarshalVT()
 }
 
+// MarshalTo writes the entries of `data` one after the other, followed by the
+// other fields of `StoreData`.
+func (p *VTproto) MarshalTo(w io.Writer, data *StoreData) error {
+	entries := data.entries()
+	var entry []byte
+	for _, key := range entries.Keys() {
+		value, err := entries.Value(key)
+		if err != nil {
+			return err
+		}
+		entrySize := protowire.SizeTag(1) + protowire.SizeBytes(len(key)) + protowire.SizeTag(2) + protowire.SizeBytes(len(value))
+
+		entry = protowire.AppendTag(entry[:0], 1, protowire.BytesType)
+		entry = protowire.AppendVarint(entry, uint64(entrySize))
+		entry = protowire.AppendTag(entry, 1, protowire.BytesType)
+		entry = protowire.AppendString(entry, key)
+		entry = protowire.AppendTag(entry, 2, protowire.BytesType)
+		entry = protowire.AppendVarint(entry, uint64(len(value)))
+		if _, err := w.Write(entry); err != nil {
+			return err
+		}
+		if _, err := w.Write(value); err != nil {
+			return err
+		}
+	}
+
+	meta, err := (&pbstore.StoreData{
+		DeletePrefixes: data.DeletePrefixes,
+		Lineage:        data.Lineage,
+		DeleteRanges:   data.DeleteRanges,
+		UpdatedKeys:    data.UpdatedKeys,
+	}).MarshalVT()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(meta)
+	return err
+}
+
 // The function `func (m *StoreData) UnmarshalVT(dAtA []byte) error` that is generated
 // by the vtprotobuf protobuf plugin is ok, but we can greatly improve the allocation and
 // speed with a few optimizations. This function is a 98% copy of the function in
@@ -236,6 +291,110 @@ func unmarshalVT(m *pbstore.StoreData, dAtA []byte) (dataSize uint64, err error)
 			//m.DeletePrefixes = append(m.DeletePrefixes, string(dAtA[iNdEx:postIndex]))
 			m.DeletePrefixes = append(m.DeletePrefixes, unsafeGetString(dAtA[iNdEx:postIndex]))
 			iNdEx = postIndex
+		case 3:
+			if wireType != 2 {
+				return 0, fmt.Errorf("proto: wrong wireType = %d for field Lineage", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return 0, pbstore.ErrIntOverflow
+				}
+				if iNdEx >= l {
+					return 0, io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return 0, pbstore.ErrInvalidLength
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return 0, pbstore.ErrInvalidLength
+			}
+			if postIndex > l {
+				return 0, io.ErrUnexpectedEOF
+			}
+			m.Lineage = &pbstore.Lineage{}
+			if err := m.Lineage.UnmarshalVT(dAtA[iNdEx:postIndex]); err != nil {
+				return 0, err
+			}
+			iNdEx = postIndex
+		case 4:
+			if wireType != 2 {
+				return 0, fmt.Errorf("proto: wrong wireType = %d for field DeleteRanges", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return 0, pbstore.ErrIntOverflow
+				}
+				if iNdEx >= l {
+					return 0, io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return 0, pbstore.ErrInvalidLength
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return 0, pbstore.ErrInvalidLength
+			}
+			if postIndex > l {
+				return 0, io.ErrUnexpectedEOF
+			}
+			keyRange := &pbstore.KeyRange{}
+			if err := keyRange.UnmarshalVT(dAtA[iNdEx:postIndex]); err != nil {
+				return 0, err
+			}
+			m.DeleteRanges = append(m.DeleteRanges, keyRange)
+			iNdEx = postIndex
+		case 5:
+			if wireType != 2 {
+				return 0, fmt.Errorf("proto: wrong wireType = %d for field UpdatedKeys", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return 0, pbstore.ErrIntOverflow
+				}
+				if iNdEx >= l {
+					return 0, io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return 0, pbstore.ErrInvalidLength
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return 0, pbstore.ErrInvalidLength
+			}
+			if postIndex > l {
+				return 0, io.ErrUnexpectedEOF
+			}
+			updatedKeys := &pbstore.UpdatedKeys{}
+			if err := updatedKeys.UnmarshalVT(dAtA[iNdEx:postIndex]); err != nil {
+				return 0, err
+			}
+			m.UpdatedKeys = append(m.UpdatedKeys, updatedKeys)
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skip(dAtA[iNdEx:])
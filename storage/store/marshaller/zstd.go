@@ -0,0 +1,58 @@
+package marshaller
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedBestCompression))
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+// Zstd writes the default format compressed with zstd at its best compression
+// level. It pays off with stores holding large, repetitive values on state
+// stores that do not compress their objects, or only at a faster level.
+type Zstd struct{}
+
+func (z *Zstd) Marshal(data *StoreData) ([]byte, error) {
+	content, err := Default().Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, len(zstdHeader), len(zstdHeader)+len(content)/2)
+	copy(out, zstdHeader)
+	return zstdEncoder.EncodeAll(content, out), nil
+}
+
+func (z *Zstd) MarshalTo(w io.Writer, data *StoreData) error {
+	if _, err := w.Write(zstdHeader); err != nil {
+		return err
+	}
+
+	encoder, err := zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.SpeedBestCompression))
+	if err != nil {
+		return err
+	}
+	if err := (&VTproto{}).MarshalTo(encoder, data); err != nil {
+		encoder.Close()
+		return err
+	}
+	return encoder.Close()
+}
+
+func (z *Zstd) Unmarshal(in []byte) (*StoreData, uint64, error) {
+	if !bytes.HasPrefix(in, zstdHeader) {
+		return unmarshalAny(in)
+	}
+
+	content, err := zstdDecoder.DecodeAll(in[len(zstdHeader):], nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("decompressing zstd store: %w", err)
+	}
+	return unmarshalAny(content)
+}
@@ -15,23 +15,23 @@ import (
 )
 
 func (b *baseStore) setKV(k string, v []byte) {
-	if prev, ok := b.kv[k]; ok {
+	if prev, ok := b.get(k); ok {
 		b.totalSizeBytes -= uint64(len(prev))
 	} else {
 		b.totalSizeBytes += uint64(len(k))
 	}
 	b.totalSizeBytes += uint64(len(v))
-	b.kv[k] = v
+	b.setKey(k, v)
 }
 
 func (b *baseStore) setNewKV(k string, v []byte) {
 	b.totalSizeBytes += uint64(len(k) + len(v))
-	b.kv[k] = v
+	b.setKey(k, v)
 }
 
 // Merge nextStore _into_ `s`, where nextStore is for the next contiguous segment's store output.
 func (b *baseStore) Merge(kvPartialStore *PartialKV) error {
-	b.logger.Debug("merging store", zap.Int("current_key_count", len(b.kv)), zap.Uint64("mod_init_block", b.moduleInitialBlock), zap.Int("partial_key_count", len(kvPartialStore.kv)), zap.Uint64("partial_start_block", kvPartialStore.initialBlock))
+	b.logger.Debug("merging store", zap.Int("current_key_count", b.keyCount()), zap.Uint64("mod_init_block", b.moduleInitialBlock), zap.Int("partial_key_count", kvPartialStore.keyCount()), zap.Uint64("partial_start_block", kvPartialStore.initialBlock))
 
 	if kvPartialStore.updatePolicy != b.updatePolicy {
 		return fmt.Errorf("incompatible update policies: policy %q cannot merge policy %q", b.updatePolicy, kvPartialStore.updatePolicy)
@@ -41,6 +41,10 @@ func (b *baseStore) Merge(kvPartialStore *PartialKV) error {
 		return fmt.Errorf("incompatible value types: cannot merge %q and %q", b.valueType, kvPartialStore.valueType)
 	}
 
+	if err := b.verifyLineage(kvPartialStore); err != nil {
+		return fmt.Errorf("verifying lineage: %w", err)
+	}
+
 	partialKvTime := time.Now()
 	for _, prefix := range kvPartialStore.DeletedPrefixes {
 		b.DeletePrefix(kvPartialStore.lastOrdinal, prefix)
@@ -48,23 +52,62 @@ func (b *baseStore) Merge(kvPartialStore *PartialKV) error {
 	if len(kvPartialStore.DeletedPrefixes) > 0 {
 		b.logger.Info("merging: applied delete prefixes", zap.Duration("duration", time.Since(partialKvTime)))
 	}
+	if len(kvPartialStore.DeletedRanges) > 0 {
+		deleteRangesTime := time.Now()
+		b.deleteKeyRanges(kvPartialStore.DeletedRanges)
+		b.logger.Info("merging: applied delete ranges", zap.Int("range_count", len(kvPartialStore.DeletedRanges)), zap.Duration("duration", time.Since(deleteRangesTime)))
+	}
+
+	b.mergeUpdatedAt(kvPartialStore)
+
+	if b.immutable {
+		// report the lowest conflicting key, so the error doesn't depend on map iteration order
+		var conflict *ImmutableKeyError
+		for _, k := range kvPartialStore.allKeys() {
+			if b.has(k) && (conflict == nil || k < conflict.Key) {
+				conflict = &ImmutableKeyError{Store: b.name, Key: k}
+			}
+		}
+		if conflict != nil {
+			return conflict
+		}
+	}
+
+	// the partial's spilled values are read back in batches, not all at once
+	if err := kvPartialStore.forEachBatch(b.mergeEntries); err != nil {
+		return err
+	}
+
+	// the merged store now continues the partial's lineage, which is unknown if the partial has none
+	b.lineage, b.lineageInputs = nil, nil
+	if next := kvPartialStore.lineage; next != nil {
+		b.lineageInputs = next.Inputs
+		b.lineage = b.newLineage(b.moduleInitialBlock, next.EndBlock)
+	}
+
+	b.Reset() // Merge should never keep deltas or ordinals
+	return nil
+}
 
+// mergeEntries merges the entries `partialKV` of a partial store into `b`,
+// according to its update policy.
+func (b *baseStore) mergeEntries(partialKV map[string][]byte) error {
 	intoValueTypeLower := strings.ToLower(b.valueType)
 
 	switch b.updatePolicy {
 	case pbsubstreams.Module_KindStore_UPDATE_POLICY_SET:
-		for k, v := range kvPartialStore.kv {
+		for k, v := range partialKV {
 			b.setKV(k, v)
 		}
 	case pbsubstreams.Module_KindStore_UPDATE_POLICY_SET_IF_NOT_EXISTS:
-		for k, v := range kvPartialStore.kv {
-			if _, found := b.kv[k]; !found {
+		for k, v := range partialKV {
+			if !b.has(k) {
 				b.setNewKV(k, v)
 			}
 		}
 	case pbsubstreams.Module_KindStore_UPDATE_POLICY_APPEND:
-		for k, v := range kvPartialStore.kv {
-			if prevVal, found := b.kv[k]; found {
+		for k, v := range partialKV {
+			if prevVal, found := b.get(k); found {
 				newLen := len(prevVal) + len(v)
 				if b.appendLimit > 0 && uint64(newLen) >= b.appendLimit {
 					return fmt.Errorf("append would exceed limit of %d bytes", b.appendLimit)
@@ -85,8 +128,8 @@ func (b *baseStore) Merge(kvPartialStore *PartialKV) error {
 			sum := func(a, b int64) int64 {
 				return a + b
 			}
-			for k, v := range kvPartialStore.kv {
-				v0b, fv0 := b.kv[k]
+			for k, v := range partialKV {
+				v0b, fv0 := b.get(k)
 				v0 := foundOrZeroInt64(v0b, fv0)
 				v1 := foundOrZeroInt64(v, true)
 				b.setKV(k, []byte(fmt.Sprintf("%d", sum(v0, v1))))
@@ -95,8 +138,8 @@ func (b *baseStore) Merge(kvPartialStore *PartialKV) error {
 			sum := func(a, b float64) float64 {
 				return a + b
 			}
-			for k, v := range kvPartialStore.kv {
-				v0b, fv0 := b.kv[k]
+			for k, v := range partialKV {
+				v0b, fv0 := b.get(k)
 				v0 := foundOrZeroFloat(v0b, fv0)
 				v1 := foundOrZeroFloat(v, true)
 				b.setKV(k, floatToBytes(sum(v0, v1)))
@@ -105,8 +148,8 @@ func (b *baseStore) Merge(kvPartialStore *PartialKV) error {
 			sum := func(a, b *big.Int) *big.Int {
 				return new(big.Int).Add(a, b)
 			}
-			for k, v := range kvPartialStore.kv {
-				v0b, fv0 := b.kv[k]
+			for k, v := range partialKV {
+				v0b, fv0 := b.get(k)
 				v0 := foundOrZeroBigInt(v0b, fv0)
 				v1 := foundOrZeroBigInt(v, true)
 				b.setKV(k, []byte(fmt.Sprintf("%d", sum(v0, v1))))
@@ -114,8 +157,8 @@ func (b *baseStore) Merge(kvPartialStore *PartialKV) error {
 		case manifest.OutputValueTypeBigFloat:
 			fallthrough
 		case manifest.OutputValueTypeBigDecimal:
-			for k, v := range kvPartialStore.kv {
-				v0b, fv0 := b.kv[k]
+			for k, v := range partialKV {
+				v0b, fv0 := b.get(k)
 				v0 := foundOrZeroBigDecimal(v0b, fv0)
 				v1 := foundOrZeroBigDecimal(v, true)
 				b.setKV(k, []byte(v0.Add(v1).String()))
@@ -132,9 +175,9 @@ func (b *baseStore) Merge(kvPartialStore *PartialKV) error {
 				}
 				return b
 			}
-			for k, v := range kvPartialStore.kv {
+			for k, v := range partialKV {
 				v1 := foundOrZeroInt64(v, true)
-				v, found := b.kv[k]
+				v, found := b.get(k)
 				if !found {
 					b.setNewKV(k, []byte(fmt.Sprintf("%d", v1)))
 					continue
@@ -150,9 +193,9 @@ func (b *baseStore) Merge(kvPartialStore *PartialKV) error {
 				}
 				return a
 			}
-			for k, v := range kvPartialStore.kv {
+			for k, v := range partialKV {
 				v1 := foundOrZeroFloat(v, true)
-				v, found := b.kv[k]
+				v, found := b.get(k)
 				if !found {
 					b.setNewKV(k, floatToBytes(v1))
 					continue
@@ -168,9 +211,9 @@ func (b *baseStore) Merge(kvPartialStore *PartialKV) error {
 				}
 				return a
 			}
-			for k, v := range kvPartialStore.kv {
+			for k, v := range partialKV {
 				v1 := foundOrZeroBigInt(v, true)
-				v, found := b.kv[k]
+				v, found := b.get(k)
 				if !found {
 					b.setNewKV(k, []byte(v1.String()))
 					continue
@@ -188,9 +231,9 @@ func (b *baseStore) Merge(kvPartialStore *PartialKV) error {
 				}
 				return a
 			}
-			for k, v := range kvPartialStore.kv {
+			for k, v := range partialKV {
 				v1 := foundOrZeroBigDecimal(v, true)
-				v, found := b.kv[k]
+				v, found := b.get(k)
 				if !found {
 					b.setNewKV(k, []byte(v1.String()))
 					continue
@@ -200,7 +243,7 @@ func (b *baseStore) Merge(kvPartialStore *PartialKV) error {
 				b.setNewKV(k, []byte(max(v0, v1).String()))
 			}
 		default:
-			return fmt.Errorf("update policy %q not supported for value type %q", kvPartialStore.updatePolicy, kvPartialStore.valueType)
+			return fmt.Errorf("update policy %q not supported for value type %q", b.updatePolicy, b.valueType)
 		}
 	case pbsubstreams.Module_KindStore_UPDATE_POLICY_MIN:
 		switch intoValueTypeLower {
@@ -211,9 +254,9 @@ func (b *baseStore) Merge(kvPartialStore *PartialKV) error {
 				}
 				return b
 			}
-			for k, v := range kvPartialStore.kv {
+			for k, v := range partialKV {
 				v1 := foundOrZeroInt64(v, true)
-				v, found := b.kv[k]
+				v, found := b.get(k)
 				if !found {
 					b.setNewKV(k, []byte(fmt.Sprintf("%d", v1)))
 					continue
@@ -229,9 +272,9 @@ func (b *baseStore) Merge(kvPartialStore *PartialKV) error {
 				}
 				return b
 			}
-			for k, v := range kvPartialStore.kv {
+			for k, v := range partialKV {
 				v1 := foundOrZeroFloat(v, true)
-				v, found := b.kv[k]
+				v, found := b.get(k)
 				if !found {
 					b.setNewKV(k, floatToBytes(v1))
 					continue
@@ -247,9 +290,9 @@ func (b *baseStore) Merge(kvPartialStore *PartialKV) error {
 				}
 				return b
 			}
-			for k, v := range kvPartialStore.kv {
+			for k, v := range partialKV {
 				v1 := foundOrZeroBigInt(v, true)
-				v, found := b.kv[k]
+				v, found := b.get(k)
 				if !found {
 					b.setNewKV(k, []byte(v1.String()))
 					continue
@@ -267,9 +310,9 @@ func (b *baseStore) Merge(kvPartialStore *PartialKV) error {
 				}
 				return b
 			}
-			for k, v := range kvPartialStore.kv {
+			for k, v := range partialKV {
 				v1 := foundOrZeroBigDecimal(v, true)
-				v, found := b.kv[k]
+				v, found := b.get(k)
 				if !found {
 					b.setNewKV(k, []byte(v1.String()))
 					continue
@@ -283,8 +326,6 @@ func (b *baseStore) Merge(kvPartialStore *PartialKV) error {
 	default:
 		return fmt.Errorf("update policy %q not supported", b.updatePolicy) // should have been validated already
 	}
-
-	b.Reset() // Merge should never keep deltas or ordinals
 	return nil
 }
 
@@ -380,6 +380,52 @@ func TestStore_Merge(t *testing.T) {
 	}
 }
 
+func TestStore_MergeImmutable(t *testing.T) {
+	prev := newStore(map[string][]byte{
+		"one":   []byte("baz"),
+		"three": []byte("lol"),
+	}, pbsubstreams.Module_KindStore_UPDATE_POLICY_SET_IF_NOT_EXISTS, manifest.OutputValueTypeString)
+	prev.immutable = true
+
+	latest := newPartialStore(map[string][]byte{
+		"two": []byte("bar"),
+	}, pbsubstreams.Module_KindStore_UPDATE_POLICY_SET_IF_NOT_EXISTS, manifest.OutputValueTypeString, nil)
+	require.NoError(t, prev.Merge(latest))
+	assert.Equal(t, []byte("bar"), prev.kv["two"])
+
+	latest = newPartialStore(map[string][]byte{
+		"three": []byte("foo"),
+		"one":   []byte("foo"),
+		"four":  []byte("foo"),
+	}, pbsubstreams.Module_KindStore_UPDATE_POLICY_SET_IF_NOT_EXISTS, manifest.OutputValueTypeString, nil)
+	err := prev.Merge(latest)
+	assert.Equal(t, &ImmutableKeyError{Key: "one"}, err)
+	assert.Equal(t, []byte("baz"), prev.kv["one"])
+}
+
+func TestStore_SetImmutable(t *testing.T) {
+	for _, policy := range []pbsubstreams.Module_KindStore_UpdatePolicy{
+		pbsubstreams.Module_KindStore_UPDATE_POLICY_SET,
+		pbsubstreams.Module_KindStore_UPDATE_POLICY_SET_IF_NOT_EXISTS,
+	} {
+		t.Run(policy.String(), func(t *testing.T) {
+			s := newTestBaseStore(t, policy, manifest.OutputValueTypeString, nil)
+			s.immutable = true
+
+			set := s.Set
+			if policy == pbsubstreams.Module_KindStore_UPDATE_POLICY_SET_IF_NOT_EXISTS {
+				set = s.SetIfNotExists
+			}
+			set(0, "key", "value")
+			assert.PanicsWithError(t, `store "test" is immutable: key "key" already exists`, func() {
+				set(1, "key", "other")
+			})
+			v, _ := s.GetLast("key")
+			assert.Equal(t, "value", string(v))
+		})
+	}
+}
+
 func newPartialStore(kv map[string][]byte, updatePolicy pbsubstreams.Module_KindStore_UpdatePolicy, valueType string, deletedPrefixes []string) *PartialKV {
 	b := &baseStore{
 		kv: kv,
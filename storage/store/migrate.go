@@ -0,0 +1,102 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/streamingfast/dstore"
+
+	"github.com/streamingfast/substreams/storage/store/marshaller"
+)
+
+// MigrateStateFile returns the store file `data` rewritten in version
+// StateFileVersion, and whether it was of an older version. Its content is
+// decoded before being rewritten, so that a file that can't be read is never
+// rewritten.
+func MigrateStateFile(filename string, data []byte) (out []byte, migrated bool, err error) {
+	version, content, err := readStateFile(filename, data)
+	if err != nil {
+		return nil, false, err
+	}
+	if version == StateFileVersion {
+		return data, false, nil
+	}
+
+	if _, _, err := marshaller.Default().Unmarshal(content); err != nil {
+		return nil, false, fmt.Errorf("decoding state file %s of version %d: %w", filename, version, err)
+	}
+	return encodeStateFile(content), true, nil
+}
+
+// MigrateStateFiles rewrites in place the store files (complete and partial) of
+// the modules of `stateStore` written in a version older than
+// StateFileVersion, see MigrateStateFile. Only the modules of `moduleHashes`
+// are migrated, all of them when empty. With `dryRun`, nothing is written,
+// `onFile` is still called for every file that would be migrated.
+//
+// Files are rewritten with the same content, so the servers reading them
+// meanwhile load the same store before and after.
+func MigrateStateFiles(ctx context.Context, stateStore dstore.Store, moduleHashes []string, dryRun bool, onFile func(filePath string)) (migrated int, err error) {
+	selected := make(map[string]bool, len(moduleHashes))
+	for _, moduleHash := range moduleHashes {
+		selected[moduleHash] = true
+	}
+
+	var filePaths []string
+	err = walkStateFiles(ctx, stateStore, func(moduleDir, filePath string, fileInfo *FileInfo) {
+		if len(selected) != 0 && !selected[moduleHashOf(moduleDir)] {
+			return
+		}
+		filePaths = append(filePaths, filePath)
+	})
+	if err != nil {
+		return 0, err
+	}
+	sort.Strings(filePaths)
+
+	for _, filePath := range filePaths {
+		data, err := readObject(ctx, stateStore, filePath)
+		if err != nil {
+			return migrated, err
+		}
+
+		out, needed, err := MigrateStateFile(filePath, data)
+		if err != nil {
+			return migrated, err
+		}
+		if !needed {
+			continue
+		}
+
+		if onFile != nil {
+			onFile(filePath)
+		}
+		if dryRun {
+			migrated++
+			continue
+		}
+
+		if err := stateStore.WriteObject(ctx, filePath, bytes.NewReader(out)); err != nil {
+			return migrated, fmt.Errorf("writing %q: %w", filePath, err)
+		}
+		migrated++
+	}
+	return migrated, nil
+}
+
+func readObject(ctx context.Context, stateStore dstore.Store, filePath string) ([]byte, error) {
+	reader, err := stateStore.OpenObject(ctx, filePath)
+	if err != nil {
+		return nil, fmt.Errorf("opening %q: %w", filePath, err)
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("reading %q: %w", filePath, err)
+	}
+	return data, nil
+}
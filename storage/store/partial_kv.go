@@ -3,8 +3,10 @@ package store
 import (
 	"context"
 	"fmt"
+	"io"
 
 	"github.com/streamingfast/substreams/storage/store/marshaller"
+	pbstore "github.com/streamingfast/substreams/storage/store/marshaller/pb"
 	"go.uber.org/zap"
 )
 
@@ -15,6 +17,7 @@ type PartialKV struct {
 
 	initialBlock    uint64 // block at which we initialized this store
 	DeletedPrefixes []string
+	DeletedRanges   []*pbstore.KeyRange // tombstones of the ranges deleted since initialBlock, applied when merging
 
 	loadedFrom string
 	seen       map[string]bool
@@ -22,7 +25,9 @@ type PartialKV struct {
 
 func (p *PartialKV) Roll(lastBlock uint64) {
 	p.initialBlock = lastBlock
-	p.baseStore.kv = map[string][]byte{}
+	p.baseStore.resetKeys(nil)
+	p.baseStore.updatedAt = nil
+	p.DeletedRanges = nil
 }
 
 func (p *PartialKV) InitialBlock() uint64 { return p.initialBlock }
@@ -31,49 +36,71 @@ func (p *PartialKV) Load(ctx context.Context, file *FileInfo) error {
 	p.loadedFrom = file.Filename
 	p.logger.Debug("loading partial store state from file", zap.String("filename", file.Filename))
 
-	data, err := loadStore(ctx, p.objStore, file.Filename)
+	var storeData *marshaller.StoreData
+	var size uint64
+	err := loadStore(ctx, p.objStore, file.Filename, func(data []byte) (err error) {
+		storeData, size, err = p.marshaller.Unmarshal(data)
+		if err != nil {
+			return fmt.Errorf("unmarshal store: %w", err)
+		}
+		return nil
+	})
 	if err != nil {
 		return fmt.Errorf("load partial store %s at %s: %w", p.name, file.Filename, err)
 	}
 
-	storeData, size, err := p.marshaller.Unmarshal(data)
-	if err != nil {
-		return fmt.Errorf("unmarshal store: %w", err)
-	}
-
-	p.kv = storeData.Kv
-	if p.kv == nil {
-		p.kv = map[string][]byte{}
-	}
+	p.resetKeys(storeData.Kv)
 	p.totalSizeBytes = size
 	p.DeletedPrefixes = storeData.DeletePrefixes
+	p.DeletedRanges = storeData.DeleteRanges
+	p.lineage = storeData.Lineage
+	p.loadUpdatedKeys(storeData.UpdatedKeys)
 
-	p.logger.Debug("partial store loaded", zap.String("filename", file.Filename), zap.Int("key_count", len(p.kv)), zap.Uint64("data_size", size))
+	p.logger.Debug("partial store loaded", zap.String("filename", file.Filename), zap.Int("key_count", p.keyCount()), zap.Uint64("data_size", size))
 	return nil
 }
 
 func (p *PartialKV) Save(endBoundaryBlock uint64) (*FileInfo, *fileWriter, error) {
 	p.logger.Debug("writing partial store state", zap.Object("store", p))
 
+	p.DeletedRanges = compactKeyRanges(p.DeletedRanges)
 	stateData := &marshaller.StoreData{
-		Kv:             p.kv,
 		DeletePrefixes: p.DeletedPrefixes,
-	}
-
-	content, err := p.marshaller.Marshal(stateData)
-	if err != nil {
-		return nil, nil, fmt.Errorf("marshal partial data: %w", err)
+		Lineage:        p.newLineage(p.initialBlock, endBoundaryBlock),
+		DeleteRanges:   p.DeletedRanges,
+		UpdatedKeys:    p.updatedKeys(),
 	}
 
 	file := NewPartialFileInfo(p.initialBlock, endBoundaryBlock, p.traceID)
-	p.logger.Info("partial store save written", zap.String("file_name", file.Filename), zap.Stringer("block_range", file.Range))
-
 	fw := &fileWriter{
 		store:    p.objStore,
 		filename: file.Filename,
-		content:  content,
+		ledger:   p.ledger,
+		traceID:  p.traceID,
+	}
+
+	// The partial is streamed from its entries, its spilled values read one at
+	// a time, instead of holding all of its encoding in memory. The entries
+	// are left to the writer when the store rolls to the next segment.
+	if streamer, ok := p.marshaller.(marshaller.StreamMarshaller); ok {
+		entries := p.streamEntries()
+		stateData.Entries = entries
+		fw.marshal = func(w io.Writer) error { return streamer.MarshalTo(w, stateData) }
+		fw.release = entries.release
+	} else {
+		kv, err := p.entries()
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading store entries: %w", err)
+		}
+		stateData.Kv = kv
+		content, err := p.marshaller.Marshal(stateData)
+		if err != nil {
+			return nil, nil, fmt.Errorf("marshal partial data: %w", err)
+		}
+		fw.content = encodeStateFile(content)
 	}
 
+	p.logger.Info("partial store save written", zap.String("file_name", file.Filename), zap.Stringer("block_range", file.Range))
 	return file, fw, nil
 }
 
@@ -86,6 +113,11 @@ func (p *PartialKV) DeletePrefix(ord uint64, prefix string) {
 	}
 }
 
+func (p *PartialKV) DeleteRange(ord uint64, startKey, endKey string) {
+	p.baseStore.DeleteRange(ord, startKey, endKey)
+	p.DeletedRanges = append(p.DeletedRanges, &pbstore.KeyRange{StartKey: startKey, EndKey: endKey})
+}
+
 func (p *PartialKV) DeleteStore(ctx context.Context, file *FileInfo) (err error) {
 	zlog.Debug("deleting partial store file", zap.String("file_name", file.Filename))
 
@@ -96,5 +128,5 @@ func (p *PartialKV) DeleteStore(ctx context.Context, file *FileInfo) (err error)
 }
 
 func (p *PartialKV) String() string {
-	return fmt.Sprintf("partialKV name %s moduleInitialBlock %d  keyCount %d deltasCount %d loadFrom %s", p.Name(), p.moduleInitialBlock, len(p.kv), len(p.deltas), p.loadedFrom)
+	return fmt.Sprintf("partialKV name %s moduleInitialBlock %d  keyCount %d deltasCount %d loadFrom %s", p.Name(), p.moduleInitialBlock, p.keyCount(), len(p.deltas), p.loadedFrom)
 }
@@ -7,7 +7,10 @@ import (
 	"testing"
 
 	"github.com/streamingfast/dstore"
+	"github.com/streamingfast/substreams/manifest"
+	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
 	"github.com/streamingfast/substreams/storage/store/marshaller"
+	pbstore "github.com/streamingfast/substreams/storage/store/marshaller/pb"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
 )
@@ -60,3 +63,103 @@ func TestPartialKV_Save_Load_Empty_MapNotNil(t *testing.T) {
 	require.NoError(t, err)
 	require.NotNilf(t, kvl.kv, "kvl.kv is nil")
 }
+
+func TestPartialKV_DeleteRange(t *testing.T) {
+	var writtenBytes []byte
+	store := dstore.NewMockStore(func(base string, f io.Reader) (err error) {
+		writtenBytes, err = io.ReadAll(f)
+		return err
+	})
+	store.OpenObjectFunc = func(ctx context.Context, name string) (out io.ReadCloser, err error) {
+		return io.NopCloser(bytes.NewBuffer(writtenBytes)), nil
+	}
+
+	newPartial := func() *PartialKV {
+		return &PartialKV{
+			baseStore: &baseStore{
+				kv: map[string][]byte{},
+
+				logger:     zap.NewNop(),
+				marshaller: marshaller.Default(),
+
+				Config: &Config{
+					moduleInitialBlock: 0,
+					objStore:           store,
+					updatePolicy:       pbsubstreams.Module_KindStore_UPDATE_POLICY_SET,
+					valueType:          manifest.OutputValueTypeString,
+					itemSizeLimit:      100,
+					totalSizeLimit:     1000,
+				},
+			},
+		}
+	}
+
+	kvs := newPartial()
+	kvs.DeleteRange(1, "b", "c")
+	kvs.DeleteRange(2, "a:2", "b:5")
+	kvs.DeleteRange(3, "d", "d")
+	kvs.SetBytes(4, "b:1", []byte("new"))
+
+	file, writer, err := kvs.Save(123)
+	require.NoError(t, err)
+	require.NoError(t, writer.Write(context.Background()))
+
+	kvl := newPartial()
+	require.NoError(t, kvl.Load(context.Background(), file))
+	require.Equal(t, []*pbstore.KeyRange{{StartKey: "a:2", EndKey: "c"}}, kvl.DeletedRanges)
+
+	full := newStore(map[string][]byte{
+		"a:1": []byte("1"),
+		"a:2": []byte("2"),
+		"b:1": []byte("3"),
+		"b:9": []byte("4"),
+		"c":   []byte("5"),
+	}, pbsubstreams.Module_KindStore_UPDATE_POLICY_SET, manifest.OutputValueTypeString)
+	require.NoError(t, full.Merge(kvl))
+	require.Equal(t, map[string][]byte{
+		"a:1": []byte("1"),
+		"b:1": []byte("new"),
+		"c":   []byte("5"),
+	}, full.kv)
+}
+
+func TestPartialKV_Save_Streamed(t *testing.T) {
+	var writtenBytes []byte
+	store := dstore.NewMockStore(func(base string, f io.Reader) (err error) {
+		writtenBytes, err = io.ReadAll(f)
+		return err
+	})
+	store.OpenObjectFunc = func(ctx context.Context, name string) (out io.ReadCloser, err error) {
+		return io.NopCloser(bytes.NewBuffer(writtenBytes)), nil
+	}
+
+	newPartialKV := func() *PartialKV {
+		return &PartialKV{
+			baseStore: &baseStore{
+				kv:         map[string][]byte{},
+				logger:     zap.NewNop(),
+				marshaller: &marshaller.Columnar{},
+				Config: &Config{
+					moduleInitialBlock: 0,
+					objStore:           store,
+				},
+			},
+			DeletedPrefixes: []string{"z:"},
+		}
+	}
+
+	kvs := newPartialKV()
+	kvs.kv["b"] = []byte("2")
+	kvs.kv["a"] = []byte("1")
+
+	file, writer, err := kvs.Save(123)
+	require.NoError(t, err)
+	require.NoError(t, writer.Write(context.Background()))
+	require.Equal(t, uint64(len(writtenBytes)), writer.Size())
+
+	kvl := newPartialKV()
+	kvl.DeletedPrefixes = nil
+	require.NoError(t, kvl.Load(context.Background(), file))
+	require.Equal(t, map[string][]byte{"a": []byte("1"), "b": []byte("2")}, kvl.kv)
+	require.Equal(t, []string{"z:"}, kvl.DeletedPrefixes)
+}
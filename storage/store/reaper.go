@@ -0,0 +1,271 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/streamingfast/dstore"
+	"go.uber.org/zap"
+
+	"github.com/streamingfast/substreams/metrics"
+	"github.com/streamingfast/substreams/storage/layout"
+	"github.com/streamingfast/substreams/storage/lease"
+)
+
+// PartialReaper deletes the partial files of the state store whose range is
+// already covered by a complete snapshot (`.kv`) of their module. Those are
+// left behind when the squasher did not delete them (ex: tier1 restarted
+// while squashing, DeleteStore failed, or another request produced the
+// complete snapshot first).
+//
+// A partial file is only deleted once it was seen orphaned by two scans in a
+// row, so that a squasher loading it while the covering snapshot was being
+// written still finds it. The files of the modules with an active lease (see
+// package `lease`) are left alone.
+//
+// The resume points (see NewResumePointFileInfo) written longer than a maximum
+// age ago are deleted too, see SetResumePointMaxAge: a request deletes its own
+// when it ends cleanly, not when it fails or its client goes away.
+type PartialReaper struct {
+	stateStore        dstore.Store
+	interval          time.Duration
+	dryRun            bool
+	resumePointMaxAge time.Duration // 0 keeps the resume points
+	logger            *zap.Logger
+
+	orphaned map[string]bool // paths seen orphaned by the previous scan
+	now      func() time.Time
+}
+
+// NewPartialReaper returns a reaper scanning `stateStore`, the root of the
+// state store, files laid out in v1 or v2 (see package `layout`). In
+// `dryRun` mode, the orphaned partial files are only logged and counted.
+func NewPartialReaper(stateStore dstore.Store, interval time.Duration, dryRun bool, logger *zap.Logger) *PartialReaper {
+	return &PartialReaper{
+		stateStore: stateStore,
+		interval:   interval,
+		dryRun:     dryRun,
+		logger:     logger.Named("partial_reaper"),
+		orphaned:   map[string]bool{},
+		now:        time.Now,
+	}
+}
+
+// SetResumePointMaxAge makes the reaper delete the resume points written
+// longer than `maxAge` ago, 0 keeps them.
+func (r *PartialReaper) SetResumePointMaxAge(maxAge time.Duration) {
+	r.resumePointMaxAge = maxAge
+}
+
+// Run scans the state store every interval, until `ctx` is done.
+func (r *PartialReaper) Run(ctx context.Context) {
+	r.logger.Info("starting partial store reaper", zap.Duration("interval", r.interval), zap.Bool("dry_run", r.dryRun))
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		start := time.Now()
+		deleted, err := r.Reap(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			metrics.PartialReaperErrors.Inc()
+			r.logger.Warn("reaping partial store files", zap.Error(err))
+			continue
+		}
+		r.logger.Info("reaped partial store files", zap.Int("orphaned_count", len(r.orphaned)), zap.Int("deleted_count", len(deleted)), zap.Duration("duration", time.Since(start)))
+	}
+}
+
+// Reap scans the state store once and deletes the partial files found
+// orphaned by this scan and the previous one, then the expired resume points,
+// returning their paths. In dry-run mode, nothing is deleted and the returned
+// paths are those that would have been.
+func (r *PartialReaper) Reap(ctx context.Context) (deleted []string, err error) {
+	orphans, resumePoints, err := r.scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	metrics.PartialReaperOrphanedFiles.SetUint64(uint64(len(orphans)))
+
+	orphaned := make(map[string]bool, len(orphans))
+	for _, filePath := range orphans {
+		orphaned[filePath] = true
+		if !r.orphaned[filePath] {
+			continue
+		}
+
+		if r.dryRun {
+			r.logger.Info("would delete orphaned partial store file", zap.String("path", filePath))
+			deleted = append(deleted, filePath)
+			continue
+		}
+
+		if err := r.stateStore.DeleteObject(ctx, filePath); err != nil {
+			metrics.PartialReaperErrors.Inc()
+			r.logger.Warn("deleting orphaned partial store file", zap.String("path", filePath), zap.Error(err))
+			continue
+		}
+		metrics.PartialReaperDeletedFiles.Inc()
+		deleted = append(deleted, filePath)
+		delete(orphaned, filePath)
+	}
+	r.orphaned = orphaned
+
+	return append(deleted, r.reapResumePoints(ctx, resumePoints)...), nil
+}
+
+// reapResumePoints deletes the resume points `resumePoints` written longer than
+// the maximum age ago, returning their paths.
+func (r *PartialReaper) reapResumePoints(ctx context.Context, resumePoints []string) (deleted []string) {
+	for _, filePath := range resumePoints {
+		attrs, err := r.stateStore.ObjectAttributes(ctx, filePath)
+		if err != nil {
+			metrics.PartialReaperErrors.Inc()
+			r.logger.Warn("reading resume point attributes", zap.String("path", filePath), zap.Error(err))
+			continue
+		}
+		if r.now().Sub(attrs.LastModified) < r.resumePointMaxAge {
+			continue
+		}
+
+		if r.dryRun {
+			r.logger.Info("would delete expired resume point", zap.String("path", filePath))
+			deleted = append(deleted, filePath)
+			continue
+		}
+		if err := r.stateStore.DeleteObject(ctx, filePath); err != nil {
+			metrics.PartialReaperErrors.Inc()
+			r.logger.Warn("deleting expired resume point", zap.String("path", filePath), zap.Error(err))
+			continue
+		}
+		metrics.PartialReaperDeletedResumePoints.Inc()
+		deleted = append(deleted, filePath)
+	}
+	return deleted
+}
+
+// scan returns the paths of the partial files covered by a complete snapshot
+// of their module, sorted, and of the resume points when they expire.
+func (r *PartialReaper) scan(ctx context.Context) (orphans, resumePoints []string, err error) {
+	type moduleFiles struct {
+		partials       map[string]*FileInfo // by path in the state store
+		lastCompleteAt uint64               // exclusive end block of the largest complete snapshot
+	}
+	modules := map[string]*moduleFiles{} // by v1 directory, `<module_hash>/states`
+
+	leases, err := lease.Active(ctx, r.stateStore)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var onResumePoint func(moduleDir, filePath string)
+	if r.resumePointMaxAge != 0 {
+		onResumePoint = func(moduleDir, filePath string) {
+			if leases[moduleHashOf(moduleDir)] == nil {
+				resumePoints = append(resumePoints, filePath)
+			}
+		}
+	}
+	err = walkStateFilesAndResumePoints(ctx, r.stateStore, func(moduleDir, filePath string, fileInfo *FileInfo) {
+		if leases[moduleHashOf(moduleDir)] != nil {
+			return
+		}
+		module := modules[moduleDir]
+		if module == nil {
+			module = &moduleFiles{partials: map[string]*FileInfo{}}
+			modules[moduleDir] = module
+		}
+		if fileInfo.Partial {
+			module.partials[filePath] = fileInfo
+		} else if fileInfo.Range.ExclusiveEndBlock > module.lastCompleteAt {
+			module.lastCompleteAt = fileInfo.Range.ExclusiveEndBlock
+		}
+	}, onResumePoint)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Complete snapshots all start at the module's initial block, so the
+	// largest covers every partial file ending before it.
+	for _, module := range modules {
+		for filePath, fileInfo := range module.partials {
+			if fileInfo.Range.ExclusiveEndBlock <= module.lastCompleteAt {
+				orphans = append(orphans, filePath)
+			}
+		}
+	}
+	sort.Strings(orphans)
+	return orphans, resumePoints, nil
+}
+
+// resumePointModuleDir returns the v1 module directory (`<module_hash>/states/`)
+// of `filePath` when it is a resume point.
+func resumePointModuleDir(filePath string) (string, bool) {
+	parts := strings.SplitN(filePath, "/", 3)
+	if len(parts) != 3 || parts[1] != "states" || !resumePointRegex.MatchString(parts[2]) {
+		return "", false
+	}
+	return parts[0] + "/states/", true
+}
+
+// moduleHashOf returns the module hash of `moduleDir`, a v1 module directory
+// (`<module_hash>/states/`).
+func moduleHashOf(moduleDir string) string {
+	return strings.Split(moduleDir, "/")[0]
+}
+
+// walkStateFiles calls `f` with every store snapshot file of `stateStore`, laid
+// out in v1 or v2 (see package `layout`), with the v1 directory of its module
+// (`<module_hash>/states/`) and its path in `stateStore`.
+func walkStateFiles(ctx context.Context, stateStore dstore.Store, f func(moduleDir, filePath string, fileInfo *FileInfo)) error {
+	return walkStateFilesAndResumePoints(ctx, stateStore, f, nil)
+}
+
+// walkStateFilesAndResumePoints is walkStateFiles also calling `onResumePoint`,
+// if not nil, with every resume point of `stateStore` (always laid out in v1,
+// `<module_hash>/states/resume/<request_id>/<file>`) and the v1 directory of its
+// module.
+func walkStateFilesAndResumePoints(ctx context.Context, stateStore dstore.Store, f func(moduleDir, filePath string, fileInfo *FileInfo), onResumePoint func(moduleDir, filePath string)) error {
+	err := stateStore.Walk(ctx, "", func(filePath string) error {
+		if onResumePoint != nil {
+			if moduleDir, ok := resumePointModuleDir(filePath); ok {
+				onResumePoint(moduleDir, filePath)
+				return nil
+			}
+		}
+
+		v1Path := filePath
+		if p, ok := layout.V1Path(filePath); ok {
+			v1Path = p
+		}
+
+		dir, filename := path.Split(v1Path)
+		if path.Base(dir) != "states" {
+			return nil
+		}
+		fileInfo, ok := parseFileName(filename)
+		if !ok {
+			return nil
+		}
+
+		f(dir, filePath, fileInfo)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("walking state store: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package store
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/streamingfast/dstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/streamingfast/substreams/storage/lease"
+)
+
+func TestPartialReaper_Reap(t *testing.T) {
+	stateStore := dstore.NewMockStore(nil)
+	for _, file := range []string{
+		"abc/states/0000002000-0000000000.kv",
+		"abc/states/0000001000-0000000000.partial",
+		"abc/states/0000002000-0000001000.trace.partial",
+		"abc/states/0000003000-0000002000.partial",
+		"abc/outputs/0000001000-0000000000.output",
+		"def/states/0000001000-0000000000.partial",
+		"de/def/states/0000000000/0000001000-0000000000.kv",
+		"de/def/states/0000000000/0000002000-0000001000.partial",
+	} {
+		stateStore.SetFile(file, []byte("{}"))
+	}
+	orphans := []string{
+		"abc/states/0000001000-0000000000.partial",
+		"abc/states/0000002000-0000001000.trace.partial",
+		"def/states/0000001000-0000000000.partial",
+	}
+
+	dryRun := NewPartialReaper(stateStore, time.Minute, true, zap.NewNop())
+	deleted, err := dryRun.Reap(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, deleted, "partial files only seen orphaned once are kept")
+	deleted, err = dryRun.Reap(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, orphans, deleted)
+	assert.Len(t, stateStore.Files, 8)
+
+	reaper := NewPartialReaper(stateStore, time.Minute, false, zap.NewNop())
+	_, err = reaper.Reap(context.Background())
+	require.NoError(t, err)
+	deleted, err = reaper.Reap(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, orphans, deleted)
+	assert.Len(t, stateStore.Files, 5)
+	assert.Contains(t, stateStore.Files, "abc/states/0000003000-0000002000.partial")
+	assert.Contains(t, stateStore.Files, "de/def/states/0000000000/0000002000-0000001000.partial")
+}
+
+func TestPartialReaper_Reap_Leased(t *testing.T) {
+	ctx := context.Background()
+	stateStore, err := dstore.NewStore("file://"+t.TempDir(), "", "", true)
+	require.NoError(t, err)
+	for _, file := range []string{
+		"abc/states/0000002000-0000000000.kv",
+		"abc/states/0000001000-0000000000.partial",
+		"def/states/0000002000-0000000000.kv",
+		"def/states/0000001000-0000000000.partial",
+	} {
+		require.NoError(t, stateStore.WriteObject(ctx, file, strings.NewReader("{}")))
+	}
+	_, err = lease.Acquire(ctx, stateStore, "abc", "migration", "", time.Hour)
+	require.NoError(t, err)
+
+	reaper := NewPartialReaper(stateStore, time.Minute, false, zap.NewNop())
+	_, err = reaper.Reap(ctx)
+	require.NoError(t, err)
+	deleted, err := reaper.Reap(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"def/states/0000001000-0000000000.partial"}, deleted)
+
+	exists, err := stateStore.FileExists(ctx, "abc/states/0000001000-0000000000.partial")
+	require.NoError(t, err)
+	assert.True(t, exists)
+}
+
+func TestPartialReaper_Reap_ResumePoints(t *testing.T) {
+	ctx := context.Background()
+	stateStore, err := dstore.NewStore("file://"+t.TempDir(), "", "", true)
+	require.NoError(t, err)
+	for _, file := range []string{
+		"abc/states/0000002000-0000000000.kv",
+		"abc/states/resume/a1/0000002500-0000000000.0000002499a.kv",
+		"def/states/resume/b2/0000001500-0000000000.0000001499b.kv",
+	} {
+		require.NoError(t, stateStore.WriteObject(ctx, file, strings.NewReader("{}")))
+	}
+	_, err = lease.Acquire(ctx, stateStore, "def", "migration", "", time.Hour)
+	require.NoError(t, err)
+
+	reaper := NewPartialReaper(stateStore, time.Minute, false, zap.NewNop())
+	deleted, err := reaper.Reap(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, deleted, "resume points kept without a maximum age")
+
+	reaper.SetResumePointMaxAge(time.Hour)
+	deleted, err = reaper.Reap(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, deleted, "resume points written less than the maximum age ago are kept")
+
+	reaper.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	deleted, err = reaper.Reap(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"abc/states/resume/a1/0000002500-0000000000.0000002499a.kv"}, deleted, "the resume points of the leased modules are kept")
+
+	exists, err := stateStore.FileExists(ctx, "abc/states/0000002000-0000000000.kv")
+	require.NoError(t, err)
+	assert.True(t, exists)
+}
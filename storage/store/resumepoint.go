@@ -0,0 +1,131 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strconv"
+
+	"github.com/streamingfast/dstore"
+
+	"github.com/streamingfast/substreams/block"
+	"github.com/streamingfast/substreams/storage/store/marshaller"
+)
+
+// resumePointsDir is the directory of the resume points in the states of a
+// module, one sub-directory per request saving them.
+const resumePointsDir = "resume/"
+
+var resumePointRegex = regexp.MustCompile(`^resume/([^/]+)/(\d+)-(\d+)\.([^./]+)\.kv$`)
+
+// NewResumePointFileInfo returns the resume point of a store saved by the
+// request `requestID` right after the final block `blockID`, its range ending
+// at `exclusiveEnd`. Resume points are complete snapshots, kept apart from the
+// ones on the store save interval boundaries since each request deletes its
+// previous one.
+func NewResumePointFileInfo(moduleInitialBlock, exclusiveEnd uint64, blockID, requestID string) *FileInfo {
+	return &FileInfo{
+		Filename: path.Join(resumePointsDir, requestID, fmt.Sprintf("%010d-%010d.%s.kv", exclusiveEnd, moduleInitialBlock, blockID)),
+		Range:    block.NewRange(moduleInitialBlock, exclusiveEnd),
+	}
+}
+
+// ListResumePoints returns the resume points of the stores of this config
+// ending at or below `below`, saved by any request.
+func (c *Config) ListResumePoints(ctx context.Context, below uint64) (files FileInfos, err error) {
+	err = c.objStore.Walk(ctx, resumePointsDir, func(filename string) error {
+		res := resumePointRegex.FindStringSubmatch(filename)
+		if res == nil {
+			return nil
+		}
+		end, err := strconv.ParseUint(res[2], 10, 64)
+		if err != nil || end > below {
+			return nil
+		}
+		start, err := strconv.ParseUint(res[3], 10, 64)
+		if err != nil || start >= end {
+			return nil
+		}
+		files = append(files, &FileInfo{Filename: filename, Range: block.NewRange(start, end)})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing resume points: %w", err)
+	}
+	return files, nil
+}
+
+// FindResumePoint returns a resume point of the stores of this config ending
+// at `exclusiveEnd`, nil if there is none.
+func (c *Config) FindResumePoint(ctx context.Context, exclusiveEnd uint64) (*FileInfo, error) {
+	files, err := c.ListResumePoints(ctx, exclusiveEnd)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		if file.Range.ExclusiveEndBlock == exclusiveEnd {
+			return file, nil
+		}
+	}
+	return nil, nil
+}
+
+// SaveResumePoint returns the writer of the resume point `file` of the store,
+// see NewResumePointFileInfo. Only the keys held in memory are copied, the
+// values being read when the snapshot is written: the store can keep being
+// updated meanwhile, its values are replaced and never modified in place.
+func (s *FullKV) SaveResumePoint(file *FileInfo) *fileWriter {
+	entries := s.streamEntries()
+	kv := make(map[string][]byte, len(entries.kv))
+	for key, value := range entries.kv {
+		kv[key] = value
+	}
+	entries.kv = kv
+
+	stateData := &marshaller.StoreData{
+		Entries:     entries,
+		Lineage:     s.newLineage(s.moduleInitialBlock, file.Range.ExclusiveEndBlock),
+		UpdatedKeys: s.updatedKeys(),
+	}
+
+	fw := &fileWriter{
+		store:    s.objStore,
+		filename: file.Filename,
+		release:  entries.release,
+	}
+	if streamer, ok := s.marshaller.(marshaller.StreamMarshaller); ok {
+		fw.marshal = func(w io.Writer) error { return streamer.MarshalTo(w, stateData) }
+		return fw
+	}
+
+	fw.marshal = func(w io.Writer) error {
+		data := *stateData
+		data.Entries, data.Kv = nil, make(map[string][]byte, len(kv))
+		for _, key := range entries.Keys() {
+			value, err := entries.Value(key)
+			if err != nil {
+				return err
+			}
+			data.Kv[key] = value
+		}
+		content, err := s.marshaller.Marshal(&data)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(content)
+		return err
+	}
+	return fw
+}
+
+// DeleteResumePoint deletes the resume point `file` of the stores of this
+// config.
+func (c *Config) DeleteResumePoint(ctx context.Context, file *FileInfo) error {
+	err := c.objStore.DeleteObject(ctx, file.Filename)
+	if err == dstore.ErrNotFound {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,130 @@
+package store
+
+import (
+	"sort"
+
+	pbssinternal "github.com/streamingfast/substreams/pb/sf/substreams/intern/v2"
+	pbstore "github.com/streamingfast/substreams/storage/store/marshaller/pb"
+)
+
+// Expirer is implemented by the stores enforcing the retention policy of
+// their module, see Config.TTLBlocks.
+type Expirer interface {
+	// TrackUpdates records the keys written by the deltas of block `blockNum`,
+	// to be called once the block is processed, before Reset.
+	TrackUpdates(blockNum uint64)
+
+	// Expire deletes the keys not updated in the `ttl_blocks` blocks before
+	// `boundaryBlock`, returning how many were deleted. It is called on the
+	// store save interval boundaries only, so that the keys kept don't depend
+	// on where requests start and stop.
+	Expire(boundaryBlock uint64) (deleted int)
+}
+
+var _ Expirer = (*baseStore)(nil)
+
+func (b *baseStore) TrackUpdates(blockNum uint64) {
+	if b.ttlBlocks == 0 {
+		return
+	}
+	if b.updatedAt == nil {
+		b.updatedAt = make(map[string]uint64)
+	}
+
+	// Keys written by undone blocks keep the number of the undone block, they
+	// are only retained longer than they should have been.
+	for _, delta := range b.deltas {
+		switch delta.Operation {
+		case pbssinternal.StoreDelta_CREATE, pbssinternal.StoreDelta_UPDATE:
+			b.updatedAt[delta.Key] = blockNum
+		}
+	}
+}
+
+func (b *baseStore) Expire(boundaryBlock uint64) (deleted int) {
+	if b.ttlBlocks == 0 || boundaryBlock < b.ttlBlocks {
+		return 0
+	}
+
+	expiredBelow := boundaryBlock - b.ttlBlocks
+	for key, blockNum := range b.updatedAt {
+		value, found := b.get(key)
+		if !found {
+			delete(b.updatedAt, key)
+			continue
+		}
+		if blockNum >= expiredBelow {
+			continue
+		}
+
+		b.deleteKey(key)
+		delete(b.updatedAt, key)
+		b.totalSizeBytes -= uint64(len(key) + len(value))
+		deleted++
+	}
+	return deleted
+}
+
+// Expire records nothing, keys only expire from the full stores the partial
+// stores are merged into.
+func (p *PartialKV) Expire(boundaryBlock uint64) (deleted int) {
+	return 0
+}
+
+// mergeUpdatedAt keeps the latest update of each key, from the partial store
+// `partial` merged into `b`.
+func (b *baseStore) mergeUpdatedAt(partial *PartialKV) {
+	if b.ttlBlocks == 0 || len(partial.updatedAt) == 0 {
+		return
+	}
+	if b.updatedAt == nil {
+		b.updatedAt = make(map[string]uint64, len(partial.updatedAt))
+	}
+	for key, blockNum := range partial.updatedAt {
+		if blockNum > b.updatedAt[key] {
+			b.updatedAt[key] = blockNum
+		}
+	}
+}
+
+// updatedKeys returns the tracked updates of the keys still in the store,
+// grouped by block and sorted, to be written in its files.
+func (b *baseStore) updatedKeys() []*pbstore.UpdatedKeys {
+	if len(b.updatedAt) == 0 {
+		return nil
+	}
+
+	byBlock := map[uint64]*pbstore.UpdatedKeys{}
+	for key, blockNum := range b.updatedAt {
+		if !b.has(key) {
+			continue
+		}
+		updated := byBlock[blockNum]
+		if updated == nil {
+			updated = &pbstore.UpdatedKeys{Block: blockNum}
+			byBlock[blockNum] = updated
+		}
+		updated.Keys = append(updated.Keys, key)
+	}
+
+	out := make([]*pbstore.UpdatedKeys, 0, len(byBlock))
+	for _, updated := range byBlock {
+		sort.Strings(updated.Keys)
+		out = append(out, updated)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Block < out[j].Block })
+	return out
+}
+
+func (b *baseStore) loadUpdatedKeys(updatedKeys []*pbstore.UpdatedKeys) {
+	b.updatedAt = nil
+	if len(updatedKeys) == 0 {
+		return
+	}
+	b.updatedAt = make(map[string]uint64)
+	for _, updated := range updatedKeys {
+		for _, key := range updated.Keys {
+			b.updatedAt[key] = updated.Block
+		}
+	}
+}
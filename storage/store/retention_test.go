@@ -0,0 +1,70 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
+	"github.com/streamingfast/substreams/storage/store/marshaller"
+)
+
+func TestFullKV_Expire(t *testing.T) {
+	config := &Config{
+		updatePolicy:   pbsubstreams.Module_KindStore_UPDATE_POLICY_SET,
+		valueType:      "string",
+		ttlBlocks:      100,
+		totalSizeLimit: 1_000_000,
+		itemSizeLimit:  1_000,
+	}
+	s := config.NewFullKV(zap.NewNop())
+
+	s.Set(0, "a", "1")
+	s.Set(1, "b", "2")
+	s.TrackUpdates(10)
+	s.Reset()
+
+	s.Set(0, "b", "3")
+	s.Set(1, "c", "4")
+	s.TrackUpdates(150)
+	s.Reset()
+
+	assert.Equal(t, 0, s.Expire(100), "nothing older than 100 blocks at block 100")
+	assert.Equal(t, 1, s.Expire(200))
+	assert.Equal(t, map[string][]byte{"b": []byte("3"), "c": []byte("4")}, s.kv)
+
+	stateData := &marshaller.StoreData{Kv: s.kv, UpdatedKeys: s.updatedKeys()}
+	require.Len(t, stateData.UpdatedKeys, 1)
+	assert.Equal(t, uint64(150), stateData.UpdatedKeys[0].Block)
+	assert.Equal(t, []string{"b", "c"}, stateData.UpdatedKeys[0].Keys)
+
+	partial := s.DerivePartialStore(200)
+	partial.Set(0, "c", "5")
+	partial.TrackUpdates(220)
+	partial.Reset()
+	assert.Equal(t, 0, partial.Expire(300), "partial stores never expire keys")
+
+	require.NoError(t, s.Merge(partial))
+	assert.Equal(t, 1, s.Expire(300))
+	assert.Equal(t, map[string][]byte{"c": []byte("5")}, s.kv)
+}
+
+func TestFullKV_Expire_NoRetentionPolicy(t *testing.T) {
+	config := &Config{
+		updatePolicy:   pbsubstreams.Module_KindStore_UPDATE_POLICY_SET,
+		valueType:      "string",
+		totalSizeLimit: 1_000_000,
+		itemSizeLimit:  1_000,
+	}
+	s := config.NewFullKV(zap.NewNop())
+
+	s.Set(0, "a", "1")
+	s.TrackUpdates(10)
+	s.Reset()
+
+	assert.Equal(t, 0, s.Expire(1_000_000))
+	assert.Nil(t, s.updatedKeys())
+	assert.Len(t, s.kv, 1)
+}
@@ -0,0 +1,164 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/streamingfast/dstore"
+	"go.uber.org/zap"
+
+	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
+)
+
+// seedEntry is a line of a seed file, see `Module.KindStore.StoreSeed`.
+type seedEntry struct {
+	Key         string  `json:"key"`
+	Value       *string `json:"value"`
+	ValueBase64 []byte  `json:"value_base64"`
+}
+
+// storeSeed loads the seed of a store once, for all the stores of its config.
+type storeSeed struct {
+	seed *pbsubstreams.Module_KindStore_StoreSeed
+
+	once sync.Once
+	kv   map[string][]byte
+	err  error
+}
+
+// SetSeed makes the full stores of this config start at the module's initial
+// block with the key/values of `seed`, see FullKV.LoadSeed.
+func (c *Config) SetSeed(seed *pbsubstreams.Module_KindStore_StoreSeed) {
+	if seed == nil {
+		c.seed = nil
+		return
+	}
+	c.seed = &storeSeed{seed: seed}
+}
+
+// HasSeed tells if the stores of this config start from a seed.
+func (c *Config) HasSeed() bool {
+	return c.seed != nil
+}
+
+func (s *storeSeed) load(ctx context.Context) (map[string][]byte, error) {
+	s.once.Do(func() {
+		s.kv, s.err = loadSeed(ctx, s.seed)
+	})
+	return s.kv, s.err
+}
+
+// LoadSeed resets the store to the seed of its config, the content of the
+// store at the module's initial block. It does nothing when the config has no
+// seed.
+func (s *FullKV) LoadSeed(ctx context.Context) error {
+	if s.seed == nil {
+		return nil
+	}
+
+	kv, err := s.seed.load(ctx)
+	if err != nil {
+		return fmt.Errorf("load seed of store %s: %w", s.name, err)
+	}
+
+	seeded := make(map[string][]byte, len(kv))
+	var size uint64
+	for key, value := range kv {
+		seeded[key] = value
+		size += uint64(len(key) + len(value))
+	}
+	s.resetKeys(seeded)
+	s.totalSizeBytes = size
+	s.loadedFrom = "seed"
+	if s.ttlBlocks != 0 {
+		s.updatedAt = make(map[string]uint64, len(kv))
+		for key := range kv {
+			s.updatedAt[key] = s.moduleInitialBlock
+		}
+	}
+
+	s.logger.Debug("full store seeded", zap.Int("key_count", s.keyCount()), zap.Uint64("data_size", size))
+	return nil
+}
+
+func loadSeed(ctx context.Context, seed *pbsubstreams.Module_KindStore_StoreSeed) (map[string][]byte, error) {
+	content := seed.GetContent()
+	if url := seed.GetUrl(); url != "" {
+		var err error
+		content, err = fetchSeed(ctx, url)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if seed.Sha256 != "" {
+		sum := sha256.Sum256(content)
+		if actual := hex.EncodeToString(sum[:]); !strings.EqualFold(actual, seed.Sha256) {
+			return nil, fmt.Errorf("seed hash mismatch, expected sha256 %s, got %s", seed.Sha256, actual)
+		}
+	}
+
+	return ParseSeed(content)
+}
+
+func fetchSeed(ctx context.Context, url string) ([]byte, error) {
+	reader, _, _, err := dstore.OpenObject(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("opening seed %q: %w", url, err)
+	}
+	defer reader.Close()
+
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("reading seed %q: %w", url, err)
+	}
+	return content, nil
+}
+
+// ParseSeed parses the key/values of a seed file, see
+// `Module.KindStore.StoreSeed`. Empty lines are skipped, a key seen twice is
+// an error.
+func ParseSeed(content []byte) (map[string][]byte, error) {
+	kv := make(map[string][]byte)
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(nil, 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		entry := &seedEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			return nil, fmt.Errorf("seed line %d: %w", line, err)
+		}
+		if entry.Key == "" {
+			return nil, fmt.Errorf("seed line %d: missing key", line)
+		}
+		if _, found := kv[entry.Key]; found {
+			return nil, fmt.Errorf("seed line %d: duplicate key %q", line, entry.Key)
+		}
+
+		switch {
+		case entry.Value != nil && entry.ValueBase64 != nil:
+			return nil, fmt.Errorf("seed line %d: only one of value and value_base64 can be set", line)
+		case entry.Value != nil:
+			kv[entry.Key] = []byte(*entry.Value)
+		case entry.ValueBase64 != nil:
+			kv[entry.Key] = entry.ValueBase64
+		default:
+			return nil, fmt.Errorf("seed line %d: missing value", line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading seed: %w", err)
+	}
+	return kv, nil
+}
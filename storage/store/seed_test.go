@@ -0,0 +1,103 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
+)
+
+func TestParseSeed(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		expect    map[string][]byte
+		expectErr string
+	}{
+		{
+			name:    "values",
+			content: "{\"key\": \"a\", \"value\": \"1\"}\n\n{\"key\": \"b\", \"value_base64\": \"AQI=\"}\n",
+			expect:  map[string][]byte{"a": []byte("1"), "b": {1, 2}},
+		},
+		{
+			name:    "empty value",
+			content: `{"key": "a", "value": ""}`,
+			expect:  map[string][]byte{"a": {}},
+		},
+		{name: "empty", content: "", expect: map[string][]byte{}},
+		{name: "missing key", content: `{"value": "1"}`, expectErr: "seed line 1: missing key"},
+		{name: "missing value", content: `{"key": "a"}`, expectErr: "seed line 1: missing value"},
+		{name: "both values", content: `{"key": "a", "value": "1", "value_base64": "AQI="}`, expectErr: "seed line 1: only one of value and value_base64 can be set"},
+		{name: "duplicate key", content: "{\"key\": \"a\", \"value\": \"1\"}\n{\"key\": \"a\", \"value\": \"2\"}", expectErr: "seed line 2: duplicate key \"a\""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			kv, err := ParseSeed([]byte(test.content))
+			if test.expectErr != "" {
+				require.EqualError(t, err, test.expectErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expect, kv)
+		})
+	}
+}
+
+func TestFullKV_LoadSeed(t *testing.T) {
+	content := []byte(`{"key": "a", "value": "1"}`)
+	sum := sha256.Sum256(content)
+
+	config := &Config{
+		name:               "test",
+		moduleInitialBlock: 10,
+		updatePolicy:       pbsubstreams.Module_KindStore_UPDATE_POLICY_SET,
+		valueType:          "string",
+		ttlBlocks:          100,
+		totalSizeLimit:     1_000_000,
+		itemSizeLimit:      1_000,
+	}
+	config.SetSeed(&pbsubstreams.Module_KindStore_StoreSeed{
+		Source: &pbsubstreams.Module_KindStore_StoreSeed_Content{Content: content},
+		Sha256: hex.EncodeToString(sum[:]),
+	})
+
+	s := config.NewFullKV(zap.NewNop())
+	require.NoError(t, s.LoadSeed(context.Background()))
+	value, found := s.GetLast("a")
+	require.True(t, found)
+	assert.Equal(t, []byte("1"), value)
+	assert.Equal(t, map[string]uint64{"a": 10}, s.updatedAt)
+
+	// the stores of the config don't share the seeded key/values
+	s.Set(0, "a", "2")
+	other := config.NewFullKV(zap.NewNop())
+	require.NoError(t, other.LoadSeed(context.Background()))
+	value, _ = other.GetLast("a")
+	assert.Equal(t, []byte("1"), value)
+}
+
+func TestFullKV_LoadSeed_HashMismatch(t *testing.T) {
+	config := &Config{name: "test", totalSizeLimit: 1_000_000, itemSizeLimit: 1_000}
+	config.SetSeed(&pbsubstreams.Module_KindStore_StoreSeed{
+		Source: &pbsubstreams.Module_KindStore_StoreSeed_Content{Content: []byte(`{"key": "a", "value": "1"}`)},
+		Sha256: "00",
+	})
+
+	err := config.NewFullKV(zap.NewNop()).LoadSeed(context.Background())
+	assert.ErrorContains(t, err, "seed hash mismatch")
+}
+
+func TestFullKV_LoadSeed_NoSeed(t *testing.T) {
+	config := &Config{name: "test", totalSizeLimit: 1_000_000, itemSizeLimit: 1_000}
+	s := config.NewFullKV(zap.NewNop())
+
+	require.NoError(t, s.LoadSeed(context.Background()))
+	assert.Equal(t, 0, s.keyCount())
+}
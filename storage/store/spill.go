@@ -0,0 +1,395 @@
+package store
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+)
+
+// spillCompactionRatio triggers the rewrite of a spill file when the records
+// of the overwritten or deleted values exceed that fraction of its size.
+const spillCompactionRatio = 0.5
+
+// spillBatchBytes is the size of the spilled values read back at once by
+// baseStore.forEachBatch.
+const spillBatchBytes = 64 * 1024 * 1024
+
+// spill keeps the values of a store on disk, once the entries held in memory
+// by the store exceed the threshold set with Config.SetSpill. Only the keys
+// and the position of their value stay in memory.
+//
+// Values are appended to an unlinked temporary file, removed from the disk as
+// soon as it is closed, even if the process crashes. The records of the
+// values overwritten or deleted since are reclaimed by rewriting the file when
+// they take more than half of it.
+type spill struct {
+	dir string
+
+	file    *spillFile
+	size    int64 // end of the file, where the next value is written
+	garbage int64 // bytes of the records no longer referenced
+	refs    map[string]spillRef
+}
+
+type spillRef struct {
+	offset int64
+	length int64
+}
+
+func newSpill(dir string) (*spill, error) {
+	file, err := createSpillFile(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &spill{
+		dir:  dir,
+		file: file,
+		refs: make(map[string]spillRef),
+	}, nil
+}
+
+// spillFile is the file of a spill, closed once released by the spill and by
+// the store files streaming their values from it, see storeEntries.
+type spillFile struct {
+	*os.File
+	users atomic.Int32
+}
+
+func createSpillFile(dir string) (*spillFile, error) {
+	file, err := os.CreateTemp(dir, "store-*.spill")
+	if err != nil {
+		return nil, fmt.Errorf("creating spill file: %w", err)
+	}
+	if err := os.Remove(file.Name()); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("unlinking spill file: %w", err)
+	}
+	out := &spillFile{File: file}
+	out.users.Store(1)
+	return out, nil
+}
+
+func (f *spillFile) retain() *spillFile {
+	f.users.Add(1)
+	return f
+}
+
+func (f *spillFile) release() error {
+	if f.users.Add(-1) > 0 {
+		return nil
+	}
+	return f.Close()
+}
+
+func (f *spillFile) read(key string, ref spillRef) ([]byte, error) {
+	value := make([]byte, ref.length)
+	if _, err := f.ReadAt(value, ref.offset); err != nil {
+		return nil, fmt.Errorf("reading spilled value of key %q: %w", key, err)
+	}
+	return value, nil
+}
+
+func (s *spill) has(key string) bool {
+	_, found := s.refs[key]
+	return found
+}
+
+func (s *spill) get(key string) ([]byte, bool, error) {
+	ref, found := s.refs[key]
+	if !found {
+		return nil, false, nil
+	}
+	value, err := s.file.read(key, ref)
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// drop forgets `key`, its record being reclaimed by the next compaction.
+func (s *spill) drop(key string) {
+	if ref, found := s.refs[key]; found {
+		s.garbage += ref.length
+		delete(s.refs, key)
+	}
+}
+
+// write appends the values of `kv` to the file, replacing the ones of the
+// same keys spilled before.
+func (s *spill) write(kv map[string][]byte) error {
+	if _, err := s.file.Seek(s.size, io.SeekStart); err != nil {
+		return fmt.Errorf("seeking spill file: %w", err)
+	}
+	writer := bufio.NewWriter(s.file)
+	for key, value := range kv {
+		if _, err := writer.Write(value); err != nil {
+			return fmt.Errorf("writing spill file: %w", err)
+		}
+		s.drop(key)
+		s.refs[key] = spillRef{offset: s.size, length: int64(len(value))}
+		s.size += int64(len(value))
+	}
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("writing spill file: %w", err)
+	}
+
+	if float64(s.garbage) > float64(s.size)*spillCompactionRatio {
+		return s.compact()
+	}
+	return nil
+}
+
+// compact rewrites the referenced values to a new file.
+func (s *spill) compact() error {
+	file, err := createSpillFile(s.dir)
+	if err != nil {
+		return err
+	}
+
+	refs := make(map[string]spillRef, len(s.refs))
+	writer := bufio.NewWriter(file)
+	var size int64
+	for key, ref := range s.refs {
+		if _, err := io.Copy(writer, io.NewSectionReader(s.file, ref.offset, ref.length)); err != nil {
+			file.Close()
+			return fmt.Errorf("compacting spill file: %w", err)
+		}
+		refs[key] = spillRef{offset: size, length: ref.length}
+		size += ref.length
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return fmt.Errorf("compacting spill file: %w", err)
+	}
+
+	s.file.release()
+	s.file, s.size, s.garbage, s.refs = file, size, 0, refs
+	return nil
+}
+
+func (s *spill) close() error {
+	return s.file.release()
+}
+
+// get returns the value of `key`, whether it is held in memory or spilled to
+// disk. A spill file that cannot be read is fatal to the store.
+func (b *baseStore) get(key string) ([]byte, bool) {
+	if value, found := b.kv[key]; found {
+		return value, true
+	}
+	if b.spill == nil {
+		return nil, false
+	}
+	value, found, err := b.spill.get(key)
+	if err != nil {
+		panic(fmt.Sprintf("store %q: %s", b.name, err))
+	}
+	return value, found
+}
+
+// valueOf returns the value of `key`, nil if it is not in the store.
+func (b *baseStore) valueOf(key string) []byte {
+	value, _ := b.get(key)
+	return value
+}
+
+func (b *baseStore) has(key string) bool {
+	if _, found := b.kv[key]; found {
+		return true
+	}
+	return b.spill != nil && b.spill.has(key)
+}
+
+func (b *baseStore) keyCount() int {
+	if b.spill == nil {
+		return len(b.kv)
+	}
+	return len(b.kv) + len(b.spill.refs)
+}
+
+func (b *baseStore) allKeys() []string {
+	keys := make([]string, 0, b.keyCount())
+	for key := range b.kv {
+		keys = append(keys, key)
+	}
+	if b.spill != nil {
+		for key := range b.spill.refs {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// forEach calls `f` with each entry of the store, reading the spilled values
+// from disk one at a time.
+func (b *baseStore) forEach(f func(key string, value []byte) error) error {
+	for key, value := range b.kv {
+		if err := f(key, value); err != nil {
+			return err
+		}
+	}
+	if b.spill == nil {
+		return nil
+	}
+	for key := range b.spill.refs {
+		value, _, err := b.spill.get(key)
+		if err != nil {
+			return fmt.Errorf("store %q: %w", b.name, err)
+		}
+		if err := f(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// forEachBatch calls `f` with the entries held in memory, then with the
+// spilled ones, read back from disk in batches of about spillBatchBytes.
+func (b *baseStore) forEachBatch(f func(kv map[string][]byte) error) error {
+	if err := f(b.kv); err != nil {
+		return err
+	}
+	if b.spill == nil {
+		return nil
+	}
+
+	batch := make(map[string][]byte)
+	var batchBytes int64
+	for key, ref := range b.spill.refs {
+		value, _, err := b.spill.get(key)
+		if err != nil {
+			return fmt.Errorf("store %q: %w", b.name, err)
+		}
+		batch[key] = value
+		batchBytes += ref.length
+		if batchBytes >= spillBatchBytes {
+			if err := f(batch); err != nil {
+				return err
+			}
+			batch, batchBytes = make(map[string][]byte), 0
+		}
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+	return f(batch)
+}
+
+// entries returns all the entries of the store in a single map, reading back
+// the spilled values, to write the store files with the marshallers which
+// cannot stream them, see streamEntries.
+func (b *baseStore) entries() (map[string][]byte, error) {
+	if b.spill == nil {
+		return b.kv, nil
+	}
+	out := make(map[string][]byte, b.keyCount())
+	err := b.forEach(func(key string, value []byte) error {
+		out[key] = value
+		return nil
+	})
+	return out, err
+}
+
+// streamEntries returns the entries of the store, for a StreamMarshaller to
+// read the spilled values one at a time. The spill file stays open until the
+// entries are released, even once the store dropped or compacted it, see
+// PartialKV.Roll.
+func (b *baseStore) streamEntries() *storeEntries {
+	entries := &storeEntries{name: b.name, kv: b.kv}
+	if b.spill != nil {
+		entries.file = b.spill.file.retain()
+		entries.refs = make(map[string]spillRef, len(b.spill.refs))
+		for key, ref := range b.spill.refs {
+			entries.refs[key] = ref
+		}
+	}
+	return entries
+}
+
+// storeEntries are the entries of a store, see marshaller.Entries.
+type storeEntries struct {
+	name string
+	kv   map[string][]byte
+	file *spillFile // nil when nothing is spilled
+	refs map[string]spillRef
+}
+
+func (e *storeEntries) Keys() []string {
+	keys := make([]string, 0, len(e.kv)+len(e.refs))
+	for key := range e.kv {
+		keys = append(keys, key)
+	}
+	for key := range e.refs {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func (e *storeEntries) ValueLen(key string) int {
+	if value, found := e.kv[key]; found {
+		return len(value)
+	}
+	return int(e.refs[key].length)
+}
+
+func (e *storeEntries) Value(key string) ([]byte, error) {
+	if value, found := e.kv[key]; found {
+		return value, nil
+	}
+	ref, found := e.refs[key]
+	if !found {
+		return nil, nil
+	}
+	value, err := e.file.read(key, ref)
+	if err != nil {
+		return nil, fmt.Errorf("store %q: %w", e.name, err)
+	}
+	return value, nil
+}
+
+func (e *storeEntries) release() {
+	if e.file == nil {
+		return
+	}
+	if err := e.file.release(); err != nil {
+		zlog.Warn("closing store spill file", zap.String("store", e.name), zap.Error(err))
+	}
+}
+
+// maybeSpill moves the entries held in memory to the spill file once they
+// exceed the spill threshold.
+func (b *baseStore) maybeSpill() {
+	if b.spillThreshold == 0 || b.memBytes <= b.spillThreshold {
+		return
+	}
+
+	if b.spill == nil {
+		s, err := newSpill(b.spillDir)
+		if err != nil {
+			panic(fmt.Sprintf("store %q: %s", b.name, err))
+		}
+		b.spill = s
+	}
+
+	b.logger.Debug("spilling store entries to disk", zap.Int("key_count", len(b.kv)), zap.Uint64("bytes", b.memBytes))
+	if err := b.spill.write(b.kv); err != nil {
+		panic(fmt.Sprintf("store %q: %s", b.name, err))
+	}
+	b.kv = make(map[string][]byte)
+	b.memBytes = 0
+}
+
+// Close releases the spill file of the store, if any, dropping the entries
+// spilled to it.
+func (b *baseStore) Close() error {
+	if b.spill == nil {
+		return nil
+	}
+	err := b.spill.close()
+	b.spill = nil
+	return err
+}
@@ -0,0 +1,96 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/streamingfast/dstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
+)
+
+func TestBaseStore_Spill(t *testing.T) {
+	config := &Config{
+		updatePolicy:   pbsubstreams.Module_KindStore_UPDATE_POLICY_SET,
+		valueType:      "string",
+		totalSizeLimit: 1_000_000,
+		itemSizeLimit:  1_000,
+	}
+	config.SetSpill(t.TempDir(), 100)
+	s := config.NewFullKV(zap.NewNop())
+	defer s.Close()
+
+	expected := map[string][]byte{}
+	for i := 0; i < 200; i++ {
+		key, value := fmt.Sprintf("k:%03d", i%50), fmt.Sprintf("v%d", i)
+		s.Set(uint64(i), key, value)
+		expected[key] = []byte(value)
+	}
+	require.NotNil(t, s.spill)
+	assert.LessOrEqual(t, s.memBytes, uint64(100))
+	assert.Less(t, len(s.kv), 50)
+
+	s.DeletePrefix(200, "k:01")
+	for i := 10; i < 20; i++ {
+		delete(expected, fmt.Sprintf("k:%03d", i))
+	}
+
+	value, found := s.GetLast("k:005")
+	assert.True(t, found)
+	assert.Equal(t, []byte("v155"), value)
+	assert.False(t, s.HasLast("k:012"))
+	assert.Equal(t, uint64(len(expected)), s.Length())
+
+	kv, err := s.entries()
+	require.NoError(t, err)
+	assert.Equal(t, expected, kv)
+
+	s.resetKeys(nil)
+	assert.Nil(t, s.spill)
+	assert.Zero(t, s.Length())
+}
+
+func TestPartialKV_SaveSpilled(t *testing.T) {
+	objStore, err := dstore.NewStore(t.TempDir(), "", "", false)
+	require.NoError(t, err)
+	config, err := NewConfig("test", 0, "test.module.hash", pbsubstreams.Module_KindStore_UPDATE_POLICY_SET, "string", objStore, "")
+	require.NoError(t, err)
+	config.SetSpill(t.TempDir(), 100)
+	s := config.NewPartialKV(0, zap.NewNop())
+	defer s.Close()
+
+	expected := map[string][]byte{}
+	for i := 0; i < 100; i++ {
+		key, value := fmt.Sprintf("k:%03d", i), fmt.Sprintf("v%d", i)
+		s.Set(uint64(i), key, value)
+		expected[key] = []byte(value)
+	}
+	require.NotNil(t, s.spill)
+
+	file, writer, err := s.Save(100)
+	require.NoError(t, err)
+
+	// the spilled values are still read once the store rolled to the next segment
+	s.Roll(100)
+	for i := 0; i < 100; i++ {
+		s.Set(uint64(100+i), fmt.Sprintf("k:%03d", i), "next")
+	}
+	require.NoError(t, writer.Write(context.Background()))
+
+	loaded := config.NewPartialKV(0, zap.NewNop())
+	require.NoError(t, loaded.Load(context.Background(), file))
+	kv, err := loaded.entries()
+	require.NoError(t, err)
+	assert.Equal(t, expected, kv)
+
+	merged := config.NewFullKV(zap.NewNop())
+	require.NoError(t, merged.Merge(s))
+	value, found := merged.GetLast("k:042")
+	assert.True(t, found)
+	assert.Equal(t, []byte("next"), value)
+	assert.Equal(t, uint64(100), merged.Length())
+}
@@ -0,0 +1,127 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/streamingfast/substreams/block"
+	"github.com/streamingfast/substreams/storage/store"
+)
+
+// MergeStep is a single partial file the squasher would load and merge into
+// the full store, in order.
+type MergeStep struct {
+	Partial *store.FileInfo
+	// WritesFullKV is the complete file that would be written after merging
+	// `Partial`, nil if this merge does not end on a store boundary.
+	WritesFullKV *store.FileInfo
+}
+
+// MergeExplanation describes what the squasher would do to bring a store
+// up to `TargetBlock`, without loading, merging or writing anything.
+type MergeExplanation struct {
+	ModuleHash         string
+	ModuleInitialBlock uint64
+	TargetBlock        uint64
+
+	// InitialFile is the complete file the store would be initialized from,
+	// nil when starting from an empty store at the module's initial block.
+	InitialFile *store.FileInfo
+	Steps       []*MergeStep
+
+	// ReachedBlock is the exclusive end block the store would be complete up to.
+	ReachedBlock uint64
+	// MissingRange is the first range for which no partial exists, preventing
+	// the store from completing up to `TargetBlock`. Nil when the target is reached.
+	MissingRange *block.Range
+	// Ignored lists partials that would never be merged: already covered by the
+	// initial file, produced twice by different requests, or past a missing range.
+	Ignored store.FileInfos
+}
+
+func (e *MergeExplanation) Completes() bool {
+	return e.MissingRange == nil
+}
+
+func (e *MergeExplanation) String() string {
+	var out []string
+	out = append(out, fmt.Sprintf("module hash %s, initial block %d, target block %d", e.ModuleHash, e.ModuleInitialBlock, e.TargetBlock))
+	if e.InitialFile != nil {
+		out = append(out, fmt.Sprintf("load complete file %s %s", e.InitialFile.Filename, e.InitialFile.Range))
+	} else {
+		out = append(out, fmt.Sprintf("start from empty store at block %d", e.ModuleInitialBlock))
+	}
+	for i, step := range e.Steps {
+		line := fmt.Sprintf("%d. merge partial %s %s", i+1, step.Partial.Filename, step.Partial.Range)
+		if step.WritesFullKV != nil {
+			line += fmt.Sprintf(", write complete file %s", step.WritesFullKV.Filename)
+		}
+		out = append(out, line)
+	}
+	if e.Completes() {
+		out = append(out, fmt.Sprintf("store complete up to block %d", e.ReachedBlock))
+	} else {
+		out = append(out, fmt.Sprintf("store stops at block %d, missing partial for range %s", e.ReachedBlock, e.MissingRange))
+	}
+	for _, file := range e.Ignored {
+		out = append(out, fmt.Sprintf("ignored partial %s %s", file.Filename, file.Range))
+	}
+	return strings.Join(out, "\n")
+}
+
+// ExplainMerge lists the snapshot files of the store described by `storeConfig` and
+// explains which ones the squasher would load and merge, in what order, and which
+// complete files it would write to bring the store up to `targetBlock`.
+func ExplainMerge(ctx context.Context, storeConfig *store.Config, storeSaveInterval, targetBlock uint64) (out *MergeExplanation, err error) {
+	snapshots, err := listSnapshots(ctx, storeConfig, targetBlock)
+	if err != nil {
+		return nil, err
+	}
+
+	return explainMerge(snapshots, storeConfig.ModuleHash(), storeConfig.ModuleInitialBlock(), storeSaveInterval, targetBlock), nil
+}
+
+func explainMerge(snapshots *storeSnapshots, moduleHash string, modInitBlock, storeSaveInterval, targetBlock uint64) *MergeExplanation {
+	out := &MergeExplanation{
+		ModuleHash:         moduleHash,
+		ModuleInitialBlock: modInitBlock,
+		TargetBlock:        targetBlock,
+		ReachedBlock:       modInitBlock,
+	}
+
+	if targetBlock <= modInitBlock {
+		return out
+	}
+
+	if complete := snapshots.LastCompleteSnapshotBefore(targetBlock); complete != nil {
+		out.InitialFile = complete
+		out.ReachedBlock = complete.Range.ExclusiveEndBlock
+	}
+
+	for _, partial := range snapshots.Partials {
+		switch {
+		case out.MissingRange != nil,
+			partial.Range.StartBlock != out.ReachedBlock,
+			partial.Range.ExclusiveEndBlock > targetBlock:
+			if out.MissingRange == nil && partial.Range.StartBlock > out.ReachedBlock {
+				out.MissingRange = block.NewRange(out.ReachedBlock, partial.Range.StartBlock)
+			}
+			out.Ignored = append(out.Ignored, partial)
+			continue
+		}
+
+		step := &MergeStep{Partial: partial}
+		if store.ShouldSaveFullKV(modInitBlock, storeSaveInterval, partial.Range) {
+			step.WritesFullKV = store.NewCompleteFileInfo(modInitBlock, partial.Range.ExclusiveEndBlock)
+		}
+		out.Steps = append(out.Steps, step)
+		out.ReachedBlock = partial.Range.ExclusiveEndBlock
+	}
+
+	if out.MissingRange == nil && out.ReachedBlock < targetBlock {
+		out.MissingRange = block.NewRange(out.ReachedBlock, targetBlock)
+	}
+
+	return out
+}
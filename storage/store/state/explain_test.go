@@ -0,0 +1,102 @@
+package state
+
+import (
+	"testing"
+
+	"github.com/streamingfast/substreams/block"
+	"github.com/streamingfast/substreams/storage/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExplainMerge(t *testing.T) {
+	tests := []struct {
+		name          string
+		snapshots     *storeSnapshots
+		targetBlock   uint64
+		expectInitial *store.FileInfo
+		expectMerged  string
+		expectWrites  []uint64
+		expectReached uint64
+		expectMissing *block.Range
+		expectIgnored string
+	}{
+		{
+			name: "complete from partials",
+			snapshots: &storeSnapshots{
+				Partials: store.PartialFiles("10-20,20-30,30-40"),
+			},
+			targetBlock:   40,
+			expectMerged:  "10-20,20-30,30-40",
+			expectWrites:  []uint64{20, 30, 40},
+			expectReached: 40,
+		},
+		{
+			name: "starts from last complete",
+			snapshots: &storeSnapshots{
+				Completes: store.CompleteFiles("10-20,10-30"),
+				Partials:  store.PartialFiles("20-30,30-40"),
+			},
+			targetBlock:   40,
+			expectInitial: store.CompleteFile("10-30"),
+			expectMerged:  "30-40",
+			expectWrites:  []uint64{40},
+			expectReached: 40,
+			expectIgnored: "20-30",
+		},
+		{
+			name: "hole in partials",
+			snapshots: &storeSnapshots{
+				Partials: store.PartialFiles("10-20,30-40"),
+			},
+			targetBlock:   40,
+			expectMerged:  "10-20",
+			expectWrites:  []uint64{20},
+			expectReached: 20,
+			expectMissing: block.NewRange(20, 30),
+			expectIgnored: "30-40",
+		},
+		{
+			name: "missing last partial",
+			snapshots: &storeSnapshots{
+				Partials: store.PartialFiles("10-20"),
+			},
+			targetBlock:   40,
+			expectMerged:  "10-20",
+			expectWrites:  []uint64{20},
+			expectReached: 20,
+			expectMissing: block.NewRange(20, 40),
+		},
+		{
+			name: "partial not on boundary does not write",
+			snapshots: &storeSnapshots{
+				Partials: store.PartialFiles("10-20,20-25"),
+			},
+			targetBlock:   25,
+			expectMerged:  "10-20,20-25",
+			expectWrites:  []uint64{20},
+			expectReached: 25,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res := explainMerge(test.snapshots, "abc", 10, 10, test.targetBlock)
+
+			assert.Equal(t, test.expectInitial, res.InitialFile)
+
+			var merged store.FileInfos
+			var writes []uint64
+			for _, step := range res.Steps {
+				merged = append(merged, step.Partial)
+				if step.WritesFullKV != nil {
+					writes = append(writes, step.WritesFullKV.Range.ExclusiveEndBlock)
+				}
+			}
+			assert.Equal(t, testRanges(t, test.expectMerged), merged.Ranges())
+			assert.Equal(t, test.expectWrites, writes)
+			assert.Equal(t, test.expectReached, res.ReachedBlock)
+			assert.Equal(t, test.expectMissing, res.MissingRange)
+			assert.Equal(t, testRanges(t, test.expectIgnored), res.Ignored.Ranges())
+		})
+	}
+}
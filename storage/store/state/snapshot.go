@@ -43,13 +43,15 @@ func (s *storeSnapshots) LastCompletedBlock() uint64 {
 	return s.Completes[len(s.Completes)-1].Range.ExclusiveEndBlock
 }
 
+// LastCompleteSnapshotBefore returns the largest complete snapshot covering
+// no block at or beyond `blockNum`, nil if there is none.
 func (s *storeSnapshots) LastCompleteSnapshotBefore(blockNum uint64) *store.FileInfo {
+	before := block.Ranges{block.NewRange(0, blockNum)}
 	for i := len(s.Completes); i > 0; i-- {
 		comp := s.Completes[i-1]
-		if comp.Range.ExclusiveEndBlock > blockNum {
-			continue
+		if len(block.Ranges{comp.Range}.Subtract(before)) == 0 {
+			return comp
 		}
-		return comp
 	}
 	return nil
 }
@@ -69,15 +71,37 @@ type Snapshot struct {
 	Path string
 }
 
+// listSnapshots lists the snapshots of `storeConfig` below `below`, leaving
+// out the ones written by its uncommitted flushes, see store.Commits. The
+// resume points are listed with the complete snapshots.
 func listSnapshots(ctx context.Context, storeConfig *store.Config, below uint64) (*storeSnapshots, error) {
 	out := &storeSnapshots{}
 
+	var uncommitted *store.UncommittedFlushes
+	if commits := storeConfig.Commits(); commits != nil && below != 0 {
+		var err error
+		if uncommitted, err = commits.Uncommitted(ctx, storeConfig.ModuleHash(), below); err != nil {
+			return nil, fmt.Errorf("fetching uncommitted flushes: %w", err)
+		}
+	}
+
 	files, err := storeConfig.ListSnapshotFiles(ctx, below)
 	if err != nil {
 		return nil, fmt.Errorf("list snapshots: %w", err)
 	}
 
+	if below != 0 {
+		resumePoints, err := storeConfig.ListResumePoints(ctx, below)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, resumePoints...)
+	}
+
 	for _, file := range files {
+		if uncommitted.Discards(file) {
+			continue
+		}
 		if file.Partial {
 			out.Partials = append(out.Partials, file)
 		} else {
@@ -30,21 +30,19 @@ func NewStoreStorageState(modName string, storeSaveInterval, modInitBlock, workU
 		return nil, fmt.Errorf("cannot have saved last store before module's init block")
 	}
 
-	parallelProcessStartBlock := modInitBlock
+	missing := block.Ranges{block.NewRange(modInitBlock, workUpToBlockNum)}
 	if completeSnapshot != nil {
-		parallelProcessStartBlock = completeSnapshot.Range.ExclusiveEndBlock
 		out.InitialCompleteFile = completeSnapshot
-
-		if completeSnapshot.Range.ExclusiveEndBlock == workUpToBlockNum {
-			return
-		}
+		missing = missing.Subtract(block.Ranges{completeSnapshot.Range})
 	}
 
-	for ptr := parallelProcessStartBlock; ptr < workUpToBlockNum; {
-		end := utils.MinOf(ptr-ptr%storeSaveInterval+storeSaveInterval, workUpToBlockNum)
-		out.PartialsMissing = append(out.PartialsMissing, block.NewRange(ptr, end))
+	for _, missingRange := range missing {
+		for ptr := missingRange.StartBlock; ptr < missingRange.ExclusiveEndBlock; {
+			end := utils.MinOf(ptr-ptr%storeSaveInterval+storeSaveInterval, missingRange.ExclusiveEndBlock)
+			out.PartialsMissing = append(out.PartialsMissing, block.NewRange(ptr, end))
 
-		ptr = end
+			ptr = end
+		}
 	}
 	return
 }
@@ -40,7 +40,7 @@ func TestWorkUnits_init(t *testing.T) {
 			reqStart:          reqStart,
 		}
 		c.expectInitLoad = store.CompleteFile(expectInitLoad)
-		c.expectMissing = block.ParseRanges(expectMissing)
+		c.expectMissing = testRanges(t, expectMissing)
 		return c
 	}
 
@@ -139,3 +139,11 @@ func parseSnapshotSpec(in string) *storeSnapshots {
 	out.Sort()
 	return out
 }
+
+func testRanges(t *testing.T, in string) block.Ranges {
+	t.Helper()
+
+	out, err := block.NewRangesFromString(in)
+	require.NoError(t, err)
+	return out
+}
@@ -2,9 +2,9 @@ package store
 
 import (
 	"sort"
-	"strings"
 
 	pbssinternal "github.com/streamingfast/substreams/pb/sf/substreams/intern/v2"
+	pbstore "github.com/streamingfast/substreams/storage/store/marshaller/pb"
 )
 
 //func (s *baseStore) Del(ord uint64, key string) {
@@ -27,23 +27,77 @@ import (
 func (b *baseStore) DeletePrefix(ord uint64, prefix string) {
 	b.bumpOrdinal(ord)
 
-	var deltas []*pbssinternal.StoreDelta
-	for key, val := range b.kv {
-		if !strings.HasPrefix(key, prefix) {
-			continue
-		}
+	for _, key := range b.keys().prefixKeys(prefix) {
 		delta := &pbssinternal.StoreDelta{
 			Operation: pbssinternal.StoreDelta_DELETE,
 			Ordinal:   ord,
 			Key:       key,
-			OldValue:  val,
+			OldValue:  b.valueOf(key),
 			NewValue:  nil,
 		}
 		b.ApplyDelta(delta)
-		deltas = append(deltas, delta)
+		b.deltas = append(b.deltas, delta)
+	}
+}
+
+// DeleteRange deletes the keys from `startKey` (inclusive) to `endKey`
+// (exclusive), recorded as a single DELETE_RANGE delta holding the deleted
+// entries. Like DeletePrefix, no delta is recorded when no key is deleted.
+func (b *baseStore) DeleteRange(ord uint64, startKey, endKey string) {
+	b.bumpOrdinal(ord)
+
+	delta := &pbssinternal.StoreDelta{
+		Operation: pbssinternal.StoreDelta_DELETE_RANGE,
+		Ordinal:   ord,
+		Key:       startKey,
+		EndKey:    endKey,
+		Deleted:   map[string][]byte{},
+	}
+	if startKey < endKey {
+		for _, key := range b.keys().rangeKeys(startKey, endKey) {
+			delta.Deleted[key] = b.valueOf(key)
+		}
+	}
+	if len(delta.Deleted) == 0 {
+		return
+	}
+	b.ApplyDelta(delta)
+	b.deltas = append(b.deltas, delta)
+}
+
+// deleteKeyRanges deletes the keys covered by `keyRanges` without recording
+// deltas.
+func (b *baseStore) deleteKeyRanges(keyRanges []*pbstore.KeyRange) {
+	for _, keyRange := range keyRanges {
+		if keyRange.StartKey >= keyRange.EndKey {
+			continue
+		}
+		for _, key := range b.keys().rangeKeys(keyRange.StartKey, keyRange.EndKey) {
+			b.totalSizeBytes -= uint64(len(key) + len(b.valueOf(key)))
+			b.deleteKey(key)
+		}
+	}
+}
+
+// compactKeyRanges sorts `keyRanges` and merges the overlapping and adjacent
+// ones.
+func compactKeyRanges(keyRanges []*pbstore.KeyRange) (out []*pbstore.KeyRange) {
+	sorted := make([]*pbstore.KeyRange, 0, len(keyRanges))
+	for _, keyRange := range keyRanges {
+		if keyRange.StartKey < keyRange.EndKey {
+			sorted = append(sorted, keyRange)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].StartKey < sorted[j].StartKey })
+
+	for _, keyRange := range sorted {
+		if last := len(out) - 1; last >= 0 && keyRange.StartKey <= out[last].EndKey {
+			if keyRange.EndKey > out[last].EndKey {
+				out[last] = &pbstore.KeyRange{StartKey: out[last].StartKey, EndKey: keyRange.EndKey}
+			}
+			continue
+		}
+		out = append(out, keyRange)
 	}
-	sort.Slice(deltas, func(i, j int) bool {
-		return deltas[i].Key < deltas[j].Key
-	})
-	b.deltas = append(b.deltas, deltas...)
+	return out
 }
@@ -8,7 +8,8 @@ import (
 
 func (b *baseStore) GetFirst(key string) ([]byte, bool) {
 	for _, delta := range b.deltas {
-		if delta.Key != key {
+		delta, ok := deltaForKey(delta, key)
+		if !ok {
 			continue
 		}
 
@@ -24,13 +25,14 @@ func (b *baseStore) GetFirst(key string) ([]byte, bool) {
 
 	}
 
-	val, found := b.kv[key]
+	val, found := b.get(key)
 	return val, found
 }
 
 func (b *baseStore) HasFirst(key string) bool {
 	for _, delta := range b.deltas {
-		if delta.Key != key {
+		delta, ok := deltaForKey(delta, key)
+		if !ok {
 			continue
 		}
 
@@ -46,14 +48,15 @@ func (b *baseStore) HasFirst(key string) bool {
 
 	}
 
-	_, found := b.kv[key]
+	found := b.has(key)
 	return found
 }
 
 func (b *baseStore) GetLast(key string) ([]byte, bool) {
 	for i := len(b.deltas) - 1; i >= 0; i-- {
 		delta := b.deltas[i]
-		if delta.Key != key {
+		delta, ok := deltaForKey(delta, key)
+		if !ok {
 			continue
 		}
 
@@ -67,14 +70,15 @@ func (b *baseStore) GetLast(key string) ([]byte, bool) {
 		}
 	}
 
-	val, found := b.kv[key]
+	val, found := b.get(key)
 	return val, found
 }
 
 func (b *baseStore) HasLast(key string) bool {
 	for i := len(b.deltas) - 1; i >= 0; i-- {
 		delta := b.deltas[i]
-		if delta.Key != key {
+		delta, ok := deltaForKey(delta, key)
+		if !ok {
 			continue
 		}
 
@@ -88,7 +92,7 @@ func (b *baseStore) HasLast(key string) bool {
 		}
 	}
 
-	_, found := b.kv[key]
+	found := b.has(key)
 	return found
 }
 
@@ -101,7 +105,8 @@ func (b *baseStore) GetAt(ord uint64, key string) (out []byte, found bool) {
 		if delta.Ordinal <= ord {
 			break
 		}
-		if delta.Key != key {
+		delta, ok := deltaForKey(delta, key)
+		if !ok {
 			continue
 		}
 
@@ -130,7 +135,8 @@ func (b *baseStore) HasAt(ord uint64, key string) bool {
 			break
 		}
 
-		if delta.Key != key {
+		delta, ok := deltaForKey(delta, key)
+		if !ok {
 			continue
 		}
 
@@ -147,3 +153,22 @@ func (b *baseStore) HasAt(ord uint64, key string) bool {
 
 	return found
 }
+
+// deltaForKey returns the change of `key` made by `delta`, if any, a
+// DELETE_RANGE delta deleting `key` being seen as a DELETE delta.
+func deltaForKey(delta *pbssinternal.StoreDelta, key string) (*pbssinternal.StoreDelta, bool) {
+	if delta.Operation != pbssinternal.StoreDelta_DELETE_RANGE {
+		return delta, delta.Key == key
+	}
+
+	val, found := delta.Deleted[key]
+	if !found {
+		return nil, false
+	}
+	return &pbssinternal.StoreDelta{
+		Operation: pbssinternal.StoreDelta_DELETE,
+		Ordinal:   delta.Ordinal,
+		Key:       key,
+		OldValue:  val,
+	}, true
+}
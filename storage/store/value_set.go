@@ -7,6 +7,18 @@ import (
 	pbssinternal "github.com/streamingfast/substreams/pb/sf/substreams/intern/v2"
 )
 
+// ImmutableKeyError is raised when writing to, or merging, a key that already
+// exists in an immutable store. It only depends on the store content, so
+// the error is deterministic.
+type ImmutableKeyError struct {
+	Store string
+	Key   string
+}
+
+func (e *ImmutableKeyError) Error() string {
+	return fmt.Sprintf("store %q is immutable: key %q already exists", e.Store, e.Key)
+}
+
 func (b *baseStore) SetBytesIfNotExists(ord uint64, key string, value []byte) {
 	b.setIfNotExists(ord, key, value)
 }
@@ -43,6 +55,10 @@ func (b *baseStore) set(ord uint64, key string, value []byte) {
 	copy(cpValue, value)
 
 	val, found := b.GetLast(key)
+	if found && b.immutable {
+		panic(&ImmutableKeyError{Store: b.name, Key: key})
+	}
+
 	var delta *pbssinternal.StoreDelta
 	if found {
 		delta = &pbssinternal.StoreDelta{
@@ -69,6 +85,9 @@ func (b *baseStore) set(ord uint64, key string, value []byte) {
 func (b *baseStore) setIfNotExists(ord uint64, key string, value []byte) {
 	_, found := b.GetLast(key)
 	if found {
+		if b.immutable {
+			panic(&ImmutableKeyError{Store: b.name, Key: key})
+		}
 		return
 	}
 
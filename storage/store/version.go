@@ -0,0 +1,124 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Store files start with a header holding versionMagic followed by the version
+// of their layout, as a big endian uint16, so that future format changes can
+// read or migrate the files of older versions (see MigrateStateFile) and refuse
+// those written by newer ones. Files without a header are of version 0.
+var versionMagic = []byte("\x00sssv")
+
+const versionHeaderSize = 7 // versionMagic and a uint16
+
+// StateFileVersion is the version of the store files written:
+//
+//   - 0: the content encoded by the store codec (see package marshaller),
+//     optionally followed by the checksum footer.
+//   - 1: the version header, the content encoded by the store codec, and the
+//     checksum footer of both.
+const StateFileVersion uint16 = 1
+
+// stateFileMigrations turn the content of a store file of version `n` into the
+// content of version `n+1`, by version `n`.
+var stateFileMigrations = map[uint16]func(content []byte) ([]byte, error){
+	0: func(content []byte) ([]byte, error) { return content, nil },
+}
+
+// UnsupportedStateFileVersionError is returned when loading a store file
+// written in a version more recent than StateFileVersion.
+type UnsupportedStateFileVersionError struct {
+	Filename string
+	Version  uint16
+}
+
+func (e *UnsupportedStateFileVersionError) Error() string {
+	return fmt.Sprintf("state file %s is of version %d, only versions up to %d are supported", e.Filename, e.Version, StateFileVersion)
+}
+
+// encodeStateFile returns the store file holding `content`, encoded by the
+// store codec, in version StateFileVersion.
+func encodeStateFile(content []byte) []byte {
+	header := make([]byte, versionHeaderSize)
+	copy(header, versionMagic)
+	binary.BigEndian.PutUint16(header[len(versionMagic):], StateFileVersion)
+
+	return withChecksum(append(header, content...))
+}
+
+// writeStateFile writes the store file holding the content written by
+// `marshal` to `w`, like encodeStateFile, as the content is produced. It returns
+// the size of the file written.
+func writeStateFile(w io.Writer, marshal func(w io.Writer) error) (size uint64, err error) {
+	buffered := bufio.NewWriterSize(w, 64*1024)
+	hasher := sha256.New()
+	counter := &countingWriter{}
+	out := io.MultiWriter(buffered, hasher, counter)
+
+	header := make([]byte, versionHeaderSize)
+	copy(header, versionMagic)
+	binary.BigEndian.PutUint16(header[len(versionMagic):], StateFileVersion)
+	if _, err := out.Write(header); err != nil {
+		return 0, err
+	}
+	if err := marshal(out); err != nil {
+		return 0, err
+	}
+
+	footer := append(hasher.Sum(nil), checksumMagic...)
+	if _, err := buffered.Write(footer); err != nil {
+		return 0, err
+	}
+	if err := buffered.Flush(); err != nil {
+		return 0, err
+	}
+	return counter.count + uint64(len(footer)), nil
+}
+
+type countingWriter struct {
+	count uint64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.count += uint64(len(p))
+	return len(p), nil
+}
+
+// decodeStateFile returns the content of the store file `data`, to be decoded
+// by the store codec, migrated to StateFileVersion when it's of an older
+// version.
+func decodeStateFile(filename string, data []byte) ([]byte, error) {
+	_, content, err := readStateFile(filename, data)
+	return content, err
+}
+
+// readStateFile returns the version of the store file `data` and its content,
+// migrated to StateFileVersion.
+func readStateFile(filename string, data []byte) (version uint16, content []byte, err error) {
+	content, err = verifyChecksum(filename, data)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if len(content) >= versionHeaderSize && bytes.HasPrefix(content, versionMagic) {
+		version = binary.BigEndian.Uint16(content[len(versionMagic):versionHeaderSize])
+		content = content[versionHeaderSize:]
+	}
+	if version > StateFileVersion {
+		return version, nil, &UnsupportedStateFileVersionError{Filename: filename, Version: version}
+	}
+
+	for v := version; v < StateFileVersion; v++ {
+		content, err = stateFileMigrations[v](content)
+		if err != nil {
+			return version, nil, fmt.Errorf("migrating state file %s from version %d: %w", filename, v, err)
+		}
+	}
+	return version, content, nil
+}
@@ -0,0 +1,105 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/streamingfast/dstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/streamingfast/substreams/storage/store/marshaller"
+)
+
+func TestStateFile_Versions(t *testing.T) {
+	content, err := marshaller.Default().Marshal(&marshaller.StoreData{Kv: map[string][]byte{"key": []byte("value")}})
+	require.NoError(t, err)
+
+	data := encodeStateFile(content)
+	decoded, err := decodeStateFile("file", data)
+	require.NoError(t, err)
+	assert.Equal(t, content, decoded)
+
+	decoded, err = decodeStateFile("file", content)
+	require.NoError(t, err, "version 0, without header nor footer")
+	assert.Equal(t, content, decoded)
+
+	decoded, err = decodeStateFile("file", withChecksum(content))
+	require.NoError(t, err, "version 0, with a footer")
+	assert.Equal(t, content, decoded)
+
+	future := append(append([]byte{}, versionMagic...), 0xff, 0xff)
+	_, err = decodeStateFile("file", withChecksum(append(future, content...)))
+	var versionErr *UnsupportedStateFileVersionError
+	require.True(t, errors.As(err, &versionErr))
+	assert.Equal(t, uint16(0xffff), versionErr.Version)
+}
+
+func TestWriteStateFile(t *testing.T) {
+	data := &marshaller.StoreData{Kv: map[string][]byte{"b": []byte("2"), "a": []byte("1")}}
+	content, err := (&marshaller.Columnar{}).Marshal(data)
+	require.NoError(t, err)
+
+	buf := bytes.NewBuffer(nil)
+	size, err := writeStateFile(buf, func(w io.Writer) error { return (&marshaller.Columnar{}).MarshalTo(w, data) })
+	require.NoError(t, err)
+	assert.Equal(t, encodeStateFile(content), buf.Bytes())
+	assert.Equal(t, uint64(buf.Len()), size)
+}
+
+func TestMigrateStateFiles(t *testing.T) {
+	ctx := context.Background()
+	stateStore, err := dstore.NewStore("file://"+t.TempDir(), "", "", true)
+	require.NoError(t, err)
+
+	content, err := marshaller.Default().Marshal(&marshaller.StoreData{Kv: map[string][]byte{"key": []byte("value")}})
+	require.NoError(t, err)
+	files := map[string][]byte{
+		"abc/states/0000001000-0000000010.kv":      content,
+		"abc/states/0000002000-0000001000.partial": withChecksum(content),
+		"abc/states/0000003000-0000000010.kv":      encodeStateFile(content),
+		"def/states/0000001000-0000000000.kv":      content,
+	}
+	for filename, data := range files {
+		require.NoError(t, saveStore(ctx, stateStore, filename, data))
+	}
+
+	var printed []string
+	migrated, err := MigrateStateFiles(ctx, stateStore, []string{"abc"}, true, func(filePath string) {
+		printed = append(printed, filePath)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, migrated)
+	assert.Equal(t, []string{
+		"abc/states/0000001000-0000000010.kv",
+		"abc/states/0000002000-0000001000.partial",
+	}, printed)
+
+	data, err := readObject(ctx, stateStore, "abc/states/0000001000-0000000010.kv")
+	require.NoError(t, err)
+	assert.Equal(t, content, data, "dry run")
+
+	migrated, err = MigrateStateFiles(ctx, stateStore, nil, false, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 3, migrated)
+
+	for filename := range files {
+		data, err := readObject(ctx, stateStore, filename)
+		require.NoError(t, err)
+		assert.Equal(t, encodeStateFile(content), data, filename)
+	}
+
+	migrated, err = MigrateStateFiles(ctx, stateStore, nil, false, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 0, migrated)
+
+	require.NoError(t, saveStore(ctx, stateStore, "def/states/0000002000-0000000000.kv", []byte("garbage")))
+	_, err = MigrateStateFiles(ctx, stateStore, nil, false, nil)
+	assert.Error(t, err, "files that can't be decoded are not rewritten")
+	data, err = readObject(ctx, stateStore, "def/states/0000002000-0000000000.kv")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("garbage"), data)
+}
@@ -2,15 +2,62 @@ package store
 
 import (
 	"context"
+	"fmt"
+	"io"
+
 	"github.com/streamingfast/dstore"
+
+	"github.com/streamingfast/substreams/storage/idempotency"
 )
 
+// fileWriter writes a store file, either its `content` or the content
+// produced by `marshal`, streamed to the object store, see PartialKV.Save.
 type fileWriter struct {
 	store    dstore.Store
 	filename string
 	content  []byte
+
+	marshal func(w io.Writer) error
+	size    uint64 // size of the streamed file, once written
+	release func() // if set, called once written, releasing what `marshal` reads
+
+	ledger  *idempotency.Ledger // nil when the writes are not checked, see Config.SetIdempotencyLedger
+	traceID string
+}
+
+// Size is the size in bytes of the file written.
+func (f *fileWriter) Size() uint64 {
+	if f.marshal != nil {
+		return f.size
+	}
+	return uint64(len(f.content))
 }
 
-func (f *fileWriter) Write(ctx context.Context) error {
-	return saveStore(ctx, f.store, f.filename, f.content)
+func (f *fileWriter) Write(ctx context.Context) (err error) {
+	if f.release != nil {
+		defer f.release()
+	}
+	written, err := f.ledger.Write(ctx, f.store, f.filename, f.traceID, f.write)
+	if err != nil || written || f.marshal == nil {
+		return err
+	}
+
+	// already written, the size of the streamed file is the one stored
+	attrs, err := f.store.ObjectAttributes(ctx, f.filename)
+	if err != nil {
+		return fmt.Errorf("reading attributes of %s: %w", f.filename, err)
+	}
+	f.size = uint64(attrs.Size)
+	return nil
+}
+
+func (f *fileWriter) write(ctx context.Context) (err error) {
+	if f.marshal == nil {
+		return saveStore(ctx, f.store, f.filename, f.content)
+	}
+
+	f.size, err = streamStore(ctx, f.store, f.filename, func(w io.Writer) (uint64, error) {
+		return writeStateFile(w, f.marshal)
+	})
+	return err
 }
@@ -0,0 +1,183 @@
+// Package traced records a span for each call made to an object store and
+// marks its failures, see Store.
+package traced
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/streamingfast/dstore"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/streamingfast/substreams/reqctx"
+	"github.com/streamingfast/substreams/storage"
+)
+
+var _ dstore.Store = (*Store)(nil)
+var _ dstore.Clonable = (*clonableStore)(nil)
+
+// Store wraps an object store and records a span for each call made to it,
+// child of the span found in the call's context. The spans of the state store
+// calls (loading and saving snapshots, reading and writing the cached module
+// outputs) are then part of the trace of the request making them, on tier1 and
+// on tier2 alike.
+//
+// The calls failing for another reason than the object missing return a
+// storage.UnavailableError, telling the clients their request can be retried.
+//
+// The sub-stores are wrapped too. A store which is clonable stays clonable.
+type Store struct {
+	dstore.Store
+}
+
+func NewStore(base dstore.Store) dstore.Store {
+	if _, ok := base.(dstore.Clonable); ok {
+		return &clonableStore{Store: &Store{Store: base}}
+	}
+	return &Store{Store: base}
+}
+
+func (s *Store) span(ctx context.Context, operation string, name string) (context.Context, reqctx.ISpan) {
+	ctx, span := reqctx.WithSpan(ctx, "dstore/"+operation)
+	span.SetAttributes(attribute.String("dstore.object", s.Store.ObjectPath(name)))
+	return ctx, span
+}
+
+// unavailable returns `err`, the failure of the call `operation`, as a
+// storage.UnavailableError unless the object is missing or the call was
+// canceled.
+func unavailable(ctx context.Context, operation string, err error) error {
+	if err == nil || errors.Is(err, dstore.ErrNotFound) || ctx.Err() != nil {
+		return err
+	}
+	return &storage.UnavailableError{Operation: operation, Err: err}
+}
+
+// OpenObject records a span ending when the object returned is closed, so it
+// covers the download of the object.
+func (s *Store) OpenObject(ctx context.Context, name string) (out io.ReadCloser, err error) {
+	ctx, span := s.span(ctx, "open_object", name)
+	out, err = s.Store.OpenObject(ctx, name)
+	if err != nil {
+		err = unavailable(ctx, "open_object", err)
+		span.EndWithErr(&err)
+		return nil, err
+	}
+	return &tracedReader{ReadCloser: out, span: span}, nil
+}
+
+func (s *Store) FileExists(ctx context.Context, name string) (exists bool, err error) {
+	ctx, span := s.span(ctx, "file_exists", name)
+	defer span.EndWithErr(&err)
+	exists, err = s.Store.FileExists(ctx, name)
+	return exists, unavailable(ctx, "file_exists", err)
+}
+
+func (s *Store) ObjectAttributes(ctx context.Context, name string) (attrs *dstore.ObjectAttributes, err error) {
+	ctx, span := s.span(ctx, "object_attributes", name)
+	defer span.EndWithErr(&err)
+	attrs, err = s.Store.ObjectAttributes(ctx, name)
+	return attrs, unavailable(ctx, "object_attributes", err)
+}
+
+func (s *Store) WriteObject(ctx context.Context, name string, f io.Reader) (err error) {
+	ctx, span := s.span(ctx, "write_object", name)
+	defer span.EndWithErr(&err)
+	return unavailable(ctx, "write_object", s.Store.WriteObject(ctx, name, f))
+}
+
+func (s *Store) PushLocalFile(ctx context.Context, localFile, toBaseName string) (err error) {
+	ctx, span := s.span(ctx, "push_local_file", toBaseName)
+	defer span.EndWithErr(&err)
+	return unavailable(ctx, "push_local_file", s.Store.PushLocalFile(ctx, localFile, toBaseName))
+}
+
+func (s *Store) CopyObject(ctx context.Context, src, dest string) (err error) {
+	ctx, span := s.span(ctx, "copy_object", dest)
+	defer span.EndWithErr(&err)
+	return unavailable(ctx, "copy_object", s.Store.CopyObject(ctx, src, dest))
+}
+
+func (s *Store) DeleteObject(ctx context.Context, name string) (err error) {
+	ctx, span := s.span(ctx, "delete_object", name)
+	defer span.EndWithErr(&err)
+	return unavailable(ctx, "delete_object", s.Store.DeleteObject(ctx, name))
+}
+
+func (s *Store) Walk(ctx context.Context, prefix string, f func(filename string) error) (err error) {
+	ctx, span := s.span(ctx, "walk", prefix)
+	defer span.EndWithErr(&err)
+	walkFunc, failed := callbackErr(f)
+	err = s.Store.Walk(ctx, prefix, walkFunc)
+	if failed(err) {
+		return err
+	}
+	return unavailable(ctx, "walk", err)
+}
+
+func (s *Store) WalkFrom(ctx context.Context, prefix, startingPoint string, f func(filename string) error) (err error) {
+	ctx, span := s.span(ctx, "walk", prefix)
+	defer span.EndWithErr(&err)
+	walkFunc, failed := callbackErr(f)
+	err = s.Store.WalkFrom(ctx, prefix, startingPoint, walkFunc)
+	if failed(err) {
+		return err
+	}
+	return unavailable(ctx, "walk", err)
+}
+
+// callbackErr wraps the callback `f` of a walk, `failed` telling whether the
+// error of the walk is the one returned by `f`, which is not a failure of the
+// store.
+func callbackErr(f func(filename string) error) (wrapped func(filename string) error, failed func(error) bool) {
+	var fErr error
+	wrapped = func(filename string) error {
+		fErr = f(filename)
+		return fErr
+	}
+	failed = func(err error) bool {
+		return err != nil && errors.Is(err, fErr)
+	}
+	return wrapped, failed
+}
+
+func (s *Store) ListFiles(ctx context.Context, prefix string, max int) (files []string, err error) {
+	ctx, span := s.span(ctx, "list_files", prefix)
+	defer span.EndWithErr(&err)
+	files, err = s.Store.ListFiles(ctx, prefix, max)
+	return files, unavailable(ctx, "list_files", err)
+}
+
+func (s *Store) SubStore(subFolder string) (dstore.Store, error) {
+	sub, err := s.Store.SubStore(subFolder)
+	if err != nil {
+		return nil, err
+	}
+	return NewStore(sub), nil
+}
+
+type clonableStore struct {
+	*Store
+}
+
+func (s *clonableStore) Clone(ctx context.Context) (dstore.Store, error) {
+	base, err := s.Store.Store.(dstore.Clonable).Clone(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return NewStore(base), nil
+}
+
+type tracedReader struct {
+	io.ReadCloser
+	span reqctx.ISpan
+	once sync.Once
+}
+
+func (r *tracedReader) Close() (err error) {
+	err = r.ReadCloser.Close()
+	r.once.Do(func() { r.span.EndWithErr(&err) })
+	return err
+}
@@ -0,0 +1,88 @@
+package traced
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/streamingfast/dstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/streamingfast/substreams/reqctx"
+	"github.com/streamingfast/substreams/storage"
+)
+
+func TestStore(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	ctx := reqctx.WithTracer(context.Background(), sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test"))
+	ctx, request := reqctx.WithSpan(ctx, "request")
+
+	base, err := dstore.NewStore("file://"+t.TempDir(), "", "", false)
+	require.NoError(t, err)
+	store := NewStore(base)
+	_, clonable := store.(dstore.Clonable)
+	assert.True(t, clonable)
+
+	sub, err := store.SubStore("abcdef/states")
+	require.NoError(t, err)
+	require.NoError(t, sub.WriteObject(ctx, "0000001000-0000000000.kv", bytes.NewReader([]byte("content"))))
+	reader, err := sub.OpenObject(ctx, "0000001000-0000000000.kv")
+	require.NoError(t, err)
+	content, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "content", string(content))
+	assert.Len(t, recorder.Ended(), 1, "open_object ends when the object is closed")
+	require.NoError(t, reader.Close())
+	request.End()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+	assert.Equal(t, "dstore/write_object", spans[0].Name())
+	assert.Equal(t, "dstore/open_object", spans[1].Name())
+	for _, span := range spans[:2] {
+		assert.Equal(t, request.SpanContext().SpanID(), span.Parent().SpanID(), "child of the request span")
+		assert.Contains(t, span.Attributes()[0].Value.AsString(), "abcdef/states/0000001000-0000000000.kv")
+	}
+
+	assert.IsType(t, &Store{}, NewStore(dstore.NewMockStore(nil)), "not clonable")
+}
+
+func TestStore_Unavailable(t *testing.T) {
+	ctx := context.Background()
+	base := dstore.NewMockStore(nil)
+	base.SetFile("present", []byte("content"))
+	base.OpenObjectFunc = func(ctx context.Context, name string) (io.ReadCloser, error) {
+		if name == "missing" {
+			return nil, dstore.ErrNotFound
+		}
+		return nil, errors.New("throttled")
+	}
+	callbackErr := errors.New("callback")
+	base.WalkFunc = func(ctx context.Context, prefix string, f func(filename string) error) error {
+		return f("present")
+	}
+	store := NewStore(base)
+
+	_, err := store.OpenObject(ctx, "missing")
+	assert.ErrorIs(t, err, dstore.ErrNotFound)
+	assert.False(t, errors.As(err, new(*storage.UnavailableError)))
+
+	_, err = store.OpenObject(ctx, "present")
+	var errUnavailable *storage.UnavailableError
+	require.ErrorAs(t, err, &errUnavailable)
+	assert.Equal(t, "open_object", errUnavailable.Operation)
+	assert.EqualError(t, err, "throttled")
+
+	err = store.Walk(ctx, "", func(filename string) error { return callbackErr })
+	assert.Equal(t, callbackErr, err, "the error of the callback is returned as is")
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = store.OpenObject(canceled, "present")
+	assert.False(t, errors.As(err, new(*storage.UnavailableError)), "canceled")
+}
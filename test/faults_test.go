@@ -0,0 +1,88 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/streamingfast/substreams/storage/faulty"
+)
+
+// The scheduler and the squashers, under object store faults, either converge
+// to the output and files of a run without faults, or fail with the injected
+// error, never hang.
+func TestStorageFaults(t *testing.T) {
+	newRun := func(faults *faulty.Config) *testRun {
+		run := newTestRun(t, 25, 38, 38, "assert_test_store_add_i64")
+		run.ProductionMode = true
+		run.ParallelSubrequests = 5
+		run.StorageFaults = faults
+		return run
+	}
+	expectedFiles := []string{
+		"states/0000000010-0000000001.kv",
+		"states/0000000020-0000000001.kv",
+		"states/0000000030-0000000001.kv",
+		"outputs/0000000020-0000000030.output",
+		"outputs/0000000030-0000000038.output",
+	}
+
+	reference := newRun(nil)
+	require.NoError(t, reference.Run(t, "storage_faults_reference"))
+	expectedOutput := reference.MapOutput("assert_test_store_add_i64")
+
+	t.Run("transient faults converge", func(t *testing.T) {
+		run := newRun(&faulty.Config{
+			MaxLatency:       5 * time.Millisecond,
+			ThrottleRate:     0.02,
+			PartialWriteRate: 0.05,
+			Seed:             1,
+		})
+		require.NoError(t, run.Run(t, "storage_faults_transient"))
+		assert.Equal(t, expectedOutput, run.MapOutput("assert_test_store_add_i64"))
+		assertFiles(t, run.TempDir, expectedFiles...)
+	})
+
+	for _, test := range []struct {
+		name   string
+		faults *faulty.Config
+		fault  faulty.Fault
+	}{
+		{"persistent throttling", &faulty.Config{ThrottleRate: 1, Seed: 1}, faulty.FaultThrottled},
+		{"persistent partial writes", &faulty.Config{PartialWriteRate: 1, Seed: 1}, faulty.FaultPartialWrite},
+	} {
+		t.Run(test.name+" fails with the injected error", func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+
+			run := newRun(test.faults)
+			run.Context = ctx
+			err := run.Run(t, "storage_faults_persistent")
+			require.Error(t, err)
+			require.NoError(t, ctx.Err(), "the request must fail, not hang")
+
+			var faultErr *faulty.Error
+			require.True(t, errors.As(err, &faultErr), "unexpected error %q", err)
+			assert.Equal(t, test.fault, faultErr.Fault)
+		})
+	}
+
+	t.Run("corrupted reads do not hang", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		run := newRun(&faulty.Config{CorruptReadRate: 0.2, Seed: 1})
+		run.Context = ctx
+		if err := run.Run(t, "storage_faults_corrupted_reads"); err != nil {
+			require.NoError(t, ctx.Err(), "the request must fail, not hang")
+			assert.Regexp(t, "corrupted state file|invalid cached outputs file", err.Error(), "the request must fail on the corruption detected")
+			return
+		}
+		assert.Equal(t, expectedOutput, run.MapOutput("assert_test_store_add_i64"), "the corrupted reads must be detected, not served")
+		assertFiles(t, run.TempDir, expectedFiles...)
+	})
+}
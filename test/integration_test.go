@@ -16,6 +16,8 @@ import (
 
 	"github.com/streamingfast/substreams/orchestrator/work"
 	pbssinternal "github.com/streamingfast/substreams/pb/sf/substreams/intern/v2"
+	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
+	"github.com/streamingfast/substreams/service"
 	"github.com/streamingfast/substreams/storage/store"
 	_ "github.com/streamingfast/substreams/wasm/wasmtime"
 	_ "github.com/streamingfast/substreams/wasm/wazero"
@@ -401,6 +403,37 @@ func TestStoreDeletePrefix(t *testing.T) {
 	require.NoError(t, run.Run(t, "test_store_delete_prefix"))
 }
 
+func TestBlockFilter(t *testing.T) {
+	run := newTestRun(t, 20, 20, 25, "store_depend")
+	index := &pbsubstreams.Module{
+		Name:             "index_all_blocks",
+		Kind:             &pbsubstreams.Module_KindBlockIndex_{KindBlockIndex: &pbsubstreams.Module_KindBlockIndex{OutputType: "proto:sf.substreams.v1.test.MapResult"}},
+		BinaryEntrypoint: "test_map",
+		InitialBlock:     3,
+		Inputs: []*pbsubstreams.Module_Input{
+			{Input: &pbsubstreams.Module_Input_Params_{Params: &pbsubstreams.Module_Input_Params{}}},
+			{Input: &pbsubstreams.Module_Input_Source_{Source: &pbsubstreams.Module_Input_Source{Type: "sf.substreams.v1.test.Block"}}},
+		},
+		Output: &pbsubstreams.Module_Output{Type: "proto:sf.substreams.v1.test.MapResult"},
+	}
+	run.Package.Modules.Modules = append(run.Package.Modules.Modules, index)
+	for _, module := range run.Package.Modules.Modules {
+		if module.Name == "store_root" {
+			index.BinaryIndex = module.BinaryIndex
+			module.BlockFilter = &pbsubstreams.Module_BlockFilter{Module: index.Name}
+		}
+	}
+
+	// `store_depend` fails unless the filtered `store_root` was written on
+	// block 3, by the jobs of tier2 and by tier1.
+	require.NoError(t, run.Run(t, "test_block_filter"))
+	assertFiles(t, run.TempDir,
+		"states/0000000010-0000000003.kv", "states/0000000020-0000000003.kv", // store_root
+		"states/0000000010-0000000003.kv", "states/0000000020-0000000003.kv", // store_depend
+		"index/0000000000-0000000010.index", "index/0000000010-0000000020.index",
+	)
+}
+
 func TestAllAssertions(t *testing.T) {
 	// Relies on `assert_all_test` having modInit == 1, so
 	run := newTestRun(t, 1, 31, 31, "assert_all_test")
@@ -410,6 +443,83 @@ func TestAllAssertions(t *testing.T) {
 	assert.Len(t, listFiles(t, run.TempDir), 90) // All these .kv files on disk
 }
 
+func TestOutputModules(t *testing.T) {
+	run := newTestRun(t, 25, 38, 38, "")
+	run.OutputModules = []string{"assert_test_store_add_i64", "test_map"}
+	run.Params = map[string]string{"test_map": "my test params"}
+	run.ProductionMode = true
+	require.NoError(t, run.Run(t, "test_output_modules"))
+
+	var blocks []uint64
+	var modules []string
+	for _, response := range run.Responses {
+		if data := response.GetBlockScopedData(); data != nil {
+			blocks = append(blocks, data.Clock.Number)
+			modules = append(modules, data.Output.Name)
+		}
+	}
+	require.Len(t, blocks, 26, "a response per block and output module")
+	for i := 0; i < len(blocks); i += 2 {
+		assert.Equal(t, uint64(25+i/2), blocks[i])
+		assert.Equal(t, blocks[i], blocks[i+1])
+		assert.Equal(t, []string{"assert_test_store_add_i64", "test_map"}, modules[i:i+2])
+	}
+}
+
+func TestHandoffCatchUp(t *testing.T) {
+	tests := []struct {
+		name              string
+		startBlock        int64
+		recentFinalBlocks []uint64 // returned by the successive calls, the last one repeated
+		expectedFirst     uint64
+	}{
+		{
+			name:              "blocks finalized while backprocessing",
+			startBlock:        12,
+			recentFinalBlocks: []uint64{20, 30},
+			expectedFirst:     12,
+		},
+		{
+			name:              "start beyond the linear handoff",
+			startBlock:        25,
+			recentFinalBlocks: []uint64{20, 30},
+			expectedFirst:     25,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recentFinalBlocks := test.recentFinalBlocks
+			run := newTestRun(t, test.startBlock, 0, 40, "test_map")
+			run.Params = map[string]string{"test_map": "my test params"}
+			run.ProductionMode = true
+			run.ServiceOptions = []service.Option{
+				service.WithHandoffCatchUp(1),
+				service.TestWithRecentFinalBlock(func() (uint64, error) {
+					block := recentFinalBlocks[0]
+					if len(recentFinalBlocks) > 1 {
+						recentFinalBlocks = recentFinalBlocks[1:]
+					}
+					return block, nil
+				}),
+			}
+			require.NoError(t, run.Run(t, "test_handoff_catch_up"))
+
+			var blocks []uint64
+			for _, response := range run.Responses {
+				if data := response.GetBlockScopedData(); data != nil {
+					blocks = append(blocks, data.Clock.Number)
+				}
+			}
+			var expected []uint64
+			for num := test.expectedFirst; num < 40; num++ {
+				expected = append(expected, num)
+			}
+			assert.Equal(t, expected, blocks)
+		})
+	}
+}
+
 func Test_SimpleMapModule(t *testing.T) {
 	run := newTestRun(t, 10000, 10001, 10001, "test_map")
 	run.Params = map[string]string{"test_map": "my test params"}
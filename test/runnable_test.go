@@ -26,6 +26,7 @@ import (
 	"github.com/streamingfast/substreams/reqctx"
 	"github.com/streamingfast/substreams/service"
 	"github.com/streamingfast/substreams/service/config"
+	"github.com/streamingfast/substreams/storage/faulty"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.opentelemetry.io/otel"
@@ -40,6 +41,7 @@ type testRun struct {
 	StartBlock             int64
 	ExclusiveEndBlock      uint64
 	ModuleName             string
+	OutputModules          []string // if set, the modules whose outputs are streamed instead of ModuleName's
 	SubrequestsSplitSize   uint64
 	ParallelSubrequests    uint64
 	NewBlockGenerator      BlockGeneratorFactory
@@ -50,6 +52,11 @@ type testRun struct {
 	// pre-existing data is available in different conditions
 	PreWork testPreWork
 	Context context.Context // custom top-level context, defaults to context.Background()
+	// StorageFaults, if set, are injected in the calls to the state store of
+	// tier1 and of the workers
+	StorageFaults *faulty.Config
+	// ServiceOptions are applied to the tier1 service
+	ServiceOptions []service.Option
 
 	Params map[string]string
 
@@ -74,6 +81,12 @@ func (f *testRun) Run(t *testing.T, testName string) error {
 	testTempDir := t.TempDir()
 	f.TempDir = testTempDir
 
+	stateStore, err := dstore.NewStore(filepath.Join(testTempDir, "test.store"), "", "none", true)
+	require.NoError(t, err)
+	if f.StorageFaults != nil {
+		stateStore = faulty.NewStore(stateStore, f.StorageFaults)
+	}
+
 	ctx, endFunc := withTestTracing(t, ctx, testName)
 	defer endFunc()
 	if f.Context == nil {
@@ -90,6 +103,7 @@ func (f *testRun) Run(t *testing.T, testName string) error {
 		StartCursor:    opaqueCursor,
 		Modules:        f.Package.Modules,
 		OutputModule:   f.ModuleName,
+		OutputModules:  f.OutputModules,
 		ProductionMode: f.ProductionMode,
 	}
 
@@ -134,7 +148,7 @@ func (f *testRun) Run(t *testing.T, testName string) error {
 			responseCollector:      newResponseCollector(),
 			newBlockGenerator:      newBlockGenerator,
 			blockProcessedCallBack: f.BlockProcessedCallback,
-			testTempDir:            testTempDir,
+			stateStore:             stateStore,
 			id:                     workerID.Inc(),
 		}
 	}
@@ -143,7 +157,7 @@ func (f *testRun) Run(t *testing.T, testName string) error {
 		f.PreWork(t, f, workerFactory)
 	}
 
-	if err := processRequest(t, ctx, request, workerFactory, newBlockGenerator, responseCollector, false, f.BlockProcessedCallback, testTempDir, f.SubrequestsSplitSize, f.ParallelSubrequests, f.LinearHandoffBlockNum); err != nil {
+	if err := processRequest(t, ctx, request, workerFactory, newBlockGenerator, responseCollector, false, f.BlockProcessedCallback, stateStore, f.SubrequestsSplitSize, f.ParallelSubrequests, f.LinearHandoffBlockNum, f.ServiceOptions); err != nil {
 		return fmt.Errorf("running test: %w", err)
 	}
 
@@ -238,7 +252,7 @@ func processInternalRequest(
 	responseCollector *responseCollector,
 	isSubRequest bool,
 	blockProcessedCallBack blockProcessedCallBack,
-	testTempDir string,
+	baseStoreStore dstore.Store,
 	subrequestsSplitSize uint64,
 	parallelSubrequests uint64,
 	linearHandoffBlockNum uint64,
@@ -246,9 +260,6 @@ func processInternalRequest(
 ) error {
 	t.Helper()
 
-	baseStoreStore, err := dstore.NewStore(filepath.Join(testTempDir, "test.store"), "", "none", true)
-	require.NoError(t, err)
-
 	tr := &TestRunner{
 		t:                      t,
 		baseStoreStore:         baseStoreStore,
@@ -278,16 +289,14 @@ func processRequest(
 	responseCollector *responseCollector,
 	isSubRequest bool,
 	blockProcessedCallBack blockProcessedCallBack,
-	testTempDir string,
+	baseStoreStore dstore.Store,
 	subrequestsSplitSize uint64,
 	parallelSubrequests uint64,
 	linearHandoffBlockNum uint64,
+	serviceOptions []service.Option,
 ) error {
 	t.Helper()
 
-	baseStoreStore, err := dstore.NewStore(filepath.Join(testTempDir, "test.store"), "", "none", true)
-	require.NoError(t, err)
-
 	tr := &TestRunner{
 		t:                      t,
 		baseStoreStore:         baseStoreStore,
@@ -304,6 +313,9 @@ func processRequest(
 		workerFactory,
 	)
 	svc := service.TestNewService(runtimeConfig, linearHandoffBlockNum, tr.StreamFactory)
+	for _, opt := range serviceOptions {
+		opt(svc)
+	}
 	return svc.TestBlocks(ctx, isSubRequest, request, responseCollector.Collect)
 }
 
@@ -6,6 +6,7 @@ import (
 	"math"
 	"testing"
 
+	"github.com/streamingfast/dstore"
 	"github.com/streamingfast/substreams"
 	"github.com/streamingfast/substreams/block"
 	"github.com/streamingfast/substreams/orchestrator/work"
@@ -22,7 +23,7 @@ type TestWorker struct {
 	responseCollector      *responseCollector
 	newBlockGenerator      BlockGeneratorFactory
 	blockProcessedCallBack blockProcessedCallBack
-	testTempDir            string
+	stateStore             dstore.Store
 	id                     uint64
 	traceID                *string
 }
@@ -50,7 +51,7 @@ func (w *TestWorker) Work(ctx context.Context, request *pbssinternal.ProcessRang
 		zap.Uint64("stop_block_num", request.StopBlockNum),
 	)
 	subrequestsSplitSize := uint64(10)
-	if err := processInternalRequest(w.t, ctx, request, nil, w.newBlockGenerator, w.responseCollector, true, w.blockProcessedCallBack, w.testTempDir, subrequestsSplitSize, 1, 0, w.traceID); err != nil {
+	if err := processInternalRequest(w.t, ctx, request, nil, w.newBlockGenerator, w.responseCollector, true, w.blockProcessedCallBack, w.stateStore, subrequestsSplitSize, 1, 0, w.traceID); err != nil {
 		return &work.Result{
 			Error: fmt.Errorf("processing sub request: %w", err),
 		}
@@ -0,0 +1,54 @@
+package tools
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/streamingfast/dstore"
+	"github.com/streamingfast/substreams/storage/store"
+)
+
+var compactStoreCmd = &cobra.Command{
+	Use:   "compact-store <state_store_url> [<module_hash>...]",
+	Short: "Keeps only the complete store snapshots every interval blocks, to speed up the listings and the loading of long-lived stores",
+	Long: ExamplePrefixed("substreams tools compact-store", `
+		# List the snapshots of all the stores that would be deleted
+		gs://my-bucket/substreams-states --dry-run
+
+		# Keep one snapshot every 100k blocks of store 'abc123...'
+		gs://my-bucket/substreams-states abc1234567890 --interval=100000
+	`),
+	Args: cobra.MinimumNArgs(1),
+	RunE: compactStoreE,
+}
+
+func init() {
+	compactStoreCmd.Flags().Uint64("interval", 100_000, "Blocks between the snapshots kept, must be a multiple of the store save interval (state bundle size) used by the server")
+	compactStoreCmd.Flags().Bool("dry-run", false, "Only print the snapshots that would be deleted")
+
+	Cmd.AddCommand(compactStoreCmd)
+}
+
+func compactStoreE(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+
+	baseStore, err := dstore.NewStore(args[0], "zst", "zstd", false)
+	if err != nil {
+		return fmt.Errorf("creating base store: %w", err)
+	}
+
+	dryRun := mustGetBool(cmd, "dry-run")
+	deleted, err := store.CompactSnapshots(ctx, baseStore, args[1:], mustGetUint64(cmd, "interval"), dryRun, func(filePath string) {
+		fmt.Println(filePath)
+	})
+	if err != nil {
+		return fmt.Errorf("compacting store snapshots: %w", err)
+	}
+
+	if dryRun {
+		fmt.Printf("%d snapshots would be deleted\n", deleted)
+		return nil
+	}
+	fmt.Printf("%d snapshots deleted\n", deleted)
+	return nil
+}
@@ -0,0 +1,88 @@
+package tools
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"github.com/streamingfast/dstore"
+	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
+	"github.com/streamingfast/substreams/storage/store"
+	"github.com/streamingfast/substreams/storage/store/state"
+)
+
+var explainMergeCmd = &cobra.Command{
+	Use:   "explain-merge <state_store_url> <module_hash> <target_block>",
+	Short: "Explains which files the squasher would load and merge to bring a store up to a target block, without merging anything",
+	Long: ExamplePrefixed("substreams tools explain-merge", `
+		# Explain how store 'abc123...' would be completed up to block 1_000_000
+		file:///data/substreams-states abc1234567890 1000000 --save-interval=1000
+	`),
+	Args: cobra.ExactArgs(3),
+	RunE: explainMergeE,
+}
+
+func init() {
+	explainMergeCmd.Flags().Uint64("save-interval", 1000, "Store save interval (state bundle size) used by the server")
+	explainMergeCmd.Flags().Uint64("module-initial-block", 0, "Initial block of the store module, inferred from the first snapshot file found when 0")
+
+	Cmd.AddCommand(explainMergeCmd)
+}
+
+func explainMergeE(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+
+	stateStoreURL := args[0]
+	moduleHash := args[1]
+	targetBlock, err := strconv.ParseUint(args[2], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid target block %q: %w", args[2], err)
+	}
+
+	saveInterval := mustGetUint64(cmd, "save-interval")
+	if saveInterval == 0 {
+		return fmt.Errorf("save interval must be greater than 0")
+	}
+
+	baseStore, err := dstore.NewStore(stateStoreURL, "zst", "zstd", false)
+	if err != nil {
+		return fmt.Errorf("creating base store: %w", err)
+	}
+
+	moduleInitialBlock := mustGetUint64(cmd, "module-initial-block")
+	if moduleInitialBlock == 0 {
+		config, err := store.NewConfig(moduleHash, 0, moduleHash, pbsubstreams.Module_KindStore_UPDATE_POLICY_UNSET, "", baseStore, "")
+		if err != nil {
+			return fmt.Errorf("creating store config: %w", err)
+		}
+
+		files, err := config.ListSnapshotFiles(ctx, math.MaxUint64)
+		if err != nil {
+			return fmt.Errorf("listing snapshots: %w", err)
+		}
+		if len(files) == 0 {
+			return fmt.Errorf("no snapshot files found for module hash %q", moduleHash)
+		}
+
+		moduleInitialBlock = files[0].Range.StartBlock
+		for _, file := range files {
+			if file.Range.StartBlock < moduleInitialBlock {
+				moduleInitialBlock = file.Range.StartBlock
+			}
+		}
+	}
+
+	config, err := store.NewConfig(moduleHash, moduleInitialBlock, moduleHash, pbsubstreams.Module_KindStore_UPDATE_POLICY_UNSET, "", baseStore, "")
+	if err != nil {
+		return fmt.Errorf("creating store config: %w", err)
+	}
+
+	explanation, err := state.ExplainMerge(ctx, config, saveInterval, targetBlock)
+	if err != nil {
+		return fmt.Errorf("explaining merge: %w", err)
+	}
+
+	fmt.Println(explanation.String())
+	return nil
+}
@@ -0,0 +1,125 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/streamingfast/dstore"
+
+	"github.com/streamingfast/substreams/storage/lease"
+)
+
+var leaseCmd = &cobra.Command{
+	Use:          "lease",
+	Short:        "Manages the leases on the state of modules, keeping the state store garbage collection away from them during maintenance",
+	SilenceUsage: true,
+}
+
+var leaseAcquireCmd = &cobra.Command{
+	Use:   "acquire <state_store_url> <module_hash>",
+	Short: "Takes (or renews) a lease on the state of a module",
+	Long: ExamplePrefixed("substreams tools lease acquire", `
+		# Keep the partial store reaper and the snapshot compaction away from store 'abc123...' for 2 hours
+		gs://my-bucket/substreams-states abc1234567890 --holder=jane --reason="rewriting keys" --ttl=2h
+	`),
+	Args:         cobra.ExactArgs(2),
+	RunE:         leaseAcquireE,
+	SilenceUsage: true,
+}
+
+var leaseReleaseCmd = &cobra.Command{
+	Use:          "release <state_store_url> <module_hash>",
+	Short:        "Gives back a lease on the state of a module",
+	Args:         cobra.ExactArgs(2),
+	RunE:         leaseReleaseE,
+	SilenceUsage: true,
+}
+
+var leaseListCmd = &cobra.Command{
+	Use:          "list <state_store_url>",
+	Short:        "Lists the active leases of the state store",
+	Args:         cobra.ExactArgs(1),
+	RunE:         leaseListE,
+	SilenceUsage: true,
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{leaseAcquireCmd, leaseReleaseCmd} {
+		cmd.Flags().String("holder", os.Getenv("USER"), "Name of the holder of the lease")
+	}
+	leaseAcquireCmd.Flags().String("reason", "", "Why the lease is taken, shown when listing the leases")
+	leaseAcquireCmd.Flags().Duration("ttl", time.Hour, "Duration of the lease, acquire it again before it expires to renew it")
+	leaseReleaseCmd.Flags().Bool("force", false, "Release the lease even if it is held by another holder")
+
+	leaseCmd.AddCommand(leaseAcquireCmd)
+	leaseCmd.AddCommand(leaseReleaseCmd)
+	leaseCmd.AddCommand(leaseListCmd)
+
+	Cmd.AddCommand(leaseCmd)
+}
+
+func newLeaseStore(url string) (dstore.Store, error) {
+	stateStore, err := dstore.NewStore(url, "zst", "zstd", true)
+	if err != nil {
+		return nil, fmt.Errorf("creating state store: %w", err)
+	}
+	return stateStore, nil
+}
+
+func leaseAcquireE(cmd *cobra.Command, args []string) error {
+	stateStore, err := newLeaseStore(args[0])
+	if err != nil {
+		return err
+	}
+
+	acquired, err := lease.Acquire(cmd.Context(), stateStore, args[1], mustGetString(cmd, "holder"), mustGetString(cmd, "reason"), mustGetDuration(cmd, "ttl"))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Acquired %s\n", acquired)
+	return nil
+}
+
+func leaseReleaseE(cmd *cobra.Command, args []string) error {
+	stateStore, err := newLeaseStore(args[0])
+	if err != nil {
+		return err
+	}
+
+	if err := lease.Release(cmd.Context(), stateStore, args[1], mustGetString(cmd, "holder"), mustGetBool(cmd, "force")); err != nil {
+		return err
+	}
+	fmt.Printf("Released lease on module %s\n", args[1])
+	return nil
+}
+
+func leaseListE(cmd *cobra.Command, args []string) error {
+	stateStore, err := newLeaseStore(args[0])
+	if err != nil {
+		return err
+	}
+
+	leases, err := lease.Active(cmd.Context(), stateStore)
+	if err != nil {
+		return err
+	}
+	if len(leases) == 0 {
+		fmt.Println("No active lease")
+		return nil
+	}
+
+	moduleHashes := make([]string, 0, len(leases))
+	for moduleHash := range leases {
+		moduleHashes = append(moduleHashes, moduleHash)
+	}
+	sort.Strings(moduleHashes)
+
+	for _, moduleHash := range moduleHashes {
+		l := leases[moduleHash]
+		fmt.Printf("%s\tholder=%s\texpires_at=%s\treason=%q\n", moduleHash, l.Holder, l.ExpiresAt.Format(time.RFC3339), l.Reason)
+	}
+	return nil
+}
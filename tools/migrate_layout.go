@@ -0,0 +1,54 @@
+package tools
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/streamingfast/dstore"
+	"github.com/streamingfast/substreams/storage/layout"
+)
+
+var migrateLayoutCmd = &cobra.Command{
+	Use:   "migrate-layout <state_store_url>",
+	Short: "Copies store snapshots and execution outputs laid out in v1 to the sharded v2 storage layout",
+	Long: ExamplePrefixed("substreams tools migrate-layout", `
+		# List what would be migrated
+		gs://my-bucket/substreams-states --dry-run
+
+		# Migrate and remove the v1 files once copied
+		gs://my-bucket/substreams-states --delete-source
+	`),
+	Args: cobra.ExactArgs(1),
+	RunE: migrateLayoutE,
+}
+
+func init() {
+	migrateLayoutCmd.Flags().Bool("dry-run", false, "Only print the files that would be migrated")
+	migrateLayoutCmd.Flags().Bool("delete-source", false, "Delete the v1 files once copied to their v2 location")
+
+	Cmd.AddCommand(migrateLayoutCmd)
+}
+
+func migrateLayoutE(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+
+	baseStore, err := dstore.NewStore(args[0], "zst", "zstd", false)
+	if err != nil {
+		return fmt.Errorf("creating base store: %w", err)
+	}
+
+	dryRun := mustGetBool(cmd, "dry-run")
+	migrated, err := layout.Migrate(ctx, baseStore, mustGetBool(cmd, "delete-source"), dryRun, func(from, to string) {
+		fmt.Printf("%s -> %s\n", from, to)
+	})
+	if err != nil {
+		return fmt.Errorf("migrating layout: %w", err)
+	}
+
+	if dryRun {
+		fmt.Printf("%d files would be migrated\n", migrated)
+		return nil
+	}
+	fmt.Printf("%d files migrated\n", migrated)
+	return nil
+}
@@ -0,0 +1,53 @@
+package tools
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/streamingfast/dstore"
+	"github.com/streamingfast/substreams/storage/store"
+)
+
+var migrateStateCmd = &cobra.Command{
+	Use:   "migrate-state <state_store_url> [<module_hash>...]",
+	Short: "Rewrites in place the store files written in an older format version, so they keep being read by future versions",
+	Long: ExamplePrefixed("substreams tools migrate-state", `
+		# List the store files of all the modules that would be migrated
+		gs://my-bucket/substreams-states --dry-run
+
+		# Migrate the store files of module 'abc123...'
+		gs://my-bucket/substreams-states abc1234567890
+	`),
+	Args: cobra.MinimumNArgs(1),
+	RunE: migrateStateE,
+}
+
+func init() {
+	migrateStateCmd.Flags().Bool("dry-run", false, "Only print the store files that would be migrated")
+
+	Cmd.AddCommand(migrateStateCmd)
+}
+
+func migrateStateE(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+
+	baseStore, err := dstore.NewStore(args[0], "zst", "zstd", true)
+	if err != nil {
+		return fmt.Errorf("creating base store: %w", err)
+	}
+
+	dryRun := mustGetBool(cmd, "dry-run")
+	migrated, err := store.MigrateStateFiles(ctx, baseStore, args[1:], dryRun, func(filePath string) {
+		fmt.Println(filePath)
+	})
+	if err != nil {
+		return fmt.Errorf("migrating store files: %w", err)
+	}
+
+	if dryRun {
+		fmt.Printf("%d store files would be migrated to version %d\n", migrated, store.StateFileVersion)
+		return nil
+	}
+	fmt.Printf("%d store files migrated to version %d\n", migrated, store.StateFileVersion)
+	return nil
+}
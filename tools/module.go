@@ -72,6 +72,9 @@ func moduleRunE(cmd *cobra.Command, args []string) error {
 	if module.GetKindMap() != nil {
 		kind = "MAP"
 	}
+	if module.GetKindBlockIndex() != nil {
+		kind = "BLOCK_INDEX"
+	}
 
 	moduleHashes := manifest.NewModuleHashes()
 	hash, err := moduleHashes.HashModule(pkg.Modules, module, graph)
@@ -0,0 +1,50 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/streamingfast/dstore"
+
+	"github.com/streamingfast/substreams/orchestrator/eventlog"
+)
+
+var schedulerTimelineCmd = &cobra.Command{
+	Use:   "scheduler-timeline <state_store_url> <trace_id>",
+	Short: "Reconstructs and renders the timeline of the jobs scheduled by tier1 for a request, from its scheduler event log",
+	Long: ExamplePrefixed("substreams tools scheduler-timeline", `
+		# Render the timeline of request with trace ID 'abc123...', the tier1 must run with the scheduler event log enabled
+		file:///data/substreams-states abc1234567890
+	`),
+	Args: cobra.ExactArgs(2),
+	RunE: schedulerTimelineE,
+}
+
+func init() {
+	Cmd.AddCommand(schedulerTimelineCmd)
+}
+
+func schedulerTimelineE(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+
+	stateStoreURL := args[0]
+	traceID := args[1]
+
+	baseStore, err := dstore.NewStore(stateStoreURL, "zst", "zstd", false)
+	if err != nil {
+		return fmt.Errorf("creating base store: %w", err)
+	}
+	eventsStore, err := baseStore.SubStore("events")
+	if err != nil {
+		return fmt.Errorf("creating events store: %w", err)
+	}
+
+	events, err := eventlog.Load(ctx, eventsStore, traceID)
+	if err != nil {
+		return err
+	}
+
+	eventlog.Replay(events).Render(os.Stdout)
+	return nil
+}
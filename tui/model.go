@@ -31,5 +31,8 @@ type model struct {
 	LastFailure *pbsubstreamsrpc.ModuleProgress_Failed
 	Reason      string
 
-	TraceID string
+	SlowModules map[string]string // module name to its last slow execution warning
+
+	TraceID   string
+	RequestID string
 }
@@ -50,7 +50,7 @@ func (ui *TUI) decoratedBlockScopedData(
 		if _, ok := ui.msgTypes[out.Name]; !ok {
 			continue
 		}
-		for _, log := range out.DebugInfo.Logs {
+		for _, log := range out.DebugInfo.GetLogs() {
 			s = append(s, fmt.Sprintf("%s: log: %s\n", out.Name, log))
 		}
 
@@ -216,6 +216,8 @@ func (ui *TUI) formatPostDataProgress(msg *pbsubstreamsrpc.Response_Progress) {
 		case *pbsubstreamsrpc.ModuleProgress_ProcessedRanges_:
 		case *pbsubstreamsrpc.ModuleProgress_InitialState_:
 		case *pbsubstreamsrpc.ModuleProgress_ProcessedBytes_:
+		case *pbsubstreamsrpc.ModuleProgress_SlowExecution_:
+			fmt.Printf("%s: warning: %s\n", mod.Name, formatSlowExecution(progMsg.SlowExecution))
 		case *pbsubstreamsrpc.ModuleProgress_Failed_:
 			failure := progMsg.Failed
 			if !displayedFailure {
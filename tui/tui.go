@@ -78,6 +78,8 @@ func (ui *TUI) Init(outputMode string) error {
 					msgType = modKind.KindStore.ValueType
 				case *pbsubstreams.Module_KindMap_:
 					msgType = modKind.KindMap.OutputType
+				case *pbsubstreams.Module_KindBlockIndex_:
+					msgType = modKind.KindBlockIndex.OutputType
 				}
 				msgType = strings.TrimPrefix(msgType, "proto:")
 
@@ -165,11 +167,15 @@ func (ui *TUI) IncomingMessage(ctx context.Context, resp *pbsubstreamsrpc.Respon
 		ui.seenFirstData = true
 		if ui.outputMode == OutputModeTUI {
 			ui.ensureTerminalUnlocked()
-			return ui.decoratedBlockScopedData(m.BlockScopedData.Output, m.BlockScopedData.DebugMapOutputs, m.BlockScopedData.DebugStoreOutputs, m.BlockScopedData.Clock)
+			return ui.decoratedBlockScopedData(m.BlockScopedData.Output, m.BlockScopedData.DebugMapOutputs, allStoreOutputs(m.BlockScopedData), m.BlockScopedData.Clock)
 		} else {
-			return ui.jsonBlockScopedData(m.BlockScopedData.Output, m.BlockScopedData.DebugMapOutputs, m.BlockScopedData.DebugStoreOutputs, m.BlockScopedData.Clock)
+			return ui.jsonBlockScopedData(m.BlockScopedData.Output, m.BlockScopedData.DebugMapOutputs, allStoreOutputs(m.BlockScopedData), m.BlockScopedData.Clock)
 		}
 	case *pbsubstreamsrpc.Response_Progress:
+		if queue := m.Progress.Queue; queue != nil {
+			fmt.Printf("Waiting for the server to start the request: position %d of %d in queue\n", queue.Position, queue.QueuedRequests)
+			return nil
+		}
 		if ui.seenFirstData {
 			ui.formatPostDataProgress(m)
 		} else {
@@ -194,19 +200,63 @@ func (ui *TUI) IncomingMessage(ctx context.Context, resp *pbsubstreamsrpc.Respon
 		}
 
 	case *pbsubstreamsrpc.Response_Session:
+		printDeprecatedModules(m.Session.DeprecatedModules)
 		if ui.outputMode == OutputModeTUI {
 			ui.ensureTerminalLocked()
 			ui.prog.Send(m)
 		} else {
 			fmt.Printf("TraceID: %s\n", m.Session.TraceId)
+			if m.Session.RequestId != "" {
+				fmt.Printf("RequestID: %s\n", m.Session.RequestId)
+			}
 		}
 
+	case *pbsubstreamsrpc.Response_Error:
+		ui.ensureTerminalUnlocked()
+		fmt.Fprintln(os.Stderr, formatError(m.Error))
+
 	default:
 		fmt.Println("Unsupported response", m)
 	}
 	return nil
 }
 
+// formatError describes the `Error` a request failed with, the stream ending
+// with it right after.
+func formatError(in *pbsubstreamsrpc.Error) string {
+	kind := "fatal"
+	if in.Retryable {
+		kind = "retryable"
+	}
+	out := fmt.Sprintf("Request failed with a %s error (%s)", kind, strings.ToLower(strings.TrimPrefix(in.Code.String(), "ERROR_CODE_")))
+	if in.Module != "" {
+		out += fmt.Sprintf(", module %q on block %d", in.Module, in.BlockNum)
+	}
+	return out
+}
+
+// printDeprecatedModules warns on stderr about the deprecated modules the
+// server runs.
+func printDeprecatedModules(deprecated []*pbsubstreamsrpc.DeprecatedModule) {
+	for _, module := range deprecated {
+		msg := fmt.Sprintf("Warning: module %q is deprecated", module.ModuleName)
+		if sunset := module.Deprecation.Sunset; sunset != nil {
+			verb := "will be sunset on"
+			if module.Sunset {
+				verb = "was sunset on"
+			}
+			msg += fmt.Sprintf(", %s %s", verb, sunset.AsTime().UTC().Format("2006-01-02"))
+		}
+		if module.Deprecation.Replacement != "" {
+			msg += fmt.Sprintf(", use %q instead", module.Deprecation.Replacement)
+		}
+		if module.Deprecation.Message != "" {
+			msg += ": " + module.Deprecation.Message
+		}
+		fmt.Fprintln(os.Stderr, msg)
+	}
+}
+
 func (ui *TUI) ensureTerminalUnlocked() {
 	if ui.prog == nil {
 		return
@@ -246,3 +296,26 @@ func (ui *TUI) CleanUpTerminal() {
 func (ui *TUI) OnTerminated(f func(error)) {
 	ui.shutter.OnTerminated(f)
 }
+
+// allStoreOutputs returns the debug store outputs of `data`, followed by the
+// streamed deltas of the stores not already in them.
+func allStoreOutputs(data *pbsubstreamsrpc.BlockScopedData) []*pbsubstreamsrpc.StoreModuleOutput {
+	if len(data.StoreOutputs) == 0 {
+		return data.DebugStoreOutputs
+	}
+
+	out := data.DebugStoreOutputs
+	for _, storeOut := range data.StoreOutputs {
+		seen := false
+		for _, debugOut := range data.DebugStoreOutputs {
+			if debugOut.Name == storeOut.Name {
+				seen = true
+				break
+			}
+		}
+		if !seen {
+			out = append(out, storeOut)
+		}
+	}
+	return out
+}
@@ -52,6 +52,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, nil
 	case *pbsubstreamsrpc.Response_Session:
 		m.TraceID = msg.Session.TraceId
+		m.RequestID = msg.Session.RequestId
 		m.BackprocessingCompleteAtBlock = msg.Session.ResolvedStartBlock
 
 	case *pbsubstreamsrpc.ModuleProgress:
@@ -81,6 +82,13 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.Modules = newModules
 		case *pbsubstreamsrpc.ModuleProgress_InitialState_:
 		case *pbsubstreamsrpc.ModuleProgress_ProcessedBytes_:
+		case *pbsubstreamsrpc.ModuleProgress_SlowExecution_:
+			slowModules := map[string]string{}
+			for k, v := range m.SlowModules {
+				slowModules[k] = v
+			}
+			slowModules[msg.Name] = formatSlowExecution(progMsg.SlowExecution)
+			m.SlowModules = slowModules
 		case *pbsubstreamsrpc.ModuleProgress_Failed_:
 			m.Failures += 1
 			if progMsg.Failed.Reason != "" {
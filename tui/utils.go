@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+
+	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
 )
 
 type ranges []*blockRange
@@ -149,3 +151,11 @@ func reduceOverlaps(r ranges) ranges {
 	// fmt.Println("reduce output:", newRanges)
 	return newRanges
 }
+
+func formatSlowExecution(slow *pbsubstreamsrpc.ModuleProgress_SlowExecution) string {
+	var blocks []string
+	for _, block := range slow.Blocks {
+		blocks = append(blocks, fmt.Sprintf("#%d (%dms)", block.BlockNum, block.DurationMs))
+	}
+	return fmt.Sprintf("execution exceeded %dms on blocks %s", slow.BudgetMs, strings.Join(blocks, ", "))
+}
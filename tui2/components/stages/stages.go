@@ -0,0 +1,148 @@
+package stages
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
+	"github.com/streamingfast/substreams/tui2/common"
+)
+
+// Matrix renders the backprocessing state of the segments of each stage, as
+// received in the latest StagesProgress message, one row per stage. The
+// segments of all the rows are aligned on their block range.
+type Matrix struct {
+	common.Common
+
+	labelWidth int
+	progress   *pbsubstreamsrpc.StagesProgress
+}
+
+func NewMatrix(c common.Common) *Matrix {
+	return &Matrix{
+		Common:     c,
+		labelWidth: 45,
+	}
+}
+
+func (m *Matrix) Init() tea.Cmd { return nil }
+
+func (m *Matrix) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case *pbsubstreamsrpc.ModulesProgress:
+		if msg.Stages != nil {
+			m.progress = msg.Stages
+		}
+	}
+	return m, nil
+}
+
+// HasProgress tells if a StagesProgress message was received, the server only
+// sending them when the `stages_progress` capability was negotiated.
+func (m *Matrix) HasProgress() bool {
+	return m.progress != nil && len(m.progress.Stages) != 0
+}
+
+var segmentGlyphs = map[pbsubstreamsrpc.SegmentState]string{
+	pbsubstreamsrpc.SegmentState_SEGMENT_STATE_PENDING:         "░",
+	pbsubstreamsrpc.SegmentState_SEGMENT_STATE_SCHEDULED:       "▒",
+	pbsubstreamsrpc.SegmentState_SEGMENT_STATE_PARTIAL_PRESENT: "▓",
+	pbsubstreamsrpc.SegmentState_SEGMENT_STATE_MERGING:         "▓",
+	pbsubstreamsrpc.SegmentState_SEGMENT_STATE_COMPLETED:       "█",
+}
+
+const legend = "█ completed  ▓ produced, not merged yet  ▒ scheduled  ░ pending"
+
+func (m *Matrix) View() string {
+	if !m.HasProgress() {
+		return ""
+	}
+
+	lo, hi := segmentsBounds(m.progress.Stages)
+	countsWidth := len(fmt.Sprintf(" %d/%d", hi-lo, hi-lo))
+	width := m.Width - m.labelWidth - countsWidth - 2 /* brackets */
+	if width < 1 {
+		width = 1
+	}
+
+	var labels, rows []string
+	for _, stage := range m.progress.Stages {
+		label := fmt.Sprintf("stage %d: %s", stage.Stage, strings.Join(stage.Modules, ", "))
+		if len(label) > m.labelWidth-4 {
+			label = label[:m.labelWidth-4]
+		}
+		labels = append(labels, lipgloss.NewStyle().Margin(0, 1).Render(label))
+
+		completed := 0
+		for _, state := range stage.Segments {
+			if state == pbsubstreamsrpc.SegmentState_SEGMENT_STATE_COMPLETED {
+				completed++
+			}
+		}
+		rows = append(rows, fmt.Sprintf("[%s] %d/%d", renderSegments(stage, lo, hi, uint64(width)), completed, len(stage.Segments)))
+	}
+
+	header := lipgloss.NewStyle().Margin(0, 1).Render(fmt.Sprintf("Stages (segments of %d blocks, from block %d to %d): %s", m.progress.SegmentSize, lo*m.progress.SegmentSize, hi*m.progress.SegmentSize, legend))
+	return lipgloss.JoinVertical(0,
+		header,
+		lipgloss.JoinHorizontal(0.5,
+			lipgloss.JoinVertical(0, labels...),
+			lipgloss.JoinVertical(0, rows...),
+		),
+	)
+}
+
+// segmentsBounds returns the index of the lowest segment of `stages` and the
+// one following their highest segment.
+func segmentsBounds(stages []*pbsubstreamsrpc.StageProgress) (lo, hi uint64) {
+	for i, stage := range stages {
+		end := stage.FirstSegment + uint64(len(stage.Segments))
+		if i == 0 || stage.FirstSegment < lo {
+			lo = stage.FirstSegment
+		}
+		if end > hi {
+			hi = end
+		}
+	}
+	return
+}
+
+// renderSegments renders the segments of `stage` within [lo, hi) in at most
+// `width` cells, each cell showing the least advanced state of the segments it
+// spans. Cells before the first segment of the stage are left blank.
+func renderSegments(stage *pbsubstreamsrpc.StageProgress, lo, hi, width uint64) string {
+	count := hi - lo
+	perCell := (count + width - 1) / width
+	if perCell == 0 {
+		perCell = 1
+	}
+
+	var out strings.Builder
+	for cellLo := lo; cellLo < hi; cellLo += perCell {
+		cellHi := cellLo + perCell
+		if cellHi > hi {
+			cellHi = hi
+		}
+
+		found := false
+		least := pbsubstreamsrpc.SegmentState_SEGMENT_STATE_COMPLETED
+		for segment := cellLo; segment < cellHi; segment++ {
+			if segment < stage.FirstSegment || segment >= stage.FirstSegment+uint64(len(stage.Segments)) {
+				continue
+			}
+			found = true
+			if state := stage.Segments[segment-stage.FirstSegment]; state < least {
+				least = state
+			}
+		}
+		if !found {
+			out.WriteString(" ")
+			continue
+		}
+		out.WriteString(segmentGlyphs[least])
+	}
+	return out.String()
+}
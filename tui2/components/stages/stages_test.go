@@ -0,0 +1,48 @@
+package stages
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
+)
+
+func Test_renderSegments(t *testing.T) {
+	pending := pbsubstreamsrpc.SegmentState_SEGMENT_STATE_PENDING
+	scheduled := pbsubstreamsrpc.SegmentState_SEGMENT_STATE_SCHEDULED
+	merging := pbsubstreamsrpc.SegmentState_SEGMENT_STATE_MERGING
+	completed := pbsubstreamsrpc.SegmentState_SEGMENT_STATE_COMPLETED
+
+	stage := &pbsubstreamsrpc.StageProgress{
+		FirstSegment: 2,
+		Segments:     []pbsubstreamsrpc.SegmentState{completed, completed, merging, scheduled, pending, pending},
+	}
+
+	tests := []struct {
+		name   string
+		lo, hi uint64
+		width  uint64
+		expect string
+	}{
+		{"one segment per cell", 2, 8, 10, "██▓▒░░"},
+		{"aligned on lower segments", 0, 8, 10, "  ██▓▒░░"},
+		{"least advanced state of the cell", 2, 8, 3, "█▒░"},
+		{"partial last cell", 2, 8, 4, "█▒░"},
+		{"blank cell only before the stage", 0, 8, 4, " █▒░"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expect, renderSegments(stage, test.lo, test.hi, test.width))
+		})
+	}
+}
+
+func Test_segmentsBounds(t *testing.T) {
+	lo, hi := segmentsBounds([]*pbsubstreamsrpc.StageProgress{
+		{FirstSegment: 3, Segments: make([]pbsubstreamsrpc.SegmentState, 5)},
+		{FirstSegment: 1, Segments: make([]pbsubstreamsrpc.SegmentState, 2)},
+	})
+	assert.Equal(t, uint64(1), lo)
+	assert.Equal(t, uint64(8), hi)
+}
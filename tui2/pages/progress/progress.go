@@ -13,6 +13,7 @@ import (
 	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
 	"github.com/streamingfast/substreams/tui2/common"
 	"github.com/streamingfast/substreams/tui2/components/ranges"
+	"github.com/streamingfast/substreams/tui2/components/stages"
 	"github.com/streamingfast/substreams/tui2/replaylog"
 	"github.com/streamingfast/substreams/tui2/stream"
 )
@@ -37,6 +38,7 @@ type Progress struct {
 	maxParallelWorkers uint64
 
 	bars   *ranges.Bars
+	stages *stages.Matrix
 	curErr string
 }
 
@@ -47,11 +49,13 @@ func New(c common.Common) *Progress {
 		targetBlock:  0,
 		progressView: viewport.New(24, 80),
 		bars:         ranges.NewBars(c, 0),
+		stages:       stages.NewMatrix(c),
 	}
 }
 func (p *Progress) Init() tea.Cmd {
 	return tea.Batch(
 		p.bars.Init(),
+		p.stages.Init(),
 		p.progressView.Init(),
 	)
 }
@@ -64,7 +68,7 @@ func (p *Progress) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		switch msg.(tea.KeyMsg).String() {
 		case "m":
 			p.bars.Mode = (p.bars.Mode + 1) % 3
-			p.progressView.SetContent(p.bars.View())
+			p.progressView.SetContent(p.progressContent())
 		}
 		var cmd tea.Cmd
 		p.progressView, cmd = p.progressView.Update(msg)
@@ -78,9 +82,19 @@ func (p *Progress) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		p.maxParallelWorkers = sessionInit.MaxParallelWorkers
 		p.bars = ranges.NewBars(p.Common, linearHandoff)
 		p.bars.Init()
+		p.stages = stages.NewMatrix(p.Common)
+		p.stages.Init()
+		p.stages.SetSize(p.Width-2 /* borders */, p.Height)
 	case *pbsubstreamsrpc.BlockScopedData:
 		p.dataPayloads += 1
 	case *pbsubstreamsrpc.ModulesProgress:
+		if queue := msg.(*pbsubstreamsrpc.ModulesProgress).Queue; queue != nil {
+			p.state = fmt.Sprintf("Queued by the server (position %d of %d)", queue.Position, queue.QueuedRequests)
+			break
+		}
+		if strings.HasPrefix(p.state, "Queued") {
+			p.state = "Connected"
+		}
 		p.progressUpdates += 1
 		thisSec := time.Now().Unix()
 		if p.updatedSecond != thisSec {
@@ -94,7 +108,8 @@ func (p *Progress) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 		p.updatesThisSecond += 1
 		p.bars.Update(msg)
-		p.progressView.SetContent(p.bars.View())
+		p.stages.Update(msg)
+		p.progressView.SetContent(p.progressContent())
 	case stream.StreamErrorMsg:
 		p.state = fmt.Sprintf("Error")
 		p.curErr = msg.(stream.StreamErrorMsg).Error()
@@ -115,6 +130,19 @@ func (p *Progress) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return p, nil
 }
 
+// progressContent renders the progress bars of the modules, followed by the
+// stages matrix once the server sent the state of the stages.
+func (p *Progress) progressContent() string {
+	if !p.stages.HasProgress() {
+		return p.bars.View()
+	}
+	return lipgloss.JoinVertical(0,
+		p.bars.View(),
+		"",
+		p.stages.View(),
+	)
+}
+
 var labels = []string{
 	"Parallel engine blocks processed: ",
 	"Target block: ",
@@ -203,6 +231,9 @@ func (p *Progress) SetSize(w, h int) {
 	if p.bars != nil {
 		p.bars.SetSize(w-2 /* borders */, h-headerHeight)
 	}
+	if p.stages != nil {
+		p.stages.SetSize(w-2 /* borders */, h-headerHeight)
+	}
 	p.progressView.Width = w
 	p.progressView.Height = h - headerHeight
 	p.Styles.StatusBarValue.Width(p.Common.Width - labelsMaxLen()) // adjust status bar width to force word wrap: full width - labels width
@@ -6,6 +6,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/streamingfast/substreams"
 	"github.com/streamingfast/substreams/client"
 	"github.com/streamingfast/substreams/manifest"
 	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
@@ -37,6 +38,7 @@ type RequestConfig struct {
 	StartBlock                  int64
 	StopBlock                   string
 	FinalBlocksOnly             bool
+	AllowSunsetModules          bool
 	Headers                     map[string]string
 	OutputModule                string
 	SubstreamsClientConfig      *client.SubstreamsClientConfig
@@ -261,6 +263,9 @@ func (c *RequestConfig) NewInstance() (*RequestInstance, error) {
 		OutputModule:                        c.OutputModule,
 		ProductionMode:                      c.ProdMode,
 		DebugInitialStoreSnapshotForModules: c.DebugModulesInitialSnapshot,
+		Capabilities:                        substreams.SupportedCapabilities,
+		AllowSunsetModules:                  c.AllowSunsetModules,
+		Network:                             pkg.Network,
 	}
 
 	stream := streamui.New(req, ssClient, c.Headers, callOpts)
@@ -10,6 +10,7 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
 
+	"github.com/streamingfast/substreams/manifest"
 	pbsubstreamsrpc "github.com/streamingfast/substreams/pb/sf/substreams/rpc/v2"
 )
 
@@ -99,6 +100,7 @@ func (s *Stream) Update(msg tea.Msg) tea.Cmd {
 		*pbsubstreamsrpc.InitialSnapshotData,
 		*pbsubstreamsrpc.InitialSnapshotComplete,
 		*pbsubstreamsrpc.SessionInit,
+		*pbsubstreamsrpc.Error,
 		ResponseUnknownMsg:
 		return s.readNextMessage
 	case Msg:
@@ -169,7 +171,17 @@ func (s *Stream) routeNextMessage(resp *pbsubstreamsrpc.Response) tea.Msg {
 	case *pbsubstreamsrpc.Response_DebugSnapshotComplete:
 		return m.DebugSnapshotComplete
 	case *pbsubstreamsrpc.Response_Session:
+		// older endpoints don't check the network of the request
+		if err := manifest.ValidateNetwork(s.req.Network, m.Session.GenesisBlockId); err != nil {
+			if s.cancelContext != nil {
+				s.cancelContext()
+				s.cancelContext = nil
+			}
+			return StreamErrorMsg(err)
+		}
 		return m.Session
+	case *pbsubstreamsrpc.Response_Error:
+		return m.Error
 	}
 	return ResponseUnknownMsg(fmt.Sprintf("%T", resp.Message))
 }
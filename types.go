@@ -24,6 +24,12 @@ func NewModulesProgressResponse(in []*pbsubstreamsrpc.ModuleProgress) *pbsubstre
 	}
 }
 
+func NewStagesProgressResponse(in *pbsubstreamsrpc.StagesProgress) *pbsubstreamsrpc.Response {
+	return &pbsubstreamsrpc.Response{
+		Message: &pbsubstreamsrpc.Response_Progress{Progress: &pbsubstreamsrpc.ModulesProgress{Stages: in}},
+	}
+}
+
 func NewSnapshotData(in *pbsubstreamsrpc.InitialSnapshotData) *pbsubstreamsrpc.Response {
 	return &pbsubstreamsrpc.Response{
 		Message: &pbsubstreamsrpc.Response_DebugSnapshotData{DebugSnapshotData: in},
@@ -36,8 +42,31 @@ func NewSnapshotComplete() *pbsubstreamsrpc.Response {
 	}
 }
 
+func NewErrorResponse(in *pbsubstreamsrpc.Error) *pbsubstreamsrpc.Response {
+	return &pbsubstreamsrpc.Response{
+		Message: &pbsubstreamsrpc.Response_Error{Error: in},
+	}
+}
+
 // BlockHooks will always be called with a valid clock
 type BlockHook func(ctx context.Context, clock *pbsubstreams.Clock) error
 
 // PostJobHooks will be called at the end of a job. The clock can be `nil` in some circumstances, or it can be >= job.StopBlock
 type PostJobHook func(ctx context.Context, clock *pbsubstreams.Clock) error
+
+// OutputSamplingHeader is the request header through which a development mode
+// client advertises that it can only render a sample of the outputs. Its value
+// is the N in "every Nth block", blocks where any module produced data are always sent.
+const OutputSamplingHeader = "X-Sf-Substreams-Output-Sampling"
+
+// BlockSourceHeader is the request header through which a client overrides
+// where the server reads the blocks of its stream from: `live-only` to fail
+// instead of reading the merged blocks files, `merged-files-distance=<blocks>`
+// to read the blocks at least that many blocks below the head from the merged
+// blocks files, or `default`.
+const BlockSourceHeader = "X-Sf-Substreams-Block-Source"
+
+// TerminationReasonTrailer is the response trailer telling why a stream of
+// blocks ended without error: `stop_block`, or the stop condition of the
+// request that was met (`max_outputs`, `store_value` or `stop_at_time`).
+const TerminationReasonTrailer = "X-Sf-Substreams-Termination-Reason"
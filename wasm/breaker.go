@@ -0,0 +1,183 @@
+package wasm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/streamingfast/substreams/metrics"
+	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
+)
+
+// ExtensionBreakerConfig configures the circuit breakers of the WASM
+// extensions, see ExtensionBreakers.
+type ExtensionBreakerConfig struct {
+	FailureThreshold uint64        // consecutive failed calls to a provider tripping its breaker
+	Backoff          time.Duration // time the breaker stays open once tripped, doubled each time the trial call that follows fails
+	MaxBackoff       time.Duration // upper bound of Backoff, no bound when 0
+	CallTimeout      time.Duration // if not 0, the calls to the extensions taking longer fail and count as failed calls
+}
+
+// ExtensionUnavailableError is returned by the extensions of a provider whose
+// breaker is open. It is transient: the same call is expected to succeed
+// once the provider recovers.
+type ExtensionUnavailableError struct {
+	Provider   string
+	RetryAfter time.Duration
+}
+
+func (e *ExtensionUnavailableError) Error() string {
+	return fmt.Sprintf("wasm extension provider %q is unavailable, retry in %s", e.Provider, e.RetryAfter.Round(time.Millisecond))
+}
+
+// ExtensionBreakers holds a circuit breaker per extension provider (the
+// namespace of its extensions, ex: `eth` for RPC calls), shared by all the
+// requests of the process. Once the calls to a provider failed or timed out
+// FailureThreshold times in a row, its breaker opens: its extensions fail
+// immediately with an ExtensionUnavailableError for Backoff, instead of
+// every block execution waiting on the provider. The first call after that
+// is let through as a trial, closing the breaker when it succeeds and opening
+// it again, for twice as long, when it fails.
+type ExtensionBreakers struct {
+	config ExtensionBreakerConfig
+	logger *zap.Logger
+
+	mu       sync.Mutex
+	breakers map[string]*extensionBreaker // by provider
+
+	now func() time.Time
+}
+
+type extensionBreaker struct {
+	failures  uint64
+	openUntil time.Time     // zero while closed
+	backoff   time.Duration // of the next opening
+	trial     bool          // a trial call is in flight
+}
+
+func NewExtensionBreakers(config ExtensionBreakerConfig, logger *zap.Logger) *ExtensionBreakers {
+	return &ExtensionBreakers{
+		config:   config,
+		logger:   logger.Named("extension_breakers"),
+		breakers: map[string]*extensionBreaker{},
+		now:      time.Now,
+	}
+}
+
+// wrap returns `ext`, an extension of `provider`, guarded by its breaker.
+func (b *ExtensionBreakers) wrap(provider string, ext WASMExtension) WASMExtension {
+	return func(ctx context.Context, requestID string, clock *pbsubstreams.Clock, in []byte) ([]byte, error) {
+		trial, err := b.allow(provider)
+		if err != nil {
+			metrics.ExtensionBreakerRejectedCalls.Inc(provider)
+			return nil, err
+		}
+
+		callCtx := ctx
+		if b.config.CallTimeout != 0 {
+			var cancel context.CancelFunc
+			callCtx, cancel = context.WithTimeout(ctx, b.config.CallTimeout)
+			defer cancel()
+		}
+
+		out, err := ext(callCtx, requestID, clock, in)
+		if err != nil && ctx.Err() != nil {
+			// the request is over, the provider is not to blame
+			if trial {
+				b.release(provider)
+			}
+			return out, err
+		}
+		b.record(provider, trial, err)
+		if err != nil && errors.Is(callCtx.Err(), context.DeadlineExceeded) {
+			return out, fmt.Errorf("timed out after %s: %w", b.config.CallTimeout, err)
+		}
+		return out, err
+	}
+}
+
+// allow returns an ExtensionUnavailableError when the breaker of `provider`
+// is open or its trial call is in flight, and whether the call allowed is the
+// trial call.
+func (b *ExtensionBreakers) allow(provider string) (trial bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	breaker := b.breakers[provider]
+	if breaker == nil || breaker.openUntil.IsZero() {
+		return false, nil
+	}
+
+	now := b.now()
+	if now.Before(breaker.openUntil) {
+		return false, &ExtensionUnavailableError{Provider: provider, RetryAfter: breaker.openUntil.Sub(now)}
+	}
+	if breaker.trial {
+		return false, &ExtensionUnavailableError{Provider: provider, RetryAfter: breaker.backoff}
+	}
+	breaker.trial = true
+	return true, nil
+}
+
+// release gives up the trial call of `provider` without recording its
+// outcome.
+func (b *ExtensionBreakers) release(provider string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if breaker := b.breakers[provider]; breaker != nil {
+		breaker.trial = false
+	}
+}
+
+func (b *ExtensionBreakers) record(provider string, trial bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	breaker := b.breakers[provider]
+	if breaker == nil {
+		if err == nil {
+			return
+		}
+		breaker = &extensionBreaker{backoff: b.config.Backoff}
+		b.breakers[provider] = breaker
+	}
+
+	if trial {
+		breaker.trial = false
+	}
+
+	if err == nil {
+		if !breaker.openUntil.IsZero() {
+			b.logger.Info("extension provider recovered, closing its breaker", zap.String("provider", provider))
+		}
+		breaker.failures = 0
+		breaker.openUntil = time.Time{}
+		breaker.backoff = b.config.Backoff
+		return
+	}
+
+	breaker.failures++
+	switch {
+	case trial:
+		breaker.backoff *= 2
+		if b.config.MaxBackoff != 0 && breaker.backoff > b.config.MaxBackoff {
+			breaker.backoff = b.config.MaxBackoff
+		}
+	case breaker.failures < b.config.FailureThreshold || !breaker.openUntil.IsZero():
+		return
+	}
+
+	breaker.openUntil = b.now().Add(breaker.backoff)
+	metrics.ExtensionBreakerTrips.Inc(provider)
+	b.logger.Warn("extension provider failing, opening its breaker",
+		zap.String("provider", provider),
+		zap.Uint64("consecutive_failures", breaker.failures),
+		zap.Duration("backoff", breaker.backoff),
+		zap.Error(err),
+	)
+}
@@ -0,0 +1,99 @@
+package wasm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
+)
+
+func TestExtensionBreakers(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	breakers := NewExtensionBreakers(ExtensionBreakerConfig{FailureThreshold: 2, Backoff: time.Second, MaxBackoff: 3 * time.Second}, zap.NewNop())
+	breakers.now = func() time.Time { return now }
+
+	var calls int
+	var failing bool
+	ext := breakers.wrap("eth", func(ctx context.Context, requestID string, clock *pbsubstreams.Clock, in []byte) ([]byte, error) {
+		calls++
+		if failing {
+			return nil, errors.New("rpc down")
+		}
+		return in, nil
+	})
+	other := breakers.wrap("other", func(ctx context.Context, requestID string, clock *pbsubstreams.Clock, in []byte) ([]byte, error) {
+		return in, nil
+	})
+	call := func(ext WASMExtension) error {
+		_, err := ext(ctx, "req", &pbsubstreams.Clock{}, []byte("in"))
+		return err
+	}
+	assertUnavailable := func(err error) {
+		t.Helper()
+		var unavailable *ExtensionUnavailableError
+		require.True(t, errors.As(err, &unavailable), "got %v", err)
+		assert.Equal(t, "eth", unavailable.Provider)
+	}
+
+	require.NoError(t, call(ext))
+
+	failing = true
+	assert.EqualError(t, call(ext), "rpc down")
+	assert.EqualError(t, call(ext), "rpc down", "tripped at the threshold")
+	assertUnavailable(call(ext))
+	assert.Equal(t, 3, calls, "calls fail immediately while open")
+	require.NoError(t, call(other), "breakers are per provider")
+
+	now = now.Add(time.Second)
+	assert.EqualError(t, call(ext), "rpc down", "trial call")
+	assert.Equal(t, 4, calls)
+	now = now.Add(time.Second)
+	assertUnavailable(call(ext))
+	now = now.Add(time.Second)
+	assert.EqualError(t, call(ext), "rpc down", "backoff doubled after the failed trial")
+
+	now = now.Add(3 * time.Second)
+	failing = false
+	require.NoError(t, call(ext), "successful trial closes the breaker")
+	require.NoError(t, call(ext))
+
+	failing = true
+	assert.EqualError(t, call(ext), "rpc down")
+	assert.EqualError(t, call(ext), "rpc down")
+	assertUnavailable(call(ext))
+	now = now.Add(time.Second)
+	assert.EqualError(t, call(ext), "rpc down", "backoff reset once recovered")
+}
+
+func TestExtensionBreakers_CallTimeout(t *testing.T) {
+	breakers := NewExtensionBreakers(ExtensionBreakerConfig{FailureThreshold: 1, Backoff: time.Minute, CallTimeout: 10 * time.Millisecond}, zap.NewNop())
+	ext := breakers.wrap("eth", func(ctx context.Context, requestID string, clock *pbsubstreams.Clock, in []byte) ([]byte, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	_, err := ext(context.Background(), "req", &pbsubstreams.Clock{}, nil)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	_, err = ext(context.Background(), "req", &pbsubstreams.Clock{}, nil)
+	var unavailable *ExtensionUnavailableError
+	assert.True(t, errors.As(err, &unavailable))
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	breakers = NewExtensionBreakers(ExtensionBreakerConfig{FailureThreshold: 1, Backoff: time.Minute, CallTimeout: time.Minute}, zap.NewNop())
+	ext = breakers.wrap("eth", func(ctx context.Context, requestID string, clock *pbsubstreams.Clock, in []byte) ([]byte, error) {
+		return nil, ctx.Err()
+	})
+	_, err = ext(canceled, "req", &pbsubstreams.Clock{}, nil)
+	assert.ErrorIs(t, err, context.Canceled)
+	_, err = ext(canceled, "req", &pbsubstreams.Clock{}, nil)
+	assert.ErrorIs(t, err, context.Canceled, "the end of the request doesn't trip the breaker")
+}
@@ -7,12 +7,14 @@ import (
 	"github.com/dustin/go-humanize"
 	"github.com/shopspring/decimal"
 
+	pbssinternal "github.com/streamingfast/substreams/pb/sf/substreams/intern/v2"
 	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
 	"github.com/streamingfast/substreams/storage/store"
 )
 
 type Call struct {
 	Clock      *pbsubstreams.Clock // Used by WASM extensions
+	Final      bool                // the block of Clock is final, see BlockIsFinal
 	ModuleName string
 	Entrypoint string
 
@@ -28,6 +30,15 @@ type Call struct {
 	Logs           []string
 	LogsByteCount  uint64
 	ExecutionStack []string
+
+	StoreOperations uint64 // reads and writes of the stores
+
+	// RecordStoreReads enables the recording of the reads from the input
+	// stores in StoreReads, one entry per store read, in the order of their
+	// first read.
+	RecordStoreReads bool
+	StoreReads       []*pbssinternal.StoreReads
+	storeReads       map[int]*storeReads // by input store index
 }
 
 func NewCall(clock *pbsubstreams.Clock, moduleName string, entrypoint string, arguments []Argument) *Call {
@@ -102,6 +113,23 @@ func (c *Call) AppendLog(message string) {
 	}
 }
 
+// BlockNumber, BlockID, BlockTimestamp and BlockIsFinal back the `block` host
+// functions, letting modules read the header fields of the block being
+// processed without decoding it.
+func (c *Call) BlockNumber() uint64 { return c.Clock.Number }
+func (c *Call) BlockID() string     { return c.Clock.Id }
+
+// BlockTimestamp returns the timestamp of the block, in nanoseconds since the
+// Unix epoch.
+func (c *Call) BlockTimestamp() int64 { return c.Clock.Timestamp.AsTime().UnixNano() }
+
+// BlockIsFinal returns whether the block was final when processed. Unlike the
+// other block fields, it depends on when the block is processed: blocks are
+// always final in the backprocessing jobs, only the live blocks can be
+// reversible. The requests using it must negotiate the `block_is_final`
+// capability, see reqctx.RequestDetails.UncachedModules.
+func (c *Call) BlockIsFinal() bool { return c.Final }
+
 func (c *Call) SetOutputStore(store store.Store) {
 	c.outputStore = store
 }
@@ -130,6 +158,10 @@ func (c *Call) DoDeletePrefix(ord uint64, prefix string) {
 	c.traceStateWrites("delete_prefix", prefix)
 	c.outputStore.DeletePrefix(ord, prefix)
 }
+func (c *Call) DoDeleteRange(ord uint64, startKey, endKey string) {
+	c.traceStateWrites("delete_range", startKey)
+	c.outputStore.DeleteRange(ord, startKey, endKey)
+}
 func (c *Call) DoAddBigInt(ord uint64, key string, value string) {
 	c.validateWithValueType("add_bigint", pbsubstreams.Module_KindStore_UPDATE_POLICY_ADD, "bigint", key)
 
@@ -200,43 +232,49 @@ func (c *Call) DoSetMaxBigDecimal(ord uint64, key string, value string) {
 func (c *Call) DoGetAt(storeIndex int, ord uint64, key string) (value []byte, found bool) {
 	c.validateStoreIndex(storeIndex, "get_at")
 	readStore := c.inputStores[storeIndex]
+	value, found = readStore.GetAt(ord, key)
 	c.traceStateReads("get_at", storeIndex, found, key)
-	return readStore.GetAt(ord, key)
+	return value, found
 }
 
 func (c *Call) DoHasAt(storeIndex int, ord uint64, key string) (found bool) {
 	c.validateStoreIndex(storeIndex, "has_at")
 	readStore := c.inputStores[storeIndex]
+	found = readStore.HasAt(ord, key)
 	c.traceStateReads("has_at", storeIndex, found, key)
-	return readStore.HasAt(ord, key)
+	return found
 }
 
 func (c *Call) DoGetFirst(storeIndex int, key string) (value []byte, found bool) {
 	c.validateStoreIndex(storeIndex, "get_first")
 	readStore := c.inputStores[storeIndex]
+	value, found = readStore.GetFirst(key)
 	c.traceStateReads("get_first", storeIndex, found, key)
-	return readStore.GetFirst(key)
+	return value, found
 }
 
 func (c *Call) DoHasFirst(storeIndex int, key string) (found bool) {
 	c.validateStoreIndex(storeIndex, "has_first")
 	readStore := c.inputStores[storeIndex]
+	found = readStore.HasFirst(key)
 	c.traceStateReads("has_first", storeIndex, found, key)
-	return readStore.HasFirst(key)
+	return found
 }
 
 func (c *Call) DoGetLast(storeIndex int, key string) (value []byte, found bool) {
 	c.validateStoreIndex(storeIndex, "get_last")
 	readStore := c.inputStores[storeIndex]
+	value, found = readStore.GetLast(key)
 	c.traceStateReads("get_last", storeIndex, found, key)
-	return readStore.GetLast(key)
+	return value, found
 }
 
 func (c *Call) DoHasLast(storeIndex int, key string) (found bool) {
 	c.validateStoreIndex(storeIndex, "has_last")
 	readStore := c.inputStores[storeIndex]
+	found = readStore.HasLast(key)
 	c.traceStateReads("has_last", storeIndex, found, key)
-	return readStore.HasLast(key)
+	return found
 }
 
 func (c *Call) validateStoreIndex(storeIndex int, stateFunc string) {
@@ -267,6 +305,7 @@ func (c *Call) validateWithTwoValueTypes(stateFunc string, updatePolicy pbsubstr
 }
 
 func (c *Call) traceStateWrites(stateFunc, key string) {
+	c.StoreOperations++
 	store := c.outputStore
 	var line string
 	if store == nil {
@@ -278,9 +317,44 @@ func (c *Call) traceStateWrites(stateFunc, key string) {
 }
 
 func (c *Call) traceStateReads(stateFunc string, storeIndex int, found bool, key string) {
+	c.StoreOperations++
 	store := c.inputStores[storeIndex]
 	line := fmt.Sprintf("%s::%s key: %q, found: %v, store details: %s", store.Name(), stateFunc, key, found, store.String())
 	c.ExecutionStack = append(c.ExecutionStack, line)
+
+	if c.RecordStoreReads {
+		c.recordStoreRead(storeIndex, found, key)
+	}
+}
+
+func (c *Call) recordStoreRead(storeIndex int, found bool, key string) {
+	if c.storeReads == nil {
+		c.storeReads = map[int]*storeReads{}
+	}
+
+	reads := c.storeReads[storeIndex]
+	if reads == nil {
+		reads = &storeReads{
+			StoreReads: &pbssinternal.StoreReads{StoreName: c.inputStores[storeIndex].Name()},
+			seen:       map[string]bool{},
+		}
+		c.storeReads[storeIndex] = reads
+		c.StoreReads = append(c.StoreReads, reads.StoreReads)
+	}
+
+	reads.ReadCount++
+	if !found {
+		reads.NotFoundCount++
+	}
+	if !reads.seen[key] {
+		reads.seen[key] = true
+		reads.Keys = append(reads.Keys, key)
+	}
+}
+
+type storeReads struct {
+	*pbssinternal.StoreReads
+	seen map[string]bool
 }
 
 func (c *Call) returnInvalidPolicy(stateFunc, policy string) {
@@ -5,8 +5,10 @@ import (
 
 	"github.com/streamingfast/dstore"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
 
+	pbssinternal "github.com/streamingfast/substreams/pb/sf/substreams/intern/v2"
 	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
 	"github.com/streamingfast/substreams/storage/store"
 )
@@ -479,6 +481,31 @@ func Test_CallStoreOps(t *testing.T) {
 	}
 }
 
+func TestCall_RecordStoreReads(t *testing.T) {
+	newInputStore := func(name string) store.Store {
+		conf, err := store.NewConfig(name, 0, "", pbsubstreams.Module_KindStore_UPDATE_POLICY_SET, "string", dstore.NewMockStore(nil), "test")
+		require.NoError(t, err)
+		s := conf.NewFullKV(zap.NewNop())
+		s.SetBytes(0, "a", []byte("1"))
+		return s
+	}
+
+	c := &Call{inputStores: []store.Reader{newInputStore("store_a"), newInputStore("store_b"), newInputStore("store_c")}}
+	c.DoGetLast(1, "a")
+	assert.Nil(t, c.StoreReads, "not recorded by default")
+
+	c.RecordStoreReads = true
+	c.DoGetLast(1, "a")
+	c.DoHasFirst(0, "b")
+	c.DoGetAt(1, 0, "c")
+	c.DoHasLast(1, "a")
+
+	assert.Equal(t, []*pbssinternal.StoreReads{
+		{StoreName: "store_b", Keys: []string{"a", "c"}, ReadCount: 3, NotFoundCount: 1},
+		{StoreName: "store_a", Keys: []string{"b"}, ReadCount: 1, NotFoundCount: 1},
+	}, c.StoreReads)
+}
+
 func newTestCall(updatePolicy pbsubstreams.Module_KindStore_UpdatePolicy, valueType string) *Call {
 	myStore := dstore.NewMockStore(nil)
 	storeConf, err := store.NewConfig("test", 0, "", updatePolicy, valueType, myStore, "test")
@@ -0,0 +1,410 @@
+package wasm
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/streamingfast/dstore"
+	"go.uber.org/zap"
+)
+
+// CompilationCache shares the compiled artifacts of WASM modules across workers
+// through an object store, so that a newly started worker downloads them instead
+// of compiling the module again on first use.
+//
+// Artifacts are keyed by runtime, runtime version, platform and module code hash
+// (see CompilationCacheKey). They are kept in a local directory, which the
+// runtimes use as their own on-disk compilation cache, and published to the
+// object store as a tar archive of that directory. The directory of a key is
+// only ever created complete, renamed into place from a temporary directory,
+// along with the checksums of its artifacts (see checksumsFilename), verified
+// before it is used.
+type CompilationCache struct {
+	store    dstore.Store
+	localDir string
+
+	locksLock sync.Mutex
+	locks     map[string]*sync.Mutex // by key, around downloads and renames
+}
+
+func NewCompilationCache(store dstore.Store, localDir string) *CompilationCache {
+	return &CompilationCache{
+		store:    store,
+		localDir: localDir,
+		locks:    map[string]*sync.Mutex{},
+	}
+}
+
+// checksumsFilename is the file listing the SHA-256 checksums of the artifacts
+// of a key, one `<hex checksum>  <slash separated name>` line per file.
+const checksumsFilename = ".sha256sums"
+
+// CompilationCacheKey returns the cache key of `wasmCode` compiled by `runtimeName`,
+// `variant` distinguishes compilation settings producing different artifacts
+// for the same code (ex: fuel metering), it can be empty.
+func CompilationCacheKey(runtimeName string, runtimeModulePath string, variant string, wasmCode []byte) string {
+	engine := fmt.Sprintf("%s-%s-%s-%s", runtimeName, moduleVersion(runtimeModulePath), runtime.GOOS, runtime.GOARCH)
+	if variant != "" {
+		engine += "-" + variant
+	}
+	return fmt.Sprintf("%s/%x", engine, sha256.Sum256(wasmCode))
+}
+
+// Fetch returns the local directory holding the artifacts for `key`, downloading
+// them from the object store if they are not present locally, their checksums
+// verified. `found` is false when no valid artifacts exist yet: `dir` is then a
+// new temporary directory, the runtime is expected to compile the module into
+// it and call Publish, or to remove it.
+func (c *CompilationCache) Fetch(ctx context.Context, key string) (dir string, found bool, err error) {
+	unlock := c.lock(key)
+	defer unlock()
+
+	dir = c.keyDir(key)
+	if err := verifyDir(dir); err == nil {
+		return dir, true, nil
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		zlog.Warn("invalid wasm compilation cache directory, discarding it", zap.String("key", key), zap.Error(err))
+		if err := os.RemoveAll(dir); err != nil {
+			return "", false, fmt.Errorf("removing invalid compilation cache directory: %w", err)
+		}
+	}
+
+	tmpDir, err := c.tempDir(key)
+	if err != nil {
+		return "", false, err
+	}
+
+	reader, err := c.store.OpenObject(ctx, objectName(key))
+	if err != nil {
+		if errors.Is(err, dstore.ErrNotFound) {
+			return tmpDir, false, nil
+		}
+		os.RemoveAll(tmpDir)
+		return "", false, fmt.Errorf("opening compilation cache object %q: %w", key, err)
+	}
+	defer reader.Close()
+
+	if err := untarDir(reader, tmpDir); err != nil {
+		os.RemoveAll(tmpDir)
+		return "", false, fmt.Errorf("extracting compilation cache object %q: %w", key, err)
+	}
+	if err := verifyDir(tmpDir); err != nil {
+		zlog.Warn("invalid wasm compilation cache object, compiling", zap.String("key", key), zap.Error(err))
+		if err := os.RemoveAll(tmpDir); err != nil {
+			return "", false, fmt.Errorf("removing invalid compilation cache object: %w", err)
+		}
+		if tmpDir, err = c.tempDir(key); err != nil {
+			return "", false, err
+		}
+		return tmpDir, false, nil
+	}
+	if err := renameDir(tmpDir, dir); err != nil {
+		return "", false, err
+	}
+
+	zlog.Debug("wasm compilation cache hit from object store", zap.String("key", key))
+	return dir, true, nil
+}
+
+// Publish uploads the artifacts written by the runtime in `dir`, the temporary
+// directory returned by Fetch for `key`, and moves it into place. `dir` is
+// removed on failure.
+func (c *CompilationCache) Publish(ctx context.Context, key string, dir string) (err error) {
+	defer func() {
+		if err != nil {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	if err := writeChecksums(dir); err != nil {
+		return fmt.Errorf("computing compilation cache checksums: %w", err)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	count, err := tarDir(dir, buf)
+	if err != nil {
+		return fmt.Errorf("archiving compilation cache directory: %w", err)
+	}
+	if count <= 1 {
+		return os.RemoveAll(dir) // only the checksums, nothing compiled
+	}
+
+	if err := c.store.WriteObject(ctx, objectName(key), buf); err != nil {
+		return fmt.Errorf("writing compilation cache object %q: %w", key, err)
+	}
+
+	unlock := c.lock(key)
+	defer unlock()
+	if err := renameDir(dir, c.keyDir(key)); err != nil {
+		return err
+	}
+
+	zlog.Debug("wasm compilation cache published", zap.String("key", key), zap.Int("files", count))
+	return nil
+}
+
+// ReadArtifact returns the content of the artifact `name` (slash separated) of
+// `dir`, a directory returned by Fetch, once its checksum is verified.
+func ReadArtifact(dir, name string) ([]byte, error) {
+	checksums, err := readChecksums(dir)
+	if err != nil {
+		return nil, err
+	}
+	expected, found := checksums[name]
+	if !found {
+		return nil, fmt.Errorf("no checksum for artifact %q", name)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+	if err != nil {
+		return nil, err
+	}
+	if actual := fmt.Sprintf("%x", sha256.Sum256(content)); actual != expected {
+		return nil, fmt.Errorf("artifact %q checksum is %s, expected %s", name, actual, expected)
+	}
+	return content, nil
+}
+
+func (c *CompilationCache) keyDir(key string) string {
+	return filepath.Join(c.localDir, filepath.FromSlash(key))
+}
+
+// tempDir creates a temporary directory next to the directory of `key`, so that
+// it can be renamed into place.
+func (c *CompilationCache) tempDir(key string) (string, error) {
+	dir := c.keyDir(key)
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return "", fmt.Errorf("creating compilation cache directory: %w", err)
+	}
+	tmpDir, err := os.MkdirTemp(filepath.Dir(dir), filepath.Base(dir)+".tmp-")
+	if err != nil {
+		return "", fmt.Errorf("creating compilation cache temporary directory: %w", err)
+	}
+	return tmpDir, nil
+}
+
+func (c *CompilationCache) lock(key string) (unlock func()) {
+	c.locksLock.Lock()
+	lock, found := c.locks[key]
+	if !found {
+		lock = &sync.Mutex{}
+		c.locks[key] = lock
+	}
+	c.locksLock.Unlock()
+
+	lock.Lock()
+	return lock.Unlock
+}
+
+// renameDir moves `tmpDir` to `dir` atomically. When another process already
+// moved a valid directory there, `tmpDir` is removed instead.
+func renameDir(tmpDir, dir string) error {
+	err := os.Rename(tmpDir, dir)
+	if err == nil {
+		return nil
+	}
+	if verifyDir(dir) == nil {
+		return os.RemoveAll(tmpDir)
+	}
+	os.RemoveAll(tmpDir)
+	return fmt.Errorf("moving compilation cache directory into place: %w", err)
+}
+
+// verifyDir checks the artifacts of `dir` against its checksums, failing with
+// fs.ErrNotExist when `dir` does not exist.
+func verifyDir(dir string) error {
+	if _, err := os.Stat(dir); err != nil {
+		return err
+	}
+	checksums, err := readChecksums(dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("no checksums, incomplete directory")
+		}
+		return err
+	}
+	actual, err := dirChecksums(dir)
+	if err != nil {
+		return err
+	}
+	if len(actual) != len(checksums) {
+		return fmt.Errorf("%d artifacts found, %d expected", len(actual), len(checksums))
+	}
+	for name, checksum := range checksums {
+		if actual[name] != checksum {
+			return fmt.Errorf("artifact %q checksum is %q, expected %s", name, actual[name], checksum)
+		}
+	}
+	return nil
+}
+
+func writeChecksums(dir string) error {
+	checksums, err := dirChecksums(dir)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(checksums))
+	for name := range checksums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	buf := bytes.NewBuffer(nil)
+	for _, name := range names {
+		fmt.Fprintf(buf, "%s  %s\n", checksums[name], name)
+	}
+	return os.WriteFile(filepath.Join(dir, checksumsFilename), buf.Bytes(), 0644)
+}
+
+func readChecksums(dir string) (map[string]string, error) {
+	content, err := os.ReadFile(filepath.Join(dir, checksumsFilename))
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+		if line == "" {
+			continue
+		}
+		checksum, name, ok := strings.Cut(line, "  ")
+		if !ok {
+			return nil, fmt.Errorf("invalid checksums line %q", line)
+		}
+		out[name] = checksum
+	}
+	return out, nil
+}
+
+// dirChecksums returns the checksums of the regular files of `dir`, but the
+// checksums file, by slash separated name.
+func dirChecksums(dir string) (map[string]string, error) {
+	out := map[string]string{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		name = filepath.ToSlash(name)
+		if name == checksumsFilename {
+			return nil
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		out[name] = fmt.Sprintf("%x", sha256.Sum256(content))
+		return nil
+	})
+	return out, err
+}
+
+func objectName(key string) string {
+	return key + ".tar"
+}
+
+func tarDir(dir string, w io.Writer) (count int, err error) {
+	tw := tar.NewWriter(w)
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(name)
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if _, err := tw.Write(content); err != nil {
+			return err
+		}
+		count++
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return count, tw.Close()
+}
+
+func untarDir(r io.Reader, dir string) error {
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		path := filepath.Join(dir, filepath.FromSlash(header.Name))
+		if !strings.HasPrefix(path, filepath.Clean(dir)+string(os.PathSeparator)) {
+			return fmt.Errorf("invalid file name %q", header.Name)
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			return err
+		}
+	}
+}
+
+// moduleVersion returns the version of Go module `path` linked in the binary,
+// or "unknown" if it cannot be determined.
+func moduleVersion(path string) string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == path {
+			if dep.Replace != nil {
+				dep = dep.Replace
+			}
+			return dep.Version
+		}
+	}
+	return "unknown"
+}
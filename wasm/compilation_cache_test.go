@@ -0,0 +1,95 @@
+package wasm
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/streamingfast/dstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompilationCache_FetchPublish(t *testing.T) {
+	ctx := context.Background()
+	store, err := dstore.NewStore("file://"+t.TempDir(), "", "", false)
+	require.NoError(t, err)
+
+	key := CompilationCacheKey("wazero", "github.com/tetratelabs/wazero", "", []byte("code"))
+
+	worker1 := NewCompilationCache(store, t.TempDir())
+	dir, found, err := worker1.Fetch(ctx, key)
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "engine"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "engine", "artifact"), []byte("compiled"), 0644))
+	require.NoError(t, worker1.Publish(ctx, key, dir))
+
+	published, found, err := worker1.Fetch(ctx, key)
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.NotEqual(t, dir, published, "compiled into a temporary directory moved into place")
+	_, err = os.Stat(dir)
+	assert.True(t, os.IsNotExist(err))
+
+	worker2 := NewCompilationCache(store, t.TempDir())
+	dir, found, err = worker2.Fetch(ctx, key)
+	require.NoError(t, err)
+	assert.True(t, found)
+
+	content, err := ReadArtifact(dir, "engine/artifact")
+	require.NoError(t, err)
+	assert.Equal(t, "compiled", string(content))
+}
+
+func TestCompilationCache_Corrupted(t *testing.T) {
+	ctx := context.Background()
+	store, err := dstore.NewStore("file://"+t.TempDir(), "", "", false)
+	require.NoError(t, err)
+	key := CompilationCacheKey("wasmtime", "github.com/bytecodealliance/wasmtime-go/v4", "", []byte("code"))
+
+	worker := NewCompilationCache(store, t.TempDir())
+	dir, _, err := worker.Fetch(ctx, key)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "module.bin"), []byte("compiled"), 0644))
+	require.NoError(t, worker.Publish(ctx, key, dir))
+
+	dir, found, err := worker.Fetch(ctx, key)
+	require.NoError(t, err)
+	require.True(t, found)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "module.bin"), []byte("truncat"), 0644))
+	_, err = ReadArtifact(dir, "module.bin")
+	assert.ErrorContains(t, err, "checksum")
+
+	// the corrupted local directory is discarded, the artifacts downloaded again
+	dir, found, err = worker.Fetch(ctx, key)
+	require.NoError(t, err)
+	require.True(t, found)
+	content, err := ReadArtifact(dir, "module.bin")
+	require.NoError(t, err)
+	assert.Equal(t, "compiled", string(content))
+
+	// a partially extracted directory is not a hit
+	partial := NewCompilationCache(store, t.TempDir())
+	partialDir := filepath.Join(partial.localDir, filepath.FromSlash(key))
+	require.NoError(t, os.MkdirAll(partialDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(partialDir, "module.bin"), []byte("comp"), 0644))
+	dir, found, err = partial.Fetch(ctx, key)
+	require.NoError(t, err)
+	require.True(t, found)
+	content, err = ReadArtifact(dir, "module.bin")
+	require.NoError(t, err)
+	assert.Equal(t, "compiled", string(content))
+}
+
+func TestCompilationCacheKey(t *testing.T) {
+	plain := CompilationCacheKey("wasmtime", "github.com/bytecodealliance/wasmtime-go/v4", "", []byte("code"))
+	fuel := CompilationCacheKey("wasmtime", "github.com/bytecodealliance/wasmtime-go/v4", "fuel", []byte("code"))
+	other := CompilationCacheKey("wasmtime", "github.com/bytecodealliance/wasmtime-go/v4", "", []byte("other"))
+
+	assert.NotEqual(t, plain, fuel)
+	assert.NotEqual(t, plain, other)
+	assert.Equal(t, filepath.Dir(plain), filepath.Dir(other))
+}
@@ -0,0 +1,48 @@
+package wasm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Extensions is a WASMExtensioner providing the functions it holds, by
+// namespace then name.
+type Extensions map[string]map[string]WASMExtension
+
+func (e Extensions) WASMExtensions() map[string]map[string]WASMExtension { return e }
+
+var hostFunctionSets = map[string]WASMExtensioner{}
+
+// RegisterHostFunctions makes the host functions of `set` available to the
+// modules under `name`, once enabled by the operators, see HostFunctions. It is
+// meant to be called from the `init` of the packages providing them.
+func RegisterHostFunctions(name string, set WASMExtensioner) {
+	if hostFunctionSets[name] != nil {
+		panic(fmt.Sprintf("host functions %q already registered", name))
+	}
+	hostFunctionSets[name] = set
+}
+
+// HostFunctionSetNames returns the names of the sets of host functions
+// registered, sorted.
+func HostFunctionSetNames() (out []string) {
+	for name := range hostFunctionSets {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// HostFunctions returns the sets of host functions registered under `names`,
+// to be given to the registries as extensions.
+func HostFunctions(names []string) (out []WASMExtensioner, err error) {
+	for _, name := range names {
+		set := hostFunctionSets[name]
+		if set == nil {
+			return nil, fmt.Errorf("unknown host functions %q, available: %s", name, strings.Join(HostFunctionSetNames(), ", "))
+		}
+		out = append(out, set)
+	}
+	return out, nil
+}
@@ -0,0 +1,62 @@
+package hostfunctions
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/shopspring/decimal"
+
+	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
+	"github.com/streamingfast/substreams/wasm"
+)
+
+// divisionPrecision is the number of decimal places of the quotients which
+// are not exact.
+const divisionPrecision = 100
+
+func init() {
+	wasm.RegisterHostFunctions("bigdecimal", wasm.Extensions{
+		"bigdecimal": bigDecimalFunctions(),
+	})
+}
+
+func bigDecimalFunctions() map[string]wasm.WASMExtension {
+	return map[string]wasm.WASMExtension{
+		"add": bigDecimalOperation(func(a, b decimal.Decimal) (decimal.Decimal, error) { return a.Add(b), nil }),
+		"sub": bigDecimalOperation(func(a, b decimal.Decimal) (decimal.Decimal, error) { return a.Sub(b), nil }),
+		"mul": bigDecimalOperation(func(a, b decimal.Decimal) (decimal.Decimal, error) { return a.Mul(b), nil }),
+		"div": bigDecimalOperation(func(a, b decimal.Decimal) (decimal.Decimal, error) {
+			if b.IsZero() {
+				return decimal.Decimal{}, fmt.Errorf("division by zero")
+			}
+			return a.DivRound(b, divisionPrecision), nil
+		}),
+	}
+}
+
+// bigDecimalOperation returns a host function applying `op` to two decimals
+// given as text separated by a space in its input, the result being returned
+// as text.
+func bigDecimalOperation(op func(a, b decimal.Decimal) (decimal.Decimal, error)) wasm.WASMExtension {
+	return func(ctx context.Context, requestID string, clock *pbsubstreams.Clock, in []byte) ([]byte, error) {
+		operands := strings.Fields(string(in))
+		if len(operands) != 2 {
+			return nil, fmt.Errorf("expected two decimals separated by a space, got %q", in)
+		}
+		a, err := decimal.NewFromString(operands[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid decimal %q: %w", operands[0], err)
+		}
+		b, err := decimal.NewFromString(operands[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid decimal %q: %w", operands[1], err)
+		}
+
+		result, err := op(a, b)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(result.String()), nil
+	}
+}
@@ -0,0 +1,61 @@
+// Package hostfunctions provides sets of host functions commonly needed by the
+// modules, registered with wasm.RegisterHostFunctions and enabled by name by
+// the operators.
+package hostfunctions
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+	"golang.org/x/crypto/sha3"
+
+	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
+	"github.com/streamingfast/substreams/wasm"
+)
+
+func init() {
+	wasm.RegisterHostFunctions("crypto", wasm.Extensions{
+		"crypto": {
+			"keccak256":         keccak256,
+			"secp256k1_recover": secp256k1Recover,
+		},
+	})
+}
+
+// keccak256 returns the Keccak-256 hash of `in`, as used by Ethereum.
+func keccak256(ctx context.Context, requestID string, clock *pbsubstreams.Clock, in []byte) ([]byte, error) {
+	hash := sha3.NewLegacyKeccak256()
+	hash.Write(in)
+	return hash.Sum(nil), nil
+}
+
+// secp256k1Recover returns the uncompressed public key (65 bytes) having signed
+// a hash, `in` being the hash (32 bytes) followed by the signature as `r || s ||
+// v` (65 bytes), `v` the recovery ID being 0, 1, 27 or 28.
+func secp256k1Recover(ctx context.Context, requestID string, clock *pbsubstreams.Clock, in []byte) ([]byte, error) {
+	if len(in) != 32+65 {
+		return nil, fmt.Errorf("expected a 32 bytes hash followed by a 65 bytes signature, got %d bytes", len(in))
+	}
+	hash, signature := in[:32], in[32:]
+
+	recoveryID := signature[64]
+	if recoveryID >= 27 {
+		recoveryID -= 27
+	}
+	if recoveryID > 1 {
+		return nil, fmt.Errorf("invalid recovery ID %d", signature[64])
+	}
+
+	// the compact signature is `v || r || s`, `v` being 27 + recovery ID for
+	// uncompressed keys
+	compact := make([]byte, 65)
+	compact[0] = 27 + recoveryID
+	copy(compact[1:], signature[:64])
+
+	publicKey, _, err := ecdsa.RecoverCompact(compact, hash)
+	if err != nil {
+		return nil, fmt.Errorf("recovering public key: %w", err)
+	}
+	return publicKey.SerializeUncompressed(), nil
+}
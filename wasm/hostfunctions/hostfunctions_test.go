@@ -0,0 +1,70 @@
+package hostfunctions
+
+import (
+	"context"
+	"encoding/hex"
+	"testing"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeccak256(t *testing.T) {
+	out, err := keccak256(context.Background(), "", nil, []byte("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, "1c8aff950685c2ed4bc3174f3472287b56d9517b9c948127319a09a7a36deac8", hex.EncodeToString(out))
+}
+
+func TestSecp256k1Recover(t *testing.T) {
+	key, err := secp256k1.GeneratePrivateKey()
+	require.NoError(t, err)
+	hash, err := keccak256(context.Background(), "", nil, []byte("message"))
+	require.NoError(t, err)
+
+	// `v || r || s` to `r || s || v`
+	compact := ecdsa.SignCompact(key, hash, false)
+	signature := append(compact[1:], compact[0])
+
+	out, err := secp256k1Recover(context.Background(), "", nil, append(hash, signature...))
+	require.NoError(t, err)
+	assert.Equal(t, key.PubKey().SerializeUncompressed(), out)
+
+	signature[64] -= 27
+	out, err = secp256k1Recover(context.Background(), "", nil, append(hash, signature...))
+	require.NoError(t, err)
+	assert.Equal(t, key.PubKey().SerializeUncompressed(), out)
+
+	_, err = secp256k1Recover(context.Background(), "", nil, hash)
+	assert.Error(t, err)
+}
+
+func TestBigDecimal(t *testing.T) {
+	tests := []struct {
+		function  string
+		in        string
+		expect    string
+		expectErr bool
+	}{
+		{"add", "1.5 2.25", "3.75", false},
+		{"sub", "1 2.5", "-1.5", false},
+		{"mul", "12345678901234567890 10", "123456789012345678900", false},
+		{"div", "1 4", "0.25", false},
+		{"div", "1 0", "", true},
+		{"add", "1", "", true},
+		{"add", "1 abc", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.function+" "+test.in, func(t *testing.T) {
+			out, err := bigDecimalFunctions()[test.function](context.Background(), "", nil, []byte(test.in))
+			if test.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expect, string(out))
+		})
+	}
+}
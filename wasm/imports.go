@@ -0,0 +1,54 @@
+package wasm
+
+import (
+	"github.com/streamingfast/substreams/wasm/wasmimports"
+)
+
+// UnsupportedImports returns the functions imported by the WASM module `code`
+// which are neither built in the runtimes nor provided by `extensions`, the
+// module failing to instantiate when there are some.
+func UnsupportedImports(code []byte, extensions []WASMExtensioner) (out []wasmimports.Import, err error) {
+	imports, err := wasmimports.FunctionImports(code)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, imp := range imports {
+		if wasmimports.IsBuiltin(imp.Namespace) {
+			continue
+		}
+		if !provides(extensions, imp) {
+			out = append(out, imp)
+		}
+	}
+	return out, nil
+}
+
+// UnsupportedNamespaces returns the namespaces of `namespaces` which are
+// neither built in the runtimes nor provided by `extensions`.
+func UnsupportedNamespaces(namespaces []string, extensions []WASMExtensioner) (out []string) {
+	for _, namespace := range namespaces {
+		if !wasmimports.IsBuiltin(namespace) && !providesNamespace(extensions, namespace) {
+			out = append(out, namespace)
+		}
+	}
+	return out
+}
+
+func provides(extensions []WASMExtensioner, imp wasmimports.Import) bool {
+	for _, ext := range extensions {
+		if ext.WASMExtensions()[imp.Namespace][imp.Name] != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func providesNamespace(extensions []WASMExtensioner, namespace string) bool {
+	for _, ext := range extensions {
+		if len(ext.WASMExtensions()[namespace]) != 0 {
+			return true
+		}
+	}
+	return false
+}
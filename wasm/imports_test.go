@@ -0,0 +1,65 @@
+package wasm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
+	"github.com/streamingfast/substreams/wasm/wasmimports"
+)
+
+// importingModule imports the functions `env::output`, `crypto::keccak256` and
+// `crypto::unknown`, and a memory from `env`.
+var importingModule = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00,
+	// types: (i32, i32) -> ()
+	0x01, 0x06, 0x01, 0x60, 0x02, 0x7f, 0x7f, 0x00,
+	// imports
+	0x02, 0x41, 0x04,
+	0x03, 'e', 'n', 'v', 0x06, 'o', 'u', 't', 'p', 'u', 't', 0x00, 0x00,
+	0x03, 'e', 'n', 'v', 0x06, 'm', 'e', 'm', 'o', 'r', 'y', 0x02, 0x01, 0x01, 0x02,
+	0x06, 'c', 'r', 'y', 'p', 't', 'o', 0x09, 'k', 'e', 'c', 'c', 'a', 'k', '2', '5', '6', 0x00, 0x00,
+	0x06, 'c', 'r', 'y', 'p', 't', 'o', 0x07, 'u', 'n', 'k', 'n', 'o', 'w', 'n', 0x00, 0x00,
+}
+
+func TestUnsupportedImports(t *testing.T) {
+	extensions := []WASMExtensioner{Extensions{
+		"crypto": {"keccak256": func(ctx context.Context, requestID string, clock *pbsubstreams.Clock, in []byte) ([]byte, error) {
+			return nil, nil
+		}},
+	}}
+
+	unsupported, err := UnsupportedImports(importingModule, extensions)
+	require.NoError(t, err)
+	assert.Equal(t, []wasmimports.Import{{Namespace: "crypto", Name: "unknown"}}, unsupported)
+
+	unsupported, err = UnsupportedImports(importingModule, nil)
+	require.NoError(t, err)
+	assert.Len(t, unsupported, 2)
+}
+
+func TestUnsupportedNamespaces(t *testing.T) {
+	extensions := []WASMExtensioner{Extensions{
+		"crypto": {"keccak256": func(ctx context.Context, requestID string, clock *pbsubstreams.Clock, in []byte) ([]byte, error) {
+			return nil, nil
+		}},
+	}}
+
+	assert.Equal(t, []string{"bigdecimal"}, UnsupportedNamespaces([]string{"env", "crypto", "bigdecimal"}, extensions))
+	assert.Empty(t, UnsupportedNamespaces(nil, extensions))
+}
+
+func TestHostFunctions(t *testing.T) {
+	RegisterHostFunctions("test", Extensions{})
+	defer delete(hostFunctionSets, "test")
+
+	sets, err := HostFunctions([]string{"test"})
+	require.NoError(t, err)
+	assert.Len(t, sets, 1)
+
+	_, err = HostFunctions([]string{"test", "unknown"})
+	assert.ErrorContains(t, err, `unknown host functions "unknown"`)
+}
@@ -2,6 +2,9 @@ package wasm
 
 import (
 	"context"
+	"fmt"
+	"sort"
+	"strings"
 
 	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
 )
@@ -62,6 +65,31 @@ type Instance interface {
 
 var runtimes = map[string]ModuleFactory{}
 
+// defaultRuntime is the runtime of the registries, unless overridden by the
+// `SUBSTREAMS_WASM_RUNTIME` env var, see SetDefaultRuntime.
+var defaultRuntime = "wazero"
+
 func RegisterModuleFactory(name string, factory ModuleFactory) {
 	runtimes[name] = factory
 }
+
+// RuntimeNames returns the names of the runtimes compiled in, sorted. The
+// wasmtime runtime is only compiled in the builds with cgo.
+func RuntimeNames() (out []string) {
+	for name := range runtimes {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// SetDefaultRuntime selects the runtime of the registries created from now on,
+// meant to be called at startup. It fails when the runtime `name` is not
+// compiled in.
+func SetDefaultRuntime(name string) error {
+	if runtimes[name] == nil {
+		return fmt.Errorf("wasm runtime %q is not available in this build, available runtimes: %s", name, strings.Join(RuntimeNames(), ", "))
+	}
+	defaultRuntime = name
+	return nil
+}
@@ -0,0 +1,25 @@
+package wasm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetDefaultRuntime(t *testing.T) {
+	previous := defaultRuntime
+	defer func() { defaultRuntime = previous }()
+
+	RegisterModuleFactory("test", ModuleFactoryFunc(nil))
+	defer delete(runtimes, "test")
+
+	assert.Contains(t, RuntimeNames(), "test")
+	require.NoError(t, SetDefaultRuntime("test"))
+	assert.Equal(t, "test", defaultRuntime)
+
+	err := SetDefaultRuntime("unknown")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `wasm runtime "unknown" is not available`)
+	assert.Equal(t, "test", defaultRuntime)
+}
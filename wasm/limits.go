@@ -0,0 +1,62 @@
+package wasm
+
+import (
+	"fmt"
+	"time"
+)
+
+// ExecutionLimit is one of the limits of the execution of a module on a
+// single block, enforced by the runtimes, see Registry.
+type ExecutionLimit int
+
+const (
+	ExecutionLimitTimeout ExecutionLimit = iota + 1 // wall-clock time, see Registry.ExecutionTimeout
+	ExecutionLimitFuel                              // WASM instructions executed, see Registry.MaxFuel
+)
+
+func (l ExecutionLimit) String() string {
+	switch l {
+	case ExecutionLimitTimeout:
+		return "timeout"
+	case ExecutionLimitFuel:
+		return "fuel"
+	}
+	return fmt.Sprintf("ExecutionLimit(%d)", int(l))
+}
+
+// LimitExceededError is returned by Module.ExecuteNewCall when the runtime
+// stopped the execution of the module because it hit `Limit`. The instance
+// executing it must not be reused.
+type LimitExceededError struct {
+	Limit    ExecutionLimit
+	Timeout  time.Duration // when Limit is ExecutionLimitTimeout
+	Fuel     uint64        // when Limit is ExecutionLimitFuel
+	BlockNum uint64
+}
+
+func NewTimeoutError(call *Call, timeout time.Duration) *LimitExceededError {
+	return &LimitExceededError{Limit: ExecutionLimitTimeout, Timeout: timeout, BlockNum: call.Clock.Number}
+}
+
+func NewFuelExhaustedError(call *Call, fuel uint64) *LimitExceededError {
+	return &LimitExceededError{Limit: ExecutionLimitFuel, Fuel: fuel, BlockNum: call.Clock.Number}
+}
+
+func (e *LimitExceededError) Error() string {
+	switch e.Limit {
+	case ExecutionLimitTimeout:
+		return fmt.Sprintf("execution on block %d exceeded the timeout of %s", e.BlockNum, e.Timeout)
+	case ExecutionLimitFuel:
+		return fmt.Sprintf("execution on block %d ran out of fuel, the limit is %d", e.BlockNum, e.Fuel)
+	}
+	return fmt.Sprintf("execution on block %d exceeded the %s limit", e.BlockNum, e.Limit)
+}
+
+// Budget is the value of the limit hit: milliseconds for the timeout, fuel
+// units for the fuel.
+func (e *LimitExceededError) Budget() uint64 {
+	if e.Limit == ExecutionLimitTimeout {
+		return uint64(e.Timeout.Milliseconds())
+	}
+	return e.Fuel
+}
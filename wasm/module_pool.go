@@ -0,0 +1,105 @@
+package wasm
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"github.com/streamingfast/substreams/metrics"
+)
+
+// ModulePool keeps the modules of the requests once they are closed, so that
+// the next requests running the same code reuse them warm instead of compiling
+// the code and setting up a runtime again, which dominates the startup of the
+// jobs over small ranges.
+//
+// A module is lent to a single request at a time, and its executions still run
+// in fresh instances, so reusing it has no effect on the outputs. Modules are
+// keyed by runtime and code hash: the registries sharing a pool must have the
+// same extensions and limits.
+type ModulePool struct {
+	maxIdle int
+
+	mu   sync.Mutex
+	idle []idleModule // the least recently released first
+}
+
+type idleModule struct {
+	key    string
+	module Module
+}
+
+// NewModulePool returns a pool keeping up to `maxIdle` modules not used by any
+// request, the least recently used ones being closed first.
+func NewModulePool(maxIdle int) *ModulePool {
+	return &ModulePool{maxIdle: maxIdle}
+}
+
+func modulePoolKey(runtimeName string, wasmCode []byte) string {
+	return fmt.Sprintf("%s/%x", runtimeName, sha256.Sum256(wasmCode))
+}
+
+// get returns an idle module for `key`, or the one created by `newModule`.
+// Closing the module returned releases it to the pool.
+func (p *ModulePool) get(ctx context.Context, key string, newModule func(ctx context.Context) (Module, error)) (Module, error) {
+	if module := p.take(key); module != nil {
+		metrics.WASMModulePoolRequests.Inc("hit")
+		return &pooledModule{Module: module, pool: p, key: key}, nil
+	}
+
+	metrics.WASMModulePoolRequests.Inc("miss")
+	module, err := newModule(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &pooledModule{Module: module, pool: p, key: key}, nil
+}
+
+func (p *ModulePool) take(key string) Module {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i := len(p.idle) - 1; i >= 0; i-- {
+		if p.idle[i].key == key {
+			module := p.idle[i].module
+			p.idle = append(p.idle[:i], p.idle[i+1:]...)
+			return module
+		}
+	}
+	return nil
+}
+
+func (p *ModulePool) release(ctx context.Context, key string, module Module) {
+	p.mu.Lock()
+	p.idle = append(p.idle, idleModule{key: key, module: module})
+	var evicted []idleModule
+	if over := len(p.idle) - p.maxIdle; over > 0 {
+		evicted = append(evicted, p.idle[:over]...)
+		p.idle = append(p.idle[:0], p.idle[over:]...)
+	}
+	p.mu.Unlock()
+
+	for _, idle := range evicted {
+		if err := idle.module.Close(ctx); err != nil {
+			zlog.Warn("closing wasm module evicted from pool", zap.String("key", idle.key), zap.Error(err))
+		}
+	}
+}
+
+// pooledModule is a module lent by a ModulePool, released to it on Close.
+type pooledModule struct {
+	Module
+	pool *ModulePool
+	key  string
+	once sync.Once
+}
+
+func (m *pooledModule) Close(ctx context.Context) error {
+	m.once.Do(func() {
+		m.pool.release(ctx, m.key, m.Module)
+	})
+	return nil
+}
@@ -0,0 +1,55 @@
+package wasm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testModule struct {
+	Module
+	closed bool
+}
+
+func (m *testModule) Close(ctx context.Context) error {
+	m.closed = true
+	return nil
+}
+
+func TestModulePool(t *testing.T) {
+	ctx := context.Background()
+	pool := NewModulePool(1)
+
+	var created []*testModule
+	newModule := func(ctx context.Context) (Module, error) {
+		m := &testModule{}
+		created = append(created, m)
+		return m, nil
+	}
+
+	first, err := pool.get(ctx, "a", newModule)
+	require.NoError(t, err)
+	second, err := pool.get(ctx, "a", newModule)
+	require.NoError(t, err)
+	assert.Len(t, created, 2, "modules in use are not shared")
+
+	require.NoError(t, first.Close(ctx))
+	require.NoError(t, first.Close(ctx))
+	assert.False(t, created[0].closed, "released to the pool")
+
+	reused, err := pool.get(ctx, "a", newModule)
+	require.NoError(t, err)
+	assert.Len(t, created, 2)
+	assert.Same(t, created[0], reused.(*pooledModule).Module)
+
+	_, err = pool.get(ctx, "b", newModule)
+	require.NoError(t, err)
+	assert.Len(t, created, 3, "other code")
+
+	require.NoError(t, second.Close(ctx))
+	require.NoError(t, reused.Close(ctx))
+	assert.True(t, created[1].closed, "least recently released evicted")
+	assert.False(t, created[0].closed)
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"sync"
+	"time"
 
 	"go.uber.org/zap"
 )
@@ -14,8 +16,12 @@ import (
 type Registry struct {
 	Extensions           map[string]map[string]WASMExtension
 	maxFuel              uint64
+	executionTimeout     time.Duration
+	runtimeName          string
 	runtimeStack         ModuleFactory
 	instanceCacheEnabled bool
+	compilationCache     *CompilationCache
+	modulePool           *ModulePool
 }
 
 func (r *Registry) registerWASMExtension(namespace string, importName string, ext WASMExtension) {
@@ -43,10 +49,49 @@ func (r *Registry) registerWASMExtension(namespace string, importName string, ex
 func (r *Registry) MaxFuel() uint64            { return r.maxFuel }
 func (r *Registry) InstanceCacheEnabled() bool { return r.instanceCacheEnabled }
 
+// ExecutionTimeout is the wall-clock time a module may spend executing on a
+// single block, no limit when 0. The runtimes stop the executions exceeding it
+// with a LimitExceededError.
+func (r *Registry) ExecutionTimeout() time.Duration { return r.executionTimeout }
+
+// SetExecutionTimeout sets the ExecutionTimeout of the modules.
+func (r *Registry) SetExecutionTimeout(timeout time.Duration) { r.executionTimeout = timeout }
+
+// CompilationCache returns the cache of compiled modules shared across workers, it can be nil.
+func (r *Registry) CompilationCache() *CompilationCache { return r.compilationCache }
+
+// SetCompilationCache makes the runtime reuse the compiled modules found in `cache`,
+// and publish the ones it compiles.
+func (r *Registry) SetCompilationCache(cache *CompilationCache) { r.compilationCache = cache }
+
+// SetExtensionBreakers guards the extensions of the registry with the circuit
+// breaker of their provider, see ExtensionBreakers. A nil `breakers` is ignored.
+func (r *Registry) SetExtensionBreakers(breakers *ExtensionBreakers) {
+	if breakers == nil {
+		return
+	}
+	for namespace, exts := range r.Extensions {
+		for name, ext := range exts {
+			exts[name] = breakers.wrap(namespace, ext)
+		}
+	}
+}
+
+// SetModulePool makes the registry reuse the modules kept by `pool` and release
+// its modules to it once closed.
+func (r *Registry) SetModulePool(pool *ModulePool) { r.modulePool = pool }
+
 func (r *Registry) NewModule(ctx context.Context, wasmCode []byte) (Module, error) {
+	if r.modulePool != nil {
+		return r.modulePool.get(ctx, modulePoolKey(r.runtimeName, wasmCode), func(ctx context.Context) (Module, error) {
+			return r.runtimeStack.NewModule(ctx, wasmCode, r)
+		})
+	}
 	return r.runtimeStack.NewModule(ctx, wasmCode, r)
 }
 
+var warnFuelNotMetered sync.Once
+
 func NewRegistry(extensions []WASMExtensioner, maxFuel uint64) *Registry {
 	r := &Registry{
 		maxFuel: maxFuel,
@@ -65,7 +110,7 @@ func NewRegistry(extensions []WASMExtensioner, maxFuel uint64) *Registry {
 	}
 	cacheField := zap.Bool("cache_enabled", r.instanceCacheEnabled)
 
-	runtimeName := "wazero" // default
+	runtimeName := defaultRuntime
 	runtime := runtimes[runtimeName]
 	if selectRuntime := os.Getenv("SUBSTREAMS_WASM_RUNTIME"); selectRuntime != "" {
 		selectedRuntime := runtimes[selectRuntime]
@@ -79,7 +124,14 @@ func NewRegistry(extensions []WASMExtensioner, maxFuel uint64) *Registry {
 	} else {
 		zlog.Info("using default wasm runtime", zap.String("runtime", runtimeName), cacheField)
 	}
+	r.runtimeName = runtimeName
 	r.runtimeStack = runtime
 
+	if r.maxFuel != 0 && runtimeName == "wazero" {
+		warnFuelNotMetered.Do(func() {
+			zlog.Warn("the wazero wasm runtime does not meter fuel, the max fuel of the modules is not enforced, select the wasmtime runtime to enforce it")
+		})
+	}
+
 	return r
 }
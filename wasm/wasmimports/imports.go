@@ -0,0 +1,171 @@
+// Package wasmimports reads the host functions imported by the WASM modules
+// from their binary, without compiling them.
+package wasmimports
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// builtinNamespaces are the namespaces of the host functions provided to the
+// modules by all the runtimes.
+var builtinNamespaces = map[string]bool{
+	"env":    true,
+	"state":  true,
+	"logger": true,
+	"block":  true,
+}
+
+// IsBuiltin returns whether the host functions of `namespace` are provided to
+// the modules by all the runtimes.
+func IsBuiltin(namespace string) bool {
+	return builtinNamespaces[namespace]
+}
+
+// Import is a function imported by a WASM module from its host.
+type Import struct {
+	Namespace string
+	Name      string
+}
+
+func (i Import) String() string {
+	return i.Namespace + "::" + i.Name
+}
+
+// Namespaces returns the namespaces of `imports` which are not built in,
+// sorted and deduplicated.
+func Namespaces(imports []Import) (out []string) {
+	seen := make(map[string]bool)
+	for _, imp := range imports {
+		if IsBuiltin(imp.Namespace) || seen[imp.Namespace] {
+			continue
+		}
+		seen[imp.Namespace] = true
+		out = append(out, imp.Namespace)
+	}
+	sort.Strings(out)
+	return out
+}
+
+var wasmMagic = []byte{0x00, 'a', 's', 'm'}
+
+const importSectionID = 2
+
+// FunctionImports returns the functions imported by the WASM module `code`,
+// read from its import section without compiling it.
+func FunctionImports(code []byte) ([]Import, error) {
+	if len(code) < 8 || !bytes.Equal(code[:4], wasmMagic) {
+		return nil, errors.New("not a wasm module")
+	}
+
+	r := &wasmReader{data: code[8:]}
+	for !r.done() {
+		id := r.byte()
+		size := r.u32()
+		section := r.bytes(size)
+		if r.err != nil {
+			return nil, fmt.Errorf("reading wasm sections: %w", r.err)
+		}
+		if id == importSectionID {
+			imports, err := readImportSection(section)
+			if err != nil {
+				return nil, fmt.Errorf("reading wasm import section: %w", err)
+			}
+			return imports, nil
+		}
+	}
+	return nil, nil
+}
+
+func readImportSection(section []byte) (out []Import, err error) {
+	r := &wasmReader{data: section}
+	count := r.u32()
+	for i := uint32(0); i < count && r.err == nil; i++ {
+		imp := Import{
+			Namespace: string(r.bytes(r.u32())),
+			Name:      string(r.bytes(r.u32())),
+		}
+
+		switch kind := r.byte(); kind {
+		case 0x00: // function, by type index
+			r.u32()
+			out = append(out, imp)
+		case 0x01: // table, by reference type and limits
+			r.byte()
+			r.limits()
+		case 0x02: // memory
+			r.limits()
+		case 0x03: // global, by value type and mutability
+			r.byte()
+			r.byte()
+		default:
+			return nil, fmt.Errorf("import %s: unknown kind 0x%02x", imp, kind)
+		}
+	}
+	return out, r.err
+}
+
+// wasmReader reads the values of the WASM binary format, its first error
+// making the next reads no-ops.
+type wasmReader struct {
+	data []byte
+	err  error
+}
+
+var errTruncated = errors.New("truncated wasm module")
+
+func (r *wasmReader) done() bool {
+	return r.err != nil || len(r.data) == 0
+}
+
+func (r *wasmReader) byte() byte {
+	if r.err != nil {
+		return 0
+	}
+	if len(r.data) == 0 {
+		r.err = errTruncated
+		return 0
+	}
+	b := r.data[0]
+	r.data = r.data[1:]
+	return b
+}
+
+// u32 reads an unsigned LEB128 integer.
+func (r *wasmReader) u32() (out uint32) {
+	for shift := 0; shift < 35; shift += 7 {
+		b := r.byte()
+		if r.err != nil {
+			return 0
+		}
+		out |= uint32(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return out
+		}
+	}
+	r.err = errors.New("invalid wasm integer")
+	return 0
+}
+
+func (r *wasmReader) bytes(n uint32) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if uint64(n) > uint64(len(r.data)) {
+		r.err = errTruncated
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *wasmReader) limits() {
+	flags := r.byte()
+	r.u32()
+	if flags&0x01 != 0 {
+		r.u32()
+	}
+}
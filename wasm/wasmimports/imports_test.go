@@ -0,0 +1,47 @@
+package wasmimports
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// importingModule imports the functions `env::output`, `crypto::keccak256` and
+// `crypto::unknown`, and a memory from `env`.
+var importingModule = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00,
+	// types: (i32, i32) -> ()
+	0x01, 0x06, 0x01, 0x60, 0x02, 0x7f, 0x7f, 0x00,
+	// imports
+	0x02, 0x41, 0x04,
+	0x03, 'e', 'n', 'v', 0x06, 'o', 'u', 't', 'p', 'u', 't', 0x00, 0x00,
+	0x03, 'e', 'n', 'v', 0x06, 'm', 'e', 'm', 'o', 'r', 'y', 0x02, 0x01, 0x01, 0x02,
+	0x06, 'c', 'r', 'y', 'p', 't', 'o', 0x09, 'k', 'e', 'c', 'c', 'a', 'k', '2', '5', '6', 0x00, 0x00,
+	0x06, 'c', 'r', 'y', 'p', 't', 'o', 0x07, 'u', 'n', 'k', 'n', 'o', 'w', 'n', 0x00, 0x00,
+}
+
+func TestFunctionImports(t *testing.T) {
+	imports, err := FunctionImports(importingModule)
+	require.NoError(t, err)
+	assert.Equal(t, []Import{
+		{Namespace: "env", Name: "output"},
+		{Namespace: "crypto", Name: "keccak256"},
+		{Namespace: "crypto", Name: "unknown"},
+	}, imports)
+
+	_, err = FunctionImports(importingModule[:30])
+	assert.Error(t, err)
+	_, err = FunctionImports([]byte("not wasm"))
+	assert.Error(t, err)
+}
+
+func TestNamespaces(t *testing.T) {
+	assert.Equal(t, []string{"bigdecimal", "crypto"}, Namespaces([]Import{
+		{Namespace: "env", Name: "output"},
+		{Namespace: "crypto", Name: "keccak256"},
+		{Namespace: "bigdecimal", Name: "add"},
+		{Namespace: "crypto", Name: "unknown"},
+	}))
+	assert.Empty(t, Namespaces([]Import{{Namespace: "state", Name: "get_last"}}))
+}
@@ -1,3 +1,5 @@
+//go:build cgo
+
 package wasmtime
 
 import (
@@ -71,6 +73,10 @@ func (i *instance) newImports() error {
 	if err != nil {
 		return fmt.Errorf("registering state imports: %w", err)
 	}
+	err = i.registerBlockImports(linker)
+	if err != nil {
+		return fmt.Errorf("registering block imports: %w", err)
+	}
 
 	if err = linker.FuncWrap("env", "register_panic",
 		func(msgPtr, msgLength int32, filenamePtr, filenameLength int32, lineNumber, columnNumber int32, caller *wasmtime.Caller) {
@@ -111,12 +117,37 @@ func (i *instance) registerLoggerImports(linker *wasmtime.Linker) error {
 	return nil
 }
 
+func (i *instance) registerBlockImports(linker *wasmtime.Linker) error {
+	functions := map[string]interface{}{}
+	functions["number"] = func() int64 { return int64(i.CurrentCall.BlockNumber()) }
+	functions["id"] = func(outputPtr int32) {
+		if err := writeOutputToHeap(i, outputPtr, []byte(i.CurrentCall.BlockID())); err != nil {
+			i.CurrentCall.ReturnError(fmt.Errorf("writing output to heap: %w", err))
+		}
+	}
+	functions["timestamp"] = func() int64 { return i.CurrentCall.BlockTimestamp() }
+	functions["is_final"] = func() int32 {
+		if i.CurrentCall.BlockIsFinal() {
+			return 1
+		}
+		return 0
+	}
+
+	for n, f := range functions {
+		if err := linker.FuncWrap("block", n, f); err != nil {
+			return fmt.Errorf("registering %s import: %w", n, err)
+		}
+	}
+	return nil
+}
+
 func (i *instance) registerStateImports(linker *wasmtime.Linker) error {
 	functions := map[string]interface{}{}
 	functions["set"] = i.set
 	functions["set_if_not_exists"] = i.setIfNotExists
 	functions["append"] = i.append
 	functions["delete_prefix"] = i.deletePrefix
+	functions["delete_range"] = i.deleteRange
 	functions["add_bigint"] = i.addBigInt
 	functions["add_bigdecimal"] = i.addBigDecimal
 	functions["add_bigfloat"] = i.addBigDecimal
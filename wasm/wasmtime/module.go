@@ -1,11 +1,20 @@
+//go:build cgo
+
 package wasmtime
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	wasmtime "github.com/bytecodealliance/wasmtime-go/v4"
+	"go.uber.org/zap"
 
+	"github.com/streamingfast/substreams/reqctx"
 	"github.com/streamingfast/substreams/wasm"
 )
 
@@ -21,12 +30,25 @@ func init() {
 
 func newModule(ctx context.Context, wasmCode []byte, registry *wasm.Registry) (wasm.Module, error) {
 	cfg := wasmtime.NewConfig()
+	var variants []string // of the compiled code
 	if registry.MaxFuel() != 0 {
 		cfg.SetConsumeFuel(true)
+		variants = append(variants, "fuel")
+	}
+	if registry.ExecutionTimeout() != 0 {
+		// the executions check the epoch of the engine, incremented at their deadline
+		cfg.SetEpochInterruption(true)
+		variants = append(variants, "epoch")
 	}
 	engine := wasmtime.NewEngineWithConfig(cfg)
 
-	module, err := wasmtime.NewModule(engine, wasmCode)
+	var module *wasmtime.Module
+	var err error
+	if compilationCache := registry.CompilationCache(); compilationCache != nil {
+		module, err = newCachedModule(ctx, compilationCache, engine, strings.Join(variants, "-"), wasmCode)
+	} else {
+		module, err = wasmtime.NewModule(engine, wasmCode)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("creating new module: %w", err)
 	}
@@ -41,6 +63,55 @@ func newModule(ctx context.Context, wasmCode []byte, registry *wasm.Registry) (w
 	}, nil
 }
 
+const serializedModuleFilename = "module.bin"
+
+// newCachedModule deserializes the module previously compiled for `wasmCode` from
+// `compilationCache`, or compiles and publishes it. Cache errors are logged, the
+// module then gets compiled without the cache.
+func newCachedModule(ctx context.Context, compilationCache *wasm.CompilationCache, engine *wasmtime.Engine, variant string, wasmCode []byte) (*wasmtime.Module, error) {
+	logger := reqctx.Logger(ctx)
+
+	key := wasm.CompilationCacheKey("wasmtime", "github.com/bytecodealliance/wasmtime-go/v4", variant, wasmCode)
+	dir, found, err := compilationCache.Fetch(ctx, key)
+	if err != nil {
+		logger.Warn("cannot fetch compiled wasm module from cache, compiling", zap.String("key", key), zap.Error(err))
+		return wasmtime.NewModule(engine, wasmCode)
+	}
+
+	if found {
+		serialized, err := wasm.ReadArtifact(dir, serializedModuleFilename)
+		if err == nil {
+			var module *wasmtime.Module
+			if module, err = wasmtime.NewModuleDeserialize(engine, serialized); err == nil {
+				return module, nil
+			}
+		}
+		logger.Warn("cannot deserialize cached wasm module, compiling", zap.String("key", key), zap.Error(err))
+		return wasmtime.NewModule(engine, wasmCode)
+	}
+
+	module, err := wasmtime.NewModule(engine, wasmCode)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	serialized, err := module.Serialize()
+	if err == nil {
+		err = os.WriteFile(filepath.Join(dir, serializedModuleFilename), serialized, 0644)
+	}
+	if err == nil {
+		err = compilationCache.Publish(ctx, key, dir)
+	} else {
+		os.RemoveAll(dir)
+	}
+	if err != nil {
+		logger.Warn("cannot publish compiled wasm module to cache", zap.String("key", key), zap.Error(err))
+	}
+
+	return module, nil
+}
+
 func (m *Module) Close(ctx context.Context) error {
 	m.engine.FreeMem()
 	return nil
@@ -70,11 +141,21 @@ func (m *Module) ExecuteNewCall(ctx context.Context, call *wasm.Call, cachedInst
 	}
 
 	maxFuel := m.registry.MaxFuel()
+	var fuelConsumedBefore uint64
 	if maxFuel != 0 {
 		if remaining, _ := inst.wasmStore.ConsumeFuel(maxFuel); remaining != 0 {
 			inst.wasmStore.ConsumeFuel(remaining) // don't accumulate fuel from previous executions
 		}
 		inst.wasmStore.AddFuel(maxFuel)
+		fuelConsumedBefore, _ = inst.wasmStore.FuelConsumed()
+	}
+
+	timeout := m.registry.ExecutionTimeout()
+	if timeout != 0 {
+		// interrupted at the next increment of the epoch, past the deadline
+		inst.wasmStore.SetEpochDeadline(1)
+		timer := time.AfterFunc(timeout, m.engine.IncrementEpoch)
+		defer timer.Stop()
 	}
 
 	var args []interface{}
@@ -102,6 +183,15 @@ func (m *Module) ExecuteNewCall(ctx context.Context, call *wasm.Call, cachedInst
 	inst.CurrentCall = call
 	_, err = entrypoint.Call(inst.wasmStore, args...)
 	if err != nil {
+		var trap *wasmtime.Trap
+		if timeout != 0 && errors.As(err, &trap) && trap.Code() != nil && *trap.Code() == wasmtime.Interrupt {
+			return inst, wasm.NewTimeoutError(call, timeout)
+		}
+		if maxFuel != 0 {
+			if consumed, _ := inst.wasmStore.FuelConsumed(); consumed-fuelConsumedBefore >= maxFuel {
+				return inst, wasm.NewFuelExhaustedError(call, maxFuel)
+			}
+		}
 		return inst, fmt.Errorf("call: %w", err)
 	}
 
@@ -0,0 +1,72 @@
+//go:build cgo
+
+package wasmtime
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
+	"github.com/streamingfast/substreams/wasm"
+)
+
+// loopingModule exports `alloc`, `dealloc` and `run`, looping forever.
+var loopingModule = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00,
+	// types: (i32) -> i32, (i32, i32) -> (), () -> ()
+	0x01, 0x0e, 0x03, 0x60, 0x01, 0x7f, 0x01, 0x7f, 0x60, 0x02, 0x7f, 0x7f, 0x00, 0x60, 0x00, 0x00,
+	// functions
+	0x03, 0x04, 0x03, 0x00, 0x01, 0x02,
+	// memory
+	0x05, 0x03, 0x01, 0x00, 0x01,
+	// exports
+	0x07, 0x22, 0x04,
+	0x06, 'm', 'e', 'm', 'o', 'r', 'y', 0x02, 0x00,
+	0x05, 'a', 'l', 'l', 'o', 'c', 0x00, 0x00,
+	0x07, 'd', 'e', 'a', 'l', 'l', 'o', 'c', 0x00, 0x01,
+	0x03, 'r', 'u', 'n', 0x00, 0x02,
+	// code: alloc returns 0, dealloc does nothing, run is `loop br 0 end`
+	0x0a, 0x11, 0x03,
+	0x04, 0x00, 0x41, 0x00, 0x0b,
+	0x02, 0x00, 0x0b,
+	0x07, 0x00, 0x03, 0x40, 0x0c, 0x00, 0x0b, 0x0b,
+}
+
+func TestModule_ExecutionLimits(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name         string
+		maxFuel      uint64
+		timeout      time.Duration
+		expectLimit  wasm.ExecutionLimit
+		expectBudget uint64
+	}{
+		{"fuel", 1000, 0, wasm.ExecutionLimitFuel, 1000},
+		{"timeout", 0, 50 * time.Millisecond, wasm.ExecutionLimitTimeout, 50},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			registry := wasm.NewRegistry(nil, test.maxFuel)
+			registry.SetExecutionTimeout(test.timeout)
+
+			module, err := newModule(ctx, loopingModule, registry)
+			require.NoError(t, err)
+			defer module.Close(ctx)
+
+			call := wasm.NewCall(&pbsubstreams.Clock{Number: 42}, "map_loop", "run", nil)
+			_, err = module.ExecuteNewCall(ctx, call, nil, nil)
+
+			var limitErr *wasm.LimitExceededError
+			require.ErrorAs(t, err, &limitErr)
+			assert.Equal(t, test.expectLimit, limitErr.Limit)
+			assert.Equal(t, test.expectBudget, limitErr.Budget())
+			assert.Equal(t, uint64(42), limitErr.BlockNum)
+		})
+	}
+}
@@ -1,3 +1,5 @@
+//go:build cgo
+
 package wasmtime
 
 import (
@@ -27,6 +29,12 @@ func (i *instance) deletePrefix(ord int64, keyPtr, keyLength int32) {
 	i.CurrentCall.DoDeletePrefix(uint64(ord), prefix)
 }
 
+func (i *instance) deleteRange(ord int64, startKeyPtr, startKeyLength, endKeyPtr, endKeyLength int32) {
+	startKey := i.Heap.ReadString(startKeyPtr, startKeyLength)
+	endKey := i.Heap.ReadString(endKeyPtr, endKeyLength)
+	i.CurrentCall.DoDeleteRange(uint64(ord), startKey, endKey)
+}
+
 func (i *instance) addBigInt(ord int64, keyPtr, keyLength, valPtr, valLength int32) {
 	key := i.Heap.ReadString(keyPtr, keyLength)
 	value := i.Heap.ReadString(valPtr, valLength)
@@ -0,0 +1,56 @@
+package wazero
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/tetratelabs/wazero/api"
+
+	"github.com/streamingfast/substreams/wasm"
+)
+
+var blockFuncs = []funcs{
+	{
+		"number",
+		[]parm{},
+		[]parm{i64},
+		api.GoModuleFunc(func(ctx context.Context, mod api.Module, stack []uint64) {
+			call := wasm.FromContext(ctx)
+
+			stack[0] = call.BlockNumber()
+		}),
+	},
+	{
+		"id",
+		[]parm{i32}, // output ptr
+		[]parm{},
+		api.GoModuleFunc(func(ctx context.Context, mod api.Module, stack []uint64) {
+			outputPtr := uint32(stack[0])
+			call := wasm.FromContext(ctx)
+
+			if err := writeOutputToHeap(ctx, instanceFromContext(ctx), outputPtr, []byte(call.BlockID())); err != nil {
+				call.ReturnError(fmt.Errorf("writing output to heap: %w", err))
+			}
+		}),
+	},
+	{
+		"timestamp",
+		[]parm{},
+		[]parm{i64},
+		api.GoModuleFunc(func(ctx context.Context, mod api.Module, stack []uint64) {
+			call := wasm.FromContext(ctx)
+
+			stack[0] = api.EncodeI64(call.BlockTimestamp())
+		}),
+	},
+	{
+		"is_final",
+		[]parm{},
+		[]parm{i32},
+		api.GoModuleFunc(func(ctx context.Context, mod api.Module, stack []uint64) {
+			call := wasm.FromContext(ctx)
+
+			setStack0Bool(stack, call.BlockIsFinal())
+		}),
+	},
+}
@@ -2,12 +2,15 @@ package wazero
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
 	"sync"
 	"time"
 
 	"github.com/tetratelabs/wazero"
 	"github.com/tetratelabs/wazero/api"
+	"go.uber.org/zap"
 
 	"github.com/streamingfast/substreams/reqctx"
 	"github.com/streamingfast/substreams/wasm"
@@ -21,6 +24,8 @@ type Module struct {
 	wazModuleConfig wazero.ModuleConfig
 	hostModules     []wazero.CompiledModule
 	userModule      wazero.CompiledModule
+	cache           wazero.CompilationCache
+	timeout         time.Duration // of the execution on a block, see wasm.Registry.ExecutionTimeout
 }
 
 func init() {
@@ -30,8 +35,26 @@ func init() {
 func newModule(ctx context.Context, wasmCode []byte, registry *wasm.Registry) (wasm.Module, error) {
 	// What's the effect of `ctx` here? Will it kill all the WASM if it cancels?
 	// TODO: try with: wazero.NewRuntimeConfigCompiler()
-	// TODO: try config := wazero.NewRuntimeConfig().WithCompilationCache(cache)
 	runtimeConfig := wazero.NewRuntimeConfigCompiler()
+	if registry.ExecutionTimeout() != 0 {
+		// the executions check their context periodically, to stop at its deadline
+		runtimeConfig = runtimeConfig.WithCloseOnContextDone(true)
+	}
+
+	var cache wazero.CompilationCache
+	var publishToCache func(compiled bool)
+	if compilationCache := registry.CompilationCache(); compilationCache != nil {
+		cache, publishToCache = setupCompilationCache(ctx, compilationCache, wasmCode)
+		if cache != nil {
+			runtimeConfig = runtimeConfig.WithCompilationCache(cache)
+		}
+	}
+	compiled := false
+	defer func() {
+		if publishToCache != nil {
+			publishToCache(compiled)
+		}
+	}()
 	// TODO: can we use some caching in the RuntimeConfig so perhaps we reuse
 	// things across runtimes creations?
 	runtime := wazero.NewRuntimeWithConfig(ctx, runtimeConfig)
@@ -51,7 +74,11 @@ func newModule(ctx context.Context, wasmCode []byte, registry *wasm.Registry) (w
 	if err != nil {
 		return nil, err
 	}
-	hostModules = append(hostModules, envModule, stateModule, loggerModule)
+	blockModule, err := addHostFunctions(ctx, runtime, "block", blockFuncs)
+	if err != nil {
+		return nil, err
+	}
+	hostModules = append(hostModules, envModule, stateModule, loggerModule, blockModule)
 
 	// TODO: where to `Close()` the `runtime` here?
 	// One runtime per request?
@@ -59,6 +86,7 @@ func newModule(ctx context.Context, wasmCode []byte, registry *wasm.Registry) (w
 	if err != nil {
 		return nil, fmt.Errorf("creating new module: %w", err)
 	}
+	compiled = true
 
 	funcs := mod.ExportedFunctions()
 	if funcs["alloc"] == nil {
@@ -73,9 +101,48 @@ func newModule(ctx context.Context, wasmCode []byte, registry *wasm.Registry) (w
 		wazRuntime:      runtime,
 		userModule:      mod,
 		hostModules:     hostModules,
+		cache:           cache,
+		timeout:         registry.ExecutionTimeout(),
 	}, nil
 }
 
+// setupCompilationCache returns a wazero compilation cache backed by the local directory
+// of `compilationCache` for `wasmCode`, and the function publishing the compiled module,
+// or discarding the directory when the module was not compiled, when it was not found
+// in the cache. Errors are logged, the module then gets compiled without a cache.
+func setupCompilationCache(ctx context.Context, compilationCache *wasm.CompilationCache, wasmCode []byte) (wazero.CompilationCache, func(compiled bool)) {
+	logger := reqctx.Logger(ctx)
+
+	key := wasm.CompilationCacheKey("wazero", "github.com/tetratelabs/wazero", "", wasmCode)
+	dir, found, err := compilationCache.Fetch(ctx, key)
+	if err != nil {
+		logger.Warn("cannot fetch compiled wasm module from cache, compiling", zap.String("key", key), zap.Error(err))
+		return nil, nil
+	}
+
+	cache, err := wazero.NewCompilationCacheWithDir(dir)
+	if err != nil {
+		logger.Warn("cannot setup wasm compilation cache, compiling without it", zap.String("key", key), zap.Error(err))
+		if !found {
+			os.RemoveAll(dir)
+		}
+		return nil, nil
+	}
+	if found {
+		return cache, nil
+	}
+
+	return cache, func(compiled bool) {
+		if !compiled {
+			os.RemoveAll(dir)
+			return
+		}
+		if err := compilationCache.Publish(ctx, key, dir); err != nil {
+			logger.Warn("cannot publish compiled wasm module to cache", zap.String("key", key), zap.Error(err))
+		}
+	}
+}
+
 func (m *Module) Close(ctx context.Context) error {
 	closeFuncs := []func(context.Context) error{
 		m.wazRuntime.Close,
@@ -84,6 +151,9 @@ func (m *Module) Close(ctx context.Context) error {
 	for _, hostMod := range m.hostModules {
 		closeFuncs = append(closeFuncs, hostMod.Close)
 	}
+	if m.cache != nil {
+		closeFuncs = append(closeFuncs, m.cache.Close)
+	}
 	for _, f := range closeFuncs {
 		if err := f(ctx); err != nil {
 			return err
@@ -130,8 +200,18 @@ func (m *Module) ExecuteNewCall(ctx context.Context, call *wasm.Call, cachedInst
 		}
 	}
 
-	_, err = f.Call(wasm.WithContext(withInstanceContext(ctx, inst), call), args...)
+	callCtx := ctx
+	if m.timeout != 0 {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithTimeout(ctx, m.timeout)
+		defer cancel()
+	}
+
+	_, err = f.Call(wasm.WithContext(withInstanceContext(callCtx, inst), call), args...)
 	if err != nil {
+		if ctx.Err() == nil && errors.Is(callCtx.Err(), context.DeadlineExceeded) {
+			return inst, wasm.NewTimeoutError(call, m.timeout)
+		}
 		return inst, fmt.Errorf("call: %w", err)
 	}
 
@@ -75,6 +75,19 @@ var stateFuncs = []funcs{
 			call.DoDeletePrefix(ord, prefix)
 		}),
 	},
+	{
+		"delete_range",
+		[]parm{i64, i32, i32, i32, i32},
+		[]parm{},
+		api.GoModuleFunc(func(ctx context.Context, mod api.Module, stack []uint64) {
+			ord := stack[0]
+			startKey := readStringFromStack(mod, stack[1:])
+			endKey := readStringFromStack(mod, stack[3:])
+			call := wasm.FromContext(ctx)
+
+			call.DoDeleteRange(ord, startKey, endKey)
+		}),
+	},
 	{
 		"add_bigint",
 		[]parm{i64, i32, i32, i32, i32},